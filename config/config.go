@@ -2,18 +2,57 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	RTSP     RTSPConfig
-	MediaMTX MediaMTXConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	JWT         JWTConfig
+	RTSP        RTSPConfig
+	Watchdog    WatchdogConfig
+	MediaMTX    MediaMTXConfig
+	WebRTC      WebRTCConfig
+	FFmpeg      FFmpegConfig
+	Tamper      TamperConfig
+	Quality     QualityConfig
+	Snapshot    SnapshotConfig
+	Thumbnail   CameraThumbnailConfig
+	Motion      MotionConfig
+	Metadata    MetadataConfig
+	Intercom    IntercomConfig
+	Patrol      PatrolConfig
+	Visitor     VisitorConfig
+	Weather     WeatherConfig
+	Webhook     WebhookConfig
+	Vault       VaultConfig
+	Secrets     SecretsConfig
+	Health      HealthConfig
+	SMTP        SMTPConfig
+	Digest      DigestConfig
+	Notify      NotifyConfig
+	LoadTest    LoadTestConfig
+	Analytics   AnalyticsConfig
+	Idempotency IdempotencyConfig
+	ClientLog   ClientLogConfig
+	Network     NetworkConfig
+	StreamToken StreamTokenConfig
+	Export      ExportConfig
+	Recording   RecordingConfig
+	Directory   DirectoryConfig
+	OIDC        OIDCConfig
+	Cluster     ClusterConfig
+	StreamIdle  StreamIdleConfig
+	Features    FeatureFlagsConfig
+	Tracing     TracingConfig
 }
 
 type ServerConfig struct {
-	Port string
+	Port        string
+	Environment string // production, staging, development; chaos endpoints are disabled in production
+	V1Sunset    string // YYYY-MM-DD announced in the Sunset header of /api/v1 responses ("" = none yet)
 }
 
 type DatabaseConfig struct {
@@ -23,11 +62,52 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	SlowQueryThreshold time.Duration // Queries slower than this are logged with their handler (0 = disabled)
+
+	// Credentials, when set, is asked for the user and password of every new
+	// connection so rotated ones are picked up; set from the secret store
+	Credentials func() (user, password string)
 }
 
 type JWTConfig struct {
-	Secret string
-	Expiry string
+	Secret        string
+	Expiry        string        // Access token lifetime
+	RefreshExpiry time.Duration // Session (refresh token) lifetime
+}
+
+// DirectoryConfig syncs users' phone, department and photo from an LDAP
+// directory such as Active Directory, matching users by email
+type DirectoryConfig struct {
+	URL          string // ldap://host:389 or ldaps://host:636 ("" = sync disabled)
+	BindDN       string // Service account, e.g. CN=vms-sync,OU=Service,DC=corp,DC=example
+	BindPassword string
+	BaseDN       string        // Where users are searched, e.g. DC=corp,DC=example
+	SyncInterval time.Duration // How often all users are synced
+
+	// Attribute names; the defaults are Active Directory's
+	MailAttribute       string
+	PhoneAttribute      string
+	DepartmentAttribute string
+	PhotoAttribute      string // JPEG photo
+}
+
+// OIDCConfig signs users in through an OpenID Connect provider (the
+// authorization code flow with PKCE), creating their account on first login
+type OIDCConfig struct {
+	Issuer       string // e.g. https://login.microsoftonline.com/<tenant>/v2.0 ("" = SSO disabled)
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // The backend's callback as the browser reaches it, registered at the provider
+	FrontendURL  string   // Where the browser is sent after login, with the tokens in the URL fragment
+	Scopes       []string // Requested scopes; openid is always added
+	EmailClaim   string
+	NameClaim    string
+	RoleClaim    string              // Claim listing the user's groups or roles
+	RoleMapping  map[string][]string // Role -> claim values granting it
+	DefaultRole  string              // Role of new users no mapping matches ("" = they are refused)
+	AutoCreate   bool                // Create users on first login; otherwise only existing emails can sign in
+	LinkExisting bool                // Let a provider account take over an existing account of its email on first login
 }
 
 type RTSPConfig struct {
@@ -35,17 +115,275 @@ type RTSPConfig struct {
 	OutputPath string
 }
 
+// WatchdogConfig is the stream watchdog of MediaMTX paths and legacy HLS
+// streams: each camera's data cadence and reconnect time are learned, and
+// its restart thresholds derived from them
+type WatchdogConfig struct {
+	Adaptive     bool          // Learn per-camera thresholds instead of always using the defaults below
+	StallTimeout time.Duration // Time without new data that restarts a stream until its cadence is learned
+	StartupGrace time.Duration // Wait for a legacy FFmpeg's first segment until the reconnect time is learned
+	MinTimeout   time.Duration // Learned thresholds are kept within min and max
+	MaxTimeout   time.Duration
+}
+
 type MediaMTXConfig struct {
-	Host       string // Internal hostname (for backend to communicate with MediaMTX)
-	PublicHost string // Public hostname (for frontend/browser to access HLS streams)
-	HTTPPort   string
-	APIPort    string
+	Host                 string // Internal hostname (for backend to communicate with MediaMTX)
+	PublicHost           string // Public hostname (for frontend/browser to access HLS streams)
+	HTTPPort             string
+	APIPort              string
+	APIVersion           string // MediaMTX control API: auto (detected), v2 (before v1.0) or v3 (v1.x)
+	RTSPPort             string // MediaMTX RTSP port (transcoded streams are published here)
+	TranscodeUnsupported bool   // Transcode cameras without H.264 (e.g. H.265-only) to H.264
+	HEVCPassthrough      bool   // Serve H.265 as-is (only when MediaMTX uses the fmp4 HLS variant)
+	SharedIngest         bool   // Backend pipelines read cameras through their MediaMTX path instead of pulling them again
+
+	HealthInterval    time.Duration // How often the MediaMTX path list is polled for health endpoints
+	ReconcileInterval time.Duration // How often orphan paths are removed and lost ones re-registered (0 = only at startup)
+	AuthCallbackURL   string        // Backend stream auth endpoint as MediaMTX reaches it, set in MediaMTX through its API ("" = configured by hand)
+	InternalUser      string        // RTSP credentials backend pipelines read MediaMTX with, so the auth callback tells them from outside readers
+	InternalPassword  string        // ("" = backend reads are only recognized by address)
 }
 
+type WebRTCConfig struct {
+	H264Passthrough bool     // Forward H.264 without re-encoding to VP8
+	H264Profiles    []string // Profiles forwarded for cameras on auto: baseline, main, high
+}
+
+type FFmpegConfig struct {
+	MaxProcesses int // Cap on concurrent WebRTC/MJPEG/audio transcodes (0 = unlimited)
+
+	Path          string  // FFmpeg binary, looked up in PATH unless absolute
+	Nice          int     // Scheduling niceness FFmpeg runs at, 0-19 (0 = the backend's)
+	User          string  // Run FFmpeg as this user; needs the backend to run as root (Linux)
+	Cgroup        string  // cgroup v2 directory all FFmpeg processes run in (Linux, empty = none)
+	CPULimit      float64 // CPU cores all FFmpeg processes may use together (0 = unlimited, needs Cgroup)
+	MemoryLimitMB int     // Memory all FFmpeg processes may use together (0 = unlimited, needs Cgroup)
+	LogLines      int     // stderr lines kept per camera and pipeline for the stream logs API
+}
+
+type TamperConfig struct {
+	CheckInterval time.Duration // How often tamper detection snapshots cameras (0 = disabled)
+}
+
+type SnapshotConfig struct {
+	MaxAge        time.Duration // Snapshots younger than this are served from cache
+	Width         int           // Snapshots are scaled to this width, keeping the aspect ratio
+	MaxConcurrent int           // Cap on concurrent snapshot captures
+	MaxBursts     int           // Cap on concurrent snapshot bursts, apart from MaxConcurrent
+}
+
+type CameraThumbnailConfig struct {
+	Interval time.Duration // How often every online camera's thumbnail is refreshed (0 = disabled)
+	Width    int           // Thumbnails are scaled to this width, keeping the aspect ratio
+	Dir      string        // Thumbnails are stored as <Dir>/cam<id>.jpg unless S3Bucket is set
+
+	// S3-compatible object store (AWS S3, MinIO, ...), used when S3Bucket is set
+	S3Endpoint  string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	S3Region    string
+	S3Bucket    string
+	S3Prefix    string // Key prefix, e.g. "thumbnails/"
+	S3AccessKey string
+	S3SecretKey string
+}
+
+type QualityConfig struct {
+	CheckInterval  time.Duration // How often image quality is sampled per camera (0 = disabled)
+	BaselineWindow time.Duration // A camera's past samples within this are its normal quality
+	Retention      time.Duration // Samples older than this are deleted
+}
+
+type MotionConfig struct {
+	SceneThreshold float64       // FFmpeg scene change score (0-1) a frame must exceed to count as motion
+	Cooldown       time.Duration // Changed frames within this of the last motion event belong to it
+	SnapshotDir    string        // Motion snapshots are written under <SnapshotDir>/cam<id>/
+	Retention      time.Duration // Motion events and snapshots older than this are deleted (0 = kept)
+}
+
+type MetadataConfig struct {
+	MinConfidence float64       // Detections the camera is less sure of (0-1) are dropped
+	Cooldown      time.Duration // Repeats of a detection type on a camera within this are one event
+}
+
+type IntercomConfig struct {
+	RingTimeout time.Duration // Unanswered calls are marked missed after this
+	DoorPulse   time.Duration // How long the door relay is held active on a door release
+}
+
+type PatrolConfig struct {
+	BookmarkRadius float64       // Cameras within this many meters of a check-in are bookmarked
+	BookmarkWindow time.Duration // Footage bookmarked before and after the check-in
+}
+
+type VisitorConfig struct {
+	LobbyCameraID  uint          // Camera snapshotted at check-in when the request names none (0 = none)
+	SnapshotDir    string        // Check-in snapshots are written under <SnapshotDir>/<date>/
+	PlaybackWindow time.Duration // Footage linked before and after the check-in
+
+	SnapshotRetention time.Duration // Check-in snapshots older than this are deleted (0 = kept forever)
+}
+
+type WeatherConfig struct {
+	ProviderURL     string        // Open-Meteo compatible forecast API ("" = disabled)
+	RefreshInterval time.Duration // How often the weather of every site is fetched
+}
+
+type WebhookConfig struct {
+	Timeout     time.Duration // Per delivery attempt
+	MaxAttempts int           // Attempts before a delivery is marked failed
+	RetryBase   time.Duration // Delay before the first retry, doubled for every retry after
+	RetryMax    time.Duration // Longest delay between retries
+	Retention   time.Duration // How long the delivery log is kept
+
+	AllowPrivateTargets bool // Accept webhooks to private networks; loopback and link-local are always refused
+}
+
+type HealthConfig struct {
+	CheckInterval time.Duration // How often every camera is probed for health history (0 = disabled)
+}
+
+type SMTPConfig struct {
+	Host     string // Empty disables outgoing mail
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+type DigestConfig struct {
+	SendAt         string   // HH:MM server time the morning digest goes out ("" = disabled)
+	WindowStart    string   // HH:MM the previous day the digest window starts, e.g. 18:00
+	RecipientRoles []string // Users with these roles receive the digest
+}
+
+type NotifyConfig struct {
+	SMSGatewayURL   string        // POSTed {"to","message"} as JSON for SMS alerts ("" = SMS disabled)
+	SMSGatewayToken string        // Sent as a Bearer token to the gateway
+	DigestInterval  time.Duration // How often alerts routed to the digest (or held by quiet hours) are emailed
+}
+
+type LoadTestConfig struct {
+	Cameras         int    // Synthetic cameras backed by FFmpeg test sources (0 = load test mode off)
+	Resolution      string // Test source size, e.g. 640x360
+	FPS             int
+	EventsPerMinute int // Synthetic motion events across the synthetic cameras (0 = none)
+}
+
+type AnalyticsConfig struct {
+	ExportMinCount int // Export rows counting fewer events are suppressed so individuals can't be singled out
+}
+
+type RecordingConfig struct {
+	Dir               string        // Recording segments are written under <Dir>/cam<id>/
+	SegmentDuration   time.Duration // Length of each recorded file
+	ThumbnailInterval time.Duration // Time between the preview thumbnails of a recording's sprite
+	Retention         time.Duration // Completed segments older than this are deleted (0 = kept)
+	ClipRetention     time.Duration // Clips cut around events and bookmarks before pruning are kept this long (0 = no clips)
+	ClipPadding       time.Duration // Footage kept before and after each event or bookmark
+	ClipSeverities    []string      // Events of these severities get clips; patrol bookmarks always do
+}
+
+type ExportConfig struct {
+	Dir string        // Where rendered export files are written
+	TTL time.Duration // How long an export file is kept for download
+}
+
+type IdempotencyConfig struct {
+	TTL     time.Duration // How long a stored response is replayed for an Idempotency-Key
+	MaxBody int           // Larger responses (e.g. big exports) are not stored; retries run again
+}
+
+type ClientLogConfig struct {
+	RateLimit int           // Playback errors each user may report per minute
+	Retention time.Duration // Reports older than this are deleted (0 = kept)
+}
+
+// StreamTokenConfig signs the HLS URLs served by MediaMTX; MediaMTX checks
+// them against the backend through its HTTP auth callback
+type StreamTokenConfig struct {
+	Secret        string        // Signing key ("" = stream URLs are not signed)
+	TTL           time.Duration // How long a signed URL stays valid
+	MaxFailures   int           // Invalid tokens from one client within FailureWindow before it is blocked
+	FailureWindow time.Duration
+	BlockFor      time.Duration
+}
+
+// StreamIdleConfig stops MediaMTX paths and WebRTC streams nobody watched
+// for a while; the next viewer starts them again
+type StreamIdleConfig struct {
+	Timeout time.Duration // 0 keeps streams running
+}
+
+// NetworkConfig holds the client network ACLs. Lists are CIDRs or single
+// IPs; an empty allow list allows any address.
+type NetworkConfig struct {
+	TrustedProxies []string            // Proxies whose X-Forwarded-For is believed (empty = any; set it when using ACLs)
+	Deny           []string            // Refused everywhere
+	APIAllow       []string            // May use the API at all
+	StreamAllow    []string            // May open camera streams, e.g. only the control-room subnet
+	RoleAllow      map[string][]string // Role -> networks users with that role may connect from
+}
+
+type VaultConfig struct {
+	Secret string // Key for encrypting stored camera credentials
+}
+
+// SecretsConfig is where the database password, JWT secret and credential
+// key are read from instead of their env vars
+type SecretsConfig struct {
+	Provider         string        // env (default), vault, gcp or file
+	VaultAddr        string        // e.g. https://vault.example.com:8200
+	VaultToken       string        // Token auth; AppRole is used when VaultRoleID is set
+	VaultRoleID      string        // AppRole role_id
+	VaultSecretID    string        // AppRole secret_id
+	VaultNamespace   string        // Vault Enterprise namespace ("" = none)
+	VaultPath        string        // KV path of db_password, jwt_secret, credential_secret, e.g. secret/data/vms
+	VaultDBCredsPath string        // Dynamic database credentials, e.g. database/creds/vms ("" = db_password from VaultPath)
+	Dir              string        // file provider: one file per secret, e.g. mounted by a cloud secret manager
+	GCPProject       string        // gcp provider: Google Cloud project holding the secrets
+	GCPPrefix        string        // gcp provider: secret IDs are the prefix and the secret name, e.g. vms-jwt_secret
+	RefreshInterval  time.Duration // How often secrets are re-read to pick up rotations
+}
+
+// ClusterConfig runs several backend instances against one database; the
+// leader, elected with a Postgres advisory lock, runs recorders, watchdogs
+// and schedulers while every instance serves the API
+type ClusterConfig struct {
+	Enabled      bool
+	NodeID       string        // Unique per instance; defaults to the hostname
+	AdvertiseURL string        // Where other instances and clients reach this one, e.g. http://10.0.0.5:8080
+	LockKey      int64         // Advisory lock key the leader holds; the same on every instance
+	Interval     time.Duration // How often followers try to take over and nodes report in
+	Secret       string        // Signs requests one instance forwards to another, the same on every instance; served by the SecretStore, which falls back to the JWT secret
+}
+
+// FeatureFlagsConfig controls how the feature flags set through the admin
+// API reach every instance
+type FeatureFlagsConfig struct {
+	RefreshInterval time.Duration // How often the flags are re-read, so changes made on another instance apply
+}
+
+// TracingConfig exports OpenTelemetry spans of requests, stream starts,
+// MediaMTX calls, FFmpeg starts and queries over OTLP/HTTP, e.g. to Jaeger
+// or Tempo
+type TracingConfig struct {
+	Endpoint    string            // OTLP/HTTP base URL, e.g. http://jaeger:4318 ("" = tracing off)
+	Headers     map[string]string // Sent with every export, e.g. an auth header for a hosted Tempo
+	ServiceName string
+	SampleRatio float64 // Share of traces started here that are exported, 0-1; incoming traceparent decisions are kept
+}
+
+// PlaceholderJWTSecret is JWT_SECRET when it isn't set; anyone can sign
+// tokens with it, so secret stores never fall back to it
+const PlaceholderJWTSecret = "your-secret-key-change-in-production"
+
 func Load() *Config {
+	jwtSecret := getEnv("JWT_SECRET", PlaceholderJWTSecret)
+
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
+			Port:        getEnv("PORT", "8080"),
+			Environment: getEnv("APP_ENV", "production"),
+			V1Sunset:    getEnv("API_V1_SUNSET", ""),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -54,27 +392,341 @@ func Load() *Config {
 			Password: getEnv("DB_PASSWORD", "postgres"),
 			DBName:   getEnv("DB_NAME", "vms_cctv"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			SlowQueryThreshold: getEnvDuration("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
 		},
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-			Expiry: getEnv("JWT_EXPIRY", "24h"),
+			Secret:        jwtSecret,
+			Expiry:        getEnv("JWT_EXPIRY", "15m"),
+			RefreshExpiry: getEnvDuration("JWT_REFRESH_EXPIRY", 30*24*time.Hour),
+		},
+		Directory: DirectoryConfig{
+			URL:          getEnv("LDAP_URL", ""),
+			BindDN:       getEnv("LDAP_BIND_DN", ""),
+			BindPassword: getEnv("LDAP_BIND_PASSWORD", ""),
+			BaseDN:       getEnv("LDAP_BASE_DN", ""),
+			SyncInterval: getEnvDuration("LDAP_SYNC_INTERVAL", time.Hour),
+
+			MailAttribute:       getEnv("LDAP_MAIL_ATTRIBUTE", "mail"),
+			PhoneAttribute:      getEnv("LDAP_PHONE_ATTRIBUTE", "telephoneNumber"),
+			DepartmentAttribute: getEnv("LDAP_DEPARTMENT_ATTRIBUTE", "department"),
+			PhotoAttribute:      getEnv("LDAP_PHOTO_ATTRIBUTE", "thumbnailPhoto"),
+		},
+		OIDC: OIDCConfig{
+			Issuer:       strings.TrimSuffix(getEnv("OIDC_ISSUER", ""), "/"),
+			ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", ""),
+			FrontendURL:  getEnv("OIDC_FRONTEND_URL", "http://localhost:5173/auth/callback"),
+			Scopes:       strings.Fields(getEnv("OIDC_SCOPES", "openid email profile")),
+			EmailClaim:   getEnv("OIDC_EMAIL_CLAIM", "email"),
+			NameClaim:    getEnv("OIDC_NAME_CLAIM", "name"),
+			RoleClaim:    getEnv("OIDC_ROLE_CLAIM", "groups"),
+			RoleMapping:  getEnvRoleLists("OIDC_ROLE_MAPPING"),
+			DefaultRole:  getEnv("OIDC_DEFAULT_ROLE", "viewer"),
+			AutoCreate:   getEnvBool("OIDC_AUTO_CREATE", true),
+			LinkExisting: getEnvBool("OIDC_LINK_EXISTING", false),
 		},
 		RTSP: RTSPConfig{
 			StreamPath: getEnv("RTSP_STREAM_PATH", "/streams"),
 			OutputPath: getEnv("HLS_OUTPUT_PATH", "./hls_output"),
 		},
+		Watchdog: WatchdogConfig{
+			Adaptive:     getEnvBool("STREAM_WATCHDOG_ADAPTIVE", true),
+			StallTimeout: getEnvDuration("STREAM_WATCHDOG_STALL_TIMEOUT", 20*time.Second),
+			StartupGrace: getEnvDuration("STREAM_WATCHDOG_STARTUP_GRACE", 30*time.Second),
+			MinTimeout:   getEnvDuration("STREAM_WATCHDOG_MIN_TIMEOUT", 10*time.Second),
+			MaxTimeout:   getEnvDuration("STREAM_WATCHDOG_MAX_TIMEOUT", 2*time.Minute),
+		},
 		MediaMTX: MediaMTXConfig{
 			Host:       getEnv("MEDIAMTX_HOST", "localhost"),        // Internal: for backend
 			PublicHost: getEnv("MEDIAMTX_PUBLIC_HOST", "localhost"), // Public: for frontend/browser
 			HTTPPort:   getEnv("MEDIAMTX_HTTP_PORT", "8888"),
 			APIPort:    getEnv("MEDIAMTX_API_PORT", "9997"),
+			APIVersion: getEnv("MEDIAMTX_API_VERSION", "auto"),
+			RTSPPort:   getEnv("MEDIAMTX_RTSP_PORT", "8554"),
+
+			TranscodeUnsupported: getEnvBool("MEDIAMTX_TRANSCODE_UNSUPPORTED", true),
+			HEVCPassthrough:      getEnvBool("MEDIAMTX_HEVC_PASSTHROUGH", false),
+			SharedIngest:         getEnvBool("MEDIAMTX_SHARED_INGEST", true),
+			HealthInterval:       getEnvDuration("MEDIAMTX_HEALTH_INTERVAL", 2*time.Second),
+			ReconcileInterval:    getEnvDuration("MEDIAMTX_RECONCILE_INTERVAL", 5*time.Minute),
+			AuthCallbackURL:      getEnv("MEDIAMTX_AUTH_CALLBACK_URL", ""),
+			InternalUser:         getEnv("MEDIAMTX_INTERNAL_USER", "vms-backend"),
+			InternalPassword:     getEnv("MEDIAMTX_INTERNAL_PASSWORD", ""),
+		},
+		WebRTC: WebRTCConfig{
+			H264Passthrough: getEnvBool("WEBRTC_H264_PASSTHROUGH", true),
+			H264Profiles:    strings.Split(getEnv("WEBRTC_H264_PROFILES", "baseline"), ","),
+		},
+		FFmpeg: FFmpegConfig{
+			MaxProcesses: getEnvInt("FFMPEG_MAX_PROCESSES", 32),
+
+			Path:          getEnv("FFMPEG_PATH", "ffmpeg"),
+			Nice:          getEnvInt("FFMPEG_NICE", 10),
+			User:          getEnv("FFMPEG_USER", ""),
+			Cgroup:        getEnv("FFMPEG_CGROUP", ""),
+			CPULimit:      getEnvFloat("FFMPEG_CPU_LIMIT", 0),
+			MemoryLimitMB: getEnvInt("FFMPEG_MEMORY_LIMIT_MB", 0),
+			LogLines:      getEnvInt("FFMPEG_LOG_LINES", 200),
+		},
+		Tamper: TamperConfig{
+			CheckInterval: getEnvDuration("TAMPER_CHECK_INTERVAL", time.Minute),
+		},
+		Quality: QualityConfig{
+			CheckInterval:  getEnvDuration("QUALITY_CHECK_INTERVAL", time.Hour),
+			BaselineWindow: getEnvDuration("QUALITY_BASELINE_WINDOW", 14*24*time.Hour),
+			Retention:      getEnvDuration("QUALITY_RETENTION", 90*24*time.Hour),
+		},
+		Snapshot: SnapshotConfig{
+			MaxAge:        getEnvDuration("SNAPSHOT_MAX_AGE", 30*time.Second),
+			Width:         getEnvInt("SNAPSHOT_WIDTH", 640),
+			MaxConcurrent: getEnvInt("SNAPSHOT_MAX_CONCURRENT", 4),
+			MaxBursts:     getEnvInt("SNAPSHOT_MAX_BURSTS", 1),
+		},
+		Thumbnail: CameraThumbnailConfig{
+			Interval: getEnvDuration("CAMERA_THUMBNAIL_INTERVAL", time.Minute),
+			Width:    getEnvInt("CAMERA_THUMBNAIL_WIDTH", 320),
+			Dir:      getEnv("CAMERA_THUMBNAIL_DIR", "./thumbnails"),
+
+			S3Endpoint:  getEnv("CAMERA_THUMBNAIL_S3_ENDPOINT", "https://s3.amazonaws.com"),
+			S3Region:    getEnv("CAMERA_THUMBNAIL_S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("CAMERA_THUMBNAIL_S3_BUCKET", ""),
+			S3Prefix:    getEnv("CAMERA_THUMBNAIL_S3_PREFIX", "thumbnails/"),
+			S3AccessKey: getEnv("CAMERA_THUMBNAIL_S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("CAMERA_THUMBNAIL_S3_SECRET_KEY", ""),
+		},
+		Motion: MotionConfig{
+			SceneThreshold: getEnvFloat("MOTION_SCENE_THRESHOLD", 0.02),
+			Cooldown:       getEnvDuration("MOTION_COOLDOWN", 10*time.Second),
+			SnapshotDir:    getEnv("MOTION_SNAPSHOT_DIR", "./motion"),
+			Retention:      getEnvDuration("MOTION_RETENTION", 7*24*time.Hour),
+		},
+		Metadata: MetadataConfig{
+			MinConfidence: getEnvFloat("ONVIF_METADATA_MIN_CONFIDENCE", 0.5),
+			Cooldown:      getEnvDuration("ONVIF_METADATA_COOLDOWN", 10*time.Second),
+		},
+		Intercom: IntercomConfig{
+			RingTimeout: getEnvDuration("INTERCOM_RING_TIMEOUT", 30*time.Second),
+			DoorPulse:   getEnvDuration("INTERCOM_DOOR_PULSE", 3*time.Second),
+		},
+		Patrol: PatrolConfig{
+			BookmarkRadius: getEnvFloat("PATROL_BOOKMARK_RADIUS", 75),
+			BookmarkWindow: getEnvDuration("PATROL_BOOKMARK_WINDOW", 2*time.Minute),
+		},
+		Visitor: VisitorConfig{
+			LobbyCameraID:  uint(getEnvInt("VISITOR_LOBBY_CAMERA_ID", 0)),
+			SnapshotDir:    getEnv("VISITOR_SNAPSHOT_DIR", "./visitors"),
+			PlaybackWindow: getEnvDuration("VISITOR_PLAYBACK_WINDOW", time.Minute),
+
+			SnapshotRetention: getEnvDuration("VISITOR_SNAPSHOT_RETENTION", 90*24*time.Hour),
+		},
+		Weather: WeatherConfig{
+			ProviderURL:     getEnv("WEATHER_PROVIDER_URL", ""),
+			RefreshInterval: getEnvDuration("WEATHER_REFRESH_INTERVAL", 15*time.Minute),
+		},
+		Webhook: WebhookConfig{
+			Timeout:     getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			RetryBase:   getEnvDuration("WEBHOOK_RETRY_BASE", 30*time.Second),
+			RetryMax:    getEnvDuration("WEBHOOK_RETRY_MAX", time.Hour),
+			Retention:   getEnvDuration("WEBHOOK_LOG_RETENTION", 30*24*time.Hour),
+
+			AllowPrivateTargets: getEnvBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", false),
+		},
+		Health: HealthConfig{
+			CheckInterval: getEnvDuration("HEALTH_CHECK_INTERVAL", time.Minute),
+		},
+		SMTP: SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", "vms@localhost"),
+		},
+		Digest: DigestConfig{
+			SendAt:         getEnv("DIGEST_SEND_AT", "07:00"),
+			WindowStart:    getEnv("DIGEST_WINDOW_START", "18:00"),
+			RecipientRoles: strings.Split(getEnv("DIGEST_RECIPIENT_ROLES", "manager"), ","),
+		},
+		Notify: NotifyConfig{
+			SMSGatewayURL:   getEnv("SMS_GATEWAY_URL", ""),
+			SMSGatewayToken: getEnv("SMS_GATEWAY_TOKEN", ""),
+			DigestInterval:  getEnvDuration("ALERT_DIGEST_INTERVAL", time.Hour),
+		},
+		LoadTest: LoadTestConfig{
+			Cameras:         getEnvInt("LOADTEST_CAMERAS", 0),
+			Resolution:      getEnv("LOADTEST_RESOLUTION", "640x360"),
+			FPS:             getEnvInt("LOADTEST_FPS", 15),
+			EventsPerMinute: getEnvInt("LOADTEST_EVENTS_PER_MINUTE", 0),
+		},
+		Analytics: AnalyticsConfig{
+			ExportMinCount: getEnvInt("ANALYTICS_EXPORT_MIN_COUNT", 5),
+		},
+		Recording: RecordingConfig{
+			Dir:               getEnv("RECORDING_DIR", "./recordings"),
+			SegmentDuration:   getEnvDuration("RECORDING_SEGMENT_DURATION", 5*time.Minute),
+			ThumbnailInterval: getEnvDuration("RECORDING_THUMBNAIL_INTERVAL", 10*time.Second),
+			Retention:         getEnvDuration("RECORDING_RETENTION", 0),
+			ClipRetention:     getEnvDuration("RECORDING_CLIP_RETENTION", 365*24*time.Hour),
+			ClipPadding:       getEnvDuration("RECORDING_CLIP_PADDING", time.Minute),
+			ClipSeverities:    strings.Split(getEnv("RECORDING_CLIP_SEVERITIES", "warning,critical"), ","),
+		},
+		Export: ExportConfig{
+			Dir: getEnv("EXPORT_DIR", "./exports"),
+			TTL: getEnvDuration("EXPORT_TTL", 24*time.Hour),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:     getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+			MaxBody: getEnvInt("IDEMPOTENCY_MAX_BODY", 1<<20),
+		},
+		ClientLog: ClientLogConfig{
+			RateLimit: getEnvInt("CLIENT_LOG_RATE_LIMIT", 30),
+			Retention: getEnvDuration("CLIENT_LOG_RETENTION", 30*24*time.Hour),
+		},
+		Network: NetworkConfig{
+			TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+			Deny:           getEnvList("ACL_DENY"),
+			APIAllow:       getEnvList("ACL_API_ALLOW"),
+			StreamAllow:    getEnvList("ACL_STREAM_ALLOW"),
+			RoleAllow:      getEnvRoleLists("ACL_ROLE_ALLOW"),
+		},
+		StreamToken: StreamTokenConfig{
+			Secret:        getEnv("STREAM_TOKEN_SECRET", ""),
+			TTL:           getEnvDuration("STREAM_TOKEN_TTL", 12*time.Hour),
+			MaxFailures:   getEnvInt("STREAM_TOKEN_MAX_FAILURES", 20),
+			FailureWindow: getEnvDuration("STREAM_TOKEN_FAILURE_WINDOW", time.Minute),
+			BlockFor:      getEnvDuration("STREAM_TOKEN_BLOCK", 15*time.Minute),
+		},
+		Vault: VaultConfig{
+			Secret: getEnv("CREDENTIAL_SECRET", jwtSecret), // Changing it makes stored credentials unreadable
+		},
+		Secrets: SecretsConfig{
+			Provider:         getEnv("SECRETS_PROVIDER", "env"),
+			VaultAddr:        getEnv("VAULT_ADDR", ""),
+			VaultToken:       getEnv("VAULT_TOKEN", ""),
+			VaultRoleID:      getEnv("VAULT_ROLE_ID", ""),
+			VaultSecretID:    getEnv("VAULT_SECRET_ID", ""),
+			VaultNamespace:   getEnv("VAULT_NAMESPACE", ""),
+			VaultPath:        getEnv("VAULT_SECRET_PATH", "secret/data/vms"),
+			VaultDBCredsPath: getEnv("VAULT_DB_CREDS_PATH", ""),
+			Dir:              getEnv("SECRETS_DIR", "/run/secrets/vms"),
+			GCPProject:       getEnv("SECRETS_GCP_PROJECT", ""),
+			GCPPrefix:        getEnv("SECRETS_GCP_PREFIX", "vms-"),
+			RefreshInterval:  getEnvDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute),
+		},
+		StreamIdle: StreamIdleConfig{
+			Timeout: getEnvDuration("STREAM_IDLE_TIMEOUT", 2*time.Minute),
+		},
+		Cluster: ClusterConfig{
+			Enabled:      getEnvBool("CLUSTER_MODE", false),
+			NodeID:       getEnv("CLUSTER_NODE_ID", hostname()),
+			AdvertiseURL: getEnv("CLUSTER_ADVERTISE_URL", ""),
+			LockKey:      int64(getEnvInt("CLUSTER_LOCK_KEY", 727001)),
+			Interval:     getEnvDuration("CLUSTER_ELECTION_INTERVAL", 5*time.Second),
+			Secret:       getEnv("CLUSTER_SECRET", ""),
+		},
+		Features: FeatureFlagsConfig{
+			RefreshInterval: getEnvDuration("FEATURE_FLAGS_REFRESH_INTERVAL", 30*time.Second),
+		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			Headers:     getEnvHeaders("OTEL_EXPORTER_OTLP_HEADERS"),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "vms-backend"),
+			SampleRatio: getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1),
 		},
 	}
 }
 
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "vms"
+	}
+	return name
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma-separated list, nil when unset
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvRoleLists reads "role=a,b;role=c" into role -> list
+func getEnvRoleLists(key string) map[string][]string {
+	lists := make(map[string][]string)
+	for _, entry := range strings.Split(os.Getenv(key), ";") {
+		role, values, ok := strings.Cut(entry, "=")
+		role = strings.TrimSpace(role)
+		if !ok || role == "" {
+			continue
+		}
+		for _, value := range strings.Split(values, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				lists[role] = append(lists[role], value)
+			}
+		}
+	}
+	return lists
+}
+
+// getEnvHeaders parses "key1=value1,key2=value2", the format of
+// OTEL_EXPORTER_OTLP_HEADERS
+func getEnvHeaders(key string) map[string]string {
+	headers := make(map[string]string)
+	for _, entry := range getEnvList(key) {
+		name, value, ok := strings.Cut(entry, "=")
+		if name = strings.TrimSpace(name); ok && name != "" {
+			headers[name] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
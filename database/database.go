@@ -1,39 +1,137 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"command-center-vms-cctv/be/config"
 	"command-center-vms-cctv/be/models"
 	"command-center-vms-cctv/be/utils"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// credentialConnLifetime caps connection age when credentials can rotate
+const credentialConnLifetime = 30 * time.Minute
+
 func Initialize(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
 		cfg.Host, cfg.User, cfg.Password, cfg.DBName, cfg.Port, cfg.SSLMode,
 	)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+	dialector := postgres.Open(dsn)
+	if cfg.Credentials != nil {
+		// Every new connection asks for the current credentials, so rotated
+		// passwords and renewed dynamic credentials are picked up
+		connConfig, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database config: %w", err)
+		}
+		sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, conn *pgx.ConnConfig) error {
+			conn.User, conn.Password = cfg.Credentials()
+			return nil
+		}))
+		// Recycled so no connection outlives the credentials it was opened with by long
+		sqlDB.SetConnMaxLifetime(credentialConnLifetime)
+		dialector = postgres.New(postgres.Config{Conn: sqlDB})
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	if err := registerSlowQueryLog(db, cfg.SlowQueryThreshold); err != nil {
+		return nil, err
+	}
+	if err := registerQueryTracing(db); err != nil {
+		return nil, err
+	}
+
+	// High-volume tables are created as partitioned tables before AutoMigrate
+	if err := createPartitionedTables(db); err != nil {
+		return nil, err
+	}
+
 	// Auto migrate
 	if err := db.AutoMigrate(
 		&models.User{},
+		&models.Session{},
 		&models.Camera{},
+		&models.Event{},
+		&models.MotionEvent{},
+		&models.Recording{},
+		&models.AuditLog{},
+		&models.Incident{},
+		&models.CameraUsage{},
+		&models.AudioRule{},
+		&models.AlertRule{},
+		&models.Alert{},
+		&models.TamperBaseline{},
+		&models.QualitySample{},
+		&models.Wall{},
+		&models.WallLayout{},
+		&models.WallShift{},
+		&models.Credential{},
+		&models.StreamHealthChange{},
+		&models.CameraStatusEvent{},
+		&models.CameraPlan{},
+		&models.CameraStatusDefinition{},
+		&models.CameraGroup{},
+		&models.NotificationPreference{},
+		&models.AlertNotification{},
+		&models.RetainedClip{},
+		&models.ClusterNode{},
+		&models.StreamOwner{},
+		&models.MediaMTXPath{},
+		&models.FeatureFlag{},
+		&models.DigestTemplate{},
+		&models.LegalHold{},
+		&models.PrivacyZone{},
+		&models.CountingRule{},
+		&models.PeopleCount{},
+		&models.Integration{},
+		&models.IntegrationMapping{},
+		&models.IdempotencyKey{},
+		&models.StreamView{},
+		&models.ClientLog{},
+		&models.IntercomCall{},
+		&models.VisitorCheckIn{},
+		&models.PrivacySchedule{},
+		&models.PrivacyBlackout{},
+		&models.Settings{},
+		&models.ExportJob{},
+		&models.RecordingSchedule{},
+		&models.Macro{},
+		&models.MacroStep{},
+		&models.PatrolCheckIn{},
+		&models.PatrolBookmark{},
+		&models.WeatherObservation{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
 	); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if err := createSearchIndexes(db); err != nil {
+		log.Printf("Warning: Failed to create search indexes: %v", err)
+	}
+
+	// Create current and upcoming monthly partitions
+	if err := EnsurePartitions(db, time.Now()); err != nil {
+		log.Printf("Warning: Failed to create partitions: %v", err)
+	}
+	go maintainPartitions(db)
+
 	// Create default admin user if not exists
 	if err := createDefaultAdmin(db); err != nil {
 		log.Printf("Warning: Failed to create default admin: %v", err)
@@ -72,4 +170,3 @@ func createDefaultAdmin(db *gorm.DB) error {
 	log.Println("Default admin user created: admin@vms.demo / demo123")
 	return nil
 }
-
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// partitionMonthsAhead is how many future monthly partitions are kept ready
+const partitionMonthsAhead = 3
+
+// partitionedTable describes a table that is range-partitioned by month
+type partitionedTable struct {
+	Name   string
+	Column string // Partition key column
+	DDL    string // CREATE TABLE statement for the partitioned parent
+}
+
+// High-volume tables are partitioned by month so that time-range queries
+// only touch the relevant partitions and old data can be dropped cheaply.
+// Postgres requires the partition key to be part of the primary key.
+// Columns and indexes beyond this initial layout are managed by AutoMigrate.
+var partitionedTables = []partitionedTable{
+	{
+		Name:   "events",
+		Column: "occurred_at",
+		DDL: `CREATE TABLE events (
+			id bigserial,
+			camera_id bigint,
+			type text NOT NULL,
+			severity text NOT NULL DEFAULT 'info',
+			source text,
+			description text,
+			data text,
+			occurred_at timestamptz NOT NULL,
+			created_at timestamptz,
+			PRIMARY KEY (id, occurred_at)
+		) PARTITION BY RANGE (occurred_at)`,
+	},
+	{
+		Name:   "recordings",
+		Column: "start_time",
+		DDL: `CREATE TABLE recordings (
+			id bigserial,
+			camera_id bigint NOT NULL,
+			start_time timestamptz NOT NULL,
+			end_time timestamptz,
+			file_path text NOT NULL,
+			size_bytes bigint,
+			status text NOT NULL DEFAULT 'recording',
+			created_at timestamptz,
+			updated_at timestamptz,
+			PRIMARY KEY (id, start_time)
+		) PARTITION BY RANGE (start_time)`,
+	},
+}
+
+// createPartitionedTables creates the partitioned parent tables on a fresh database.
+// Existing (non-partitioned) tables from older deployments are left untouched.
+func createPartitionedTables(db *gorm.DB) error {
+	for _, table := range partitionedTables {
+		if db.Migrator().HasTable(table.Name) {
+			continue
+		}
+		if err := db.Exec(table.DDL).Error; err != nil {
+			return fmt.Errorf("failed to create partitioned table %s: %w", table.Name, err)
+		}
+		log.Printf("Created partitioned table %s (by %s)", table.Name, table.Column)
+	}
+	return nil
+}
+
+// isPartitioned reports whether a table is a partitioned parent
+func isPartitioned(db *gorm.DB, table string) bool {
+	var count int64
+	db.Raw("SELECT count(*) FROM pg_partitioned_table pt JOIN pg_class c ON c.oid = pt.partrelid WHERE c.relname = ?", table).Scan(&count)
+	return count > 0
+}
+
+// EnsurePartitions makes sure monthly partitions exist from the month of `now`
+// through partitionMonthsAhead months later, plus a default partition that
+// catches rows outside that window. Rows the default partition caught for a
+// month are moved into that month's partition when it is created.
+func EnsurePartitions(db *gorm.DB, now time.Time) error {
+	for _, table := range partitionedTables {
+		if !isPartitioned(db, table.Name) {
+			continue
+		}
+
+		defaultStmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s_default PARTITION OF %s DEFAULT", table.Name, table.Name)
+		if err := db.Exec(defaultStmt).Error; err != nil {
+			return fmt.Errorf("failed to create default partition for %s: %w", table.Name, err)
+		}
+
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i <= partitionMonthsAhead; i++ {
+			from := month.AddDate(0, i, 0)
+			if err := createMonthPartition(db, table, from); err != nil {
+				return fmt.Errorf("failed to create partition %s: %w", partitionName(table.Name, from), err)
+			}
+		}
+	}
+	return nil
+}
+
+// createMonthPartition creates the partition of the month starting at from
+// unless it exists. Postgres refuses to create a partition for a range the
+// default partition holds rows of, so the partition is created detached,
+// those rows are moved into it and it is attached, in one transaction.
+func createMonthPartition(db *gorm.DB, table partitionedTable, from time.Time) error {
+	name := partitionName(table.Name, from)
+	if db.Migrator().HasTable(name) {
+		return nil
+	}
+	to := from.AddDate(0, 1, 0)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", name, table.Name)).Error; err != nil {
+			return err
+		}
+		moved := tx.Exec(fmt.Sprintf(
+			"WITH moved AS (DELETE FROM %s_default WHERE %s >= ? AND %s < ? RETURNING *) INSERT INTO %s SELECT * FROM moved",
+			table.Name, table.Column, table.Column, name,
+		), from, to)
+		if moved.Error != nil {
+			return moved.Error
+		}
+		if moved.RowsAffected > 0 {
+			log.Printf("Moved %d rows from %s_default into %s", moved.RowsAffected, table.Name, name)
+		}
+		return tx.Exec(fmt.Sprintf(
+			"ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')",
+			table.Name, name, from.Format(time.RFC3339), to.Format(time.RFC3339),
+		)).Error
+	})
+}
+
+// partitionName returns the name of the monthly partition, e.g. events_y2024m03
+func partitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_y%04dm%02d", table, month.Year(), int(month.Month()))
+}
+
+// maintainPartitions periodically creates upcoming partitions
+func maintainPartitions(db *gorm.DB) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := EnsurePartitions(db, time.Now()); err != nil {
+			log.Printf("Warning: Partition maintenance failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"command-center-vms-cctv/be/tracing"
+
+	"gorm.io/gorm"
+)
+
+const querySpanKey = "tracing:span"
+
+// registerQueryTracing records a span for every statement run with
+// db.WithContext(ctx) in a traced request. The SQL is recorded with its
+// placeholders, never the values.
+func registerQueryTracing(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		_, span := tracing.StartClient(tx.Statement.Context, "db")
+		if span != nil {
+			tx.InstanceSet(querySpanKey, span)
+		}
+	}
+	after := func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(querySpanKey)
+		if !ok {
+			return
+		}
+		span := value.(*tracing.Span)
+		sql := tx.Statement.SQL.String()
+		if fields := strings.Fields(sql); len(fields) > 0 {
+			span.SetName(strings.TrimSpace(strings.ToUpper(fields[0]) + " " + tx.Statement.Table))
+		}
+		span.SetAttribute("db.system", "postgresql")
+		span.SetAttribute("db.statement", sql)
+		span.SetAttribute("db.sql.table", tx.Statement.Table)
+		span.SetAttribute("db.rows_affected", tx.Statement.RowsAffected)
+		if !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(tx.Error)
+		}
+		span.End()
+	}
+
+	for _, register := range []func() error{
+		func() error {
+			return db.Callback().Create().Before("gorm:create").Register("tracing:before_create", before)
+		},
+		func() error {
+			return db.Callback().Create().After("gorm:create").Register("tracing:after_create", after)
+		},
+		func() error {
+			return db.Callback().Query().Before("gorm:query").Register("tracing:before_query", before)
+		},
+		func() error { return db.Callback().Query().After("gorm:query").Register("tracing:after_query", after) },
+		func() error {
+			return db.Callback().Update().Before("gorm:update").Register("tracing:before_update", before)
+		},
+		func() error {
+			return db.Callback().Update().After("gorm:update").Register("tracing:after_update", after)
+		},
+		func() error {
+			return db.Callback().Delete().Before("gorm:delete").Register("tracing:before_delete", before)
+		},
+		func() error {
+			return db.Callback().Delete().After("gorm:delete").Register("tracing:after_delete", after)
+		},
+		func() error { return db.Callback().Row().Before("gorm:row").Register("tracing:before_row", before) },
+		func() error { return db.Callback().Row().After("gorm:row").Register("tracing:after_row", after) },
+		func() error { return db.Callback().Raw().Before("gorm:raw").Register("tracing:before_raw", before) },
+		func() error { return db.Callback().Raw().After("gorm:raw").Register("tracing:after_raw", after) },
+	} {
+		if err := register(); err != nil {
+			return fmt.Errorf("failed to register query tracing: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TimeRange limits a query to rows whose column falls in [from, to).
+// Always filter partitioned tables on their partition key so Postgres can
+// prune partitions instead of scanning every month.
+func TimeRange(column string, from, to *time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if from != nil {
+			db = db.Where(column+" >= ?", *from)
+		}
+		if to != nil {
+			db = db.Where(column+" < ?", *to)
+		}
+		return db
+	}
+}
+
+// ForCamera limits a query to a single camera when cameraID is non-zero
+func ForCamera(cameraID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if cameraID == 0 {
+			return db
+		}
+		return db.Where("camera_id = ?", cameraID)
+	}
+}
+
+// NewestFirst orders by a time column and id, both descending, matching the
+// composite (camera_id, time) / (type, time) indexes on partitioned tables
+func NewestFirst(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(column + " DESC").Order("id DESC")
+	}
+}
+
+// SeekBefore continues a NewestFirst listing after the row at (t, id).
+// Uses a row comparison so Postgres can seek on the index instead of
+// counting past skipped rows like OFFSET does.
+func SeekBefore(column string, t time.Time, id uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("("+column+", id) < (?, ?)", t, id)
+	}
+}
+
+// OldestFirst orders by a time column and id, both ascending, for sync feeds
+// that are consumed in the order changes happened
+func OldestFirst(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(column + " ASC").Order("id ASC")
+	}
+}
+
+// SeekAfter continues an OldestFirst listing after the row at (t, id)
+func SeekAfter(column string, t time.Time, id uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("("+column+", id) > (?, ?)", t, id)
+	}
+}
+
+// InAreas limits a query of a table with an area column (cameras, counting
+// rules) to the given areas. A nil slice means no
+// restriction; an empty non-nil slice matches nothing.
+func InAreas(areas []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if areas == nil {
+			return db
+		}
+		if len(areas) == 0 {
+			return db.Where("1 = 0")
+		}
+		return db.Where("area IN ?", areas)
+	}
+}
+
+// OnLegalHold limits a recording query to recordings overlapping an active
+// legal hold of their camera. Retention pruning and deletions must exclude
+// these, see NotOnLegalHold.
+func OnLegalHold() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("EXISTS (" + legalHoldOverlap + ")")
+	}
+}
+
+// NotOnLegalHold limits a recording query to recordings that may be deleted
+func NotOnLegalHold() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT EXISTS (" + legalHoldOverlap + ")")
+	}
+}
+
+// legalHoldOverlap matches active holds overlapping the current recordings
+// row; a recording still in progress extends to now
+const legalHoldOverlap = `SELECT 1 FROM legal_holds h
+	WHERE h.camera_id = recordings.camera_id AND h.released_at IS NULL
+	AND h.start_time < COALESCE(recordings.end_time, NOW()) AND h.end_time > recordings.start_time`
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// searchDocuments is the tsvector expression searched for each table.
+// The 'simple' configuration is used because camera and area names are
+// mostly proper nouns (and not English), so stemming does more harm than good.
+// Each expression has a matching GIN index so searches stay index-backed.
+var searchDocuments = map[string]string{
+	"cameras":   "to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(area, '') || ' ' || coalesce(building, ''))",
+	"events":    "to_tsvector('simple', coalesce(type, '') || ' ' || coalesce(description, ''))",
+	"incidents": "to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(notes, '') || ' ' || coalesce(area, ''))",
+}
+
+// createSearchIndexes creates the GIN indexes backing full-text search
+func createSearchIndexes(db *gorm.DB) error {
+	for table, document := range searchDocuments {
+		stmt := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_search ON %s USING GIN (%s)", table, table, document)
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to create search index on %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// SearchQuery turns free text into a tsquery where every word must match
+// as a prefix, e.g. "lobby cam" -> "lobby:* & cam:*". Returns "" when the
+// input contains no searchable words.
+func SearchQuery(input string) string {
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, strings.ToLower(word)+":*")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// SearchMatch limits rows of table to those matching a tsquery built by
+// SearchQuery, leaving the order to the caller
+func SearchMatch(table, tsquery string) func(*gorm.DB) *gorm.DB {
+	document := searchDocuments[table]
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(document+" @@ to_tsquery('simple', ?)", tsquery)
+	}
+}
+
+// FullTextSearch matches rows of table against a tsquery built by SearchQuery
+// and orders them by relevance
+func FullTextSearch(table, tsquery string) func(*gorm.DB) *gorm.DB {
+	document := searchDocuments[table]
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(SearchMatch(table, tsquery)).
+			Clauses(clause.OrderBy{Expression: clause.Expr{
+				SQL:                "ts_rank(" + document + ", to_tsquery('simple', ?)) DESC",
+				Vars:               []interface{}{tsquery},
+				WithoutParentheses: true,
+			}})
+	}
+}
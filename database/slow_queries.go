@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type requestInfoKey struct{}
+
+const queryStartKey = "slow_queries:start"
+
+// RequestInfo identifies the handler a query ran for in slow query logs
+type RequestInfo struct {
+	Method string
+	Route  string // Route pattern, e.g. /api/v1/cameras/:id
+	Path   string
+}
+
+// WithRequestInfo attaches the current request to a context. Queries run
+// with db.WithContext(ctx) are logged with it when slow.
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the request attached to a context, if any
+func RequestInfoFrom(ctx context.Context) (RequestInfo, bool) {
+	if ctx == nil {
+		return RequestInfo{}, false
+	}
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
+
+// registerSlowQueryLog times every statement and logs those slower than
+// threshold with the request they ran for (0 disables it)
+func registerSlowQueryLog(db *gorm.DB, threshold time.Duration) error {
+	if threshold <= 0 {
+		return nil
+	}
+
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(queryStartKey, time.Now())
+	}
+	after := func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(queryStartKey)
+		if !ok {
+			return
+		}
+		elapsed := time.Since(value.(time.Time))
+		if elapsed < threshold {
+			return
+		}
+
+		handler := "background"
+		if info, ok := RequestInfoFrom(tx.Statement.Context); ok {
+			handler = fmt.Sprintf("%s %s (%s)", info.Method, info.Route, info.Path)
+		}
+		sql := tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...)
+		fmt.Printf("[SlowQuery] %v rows=%d handler=%s: %s\n", elapsed.Round(time.Millisecond), tx.Statement.RowsAffected, handler, sql)
+	}
+
+	for _, register := range []func() error{
+		func() error {
+			return db.Callback().Create().Before("gorm:create").Register("slow_queries:before_create", before)
+		},
+		func() error {
+			return db.Callback().Create().After("gorm:create").Register("slow_queries:after_create", after)
+		},
+		func() error {
+			return db.Callback().Query().Before("gorm:query").Register("slow_queries:before_query", before)
+		},
+		func() error {
+			return db.Callback().Query().After("gorm:query").Register("slow_queries:after_query", after)
+		},
+		func() error {
+			return db.Callback().Update().Before("gorm:update").Register("slow_queries:before_update", before)
+		},
+		func() error {
+			return db.Callback().Update().After("gorm:update").Register("slow_queries:after_update", after)
+		},
+		func() error {
+			return db.Callback().Delete().Before("gorm:delete").Register("slow_queries:before_delete", before)
+		},
+		func() error {
+			return db.Callback().Delete().After("gorm:delete").Register("slow_queries:after_delete", after)
+		},
+		func() error {
+			return db.Callback().Row().Before("gorm:row").Register("slow_queries:before_row", before)
+		},
+		func() error { return db.Callback().Row().After("gorm:row").Register("slow_queries:after_row", after) },
+		func() error {
+			return db.Callback().Raw().Before("gorm:raw").Register("slow_queries:before_raw", before)
+		},
+		func() error { return db.Callback().Raw().After("gorm:raw").Register("slow_queries:after_raw", after) },
+	} {
+		if err := register(); err != nil {
+			return fmt.Errorf("failed to register slow query log: %w", err)
+		}
+	}
+	return nil
+}
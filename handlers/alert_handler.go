@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AlertHandler struct {
+	db *gorm.DB
+}
+
+func NewAlertHandler(db *gorm.DB) *AlertHandler {
+	return &AlertHandler{
+		db: db,
+	}
+}
+
+type ResolveAlertRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+// ListAlerts returns alerts newest first using cursor pagination
+// Query: ?after=&limit=&camera_id=&status=&severity=&type=&from=&to=
+func (h *AlertHandler) ListAlerts(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.Alert{}).
+		Scopes(database.ForCamera(cameraID), database.TimeRange("raised_at", from, to))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("raised_at", cursor.Time, cursor.ID))
+	}
+
+	var alerts []models.Alert
+	if err := query.Scopes(database.NewestFirst("raised_at")).Limit(limit + 1).Find(&alerts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alerts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(alerts, limit, func(a models.Alert) (time.Time, uint) {
+		return a.RaisedAt, a.ID
+	}))
+}
+
+// AcknowledgeAlert marks an open alert as being handled by the caller
+func (h *AlertHandler) AcknowledgeAlert(c *gin.Context) {
+	alert, ok := h.findAlert(c)
+	if !ok {
+		return
+	}
+	if alert.Status != models.AlertOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Alert is already %s", alert.Status)})
+		return
+	}
+
+	// Only the call that moves the alert out of open takes it
+	result := requestDB(h.db, c).Model(&models.Alert{}).
+		Where("id = ? AND status = ?", alert.ID, models.AlertOpen).
+		Updates(map[string]interface{}{
+			"status":             models.AlertAcknowledged,
+			"acknowledged_at":    time.Now(),
+			"acknowledged_by_id": currentUserID(c),
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acknowledge alert"})
+		return
+	}
+	if alert, ok = h.reloadAlert(c, alert.ID, result.RowsAffected); !ok {
+		return
+	}
+
+	recordAudit(h.db, c, "acknowledge", "alert", fmt.Sprint(alert.ID), fmt.Sprintf("camera %d: %s", alert.CameraID, alert.EventType))
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// ResolveAlert closes an open or acknowledged alert, optionally with a
+// resolution note. Resolving an open alert acknowledges it too.
+func (h *AlertHandler) ResolveAlert(c *gin.Context) {
+	alert, ok := h.findAlert(c)
+	if !ok {
+		return
+	}
+	var req ResolveAlertRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if alert.Status == models.AlertResolved {
+		c.JSON(http.StatusConflict, gin.H{"error": "Alert is already resolved"})
+		return
+	}
+
+	// The acknowledgement of an alert someone else took in the meantime is
+	// kept; only one call resolves it
+	now := time.Now()
+	userID := currentUserID(c)
+	result := requestDB(h.db, c).Model(&models.Alert{}).
+		Where("id = ? AND status <> ?", alert.ID, models.AlertResolved).
+		Updates(map[string]interface{}{
+			"status":             models.AlertResolved,
+			"acknowledged_at":    gorm.Expr("COALESCE(acknowledged_at, ?)", now),
+			"acknowledged_by_id": gorm.Expr("CASE WHEN acknowledged_at IS NULL THEN ? ELSE acknowledged_by_id END", userID),
+			"resolved_at":        now,
+			"resolved_by_id":     userID,
+			"resolution":         req.Resolution,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve alert"})
+		return
+	}
+	if alert, ok = h.reloadAlert(c, alert.ID, result.RowsAffected); !ok {
+		return
+	}
+
+	recordAudit(h.db, c, "resolve", "alert", fmt.Sprint(alert.ID), fmt.Sprintf("camera %d: %s", alert.CameraID, alert.EventType))
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// findAlert loads the :id alert, writing the error response when it can't
+func (h *AlertHandler) findAlert(c *gin.Context) (*models.Alert, bool) {
+	var alert models.Alert
+	if err := requestDB(h.db, c).First(&alert, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert"})
+		return nil, false
+	}
+	return &alert, true
+}
+
+// reloadAlert loads an alert after a conditional status update, writing a
+// 409 with its current status when the update matched no row because
+// another call changed it first
+func (h *AlertHandler) reloadAlert(c *gin.Context, id uint, updated int64) (*models.Alert, bool) {
+	var alert models.Alert
+	if err := requestDB(h.db, c).First(&alert, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert"})
+		return nil, false
+	}
+	if updated == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Alert is already %s", alert.Status)})
+		return nil, false
+	}
+	return &alert, true
+}
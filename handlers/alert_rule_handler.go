@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AlertRuleHandler struct {
+	db *gorm.DB
+}
+
+func NewAlertRuleHandler(db *gorm.DB) *AlertRuleHandler {
+	return &AlertRuleHandler{
+		db: db,
+	}
+}
+
+type AlertRuleRequest struct {
+	EventType       *string `json:"event_type"`
+	ScheduleDays    *string `json:"schedule_days"`
+	ScheduleStart   *string `json:"schedule_start"`
+	ScheduleEnd     *string `json:"schedule_end"`
+	CooldownSeconds *int    `json:"cooldown_seconds"`
+	Severity        *string `json:"severity" binding:"omitempty,oneof=info warning critical"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+// apply copies the provided fields onto rule and validates the result
+func (req *AlertRuleRequest) apply(rule *models.AlertRule) error {
+	if req.EventType != nil {
+		rule.EventType = strings.TrimSpace(*req.EventType)
+	}
+	if req.ScheduleDays != nil {
+		rule.ScheduleDays = *req.ScheduleDays
+	}
+	if req.ScheduleStart != nil {
+		rule.ScheduleStart = *req.ScheduleStart
+	}
+	if req.ScheduleEnd != nil {
+		rule.ScheduleEnd = *req.ScheduleEnd
+	}
+	if req.CooldownSeconds != nil {
+		rule.CooldownSeconds = *req.CooldownSeconds
+	}
+	if req.Severity != nil {
+		rule.Severity = *req.Severity
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+
+	if rule.EventType == "" {
+		return fmt.Errorf("event_type is required")
+	}
+	if rule.CooldownSeconds < 0 {
+		return fmt.Errorf("cooldown_seconds must not be negative")
+	}
+	return validateSchedule(rule.ScheduleDays, rule.ScheduleStart, rule.ScheduleEnd)
+}
+
+// ListAlertRules returns the alert rules of a camera
+func (h *AlertRuleHandler) ListAlertRules(c *gin.Context) {
+	var rules []models.AlertRule
+	if err := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).Order("event_type").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *AlertRuleHandler) CreateAlertRule(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.AlertRule{
+		CameraID: camera.ID,
+		Enabled:  true,
+	}
+	if err := req.apply(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkUnique(c, &rule) {
+		return
+	}
+
+	if err := requestDB(h.db, c).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert rule"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "alert_rule", fmt.Sprint(rule.ID), fmt.Sprintf("camera %d: %s", rule.CameraID, rule.EventType))
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *AlertRuleHandler) UpdateAlertRule(c *gin.Context) {
+	var rule models.AlertRule
+	if err := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).First(&rule, c.Param("ruleId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert rule"})
+		return
+	}
+
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkUnique(c, &rule) {
+		return
+	}
+
+	if err := requestDB(h.db, c).Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert rule"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "alert_rule", fmt.Sprint(rule.ID), fmt.Sprintf("camera %d: %s", rule.CameraID, rule.EventType))
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *AlertRuleHandler) DeleteAlertRule(c *gin.Context) {
+	result := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).Delete(&models.AlertRule{}, c.Param("ruleId"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert rule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "alert_rule", c.Param("ruleId"), "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert rule deleted successfully"})
+}
+
+// checkUnique rejects a second rule for the same camera and event type
+func (h *AlertRuleHandler) checkUnique(c *gin.Context, rule *models.AlertRule) bool {
+	var existing int64
+	if err := requestDB(h.db, c).Model(&models.AlertRule{}).
+		Where("camera_id = ? AND event_type = ? AND id <> ?", rule.CameraID, rule.EventType, rule.ID).
+		Count(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check alert rules"})
+		return false
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Camera already has an alert rule for %s events", rule.EventType)})
+		return false
+	}
+	return true
+}
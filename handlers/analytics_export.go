@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxExportWindow bounds a movement export; hourly rows for every camera add up fast
+const maxExportWindow = 93 * 24 * time.Hour
+
+// MovementRow is one hour of motion on one camera in the movement export.
+// It only carries counts and the weather of the camera's site: no imagery,
+// event descriptions or payloads.
+type MovementRow struct {
+	Hour            time.Time
+	CameraID        uint
+	CameraName      string
+	Area            string
+	Building        string
+	MotionEvents    int64
+	Weather         string // Conditions during the hour, empty when unknown
+	PrecipitationMM float64
+	Lux             float64
+}
+
+// hourlyWeather is the weather of one site over one hour
+type hourlyWeather struct {
+	Area            string
+	Hour            time.Time
+	Rain            bool
+	Fog             bool
+	Snow            bool
+	PrecipitationMM float64
+	Lux             float64
+}
+
+type CreatePrivacyZoneRequest struct {
+	Name     string `json:"name" binding:"required"`
+	CameraID *uint  `json:"camera_id"`
+	Area     string `json:"area"`
+	Reason   string `json:"reason"`
+}
+
+// ExportMovement exports motion counts per hour per camera for the
+// facilities analytics team, leaving out cameras in privacy zones and
+// suppressing hours with fewer than ANALYTICS_EXPORT_MIN_COUNT events
+// Query: ?from=&to= (default last 24h, at most 93 days), ?format=csv|parquet (default csv)
+func (h *AnalyticsHandler) ExportMovement(c *gin.Context) {
+	from, to, err := parseAnalyticsWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if to.Sub(from) > maxExportWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Export window is limited to 93 days"})
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "parquet" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or parquet"})
+		return
+	}
+
+	var rows []MovementRow
+	if err := h.db.WithContext(c.Request.Context()).Table("events").
+		Select("date_trunc('hour', events.occurred_at) AS hour, events.camera_id, cameras.name AS camera_name, cameras.area, cameras.building, COUNT(*) AS motion_events").
+		Joins("JOIN cameras ON cameras.id = events.camera_id").
+		Where("events.type = ?", "motion").
+		Scopes(database.TimeRange("events.occurred_at", &from, &to)).
+		Where("NOT EXISTS (SELECT 1 FROM privacy_zones WHERE privacy_zones.camera_id = cameras.id OR (privacy_zones.area <> '' AND privacy_zones.area = cameras.area))").
+		Group("hour, events.camera_id, cameras.name, cameras.area, cameras.building").
+		Order("hour ASC, events.camera_id ASC").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch movement statistics"})
+		return
+	}
+
+	var weather []hourlyWeather
+	if err := h.db.WithContext(c.Request.Context()).Model(&models.WeatherObservation{}).
+		Select("area, date_trunc('hour', observed_at) AS hour, bool_or(rain) AS rain, bool_or(fog) AS fog, bool_or(snow) AS snow, AVG(precipitation_mm) AS precipitation_mm, AVG(lux) AS lux").
+		Scopes(database.TimeRange("observed_at", &from, &to)).
+		Group("area, hour").
+		Scan(&weather).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weather observations"})
+		return
+	}
+	weatherByHour := make(map[string]hourlyWeather, len(weather))
+	for _, w := range weather {
+		weatherByHour[w.Area+"|"+w.Hour.UTC().Format(time.RFC3339)] = w
+	}
+
+	kept := rows[:0]
+	suppressed := 0
+	for _, row := range rows {
+		if row.MotionEvents < int64(h.config.ExportMinCount) {
+			suppressed++
+			continue
+		}
+		if w, ok := weatherByHour[row.Area+"|"+row.Hour.UTC().Format(time.RFC3339)]; ok {
+			conditions := models.WeatherObservation{Rain: w.Rain, Fog: w.Fog, Snow: w.Snow}
+			row.Weather = conditions.Conditions()
+			row.PrecipitationMM = w.PrecipitationMM
+			row.Lux = w.Lux
+		}
+		kept = append(kept, row)
+	}
+
+	filename := fmt.Sprintf("movement_%s_%s.%s", from.UTC().Format("20060102T15"), to.UTC().Format("20060102T15"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Suppressed-Rows", strconv.Itoa(suppressed))
+
+	if format == "parquet" {
+		c.Header("Content-Type", "application/vnd.apache.parquet")
+		c.Status(http.StatusOK)
+		writer := utils.NewParquetWriter(c.Writer, []utils.ParquetColumn{
+			{Name: "hour", Type: utils.ParquetTimestamp},
+			{Name: "camera_id", Type: utils.ParquetInt64},
+			{Name: "camera_name", Type: utils.ParquetString},
+			{Name: "area", Type: utils.ParquetString},
+			{Name: "building", Type: utils.ParquetString},
+			{Name: "motion_events", Type: utils.ParquetInt64},
+			{Name: "weather", Type: utils.ParquetString},
+			{Name: "precipitation_mm", Type: utils.ParquetDouble},
+			{Name: "lux", Type: utils.ParquetDouble},
+		})
+		for _, row := range kept {
+			if err := writer.Write(row.Hour.UTC(), int64(row.CameraID), row.CameraName, row.Area, row.Building, row.MotionEvents,
+				row.Weather, row.PrecipitationMM, row.Lux); err != nil {
+				fmt.Printf("[Analytics] Parquet export failed: %v\n", err)
+				return
+			}
+		}
+		if err := writer.Close(); err != nil {
+			fmt.Printf("[Analytics] Parquet export failed: %v\n", err)
+		}
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"hour", "camera_id", "camera_name", "area", "building", "motion_events", "weather", "precipitation_mm", "lux"})
+	for _, row := range kept {
+		precipitation, lux := "", ""
+		if row.Weather != "" {
+			precipitation = strconv.FormatFloat(row.PrecipitationMM, 'f', 2, 64)
+			lux = strconv.FormatFloat(row.Lux, 'f', 0, 64)
+		}
+		writer.Write([]string{
+			row.Hour.UTC().Format(time.RFC3339),
+			strconv.FormatUint(uint64(row.CameraID), 10),
+			row.CameraName,
+			row.Area,
+			row.Building,
+			strconv.FormatInt(row.MotionEvents, 10),
+			row.Weather,
+			precipitation,
+			lux,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		fmt.Printf("[Analytics] CSV export failed: %v\n", err)
+	}
+}
+
+func (h *AnalyticsHandler) ListPrivacyZones(c *gin.Context) {
+	zones := []models.PrivacyZone{}
+	if err := requestDB(h.db, c).Order("name").Find(&zones).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch privacy zones"})
+		return
+	}
+
+	c.JSON(http.StatusOK, zones)
+}
+
+// CreatePrivacyZone excludes a camera (camera_id) or a whole area (area)
+// from analytics exports
+func (h *AnalyticsHandler) CreatePrivacyZone(c *gin.Context) {
+	var req CreatePrivacyZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.CameraID == nil) == (req.Area == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either camera_id or area"})
+		return
+	}
+	if req.CameraID != nil {
+		var camera models.Camera
+		if err := requestDB(h.db, c).Select("id").First(&camera, *req.CameraID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+	}
+
+	zone := models.PrivacyZone{
+		Name:     req.Name,
+		CameraID: req.CameraID,
+		Area:     req.Area,
+		Reason:   req.Reason,
+	}
+	if err := requestDB(h.db, c).Create(&zone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create privacy zone"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "privacy_zone", fmt.Sprint(zone.ID), fmt.Sprintf("%s: %s", zone.Name, zone.Reason))
+
+	c.JSON(http.StatusCreated, zone)
+}
+
+func (h *AnalyticsHandler) DeletePrivacyZone(c *gin.Context) {
+	var zone models.PrivacyZone
+	if err := requestDB(h.db, c).First(&zone, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Privacy zone not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch privacy zone"})
+		return
+	}
+
+	if err := requestDB(h.db, c).Delete(&zone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete privacy zone"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "privacy_zone", fmt.Sprint(zone.ID), zone.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Privacy zone deleted"})
+}
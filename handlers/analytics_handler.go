@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultAnalyticsWindow = 24 * time.Hour
+
+type AnalyticsHandler struct {
+	db     *gorm.DB
+	config config.AnalyticsConfig
+}
+
+func NewAnalyticsHandler(db *gorm.DB, cfg config.AnalyticsConfig) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// CameraUsageSummary is the total FFmpeg cost of one camera over a window
+type CameraUsageSummary struct {
+	CameraID    uint    `json:"camera_id"`
+	CameraName  string  `json:"camera_name"`
+	CPUSeconds  float64 `json:"cpu_seconds"`
+	BytesOut    int64   `json:"bytes_out"`
+	AvgCPUCores float64 `json:"avg_cpu_cores"` // cpu_seconds / window seconds
+	AvgMbps     float64 `json:"avg_mbps"`
+}
+
+// parseAnalyticsWindow reads ?from=&to=, defaulting to the last 24 hours
+func parseAnalyticsWindow(c *gin.Context) (time.Time, time.Time, error) {
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	end := time.Now()
+	if to != nil {
+		end = *to
+	}
+	start := end.Add(-defaultAnalyticsWindow)
+	if from != nil {
+		start = *from
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return start, end, nil
+}
+
+// GetCameraUsage ranks cameras by FFmpeg CPU time over a window
+// Query: ?from=&to=&pipeline=
+func (h *AnalyticsHandler) GetCameraUsage(c *gin.Context) {
+	from, to, err := parseAnalyticsWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Table("camera_usages").
+		Select("camera_usages.camera_id, cameras.name AS camera_name, SUM(camera_usages.cpu_seconds) AS cpu_seconds, SUM(camera_usages.bytes_out) AS bytes_out").
+		Joins("LEFT JOIN cameras ON cameras.id = camera_usages.camera_id").
+		Scopes(database.TimeRange("camera_usages.hour", &from, &to))
+	if pipeline := c.Query("pipeline"); pipeline != "" {
+		query = query.Where("camera_usages.pipeline = ?", pipeline)
+	}
+
+	var summaries []CameraUsageSummary
+	if err := query.Group("camera_usages.camera_id, cameras.name").Order("cpu_seconds DESC").Scan(&summaries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera usage"})
+		return
+	}
+
+	window := to.Sub(from).Seconds()
+	for i := range summaries {
+		summaries[i].AvgCPUCores = summaries[i].CPUSeconds / window
+		summaries[i].AvgMbps = float64(summaries[i].BytesOut) * 8 / window / 1_000_000
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"cameras": summaries,
+	})
+}
+
+// GetCameraUsageHistory returns the hourly usage rows for one camera
+// Query: ?from=&to=&pipeline=
+func (h *AnalyticsHandler) GetCameraUsageHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	from, to, err := parseAnalyticsWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Where("camera_id = ?", id).Scopes(database.TimeRange("hour", &from, &to))
+	if pipeline := c.Query("pipeline"); pipeline != "" {
+		query = query.Where("pipeline = ?", pipeline)
+	}
+
+	var usage []models.CameraUsage
+	if err := query.Order("hour ASC, pipeline ASC").Find(&usage).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  from,
+		"to":    to,
+		"hours": usage,
+	})
+}
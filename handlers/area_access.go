@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AreaAccess limits camera routes to the current user's assigned areas,
+// the same scoping as the operator dashboard: admins without assigned areas
+// reach every camera, other users without assigned areas none
+type AreaAccess struct {
+	db *gorm.DB
+}
+
+func NewAreaAccess(db *gorm.DB) *AreaAccess {
+	return &AreaAccess{db: db}
+}
+
+// Camera only lets the request through when the camera in :id is in one
+// of the user's areas. Must be used after AuthMiddleware.
+func (a *AreaAccess) Camera(c *gin.Context) {
+	var camera models.Camera
+	if err := a.db.Select("id", "area").First(&camera, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+	allowed, err := a.CameraAllowed(c, &camera)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Camera is outside your assigned areas"})
+	}
+}
+
+// Areas returns the areas the current user may reach, nil for all
+func (a *AreaAccess) Areas(c *gin.Context) ([]string, error) {
+	return userAreas(a.db, c)
+}
+
+// CameraAllowed reports whether the current user may reach a camera
+func (a *AreaAccess) CameraAllowed(c *gin.Context, camera *models.Camera) (bool, error) {
+	areas, err := userAreas(a.db, c)
+	if err != nil {
+		return false, err
+	}
+	return areaAllowed(areas, camera.Area), nil
+}
+
+// userAreas returns the areas the current user may reach (dashboardAreas),
+// nil for all
+func userAreas(db *gorm.DB, c *gin.Context) ([]string, error) {
+	var user models.User
+	if err := requestDB(db, c).Select("id", "role", "assigned_areas").First(&user, c.GetUint("user_id")).Error; err != nil {
+		return nil, err
+	}
+	return dashboardAreas(&user), nil
+}
+
+// areaAllowed reports whether area is one of areas, nil allowing all
+func areaAllowed(areas []string, area string) bool {
+	if areas == nil {
+		return true
+	}
+	for _, allowed := range areas {
+		if allowed == area {
+			return true
+		}
+	}
+	return false
+}
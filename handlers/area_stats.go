@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// areaStatsTTL is how long computed area stats are served to every wall
+// polling them, so a room of walls costs three queries every few seconds
+const areaStatsTTL = 5 * time.Second
+
+// AreaStats are the live numbers of one area for the widgets above the
+// video wall. Up and down count cameras in monitored statuses; Other counts
+// the rest (awaiting install, decommissioned, ...).
+type AreaStats struct {
+	Area              string `json:"area"`
+	Cameras           int64  `json:"cameras"`
+	CamerasUp         int64  `json:"cameras_up"`
+	CamerasDown       int64  `json:"cameras_down"`
+	CamerasOther      int64  `json:"cameras_other"`
+	EventsLastHour    int64  `json:"events_last_hour"`
+	CriticalLastHour  int64  `json:"critical_events_last_hour"`
+	ActiveIncidents   int64  `json:"active_incidents"`
+	CriticalIncidents int64  `json:"critical_incidents"`
+}
+
+// GetAreaStats returns live per-area stats (cameras up/down, events in the
+// last hour, open incidents) of the current user's areas, busiest first
+func (h *DashboardHandler) GetAreaStats(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var user models.User
+	if err := requestDB(h.db, c).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	stats, computedAt, err := h.allAreaStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute area stats"})
+		return
+	}
+
+	areas := dashboardAreas(&user)
+	if areas != nil {
+		allowed := make(map[string]bool, len(areas))
+		for _, area := range areas {
+			allowed[area] = true
+		}
+		scoped := make([]AreaStats, 0, len(areas))
+		for _, s := range stats {
+			if allowed[s.Area] {
+				scoped = append(scoped, s)
+			}
+		}
+		stats = scoped
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"computed_at": computedAt,
+		"areas":       stats,
+	})
+}
+
+// allAreaStats returns the stats of every area, recomputed at most every
+// areaStatsTTL
+func (h *DashboardHandler) allAreaStats() ([]AreaStats, time.Time, error) {
+	h.areaStatsMu.Lock()
+	defer h.areaStatsMu.Unlock()
+
+	if h.areaStats != nil && time.Since(h.areaStatsAt) < areaStatsTTL {
+		return h.areaStats, h.areaStatsAt, nil
+	}
+
+	byArea := make(map[string]*AreaStats)
+	area := func(name string) *AreaStats {
+		s, ok := byArea[name]
+		if !ok {
+			s = &AreaStats{Area: name}
+			byArea[name] = s
+		}
+		return s
+	}
+
+	var cameraRows []struct {
+		Area   string
+		Status string
+		Count  int64
+	}
+	if err := h.db.Model(&models.Camera{}).
+		Select("area, status, COUNT(*) AS count").Group("area, status").
+		Scan(&cameraRows).Error; err != nil {
+		return nil, time.Time{}, err
+	}
+	for _, row := range cameraRows {
+		s := area(row.Area)
+		s.Cameras += row.Count
+		if row.Status == models.CameraStatusOnline {
+			s.CamerasUp += row.Count
+		} else if h.statuses.Monitored(row.Status) {
+			s.CamerasDown += row.Count
+		} else {
+			s.CamerasOther += row.Count
+		}
+	}
+
+	var eventRows []struct {
+		Area     string
+		Count    int64
+		Critical int64
+	}
+	if err := h.db.Table("events").
+		Select("cameras.area, COUNT(*) AS count, COUNT(*) FILTER (WHERE events.severity = 'critical') AS critical").
+		Joins("JOIN cameras ON cameras.id = events.camera_id AND cameras.deleted_at IS NULL").
+		Where("events.occurred_at >= ?", time.Now().Add(-time.Hour)).
+		Group("cameras.area").
+		Scan(&eventRows).Error; err != nil {
+		return nil, time.Time{}, err
+	}
+	for _, row := range eventRows {
+		s := area(row.Area)
+		s.EventsLastHour = row.Count
+		s.CriticalLastHour = row.Critical
+	}
+
+	// Incidents count in their own area, or their camera's when they have none
+	var incidentRows []struct {
+		Area     string
+		Count    int64
+		Critical int64
+	}
+	if err := h.db.Model(&models.Incident{}).
+		Select("COALESCE(NULLIF(incidents.area, ''), cameras.area, '') AS area, COUNT(*) AS count, COUNT(*) FILTER (WHERE incidents.severity = 'critical') AS critical").
+		Joins("LEFT JOIN cameras ON cameras.id = incidents.camera_id AND cameras.deleted_at IS NULL").
+		Where("incidents.status = ?", "open").
+		Group("1").
+		Scan(&incidentRows).Error; err != nil {
+		return nil, time.Time{}, err
+	}
+	for _, row := range incidentRows {
+		if row.Area == "" {
+			continue
+		}
+		s := area(row.Area)
+		s.ActiveIncidents = row.Count
+		s.CriticalIncidents = row.Critical
+	}
+
+	stats := make([]AreaStats, 0, len(byArea))
+	for _, s := range byArea {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].ActiveIncidents != stats[j].ActiveIncidents {
+			return stats[i].ActiveIncidents > stats[j].ActiveIncidents
+		}
+		if stats[i].CamerasDown != stats[j].CamerasDown {
+			return stats[i].CamerasDown > stats[j].CamerasDown
+		}
+		return stats[i].Area < stats[j].Area
+	})
+
+	h.areaStats = stats
+	h.areaStatsAt = time.Now()
+	return stats, h.areaStatsAt, nil
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AudioRuleHandler struct {
+	db *gorm.DB
+}
+
+func NewAudioRuleHandler(db *gorm.DB) *AudioRuleHandler {
+	return &AudioRuleHandler{
+		db: db,
+	}
+}
+
+type AudioRuleRequest struct {
+	Name            *string  `json:"name"`
+	ThresholdDB     *float64 `json:"threshold_db"`
+	MinDurationMS   *int     `json:"min_duration_ms"`
+	CooldownSeconds *int     `json:"cooldown_seconds"`
+	Severity        *string  `json:"severity" binding:"omitempty,oneof=info warning critical"`
+	ScheduleDays    *string  `json:"schedule_days"`
+	ScheduleStart   *string  `json:"schedule_start"`
+	ScheduleEnd     *string  `json:"schedule_end"`
+	Enabled         *bool    `json:"enabled"`
+}
+
+// apply copies the provided fields onto rule and validates the result
+func (req *AudioRuleRequest) apply(rule *models.AudioRule) error {
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.ThresholdDB != nil {
+		rule.ThresholdDB = *req.ThresholdDB
+	}
+	if req.MinDurationMS != nil {
+		rule.MinDurationMS = *req.MinDurationMS
+	}
+	if req.CooldownSeconds != nil {
+		rule.CooldownSeconds = *req.CooldownSeconds
+	}
+	if req.Severity != nil {
+		rule.Severity = *req.Severity
+	}
+	if req.ScheduleDays != nil {
+		rule.ScheduleDays = *req.ScheduleDays
+	}
+	if req.ScheduleStart != nil {
+		rule.ScheduleStart = *req.ScheduleStart
+	}
+	if req.ScheduleEnd != nil {
+		rule.ScheduleEnd = *req.ScheduleEnd
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rule.ThresholdDB > 0 || rule.ThresholdDB < -120 {
+		return fmt.Errorf("threshold_db must be between -120 and 0 dBFS")
+	}
+	if rule.MinDurationMS < 0 || rule.CooldownSeconds < 0 {
+		return fmt.Errorf("min_duration_ms and cooldown_seconds must not be negative")
+	}
+	return validateSchedule(rule.ScheduleDays, rule.ScheduleStart, rule.ScheduleEnd)
+}
+
+// ListAudioRules returns the audio level rules of a camera
+func (h *AudioRuleHandler) ListAudioRules(c *gin.Context) {
+	var rules []models.AudioRule
+	if err := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).Order("id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audio rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *AudioRuleHandler) CreateAudioRule(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	var req AudioRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ThresholdDB == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "threshold_db is required"})
+		return
+	}
+
+	rule := models.AudioRule{
+		CameraID:        camera.ID,
+		MinDurationMS:   500,
+		CooldownSeconds: 60,
+		Severity:        "warning",
+		Enabled:         true,
+	}
+	if err := req.apply(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create audio rule"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "audio_rule", fmt.Sprint(rule.ID), rule.Name)
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *AudioRuleHandler) UpdateAudioRule(c *gin.Context) {
+	var rule models.AudioRule
+	if err := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).First(&rule, c.Param("ruleId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Audio rule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audio rule"})
+		return
+	}
+
+	var req AudioRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update audio rule"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "audio_rule", fmt.Sprint(rule.ID), rule.Name)
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *AudioRuleHandler) DeleteAudioRule(c *gin.Context) {
+	result := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).Delete(&models.AudioRule{}, c.Param("ruleId"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete audio rule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Audio rule not found"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "audio_rule", c.Param("ruleId"), "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Audio rule deleted successfully"})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuditHandler struct {
+	db *gorm.DB
+}
+
+func NewAuditHandler(db *gorm.DB) *AuditHandler {
+	return &AuditHandler{
+		db: db,
+	}
+}
+
+// ListAuditLogs returns audit log entries newest first using cursor pagination
+// Query: ?after=&limit=&user_id=&resource_type=&resource_id=&from=&to=
+func (h *AuditHandler) ListAuditLogs(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := parseUintParam(c, "user_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.AuditLog{}).Scopes(database.TimeRange("created_at", from, to))
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if resourceType := c.Query("resource_type"); resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	if resourceID := c.Query("resource_id"); resourceID != "" {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("created_at", cursor.Time, cursor.ID))
+	}
+
+	var logs []models.AuditLog
+	if err := query.Scopes(database.NewestFirst("created_at")).Limit(limit + 1).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(logs, limit, func(l models.AuditLog) (time.Time, uint) {
+		return l.CreatedAt, l.ID
+	}))
+}
+
+// currentUserID returns the authenticated user's ID, nil when unknown
+func currentUserID(c *gin.Context) *uint {
+	if value, exists := c.Get("user_id"); exists {
+		if id, ok := value.(uint); ok {
+			return &id
+		}
+	}
+	return nil
+}
+
+// requestDB returns db with the request's context, so slow query logs and
+// traces name the handler a query ran for. The context isn't cancelled
+// with the request: a client going away mustn't abort writes half done.
+func requestDB(db *gorm.DB, c *gin.Context) *gorm.DB {
+	return db.WithContext(context.WithoutCancel(c.Request.Context()))
+}
+
+// recordAudit stores an audit log entry for the current user.
+// Failures are logged but never fail the request being audited.
+func recordAudit(db *gorm.DB, c *gin.Context, action, resourceType, resourceID, details string) {
+	entry := models.AuditLog{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      details,
+		IPAddress:    c.ClientIP(),
+		UserID:       currentUserID(c),
+	}
+
+	if err := requestDB(db, c).Create(&entry).Error; err != nil {
+		log.Printf("[Audit] Failed to record %s %s %s: %v\n", action, resourceType, resourceID, err)
+	}
+}
@@ -1,27 +1,29 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
-	"command-center-vms-cctv/be/config"
 	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	db        *gorm.DB
-	jwtConfig config.JWTConfig
+	db       *gorm.DB
+	sessions *services.SessionService
+	oidc     *services.OIDCService
 }
 
-func NewAuthHandler(db *gorm.DB, jwtConfig config.JWTConfig) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, sessions *services.SessionService, oidc *services.OIDCService) *AuthHandler {
 	return &AuthHandler{
-		db:        db,
-		jwtConfig: jwtConfig,
+		db:       db,
+		sessions: sessions,
+		oidc:     oidc,
 	}
 }
 
@@ -30,9 +32,21 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// LoginResponse is returned by login and refresh: a short-lived access
+// token and the refresh token that renews it
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  UserResponse `json:"user"`
+	services.TokenPair
+	User UserResponse `json:"user"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// SessionResponse is a session with whether it is the caller's own
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
 }
 
 type UserResponse struct {
@@ -40,6 +54,29 @@ type UserResponse struct {
 	Email string `json:"email"`
 	Name  string `json:"name"`
 	Role  string `json:"role"`
+
+	AssignedAreas []string `json:"assigned_areas"`
+
+	Phone             string     `json:"phone"`
+	Department        string     `json:"department"`
+	AvatarURL         string     `json:"avatar_url"`
+	DirectorySyncedAt *time.Time `json:"directory_synced_at,omitempty"`
+}
+
+func newUserResponse(user *models.User) UserResponse {
+	return UserResponse{
+		ID:    user.ID,
+		Email: user.Email,
+		Name:  user.Name,
+		Role:  user.Role,
+
+		AssignedAreas: user.Areas(),
+
+		Phone:             user.Phone,
+		Department:        user.Department,
+		AvatarURL:         user.Avatar(),
+		DirectorySyncedAt: user.DirectorySyncedAt,
+	}
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -51,7 +88,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Find user
 	var user models.User
-	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if err := requestDB(h.db, c).Where("email = ?", req.Email).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
@@ -66,30 +103,37 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	expiry, _ := time.ParseDuration(h.jwtConfig.Expiry)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"role":    user.Role,
-		"exp":     time.Now().Add(expiry).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(h.jwtConfig.Secret))
+	// Start a session and issue its tokens
+	tokens, err := h.sessions.Create(&user, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: tokenString,
-		User: UserResponse{
-			ID:    user.ID,
-			Email: user.Email,
-			Name:  user.Name,
-			Role:  user.Role,
-		},
-	})
+	c.JSON(http.StatusOK, loginResponse(tokens, &user))
+}
+
+// Refresh trades a refresh token in for a new access token. The refresh
+// token is rotated too: the old one stops working, and presenting it again
+// revokes the session, since it must have been copied.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := h.sessions.Refresh(req.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		if err == services.ErrInvalidRefreshToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginResponse(tokens, user))
 }
 
 func (h *AuthHandler) GetMe(c *gin.Context) {
@@ -100,22 +144,90 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := requestDB(h.db, c).First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, UserResponse{
-		ID:    user.ID,
-		Email: user.Email,
-		Name:  user.Name,
-		Role:  user.Role,
-	})
+	c.JSON(http.StatusOK, newUserResponse(&user))
 }
 
+// Logout revokes the current session: its refresh token and every access
+// token issued for it stop working
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// In a stateless JWT system, logout is handled client-side by removing the token
-	// But we can add token blacklisting here if needed
+	if err := h.sessions.Revoke(c.GetUint("session_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
+// ListSessions returns the caller's active sessions, newest first
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	sessions := []models.Session{}
+	if err := requestDB(h.db, c).Where("user_id = ? AND revoked_at IS NULL AND expires_at > NOW()", c.GetUint("user_id")).
+		Order("created_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	current := c.GetUint("session_id")
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{Session: session, Current: session.ID == current})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession ends one of the caller's sessions, e.g. on a lost device
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	var session models.Session
+	if err := requestDB(h.db, c).Where("user_id = ?", c.GetUint("user_id")).First(&session, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch session"})
+		return
+	}
+
+	if err := h.sessions.Revoke(session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	recordAudit(h.db, c, "revoke", "session", fmt.Sprint(session.ID), fmt.Sprintf("%s from %s", session.UserAgent, session.ClientIP))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeUserSessions ends every session of a user (admin), e.g. when their
+// credentials may have been stolen
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	var user models.User
+	if err := requestDB(h.db, c).First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	revoked, err := h.sessions.RevokeUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	recordAudit(h.db, c, "revoke_sessions", "user", fmt.Sprint(user.ID), fmt.Sprintf("%s: %d sessions revoked", user.Email, revoked))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "sessions_revoked": revoked})
+}
+
+func loginResponse(tokens *services.TokenPair, user *models.User) LoginResponse {
+	return LoginResponse{
+		TokenPair: *tokens,
+		User:      newUserResponse(user),
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxBatchDelete = 500
+
+// What happens to recordings and incidents of cameras deleted in a batch
+const (
+	DeleteModeBlock   = "block"   // Refuse the whole batch if any camera has some
+	DeleteModeCascade = "cascade" // Delete the recordings (files included) and detach the incidents, as DeleteCamera; refused while any recording is on legal hold
+	DeleteModeArchive = "archive" // Keep them; the cameras are soft-deleted as archived
+)
+
+// CameraDependents is what depends on a camera in a batch delete
+type CameraDependents struct {
+	CameraID       uint   `json:"camera_id"`
+	Name           string `json:"name"`
+	Recordings     int64  `json:"recordings"`
+	HeldRecordings int64  `json:"held_recordings"` // Under legal hold, block cascading deletes
+	Incidents      int64  `json:"incidents"`
+	OpenIncidents  int64  `json:"open_incidents"`
+}
+
+// BatchDeleteResult is the response of DeleteCameras
+type BatchDeleteResult struct {
+	Mode                string             `json:"mode"`
+	DryRun              bool               `json:"dry_run"`
+	Cameras             []CameraDependents `json:"cameras"`
+	NotFound            []uint             `json:"not_found,omitempty"`
+	Deleted             []uint             `json:"deleted"`
+	RecordingsDeleted   int64              `json:"recordings_deleted"`
+	EventsDeleted       int64              `json:"events_deleted"`        // With their alerts
+	MotionEventsDeleted int64              `json:"motion_events_deleted"` // With their snapshots
+	IncidentsDetached   int64              `json:"incidents_detached"`    // Kept, with their camera cleared
+}
+
+// parseIDList parses a comma-separated list of IDs, dropping duplicates
+func parseIDList(raw string) ([]uint, error) {
+	var ids []uint
+	seen := make(map[uint]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid id %q", part)
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, nil
+}
+
+// DeleteCameras deletes several cameras at once, checking their recordings
+// and incidents first
+// Query: ?ids=1,2,3 (required), ?mode=block|cascade|archive (default block),
+// ?dry_run=true to only report what would be affected
+func (h *CameraHandler) DeleteCameras(c *gin.Context) {
+	ids, err := parseIDList(c.Query("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids is required"})
+		return
+	}
+	if len(ids) > maxBatchDelete {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d cameras can be deleted at once", maxBatchDelete)})
+		return
+	}
+	mode := c.DefaultQuery("mode", DeleteModeBlock)
+	if mode != DeleteModeBlock && mode != DeleteModeCascade && mode != DeleteModeArchive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be block, cascade or archive"})
+		return
+	}
+
+	result, err := h.cameraDependents(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check camera dependencies"})
+		return
+	}
+	result.Mode = mode
+	result.DryRun = c.Query("dry_run") == "true"
+	result.Deleted = []uint{}
+
+	existing := make([]uint, len(result.Cameras))
+	hasDependents := false
+	var heldRecordings int64
+	for i, camera := range result.Cameras {
+		existing[i] = camera.CameraID
+		heldRecordings += camera.HeldRecordings
+		if camera.Recordings > 0 || camera.Incidents > 0 {
+			hasDependents = true
+		}
+	}
+
+	if mode == DeleteModeBlock && hasDependents {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Some cameras have recordings or incidents; use mode=cascade or mode=archive",
+			"result": result,
+		})
+		return
+	}
+	refuseHeld := func() {
+		recordAudit(h.db, c, "legal_hold_block", "camera", "", fmt.Sprintf("batch delete of cameras %v refused: %d recordings on legal hold", existing, heldRecordings))
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  fmt.Sprintf("%d recordings are on legal hold; release the holds or use mode=archive", heldRecordings),
+			"result": result,
+		})
+	}
+	if mode == DeleteModeCascade && heldRecordings > 0 {
+		refuseHeld()
+		return
+	}
+	if result.DryRun || len(existing) == 0 {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	var cleanup *cameraCleanup
+	err = requestDB(h.db, c).Transaction(func(tx *gorm.DB) (err error) {
+		if mode == DeleteModeCascade {
+			// Again with the cameras locked, for holds placed since
+			if err = lockCameras(tx, existing); err != nil {
+				return err
+			}
+			if err = tx.Model(&models.Recording{}).Where("camera_id IN ?", existing).
+				Scopes(database.OnLegalHold()).Count(&heldRecordings).Error; err != nil {
+				return err
+			}
+			if heldRecordings > 0 {
+				return errLegalHold
+			}
+		}
+		cleanup, err = deleteCameras(tx, existing, mode == DeleteModeArchive)
+		return err
+	})
+	if errors.Is(err, errLegalHold) {
+		refuseHeld()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cameras"})
+		return
+	}
+	result.Deleted = existing
+	result.RecordingsDeleted = cleanup.RecordingsDeleted
+	result.EventsDeleted = cleanup.EventsDeleted
+	result.MotionEventsDeleted = cleanup.MotionEventsDeleted
+	result.IncidentsDetached = cleanup.IncidentsDetached
+
+	cleanup.finish()
+	h.stopDeletedStreams(existing)
+
+	for _, camera := range result.Cameras {
+		recordAudit(h.db, c, "delete", "camera", fmt.Sprint(camera.CameraID),
+			fmt.Sprintf("batch mode=%s recordings=%d incidents=%d", mode, camera.Recordings, camera.Incidents))
+	}
+	h.changes.notify()
+
+	c.JSON(http.StatusOK, result)
+}
+
+// cameraDependents counts recordings and incidents of the given cameras and
+// lists the IDs that don't exist
+func (h *CameraHandler) cameraDependents(ids []uint) (*BatchDeleteResult, error) {
+	var cameras []models.Camera
+	if err := h.db.Select("id", "name").Where("id IN ?", ids).Order("id").Find(&cameras).Error; err != nil {
+		return nil, err
+	}
+
+	var recordingRows []struct {
+		CameraID uint
+		Count    int64
+	}
+	if err := h.db.Model(&models.Recording{}).
+		Select("camera_id, COUNT(*) AS count").
+		Where("camera_id IN ?", ids).
+		Group("camera_id").
+		Scan(&recordingRows).Error; err != nil {
+		return nil, err
+	}
+	var heldRows []struct {
+		CameraID uint
+		Count    int64
+	}
+	if err := h.db.Model(&models.Recording{}).
+		Select("camera_id, COUNT(*) AS count").
+		Where("camera_id IN ?", ids).
+		Scopes(database.OnLegalHold()).
+		Group("camera_id").
+		Scan(&heldRows).Error; err != nil {
+		return nil, err
+	}
+	var incidentRows []struct {
+		CameraID uint
+		Count    int64
+		Open     int64
+	}
+	if err := h.db.Model(&models.Incident{}).
+		Select("camera_id, COUNT(*) AS count, COUNT(*) FILTER (WHERE status = 'open') AS open").
+		Where("camera_id IN ?", ids).
+		Group("camera_id").
+		Scan(&incidentRows).Error; err != nil {
+		return nil, err
+	}
+
+	recordings := make(map[uint]int64, len(recordingRows))
+	for _, row := range recordingRows {
+		recordings[row.CameraID] = row.Count
+	}
+	held := make(map[uint]int64, len(heldRows))
+	for _, row := range heldRows {
+		held[row.CameraID] = row.Count
+	}
+	incidents := make(map[uint]int64, len(incidentRows))
+	openIncidents := make(map[uint]int64, len(incidentRows))
+	for _, row := range incidentRows {
+		incidents[row.CameraID] = row.Count
+		openIncidents[row.CameraID] = row.Open
+	}
+
+	result := &BatchDeleteResult{Cameras: make([]CameraDependents, len(cameras))}
+	found := make(map[uint]bool, len(cameras))
+	for i, camera := range cameras {
+		found[camera.ID] = true
+		result.Cameras[i] = CameraDependents{
+			CameraID:       camera.ID,
+			Name:           camera.Name,
+			Recordings:     recordings[camera.ID],
+			HeldRecordings: held[camera.ID],
+			Incidents:      incidents[camera.ID],
+			OpenIncidents:  openIncidents[camera.ID],
+		}
+	}
+	for _, id := range ids {
+		if !found[id] {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cameraChangeColumn is when a camera last changed, counting soft deletes
+const cameraChangeColumn = "COALESCE(deleted_at, updated_at)"
+
+const maxChangesWait = 30 * time.Second
+
+// CameraChange is one entry of the camera sync feed
+type CameraChange struct {
+	Type     string         `json:"type"` // created, updated, deleted
+	CameraID uint           `json:"camera_id"`
+	Camera   *models.Camera `json:"camera,omitempty"` // Omitted for deletes
+}
+
+// CameraChangesPage is the response of GetCameraChanges. next_cursor is always
+// set; pass it back as ?since= to continue syncing from this point.
+type CameraChangesPage struct {
+	Changes    []CameraChange `json:"changes"`
+	NextCursor string         `json:"next_cursor"`
+	HasMore    bool           `json:"has_more"`
+}
+
+// changeNotifier wakes long-polling requests when something changes.
+// Waiters get a channel that is closed on the next notify.
+type changeNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func newChangeNotifier() *changeNotifier {
+	return &changeNotifier{ch: make(chan struct{})}
+}
+
+func (n *changeNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch
+}
+
+func (n *changeNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// GetCameraChanges returns cameras created, updated or deleted since a cursor,
+// oldest change first, so clients can sync incrementally. Without ?since= the
+// feed starts from the beginning (a full sync).
+// Query: ?since=&limit=&wait=<seconds> (long-poll up to 30s when there are no changes)
+func (h *CameraHandler) GetCameraChanges(c *gin.Context) {
+	limit := defaultPageLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		limit = n
+	}
+
+	var since *utils.Cursor
+	if raw := c.Query("since"); raw != "" {
+		decoded, err := utils.DecodeCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since = decoded
+	}
+
+	var wait time.Duration
+	if raw := c.Query("wait"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wait"})
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > maxChangesWait {
+			wait = maxChangesWait
+		}
+	}
+	deadline := time.Now().Add(wait)
+
+	for {
+		// Subscribe before querying so a change in between isn't missed
+		changed := h.changes.wait()
+
+		page, err := h.loadCameraChanges(since, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera changes"})
+			return
+		}
+
+		remaining := time.Until(deadline)
+		if len(page.Changes) > 0 || remaining <= 0 {
+			c.JSON(http.StatusOK, page)
+			return
+		}
+
+		// Re-query on timeout too: changes made by other API instances
+		// don't reach this notifier
+		select {
+		case <-changed:
+		case <-time.After(remaining):
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *CameraHandler) loadCameraChanges(since *utils.Cursor, limit int) (*CameraChangesPage, error) {
+	query := h.db.Unscoped().Model(&models.Camera{})
+	if since != nil {
+		query = query.Scopes(database.SeekAfter(cameraChangeColumn, since.Time, since.ID))
+	}
+
+	var cameras []models.Camera
+	if err := query.Scopes(database.OldestFirst(cameraChangeColumn)).Limit(limit + 1).Find(&cameras).Error; err != nil {
+		return nil, err
+	}
+
+	page := &CameraChangesPage{Changes: []CameraChange{}}
+	if len(cameras) > limit {
+		cameras = cameras[:limit]
+		page.HasMore = true
+	}
+
+	for i := range cameras {
+		camera := &cameras[i]
+		change := CameraChange{CameraID: camera.ID}
+		switch {
+		case camera.DeletedAt.Valid:
+			change.Type = "deleted"
+		case since == nil || camera.CreatedAt.After(since.Time):
+			// The client has never seen this camera
+			change.Type = "created"
+			change.Camera = camera
+		default:
+			change.Type = "updated"
+			change.Camera = camera
+		}
+		page.Changes = append(page.Changes, change)
+	}
+
+	switch {
+	case len(cameras) > 0:
+		last := cameras[len(cameras)-1]
+		changedAt := last.UpdatedAt
+		if last.DeletedAt.Valid {
+			changedAt = last.DeletedAt.Time
+		}
+		page.NextCursor = utils.EncodeCursor(changedAt, last.ID)
+	case since != nil:
+		page.NextCursor = utils.EncodeCursor(since.Time, since.ID)
+	default:
+		// Nothing to sync yet; an empty position sorts before every change
+		page.NextCursor = utils.EncodeCursor(time.Unix(0, 0), 0)
+	}
+
+	return page, nil
+}
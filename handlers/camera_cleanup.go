@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CameraDeleteResult is the response of DeleteCamera
+type CameraDeleteResult struct {
+	CameraID            uint     `json:"camera_id"`
+	Stopped             []string `json:"stopped"` // Pipelines whose streams were stopped
+	RecordingsDeleted   int64    `json:"recordings_deleted"`
+	EventsDeleted       int64    `json:"events_deleted"`        // With their alerts
+	MotionEventsDeleted int64    `json:"motion_events_deleted"` // With their snapshots
+	IncidentsDetached   int64    `json:"incidents_detached"`    // Kept, with their camera cleared
+	LayoutsUpdated      int      `json:"layouts_updated"`       // Wall layouts the camera was removed from
+}
+
+// DeleteCamera deletes a camera and everything hanging off it: its streams
+// are stopped first so nothing keeps pulling it, then its recordings (and
+// files), events and alerts, motion events (and snapshots), rules and wall layout cells
+// go in one transaction. Incidents are kept without the camera. Refused
+// while a legal hold covers the camera. If the transaction fails the
+// MediaMTX path is restored.
+func (h *CameraHandler) DeleteCamera(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	// Checked again in the transaction; this one keeps the streams of a
+	// held camera running
+	holds, err := activeLegalHolds(h.db, camera.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check legal holds"})
+		return
+	}
+	if holds > 0 {
+		h.refuseHeldDelete(c, camera.ID, holds)
+		return
+	}
+
+	result := CameraDeleteResult{CameraID: camera.ID}
+
+	// Stop streams before touching the database so no pipeline writes for a
+	// camera that is half gone; only the MediaMTX path needs restoring on
+	// failure, the others restart on the next request
+	rtspURL := h.credentials.StreamURL(&camera)
+	_, hadPath := h.mediamtxService.GetPathInfo(camera.ID)
+	result.Stopped = h.stopStreams(camera.ID)
+	if hadPath {
+		if err := h.mediamtxService.StopStream(camera.ID); err != nil {
+			fmt.Printf("[Cameras] Failed to remove MediaMTX path of camera %d: %v\n", camera.ID, err)
+		} else {
+			result.Stopped = append(result.Stopped, "mediamtx")
+		}
+	}
+
+	var cleanup *cameraCleanup
+	err = requestDB(h.db, c).Transaction(func(tx *gorm.DB) (err error) {
+		if err = lockCameras(tx, []uint{camera.ID}); err != nil {
+			return err
+		}
+		if holds, err = activeLegalHolds(tx, camera.ID); err != nil {
+			return err
+		}
+		if holds > 0 {
+			return errLegalHold
+		}
+		cleanup, err = deleteCameras(tx, []uint{camera.ID}, false)
+		return err
+	})
+	if err != nil {
+		// Compensate: put the HLS path back so viewers aren't cut off by a failed delete
+		if hadPath {
+			if _, restartErr := h.mediamtxService.StartStream(camera.ID, rtspURL); restartErr != nil {
+				fmt.Printf("[Cameras] Failed to restore MediaMTX path of camera %d: %v\n", camera.ID, restartErr)
+			}
+		}
+		if errors.Is(err, errLegalHold) {
+			h.refuseHeldDelete(c, camera.ID, holds)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete camera"})
+		return
+	}
+
+	cleanup.finish()
+	result.RecordingsDeleted = cleanup.RecordingsDeleted
+	result.EventsDeleted = cleanup.EventsDeleted
+	result.MotionEventsDeleted = cleanup.MotionEventsDeleted
+	result.IncidentsDetached = cleanup.IncidentsDetached
+	result.LayoutsUpdated = cleanup.LayoutsUpdated
+
+	recordAudit(h.db, c, "delete", "camera", fmt.Sprint(camera.ID), fmt.Sprintf(
+		"%s: stopped %v, recordings=%d events=%d incidents detached=%d", camera.Name,
+		result.Stopped, result.RecordingsDeleted, result.EventsDeleted, result.IncidentsDetached))
+	h.changes.notify()
+
+	c.JSON(http.StatusOK, result)
+}
+
+// refuseHeldDelete answers a delete of a camera under legal hold
+func (h *CameraHandler) refuseHeldDelete(c *gin.Context, cameraID uint, holds int64) {
+	recordAudit(h.db, c, "legal_hold_block", "camera", fmt.Sprint(cameraID), fmt.Sprintf("delete refused: %d active legal holds", holds))
+	c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Camera has %d active legal holds; release them first", holds)})
+}
+
+// errLegalHold rolls back a delete that found a legal hold once the
+// cameras were locked
+var errLegalHold = errors.New("cameras are under legal hold")
+
+// lockCameras locks the cameras' rows until tx ends. CreateLegalHold takes
+// the same rows in share mode, so no hold can be placed between a delete's
+// legal hold check and its commit.
+func lockCameras(tx *gorm.DB, ids []uint) error {
+	var locked []uint
+	return tx.Model(&models.Camera{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).Pluck("id", &locked).Error
+}
+
+// activeLegalHolds counts the unreleased legal holds of a camera
+func activeLegalHolds(db *gorm.DB, cameraID uint) (int64, error) {
+	var holds int64
+	err := db.Model(&models.LegalHold{}).Where("camera_id = ? AND released_at IS NULL", cameraID).Count(&holds).Error
+	return holds, err
+}
+
+// stopStreams stops a camera's WebRTC, MJPEG, legacy HLS and audio streams
+// and its recording, and returns the pipelines that had one. Scheduled
+// recording resumes on its own with the camera's current URL. The MediaMTX
+// path is left to the caller, which either removes or reconfigures it.
+// Other cluster nodes stop their WebRTC and MJPEG streams of the camera
+// shortly after.
+func (h *CameraHandler) stopStreams(cameraID uint) []string {
+	h.cluster.RequestStreamStop(cameraID)
+	stopped := h.stopViewerStreams(cameraID)
+	if h.recordings.Stop(cameraID) {
+		stopped = append(stopped, "recording")
+	}
+	return stopped
+}
+
+// stopViewerStreams stops the streams this node runs for viewers of a
+// camera: WebRTC, MJPEG, legacy HLS and audio
+func (h *CameraHandler) stopViewerStreams(cameraID uint) []string {
+	stopped := []string{}
+	if h.webrtcService.StopStream(cameraID) == nil {
+		stopped = append(stopped, "webrtc")
+	}
+	if h.mjpegService.StopStream(cameraID) == nil {
+		stopped = append(stopped, "mjpeg")
+	}
+	if h.rtspService.StopStream(cameraID) == nil {
+		stopped = append(stopped, "hls_legacy")
+	}
+	if h.audioService.StopStreams(cameraID) > 0 {
+		stopped = append(stopped, "audio")
+	}
+	return stopped
+}
+
+// cameraCleanup is what deleteCameras removed, with the files to remove
+// once the transaction is committed
+type cameraCleanup struct {
+	CameraIDs           []uint
+	RecordingsDeleted   int64
+	EventsDeleted       int64
+	MotionEventsDeleted int64
+	IncidentsDetached   int64
+	LayoutsUpdated      int
+
+	files     []string // Recordings and retained clips
+	snapshots []string // Motion snapshots
+}
+
+// deleteCameras deletes cameras in tx along with everything hanging off
+// them, the one cleanup path of single, batch and plan deletes. Their
+// recordings (and retained clips), events and alerts and motion events go
+// unless keepHistory (archive deletes), and incidents are kept without the
+// camera. The rest goes in every case (cleanupCameraRefs).
+func deleteCameras(tx *gorm.DB, ids []uint, keepHistory bool) (*cameraCleanup, error) {
+	cleanup := &cameraCleanup{CameraIDs: ids}
+	if !keepHistory {
+		if err := tx.Model(&models.Recording{}).Where("camera_id IN ?", ids).Pluck("file_path", &cleanup.files).Error; err != nil {
+			return nil, err
+		}
+		recordings := tx.Where("camera_id IN ?", ids).Delete(&models.Recording{})
+		if recordings.Error != nil {
+			return nil, recordings.Error
+		}
+		cleanup.RecordingsDeleted = recordings.RowsAffected
+		var clips []string
+		if err := tx.Model(&models.RetainedClip{}).Where("camera_id IN ?", ids).Pluck("file_path", &clips).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("camera_id IN ?", ids).Delete(&models.RetainedClip{}).Error; err != nil {
+			return nil, err
+		}
+		cleanup.files = append(cleanup.files, clips...)
+
+		events := tx.Where("camera_id IN ?", ids).Delete(&models.Event{})
+		if events.Error != nil {
+			return nil, events.Error
+		}
+		cleanup.EventsDeleted = events.RowsAffected
+		if err := tx.Where("camera_id IN ?", ids).Delete(&models.Alert{}).Error; err != nil {
+			return nil, err
+		}
+
+		if err := tx.Model(&models.MotionEvent{}).Where("camera_id IN ?", ids).Pluck("snapshot_path", &cleanup.snapshots).Error; err != nil {
+			return nil, err
+		}
+		motion := tx.Where("camera_id IN ?", ids).Delete(&models.MotionEvent{})
+		if motion.Error != nil {
+			return nil, motion.Error
+		}
+		cleanup.MotionEventsDeleted = motion.RowsAffected
+
+		incidents := tx.Model(&models.Incident{}).Where("camera_id IN ?", ids).Update("camera_id", nil)
+		if incidents.Error != nil {
+			return nil, incidents.Error
+		}
+		cleanup.IncidentsDetached = incidents.RowsAffected
+	}
+
+	layouts, err := cleanupCameraRefs(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	cleanup.LayoutsUpdated = layouts
+
+	if err := tx.Where("id IN ?", ids).Delete(&models.Camera{}).Error; err != nil {
+		return nil, err
+	}
+	return cleanup, nil
+}
+
+// finish removes the files of the deleted rows and the cameras' stream
+// logs. Called after the commit so a rollback never leaves rows without
+// files.
+func (c *cameraCleanup) finish() {
+	removeRecordingFiles(c.files)
+	for _, path := range c.snapshots {
+		services.RemoveMotionSnapshot(path)
+	}
+	for _, id := range c.CameraIDs {
+		services.ClearStreamLogs(id)
+	}
+}
+
+// stopDeletedStreams stops whatever still pulls cameras deleted in a batch
+// or by a plan, MediaMTX paths included
+func (h *CameraHandler) stopDeletedStreams(ids []uint) {
+	for _, id := range ids {
+		h.stopStreams(id)
+		if _, active := h.mediamtxService.GetPathInfo(id); active {
+			if err := h.mediamtxService.StopStream(id); err != nil {
+				fmt.Printf("[Cameras] Failed to remove MediaMTX path of camera %d: %v\n", id, err)
+			}
+		}
+	}
+}
+
+// cleanupCameraRefs removes what only makes sense for existing cameras:
+// audio, alert and counting rules, tamper baselines, health history, privacy
+// zones, privacy schedules and blackouts, recording schedules, patrol
+// bookmarks, wall layout cells and camera group members, and detaches
+// visitor check-ins, which are kept.
+// Returns how many layouts were changed.
+func cleanupCameraRefs(tx *gorm.DB, ids []uint) (int, error) {
+	for _, model := range []interface{}{
+		&models.AudioRule{},
+		&models.AlertRule{},
+		&models.CountingRule{},
+		&models.TamperBaseline{},
+		&models.QualitySample{},
+		&models.StreamHealthChange{},
+		&models.CameraStatusEvent{},
+		&models.PrivacyZone{},
+		&models.PrivacySchedule{},
+		&models.PrivacyBlackout{},
+		&models.RecordingSchedule{},
+		&models.PatrolBookmark{},
+		&models.WebhookDelivery{},
+		&models.Webhook{},
+	} {
+		if err := tx.Where("camera_id IN ?", ids).Delete(model).Error; err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Model(&models.VisitorCheckIn{}).Where("camera_id IN ?", ids).Update("camera_id", nil).Error; err != nil {
+		return 0, err
+	}
+
+	deleted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	var layouts []models.WallLayout
+	if err := tx.Find(&layouts).Error; err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, layout := range layouts {
+		cameras := layout.Cameras()
+		kept := make([]string, 0, len(cameras))
+		for _, id := range cameras {
+			if !deleted[id] {
+				kept = append(kept, fmt.Sprint(id))
+			}
+		}
+		if len(kept) == len(cameras) {
+			continue
+		}
+		if err := tx.Model(&layout).Update("camera_ids", strings.Join(kept, ",")).Error; err != nil {
+			return 0, err
+		}
+		updated++
+	}
+
+	var groups []models.CameraGroup
+	if err := tx.Find(&groups).Error; err != nil {
+		return 0, err
+	}
+	for _, group := range groups {
+		cameras := group.Cameras()
+		kept := make([]string, 0, len(cameras))
+		for _, id := range cameras {
+			if !deleted[id] {
+				kept = append(kept, fmt.Sprint(id))
+			}
+		}
+		if len(kept) == len(cameras) {
+			continue
+		}
+		if err := tx.Model(&group).Update("camera_ids", strings.Join(kept, ",")).Error; err != nil {
+			return 0, err
+		}
+	}
+	return updated, nil
+}
+
+// removeRecordingFiles deletes recording files whose rows are gone, with
+// their thumbnail sprites
+func removeRecordingFiles(files []string) {
+	for _, path := range files {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[Cameras] Failed to remove recording %s: %v\n", path, err)
+		}
+		if err := os.Remove(services.SpritePath(path)); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[Cameras] Failed to remove thumbnails of %s: %v\n", path, err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxGroupCameras = 500
+
+type CameraGroupHandler struct {
+	db *gorm.DB
+}
+
+func NewCameraGroupHandler(db *gorm.DB) *CameraGroupHandler {
+	return &CameraGroupHandler{
+		db: db,
+	}
+}
+
+type CreateCameraGroupRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	CameraIDs   []uint `json:"camera_ids"`
+	Personal    bool   `json:"personal"` // Only visible to the creator
+}
+
+type UpdateCameraGroupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	CameraIDs   *[]uint `json:"camera_ids"`
+}
+
+// CameraGroupResponse is a group with its cameras, in the group's order
+type CameraGroupResponse struct {
+	models.CameraGroup
+	Cameras []models.Camera `json:"cameras"`
+}
+
+// ownedOrShared limits a query to shared rows and the current user's own.
+// ?mine=true leaves only the user's own.
+func ownedOrShared(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	userID := currentUserID(c)
+	mine := c.Query("mine") == "true"
+	return func(db *gorm.DB) *gorm.DB {
+		switch {
+		case userID == nil:
+			return db.Where("owner_id IS NULL")
+		case mine:
+			return db.Where("owner_id = ?", *userID)
+		default:
+			return db.Where("owner_id IS NULL OR owner_id = ?", *userID)
+		}
+	}
+}
+
+// canEditOwned reports whether the current user may change a row with this
+// owner: shared rows admins, personal rows their owner and admins
+func canEditOwned(c *gin.Context, ownerID *uint) bool {
+	if c.GetString("role") == "admin" {
+		return true
+	}
+	if ownerID == nil {
+		return false
+	}
+	userID := currentUserID(c)
+	return userID != nil && *userID == *ownerID
+}
+
+// joinIDs formats IDs for a comma-separated column
+func joinIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ListCameraGroups returns the shared groups and the current user's own
+// Query: ?mine=true for only the user's own
+func (h *CameraGroupHandler) ListCameraGroups(c *gin.Context) {
+	groups := []models.CameraGroup{}
+	if err := requestDB(h.db, c).Scopes(ownedOrShared(c)).Order("name").Find(&groups).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera groups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// GetCameraGroup returns a group with its cameras
+func (h *CameraGroupHandler) GetCameraGroup(c *gin.Context) {
+	group, ok := h.findGroup(c)
+	if !ok {
+		return
+	}
+
+	ids := group.Cameras()
+	var cameras []models.Camera
+	if len(ids) > 0 {
+		if err := requestDB(h.db, c).Where("id IN ?", ids).Find(&cameras).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+			return
+		}
+	}
+	byID := make(map[uint]models.Camera, len(cameras))
+	for _, camera := range cameras {
+		byID[camera.ID] = camera
+	}
+	ordered := make([]models.Camera, 0, len(cameras))
+	for _, id := range ids {
+		if camera, exists := byID[id]; exists {
+			ordered = append(ordered, camera)
+		}
+	}
+
+	c.JSON(http.StatusOK, CameraGroupResponse{CameraGroup: *group, Cameras: ordered})
+}
+
+func (h *CameraGroupHandler) CreateCameraGroup(c *gin.Context) {
+	var req CreateCameraGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.checkCameras(req.CameraIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group := models.CameraGroup{
+		Name:        req.Name,
+		Description: req.Description,
+		CameraIDs:   joinIDs(req.CameraIDs),
+	}
+	if req.Personal {
+		group.OwnerID = currentUserID(c)
+	} else if c.GetString("role") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create shared groups"})
+		return
+	}
+	if err := requestDB(h.db, c).Create(&group).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create camera group"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "camera_group", fmt.Sprint(group.ID), group.Name)
+
+	c.JSON(http.StatusCreated, group)
+}
+
+func (h *CameraGroupHandler) UpdateCameraGroup(c *gin.Context) {
+	group, ok := h.findGroup(c)
+	if !ok {
+		return
+	}
+	if !canEditOwned(c, group.OwnerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change shared groups, and only their owner personal ones"})
+		return
+	}
+
+	var req UpdateCameraGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != nil {
+		group.Name = *req.Name
+	}
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
+	if req.CameraIDs != nil {
+		if err := h.checkCameras(*req.CameraIDs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		group.CameraIDs = joinIDs(*req.CameraIDs)
+	}
+
+	if err := requestDB(h.db, c).Save(group).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update camera group"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "camera_group", fmt.Sprint(group.ID), group.Name)
+
+	c.JSON(http.StatusOK, group)
+}
+
+func (h *CameraGroupHandler) DeleteCameraGroup(c *gin.Context) {
+	group, ok := h.findGroup(c)
+	if !ok {
+		return
+	}
+	if !canEditOwned(c, group.OwnerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can delete shared groups, and only their owner personal ones"})
+		return
+	}
+
+	if err := requestDB(h.db, c).Delete(group).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete camera group"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "camera_group", fmt.Sprint(group.ID), group.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Camera group deleted successfully"})
+}
+
+// findGroup loads the group in the :id param if the current user can see
+// it, writing the error response otherwise
+func (h *CameraGroupHandler) findGroup(c *gin.Context) (*models.CameraGroup, bool) {
+	var group models.CameraGroup
+	if err := requestDB(h.db, c).Scopes(ownedOrShared(c)).First(&group, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera group not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera group"})
+		return nil, false
+	}
+	return &group, true
+}
+
+// checkCameras returns an error when the list is too long, repeats a
+// camera or names one that doesn't exist
+func (h *CameraGroupHandler) checkCameras(ids []uint) error {
+	if len(ids) > maxGroupCameras {
+		return fmt.Errorf("a group holds at most %d cameras", maxGroupCameras)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return fmt.Errorf("camera %d is listed twice", id)
+		}
+		seen[id] = true
+	}
+	return checkCameraIDs(h.db, ids)
+}
+
+// checkCameraIDs makes sure every listed camera exists; an ID may be
+// listed more than once
+func checkCameraIDs(db *gorm.DB, ids []uint) error {
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	var found int64
+	if err := db.Model(&models.Camera{}).Where("id IN ?", ids).Count(&found).Error; err != nil {
+		return err
+	}
+	if int(found) != len(unique) {
+		return fmt.Errorf("some cameras do not exist")
+	}
+	return nil
+}
@@ -1,15 +1,19 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"command-center-vms-cctv/be/models"
 	"command-center-vms-cctv/be/services"
+	"command-center-vms-cctv/be/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -22,15 +26,39 @@ type CameraHandler struct {
 	rtspService     *services.RTSPService
 	mjpegService    *services.MJPEGService
 	webrtcService   *services.WebRTCService
+	onvifService    *services.ONVIFService
+	audioService    *services.AudioService
+	credentials     *services.CredentialService
+	healthHistory   *services.HealthHistoryService
+	views           *services.StreamViewLog
+	tokens          *services.StreamTokenService
+	recordings      *services.RecordingService
+	statuses        *services.CameraStatusService
+	cluster         *services.ClusterService
+	viewers         *services.ViewerTracker
+	features        *services.FeatureFlagService
+	changes         *changeNotifier // Wakes /cameras/changes long-polls
 }
 
-func NewCameraHandler(db *gorm.DB, mediamtxService *services.MediaMTXService, rtspService *services.RTSPService, mjpegService *services.MJPEGService, webrtcService *services.WebRTCService) *CameraHandler {
+func NewCameraHandler(db *gorm.DB, mediamtxService *services.MediaMTXService, rtspService *services.RTSPService, mjpegService *services.MJPEGService, webrtcService *services.WebRTCService, onvifService *services.ONVIFService, audioService *services.AudioService, credentials *services.CredentialService, healthHistory *services.HealthHistoryService, views *services.StreamViewLog, tokens *services.StreamTokenService, recordings *services.RecordingService, statuses *services.CameraStatusService, cluster *services.ClusterService, viewers *services.ViewerTracker, features *services.FeatureFlagService) *CameraHandler {
 	return &CameraHandler{
 		db:              db,
 		mediamtxService: mediamtxService,
 		rtspService:     rtspService,
 		mjpegService:    mjpegService,
 		webrtcService:   webrtcService,
+		onvifService:    onvifService,
+		audioService:    audioService,
+		credentials:     credentials,
+		healthHistory:   healthHistory,
+		views:           views,
+		tokens:          tokens,
+		recordings:      recordings,
+		statuses:        statuses,
+		cluster:         cluster,
+		viewers:         viewers,
+		features:        features,
+		changes:         newChangeNotifier(),
 	}
 }
 
@@ -62,6 +90,18 @@ type CreateCameraRequest struct {
 	Area      string  `json:"area" binding:"required"`
 	Building  string  `json:"building" binding:"required"`
 	Status    string  `json:"status"`
+	ONVIFPort int     `json:"onvif_port"`
+	Priority  string  `json:"priority" binding:"omitempty,oneof=low normal high critical"`
+
+	TamperDetection bool   `json:"tamper_detection"`
+	MotionDetection bool   `json:"motion_detection"`
+	ONVIFMetadata   bool   `json:"onvif_metadata"`
+	CredentialID    *uint  `json:"credential_id"` // Vault credential; user:pass is then stripped from rtsp_url
+	WebRTCCodec     string `json:"webrtc_codec" binding:"omitempty,oneof=auto h264 vp8"`
+
+	DeviceType string `json:"device_type" binding:"omitempty,oneof=camera intercom"`
+	DoorRelay  string `json:"door_relay"`
+	TalkURL    string `json:"talk_url" binding:"omitempty,url"` // http(s) on the RTSP host, see services.ValidateTalkURL
 }
 
 type UpdateCameraRequest struct {
@@ -72,23 +112,119 @@ type UpdateCameraRequest struct {
 	Area      *string  `json:"area"`
 	Building  *string  `json:"building"`
 	Status    *string  `json:"status"`
+	ONVIFPort *int     `json:"onvif_port"`
+	Priority  *string  `json:"priority" binding:"omitempty,oneof=low normal high critical"`
+
+	TamperDetection *bool   `json:"tamper_detection"`
+	MotionDetection *bool   `json:"motion_detection"`
+	ONVIFMetadata   *bool   `json:"onvif_metadata"`
+	CredentialID    *uint   `json:"credential_id"` // 0 detaches the credential
+	WebRTCCodec     *string `json:"webrtc_codec" binding:"omitempty,oneof=auto h264 vp8"`
+
+	DeviceType *string `json:"device_type" binding:"omitempty,oneof=camera intercom"`
+	DoorRelay  *string `json:"door_relay"`
+	TalkURL    *string `json:"talk_url" binding:"omitempty,url"`
 }
 
+// GetCameras lists cameras, filtered and sorted. Without ?page= or ?limit=
+// every matching camera is returned as a plain array, as before; with
+// either, one page in an OffsetPage envelope.
+// Query: ?status=&area=&building=&q=&sort=&page=&limit=
 func (h *CameraHandler) GetCameras(c *gin.Context) {
+	filters, err := h.cameraFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := cameraSort(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// A fresh query per statement; count and find can't share one
+	query := func() *gorm.DB {
+		return h.db.WithContext(c.Request.Context()).Model(&models.Camera{}).Scopes(filters)
+	}
+
+	if c.Query("page") == "" && c.Query("limit") == "" {
+		var cameras []models.Camera
+		if err := query().Scopes(order).Find(&cameras).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+			return
+		}
+		c.JSON(http.StatusOK, cameras)
+		return
+	}
+
+	page, limit, err := parseOffsetParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count cameras"})
+		return
+	}
+	cameras := []models.Camera{}
+	if err := query().Scopes(order).Offset((page - 1) * limit).Limit(limit).Find(&cameras).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+		return
+	}
+
+	c.JSON(http.StatusOK, OffsetPage{Items: cameras, Total: total, Page: page, Limit: limit})
+}
+
+// CameraStatus is the compact per-camera state used to color map pins
+type CameraStatus struct {
+	ID          uint       `json:"id"`
+	Status      string     `json:"status"`
+	Color       string     `json:"color,omitempty"` // Of the status definition
+	IsStreaming bool       `json:"is_streaming"`
+	LastMotion  *time.Time `json:"last_motion"`
+	Reliability string     `json:"reliability,omitempty"` // ok, down, flapping, chronic
+}
+
+// GetCameraStatuses returns the status of every camera in one small payload,
+// cheap enough for the map to poll every 1-2 seconds. Stream state comes from
+// in-memory service state and the last MediaMTX health poll, whose time is in
+// the X-Health-Checked-At header.
+func (h *CameraHandler) GetCameraStatuses(c *gin.Context) {
 	var cameras []models.Camera
-	if err := h.db.Find(&cameras).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Select("id", "status", "last_motion_detected").Order("id").Find(&cameras).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
 		return
 	}
 
-	c.JSON(http.StatusOK, cameras)
+	hls := h.mediamtxService.GetAllStreamHealth()
+	webrtc := h.webrtcService.GetAllStreamStatus()
+	mjpeg := h.mjpegService.GetAllStreamStatus()
+	reliability := h.healthHistory.GetAllSummaries()
+
+	statuses := make([]CameraStatus, len(cameras))
+	for i, camera := range cameras {
+		statuses[i] = CameraStatus{
+			ID:          camera.ID,
+			Status:      camera.Status,
+			Color:       h.statusColor(camera.Status),
+			IsStreaming: hls[camera.ID] || webrtc[camera.ID] || mjpeg[camera.ID],
+			LastMotion:  camera.LastMotionDetected,
+			Reliability: reliability[camera.ID].Reliability,
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	if checkedAt := h.mediamtxService.HealthCheckedAt(); !checkedAt.IsZero() {
+		c.Header("X-Health-Checked-At", checkedAt.UTC().Format(time.RFC3339Nano))
+	}
+	c.JSON(http.StatusOK, statuses)
 }
 
 func (h *CameraHandler) GetCamera(c *gin.Context) {
 	id := c.Param("id")
 
 	var camera models.Camera
-	if err := h.db.First(&camera, id).Error; err != nil {
+	if err := requestDB(h.db, c).First(&camera, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
 			return
@@ -111,6 +247,30 @@ func (h *CameraHandler) CreateCamera(c *gin.Context) {
 	if status == "" {
 		status = "offline"
 	}
+	if _, exists := h.statuses.Get(status); !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown status %q", status)})
+		return
+	}
+
+	onvifPort := req.ONVIFPort
+	if onvifPort == 0 {
+		onvifPort = 80
+	}
+
+	priority := req.Priority
+	if priority == "" {
+		priority = models.CameraPriorityNormal
+	}
+
+	webrtcCodec := req.WebRTCCodec
+	if webrtcCodec == "" {
+		webrtcCodec = models.WebRTCCodecAuto
+	}
+
+	deviceType := req.DeviceType
+	if deviceType == "" {
+		deviceType = models.DeviceTypeCamera
+	}
 
 	camera := models.Camera{
 		Name:      req.Name,
@@ -120,13 +280,46 @@ func (h *CameraHandler) CreateCamera(c *gin.Context) {
 		Status:    status,
 		Area:      req.Area,
 		Building:  req.Building,
+		ONVIFPort: onvifPort,
+		Priority:  priority,
+
+		TamperDetection: req.TamperDetection,
+		MotionDetection: req.MotionDetection,
+		ONVIFMetadata:   req.ONVIFMetadata,
+		WebRTCCodec:     webrtcCodec,
+
+		DeviceType: deviceType,
+		DoorRelay:  req.DoorRelay,
+		TalkURL:    req.TalkURL,
+	}
+	if camera.TalkURL != "" {
+		if err := services.ValidateTalkURL(camera.TalkURL, camera.RTSPUrl); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.CredentialID != nil && *req.CredentialID != 0 {
+		exists, err := h.credentialExists(*req.CredentialID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check credential"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Credential not found"})
+			return
+		}
+		camera.CredentialID = req.CredentialID
+		camera.RTSPUrl = services.StripURLCredentials(camera.RTSPUrl)
 	}
 
-	if err := h.db.Create(&camera).Error; err != nil {
+	if err := requestDB(h.db, c).Create(&camera).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create camera"})
 		return
 	}
 
+	recordAudit(h.db, c, "create", "camera", fmt.Sprint(camera.ID), camera.Name)
+	h.changes.notify()
+
 	c.JSON(http.StatusCreated, camera)
 }
 
@@ -140,7 +333,7 @@ func (h *CameraHandler) UpdateCamera(c *gin.Context) {
 	}
 
 	var camera models.Camera
-	if err := h.db.First(&camera, id).Error; err != nil {
+	if err := requestDB(h.db, c).First(&camera, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
 			return
@@ -149,6 +342,10 @@ func (h *CameraHandler) UpdateCamera(c *gin.Context) {
 		return
 	}
 
+	previousURL := h.credentials.StreamURL(&camera)
+	previousStatus := camera.Status
+	previousCodec := camera.WebRTCCodec
+
 	// Update fields if provided
 	if req.Name != nil {
 		camera.Name = *req.Name
@@ -169,33 +366,104 @@ func (h *CameraHandler) UpdateCamera(c *gin.Context) {
 		camera.Building = *req.Building
 	}
 	if req.Status != nil {
+		if err := h.statuses.CheckTransition(camera.Status, *req.Status); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		camera.Status = *req.Status
 	}
+	if req.ONVIFPort != nil {
+		camera.ONVIFPort = *req.ONVIFPort
+	}
+	if req.Priority != nil {
+		camera.Priority = *req.Priority
+	}
+	if req.TamperDetection != nil {
+		camera.TamperDetection = *req.TamperDetection
+	}
+	if req.MotionDetection != nil {
+		camera.MotionDetection = *req.MotionDetection
+	}
+	if req.ONVIFMetadata != nil {
+		camera.ONVIFMetadata = *req.ONVIFMetadata
+	}
+	if req.WebRTCCodec != nil {
+		camera.WebRTCCodec = *req.WebRTCCodec
+	}
+	if req.DeviceType != nil {
+		camera.DeviceType = *req.DeviceType
+	}
+	if req.DoorRelay != nil {
+		camera.DoorRelay = *req.DoorRelay
+	}
+	if req.TalkURL != nil {
+		camera.TalkURL = *req.TalkURL
+	}
+	if req.CredentialID != nil {
+		if *req.CredentialID == 0 {
+			camera.CredentialID = nil
+		} else if exists, err := h.credentialExists(*req.CredentialID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check credential"})
+			return
+		} else if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Credential not found"})
+			return
+		} else {
+			camera.CredentialID = req.CredentialID
+		}
+	}
+	if camera.CredentialID != nil {
+		camera.RTSPUrl = services.StripURLCredentials(camera.RTSPUrl)
+	}
+	if camera.TalkURL != "" && (req.TalkURL != nil || req.RTSPUrl != nil) {
+		if err := services.ValidateTalkURL(camera.TalkURL, camera.RTSPUrl); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	if err := h.db.Save(&camera).Error; err != nil {
+	if err := requestDB(h.db, c).Save(&camera).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update camera"})
 		return
 	}
+	if camera.Status != previousStatus {
+		h.healthHistory.RecordStatusChange(&models.CameraStatusEvent{
+			CameraID:   camera.ID,
+			FromStatus: previousStatus,
+			ToStatus:   camera.Status,
+			Source:     models.StatusSourceManual,
+			ChangedAt:  time.Now(),
+		})
+	}
 
-	c.JSON(http.StatusOK, camera)
-}
-
-func (h *CameraHandler) DeleteCamera(c *gin.Context) {
-	id := c.Param("id")
-
-	if err := h.db.Delete(&models.Camera{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete camera"})
+	// Streams keep pulling the old URL until they are restarted
+	if h.credentials.StreamURL(&camera) != previousURL {
+		restart := h.restartStreams(&camera)
+		restart.HLSURL = h.signStreamURL(c, camera.ID, restart.HLSURL)
+		recordAudit(h.db, c, "update", "camera", fmt.Sprint(camera.ID), fmt.Sprintf("%s (source URL changed, restarted %v)", camera.Name, restart.Stopped))
+		h.changes.notify()
+		c.JSON(http.StatusOK, CameraUpdateResponse{Camera: camera, StreamRestart: &restart})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Camera deleted successfully"})
+	// The next viewer starts the WebRTC stream again with the new codec
+	if camera.WebRTCCodec != previousCodec {
+		h.webrtcService.StopStream(camera.ID)
+		h.cluster.RequestStreamStop(camera.ID, services.PipelineWebRTC)
+	}
+
+	recordAudit(h.db, c, "update", "camera", fmt.Sprint(camera.ID), camera.Name)
+	h.changes.notify()
+
+	c.JSON(http.StatusOK, camera)
 }
 
 func (h *CameraHandler) GetStreamURL(c *gin.Context) {
 	id := c.Param("id")
+	ctx := c.Request.Context()
 
 	var camera models.Camera
-	if err := h.db.First(&camera, id).Error; err != nil {
+	if err := h.db.WithContext(ctx).First(&camera, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
 			return
@@ -206,19 +474,94 @@ func (h *CameraHandler) GetStreamURL(c *gin.Context) {
 
 	// Configure MediaMTX path and get HLS URL
 	// MediaMTX will pull RTSP stream from camera and serve as HLS
-	hlsURL, err := h.mediamtxService.StartStream(camera.ID, camera.RTSPUrl)
+	hlsURL, err := h.mediamtxService.StartStreamContext(ctx, camera.ID, h.credentials.StreamURL(&camera))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to configure MediaMTX stream: " + err.Error()})
 		return
 	}
 
+	// Segments are served by MediaMTX, so only the start of an HLS view is known
+	h.openView(c, camera.ID, "hls")
+	h.viewers.Touch(camera.ID, services.PipelineHLS)
+
 	// Get stream health status
 	isHealthy, _ := h.mediamtxService.GetStreamHealth(camera.ID)
 
-	c.JSON(http.StatusOK, gin.H{
-		"hls_url":    hlsURL,
+	response := gin.H{
+		"hls_url":    h.signStreamURL(c, camera.ID, hlsURL),
 		"camera_id":  camera.ID,
 		"is_healthy": isHealthy,
+	}
+	if info, ok := h.mediamtxService.GetPathInfo(camera.ID); ok {
+		response["video_codecs"] = info.VideoCodecs
+		response["transcoding"] = info.Transcoding
+		if info.Note != "" {
+			response["codec_note"] = info.Note
+		}
+	}
+
+	// ?wait=true blocks until the first HLS segment exists so the player
+	// doesn't have to guess when to start
+	if wait, timeout := parseWaitParams(c); wait {
+		start := time.Now()
+		ready := h.mediamtxService.WaitForReadyContext(ctx, camera.ID, timeout)
+		response["ready"] = ready
+		response["waited_ms"] = time.Since(start).Milliseconds()
+		if !ready {
+			status := h.mediamtxService.GetStreamStatus(camera.ID, h.credentials.StreamURL(&camera))
+			if status.Error != nil {
+				response["reason"] = status.Error.Reason
+				response["error"] = status.Error.Message
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+const (
+	defaultWaitTimeout = 10 * time.Second
+	maxWaitTimeout     = 30 * time.Second
+)
+
+// parseWaitParams reads ?wait=true and the optional ?wait_timeout=<seconds>
+func parseWaitParams(c *gin.Context) (bool, time.Duration) {
+	if c.Query("wait") != "true" {
+		return false, 0
+	}
+
+	timeout := defaultWaitTimeout
+	if raw := c.Query("wait_timeout"); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil && seconds > 0 {
+			timeout = time.Duration(seconds) * time.Second
+		}
+	}
+	if timeout > maxWaitTimeout {
+		timeout = maxWaitTimeout
+	}
+	return true, timeout
+}
+
+// StreamKeepalive marks a camera's streams as watched, for players that keep
+// a stream open without reading it through the backend (e.g. a paused HLS
+// player), so the idle stop doesn't end them
+// Query: ?protocol=hls|webrtc, all of them when empty
+func (h *CameraHandler) StreamKeepalive(c *gin.Context) {
+	protocol := c.Query("protocol")
+	if protocol != "" && protocol != services.PipelineHLS && protocol != services.PipelineWebRTC {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "protocol must be hls or webrtc"})
+		return
+	}
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id").First(&camera, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+		return
+	}
+
+	h.viewers.Touch(camera.ID, protocol)
+	c.JSON(http.StatusOK, gin.H{
+		"camera_id":            camera.ID,
+		"idle_timeout_seconds": int(h.viewers.IdleTimeout().Seconds()),
 	})
 }
 
@@ -226,7 +569,7 @@ func (h *CameraHandler) GetStreamHealth(c *gin.Context) {
 	id := c.Param("id")
 
 	var camera models.Camera
-	if err := h.db.First(&camera, id).Error; err != nil {
+	if err := requestDB(h.db, c).First(&camera, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
 			return
@@ -235,29 +578,67 @@ func (h *CameraHandler) GetStreamHealth(c *gin.Context) {
 		return
 	}
 
-	// Get stream health status from MediaMTX
-	isHealthy, err := h.mediamtxService.GetStreamHealth(camera.ID)
-	if err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"camera_id":  camera.ID,
-			"is_healthy": false,
-			"error":      err.Error(),
-		})
-		return
-	}
+	// Get stream health status from MediaMTX, with a classified reason when it's not working
+	status := h.mediamtxService.GetStreamStatus(camera.ID, h.credentials.StreamURL(&camera))
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"camera_id":  camera.ID,
-		"is_healthy": isHealthy,
-	})
+		"is_healthy": status.Healthy,
+		"ready":      status.Ready,
+		"checked_at": status.CheckedAt,
+	}
+	if status.Error != nil {
+		response["reason"] = status.Error.Reason
+		response["error"] = status.Error.Message
+		response["error_detail"] = status.Error
+	}
+
+	// Errors reported by FFmpeg-based pipelines (WebRTC, MJPEG, legacy HLS)
+	ffmpegErrors := gin.H{}
+	if streamErr := h.webrtcService.GetStreamError(camera.ID); streamErr != nil {
+		ffmpegErrors["webrtc"] = streamErr
+	}
+	if streamErr := h.mjpegService.GetStreamError(camera.ID); streamErr != nil {
+		ffmpegErrors["mjpeg"] = streamErr
+	}
+	if streamErr := h.rtspService.GetStreamError(camera.ID); streamErr != nil {
+		ffmpegErrors["hls_legacy"] = streamErr
+	}
+	if streamErr := h.audioService.GetStreamError(camera.ID); streamErr != nil {
+		ffmpegErrors["audio"] = streamErr
+	}
+	if len(ffmpegErrors) > 0 {
+		response["ffmpeg_errors"] = ffmpegErrors
+	}
+
+	// Restart thresholds the stream watchdogs learned for this camera
+	if baseline, ok := h.mediamtxService.GetWatchdogBaseline(camera.ID); ok {
+		response["watchdog"] = baseline
+	}
+	if baseline, ok := h.rtspService.GetWatchdogBaseline(camera.ID); ok {
+		response["hls_legacy_watchdog"] = baseline
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// webrtcAllowed responds 403 when the webrtc feature flag is off at the
+// camera's site; players fall back to HLS
+func (h *CameraHandler) webrtcAllowed(c *gin.Context, camera *models.Camera) bool {
+	if h.features.EnabledFor(models.FeatureWebRTC, camera) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "WebRTC is disabled at this camera's site", "reason": "feature_disabled", "fallback": "hls"})
+	return false
 }
 
 // GetWebRTCStream starts WebRTC stream for a camera
 func (h *CameraHandler) GetWebRTCStream(c *gin.Context) {
 	id := c.Param("id")
+	ctx := c.Request.Context()
 
 	var camera models.Camera
-	if err := h.db.First(&camera, id).Error; err != nil {
+	if err := h.db.WithContext(ctx).First(&camera, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
 			return
@@ -265,14 +646,23 @@ func (h *CameraHandler) GetWebRTCStream(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
 		return
 	}
+	if !h.webrtcAllowed(c, &camera) {
+		return
+	}
 
-	// Start WebRTC stream with RTSP URL
-	fmt.Printf("[WebRTC] Starting stream for camera %d (RTSP: %s)\n", camera.ID, camera.RTSPUrl)
-	if err := h.webrtcService.StartStream(camera.ID, camera.RTSPUrl); err != nil {
+	// Start WebRTC stream from the camera's MediaMTX path, shared with HLS
+	fmt.Printf("[WebRTC] Starting stream for camera %d (RTSP: %s)\n", camera.ID, services.StripURLCredentials(camera.RTSPUrl))
+	rtspURL := h.mediamtxService.IngestURLContext(ctx, camera.ID, h.credentials.StreamURL(&camera))
+	if err := h.webrtcService.StartStreamContext(ctx, camera.ID, rtspURL, camera.PriorityRank(), camera.WebRTCCodec); err != nil {
 		fmt.Printf("[WebRTC] Error starting stream for camera %d: %v\n", camera.ID, err)
+		if errors.Is(err, services.ErrTranscodeCapacity) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "All transcode slots are in use by equal or higher priority cameras", "reason": "capacity"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start WebRTC stream: " + err.Error()})
 		return
 	}
+	h.viewers.Touch(camera.ID, services.PipelineWebRTC)
 	fmt.Printf("[WebRTC] Stream started successfully for camera %d\n", camera.ID)
 
 	// Construct WebSocket URL
@@ -310,11 +700,28 @@ func (h *CameraHandler) GetWebRTCStream(c *gin.Context) {
 	wsURL := fmt.Sprintf("%s://%s/api/v1/cameras/%d/webrtc/ws", scheme, host, camera.ID)
 	fmt.Printf("[WebRTC] Generated WebSocket URL for camera %d: %s (request host: %s, mode: %s)\n", camera.ID, wsURL, c.Request.Host, os.Getenv("GIN_MODE"))
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"camera_id":     camera.ID,
 		"stream_type":   "webrtc",
 		"websocket_url": wsURL,
-	})
+		"codec":         h.webrtcService.GetStreamCodec(camera.ID), // vp8 or h264 (passthrough)
+	}
+
+	// ?wait=true blocks until the first keyframe is available
+	if wait, timeout := parseWaitParams(c); wait {
+		start := time.Now()
+		ready := h.webrtcService.WaitForKeyframe(camera.ID, timeout)
+		response["ready"] = ready
+		response["waited_ms"] = time.Since(start).Milliseconds()
+		if !ready {
+			if streamErr := h.webrtcService.GetStreamError(camera.ID); streamErr != nil {
+				response["reason"] = streamErr.Reason
+				response["error"] = streamErr.Message
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // HandleWebRTCWebSocket handles WebSocket connection for WebRTC signaling
@@ -333,7 +740,7 @@ func (h *CameraHandler) HandleWebRTCWebSocket(c *gin.Context) {
 
 	// Check camera exists before upgrading
 	var camera models.Camera
-	if err := h.db.First(&camera, id).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).First(&camera, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			log.Printf("[WebRTC] Camera %s not found\n", id)
 			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
@@ -343,8 +750,11 @@ func (h *CameraHandler) HandleWebRTCWebSocket(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
 		return
 	}
+	if !h.webrtcAllowed(c, &camera) {
+		return
+	}
 
-	log.Printf("[WebRTC] Upgrading to WebSocket for camera %d (RTSP: %s)\n", camera.ID, camera.RTSPUrl)
+	log.Printf("[WebRTC] Upgrading to WebSocket for camera %d (RTSP: %s)\n", camera.ID, services.StripURLCredentials(camera.RTSPUrl))
 
 	// Upgrade to WebSocket - must be done before any response is written
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -356,17 +766,107 @@ func (h *CameraHandler) HandleWebRTCWebSocket(c *gin.Context) {
 
 	log.Printf("[WebRTC] WebSocket upgraded successfully for camera %d\n", camera.ID)
 
-	// Handle WebRTC signaling
-	h.webrtcService.HandleWebSocket(conn, camera.ID)
+	// Handle WebRTC signaling; returns once the viewer disconnects
+	view := h.openView(c, camera.ID, "webrtc")
+	h.views.Close(view, h.webrtcService.HandleWebSocket(conn, camera.ID))
+}
+
+// maxWHEPOffer caps the SDP offer read from a WHEP request
+const maxWHEPOffer = 64 << 10
+
+// CreateWHEPSession is the WHEP endpoint (RFC 9725) of a camera: the body is
+// the viewer's SDP offer, the response the answer with all ICE candidates
+// and a Location to DELETE when done. The WebRTC stream is started if needed.
+func (h *CameraHandler) CreateWHEPSession(c *gin.Context) {
+	if contentType := c.ContentType(); contentType != "application/sdp" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/sdp"})
+		return
+	}
+	offer, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWHEPOffer))
+	if err != nil || len(offer) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be an SDP offer"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var camera models.Camera
+	if err := h.db.WithContext(ctx).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+	if !h.webrtcAllowed(c, &camera) {
+		return
+	}
+
+	rtspURL := h.mediamtxService.IngestURLContext(ctx, camera.ID, h.credentials.StreamURL(&camera))
+	if err := h.webrtcService.StartStreamContext(ctx, camera.ID, rtspURL, camera.PriorityRank(), camera.WebRTCCodec); err != nil {
+		if errors.Is(err, services.ErrTranscodeCapacity) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "All transcode slots are in use by equal or higher priority cameras", "reason": "capacity"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start WebRTC stream: " + err.Error()})
+		return
+	}
+	h.viewers.Touch(camera.ID, services.PipelineWebRTC)
+
+	view := h.openView(c, camera.ID, "whep")
+	_, span := tracing.Start(ctx, "webrtc.answer_whep")
+	sessionID, answer, err := h.webrtcService.AnswerWHEP(camera.ID, string(offer), func(bytesSent int64) {
+		h.views.Close(view, bytesSent)
+	})
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		h.views.Close(view, 0)
+		if errors.Is(err, services.ErrStreamNotReady) {
+			response := gin.H{"error": "WebRTC stream is not ready yet, retry shortly"}
+			if streamErr := h.webrtcService.GetStreamError(camera.ID); streamErr != nil {
+				response["reason"] = streamErr.Reason
+				response["error"] = streamErr.Message
+			}
+			c.Header("Retry-After", "2")
+			c.JSON(http.StatusServiceUnavailable, response)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/api/v1/cameras/%d/whep/%s", camera.ID, sessionID))
+	c.Data(http.StatusCreated, "application/sdp", []byte(answer))
 }
 
-// GetMJPEGStream streams MJPEG frames for a camera
-// Simple HTTP streaming - no WebSocket, no file storage needed
+// DeleteWHEPSession ends a WHEP session
+func (h *CameraHandler) DeleteWHEPSession(c *gin.Context) {
+	cameraID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid camera ID"})
+		return
+	}
+	if err := h.webrtcService.CloseWHEP(uint(cameraID), c.Param("session")); err != nil {
+		if errors.Is(err, services.ErrWHEPSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session ended"})
+}
+
+// GetMJPEGStream streams MJPEG frames for a camera as a multipart response.
+// Every viewer of a camera shares one FFmpeg.
 func (h *CameraHandler) GetMJPEGStream(c *gin.Context) {
 	id := c.Param("id")
+	ctx := c.Request.Context()
 
 	var camera models.Camera
-	if err := h.db.First(&camera, id).Error; err != nil {
+	if err := h.db.WithContext(ctx).First(&camera, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
 			return
@@ -376,22 +876,23 @@ func (h *CameraHandler) GetMJPEGStream(c *gin.Context) {
 	}
 
 	// Start MJPEG stream
-	if err := h.mjpegService.StartStream(camera.ID, camera.RTSPUrl); err != nil {
+	if err := h.mjpegService.StartStream(camera.ID, h.mediamtxService.IngestURLContext(ctx, camera.ID, h.credentials.StreamURL(&camera)), camera.PriorityRank()); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MJPEG stream: " + err.Error()})
 		return
 	}
 
-	// Get stream reader
-	reader, err := h.mjpegService.GetStreamReader(camera.ID)
+	viewer, err := h.mjpegService.Subscribe(camera.ID)
 	if err != nil {
+		if errors.Is(err, services.ErrTranscodeCapacity) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "All transcode slots are in use by equal or higher priority cameras", "reason": "capacity"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get MJPEG stream: " + err.Error()})
 		return
 	}
-	defer reader.Close()
+	defer viewer.Close()
 
-	// Set headers for MJPEG streaming
-	// FFmpeg with -f mjpeg outputs multipart/x-mixed-replace automatically
-	c.Header("Content-Type", "multipart/x-mixed-replace; boundary=ffmpeg")
+	c.Header("Content-Type", "multipart/x-mixed-replace; boundary="+services.MJPEGBoundary)
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("Expires", "0")
@@ -400,25 +901,199 @@ func (h *CameraHandler) GetMJPEGStream(c *gin.Context) {
 
 	fmt.Printf("[MJPEG] Starting stream for camera %d\n", camera.ID)
 
-	// Stream MJPEG directly from FFmpeg
-	// FFmpeg with -f mjpeg already outputs multipart/x-mixed-replace format
-	// Just pipe it directly to HTTP response
-	buffer := make([]byte, 8192)
+	view := h.openView(c, camera.ID, "mjpeg")
+	var sent int64
+
+	// Times how long the viewer waits for its first frame
+	_, firstFrame := tracing.Start(ctx, "mjpeg.first_frame")
+	c.Stream(func(w io.Writer) bool {
+		frame, ok := viewer.Next(ctx)
+		firstFrame.End()
+		if !ok {
+			return false
+		}
+		n, err := services.WriteMJPEGPart(w, frame)
+		sent += int64(n)
+		if err != nil {
+			fmt.Printf("[MJPEG] Write error for camera %d: %v\n", camera.ID, err)
+			return false
+		}
+		return true
+	})
+	h.views.Close(view, sent)
+
+	fmt.Printf("[MJPEG] Stream finished for camera %d\n", camera.ID)
+}
+
+// GetAudioStream streams only a camera's audio over HTTP, so audio monitoring
+// posts don't pay for video decode. ?format=aac (default, ADTS) or opus (Ogg).
+func (h *CameraHandler) GetAudioStream(c *gin.Context) {
+	id := c.Param("id")
+
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	format := c.DefaultQuery("format", services.AudioFormatAAC)
+	if format != services.AudioFormatAAC && format != services.AudioFormatOpus {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be aac or opus"})
+		return
+	}
+
+	// Check the camera actually has a microphone before spawning FFmpeg
+	rtspURL := h.mediamtxService.IngestURL(camera.ID, h.credentials.StreamURL(&camera))
+	probe, probeErr := services.ProbeRTSP(rtspURL, 5*time.Second)
+	if probeErr != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": probeErr.Message, "reason": probeErr.Reason})
+		return
+	}
+	if len(probe.AudioCodecs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Camera has no audio track", "reason": "no_audio"})
+		return
+	}
 
+	reader, err := h.audioService.OpenStream(camera.ID, rtspURL, format, probe.AudioCodecs, camera.PriorityRank())
+	if err != nil {
+		if errors.Is(err, services.ErrTranscodeCapacity) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "All transcode slots are in use by equal or higher priority cameras", "reason": "capacity"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start audio stream: " + err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Type", services.AudioContentType(format))
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("X-Accel-Buffering", "no")
+
+	buffer := make([]byte, 4096)
+	view := h.openView(c, camera.ID, "audio")
+	var sent int64
 	c.Stream(func(w io.Writer) bool {
 		n, err := reader.Read(buffer)
 		if n > 0 {
 			if _, writeErr := w.Write(buffer[:n]); writeErr != nil {
-				fmt.Printf("[MJPEG] Write error for camera %d: %v\n", camera.ID, writeErr)
 				return false
 			}
-		}
-		if err == io.EOF {
-			fmt.Printf("[MJPEG] Stream ended for camera %d\n", camera.ID)
-			return false
+			sent += int64(n)
 		}
 		return err == nil
 	})
+	h.views.Close(view, sent)
 
-	fmt.Printf("[MJPEG] Stream finished for camera %d\n", camera.ID)
+	fmt.Printf("[Audio] Stream finished for camera %d\n", camera.ID)
+}
+
+// RebootCamera reboots a camera via ONVIF SystemReboot
+func (h *CameraHandler) RebootCamera(c *gin.Context) {
+	id := c.Param("id")
+
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	target, err := services.ONVIFTargetFromRTSP(h.credentials.StreamURL(&camera), camera.ONVIFPort)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, err := h.onvifService.SystemReboot(target)
+	if err != nil {
+		log.Printf("[ONVIF] Reboot failed for camera %d: %v\n", camera.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reboot camera: " + err.Error()})
+		return
+	}
+
+	recordAudit(h.db, c, "reboot", "camera", fmt.Sprint(camera.ID), message)
+	log.Printf("[ONVIF] Reboot requested for camera %d: %s\n", camera.ID, message)
+
+	c.JSON(http.StatusOK, gin.H{
+		"camera_id": camera.ID,
+		"message":   message,
+	})
+}
+
+// DiagnoseCamera runs network checks against a camera and collects its
+// current stream state and recent warning events
+func (h *CameraHandler) DiagnoseCamera(c *gin.Context) {
+	id := c.Param("id")
+
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	checks := services.RunCameraDiagnostics(camera.RTSPUrl, camera.ONVIFPort)
+
+	streams := gin.H{}
+	if healthy, err := h.mediamtxService.GetStreamHealth(camera.ID); err == nil {
+		streams["hls"] = gin.H{"active": true, "healthy": healthy}
+	} else {
+		streams["hls"] = gin.H{"active": false, "error": err.Error()}
+	}
+	if active, err := h.webrtcService.GetStreamStatus(camera.ID); err == nil {
+		streams["webrtc"] = gin.H{"active": active}
+	}
+	if active, err := h.mjpegService.GetStreamStatus(camera.ID); err == nil {
+		streams["mjpeg"] = gin.H{"active": active, "viewers": h.mjpegService.GetViewerCount(camera.ID)}
+	}
+
+	var recentErrors []models.Event
+	requestDB(h.db, c).Where("camera_id = ? AND severity IN ?", camera.ID, []string{"warning", "critical"}).
+		Order("occurred_at DESC").Limit(10).Find(&recentErrors)
+
+	c.JSON(http.StatusOK, gin.H{
+		"camera_id":     camera.ID,
+		"checks":        checks,
+		"streams":       streams,
+		"recent_errors": recentErrors,
+		"checked_at":    time.Now(),
+	})
+}
+
+// signStreamURL signs a MediaMTX URL for the current user when stream
+// tokens are enabled
+func (h *CameraHandler) signStreamURL(c *gin.Context, cameraID uint, rawURL string) string {
+	var userID uint
+	if id := currentUserID(c); id != nil {
+		userID = *id
+	}
+	return h.tokens.SignURL(rawURL, h.mediamtxService.GetPathName(cameraID), userID)
+}
+
+// openView records the start of a stream view by the current user
+func (h *CameraHandler) openView(c *gin.Context, cameraID uint, protocol string) *models.StreamView {
+	return h.views.Open(cameraID, currentUserID(c), c.GetString("email"), protocol, c.ClientIP())
+}
+
+func (h *CameraHandler) statusColor(status string) string {
+	definition, _ := h.statuses.Get(status)
+	return definition.Color
+}
+
+func (h *CameraHandler) credentialExists(id uint) (bool, error) {
+	var count int64
+	if err := h.db.Model(&models.Credential{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
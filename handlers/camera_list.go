@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"command-center-vms-cctv/be/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// cameraSortColumns are the fields the camera list can be sorted by
+var cameraSortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"status":     "status",
+	"area":       "area",
+	"building":   "building",
+	"priority":   "priority",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// cameraFilters reads the camera list filters: ?status=, ?area= and
+// ?building= (each comma-separated for several values), ?monitored=
+// (whether health checks manage the status) and ?q= (words matched against
+// name, area and building as prefixes)
+func (h *CameraHandler) cameraFilters(c *gin.Context) (func(*gorm.DB) *gorm.DB, error) {
+	values := func(name string) []string {
+		var list []string
+		for _, value := range strings.Split(c.Query(name), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				list = append(list, value)
+			}
+		}
+		return list
+	}
+	statuses, areas, buildings := values("status"), values("area"), values("building")
+	for _, status := range statuses {
+		if _, exists := h.statuses.Get(status); !exists {
+			return nil, fmt.Errorf("unknown status %q", status)
+		}
+	}
+	monitored := c.Query("monitored")
+	if monitored != "" && monitored != "true" && monitored != "false" {
+		return nil, fmt.Errorf("monitored must be true or false")
+	}
+	unmonitored := h.statuses.Unmonitored()
+
+	var tsquery string
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		if tsquery = database.SearchQuery(q); tsquery == "" {
+			return nil, fmt.Errorf("q must contain letters or digits")
+		}
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if len(statuses) > 0 {
+			db = db.Where("status IN ?", statuses)
+		}
+		switch {
+		case monitored == "true" && len(unmonitored) > 0:
+			db = db.Where("status NOT IN ?", unmonitored)
+		case monitored == "false" && len(unmonitored) > 0:
+			db = db.Where("status IN ?", unmonitored)
+		case monitored == "false":
+			db = db.Where("FALSE")
+		}
+		if len(areas) > 0 {
+			db = db.Where("area IN ?", areas)
+		}
+		if len(buildings) > 0 {
+			db = db.Where("building IN ?", buildings)
+		}
+		if tsquery != "" {
+			db = db.Scopes(database.SearchMatch("cameras", tsquery))
+		}
+		return db
+	}, nil
+}
+
+// cameraSort reads ?sort=: comma-separated fields, each optionally prefixed
+// with - for descending, e.g. "area,-name". id breaks ties so pages are
+// stable.
+func cameraSort(c *gin.Context) (func(*gorm.DB) *gorm.DB, error) {
+	var order []string
+	for _, field := range strings.Split(c.Query("sort"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			field, direction = field[1:], "DESC"
+		}
+		column, ok := cameraSortColumns[field]
+		if !ok {
+			fields := make([]string, 0, len(cameraSortColumns))
+			for name := range cameraSortColumns {
+				fields = append(fields, name)
+			}
+			sort.Strings(fields)
+			return nil, fmt.Errorf("cannot sort by %q, use one of %s", field, strings.Join(fields, ", "))
+		}
+		order = append(order, column+" "+direction)
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		for _, clause := range order {
+			db = db.Order(clause)
+		}
+		return db.Order("id")
+	}, nil
+}
@@ -0,0 +1,575 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxPlanCameras = 1000
+	cameraPlanTTL  = time.Hour
+)
+
+// Actions of a CameraPlanChange
+const (
+	PlanActionCreate = "create"
+	PlanActionUpdate = "update"
+	PlanActionDelete = "delete" // Archive-style: recordings and incidents are kept
+)
+
+// CameraSpec is one camera of the desired list. Cameras are matched by id,
+// or by name when id is omitted. Omitted optional fields keep their current
+// value, or the CreateCamera default for new cameras.
+type CameraSpec struct {
+	ID        *uint   `json:"id,omitempty"`
+	Name      string  `json:"name" binding:"required"`
+	Latitude  float64 `json:"latitude" binding:"required"`
+	Longitude float64 `json:"longitude" binding:"required"`
+	RTSPUrl   string  `json:"rtsp_url" binding:"required"`
+	Area      string  `json:"area" binding:"required"`
+	Building  string  `json:"building" binding:"required"`
+
+	Status          *string `json:"status,omitempty"`
+	ONVIFPort       *int    `json:"onvif_port,omitempty"`
+	Priority        *string `json:"priority,omitempty" binding:"omitempty,oneof=low normal high critical"`
+	TamperDetection *bool   `json:"tamper_detection,omitempty"`
+	MotionDetection *bool   `json:"motion_detection,omitempty"`
+	ONVIFMetadata   *bool   `json:"onvif_metadata,omitempty"`
+	WebRTCCodec     *string `json:"webrtc_codec,omitempty" binding:"omitempty,oneof=auto h264 vp8"`
+	DeviceType      *string `json:"device_type,omitempty" binding:"omitempty,oneof=camera intercom"`
+	DoorRelay       *string `json:"door_relay,omitempty"`
+	TalkURL         *string `json:"talk_url,omitempty" binding:"omitempty,url"`
+	CredentialID    *uint   `json:"credential_id,omitempty"` // 0 detaches the credential
+}
+
+func (s *CameraSpec) apply(camera *models.Camera) {
+	camera.Name = s.Name
+	camera.Latitude = s.Latitude
+	camera.Longitude = s.Longitude
+	camera.RTSPUrl = s.RTSPUrl
+	camera.Area = s.Area
+	camera.Building = s.Building
+	if s.Status != nil {
+		camera.Status = *s.Status
+	}
+	if s.ONVIFPort != nil {
+		camera.ONVIFPort = *s.ONVIFPort
+	}
+	if s.Priority != nil {
+		camera.Priority = *s.Priority
+	}
+	if s.TamperDetection != nil {
+		camera.TamperDetection = *s.TamperDetection
+	}
+	if s.MotionDetection != nil {
+		camera.MotionDetection = *s.MotionDetection
+	}
+	if s.ONVIFMetadata != nil {
+		camera.ONVIFMetadata = *s.ONVIFMetadata
+	}
+	if s.WebRTCCodec != nil {
+		camera.WebRTCCodec = *s.WebRTCCodec
+	}
+	if s.DeviceType != nil {
+		camera.DeviceType = *s.DeviceType
+	}
+	if s.DoorRelay != nil {
+		camera.DoorRelay = *s.DoorRelay
+	}
+	if s.TalkURL != nil {
+		camera.TalkURL = *s.TalkURL
+	}
+	if s.CredentialID != nil {
+		if *s.CredentialID == 0 {
+			camera.CredentialID = nil
+		} else {
+			id := *s.CredentialID
+			camera.CredentialID = &id
+		}
+	}
+	if camera.CredentialID != nil {
+		camera.RTSPUrl = services.StripURLCredentials(camera.RTSPUrl)
+	}
+}
+
+// CameraPlanRequest is the desired list of cameras. With prune, cameras in
+// scope that aren't listed are deleted; without it they are left alone.
+type CameraPlanRequest struct {
+	Cameras []CameraSpec `json:"cameras" binding:"required,dive"`
+	Prune   bool         `json:"prune"`
+	Scope   struct {
+		Area     string `json:"area"`
+		Building string `json:"building"`
+	} `json:"scope"` // Limits which cameras prune may delete
+}
+
+// CameraFieldChange is one field an update changes
+type CameraFieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// CameraPlanChange is one camera the plan creates, updates or deletes
+type CameraPlanChange struct {
+	Action     string              `json:"action"`
+	CameraID   uint                `json:"camera_id,omitempty"` // Not set for creates
+	Name       string              `json:"name"`
+	Fields     []CameraFieldChange `json:"fields,omitempty"`
+	Spec       *CameraSpec         `json:"spec,omitempty"`       // Desired camera of creates and updates
+	UpdatedAt  *time.Time          `json:"updated_at,omitempty"` // Camera's updated_at when planned; applying refuses if it moved
+	Recordings int64               `json:"recordings,omitempty"` // Kept when the camera is deleted
+	Incidents  int64               `json:"incidents,omitempty"`
+}
+
+// CameraPlanResponse is a stored plan with its changes
+type CameraPlanResponse struct {
+	models.CameraPlan
+	Changes []CameraPlanChange `json:"changes"`
+}
+
+// CameraApplyResult is the response of ApplyCameraPlan
+type CameraApplyResult struct {
+	Plan      models.CameraPlan `json:"plan"`
+	Created   []uint            `json:"created"`
+	Updated   []uint            `json:"updated"`
+	Deleted   []uint            `json:"deleted"`
+	Restarted []uint            `json:"restarted,omitempty"` // Cameras whose streams restarted on a new source URL
+}
+
+// errPlanStale is returned when cameras changed between planning and applying
+var errPlanStale = errors.New("cameras changed since the plan was made; plan again")
+
+// PlanCameras computes the creates, updates and deletes that turn the
+// current cameras into the desired list, and stores them as a plan without
+// changing anything. ApplyCameraPlan then applies exactly that plan.
+func (h *CameraHandler) PlanCameras(c *gin.Context) {
+	var req CameraPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Cameras) > maxPlanCameras {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d cameras can be planned at once", maxPlanCameras)})
+		return
+	}
+
+	var cameras []models.Camera
+	if err := requestDB(h.db, c).Order("id").Find(&cameras).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+		return
+	}
+	byID := make(map[uint]*models.Camera, len(cameras))
+	byName := make(map[string][]*models.Camera)
+	for i := range cameras {
+		byID[cameras[i].ID] = &cameras[i]
+		byName[cameras[i].Name] = append(byName[cameras[i].Name], &cameras[i])
+	}
+
+	var changes []CameraPlanChange
+	matched := make(map[uint]bool)
+	created := make(map[string]bool)
+	unchanged := 0
+	for i := range req.Cameras {
+		spec := &req.Cameras[i]
+		if spec.CredentialID != nil && *spec.CredentialID != 0 {
+			exists, err := h.credentialExists(*spec.CredentialID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check credentials"})
+				return
+			}
+			if !exists {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cameras[%d]: credential not found", i)})
+				return
+			}
+		}
+		// Plans are stored and returned as is, so inline credentials are
+		// moved into the vault and the plan only references them
+		if spec.CredentialID == nil || *spec.CredentialID == 0 {
+			credentialID, stripped, err := h.credentials.VaultURLCredentials(spec.RTSPUrl)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("cameras[%d]: failed to store credentials", i)})
+				return
+			}
+			if credentialID != 0 {
+				spec.RTSPUrl = stripped
+				spec.CredentialID = &credentialID
+			}
+		} else {
+			spec.RTSPUrl = services.StripURLCredentials(spec.RTSPUrl)
+		}
+
+		if spec.Status != nil {
+			if _, exists := h.statuses.Get(*spec.Status); !exists {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cameras[%d]: unknown status %q", i, *spec.Status)})
+				return
+			}
+		}
+
+		if spec.TalkURL != nil && *spec.TalkURL != "" {
+			if err := services.ValidateTalkURL(*spec.TalkURL, spec.RTSPUrl); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cameras[%d]: %v", i, err)})
+				return
+			}
+		}
+
+		var current *models.Camera
+		if spec.ID != nil {
+			if current = byID[*spec.ID]; current == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cameras[%d]: camera %d not found", i, *spec.ID)})
+				return
+			}
+		} else if named := byName[spec.Name]; len(named) > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cameras[%d]: %d cameras are named %q; give the id", i, len(named), spec.Name)})
+			return
+		} else if len(named) == 1 {
+			current = named[0]
+		}
+
+		if current == nil {
+			if created[spec.Name] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cameras[%d]: %q is listed twice", i, spec.Name)})
+				return
+			}
+			created[spec.Name] = true
+			changes = append(changes, CameraPlanChange{Action: PlanActionCreate, Name: spec.Name, Spec: spec})
+			continue
+		}
+		if matched[current.ID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cameras[%d]: camera %d is listed twice", i, current.ID)})
+			return
+		}
+		matched[current.ID] = true
+
+		if spec.Status != nil {
+			if err := h.statuses.CheckTransition(current.Status, *spec.Status); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("cameras[%d]: %v", i, err)})
+				return
+			}
+		}
+		desired := *current
+		spec.apply(&desired)
+		fields := diffCamera(current, &desired)
+		if len(fields) == 0 {
+			unchanged++
+			continue
+		}
+		updatedAt := current.UpdatedAt
+		changes = append(changes, CameraPlanChange{
+			Action:    PlanActionUpdate,
+			CameraID:  current.ID,
+			Name:      current.Name,
+			Fields:    fields,
+			Spec:      spec,
+			UpdatedAt: &updatedAt,
+		})
+	}
+
+	if req.Prune {
+		var pruned []uint
+		for i := range cameras {
+			camera := &cameras[i]
+			if matched[camera.ID] || camera.Synthetic ||
+				(req.Scope.Area != "" && camera.Area != req.Scope.Area) ||
+				(req.Scope.Building != "" && camera.Building != req.Scope.Building) {
+				continue
+			}
+			pruned = append(pruned, camera.ID)
+		}
+		if len(pruned) > 0 {
+			dependents, err := h.cameraDependents(pruned)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check camera dependencies"})
+				return
+			}
+			for _, dependent := range dependents.Cameras {
+				updatedAt := byID[dependent.CameraID].UpdatedAt
+				changes = append(changes, CameraPlanChange{
+					Action:     PlanActionDelete,
+					CameraID:   dependent.CameraID,
+					Name:       dependent.Name,
+					UpdatedAt:  &updatedAt,
+					Recordings: dependent.Recordings,
+					Incidents:  dependent.Incidents,
+				})
+			}
+		}
+	}
+
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store plan"})
+		return
+	}
+	plan := models.CameraPlan{
+		CreatedByID: currentUserID(c),
+		Status:      models.CameraPlanPending,
+		Changes:     string(encoded),
+		Unchanged:   unchanged,
+		ExpiresAt:   time.Now().Add(cameraPlanTTL),
+	}
+	for _, change := range changes {
+		switch change.Action {
+		case PlanActionCreate:
+			plan.Creates++
+		case PlanActionUpdate:
+			plan.Updates++
+		case PlanActionDelete:
+			plan.Deletes++
+		}
+	}
+	// Plans are only useful for a short while; drop the old ones
+	requestDB(h.db, c).Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.CameraPlan{})
+	if err := requestDB(h.db, c).Create(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store plan"})
+		return
+	}
+
+	recordAudit(h.db, c, "plan", "camera", "", fmt.Sprintf("plan %d: %d to create, %d to update, %d to delete",
+		plan.ID, plan.Creates, plan.Updates, plan.Deletes))
+
+	if changes == nil {
+		changes = []CameraPlanChange{}
+	}
+	c.JSON(http.StatusCreated, CameraPlanResponse{CameraPlan: plan, Changes: changes})
+}
+
+// GetCameraPlan returns a stored plan
+func (h *CameraHandler) GetCameraPlan(c *gin.Context) {
+	var plan models.CameraPlan
+	if err := requestDB(h.db, c).First(&plan, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plan"})
+		return
+	}
+	changes := []CameraPlanChange{}
+	if err := json.Unmarshal([]byte(plan.Changes), &changes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read plan"})
+		return
+	}
+	for _, change := range changes {
+		if change.Spec != nil {
+			change.Spec.RTSPUrl = services.StripURLCredentials(change.Spec.RTSPUrl)
+		}
+	}
+	c.JSON(http.StatusOK, CameraPlanResponse{CameraPlan: plan, Changes: changes})
+}
+
+// ApplyCameraPlan applies a pending plan in one transaction. It is refused
+// when the plan expired, was already applied, or any camera it touches
+// changed since it was made.
+// Body: {"plan_id": 1}
+func (h *CameraHandler) ApplyCameraPlan(c *gin.Context) {
+	var req struct {
+		PlanID uint `json:"plan_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var plan models.CameraPlan
+	if err := requestDB(h.db, c).First(&plan, req.PlanID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plan"})
+		return
+	}
+	if plan.Status != models.CameraPlanPending {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Plan is %s", plan.Status)})
+		return
+	}
+	if time.Now().After(plan.ExpiresAt) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Plan expired; plan again"})
+		return
+	}
+	var changes []CameraPlanChange
+	if err := json.Unmarshal([]byte(plan.Changes), &changes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read plan"})
+		return
+	}
+
+	result := CameraApplyResult{Created: []uint{}, Updated: []uint{}, Deleted: []uint{}}
+	var statusChanges []models.CameraStatusEvent
+	var restarts []models.Camera
+	var cleanup *cameraCleanup
+	now := time.Now()
+	err := requestDB(h.db, c).Transaction(func(tx *gorm.DB) error {
+		// Claiming the plan first keeps two concurrent applies from both running
+		claim := tx.Model(&models.CameraPlan{}).
+			Where("id = ? AND status = ?", plan.ID, models.CameraPlanPending).
+			Updates(map[string]interface{}{"status": models.CameraPlanApplied, "applied_at": now, "applied_by_id": currentUserID(c)})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return errPlanStale
+		}
+
+		for _, change := range changes {
+			switch change.Action {
+			case PlanActionCreate:
+				var taken int64
+				if err := tx.Model(&models.Camera{}).Where("name = ?", change.Name).Count(&taken).Error; err != nil {
+					return err
+				}
+				if taken > 0 {
+					return errPlanStale
+				}
+				camera := models.Camera{Status: "offline", ONVIFPort: 80, Priority: models.CameraPriorityNormal, WebRTCCodec: models.WebRTCCodecAuto, DeviceType: models.DeviceTypeCamera}
+				change.Spec.apply(&camera)
+				if err := tx.Create(&camera).Error; err != nil {
+					return err
+				}
+				result.Created = append(result.Created, camera.ID)
+
+			case PlanActionUpdate:
+				var camera models.Camera
+				if err := tx.First(&camera, change.CameraID).Error; err != nil {
+					if err == gorm.ErrRecordNotFound {
+						return errPlanStale
+					}
+					return err
+				}
+				if change.UpdatedAt == nil || !camera.UpdatedAt.Equal(*change.UpdatedAt) {
+					return errPlanStale
+				}
+				previousURL := h.credentials.StreamURL(&camera)
+				previousStatus := camera.Status
+				change.Spec.apply(&camera)
+				if err := tx.Save(&camera).Error; err != nil {
+					return err
+				}
+				result.Updated = append(result.Updated, camera.ID)
+				if camera.Status != previousStatus {
+					statusChanges = append(statusChanges, models.CameraStatusEvent{
+						CameraID:   camera.ID,
+						FromStatus: previousStatus,
+						ToStatus:   camera.Status,
+						Source:     models.StatusSourceManual,
+						ChangedAt:  now,
+					})
+				}
+				if h.credentials.StreamURL(&camera) != previousURL {
+					restarts = append(restarts, camera)
+				}
+
+			case PlanActionDelete:
+				var camera models.Camera
+				if err := tx.Select("id", "updated_at").First(&camera, change.CameraID).Error; err != nil {
+					if err == gorm.ErrRecordNotFound {
+						return errPlanStale
+					}
+					return err
+				}
+				if change.UpdatedAt == nil || !camera.UpdatedAt.Equal(*change.UpdatedAt) {
+					return errPlanStale
+				}
+				result.Deleted = append(result.Deleted, camera.ID)
+			}
+		}
+
+		if len(result.Deleted) > 0 {
+			deleted, err := deleteCameras(tx, result.Deleted, true)
+			if err != nil {
+				return err
+			}
+			cleanup = deleted
+		}
+		return nil
+	})
+	if err == errPlanStale {
+		requestDB(h.db, c).Model(&models.CameraPlan{}).Where("id = ? AND status = ?", plan.ID, models.CameraPlanPending).
+			Update("status", models.CameraPlanStale)
+		c.JSON(http.StatusConflict, gin.H{"error": errPlanStale.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply plan"})
+		return
+	}
+
+	if cleanup != nil {
+		cleanup.finish()
+	}
+	h.stopDeletedStreams(result.Deleted)
+	for i := range restarts {
+		h.restartStreams(&restarts[i])
+		result.Restarted = append(result.Restarted, restarts[i].ID)
+	}
+	for i := range statusChanges {
+		h.healthHistory.RecordStatusChange(&statusChanges[i])
+	}
+
+	planRef := fmt.Sprintf("plan %d", plan.ID)
+	for _, id := range result.Created {
+		recordAudit(h.db, c, "create", "camera", fmt.Sprint(id), planRef)
+	}
+	for _, id := range result.Updated {
+		recordAudit(h.db, c, "update", "camera", fmt.Sprint(id), planRef)
+	}
+	for _, id := range result.Deleted {
+		recordAudit(h.db, c, "delete", "camera", fmt.Sprint(id), planRef+" mode=archive")
+	}
+	h.changes.notify()
+
+	requestDB(h.db, c).First(&result.Plan, plan.ID)
+	c.JSON(http.StatusOK, result)
+}
+
+// diffCamera lists the fields that differ between two versions of a
+// camera. Credentials in source URLs are never shown.
+func diffCamera(from, to *models.Camera) []CameraFieldChange {
+	var fields []CameraFieldChange
+	add := func(field string, before, after interface{}) {
+		if before != after {
+			fields = append(fields, CameraFieldChange{Field: field, From: before, To: after})
+		}
+	}
+	add("name", from.Name, to.Name)
+	add("latitude", from.Latitude, to.Latitude)
+	add("longitude", from.Longitude, to.Longitude)
+	if from.RTSPUrl != to.RTSPUrl {
+		before, after := services.StripURLCredentials(from.RTSPUrl), services.StripURLCredentials(to.RTSPUrl)
+		if before == after {
+			fields = append(fields, CameraFieldChange{Field: "rtsp_url", From: "(credentials)", To: "(new credentials)"})
+		} else {
+			fields = append(fields, CameraFieldChange{Field: "rtsp_url", From: before, To: after})
+		}
+	}
+	add("area", from.Area, to.Area)
+	add("building", from.Building, to.Building)
+	add("status", from.Status, to.Status)
+	add("onvif_port", from.ONVIFPort, to.ONVIFPort)
+	add("priority", from.Priority, to.Priority)
+	add("tamper_detection", from.TamperDetection, to.TamperDetection)
+	add("motion_detection", from.MotionDetection, to.MotionDetection)
+	add("onvif_metadata", from.ONVIFMetadata, to.ONVIFMetadata)
+	add("webrtc_codec", from.WebRTCCodec, to.WebRTCCodec)
+	add("device_type", from.DeviceType, to.DeviceType)
+	add("door_relay", from.DoorRelay, to.DoorRelay)
+	add("talk_url", services.StripURLCredentials(from.TalkURL), services.StripURLCredentials(to.TalkURL))
+	var fromCredential, toCredential uint
+	if from.CredentialID != nil {
+		fromCredential = *from.CredentialID
+	}
+	if to.CredentialID != nil {
+		toCredential = *to.CredentialID
+	}
+	add("credential_id", fromCredential, toCredential)
+	return fields
+}
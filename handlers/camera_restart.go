@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamRestart reports what happened to a camera's streams after its
+// source URL changed or a restart was requested
+type StreamRestart struct {
+	Stopped []string                  `json:"stopped"` // Pipelines whose streams were stopped
+	Probe   *services.RTSPProbeResult `json:"probe,omitempty"`
+	Error   *services.StreamError     `json:"error,omitempty"` // Probe failure against the new URL
+	HLSURL  string                    `json:"hls_url,omitempty"`
+}
+
+// CameraUpdateResponse is the updated camera, with the stream restart when
+// its source URL changed
+type CameraUpdateResponse struct {
+	models.Camera
+	StreamRestart *StreamRestart `json:"stream_restart,omitempty"`
+}
+
+// restartStreams stops everything still pulling a camera's old URL, probes
+// the new one and reconfigures the MediaMTX path if it was active. WebRTC,
+// MJPEG, legacy HLS and audio streams start again on the next request.
+func (h *CameraHandler) restartStreams(camera *models.Camera) StreamRestart {
+	restart := StreamRestart{Stopped: h.stopStreams(camera.ID)}
+	rtspURL := h.credentials.StreamURL(camera)
+
+	restart.Probe, restart.Error = h.mediamtxService.Reprobe(camera.ID, rtspURL)
+
+	if _, active := h.mediamtxService.GetPathInfo(camera.ID); active {
+		restart.Stopped = append(restart.Stopped, "mediamtx")
+		hlsURL, err := h.mediamtxService.RefreshStream(camera.ID, rtspURL)
+		if err != nil {
+			fmt.Printf("[Cameras] Failed to restart MediaMTX path for camera %d: %v\n", camera.ID, err)
+		}
+		restart.HLSURL = hlsURL
+	}
+
+	fmt.Printf("[Cameras] Source URL of camera %d changed, stopped %v\n", camera.ID, restart.Stopped)
+	return restart
+}
+
+// reconnectStreams stops everything pulling a camera and reconfigures its
+// MediaMTX path if it was active, without probing, for a source whose
+// credential was rotated. WebRTC, MJPEG, legacy HLS and audio streams start
+// again on the next request. Returns the pipelines that were restarted.
+func (h *CameraHandler) reconnectStreams(camera *models.Camera) []string {
+	stopped := h.stopStreams(camera.ID)
+	if _, active := h.mediamtxService.GetPathInfo(camera.ID); active {
+		if _, err := h.mediamtxService.RefreshStream(camera.ID, h.credentials.StreamURL(camera)); err != nil {
+			fmt.Printf("[Vault] Failed to refresh MediaMTX path for camera %d: %v\n", camera.ID, err)
+		}
+		stopped = append(stopped, "mediamtx")
+	}
+	return stopped
+}
+
+// stopLiveStreams stops a camera's live streams: its MediaMTX path and the
+// WebRTC, MJPEG, legacy HLS and audio streams. Recordings are left running;
+// they follow their schedule. Other cluster nodes stop their WebRTC and
+// MJPEG streams of the camera shortly after.
+func (h *CameraHandler) stopLiveStreams(cameraID uint) []string {
+	h.cluster.RequestStreamStop(cameraID, services.PipelineWebRTC, services.PipelineMJPEG)
+	stopped := []string{}
+	if h.mediamtxService.StopStream(cameraID) == nil {
+		stopped = append(stopped, "mediamtx")
+	}
+	return append(stopped, h.stopViewerStreams(cameraID)...)
+}
+
+// StopCameraStream stops a camera's live streams, e.g. one stuck on a dead
+// FFmpeg. They start again on the next stream request.
+func (h *CameraHandler) StopCameraStream(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+		return
+	}
+
+	stopped := h.stopLiveStreams(camera.ID)
+	fmt.Printf("[Cameras] Streams of camera %d stopped by request, stopped %v\n", camera.ID, stopped)
+	recordAudit(h.db, c, "stop_stream", "camera", fmt.Sprint(camera.ID), fmt.Sprintf("%s: stopped %v", camera.Name, stopped))
+
+	c.JSON(http.StatusOK, gin.H{"camera_id": camera.ID, "stopped": stopped})
+}
+
+// RestartCameraStream stops a camera's live streams, probes the camera again
+// and sets its MediaMTX path up anew. WebRTC, MJPEG, legacy HLS and audio
+// viewers reconnect to start theirs.
+func (h *CameraHandler) RestartCameraStream(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+		return
+	}
+
+	restart := StreamRestart{Stopped: h.stopLiveStreams(camera.ID)}
+	rtspURL := h.credentials.StreamURL(&camera)
+	restart.Probe, restart.Error = h.mediamtxService.Reprobe(camera.ID, rtspURL)
+
+	hlsURL, err := h.mediamtxService.StartStream(camera.ID, rtspURL)
+	recordAudit(h.db, c, "restart_stream", "camera", fmt.Sprint(camera.ID), fmt.Sprintf("%s: stopped %v", camera.Name, restart.Stopped))
+	if err != nil {
+		fmt.Printf("[Cameras] Failed to restart MediaMTX path for camera %d: %v\n", camera.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to restart stream: " + err.Error(), "stream_restart": restart})
+		return
+	}
+	restart.HLSURL = h.signStreamURL(c, camera.ID, hlsURL)
+	h.viewers.Touch(camera.ID, services.PipelineHLS)
+	fmt.Printf("[Cameras] Streams of camera %d restarted by request, stopped %v\n", camera.ID, restart.Stopped)
+
+	c.JSON(http.StatusOK, gin.H{"camera_id": camera.ID, "stream_restart": restart})
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var statusKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+type CameraStatusHandler struct {
+	db       *gorm.DB
+	statuses *services.CameraStatusService
+}
+
+func NewCameraStatusHandler(db *gorm.DB, statuses *services.CameraStatusService) *CameraStatusHandler {
+	return &CameraStatusHandler{
+		db:       db,
+		statuses: statuses,
+	}
+}
+
+type CreateCameraStatusRequest struct {
+	Key         string   `json:"key" binding:"required"`
+	Label       string   `json:"label" binding:"required"`
+	Color       string   `json:"color"`
+	Description string   `json:"description"`
+	Monitored   bool     `json:"monitored"`
+	Transitions []string `json:"transitions"`
+	SortOrder   int      `json:"sort_order"`
+}
+
+type UpdateCameraStatusRequest struct {
+	Label       *string   `json:"label"`
+	Color       *string   `json:"color"`
+	Description *string   `json:"description"`
+	Monitored   *bool     `json:"monitored"`
+	Transitions *[]string `json:"transitions"`
+	SortOrder   *int      `json:"sort_order"`
+}
+
+// CameraStatusResponse is a status definition and how many cameras are in it
+type CameraStatusResponse struct {
+	models.CameraStatusDefinition
+	CameraCount int64 `json:"camera_count"`
+}
+
+// ListCameraStatuses returns every status cameras can be in, in display order
+func (h *CameraStatusHandler) ListCameraStatuses(c *gin.Context) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := requestDB(h.db, c).Model(&models.Camera{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count cameras"})
+		return
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	statuses := h.statuses.List()
+	response := make([]CameraStatusResponse, len(statuses))
+	for i, status := range statuses {
+		response[i] = CameraStatusResponse{CameraStatusDefinition: status, CameraCount: counts[status.Key]}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *CameraStatusHandler) CreateCameraStatus(c *gin.Context) {
+	var req CreateCameraStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !statusKeyPattern.MatchString(req.Key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must be lowercase letters, digits and underscores, e.g. awaiting_install"})
+		return
+	}
+	if _, exists := h.statuses.Get(req.Key); exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Status already exists"})
+		return
+	}
+	transitions, err := h.transitions(req.Key, req.Transitions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := models.CameraStatusDefinition{
+		Key:         req.Key,
+		Label:       req.Label,
+		Color:       req.Color,
+		Description: req.Description,
+		Monitored:   req.Monitored,
+		Transitions: transitions,
+		SortOrder:   req.SortOrder,
+	}
+	if err := requestDB(h.db, c).Create(&status).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create status"})
+		return
+	}
+	h.reload()
+
+	recordAudit(h.db, c, "create", "camera_status", status.Key, status.Label)
+
+	c.JSON(http.StatusCreated, CameraStatusResponse{CameraStatusDefinition: status})
+}
+
+// UpdateCameraStatus edits a status. Built-in statuses stay monitored.
+func (h *CameraStatusHandler) UpdateCameraStatus(c *gin.Context) {
+	var req UpdateCameraStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var status models.CameraStatusDefinition
+	if err := requestDB(h.db, c).Where("key = ?", c.Param("key")).First(&status).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Status not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch status"})
+		return
+	}
+
+	if req.Label != nil {
+		status.Label = *req.Label
+	}
+	if req.Color != nil {
+		status.Color = *req.Color
+	}
+	if req.Description != nil {
+		status.Description = *req.Description
+	}
+	if req.Monitored != nil {
+		if status.System && !*req.Monitored {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in statuses are always monitored"})
+			return
+		}
+		status.Monitored = *req.Monitored
+	}
+	if req.Transitions != nil {
+		transitions, err := h.transitions(status.Key, *req.Transitions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		status.Transitions = transitions
+	}
+	if req.SortOrder != nil {
+		status.SortOrder = *req.SortOrder
+	}
+
+	if err := requestDB(h.db, c).Save(&status).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
+		return
+	}
+	h.reload()
+
+	recordAudit(h.db, c, "update", "camera_status", status.Key, status.Label)
+
+	c.JSON(http.StatusOK, status)
+}
+
+// DeleteCameraStatus removes a status no camera is in, and drops it from
+// the transitions of the others
+func (h *CameraStatusHandler) DeleteCameraStatus(c *gin.Context) {
+	status, exists := h.statuses.Get(c.Param("key"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Status not found"})
+		return
+	}
+	if status.System {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in statuses cannot be deleted"})
+		return
+	}
+
+	var cameras int64
+	if err := requestDB(h.db, c).Model(&models.Camera{}).Where("status = ?", status.Key).Count(&cameras).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count cameras"})
+		return
+	}
+	if cameras > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%d cameras are %s; move them to another status first", cameras, status.Key)})
+		return
+	}
+
+	err := requestDB(h.db, c).Transaction(func(tx *gorm.DB) error {
+		for _, other := range h.statuses.List() {
+			next := other.Next()
+			kept := make([]string, 0, len(next))
+			for _, key := range next {
+				if key != status.Key {
+					kept = append(kept, key)
+				}
+			}
+			if len(kept) == len(next) {
+				continue
+			}
+			if err := tx.Model(&models.CameraStatusDefinition{}).Where("id = ?", other.ID).
+				Update("transitions", strings.Join(kept, ",")).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.CameraStatusDefinition{}, status.ID).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete status"})
+		return
+	}
+	h.reload()
+
+	recordAudit(h.db, c, "delete", "camera_status", status.Key, status.Label)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status deleted"})
+}
+
+// transitions validates the statuses a status may change to and joins them
+// for CameraStatusDefinition.Transitions
+func (h *CameraStatusHandler) transitions(key string, next []string) (string, error) {
+	kept := make([]string, 0, len(next))
+	seen := make(map[string]bool)
+	for _, to := range next {
+		to = strings.TrimSpace(to)
+		if to == "" || to == key || seen[to] {
+			continue
+		}
+		if _, exists := h.statuses.Get(to); !exists {
+			return "", fmt.Errorf("unknown status %q in transitions", to)
+		}
+		seen[to] = true
+		kept = append(kept, to)
+	}
+	return strings.Join(kept, ","), nil
+}
+
+func (h *CameraStatusHandler) reload() {
+	if err := h.statuses.Load(); err != nil {
+		fmt.Printf("[Cameras] Failed to reload camera statuses: %v\n", err)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamProtocols are the protocols served by the unified stream endpoint
+var streamProtocols = []string{"hls", "webrtc", "mjpeg", "audio"}
+
+// ListCamerasPage is the v2 camera list: cursor paginated, oldest first,
+// with the filters of the v1 list
+// Query: ?after=&limit=&status=&area=&building=&q=
+func (h *CameraHandler) ListCamerasPage(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := h.cameraFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Scopes(filters)
+	if cursor != nil {
+		query = query.Scopes(database.SeekAfter("created_at", cursor.Time, cursor.ID))
+	}
+
+	var cameras []models.Camera
+	if err := query.Scopes(database.OldestFirst("created_at")).Limit(limit + 1).Find(&cameras).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(cameras, limit, func(camera models.Camera) (time.Time, uint) {
+		return camera.CreatedAt, camera.ID
+	}))
+}
+
+// GetStream is the v2 unified stream endpoint: one route for every playback
+// protocol instead of a route per protocol
+// Query: ?protocol=hls|webrtc|mjpeg|audio (default hls), ?wait= as in v1
+func (h *CameraHandler) GetStream(c *gin.Context) {
+	protocol := c.DefaultQuery("protocol", "hls")
+	switch protocol {
+	case "hls":
+		h.GetStreamURL(c)
+	case "webrtc":
+		h.GetWebRTCStream(c)
+	case "mjpeg", "audio":
+		// Continuous media bodies; describe where to read them from
+		var camera models.Camera
+		if err := requestDB(h.db, c).Select("id").First(&camera, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		base := strings.TrimSuffix(c.Request.URL.Path, "/stream")
+		c.JSON(http.StatusOK, gin.H{
+			"camera_id":   camera.ID,
+			"stream_type": protocol,
+			"url":         fmt.Sprintf("%s/%s", base, protocol),
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("protocol must be one of %s", strings.Join(streamProtocols, ", "))})
+	}
+}
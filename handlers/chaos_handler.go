@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ChaosHandler exposes failure injection. Its routes are only registered
+// outside production (APP_ENV).
+type ChaosHandler struct {
+	db    *gorm.DB
+	chaos *services.ChaosService
+}
+
+func NewChaosHandler(db *gorm.DB, chaos *services.ChaosService) *ChaosHandler {
+	return &ChaosHandler{
+		db:    db,
+		chaos: chaos,
+	}
+}
+
+type KillFFmpegRequest struct {
+	Pipeline string `json:"pipeline"` // webrtc, mjpeg, hls_legacy, audio; empty = all
+}
+
+type BlockMediaMTXRequest struct {
+	Blocked  bool   `json:"blocked"`
+	Duration string `json:"duration"` // e.g. 30s; empty = until unblocked
+}
+
+type DelayRTSPRequest struct {
+	Delay    string `json:"delay" binding:"required"` // e.g. 3s; 0 removes it
+	Duration string `json:"duration"`                 // e.g. 5m; empty = until removed
+}
+
+// parseOptionalDuration parses a duration field that may be empty
+func parseOptionalDuration(field, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid %s %q", field, value)
+	}
+	return duration, nil
+}
+
+func (h *ChaosHandler) GetChaosStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.chaos.Status())
+}
+
+// KillFFmpeg kills the backend's FFmpeg processes for a camera
+func (h *ChaosHandler) KillFFmpeg(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id").First(&camera, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+		return
+	}
+	var req KillFFmpegRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	killed := h.chaos.KillFFmpeg(camera.ID, req.Pipeline)
+	recordAudit(h.db, c, "chaos_kill_ffmpeg", "camera", fmt.Sprint(camera.ID), req.Pipeline)
+
+	c.JSON(http.StatusOK, gin.H{"killed": killed})
+}
+
+// BlockMediaMTX makes every MediaMTX API call fail, as if it were down
+func (h *ChaosHandler) BlockMediaMTX(c *gin.Context) {
+	var req BlockMediaMTXRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	duration, err := parseOptionalDuration("duration", req.Duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.chaos.SetMediaMTXBlocked(req.Blocked, duration)
+	recordAudit(h.db, c, "chaos_block_mediamtx", "mediamtx", "", fmt.Sprintf("blocked=%v duration=%s", req.Blocked, req.Duration))
+
+	c.JSON(http.StatusOK, h.chaos.Status())
+}
+
+// DelayRTSP delays every RTSP connection the backend makes
+func (h *ChaosHandler) DelayRTSP(c *gin.Context) {
+	var req DelayRTSPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	delay, err := parseOptionalDuration("delay", req.Delay)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	duration, err := parseOptionalDuration("duration", req.Duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.chaos.SetRTSPDelay(delay, duration)
+	recordAudit(h.db, c, "chaos_delay_rtsp", "rtsp", "", fmt.Sprintf("delay=%s duration=%s", req.Delay, req.Duration))
+
+	c.JSON(http.StatusOK, h.chaos.Status())
+}
+
+// ResetChaos removes every injected failure
+func (h *ChaosHandler) ResetChaos(c *gin.Context) {
+	h.chaos.Reset()
+	recordAudit(h.db, c, "chaos_reset", "chaos", "", "")
+
+	c.JSON(http.StatusOK, h.chaos.Status())
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Limits on what a client may report, so a misbehaving player can't fill
+// the table with huge rows
+const (
+	maxClientLogMessage = 2000
+	maxClientLogDetails = 8 << 10
+	maxClientLogBody    = maxClientLogDetails + 4<<10 // details plus the other fields
+	maxClientLogAge     = 24 * time.Hour              // Older occurred_at values are taken as a wrong client clock
+)
+
+var clientLogProtocols = map[string]bool{"": true, "hls": true, "webrtc": true, "mjpeg": true, "audio": true}
+
+type ClientLogHandler struct {
+	db     *gorm.DB
+	config config.ClientLogConfig
+
+	mu      sync.Mutex
+	windows map[uint]*clientLogWindow // user_id -> reports this minute
+}
+
+// clientLogWindow counts a user's reports in the minute since start
+type clientLogWindow struct {
+	start time.Time
+	count int
+}
+
+func NewClientLogHandler(cfg config.ClientLogConfig, db *gorm.DB) *ClientLogHandler {
+	return &ClientLogHandler{
+		db:      db,
+		config:  cfg,
+		windows: make(map[uint]*clientLogWindow),
+	}
+}
+
+// allow counts a report of the user against CLIENT_LOG_RATE_LIMIT and
+// reports whether it is within it. Windows of other users that ended are
+// dropped along the way.
+func (h *ClientLogHandler) allow(userID uint, now time.Time) bool {
+	if h.config.RateLimit <= 0 {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	window, exists := h.windows[userID]
+	if !exists || now.Sub(window.start) >= time.Minute {
+		for id, other := range h.windows {
+			if now.Sub(other.start) >= time.Minute {
+				delete(h.windows, id)
+			}
+		}
+		window = &clientLogWindow{start: now}
+		h.windows[userID] = window
+	}
+	window.count++
+	return window.count <= h.config.RateLimit
+}
+
+type ReportClientLogRequest struct {
+	CameraID   *uint           `json:"camera_id"`
+	SessionID  string          `json:"session_id" binding:"max=100"`
+	Protocol   string          `json:"protocol"`
+	Type       string          `json:"type" binding:"required,max=100"`
+	Message    string          `json:"message"`
+	Details    json.RawMessage `json:"details"`
+	OccurredAt *time.Time      `json:"occurred_at"`
+}
+
+// ClientLogSummary is how often one kind of playback error was reported for
+// a camera over a protocol
+type ClientLogSummary struct {
+	CameraID   *uint     `json:"camera_id"`
+	CameraName string    `json:"camera_name,omitempty"`
+	Protocol   string    `json:"protocol"`
+	Type       string    `json:"type"`
+	Count      int64     `json:"count"`
+	Sessions   int64     `json:"sessions"` // Distinct player sessions reporting it
+	Users      int64     `json:"users"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// ReportClientLog stores a playback error reported by the frontend
+func (h *ClientLogHandler) ReportClientLog(c *gin.Context) {
+	if !h.allow(c.GetUint("user_id"), time.Now()) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many client logs, try again in a minute"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxClientLogBody)
+	var req ReportClientLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Client log is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Protocol = strings.ToLower(strings.TrimSpace(req.Protocol))
+	if !clientLogProtocols[req.Protocol] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "protocol must be hls, webrtc, mjpeg or audio"})
+		return
+	}
+	if len(req.Details) > maxClientLogDetails {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "details is too large"})
+		return
+	}
+	if req.CameraID != nil {
+		var count int64
+		if err := requestDB(h.db, c).Model(&models.Camera{}).Where("id = ?", *req.CameraID).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+	}
+
+	now := time.Now()
+	occurredAt := now
+	if req.OccurredAt != nil && req.OccurredAt.Before(now) && now.Sub(*req.OccurredAt) < maxClientLogAge {
+		occurredAt = *req.OccurredAt
+	}
+	message := req.Message
+	if len(message) > maxClientLogMessage {
+		// Cut at a rune boundary so the message stays valid UTF-8
+		cut := maxClientLogMessage
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		message = message[:cut]
+	}
+	details := ""
+	if len(req.Details) > 0 && string(req.Details) != "null" {
+		details = string(req.Details)
+	}
+
+	entry := models.ClientLog{
+		CameraID:   req.CameraID,
+		UserID:     currentUserID(c),
+		Email:      c.GetString("email"),
+		SessionID:  req.SessionID,
+		Protocol:   req.Protocol,
+		Type:       strings.TrimSpace(req.Type),
+		Message:    message,
+		Details:    details,
+		UserAgent:  c.Request.UserAgent(),
+		ClientIP:   c.ClientIP(),
+		OccurredAt: occurredAt,
+	}
+	if err := requestDB(h.db, c).Create(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store client log"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": entry.ID})
+}
+
+// ListClientLogs returns reported playback errors newest first using cursor
+// pagination
+// Query: ?after=&limit=&camera_id=&user_id=&protocol=&type=&session_id=&from=&to=
+func (h *ClientLogHandler) ListClientLogs(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := parseUintParam(c, "user_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.ClientLog{}).Scopes(database.TimeRange("occurred_at", from, to))
+	if cameraID != 0 {
+		query = query.Where("camera_id = ?", cameraID)
+	}
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if protocol := c.Query("protocol"); protocol != "" {
+		query = query.Where("protocol = ?", protocol)
+	}
+	if logType := c.Query("type"); logType != "" {
+		query = query.Where("type = ?", logType)
+	}
+	if sessionID := c.Query("session_id"); sessionID != "" {
+		query = query.Where("session_id = ?", sessionID)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("occurred_at", cursor.Time, cursor.ID))
+	}
+
+	var logs []models.ClientLog
+	if err := query.Scopes(database.NewestFirst("occurred_at")).Limit(limit + 1).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch client logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(logs, limit, func(l models.ClientLog) (time.Time, uint) {
+		return l.OccurredAt, l.ID
+	}))
+}
+
+// GetClientLogSummary counts reported playback errors per camera, protocol
+// and type over a window, most reported first
+// Query: ?from=&to=&camera_id=&protocol=
+func (h *ClientLogHandler) GetClientLogSummary(c *gin.Context) {
+	from, to, err := parseAnalyticsWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Table("client_logs").
+		Select("client_logs.camera_id, cameras.name AS camera_name, client_logs.protocol, client_logs.type, COUNT(*) AS count, " +
+			"COUNT(DISTINCT NULLIF(client_logs.session_id, '')) AS sessions, COUNT(DISTINCT client_logs.user_id) AS users, MAX(client_logs.occurred_at) AS last_seen").
+		Joins("LEFT JOIN cameras ON cameras.id = client_logs.camera_id").
+		Scopes(database.TimeRange("client_logs.occurred_at", &from, &to))
+	if cameraID != 0 {
+		query = query.Where("client_logs.camera_id = ?", cameraID)
+	}
+	if protocol := c.Query("protocol"); protocol != "" {
+		query = query.Where("client_logs.protocol = ?", protocol)
+	}
+
+	var summaries []ClientLogSummary
+	if err := query.Group("client_logs.camera_id, cameras.name, client_logs.protocol, client_logs.type").Order("count DESC").Scan(&summaries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize client logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"summary": summaries,
+	})
+}
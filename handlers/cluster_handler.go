@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ClusterHandler struct {
+	cluster *services.ClusterService
+}
+
+func NewClusterHandler(cluster *services.ClusterService) *ClusterHandler {
+	return &ClusterHandler{
+		cluster: cluster,
+	}
+}
+
+// GetCluster returns the backend instances seen in the last day, which one
+// leads and which one answered the request
+func (h *ClusterHandler) GetCluster(c *gin.Context) {
+	nodes, err := h.cluster.Nodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cluster nodes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"node_id": h.cluster.NodeID(),
+		"leader":  h.cluster.IsLeader(),
+		"nodes":   nodes,
+	})
+}
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxCountReports     = 1000 // Per ingest request
+	maxOccupancyBuckets = 2000
+)
+
+type CountingHandler struct {
+	db *gorm.DB
+}
+
+func NewCountingHandler(db *gorm.DB) *CountingHandler {
+	return &CountingHandler{
+		db: db,
+	}
+}
+
+type CountingRuleRequest struct {
+	Name     *string `json:"name"`
+	Kind     *string `json:"kind"`
+	Points   *string `json:"points"`
+	Area     *string `json:"area"`
+	Inverted *bool   `json:"inverted"`
+	Enabled  *bool   `json:"enabled"`
+}
+
+// apply copies the provided fields onto rule and validates the result
+func (req *CountingRuleRequest) apply(rule *models.CountingRule) error {
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Kind != nil {
+		rule.Kind = *req.Kind
+	}
+	if req.Points != nil {
+		rule.Points = *req.Points
+	}
+	if req.Area != nil && *req.Area != "" {
+		rule.Area = *req.Area
+	}
+	if req.Inverted != nil {
+		rule.Inverted = *req.Inverted
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+
+	if rule.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	_, err := rule.Vertices()
+	return err
+}
+
+// CountReport is one report from camera analytics. Lines report entries
+// and exits since their previous report, zones their current occupancy.
+type CountReport struct {
+	RuleID     uint       `json:"rule_id" binding:"required"`
+	Entries    int        `json:"entries"`
+	Exits      int        `json:"exits"`
+	Occupancy  *int       `json:"occupancy"`
+	OccurredAt *time.Time `json:"occurred_at"` // Defaults to now
+}
+
+type IngestCountsRequest struct {
+	Reports []CountReport `json:"reports" binding:"required,dive"`
+}
+
+// OccupancyPoint is one interval of an area: people counted in and out
+// during it and the occupancy at its end
+type OccupancyPoint struct {
+	Time      time.Time `json:"time"` // Interval start
+	Entries   int64     `json:"entries"`
+	Exits     int64     `json:"exits"`
+	Occupancy int64     `json:"occupancy"`
+}
+
+// AreaOccupancy is the occupancy series of one area
+type AreaOccupancy struct {
+	Area    string           `json:"area"`
+	Current int64            `json:"current"` // Last point
+	Peak    int64            `json:"peak"`
+	Points  []OccupancyPoint `json:"points"`
+}
+
+// ListCountingRules returns the counting lines and zones of a camera
+func (h *CountingHandler) ListCountingRules(c *gin.Context) {
+	rules := []models.CountingRule{}
+	if err := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).Order("id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch counting rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func (h *CountingHandler) CreateCountingRule(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	var req CountingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.CountingRule{
+		CameraID: camera.ID,
+		Area:     camera.Area,
+		Enabled:  true,
+	}
+	if err := req.apply(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create counting rule"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "counting_rule", fmt.Sprint(rule.ID), rule.Name)
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *CountingHandler) UpdateCountingRule(c *gin.Context) {
+	var rule models.CountingRule
+	if err := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).First(&rule, c.Param("ruleId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Counting rule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch counting rule"})
+		return
+	}
+
+	var req CountingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Kind != nil && *req.Kind != rule.Kind {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind can't be changed; create a new rule"})
+		return
+	}
+	if err := req.apply(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update counting rule"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "counting_rule", fmt.Sprint(rule.ID), rule.Name)
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteCountingRule removes a rule; its past counts stay in the area's history
+func (h *CountingHandler) DeleteCountingRule(c *gin.Context) {
+	result := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).Delete(&models.CountingRule{}, c.Param("ruleId"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete counting rule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Counting rule not found"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "counting_rule", c.Param("ruleId"), "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Counting rule deleted successfully"})
+}
+
+// IngestCounts stores reports pushed by camera analytics (or a counting
+// worker). Reports for disabled or unknown rules reject the whole batch.
+func (h *CountingHandler) IngestCounts(c *gin.Context) {
+	var req IngestCountsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Reports) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reports is empty"})
+		return
+	}
+	if len(req.Reports) > maxCountReports {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d reports per request", maxCountReports)})
+		return
+	}
+
+	ruleIDs := make([]uint, len(req.Reports))
+	for i, report := range req.Reports {
+		ruleIDs[i] = report.RuleID
+	}
+	var rules []models.CountingRule
+	if err := requestDB(h.db, c).Where("id IN ? AND enabled = ?", ruleIDs, true).Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch counting rules"})
+		return
+	}
+	byID := make(map[uint]models.CountingRule, len(rules))
+	for _, rule := range rules {
+		byID[rule.ID] = rule
+	}
+
+	now := time.Now()
+	counts := make([]models.PeopleCount, len(req.Reports))
+	for i, report := range req.Reports {
+		rule, ok := byID[report.RuleID]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reports[%d]: counting rule %d not found or disabled", i, report.RuleID)})
+			return
+		}
+		count := models.PeopleCount{
+			RuleID:     rule.ID,
+			CameraID:   rule.CameraID,
+			Area:       rule.Area,
+			OccurredAt: now,
+		}
+		if report.OccurredAt != nil {
+			count.OccurredAt = *report.OccurredAt
+		}
+
+		switch rule.Kind {
+		case models.CountingLine:
+			if report.Occupancy != nil || report.Entries < 0 || report.Exits < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reports[%d]: lines report non-negative entries and exits", i)})
+				return
+			}
+			count.Entries, count.Exits = report.Entries, report.Exits
+			if rule.Inverted {
+				count.Entries, count.Exits = count.Exits, count.Entries
+			}
+		case models.CountingZone:
+			if report.Occupancy == nil || *report.Occupancy < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reports[%d]: zones report a non-negative occupancy", i)})
+				return
+			}
+			count.Occupancy = report.Occupancy
+		}
+		counts[i] = count
+	}
+
+	if err := requestDB(h.db, c).Create(&counts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store counts"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"stored": len(counts)})
+}
+
+// GetOccupancy returns occupancy per area over time for capacity dashboards.
+// An area's occupancy is the net of its lines (entries - exits, reset at
+// midnight and never below zero) plus the last reported headcount of each
+// of its zones.
+// Query: ?area= (repeatable, default all), ?from=&to= (default last 24h),
+// ?interval= (Go duration dividing 24h, default 1h), ?tz= (IANA zone for the midnight reset, default UTC).
+// Users with assigned areas only see those.
+func (h *CountingHandler) GetOccupancy(c *gin.Context) {
+	from, to, err := parseAnalyticsWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	interval := time.Hour
+	if raw := c.Query("interval"); raw != "" {
+		interval, err = time.ParseDuration(raw)
+		if err != nil || interval < 5*time.Minute || (24*time.Hour)%interval != 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be a duration of at least 5m that divides 24h"})
+			return
+		}
+	}
+	if to.Sub(from)/interval > maxOccupancyBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d intervals; use a longer interval", maxOccupancyBuckets)})
+		return
+	}
+	loc := time.UTC
+	if tz := c.Query("tz"); tz != "" {
+		parsed, err := time.LoadLocation(tz)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tz"})
+			return
+		}
+		loc = parsed
+	}
+
+	// Line nets reset at midnight, so counting starts at the start of from's day
+	local := from.In(loc)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).Truncate(interval)
+	bucket := fmt.Sprintf("to_timestamp(floor(extract(epoch FROM occurred_at) / %d) * %d)", int64(interval.Seconds()), int64(interval.Seconds()))
+
+	allowed, err := userAreas(h.db, c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	areas := c.QueryArray("area")
+	ctx := c.Request.Context()
+
+	// Only the caller's assigned areas; the count queries below are limited
+	// to what this returns
+	areaQuery := h.db.WithContext(ctx).Model(&models.CountingRule{}).
+		Scopes(database.InAreas(allowed)).Distinct("area").Order("area")
+	if len(areas) > 0 {
+		areaQuery = areaQuery.Where("area IN ?", areas)
+	}
+	var areaNames []string
+	if err := areaQuery.Pluck("area", &areaNames).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch areas"})
+		return
+	}
+
+	var lineRows []struct {
+		Area    string
+		Bucket  time.Time
+		Entries int64
+		Exits   int64
+	}
+	if err := h.db.WithContext(ctx).Model(&models.PeopleCount{}).
+		Select("area, "+bucket+" AS bucket, SUM(entries) AS entries, SUM(exits) AS exits").
+		Where("occupancy IS NULL AND area IN ? AND occurred_at >= ? AND occurred_at < ?", areaNames, dayStart, to).
+		Group("area, bucket").
+		Scan(&lineRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch people counts"})
+		return
+	}
+
+	// Last headcount of each zone per interval
+	var zoneRows []struct {
+		RuleID    uint
+		Area      string
+		Bucket    time.Time
+		Occupancy int64
+	}
+	if err := h.db.WithContext(ctx).Model(&models.PeopleCount{}).
+		Select("DISTINCT ON (rule_id, bucket) rule_id, area, "+bucket+" AS bucket, occupancy").
+		Where("occupancy IS NOT NULL AND area IN ? AND occurred_at >= ? AND occurred_at < ?", areaNames, dayStart, to).
+		Order("rule_id, bucket, occurred_at DESC").
+		Scan(&zoneRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch people counts"})
+		return
+	}
+
+	type lineTotals struct{ entries, exits int64 }
+	lines := make(map[string]map[int64]lineTotals)
+	for _, row := range lineRows {
+		if lines[row.Area] == nil {
+			lines[row.Area] = make(map[int64]lineTotals)
+		}
+		lines[row.Area][row.Bucket.Unix()] = lineTotals{row.Entries, row.Exits}
+	}
+	zones := make(map[string]map[uint]map[int64]int64) // area -> rule -> bucket -> headcount
+	for _, row := range zoneRows {
+		if zones[row.Area] == nil {
+			zones[row.Area] = make(map[uint]map[int64]int64)
+		}
+		if zones[row.Area][row.RuleID] == nil {
+			zones[row.Area][row.RuleID] = make(map[int64]int64)
+		}
+		zones[row.Area][row.RuleID][row.Bucket.Unix()] = row.Occupancy
+	}
+
+	result := make([]AreaOccupancy, 0, len(areaNames))
+	for _, area := range areaNames {
+		series := AreaOccupancy{Area: area, Points: []OccupancyPoint{}}
+		var net int64
+		lastZone := make(map[uint]int64)
+		var day time.Time
+		for t := dayStart; t.Before(to); t = t.Add(interval) {
+			local := t.In(loc)
+			if today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc); !today.Equal(day) {
+				day = today
+				net = 0
+				lastZone = make(map[uint]int64)
+			}
+
+			totals := lines[area][t.Unix()]
+			net += totals.entries - totals.exits
+			if net < 0 {
+				net = 0
+			}
+			occupancy := net
+			for ruleID, buckets := range zones[area] {
+				if headcount, ok := buckets[t.Unix()]; ok {
+					lastZone[ruleID] = headcount
+				}
+				occupancy += lastZone[ruleID]
+			}
+
+			if t.Add(interval).After(from) {
+				series.Points = append(series.Points, OccupancyPoint{
+					Time:      t,
+					Entries:   totals.entries,
+					Exits:     totals.exits,
+					Occupancy: occupancy,
+				})
+				if occupancy > series.Peak {
+					series.Peak = occupancy
+				}
+				series.Current = occupancy
+			}
+		}
+		result = append(result, series)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":     from,
+		"to":       to,
+		"interval": interval.String(),
+		"areas":    result,
+	})
+}
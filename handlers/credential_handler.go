@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CredentialHandler struct {
+	db          *gorm.DB
+	credentials *services.CredentialService
+	cameras     *CameraHandler
+}
+
+func NewCredentialHandler(db *gorm.DB, credentials *services.CredentialService, cameras *CameraHandler) *CredentialHandler {
+	return &CredentialHandler{
+		db:          db,
+		credentials: credentials,
+		cameras:     cameras,
+	}
+}
+
+type CreateCredentialRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Notes    string `json:"notes"`
+}
+
+type UpdateCredentialRequest struct {
+	Name     *string `json:"name"`
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	Notes    *string `json:"notes"`
+}
+
+// CredentialResponse is a credential (without its password) and how many
+// cameras use it
+type CredentialResponse struct {
+	models.Credential
+	CameraCount int64 `json:"camera_count"`
+}
+
+func (h *CredentialHandler) ListCredentials(c *gin.Context) {
+	var credentials []models.Credential
+	if err := requestDB(h.db, c).Order("name").Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credentials"})
+		return
+	}
+
+	var rows []struct {
+		CredentialID uint
+		Count        int64
+	}
+	if err := requestDB(h.db, c).Model(&models.Camera{}).
+		Select("credential_id, COUNT(*) AS count").
+		Where("credential_id IS NOT NULL").
+		Group("credential_id").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count cameras"})
+		return
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.CredentialID] = row.Count
+	}
+
+	response := make([]CredentialResponse, len(credentials))
+	for i, credential := range credentials {
+		response[i] = CredentialResponse{Credential: credential, CameraCount: counts[credential.ID]}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *CredentialHandler) CreateCredential(c *gin.Context) {
+	var req CreateCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	encrypted, err := h.credentials.EncryptPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt password"})
+		return
+	}
+
+	credential := models.Credential{
+		Name:              req.Name,
+		Username:          req.Username,
+		PasswordEncrypted: encrypted,
+		Notes:             req.Notes,
+	}
+	if err := requestDB(h.db, c).Create(&credential).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create credential"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "credential", fmt.Sprint(credential.ID), credential.Name)
+
+	c.JSON(http.StatusCreated, CredentialResponse{Credential: credential})
+}
+
+// UpdateCredential edits a credential. Changing the username or password
+// rotates it for every camera that uses it; HLS paths already configured in
+// MediaMTX are re-pushed with the new credentials.
+func (h *CredentialHandler) UpdateCredential(c *gin.Context) {
+	var req UpdateCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var credential models.Credential
+	if err := requestDB(h.db, c).First(&credential, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Credential not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credential"})
+		return
+	}
+
+	rotated := false
+	if req.Name != nil {
+		credential.Name = *req.Name
+	}
+	if req.Notes != nil {
+		credential.Notes = *req.Notes
+	}
+	if req.Username != nil && *req.Username != credential.Username {
+		credential.Username = *req.Username
+		rotated = true
+	}
+	if req.Password != nil {
+		encrypted, err := h.credentials.EncryptPassword(*req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt password"})
+			return
+		}
+		credential.PasswordEncrypted = encrypted
+		rotated = true
+	}
+	if rotated {
+		now := time.Now()
+		credential.RotatedAt = &now
+	}
+
+	if err := requestDB(h.db, c).Save(&credential).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update credential"})
+		return
+	}
+
+	refreshed := 0
+	if rotated {
+		h.credentials.Invalidate(credential.ID)
+		refreshed = h.refreshStreams(credential.ID)
+		recordAudit(h.db, c, "rotate", "credential", fmt.Sprint(credential.ID), credential.Name)
+	} else {
+		recordAudit(h.db, c, "update", "credential", fmt.Sprint(credential.ID), credential.Name)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credential":        credential,
+		"rotated":           rotated,
+		"refreshed_cameras": refreshed,
+	})
+}
+
+// refreshStreams restarts every pipeline still pulling a camera that uses
+// a credential, so they reconnect with the rotated one. Returns how many
+// cameras had streams running.
+func (h *CredentialHandler) refreshStreams(credentialID uint) int {
+	var cameras []models.Camera
+	if err := h.db.Where("credential_id = ?", credentialID).Find(&cameras).Error; err != nil {
+		fmt.Printf("[Vault] Failed to load cameras for credential %d: %v\n", credentialID, err)
+		return 0
+	}
+
+	refreshed := 0
+	for i := range cameras {
+		if len(h.cameras.reconnectStreams(&cameras[i])) > 0 {
+			refreshed++
+		}
+	}
+	return refreshed
+}
+
+func (h *CredentialHandler) DeleteCredential(c *gin.Context) {
+	var credential models.Credential
+	if err := requestDB(h.db, c).First(&credential, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Credential not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credential"})
+		return
+	}
+
+	var inUse int64
+	if err := requestDB(h.db, c).Model(&models.Camera{}).Where("credential_id = ?", credential.ID).Count(&inUse).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check credential usage"})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Credential is used by %d cameras", inUse)})
+		return
+	}
+
+	if err := requestDB(h.db, c).Delete(&credential).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete credential"})
+		return
+	}
+	h.credentials.Invalidate(credential.ID)
+
+	recordAudit(h.db, c, "delete", "credential", fmt.Sprint(credential.ID), credential.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Credential deleted successfully"})
+}
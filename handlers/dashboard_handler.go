@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const dashboardRecentEvents = 20
+
+type DashboardHandler struct {
+	db       *gorm.DB
+	statuses *services.CameraStatusService
+
+	// Stats of every area, shared by all walls polling them
+	areaStats   []AreaStats
+	areaStatsAt time.Time
+	areaStatsMu sync.Mutex
+}
+
+func NewDashboardHandler(db *gorm.DB, statuses *services.CameraStatusService) *DashboardHandler {
+	return &DashboardHandler{
+		db:       db,
+		statuses: statuses,
+	}
+}
+
+// DashboardCameraCounts summarizes the cameras on a dashboard. Online and
+// offline only count cameras in monitored statuses; cameras awaiting
+// install or decommissioned are only in ByStatus.
+type DashboardCameraCounts struct {
+	Total    int            `json:"total"`
+	Online   int            `json:"online"`
+	Offline  int            `json:"offline"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// dashboardAreas returns the areas a user's dashboard is scoped to. Admins
+// without assigned areas see everything (nil); other users without assigned
+// areas see nothing.
+func dashboardAreas(user *models.User) []string {
+	areas := user.Areas()
+	if areas == nil && user.Role != "admin" {
+		return []string{}
+	}
+	return areas
+}
+
+// GetMyDashboard returns the cameras, recent events and alert counts of the
+// current operator's assigned areas
+// Query: ?from=&to= (default: last 24h)
+func (h *DashboardHandler) GetMyDashboard(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	from, to, err := parseAnalyticsWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := requestDB(h.db, c).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	areas := dashboardAreas(&user)
+
+	cameras := []models.Camera{}
+	if err := requestDB(h.db, c).Scopes(database.InAreas(areas)).Order("area, name").Find(&cameras).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+		return
+	}
+
+	counts := DashboardCameraCounts{Total: len(cameras), ByStatus: make(map[string]int)}
+	cameraIDs := make([]uint, len(cameras))
+	for i, camera := range cameras {
+		cameraIDs[i] = camera.ID
+		counts.ByStatus[camera.Status]++
+		if camera.Status == models.CameraStatusOnline {
+			counts.Online++
+		} else if h.statuses.Monitored(camera.Status) {
+			counts.Offline++
+		}
+	}
+
+	// Unscoped admins also see system events that have no camera
+	eventScope := func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(database.TimeRange("occurred_at", &from, &to))
+		if areas == nil {
+			return db
+		}
+		return db.Where("camera_id IN ?", cameraIDs)
+	}
+
+	recentEvents := []models.Event{}
+	if err := requestDB(h.db, c).Scopes(eventScope, database.NewestFirst("occurred_at")).
+		Limit(dashboardRecentEvents).Find(&recentEvents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+
+	var severityRows []struct {
+		Severity string
+		Count    int64
+	}
+	if err := requestDB(h.db, c).Model(&models.Event{}).Scopes(eventScope).
+		Select("severity, COUNT(*) AS count").Group("severity").
+		Scan(&severityRows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count alerts"})
+		return
+	}
+	alertCounts := map[string]int64{"info": 0, "warning": 0, "critical": 0}
+	for _, row := range severityRows {
+		alertCounts[row.Severity] = row.Count
+	}
+
+	var openIncidents int64
+	incidents := requestDB(h.db, c).Model(&models.Incident{}).Where("status = ?", "open")
+	if areas != nil {
+		incidents = incidents.Where("camera_id IN ? OR area IN ?", cameraIDs, areas)
+	}
+	if err := incidents.Count(&openIncidents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count incidents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"areas":          areas,
+		"from":           from,
+		"to":             to,
+		"cameras":        cameras,
+		"camera_counts":  counts,
+		"statuses":       h.statuses.List(),
+		"alert_counts":   alertCounts,
+		"open_incidents": openIncidents,
+		"recent_events":  recentEvents,
+	})
+}
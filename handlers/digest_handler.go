@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type DigestHandler struct {
+	db     *gorm.DB
+	digest *services.DigestService
+}
+
+func NewDigestHandler(db *gorm.DB, digest *services.DigestService) *DigestHandler {
+	return &DigestHandler{
+		db:     db,
+		digest: digest,
+	}
+}
+
+type CreateDigestTemplateRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Subject string `json:"subject" binding:"required"`
+	Body    string `json:"body" binding:"required"`
+	HTML    bool   `json:"html"`
+	Active  bool   `json:"active"`
+}
+
+type UpdateDigestTemplateRequest struct {
+	Name    *string `json:"name"`
+	Subject *string `json:"subject"`
+	Body    *string `json:"body"`
+	HTML    *bool   `json:"html"`
+	Active  *bool   `json:"active"`
+}
+
+// sampleDigest is what templates are test-rendered with before saving
+func sampleDigest() *services.DigestData {
+	cameraID := uint(1)
+	to := time.Now()
+	return &services.DigestData{
+		Recipient:   "Sample Manager",
+		From:        to.Add(-13 * time.Hour),
+		To:          to,
+		TotalEvents: 12,
+		Areas: []services.AreaDigest{{
+			Area:            "Lobby",
+			Cameras:         4,
+			TotalEvents:     12,
+			EventCounts:     map[string]int64{"info": 8, "warning": 3, "critical": 1},
+			TopCameras:      []services.DigestCamera{{ID: cameraID, Name: "Lobby Entrance", Events: 7}},
+			Downtime:        []services.DigestDowntime{{ID: cameraID, Name: "Lobby Entrance", Minutes: 42}},
+			DowntimeMinutes: 42,
+			UnresolvedIncidents: []models.Incident{{
+				ID: 1, Title: "Door forced open", Severity: "critical", Status: "open", CameraID: &cameraID, Area: "Lobby",
+			}},
+		}},
+	}
+}
+
+// saveDigestTemplate saves a template, deactivating the others when it is
+// the active one
+func (h *DigestHandler) saveDigestTemplate(tpl *models.DigestTemplate) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if tpl.Active {
+			if err := tx.Model(&models.DigestTemplate{}).
+				Where("active = ? AND id <> ?", true, tpl.ID).
+				Update("active", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(tpl).Error
+	})
+}
+
+func (h *DigestHandler) ListDigestTemplates(c *gin.Context) {
+	var templates []models.DigestTemplate
+	if err := requestDB(h.db, c).Order("name").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch digest templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"default":   services.DefaultDigestTemplate,
+	})
+}
+
+func (h *DigestHandler) CreateDigestTemplate(c *gin.Context) {
+	var req CreateDigestTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tpl := models.DigestTemplate{
+		Name:    req.Name,
+		Subject: req.Subject,
+		Body:    req.Body,
+		HTML:    req.HTML,
+		Active:  req.Active,
+	}
+	if _, _, err := services.RenderDigest(&tpl, sampleDigest()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.saveDigestTemplate(&tpl); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create digest template"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "digest_template", fmt.Sprint(tpl.ID), tpl.Name)
+
+	c.JSON(http.StatusCreated, tpl)
+}
+
+func (h *DigestHandler) UpdateDigestTemplate(c *gin.Context) {
+	var req UpdateDigestTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tpl models.DigestTemplate
+	if err := requestDB(h.db, c).First(&tpl, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Digest template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch digest template"})
+		return
+	}
+
+	if req.Name != nil {
+		tpl.Name = *req.Name
+	}
+	if req.Subject != nil {
+		tpl.Subject = *req.Subject
+	}
+	if req.Body != nil {
+		tpl.Body = *req.Body
+	}
+	if req.HTML != nil {
+		tpl.HTML = *req.HTML
+	}
+	if req.Active != nil {
+		tpl.Active = *req.Active
+	}
+	if _, _, err := services.RenderDigest(&tpl, sampleDigest()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.saveDigestTemplate(&tpl); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update digest template"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "digest_template", fmt.Sprint(tpl.ID), tpl.Name)
+
+	c.JSON(http.StatusOK, tpl)
+}
+
+func (h *DigestHandler) DeleteDigestTemplate(c *gin.Context) {
+	var tpl models.DigestTemplate
+	if err := requestDB(h.db, c).First(&tpl, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Digest template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch digest template"})
+		return
+	}
+
+	if err := requestDB(h.db, c).Delete(&tpl).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete digest template"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "digest_template", fmt.Sprint(tpl.ID), tpl.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Digest template deleted successfully"})
+}
+
+// PreviewDigest renders the digest the current user would receive
+// Query: ?to= (default: now), ?template_id= (default: the active template)
+func (h *DigestHandler) PreviewDigest(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	end := time.Now()
+	if to != nil {
+		end = *to
+	}
+
+	var user models.User
+	if err := requestDB(h.db, c).First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var tpl *models.DigestTemplate
+	if templateID := c.Query("template_id"); templateID != "" {
+		var stored models.DigestTemplate
+		if err := requestDB(h.db, c).First(&stored, templateID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Digest template not found"})
+			return
+		}
+		tpl = &stored
+	} else if tpl, err = h.digest.ActiveTemplate(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch digest template"})
+		return
+	}
+
+	data, err := h.digest.Build(h.digest.WindowFor(end), end, services.DigestAreas(&user))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build digest"})
+		return
+	}
+	data.Recipient = user.Name
+
+	subject, body, err := services.RenderDigest(tpl, data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"template": tpl.Name,
+		"subject":  subject,
+		"body":     body,
+		"html":     tpl.HTML,
+		"data":     data,
+	})
+}
+
+// SendDigest sends the digest to every recipient now, for the window ending now
+func (h *DigestHandler) SendDigest(c *gin.Context) {
+	sent, failed := h.digest.SendDigests(time.Now())
+
+	recordAudit(h.db, c, "send", "digest", "", fmt.Sprintf("sent %d, failed %d", sent, len(failed)))
+
+	status := http.StatusOK
+	if len(failed) > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{
+		"sent":   sent,
+		"failed": failed,
+	})
+}
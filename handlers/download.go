@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadLink is a pre-signed URL of a file download, usable without the
+// Authorization header until it expires, so download managers can resume
+// it after the access token has expired
+type DownloadLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// serveDownload sends a file as an attachment with Range support. The
+// ETag and Last-Modified let a client resume an interrupted download with
+// If-Range and get the rest of the same file, or all of it if it changed.
+func serveDownload(c *gin.Context, path, name string) {
+	file, err := os.Open(path)
+	if err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "File is no longer available"})
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "File is no longer available"})
+		return
+	}
+
+	c.Header("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Header("Cache-Control", "private")
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+}
+
+// startsDownload reports whether a request starts a download rather than
+// probing it (HEAD) or resuming it with a Range, so a download is audited
+// once however many times it was resumed
+func startsDownload(c *gin.Context) bool {
+	if c.Request.Method == http.MethodHead {
+		return false
+	}
+	rangeHeader := c.GetHeader("Range")
+	return rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-")
+}
+
+// Kinds of pre-signed downloads
+const (
+	downloadExport       = "export"
+	downloadRecording    = "recording"
+	downloadRetainedClip = "retained_clip"
+)
+
+// RequireDownloadToken authorizes the pre-signed download routes of a kind:
+// the token must be signed for the file requested, by a user who still
+// exists and is logged in somewhere, so deleting the user or revoking their
+// sessions cuts their links off too. The signing user is set as the current
+// user, so the download is audited as theirs.
+func RequireDownloadToken(tokens *services.StreamTokenService, sessions *services.SessionService, kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tokens.Enabled() {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Pre-signed downloads are disabled"})
+			return
+		}
+		scope, ok := downloadScopeOf(c, kind)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+
+		token := c.Query("token")
+		switch err := tokens.Validate(scope, token, c.ClientIP()); err {
+		case nil:
+		case services.ErrStreamTokenBlocked:
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		case services.ErrStreamTokenExpired:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Download link has expired"})
+			return
+		default:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid download link"})
+			return
+		}
+		userID := tokens.TokenUser(token)
+		if !sessions.UserActive(userID) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Download link is no longer valid"})
+			return
+		}
+		c.Set("user_id", userID)
+		c.Set("signed_download", true)
+	}
+}
+
+// downloadScopeOf is the token scope of a pre-signed download route: :id
+// is the export, or the camera of a recording or retained clip
+func downloadScopeOf(c *gin.Context, kind string) (string, bool) {
+	param := map[string]string{downloadRecording: "recordingId", downloadRetainedClip: "clipId"}[kind]
+	if param == "" {
+		param = "id"
+	}
+	id, err := strconv.ParseUint(c.Param(param), 10, 64)
+	if err != nil {
+		return "", false
+	}
+	if kind == downloadExport {
+		return downloadScope(kind, 0, uint(id)), true
+	}
+	cameraID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return downloadScope(kind, uint(cameraID), uint(id)), true
+}
+
+// downloadScope is what a download link is signed for: a file of a camera,
+// or an export (cameraID 0)
+func downloadScope(kind string, cameraID, id uint) string {
+	return fmt.Sprintf("download/%s/%d/%d", kind, cameraID, id)
+}
+
+// signedDownloadURL returns a pre-signed link to path (relative to prefix,
+// the API base, e.g. /api/v1) for userID
+func signedDownloadURL(tokens *services.StreamTokenService, prefix, path, scope string, userID uint) DownloadLink {
+	token, expires := tokens.Token(scope, userID)
+	return DownloadLink{
+		URL:       fmt.Sprintf("%s/signed%s?token=%s", prefix, path, url.QueryEscape(token)),
+		ExpiresAt: expires,
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type EventHandler struct {
+	db     *gorm.DB
+	tokens *services.StreamTokenService
+	feed   *services.LiveFeed
+}
+
+func NewEventHandler(db *gorm.DB, streamTokens *services.StreamTokenService, feed *services.LiveFeed) *EventHandler {
+	return &EventHandler{
+		db:     db,
+		tokens: streamTokens,
+		feed:   feed,
+	}
+}
+
+// ListEvents returns events newest first using cursor pagination
+// Query: ?after=&limit=&camera_id=&type=&severity=&from=&to=&alerts=&weather=
+// alerts=true leaves out events an alert rule suppressed, for notification
+// feeds; weather=rain (fog, snow, clear) keeps events with that condition.
+func (h *EventHandler) ListEvents(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.Event{}).
+		Scopes(database.ForCamera(cameraID), database.TimeRange("occurred_at", from, to))
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	if c.Query("alerts") == "true" {
+		query = query.Where("suppressed IS NULL OR suppressed = ''")
+	}
+	if weather := c.Query("weather"); weather != "" {
+		query = query.Where("? = ANY(string_to_array(weather, ','))", weather)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("occurred_at", cursor.Time, cursor.ID))
+	}
+
+	var events []models.Event
+	if err := query.Scopes(database.NewestFirst("occurred_at")).Limit(limit + 1).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(events, limit, func(e models.Event) (time.Time, uint) {
+		return e.OccurredAt, e.ID
+	}))
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Footage around an event covered by its playback link
+const (
+	eventClipPreRoll  = 10 * time.Second
+	eventClipPostRoll = 20 * time.Second
+)
+
+// EventMedia locates an event in the recordings of its camera
+type EventMedia struct {
+	EventID       uint      `json:"event_id"`
+	CameraID      uint      `json:"camera_id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	RecordingID   uint      `json:"recording_id"`
+	OffsetSeconds float64   `json:"offset_seconds"` // Into the recording file
+	From          time.Time `json:"from"`           // Range of the playback playlist
+	To            time.Time `json:"to"`
+	// Where the event is in the playlist, whose timeline leaves out gaps
+	PlaylistOffsetSeconds float64    `json:"playlist_offset_seconds"`
+	PlaybackURL           string     `json:"playback_url"`
+	PlaybackURLExpiresAt  *time.Time `json:"playback_url_expires_at,omitempty"` // Not set when the URL needs the Authorization header
+}
+
+// GetEventMedia resolves an event to its footage: the recording and offset
+// it happened at and a playback URL around it. /events/:id/media never
+// changes, so alert emails and push payloads only need to carry it; the
+// playback URL is pre-signed when stream tokens are enabled, otherwise it
+// needs the Authorization header like any other API call.
+func (h *EventHandler) GetEventMedia(c *gin.Context) {
+	var event models.Event
+	if err := requestDB(h.db, c).First(&event, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch event"})
+		return
+	}
+	if event.CameraID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event has no camera", "reason": "no_camera"})
+		return
+	}
+
+	media := EventMedia{
+		EventID:    event.ID,
+		CameraID:   *event.CameraID,
+		OccurredAt: event.OccurredAt,
+		From:       event.OccurredAt.Add(-eventClipPreRoll).Truncate(time.Second),
+		To:         event.OccurredAt.Add(eventClipPostRoll).Truncate(time.Second).Add(time.Second),
+	}
+
+	searchFrom := media.From.Add(-maxRecordingSpan)
+	var recordings []models.Recording
+	if err := requestDB(h.db, c).Scopes(database.ForCamera(media.CameraID), database.TimeRange("start_time", &searchFrom, &media.To)).
+		Where("status NOT IN ? AND (end_time IS NULL OR end_time > ?)", []string{"failed", "quarantined"}, media.From).
+		Scopes(database.OldestFirst("start_time")).
+		Find(&recordings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recordings"})
+		return
+	}
+
+	var containing *models.Recording
+	for i := range recordings {
+		r := &recordings[i]
+		if !r.StartTime.After(event.OccurredAt) && (r.EndTime == nil || r.EndTime.After(event.OccurredAt)) {
+			containing = r
+			break
+		}
+	}
+	if containing == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No recording covers this event", "reason": "not_recorded"})
+		return
+	}
+	if containing.Status != "completed" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The recording of this event is still being written; try again in a few minutes", "reason": "recording_in_progress"})
+		return
+	}
+	media.RecordingID = containing.ID
+	media.OffsetSeconds = event.OccurredAt.Sub(containing.StartTime).Seconds()
+
+	for _, piece := range playbackPieces(recordings, media.From, media.To) {
+		if piece.End.After(event.OccurredAt) {
+			if event.OccurredAt.After(piece.Start) {
+				media.PlaylistOffsetSeconds += event.OccurredAt.Sub(piece.Start).Seconds()
+			}
+			break
+		}
+		media.PlaylistOffsetSeconds += piece.End.Sub(piece.Start).Seconds()
+	}
+
+	// Same API version as the request: /api/v1/events/:id/media -> /api/v1
+	prefix := strings.TrimSuffix(c.FullPath(), "/events/:id/media")
+	if userID := currentUserID(c); h.tokens.Enabled() && userID != nil {
+		playbackURL, expires := signedPlaybackURL(h.tokens, prefix, media.CameraID, media.From, media.To, *userID)
+		media.PlaybackURL = playbackURL
+		media.PlaybackURLExpiresAt = &expires
+	} else {
+		media.PlaybackURL = playbackURL(prefix, media.CameraID, media.From, media.To)
+	}
+
+	c.JSON(http.StatusOK, media)
+}
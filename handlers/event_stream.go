@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	liveHeartbeat   = 25 * time.Second // Keeps idle connections open through proxies
+	liveAreaRefresh = time.Minute      // How often a scoped client's cameras are reloaded
+)
+
+// liveScope limits a client to the messages of cameras in its user's
+// assigned areas. Messages of no camera are left out, as for other data
+// without a camera only users reaching every area see. The cameras are
+// reloaded every liveAreaRefresh, so cameras moved between areas are
+// picked up without reconnecting.
+type liveScope struct {
+	db       *gorm.DB
+	areas    []string
+	cameras  map[uint]bool
+	loadedAt time.Time
+}
+
+// newLiveScope returns the scope of a user's areas, nil for all
+func newLiveScope(db *gorm.DB, areas []string) (*liveScope, error) {
+	if areas == nil {
+		return nil, nil
+	}
+	scope := &liveScope{db: db, areas: areas}
+	if err := scope.load(); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+func (s *liveScope) load() error {
+	var ids []uint
+	if err := s.db.Model(&models.Camera{}).Scopes(database.InAreas(s.areas)).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	s.cameras = make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		s.cameras[id] = true
+	}
+	s.loadedAt = time.Now()
+	return nil
+}
+
+func (s *liveScope) allows(msg *services.LiveMessage) bool {
+	if s == nil {
+		return true
+	}
+	if time.Since(s.loadedAt) > liveAreaRefresh {
+		if err := s.load(); err != nil {
+			// Keeps the cameras loaded last; retried on the next message
+			fmt.Printf("[LiveFeed] Failed to reload cameras of the client's areas: %v\n", err)
+		}
+	}
+	return msg.CameraID != 0 && s.cameras[msg.CameraID]
+}
+
+var liveMessageTypes = map[string]bool{
+	services.LiveCameraStatus: true,
+	services.LiveStreamHealth: true,
+	services.LiveEvent:        true,
+	services.LiveAlert:        true,
+	services.LiveIntercomCall: true,
+}
+
+// StreamEvents pushes camera status changes, stream health transitions,
+// events and alerts as they happen, over WebSocket when the request is an
+// upgrade and as Server-Sent Events otherwise. A "resync" message is sent
+// first when the client's Last-Event-ID is too old to replay what it
+// missed, so it reloads its state. Users with assigned areas only get the
+// messages of cameras in those areas.
+// Query: ?types=camera_status,stream_health,event,alert,intercom_call&camera_ids=1,2&last_event_id=
+func (h *EventHandler) StreamEvents(c *gin.Context) {
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	filter := services.LiveFilter{Types: make(map[string]bool), CameraIDs: make(map[uint]bool)}
+	for _, msgType := range strings.Split(c.Query("types"), ",") {
+		if msgType = strings.TrimSpace(msgType); msgType == "" {
+			continue
+		}
+		if !liveMessageTypes[msgType] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown type %q", msgType)})
+			return
+		}
+		filter.Types[msgType] = true
+	}
+	cameraIDs, err := parseIDList(c.Query("camera_ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, id := range cameraIDs {
+		filter.CameraIDs[id] = true
+	}
+
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	var after uint64
+	if lastID != "" {
+		if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid last_event_id"})
+			return
+		}
+	}
+
+	areas, err := userAreas(h.db, c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	scope, err := newLiveScope(h.db, areas)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			fmt.Printf("[LiveFeed] WebSocket upgrade failed: %v\n", err)
+			return
+		}
+		h.streamWebSocket(conn, filter, scope, after)
+		return
+	}
+	h.streamSSE(c, filter, scope, after)
+}
+
+func (h *EventHandler) streamSSE(c *gin.Context, filter services.LiveFilter, scope *liveScope, after uint64) {
+	sub, resumed := h.feed.Subscribe(filter, after)
+	defer h.feed.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // nginx would hold the stream back
+	c.Status(http.StatusOK)
+	if !resumed {
+		fmt.Fprint(c.Writer, "event: resync\ndata: {}\n\n")
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case msg := <-sub.C:
+			if !scope.allows(&msg) {
+				continue
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, data)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		case <-sub.Dropped:
+			return // The client reconnects with Last-Event-ID and catches up
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *EventHandler) streamWebSocket(conn *websocket.Conn, filter services.LiveFilter, scope *liveScope, after uint64) {
+	defer conn.Close()
+	sub, resumed := h.feed.Subscribe(filter, after)
+	defer h.feed.Unsubscribe(sub)
+
+	if !resumed {
+		if err := conn.WriteJSON(gin.H{"type": "resync"}); err != nil {
+			return
+		}
+	}
+
+	// Reads only detect the client going away; clients don't send anything
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case msg := <-sub.C:
+			if !scope.allows(&msg) {
+				continue
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case <-sub.Dropped:
+			return
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxCompositeCameras  = 4
+	maxCompositeDuration = 2 * time.Hour
+
+	maxSpeedExportRange  = 12 * time.Hour // Recorded time a speed export covers
+	maxSpeedExportOutput = 2 * time.Hour  // Length of the rendered video
+
+	maxClipDuration = 2 * time.Hour
+)
+
+// speedExportRates are the playback speeds a speed export can be rendered at
+var speedExportRates = []float64{0.25, 0.5, 1, 2, 4, 8, 16}
+
+type ExportHandler struct {
+	db      *gorm.DB
+	exports *services.ExportService
+	tokens  *services.StreamTokenService
+}
+
+func NewExportHandler(db *gorm.DB, exports *services.ExportService, tokens *services.StreamTokenService) *ExportHandler {
+	return &ExportHandler{
+		db:      db,
+		exports: exports,
+		tokens:  tokens,
+	}
+}
+
+type CreateCompositeExportRequest struct {
+	CameraIDs []uint    `json:"camera_ids" binding:"required"`
+	From      time.Time `json:"from" binding:"required"`
+	To        time.Time `json:"to" binding:"required"`
+}
+
+// CreateCompositeExport queues a 2x2 composite MP4 of up to four cameras
+// over the same time range, e.g. to present an incident from every angle
+func (h *ExportHandler) CreateCompositeExport(c *gin.Context) {
+	var req CreateCompositeExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.CameraIDs) == 0 || len(req.CameraIDs) > maxCompositeCameras {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("camera_ids must list 1 to %d cameras", maxCompositeCameras)})
+		return
+	}
+	if !req.To.After(req.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+	if req.To.Sub(req.From) > maxCompositeDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("range is limited to %s", maxCompositeDuration)})
+		return
+	}
+	var count int64
+	if err := requestDB(h.db, c).Model(&models.Camera{}).Where("id IN ?", req.CameraIDs).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check cameras"})
+		return
+	}
+	if int(count) != len(req.CameraIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "camera_ids contains unknown or duplicate cameras"})
+		return
+	}
+
+	ids := make([]string, len(req.CameraIDs))
+	for i, id := range req.CameraIDs {
+		ids[i] = fmt.Sprint(id)
+	}
+	job := models.ExportJob{
+		UserID:    currentUserID(c),
+		Kind:      models.ExportComposite,
+		CameraIDs: strings.Join(ids, ","),
+		From:      req.From,
+		To:        req.To,
+		Format:    models.ExportMP4,
+	}
+	if err := h.exports.Enqueue(&job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue export"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "export", fmt.Sprint(job.ID), fmt.Sprintf("composite of cameras %s, %s to %s",
+		job.CameraIDs, job.From.Format(time.RFC3339), job.To.Format(time.RFC3339)))
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+type CreateSpeedExportRequest struct {
+	CameraID uint      `json:"camera_id" binding:"required"`
+	From     time.Time `json:"from" binding:"required"`
+	To       time.Time `json:"to" binding:"required"`
+	Speed    float64   `json:"speed" binding:"required"`
+	Format   string    `json:"format"` // mp4 (default) or hls
+}
+
+// CreateSpeedExport queues a camera's footage rendered faster or slower
+// than real time, so a low-power client can skim hours of recordings as a
+// short, small video instead of downloading them
+func (h *ExportHandler) CreateSpeedExport(c *gin.Context) {
+	var req CreateSpeedExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validSpeedExportRate(req.Speed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "speed must be one of 0.25, 0.5, 1, 2, 4, 8, 16"})
+		return
+	}
+	if req.Format == "" {
+		req.Format = models.ExportMP4
+	}
+	if req.Format != models.ExportMP4 && req.Format != models.ExportHLS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be mp4 or hls"})
+		return
+	}
+	if !req.To.After(req.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+	span := req.To.Sub(req.From)
+	if span > maxSpeedExportRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("range is limited to %s", maxSpeedExportRange)})
+		return
+	}
+	if time.Duration(float64(span)/req.Speed) > maxSpeedExportOutput {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at %gx the export would be longer than %s; use a higher speed or a shorter range",
+			req.Speed, maxSpeedExportOutput)})
+		return
+	}
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id").First(&camera, req.CameraID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check camera"})
+		return
+	}
+
+	job := models.ExportJob{
+		UserID:    currentUserID(c),
+		Kind:      models.ExportSpeed,
+		CameraIDs: fmt.Sprint(camera.ID),
+		From:      req.From,
+		To:        req.To,
+		Speed:     req.Speed,
+		Format:    req.Format,
+	}
+	if err := h.exports.Enqueue(&job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue export"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "export", fmt.Sprint(job.ID), fmt.Sprintf("%gx %s of camera %d, %s to %s",
+		job.Speed, job.Format, camera.ID, job.From.Format(time.RFC3339), job.To.Format(time.RFC3339)))
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func validSpeedExportRate(speed float64) bool {
+	for _, rate := range speedExportRates {
+		if speed == rate {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateClipRequest struct {
+	From time.Time `json:"from" binding:"required"`
+	To   time.Time `json:"to" binding:"required"`
+}
+
+// ClipExportResponse is a queued clip export and where to download it once
+// it is completed
+type ClipExportResponse struct {
+	models.ExportJob
+	DownloadURL string `json:"download_url"`
+}
+
+// CreateClipExport queues an MP4 clip of the camera in the path between
+// two times, cut from its recordings without re-encoding
+func (h *ExportHandler) CreateClipExport(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id", "name").First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+	var req CreateClipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.To.After(req.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+	if req.To.Sub(req.From) > maxClipDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("clips are limited to %s", maxClipDuration)})
+		return
+	}
+
+	job := models.ExportJob{
+		UserID:    currentUserID(c),
+		Kind:      models.ExportClip,
+		CameraIDs: fmt.Sprint(camera.ID),
+		From:      req.From,
+		To:        req.To,
+		Format:    models.ExportMP4,
+	}
+	if err := h.exports.Enqueue(&job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue clip"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "export", fmt.Sprint(job.ID), fmt.Sprintf("clip of %s, %s to %s",
+		camera.Name, job.From.Format(time.RFC3339), job.To.Format(time.RFC3339)))
+
+	// Same API version as the request: /api/v1/cameras/:id/clips -> /api/v1
+	prefix := strings.TrimSuffix(c.FullPath(), "/cameras/:id/clips")
+	c.JSON(http.StatusAccepted, ClipExportResponse{
+		ExportJob:   job,
+		DownloadURL: fmt.Sprintf("%s/exports/%d/download", prefix, job.ID),
+	})
+}
+
+// ListExports returns the current user's export jobs, newest first
+func (h *ExportHandler) ListExports(c *gin.Context) {
+	var jobs []models.ExportJob
+	if err := requestDB(h.db, c).Where("user_id = ?", currentUserID(c)).Order("id DESC").Limit(50).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exports"})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	job, ok := h.findExport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// DownloadExport sends the rendered file of a completed export. Range
+// requests resume an interrupted download; only its start is audited.
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	job, ok := h.findDownloadableExport(c)
+	if !ok {
+		return
+	}
+
+	if startsDownload(c) {
+		recordAudit(h.db, c, "download", "export", fmt.Sprint(job.ID), job.CameraIDs)
+	}
+
+	serveDownload(c, job.FilePath, filepath.Base(job.FilePath))
+}
+
+// CreateExportDownloadLink returns a pre-signed link to download a
+// completed export, valid for STREAM_TOKEN_TTL
+func (h *ExportHandler) CreateExportDownloadLink(c *gin.Context) {
+	userID := currentUserID(c)
+	if !h.tokens.Enabled() || userID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pre-signed downloads are disabled"})
+		return
+	}
+	job, ok := h.findDownloadableExport(c)
+	if !ok {
+		return
+	}
+
+	prefix := strings.TrimSuffix(c.FullPath(), "/exports/:id/download-link")
+	path := fmt.Sprintf("/exports/%d/download", job.ID)
+	c.JSON(http.StatusOK, signedDownloadURL(h.tokens, prefix, path, downloadScope(downloadExport, 0, job.ID), *userID))
+}
+
+// findDownloadableExport is findCompletedExport for a file export
+func (h *ExportHandler) findDownloadableExport(c *gin.Context) (*models.ExportJob, bool) {
+	job, ok := h.findCompletedExport(c)
+	if !ok {
+		return nil, false
+	}
+	if job.Format == models.ExportHLS {
+		c.JSON(http.StatusConflict, gin.H{"error": "HLS exports are played from /hls/index.m3u8"})
+		return nil, false
+	}
+	return job, true
+}
+
+// ServeExportHLS serves the playlist and segments of a completed HLS
+// export. Only the playlist request is audited.
+func (h *ExportHandler) ServeExportHLS(c *gin.Context) {
+	job, ok := h.findCompletedExport(c)
+	if !ok {
+		return
+	}
+	if job.Format != models.ExportHLS {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export is not HLS"})
+		return
+	}
+	file := filepath.Base(c.Param("file"))
+	path := filepath.Join(filepath.Dir(job.FilePath), file)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if path == job.FilePath {
+		recordAudit(h.db, c, "play", "export", fmt.Sprint(job.ID), job.CameraIDs)
+		c.Header("Content-Type", "application/vnd.apple.mpegurl")
+	} else {
+		c.Header("Content-Type", "video/mp2t")
+	}
+	c.File(path)
+}
+
+// findCompletedExport is findExport for an export whose file can be served
+func (h *ExportHandler) findCompletedExport(c *gin.Context) (*models.ExportJob, bool) {
+	job, ok := h.findExport(c)
+	if !ok {
+		return nil, false
+	}
+	if job.Status != models.ExportCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Export is %s", job.Status)})
+		return nil, false
+	}
+	if job.FilePath == "" {
+		c.JSON(http.StatusGone, gin.H{"error": "Export has expired"})
+		return nil, false
+	}
+	if _, err := os.Stat(job.FilePath); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Export file is no longer available"})
+		return nil, false
+	}
+	return job, true
+}
+
+// findExport loads an export of the current user (any export for admins),
+// writing the error response when there is none
+func (h *ExportHandler) findExport(c *gin.Context) (*models.ExportJob, bool) {
+	var job models.ExportJob
+	if err := requestDB(h.db, c).First(&job, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch export"})
+		return nil, false
+	}
+	// A download link was signed for this export by someone allowed to see it
+	if c.GetBool("signed_download") {
+		return &job, true
+	}
+	userID := currentUserID(c)
+	if c.GetString("role") != "admin" && (job.UserID == nil || userID == nil || *job.UserID != *userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return nil, false
+	}
+	return &job, true
+}
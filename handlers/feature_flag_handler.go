@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type FeatureFlagHandler struct {
+	db       *gorm.DB
+	features *services.FeatureFlagService
+}
+
+func NewFeatureFlagHandler(db *gorm.DB, features *services.FeatureFlagService) *FeatureFlagHandler {
+	return &FeatureFlagHandler{
+		db:       db,
+		features: features,
+	}
+}
+
+type SetFeatureFlagRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// GetFeatureFlags returns whether each feature is on at a site, for clients
+// to hide what is off
+// Query: ?site= (camera area), the deployment-wide settings when empty
+func (h *FeatureFlagHandler) GetFeatureFlags(c *gin.Context) {
+	site := c.Query("site")
+	c.JSON(http.StatusOK, gin.H{
+		"site":     site,
+		"features": h.features.ForSite(site),
+	})
+}
+
+// ListFeatureFlags returns every feature with its deployment-wide setting
+// and the sites overriding it
+func (h *FeatureFlagHandler) ListFeatureFlags(c *gin.Context) {
+	c.JSON(http.StatusOK, h.features.List())
+}
+
+// SetFeatureFlag turns a feature on or off for every site without an
+// override of its own
+func (h *FeatureFlagHandler) SetFeatureFlag(c *gin.Context) {
+	h.set(c, "")
+}
+
+// SetSiteFeatureFlag turns a feature on or off at one site, whatever the
+// deployment-wide setting
+func (h *FeatureFlagHandler) SetSiteFeatureFlag(c *gin.Context) {
+	site := strings.TrimSpace(c.Param("site"))
+	if site == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "site is required"})
+		return
+	}
+	h.set(c, site)
+}
+
+// ClearSiteFeatureFlag removes a site's override, so the deployment-wide
+// setting applies there again
+func (h *FeatureFlagHandler) ClearSiteFeatureFlag(c *gin.Context) {
+	feature, ok := h.feature(c)
+	if !ok {
+		return
+	}
+	site := c.Param("site")
+
+	cleared, err := h.features.ClearSite(feature.Key, site)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear feature flag"})
+		return
+	}
+	if !cleared {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Site has no flag of its own for this feature"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "feature_flag", feature.Key, "site "+site)
+
+	c.JSON(http.StatusOK, gin.H{"key": feature.Key, "site": site, "enabled": h.features.Enabled(feature.Key, site)})
+}
+
+func (h *FeatureFlagHandler) set(c *gin.Context, site string) {
+	feature, ok := h.feature(c)
+	if !ok {
+		return
+	}
+	var req SetFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.features.Set(feature.Key, site, *req.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feature flag"})
+		return
+	}
+
+	scope := "every site"
+	if site != "" {
+		scope = "site " + site
+	}
+	recordAudit(h.db, c, "update", "feature_flag", feature.Key, fmt.Sprintf("enabled=%t for %s", *req.Enabled, scope))
+
+	c.JSON(http.StatusOK, gin.H{"key": feature.Key, "site": site, "enabled": *req.Enabled})
+}
+
+func (h *FeatureFlagHandler) feature(c *gin.Context) (services.Feature, bool) {
+	feature, ok := h.features.Feature(c.Param("key"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown feature"})
+	}
+	return feature, ok
+}
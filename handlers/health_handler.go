@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultHealthHistoryWindow = 7 * 24 * time.Hour
+	maxHealthHistoryChanges    = 1000
+)
+
+type HealthHandler struct {
+	db            *gorm.DB
+	healthHistory *services.HealthHistoryService
+}
+
+func NewHealthHandler(db *gorm.DB, healthHistory *services.HealthHistoryService) *HealthHandler {
+	return &HealthHandler{
+		db:            db,
+		healthHistory: healthHistory,
+	}
+}
+
+// GetHealthHistory returns a camera's up/down transitions, its recent checks
+// and flap summary
+// Query: ?from=&to= (default: last 7 days)
+func (h *HealthHandler) GetHealthHistory(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id").First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from == nil {
+		start := time.Now().Add(-defaultHealthHistoryWindow)
+		from = &start
+	}
+
+	changes := []models.StreamHealthChange{}
+	if err := requestDB(h.db, c).Scopes(database.ForCamera(camera.ID), database.TimeRange("changed_at", from, to), database.NewestFirst("changed_at")).
+		Limit(maxHealthHistoryChanges).Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch health history"})
+		return
+	}
+
+	response := gin.H{
+		"camera_id":     camera.ID,
+		"summary":       nil,
+		"changes":       changes,
+		"recent_checks": h.healthHistory.GetRecentChecks(camera.ID),
+	}
+	if summary, ok := h.healthHistory.GetSummary(camera.ID); ok {
+		response["summary"] = summary
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetStatusHistory returns a camera's status changes (online/offline, by the
+// health checks or set by hand) newest first using cursor pagination
+// Query: ?after=&limit=&source=&from=&to=
+func (h *HealthHandler) GetStatusHistory(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id").First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.CameraStatusEvent{}).
+		Scopes(database.ForCamera(camera.ID), database.TimeRange("changed_at", from, to))
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("changed_at", cursor.Time, cursor.ID))
+	}
+
+	var events []models.CameraStatusEvent
+	if err := query.Scopes(database.NewestFirst("changed_at")).Limit(limit + 1).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch status history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(events, limit, func(e models.CameraStatusEvent) (time.Time, uint) {
+		return e.ChangedAt, e.ID
+	}))
+}
+
+// GetCameraReliability lists the health summary of every camera, least
+// reliable first
+// Query: ?reliability=chronic|flapping|down|ok
+func (h *HealthHandler) GetCameraReliability(c *gin.Context) {
+	filter := c.Query("reliability")
+
+	summaries := []services.HealthSummary{}
+	for _, summary := range h.healthHistory.GetAllSummaries() {
+		if filter == "" || summary.Reliability == filter {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	rank := map[string]int{
+		services.ReliabilityChronic:  0,
+		services.ReliabilityDown:     1,
+		services.ReliabilityFlapping: 2,
+		services.ReliabilityOK:       3,
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if rank[summaries[i].Reliability] != rank[summaries[j].Reliability] {
+			return rank[summaries[i].Reliability] < rank[summaries[j].Reliability]
+		}
+		if summaries[i].FlapRate7d != summaries[j].FlapRate7d {
+			return summaries[i].FlapRate7d > summaries[j].FlapRate7d
+		}
+		return summaries[i].CameraID < summaries[j].CameraID
+	})
+
+	c.JSON(http.StatusOK, summaries)
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type IncidentHandler struct {
+	db *gorm.DB
+}
+
+func NewIncidentHandler(db *gorm.DB) *IncidentHandler {
+	return &IncidentHandler{
+		db: db,
+	}
+}
+
+type CreateIncidentRequest struct {
+	Title    string `json:"title" binding:"required"`
+	Notes    string `json:"notes"`
+	Severity string `json:"severity"`
+	CameraID *uint  `json:"camera_id"`
+	Area     string `json:"area"`
+	// Operator to hand the incident to
+	AssignedToID *uint `json:"assigned_to_id"`
+}
+
+type UpdateIncidentRequest struct {
+	Title    *string `json:"title"`
+	Notes    *string `json:"notes"`
+	Severity *string `json:"severity"`
+	Status   *string `json:"status"`
+	Area     *string `json:"area"`
+	// Operator to hand the incident to, 0 to unassign it
+	AssignedToID *uint `json:"assigned_to_id"`
+}
+
+// IncidentResponse is an incident with the contact details of who opened
+// it and who it is assigned to
+type IncidentResponse struct {
+	models.Incident
+	CreatedBy  *UserContact `json:"created_by,omitempty"`
+	AssignedTo *UserContact `json:"assigned_to,omitempty"`
+}
+
+// withContacts adds the creators' and assignees' contact details to
+// incidents
+func (h *IncidentHandler) withContacts(c *gin.Context, incidents []models.Incident) ([]IncidentResponse, error) {
+	var ids []uint
+	for _, incident := range incidents {
+		if incident.CreatedByID != nil {
+			ids = append(ids, *incident.CreatedByID)
+		}
+		if incident.AssignedToID != nil {
+			ids = append(ids, *incident.AssignedToID)
+		}
+	}
+	contacts, _, err := loadUserContacts(h.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	contacts = contactsFor(c, contacts)
+
+	contact := func(id *uint) *UserContact {
+		if id == nil {
+			return nil
+		}
+		if contact, ok := contacts[*id]; ok {
+			return &contact
+		}
+		return nil
+	}
+	response := make([]IncidentResponse, 0, len(incidents))
+	for _, incident := range incidents {
+		response = append(response, IncidentResponse{
+			Incident:   incident,
+			CreatedBy:  contact(incident.CreatedByID),
+			AssignedTo: contact(incident.AssignedToID),
+		})
+	}
+	return response, nil
+}
+
+// checkAssignee makes sure an incident is assigned to an operator: an
+// existing user who isn't a viewer
+func (h *IncidentHandler) checkAssignee(userID uint) error {
+	var user models.User
+	if err := h.db.Select("id", "role").First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("user %d not found", userID)
+		}
+		return err
+	}
+	if user.Role == "viewer" {
+		return fmt.Errorf("incidents can't be assigned to viewers")
+	}
+	return nil
+}
+
+// ListIncidents returns incidents, newest first, optionally filtered by ?status=
+func (h *IncidentHandler) ListIncidents(c *gin.Context) {
+	query := requestDB(h.db, c).Order("created_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var incidents []models.Incident
+	if err := query.Find(&incidents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incidents"})
+		return
+	}
+	response, err := h.withContacts(c, incidents)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incidents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *IncidentHandler) GetIncident(c *gin.Context) {
+	id := c.Param("id")
+
+	var incident models.Incident
+	if err := requestDB(h.db, c).First(&incident, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+		return
+	}
+	response, err := h.withContacts(c, []models.Incident{incident})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response[0])
+}
+
+func (h *IncidentHandler) CreateIncident(c *gin.Context) {
+	var req CreateIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	severity := req.Severity
+	if severity == "" {
+		severity = "info"
+	}
+	if req.AssignedToID != nil {
+		if err := h.checkAssignee(*req.AssignedToID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	incident := models.Incident{
+		Title:    req.Title,
+		Notes:    req.Notes,
+		Severity: severity,
+		Status:   "open",
+		CameraID: req.CameraID,
+		Area:     req.Area,
+
+		AssignedToID: req.AssignedToID,
+	}
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint); ok {
+			incident.CreatedByID = &id
+		}
+	}
+
+	if err := requestDB(h.db, c).Create(&incident).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create incident"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "incident", fmt.Sprint(incident.ID), incident.Title)
+
+	c.JSON(http.StatusCreated, incident)
+}
+
+func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
+	id := c.Param("id")
+
+	var req UpdateIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var incident models.Incident
+	if err := requestDB(h.db, c).First(&incident, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+		return
+	}
+
+	if req.Title != nil {
+		incident.Title = *req.Title
+	}
+	if req.Notes != nil {
+		incident.Notes = *req.Notes
+	}
+	if req.Severity != nil {
+		incident.Severity = *req.Severity
+	}
+	if req.Area != nil {
+		incident.Area = *req.Area
+	}
+	reassigned := false
+	if req.AssignedToID != nil {
+		assignee := req.AssignedToID
+		if *assignee == 0 {
+			assignee = nil
+		} else if err := h.checkAssignee(*assignee); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		previous := incident.AssignedToID
+		reassigned = (assignee == nil) != (previous == nil) || (assignee != nil && *assignee != *previous)
+		incident.AssignedToID = assignee
+	}
+	if req.Status != nil && *req.Status != incident.Status {
+		switch *req.Status {
+		case "open":
+			incident.ResolvedAt = nil
+		case "resolved":
+			now := time.Now()
+			incident.ResolvedAt = &now
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be open or resolved"})
+			return
+		}
+		incident.Status = *req.Status
+	}
+
+	if err := requestDB(h.db, c).Save(&incident).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update incident"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "incident", fmt.Sprint(incident.ID), incident.Title)
+	if reassigned {
+		assignee := "nobody"
+		if incident.AssignedToID != nil {
+			assignee = fmt.Sprintf("user %d", *incident.AssignedToID)
+		}
+		recordAudit(h.db, c, "assign", "incident", fmt.Sprint(incident.ID), assignee)
+	}
+
+	c.JSON(http.StatusOK, incident)
+}
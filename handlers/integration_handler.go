@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxWebhookBody = 1 << 20
+
+var integrationNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type IntegrationHandler struct {
+	db           *gorm.DB
+	integrations *services.IntegrationService
+}
+
+func NewIntegrationHandler(db *gorm.DB, integrations *services.IntegrationService) *IntegrationHandler {
+	return &IntegrationHandler{
+		db:           db,
+		integrations: integrations,
+	}
+}
+
+type IntegrationRequest struct {
+	Name            *string `json:"name"`
+	SignatureHeader *string `json:"signature_header"`
+	Enabled         *bool   `json:"enabled"`
+	Notes           *string `json:"notes"`
+}
+
+// apply copies the provided fields onto integration and validates the result
+func (req *IntegrationRequest) apply(integration *models.Integration) error {
+	if req.Name != nil {
+		integration.Name = *req.Name
+	}
+	if req.SignatureHeader != nil && *req.SignatureHeader != "" {
+		integration.SignatureHeader = *req.SignatureHeader
+	}
+	if req.Enabled != nil {
+		integration.Enabled = *req.Enabled
+	}
+	if req.Notes != nil {
+		integration.Notes = *req.Notes
+	}
+
+	if !integrationNamePattern.MatchString(integration.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits, - and _ (it is used in the webhook URL)")
+	}
+	return nil
+}
+
+type IntegrationMappingRequest struct {
+	Position            *int    `json:"position"`
+	MatchField          *string `json:"match_field"`
+	MatchValue          *string `json:"match_value"`
+	EventType           *string `json:"event_type"`
+	Severity            *string `json:"severity"`
+	SeverityField       *string `json:"severity_field"`
+	CameraField         *string `json:"camera_field"`
+	CameraLookup        *string `json:"camera_lookup"`
+	OccurredAtField     *string `json:"occurred_at_field"`
+	DescriptionTemplate *string `json:"description_template"`
+}
+
+// apply copies the provided fields onto mapping and validates the result
+func (req *IntegrationMappingRequest) apply(mapping *models.IntegrationMapping) error {
+	if req.Position != nil {
+		mapping.Position = *req.Position
+	}
+	if req.MatchField != nil {
+		mapping.MatchField = *req.MatchField
+	}
+	if req.MatchValue != nil {
+		mapping.MatchValue = *req.MatchValue
+	}
+	if req.EventType != nil {
+		mapping.EventType = *req.EventType
+	}
+	if req.Severity != nil {
+		mapping.Severity = *req.Severity
+	}
+	if req.SeverityField != nil {
+		mapping.SeverityField = *req.SeverityField
+	}
+	if req.CameraField != nil {
+		mapping.CameraField = *req.CameraField
+	}
+	if req.CameraLookup != nil {
+		mapping.CameraLookup = *req.CameraLookup
+	}
+	if req.OccurredAtField != nil {
+		mapping.OccurredAtField = *req.OccurredAtField
+	}
+	if req.DescriptionTemplate != nil {
+		mapping.DescriptionTemplate = *req.DescriptionTemplate
+	}
+	return services.ValidateMapping(mapping)
+}
+
+// ReceiveWebhook is the public endpoint third-party systems post to. The
+// body must be signed (see IntegrationService.Verify); payloads no mapping
+// matches are accepted and dropped so senders don't retry them.
+func (h *IntegrationHandler) ReceiveWebhook(c *gin.Context) {
+	var integration models.Integration
+	if err := requestDB(h.db, c).Preload("Mappings").Where("name = ? AND enabled = ?", c.Param("integration"), true).
+		First(&integration).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown integration"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Payload too large"})
+		return
+	}
+	if !h.integrations.Verify(&integration, body, c.GetHeader(integration.SignatureHeader),
+		c.GetHeader(services.IntegrationTimestampHeader), time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired signature"})
+		return
+	}
+
+	recorded, err := h.integrations.Receive(&integration, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"events": recorded})
+}
+
+func (h *IntegrationHandler) ListIntegrations(c *gin.Context) {
+	integrations := []models.Integration{}
+	if err := requestDB(h.db, c).Preload("Mappings", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	}).Order("name").Find(&integrations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch integrations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, integrations)
+}
+
+// CreateIntegration registers an integration; the signing secret is only
+// returned in this response and when rotated
+func (h *IntegrationHandler) CreateIntegration(c *gin.Context) {
+	var req IntegrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	integration := models.Integration{SignatureHeader: "X-Signature", Enabled: true}
+	if err := req.apply(&integration); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	secret, encrypted, err := h.integrations.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	integration.SecretEncrypted = encrypted
+
+	var existing int64
+	if err := requestDB(h.db, c).Model(&models.Integration{}).Where("name = ?", integration.Name).Count(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check integrations"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "An integration with this name already exists"})
+		return
+	}
+	if err := requestDB(h.db, c).Create(&integration).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create integration"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "integration", fmt.Sprint(integration.ID), integration.Name)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"integration": integration,
+		"secret":      secret,
+	})
+}
+
+func (h *IntegrationHandler) UpdateIntegration(c *gin.Context) {
+	integration, ok := h.findIntegration(c)
+	if !ok {
+		return
+	}
+
+	var req IntegrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(integration); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Omit("Mappings").Save(integration).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update integration"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "integration", fmt.Sprint(integration.ID), integration.Name)
+
+	c.JSON(http.StatusOK, integration)
+}
+
+// DeleteIntegration removes an integration and its mappings; its events stay
+func (h *IntegrationHandler) DeleteIntegration(c *gin.Context) {
+	integration, ok := h.findIntegration(c)
+	if !ok {
+		return
+	}
+
+	err := requestDB(h.db, c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("integration_id = ?", integration.ID).Delete(&models.IntegrationMapping{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(integration).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete integration"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "integration", fmt.Sprint(integration.ID), integration.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Integration deleted successfully"})
+}
+
+// RotateIntegrationSecret replaces the signing secret; the old one stops
+// working immediately
+func (h *IntegrationHandler) RotateIntegrationSecret(c *gin.Context) {
+	integration, ok := h.findIntegration(c)
+	if !ok {
+		return
+	}
+
+	secret, encrypted, err := h.integrations.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := requestDB(h.db, c).Model(integration).Update("secret_encrypted", encrypted).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate secret"})
+		return
+	}
+
+	recordAudit(h.db, c, "rotate", "integration", fmt.Sprint(integration.ID), integration.Name)
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret})
+}
+
+// TestIntegration runs a sample payload through the integration's mappings
+// and returns the events it would create, without storing them or checking
+// a signature
+func (h *IntegrationHandler) TestIntegration(c *gin.Context) {
+	integration, ok := h.findIntegration(c)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Payload too large"})
+		return
+	}
+	events, err := h.integrations.Transform(integration, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+func (h *IntegrationHandler) CreateIntegrationMapping(c *gin.Context) {
+	integration, ok := h.findIntegration(c)
+	if !ok {
+		return
+	}
+
+	var req IntegrationMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mapping := models.IntegrationMapping{
+		IntegrationID: integration.ID,
+		Severity:      "info",
+		CameraLookup:  "name",
+	}
+	if err := req.apply(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Create(&mapping).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create mapping"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "integration_mapping", fmt.Sprint(mapping.ID), fmt.Sprintf("%s -> %s", integration.Name, mapping.EventType))
+
+	c.JSON(http.StatusCreated, mapping)
+}
+
+func (h *IntegrationHandler) UpdateIntegrationMapping(c *gin.Context) {
+	var mapping models.IntegrationMapping
+	if err := requestDB(h.db, c).Where("integration_id = ?", c.Param("id")).First(&mapping, c.Param("mappingId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Mapping not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mapping"})
+		return
+	}
+
+	var req IntegrationMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Save(&mapping).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update mapping"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "integration_mapping", fmt.Sprint(mapping.ID), mapping.EventType)
+
+	c.JSON(http.StatusOK, mapping)
+}
+
+func (h *IntegrationHandler) DeleteIntegrationMapping(c *gin.Context) {
+	result := requestDB(h.db, c).Where("integration_id = ?", c.Param("id")).Delete(&models.IntegrationMapping{}, c.Param("mappingId"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete mapping"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mapping not found"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "integration_mapping", c.Param("mappingId"), "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mapping deleted successfully"})
+}
+
+// findIntegration loads the :id integration with its mappings, writing the
+// error response when it can't
+func (h *IntegrationHandler) findIntegration(c *gin.Context) (*models.Integration, bool) {
+	var integration models.Integration
+	if err := requestDB(h.db, c).Preload("Mappings").First(&integration, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch integration"})
+		return nil, false
+	}
+	return &integration, true
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type IntercomHandler struct {
+	db        *gorm.DB
+	intercoms *services.IntercomService
+}
+
+func NewIntercomHandler(db *gorm.DB, intercoms *services.IntercomService) *IntercomHandler {
+	return &IntercomHandler{
+		db:        db,
+		intercoms: intercoms,
+	}
+}
+
+// IntercomStatus is an intercom with its ringing or answered call
+type IntercomStatus struct {
+	models.Camera
+	Call *models.IntercomCall `json:"call"`
+}
+
+// ListIntercoms returns the intercoms with their current call, ringing
+// ones first
+func (h *IntercomHandler) ListIntercoms(c *gin.Context) {
+	var cameras []models.Camera
+	if err := requestDB(h.db, c).Where("device_type = ?", models.DeviceTypeIntercom).Order("name").Find(&cameras).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch intercoms"})
+		return
+	}
+
+	ringing := make([]IntercomStatus, 0, len(cameras))
+	rest := make([]IntercomStatus, 0, len(cameras))
+	for _, camera := range cameras {
+		status := IntercomStatus{Camera: camera, Call: h.intercoms.ActiveCall(camera.ID)}
+		if status.Call != nil && status.Call.Status == models.IntercomCallRinging {
+			ringing = append(ringing, status)
+		} else {
+			rest = append(rest, status)
+		}
+	}
+
+	c.JSON(http.StatusOK, append(ringing, rest...))
+}
+
+// RingIntercom starts a call from an intercom, for stations reporting
+// button presses through a bridge rather than their metadata stream
+func (h *IntercomHandler) RingIntercom(c *gin.Context) {
+	cameraID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid camera ID"})
+		return
+	}
+
+	call, created, err := h.intercoms.Ring(uint(cameraID), "api")
+	if err != nil {
+		h.intercomError(c, err, nil, "Failed to start call")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, call)
+}
+
+// ListIntercomCalls returns intercom calls newest first using cursor
+// pagination
+// Query: ?after=&limit=&camera_id=&status=&from=&to=
+func (h *IntercomHandler) ListIntercomCalls(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.IntercomCall{}).Scopes(database.TimeRange("started_at", from, to))
+	if cameraID != 0 {
+		query = query.Where("camera_id = ?", cameraID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("started_at", cursor.Time, cursor.ID))
+	}
+
+	var calls []models.IntercomCall
+	if err := query.Scopes(database.NewestFirst("started_at")).Limit(limit + 1).Find(&calls).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch intercom calls"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(calls, limit, func(call models.IntercomCall) (time.Time, uint) {
+		return call.StartedAt, call.ID
+	}))
+}
+
+// AnswerIntercomCall marks a ringing call as answered by the current user
+func (h *IntercomHandler) AnswerIntercomCall(c *gin.Context) {
+	callID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid call ID"})
+		return
+	}
+
+	call, err := h.intercoms.Answer(uint(callID), c.GetUint("user_id"))
+	if err != nil {
+		h.intercomError(c, err, call, "Failed to answer call")
+		return
+	}
+
+	recordAudit(h.db, c, "answer", "intercom_call", fmt.Sprint(call.ID), fmt.Sprintf("camera %d", call.CameraID))
+	c.JSON(http.StatusOK, call)
+}
+
+// HangupIntercomCall ends a ringing or answered call and its talk session
+func (h *IntercomHandler) HangupIntercomCall(c *gin.Context) {
+	callID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid call ID"})
+		return
+	}
+
+	call, err := h.intercoms.Hangup(uint(callID), c.GetUint("user_id"))
+	if err != nil {
+		h.intercomError(c, err, call, "Failed to end call")
+		return
+	}
+
+	recordAudit(h.db, c, "hangup", "intercom_call", fmt.Sprint(call.ID), fmt.Sprintf("camera %d", call.CameraID))
+	c.JSON(http.StatusOK, call)
+}
+
+// ReleaseDoor opens the door of an intercom through its ONVIF relay output
+func (h *IntercomHandler) ReleaseDoor(c *gin.Context) {
+	camera, ok := h.findIntercom(c)
+	if !ok {
+		return
+	}
+
+	call, err := h.intercoms.ReleaseDoor(camera, c.GetUint("user_id"))
+	if err != nil {
+		log.Printf("[Intercom] Door release failed for camera %d: %v\n", camera.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to release door: " + err.Error()})
+		return
+	}
+
+	details := ""
+	if call != nil {
+		details = fmt.Sprintf("call %d", call.ID)
+	}
+	recordAudit(h.db, c, "door_release", "camera", fmt.Sprint(camera.ID), details)
+
+	c.JSON(http.StatusOK, gin.H{
+		"camera_id": camera.ID,
+		"call":      call,
+	})
+}
+
+// CreateTalkSession answers a WebRTC offer carrying the operator's
+// microphone (application/sdp, like WHEP) and plays it on the intercom
+func (h *IntercomHandler) CreateTalkSession(c *gin.Context) {
+	if contentType := c.ContentType(); contentType != "application/sdp" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/sdp"})
+		return
+	}
+	offer, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWHEPOffer))
+	if err != nil || len(offer) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be an SDP offer"})
+		return
+	}
+
+	camera, ok := h.findIntercom(c)
+	if !ok {
+		return
+	}
+
+	sessionID, answer, err := h.intercoms.AnswerTalk(camera, string(offer), c.GetUint("user_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIntercomBusy):
+			c.JSON(http.StatusConflict, gin.H{"error": "Another operator is talking on this intercom"})
+		case errors.Is(err, services.ErrTalkNotConfigured):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	recordAudit(h.db, c, "talk", "camera", fmt.Sprint(camera.ID), "")
+	c.Header("Location", fmt.Sprintf("/api/v1/intercoms/%d/talk/%s", camera.ID, sessionID))
+	c.Data(http.StatusCreated, "application/sdp", []byte(answer))
+}
+
+// DeleteTalkSession ends a talk session
+func (h *IntercomHandler) DeleteTalkSession(c *gin.Context) {
+	cameraID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid camera ID"})
+		return
+	}
+	if err := h.intercoms.CloseTalk(uint(cameraID), c.Param("session")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// findIntercom loads the intercom in :id, answering the request when it
+// doesn't exist or isn't an intercom
+func (h *IntercomHandler) findIntercom(c *gin.Context) (*models.Camera, bool) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return nil, false
+	}
+	if camera.DeviceType != models.DeviceTypeIntercom {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Camera is not an intercom"})
+		return nil, false
+	}
+	return &camera, true
+}
+
+func (h *IntercomHandler) intercomError(c *gin.Context, err error, call *models.IntercomCall, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, services.ErrNotIntercom):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Camera is not an intercom"})
+	case errors.Is(err, services.ErrIntercomCallState) && call != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Call is already %s", call.Status)})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LegalHoldHandler struct {
+	db *gorm.DB
+}
+
+func NewLegalHoldHandler(db *gorm.DB) *LegalHoldHandler {
+	return &LegalHoldHandler{
+		db: db,
+	}
+}
+
+// CreateLegalHoldRequest places a hold either on a camera's time range
+// (camera_id, start_time, end_time) or on specific recordings (recording_ids)
+type CreateLegalHoldRequest struct {
+	CameraID     uint       `json:"camera_id"`
+	StartTime    *time.Time `json:"start_time"`
+	EndTime      *time.Time `json:"end_time"`
+	RecordingIDs []uint     `json:"recording_ids"`
+	Reason       string     `json:"reason" binding:"required"`
+	CaseRef      string     `json:"case_ref"`
+}
+
+type ReleaseLegalHoldRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ListLegalHolds returns legal holds, newest first
+// Query: ?camera_id=, ?recording_id= (holds covering that recording), ?active=true|false
+func (h *LegalHoldHandler) ListLegalHolds(c *gin.Context) {
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordingID, err := parseUintParam(c, "recording_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.LegalHold{}).Scopes(database.ForCamera(cameraID))
+	switch c.Query("active") {
+	case "true":
+		query = query.Where("released_at IS NULL")
+	case "false":
+		query = query.Where("released_at IS NOT NULL")
+	}
+	if recordingID != 0 {
+		var recording models.Recording
+		if err := requestDB(h.db, c).First(&recording, recordingID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+			return
+		}
+		end := time.Now()
+		if recording.EndTime != nil {
+			end = *recording.EndTime
+		}
+		query = query.Where("camera_id = ? AND start_time < ? AND end_time > ?", recording.CameraID, end, recording.StartTime)
+	}
+
+	holds := []models.LegalHold{}
+	if err := query.Order("created_at DESC").Find(&holds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch legal holds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, holds)
+}
+
+func (h *LegalHoldHandler) CreateLegalHold(c *gin.Context) {
+	var req CreateLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var holds []models.LegalHold
+	base := models.LegalHold{Reason: req.Reason, CaseRef: req.CaseRef, CreatedByID: currentUserID(c)}
+
+	switch {
+	case len(req.RecordingIDs) > 0:
+		var recordings []models.Recording
+		if err := requestDB(h.db, c).Where("id IN ?", req.RecordingIDs).Find(&recordings).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recordings"})
+			return
+		}
+		if len(recordings) != len(req.RecordingIDs) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Some recordings were not found"})
+			return
+		}
+		for _, recording := range recordings {
+			hold := base
+			recordingID := recording.ID
+			hold.CameraID = recording.CameraID
+			hold.RecordingID = &recordingID
+			hold.StartTime = recording.StartTime
+			// A recording still in progress is held up to its longest possible span
+			hold.EndTime = recording.StartTime.Add(maxRecordingSpan)
+			if recording.EndTime != nil {
+				hold.EndTime = *recording.EndTime
+			}
+			holds = append(holds, hold)
+		}
+	case req.CameraID != 0 && req.StartTime != nil && req.EndTime != nil:
+		if !req.EndTime.After(*req.StartTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be after start_time"})
+			return
+		}
+		var camera models.Camera
+		if err := requestDB(h.db, c).Unscoped().Select("id").First(&camera, req.CameraID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		hold := base
+		hold.CameraID = camera.ID
+		hold.StartTime = *req.StartTime
+		hold.EndTime = *req.EndTime
+		holds = append(holds, hold)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide recording_ids, or camera_id with start_time and end_time"})
+		return
+	}
+
+	// Shares the lock camera deletes take, so a delete that already checked
+	// for holds commits first and one that hasn't sees these
+	cameraIDs := make([]uint, len(holds))
+	for i, hold := range holds {
+		cameraIDs[i] = hold.CameraID
+	}
+	err := requestDB(h.db, c).Transaction(func(tx *gorm.DB) error {
+		var locked []uint
+		if err := tx.Unscoped().Model(&models.Camera{}).Clauses(clause.Locking{Strength: "SHARE"}).
+			Where("id IN ?", cameraIDs).Pluck("id", &locked).Error; err != nil {
+			return err
+		}
+		return tx.Create(&holds).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create legal hold"})
+		return
+	}
+
+	for _, hold := range holds {
+		recordAudit(h.db, c, "legal_hold_create", "legal_hold", fmt.Sprint(hold.ID), fmt.Sprintf(
+			"camera %d %s - %s, case %q: %s", hold.CameraID,
+			hold.StartTime.Format(time.RFC3339), hold.EndTime.Format(time.RFC3339), hold.CaseRef, hold.Reason))
+	}
+
+	c.JSON(http.StatusCreated, holds)
+}
+
+// ReleaseLegalHold lifts a hold; its recordings become deletable again
+// unless another hold covers them
+func (h *LegalHoldHandler) ReleaseLegalHold(c *gin.Context) {
+	var req ReleaseLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var hold models.LegalHold
+	if err := requestDB(h.db, c).First(&hold, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Legal hold not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch legal hold"})
+		return
+	}
+	if hold.ReleasedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Legal hold is already released"})
+		return
+	}
+
+	now := time.Now()
+	hold.ReleasedAt = &now
+	hold.ReleasedByID = currentUserID(c)
+	hold.ReleaseReason = req.Reason
+	if err := requestDB(h.db, c).Save(&hold).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release legal hold"})
+		return
+	}
+
+	recordAudit(h.db, c, "legal_hold_release", "legal_hold", fmt.Sprint(hold.ID), fmt.Sprintf("case %q: %s", hold.CaseRef, req.Reason))
+
+	c.JSON(http.StatusOK, hold)
+}
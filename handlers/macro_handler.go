@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxMacroSteps = 20
+
+type MacroHandler struct {
+	db     *gorm.DB
+	macros *services.MacroService
+}
+
+func NewMacroHandler(db *gorm.DB, macros *services.MacroService) *MacroHandler {
+	return &MacroHandler{
+		db:     db,
+		macros: macros,
+	}
+}
+
+type MacroRequest struct {
+	Name        *string             `json:"name"`
+	Description *string             `json:"description"`
+	Hotkey      *string             `json:"hotkey"`
+	Steps       *[]MacroStepRequest `json:"steps"` // Replaces all steps; run in list order
+}
+
+type MacroStepRequest struct {
+	Action          string `json:"action" binding:"required"`
+	CameraIDs       []uint `json:"camera_ids"`
+	DurationSeconds int    `json:"duration_seconds"`
+	Preset          string `json:"preset"`
+	Title           string `json:"title"`
+	Severity        string `json:"severity"`
+	Notes           string `json:"notes"`
+}
+
+// apply copies the provided fields onto macro and validates the result
+func (req *MacroRequest) apply(macro *models.Macro) error {
+	if req.Name != nil {
+		macro.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		macro.Description = *req.Description
+	}
+	if req.Hotkey != nil {
+		macro.Hotkey = strings.ToLower(strings.TrimSpace(*req.Hotkey))
+	}
+	if req.Steps != nil {
+		if len(*req.Steps) > maxMacroSteps {
+			return fmt.Errorf("a macro has at most %d steps", maxMacroSteps)
+		}
+		macro.Steps = make([]models.MacroStep, 0, len(*req.Steps))
+		for i, stepReq := range *req.Steps {
+			ids := make([]string, len(stepReq.CameraIDs))
+			for j, id := range stepReq.CameraIDs {
+				ids[j] = fmt.Sprint(id)
+			}
+			step := models.MacroStep{
+				Position:        i,
+				Action:          stepReq.Action,
+				CameraIDs:       strings.Join(ids, ","),
+				DurationSeconds: stepReq.DurationSeconds,
+				Preset:          stepReq.Preset,
+				Title:           stepReq.Title,
+				Severity:        stepReq.Severity,
+				Notes:           stepReq.Notes,
+			}
+			if err := services.ValidateMacroStep(&step); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+			macro.Steps = append(macro.Steps, step)
+		}
+	}
+
+	if macro.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(macro.Steps) == 0 {
+		return fmt.Errorf("a macro needs at least one step")
+	}
+	return nil
+}
+
+// ListMacros returns all macros with their steps, for the operator toolbar
+// and its hotkeys
+func (h *MacroHandler) ListMacros(c *gin.Context) {
+	macros := []models.Macro{}
+	if err := requestDB(h.db, c).Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	}).Order("name").Find(&macros).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch macros"})
+		return
+	}
+	c.JSON(http.StatusOK, macros)
+}
+
+func (h *MacroHandler) CreateMacro(c *gin.Context) {
+	var req MacroRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	macro := models.Macro{CreatedByID: currentUserID(c)}
+	if err := req.apply(&macro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkUnique(c, &macro) {
+		return
+	}
+
+	if err := requestDB(h.db, c).Create(&macro).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create macro"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "macro", fmt.Sprint(macro.ID), fmt.Sprintf("%s (%d steps)", macro.Name, len(macro.Steps)))
+
+	c.JSON(http.StatusCreated, macro)
+}
+
+// UpdateMacro changes a macro; steps, when given, replace the current ones
+func (h *MacroHandler) UpdateMacro(c *gin.Context) {
+	macro, ok := h.findMacro(c)
+	if !ok {
+		return
+	}
+	var req MacroRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(macro); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkUnique(c, macro) {
+		return
+	}
+
+	err := requestDB(h.db, c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Steps").Save(macro).Error; err != nil {
+			return err
+		}
+		if req.Steps == nil {
+			return nil
+		}
+		if err := tx.Where("macro_id = ?", macro.ID).Delete(&models.MacroStep{}).Error; err != nil {
+			return err
+		}
+		for i := range macro.Steps {
+			macro.Steps[i].ID = 0
+			macro.Steps[i].MacroID = macro.ID
+		}
+		return tx.Create(&macro.Steps).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update macro"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "macro", fmt.Sprint(macro.ID), fmt.Sprintf("%s (%d steps)", macro.Name, len(macro.Steps)))
+
+	c.JSON(http.StatusOK, macro)
+}
+
+func (h *MacroHandler) DeleteMacro(c *gin.Context) {
+	macro, ok := h.findMacro(c)
+	if !ok {
+		return
+	}
+
+	err := requestDB(h.db, c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("macro_id = ?", macro.ID).Delete(&models.MacroStep{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(macro).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete macro"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "macro", fmt.Sprint(macro.ID), macro.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Macro deleted successfully"})
+}
+
+// RunMacro runs a macro's steps in order. It is all or nothing: when a step
+// fails the rest are skipped and earlier steps are rolled back (incidents
+// removed, recordings stopped; PTZ moves stay). Responds 200 when every step
+// succeeded and 422 otherwise, both with the per-step results.
+func (h *MacroHandler) RunMacro(c *gin.Context) {
+	macro, ok := h.findMacro(c)
+	if !ok {
+		return
+	}
+
+	run := h.macros.Run(macro, currentUserID(c))
+
+	outcome := "succeeded"
+	for _, result := range run.Results {
+		if result.Status == services.MacroStepFailed {
+			outcome = fmt.Sprintf("failed at step %d (%s): %s", result.Position+1, result.Action, result.Message)
+			break
+		}
+	}
+	recordAudit(h.db, c, "run", "macro", fmt.Sprint(macro.ID), fmt.Sprintf("%s: %s", macro.Name, outcome))
+
+	status := http.StatusOK
+	if !run.Succeeded {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, run)
+}
+
+// checkUnique rejects a name or hotkey another macro already uses
+func (h *MacroHandler) checkUnique(c *gin.Context, macro *models.Macro) bool {
+	var existing int64
+	query := requestDB(h.db, c).Model(&models.Macro{}).Where("id <> ?", macro.ID)
+	if macro.Hotkey != "" {
+		query = query.Where("name = ? OR hotkey = ?", macro.Name, macro.Hotkey)
+	} else {
+		query = query.Where("name = ?", macro.Name)
+	}
+	if err := query.Count(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check macros"})
+		return false
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another macro already uses this name or hotkey"})
+		return false
+	}
+	return true
+}
+
+// findMacro loads the :id macro with its steps, writing the error response
+// when it can't
+func (h *MacroHandler) findMacro(c *gin.Context) (*models.Macro, bool) {
+	var macro models.Macro
+	if err := requestDB(h.db, c).Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	}).First(&macro, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Macro not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch macro"})
+		return nil, false
+	}
+	return &macro, true
+}
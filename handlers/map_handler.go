@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// mapPinsTTL is how long the camera positions are served from memory to
+	// every map asking for clusters
+	mapPinsTTL = 5 * time.Second
+
+	// mapTileSize is the size of a Web Mercator tile in pixels; the world is
+	// mapTileSize * 2^zoom pixels wide
+	mapTileSize = 256
+
+	defaultClusterRadius = 60 // Grid cell size in screen pixels
+	minClusterRadius     = 20
+	maxClusterRadius     = 200
+
+	// maxClusterCameraIDs is the largest cluster listing its cameras, enough
+	// for a popup without bloating city-wide views
+	maxClusterCameraIDs = 10
+
+	// maxMercatorLatitude is where Web Mercator maps end
+	maxMercatorLatitude = 85.05112878
+)
+
+type MapHandler struct {
+	db       *gorm.DB
+	statuses *services.CameraStatusService
+	pins     []mapPin
+	pinsAt   time.Time
+	pinsMu   sync.Mutex
+}
+
+func NewMapHandler(db *gorm.DB, statuses *services.CameraStatusService) *MapHandler {
+	return &MapHandler{
+		db:       db,
+		statuses: statuses,
+	}
+}
+
+// mapPin is a camera placed on the map, x and y in pixels at zoom 0
+type mapPin struct {
+	id        uint
+	latitude  float64
+	longitude float64
+	x, y      float64
+	status    string
+	area      string
+}
+
+// MapCluster is a group of cameras close together at the requested zoom,
+// placed at their mean position
+type MapCluster struct {
+	Latitude  float64        `json:"latitude"`
+	Longitude float64        `json:"longitude"`
+	Count     int            `json:"count"`
+	Statuses  map[string]int `json:"statuses"`             // Cameras per status
+	CameraID  *uint          `json:"camera_id,omitempty"`  // Single-camera clusters
+	Status    string         `json:"status,omitempty"`     // Single-camera clusters
+	Color     string         `json:"color,omitempty"`      // Of the single camera's status definition
+	CameraIDs []uint         `json:"camera_ids,omitempty"` // Clusters of up to 10 cameras
+	// ExpansionZoom is the zoom at which the cluster splits up, for zooming
+	// in on click; omitted when its cameras share one spot
+	ExpansionZoom *int `json:"expansion_zoom,omitempty"`
+}
+
+// MapClustersResponse are the clusters of a map view
+type MapClustersResponse struct {
+	Zoom        int            `json:"zoom"`
+	BBox        []float64      `json:"bbox"` // west, south, east, north; null for the whole world
+	Radius      int            `json:"radius"`
+	Total       int            `json:"total"` // Cameras in the view
+	Clusters    []MapCluster   `json:"clusters"`
+	DefaultView models.MapView `json:"default_view"` // Of the settings
+}
+
+// GetMapClusters groups the cameras in a map view into grid clusters, so
+// walls showing thousands of cameras draw a few dozen markers instead of
+// clustering them in the browser. Cameras fall into square cells of radius
+// pixels at the zoom; without a zoom the settings' default map zoom is used.
+// Query: ?zoom=&bbox=west,south,east,north&radius=&area=
+func (h *MapHandler) GetMapClusters(c *gin.Context) {
+	settings, err := loadSettings(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+
+	zoom := settings.Map.Zoom
+	if raw := c.Query("zoom"); raw != "" {
+		zoom, err = strconv.Atoi(raw)
+		if err != nil || zoom < 0 || zoom > maxMapZoom {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("zoom must be between 0 and %d", maxMapZoom)})
+			return
+		}
+	}
+	radius := defaultClusterRadius
+	if raw := c.Query("radius"); raw != "" {
+		radius, err = strconv.Atoi(raw)
+		if err != nil || radius < minClusterRadius || radius > maxClusterRadius {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("radius must be between %d and %d", minClusterRadius, maxClusterRadius)})
+			return
+		}
+	}
+	bbox, err := parseBBox(c.Query("bbox"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pins, err := h.allPins()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+		return
+	}
+
+	var areas map[string]bool
+	if values := c.QueryArray("area"); len(values) > 0 {
+		areas = make(map[string]bool, len(values))
+		for _, area := range values {
+			areas[area] = true
+		}
+	}
+	visible := make([]mapPin, 0, len(pins))
+	for _, pin := range pins {
+		if areas != nil && !areas[pin.area] {
+			continue
+		}
+		if bbox != nil && !bboxContains(bbox, pin.latitude, pin.longitude) {
+			continue
+		}
+		visible = append(visible, pin)
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, MapClustersResponse{
+		Zoom:        zoom,
+		BBox:        bbox,
+		Radius:      radius,
+		Total:       len(visible),
+		Clusters:    h.cluster(visible, zoom, radius),
+		DefaultView: settings.Map,
+	})
+}
+
+// cluster groups pins by the grid cell they fall in at the zoom, biggest
+// clusters first
+func (h *MapHandler) cluster(pins []mapPin, zoom, radius int) []MapCluster {
+	scale := math.Exp2(float64(zoom))
+	type cell struct{ x, y int64 }
+	cells := make(map[cell][]mapPin)
+	var order []cell
+	for _, pin := range pins {
+		key := cell{int64(pin.x * scale / float64(radius)), int64(pin.y * scale / float64(radius))}
+		if _, ok := cells[key]; !ok {
+			order = append(order, key)
+		}
+		cells[key] = append(cells[key], pin)
+	}
+
+	clusters := make([]MapCluster, 0, len(order))
+	for _, key := range order {
+		members := cells[key]
+		cluster := MapCluster{Count: len(members), Statuses: make(map[string]int)}
+		minX, minY, maxX, maxY := members[0].x, members[0].y, members[0].x, members[0].y
+		for _, pin := range members {
+			cluster.Latitude += pin.latitude
+			cluster.Longitude += pin.longitude
+			cluster.Statuses[pin.status]++
+			minX, maxX = math.Min(minX, pin.x), math.Max(maxX, pin.x)
+			minY, maxY = math.Min(minY, pin.y), math.Max(maxY, pin.y)
+			if len(members) <= maxClusterCameraIDs {
+				cluster.CameraIDs = append(cluster.CameraIDs, pin.id)
+			}
+		}
+		cluster.Latitude /= float64(len(members))
+		cluster.Longitude /= float64(len(members))
+
+		if len(members) == 1 {
+			id := members[0].id
+			cluster.CameraID = &id
+			cluster.Status = members[0].status
+			cluster.Color = h.statusColor(members[0].status)
+		} else if span := math.Max(maxX-minX, maxY-minY); span > 0 {
+			// The cameras land in different cells once they are radius apart
+			expansion := int(math.Ceil(math.Log2(float64(radius) / span)))
+			if expansion <= zoom {
+				expansion = zoom + 1
+			}
+			if expansion > maxMapZoom {
+				expansion = maxMapZoom
+			}
+			cluster.ExpansionZoom = &expansion
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].Count > clusters[j].Count
+	})
+	return clusters
+}
+
+// allPins returns every camera's map position, reloaded at most every
+// mapPinsTTL
+func (h *MapHandler) allPins() ([]mapPin, error) {
+	h.pinsMu.Lock()
+	defer h.pinsMu.Unlock()
+
+	if h.pins != nil && time.Since(h.pinsAt) < mapPinsTTL {
+		return h.pins, nil
+	}
+
+	var cameras []models.Camera
+	if err := h.db.Select("id", "latitude", "longitude", "status", "area").Order("id").Find(&cameras).Error; err != nil {
+		return nil, err
+	}
+	pins := make([]mapPin, len(cameras))
+	for i, camera := range cameras {
+		x, y := mercatorPixel(camera.Latitude, camera.Longitude)
+		pins[i] = mapPin{
+			id:        camera.ID,
+			latitude:  camera.Latitude,
+			longitude: camera.Longitude,
+			x:         x,
+			y:         y,
+			status:    camera.Status,
+			area:      camera.Area,
+		}
+	}
+	h.pins, h.pinsAt = pins, time.Now()
+	return pins, nil
+}
+
+func (h *MapHandler) statusColor(status string) string {
+	definition, _ := h.statuses.Get(status)
+	return definition.Color
+}
+
+// mercatorPixel projects a position to Web Mercator pixels at zoom 0
+func mercatorPixel(latitude, longitude float64) (float64, float64) {
+	latitude = math.Max(-maxMercatorLatitude, math.Min(maxMercatorLatitude, latitude))
+	sin := math.Sin(latitude * math.Pi / 180)
+	x := (longitude + 180) / 360 * mapTileSize
+	y := (0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)) * mapTileSize
+	return x, y
+}
+
+// parseBBox parses "west,south,east,north" in degrees; west is greater than
+// east for views crossing the antimeridian. Empty means the whole world.
+func parseBBox(raw string) ([]float64, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be west,south,east,north")
+	}
+	bbox := make([]float64, 4)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox must be west,south,east,north")
+		}
+		bbox[i] = value
+	}
+	west, south, east, north := bbox[0], bbox[1], bbox[2], bbox[3]
+	if west < -180 || west > 180 || east < -180 || east > 180 || south < -90 || north > 90 || south > north {
+		return nil, fmt.Errorf("bbox longitudes must be between -180 and 180 and latitudes between -90 and 90, south below north")
+	}
+	return bbox, nil
+}
+
+func bboxContains(bbox []float64, latitude, longitude float64) bool {
+	west, south, east, north := bbox[0], bbox[1], bbox[2], bbox[3]
+	if latitude < south || latitude > north {
+		return false
+	}
+	if west <= east {
+		return longitude >= west && longitude <= east
+	}
+	return longitude >= west || longitude <= east
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MediaMTXHandler struct {
+	db              *gorm.DB
+	mediamtxService *services.MediaMTXService
+	tokens          *services.StreamTokenService
+	privacy         *services.PrivacyService
+}
+
+func NewMediaMTXHandler(db *gorm.DB, mediamtxService *services.MediaMTXService, tokens *services.StreamTokenService, privacy *services.PrivacyService) *MediaMTXHandler {
+	return &MediaMTXHandler{
+		db:              db,
+		mediamtxService: mediamtxService,
+		tokens:          tokens,
+		privacy:         privacy,
+	}
+}
+
+// MediaMTXAuthRequest is the body of MediaMTX's HTTP auth callback. Before
+// v1.0 (externalAuthenticationURL) there is no token; it is in the query.
+type MediaMTXAuthRequest struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+	IP       string `json:"ip"`
+	Action   string `json:"action"` // publish, read, playback, api, metrics, pprof
+	Path     string `json:"path"`
+	Protocol string `json:"protocol"` // rtsp, rtmp, hls, webrtc, srt
+	Query    string `json:"query"`
+}
+
+// AuthorizeStream is MediaMTX's HTTP auth callback (authHTTPAddress, or
+// externalAuthenticationURL before v1.0). The backend's pipelines and
+// MediaMTX's own FFmpegs (IsInternalClient) are let through; anyone else
+// may only read, in any protocol including RTSP, with the token from a
+// signed stream URL. Reads of cameras in privacy mode are refused, token
+// or not.
+func (h *MediaMTXHandler) AuthorizeStream(c *gin.Context) {
+	// Only MediaMTX may ask; anyone else could pick the client IP in the body
+	// and dodge the failure limit
+	if !h.mediamtxService.IsMediaMTXAddress(c.ClientIP()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only MediaMTX may call this endpoint"})
+		return
+	}
+
+	var req MediaMTXAuthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	internal := h.mediamtxService.IsInternalClient(req.User, req.Password, req.IP)
+	if req.Action != "read" && req.Action != "playback" {
+		if !internal {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the backend may " + req.Action})
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+	// Before letting the backend through too: its transcodes and snapshots
+	// of a blacked out camera are views of it as well
+	if cameraID, ok := h.mediamtxService.PathCamera(req.Path); ok {
+		if _, private := h.privacy.Active(cameraID); private {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Camera is in privacy mode"})
+			return
+		}
+	}
+	if internal || !h.tokens.Enabled() {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	token := req.Token
+	if token == "" {
+		query, _ := url.ParseQuery(req.Query)
+		token = query.Get("token")
+	}
+	if err := h.tokens.Validate(req.Path, token, req.IP); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// ExportMediaMTXConfig dumps the MediaMTX paths this backend manages
+func (h *MediaMTXHandler) ExportMediaMTXConfig(c *gin.Context) {
+	snapshot := h.mediamtxService.ExportSnapshot()
+
+	recordAudit(h.db, c, "export", "mediamtx_config", "", fmt.Sprintf("%d paths", len(snapshot.Paths)))
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// ImportMediaMTXConfig reapplies a snapshot from ExportMediaMTXConfig.
+// Paths of cameras that have since been deleted are skipped.
+func (h *MediaMTXHandler) ImportMediaMTXConfig(c *gin.Context) {
+	var snapshot services.MediaMTXSnapshot
+	if err := c.ShouldBindJSON(&snapshot); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cameraIDs := make([]uint, len(snapshot.Paths))
+	for i, path := range snapshot.Paths {
+		cameraIDs[i] = path.CameraID
+	}
+	var existing []uint
+	if err := requestDB(h.db, c).Model(&models.Camera{}).Where("id IN ?", cameraIDs).Pluck("id", &existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+		return
+	}
+	known := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		known[id] = true
+	}
+
+	skipped := []string{}
+	paths := snapshot.Paths[:0]
+	for _, path := range snapshot.Paths {
+		if !known[path.CameraID] {
+			skipped = append(skipped, path.Path)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	snapshot.Paths = paths
+
+	applied, failed := h.mediamtxService.ImportSnapshot(&snapshot)
+
+	recordAudit(h.db, c, "import", "mediamtx_config", "", fmt.Sprintf("%d applied, %d failed, %d skipped", applied, len(failed), len(skipped)))
+
+	status := http.StatusOK
+	if len(failed) > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, gin.H{
+		"applied": applied,
+		"failed":  failed,
+		"skipped": skipped,
+	})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsHandler struct {
+	metrics *services.RequestMetrics
+}
+
+func NewMetricsHandler(metrics *services.RequestMetrics) *MetricsHandler {
+	return &MetricsHandler{
+		metrics: metrics,
+	}
+}
+
+// GetRequestMetrics returns per-route latency histograms, slowest p95 first
+// Query: ?route= to only return one route pattern
+func (h *MetricsHandler) GetRequestMetrics(c *gin.Context) {
+	routes, since := h.metrics.Snapshot()
+	if route := c.Query("route"); route != "" {
+		filtered := []services.RouteMetrics{}
+		for _, metrics := range routes {
+			if metrics.Route == route {
+				filtered = append(filtered, metrics)
+			}
+		}
+		routes = filtered
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since":  since,
+		"routes": routes,
+	})
+}
+
+// ResetRequestMetrics clears the histograms, e.g. before measuring a peak
+func (h *MetricsHandler) ResetRequestMetrics(c *gin.Context) {
+	h.metrics.Reset()
+	c.JSON(http.StatusOK, gin.H{"message": "Request metrics reset"})
+}
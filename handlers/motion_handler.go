@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MotionHandler struct {
+	db *gorm.DB
+}
+
+func NewMotionHandler(db *gorm.DB) *MotionHandler {
+	return &MotionHandler{
+		db: db,
+	}
+}
+
+// MotionEventItem is a motion event with the URL of its snapshot
+type MotionEventItem struct {
+	models.MotionEvent
+	SnapshotURL string `json:"snapshot_url,omitempty"`
+}
+
+// ListMotionEvents returns a camera's motion events newest first using
+// cursor pagination
+// Query: ?after=&limit=&from=&to=
+func (h *MotionHandler) ListMotionEvents(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id").First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.MotionEvent{}).
+		Scopes(database.ForCamera(camera.ID), database.TimeRange("detected_at", from, to))
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("detected_at", cursor.Time, cursor.ID))
+	}
+
+	var motions []models.MotionEvent
+	if err := query.Scopes(database.NewestFirst("detected_at")).Limit(limit + 1).Find(&motions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch motion events"})
+		return
+	}
+
+	// Same API version as the request: /api/v1/cameras/:id/motion-events -> /api/v1
+	prefix := strings.TrimSuffix(c.FullPath(), "/cameras/:id/motion-events")
+	items := make([]MotionEventItem, len(motions))
+	for i, motion := range motions {
+		items[i].MotionEvent = motion
+		if motion.SnapshotPath != "" {
+			items[i].SnapshotURL = fmt.Sprintf("%s/cameras/%d/motion-events/%d/snapshot", prefix, camera.ID, motion.ID)
+		}
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(items, limit, func(item MotionEventItem) (time.Time, uint) {
+		return item.DetectedAt, item.ID
+	}))
+}
+
+// ServeMotionSnapshot serves the JPEG of the frame that started a motion
+// event
+func (h *MotionHandler) ServeMotionSnapshot(c *gin.Context) {
+	var motion models.MotionEvent
+	if err := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).First(&motion, c.Param("eventId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Motion event not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch motion event"})
+		return
+	}
+	if motion.SnapshotPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Motion event has no snapshot"})
+		return
+	}
+
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.File(motion.SnapshotPath)
+}
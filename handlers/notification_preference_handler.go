@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxNotificationHistory = 200
+
+var alertSeverities = map[string]bool{"info": true, "warning": true, "critical": true}
+
+type NotificationPreferenceHandler struct {
+	db *gorm.DB
+}
+
+func NewNotificationPreferenceHandler(db *gorm.DB) *NotificationPreferenceHandler {
+	return &NotificationPreferenceHandler{
+		db: db,
+	}
+}
+
+type NotificationPreferenceRequest struct {
+	Enabled         *bool     `json:"enabled"`
+	CriticalChannel *string   `json:"critical_channel" binding:"omitempty,oneof=sms email digest none"`
+	WarningChannel  *string   `json:"warning_channel" binding:"omitempty,oneof=sms email digest none"`
+	InfoChannel     *string   `json:"info_channel" binding:"omitempty,oneof=sms email digest none"`
+	QuietDays       *string   `json:"quiet_days"`
+	QuietStart      *string   `json:"quiet_start"`
+	QuietEnd        *string   `json:"quiet_end"`
+	QuietBypass     *[]string `json:"quiet_bypass"` // Severities sent right away during quiet hours
+}
+
+// apply copies the provided fields onto preference and validates the result
+func (req *NotificationPreferenceRequest) apply(preference *models.NotificationPreference) error {
+	if req.Enabled != nil {
+		preference.Enabled = *req.Enabled
+	}
+	if req.CriticalChannel != nil {
+		preference.CriticalChannel = *req.CriticalChannel
+	}
+	if req.WarningChannel != nil {
+		preference.WarningChannel = *req.WarningChannel
+	}
+	if req.InfoChannel != nil {
+		preference.InfoChannel = *req.InfoChannel
+	}
+	if req.QuietDays != nil {
+		preference.QuietDays = *req.QuietDays
+	}
+	if req.QuietStart != nil {
+		preference.QuietStart = *req.QuietStart
+	}
+	if req.QuietEnd != nil {
+		preference.QuietEnd = *req.QuietEnd
+	}
+	if req.QuietBypass != nil {
+		for _, severity := range *req.QuietBypass {
+			if !alertSeverities[severity] {
+				return fmt.Errorf("invalid severity %q in quiet_bypass", severity)
+			}
+		}
+		preference.QuietBypass = strings.Join(*req.QuietBypass, ",")
+	}
+	if err := validateSchedule(preference.QuietDays, preference.QuietStart, preference.QuietEnd); err != nil {
+		return err
+	}
+	return nil
+}
+
+// defaultNotificationPreference is what a user starts from: critical alerts
+// by SMS at any time, warnings by email and the rest in the digest
+func defaultNotificationPreference(userID uint) models.NotificationPreference {
+	return models.NotificationPreference{
+		UserID:          userID,
+		CriticalChannel: models.ChannelSMS,
+		WarningChannel:  models.ChannelEmail,
+		InfoChannel:     models.ChannelDigest,
+		QuietBypass:     "critical",
+	}
+}
+
+// GetMyNotificationPreference returns the current user's alert routing.
+// Users who never saved one get the defaults, disabled.
+func (h *NotificationPreferenceHandler) GetMyNotificationPreference(c *gin.Context) {
+	userID := currentUserID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	preference := defaultNotificationPreference(*userID)
+	if err := requestDB(h.db, c).Where("user_id = ?", *userID).First(&preference).Error; err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preference)
+}
+
+// UpdateMyNotificationPreference changes the current user's alert routing
+// and quiet hours. Saving for the first time enables notifications unless
+// enabled is false.
+func (h *NotificationPreferenceHandler) UpdateMyNotificationPreference(c *gin.Context) {
+	userID := currentUserID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req NotificationPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preference := defaultNotificationPreference(*userID)
+	preference.Enabled = true
+	if err := requestDB(h.db, c).Where("user_id = ?", *userID).First(&preference).Error; err != nil && err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+	if err := req.apply(&preference); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Save(&preference).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification preferences"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "notification_preference", fmt.Sprint(*userID),
+		fmt.Sprintf("critical=%s warning=%s info=%s quiet=%s-%s", preference.CriticalChannel, preference.WarningChannel,
+			preference.InfoChannel, preference.QuietStart, preference.QuietEnd))
+
+	c.JSON(http.StatusOK, preference)
+}
+
+// ListMyNotifications returns the alert notifications sent to the current
+// user, or waiting for their digest, newest first
+// Query: ?status=pending|sent|failed
+func (h *NotificationPreferenceHandler) ListMyNotifications(c *gin.Context) {
+	userID := currentUserID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	query := requestDB(h.db, c).Where("user_id = ?", *userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	notifications := []models.AlertNotification{}
+	if err := query.Order("created_at DESC").Limit(maxNotificationHistory).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
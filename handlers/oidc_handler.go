@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcCookie carries a login's state between the redirect to the identity
+// provider and its callback
+const oidcCookie = "vms_oidc"
+
+// OIDCLogin sends the browser to the identity provider to sign in; it comes
+// back on OIDCCallback
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	login, err := h.oidc.Begin()
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("[OIDC] Failed to start login: %v\n", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	// Lax, so the cookie comes along on the provider's redirect back
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, login.Cookie, int((10 * time.Minute).Seconds()), "/", "", h.oidc.Secure(), true)
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, login.URL)
+}
+
+// OIDCCallback completes a login at the identity provider: the user is
+// found or created, a session started, and the browser sent to the
+// frontend with the tokens in the URL fragment, or an error
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	cookie, _ := c.Cookie(oidcCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, "", -1, "/", "", h.oidc.Secure(), true)
+	c.Header("Cache-Control", "no-store")
+
+	if providerError := c.Query("error"); providerError != "" {
+		message := providerError
+		if description := c.Query("error_description"); description != "" {
+			message += ": " + description
+		}
+		h.oidcRedirect(c, url.Values{"error": {message}})
+		return
+	}
+
+	identity, err := h.oidc.Complete(cookie, c.Query("state"), c.Query("code"))
+	if err != nil {
+		fmt.Printf("[OIDC] Login failed: %v\n", err)
+		message := "Sign-in failed"
+		if errors.Is(err, services.ErrOIDCState) || errors.Is(err, services.ErrOIDCNoEmail) || errors.Is(err, services.ErrOIDCDisabled) {
+			message = err.Error()
+		}
+		h.oidcRedirect(c, url.Values{"error": {message}})
+		return
+	}
+
+	user, err := h.oidc.Provision(identity)
+	if err != nil {
+		fmt.Printf("[OIDC] Login of %s refused: %v\n", identity.Email, err)
+		message := "Sign-in failed"
+		if errors.Is(err, services.ErrOIDCUnknownUser) || errors.Is(err, services.ErrOIDCNotPermitted) || errors.Is(err, services.ErrOIDCNotLinked) {
+			message = err.Error()
+		}
+		h.oidcRedirect(c, url.Values{"error": {message}})
+		return
+	}
+
+	tokens, err := h.sessions.Create(user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		h.oidcRedirect(c, url.Values{"error": {"Failed to generate token"}})
+		return
+	}
+	fmt.Printf("[OIDC] User %d (%s) signed in\n", user.ID, user.Email)
+
+	h.oidcRedirect(c, url.Values{
+		"token":              {tokens.Token},
+		"expires_at":         {tokens.ExpiresAt.UTC().Format(time.RFC3339)},
+		"refresh_token":      {tokens.RefreshToken},
+		"refresh_expires_at": {tokens.RefreshExpiresAt.UTC().Format(time.RFC3339)},
+	})
+}
+
+// oidcRedirect sends the browser to the frontend with values in the
+// fragment, which browsers don't send to servers or put in Referer headers
+func (h *AuthHandler) oidcRedirect(c *gin.Context, values url.Values) {
+	c.Redirect(http.StatusFound, h.oidc.FrontendURL()+"#"+values.Encode())
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"command-center-vms-cctv/be/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// CursorPage is the response envelope for keyset-paginated lists.
+// Pass next_cursor back as ?after= to fetch the following page.
+type CursorPage struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	HasMore    bool        `json:"has_more"`
+}
+
+// OffsetPage is the response envelope for numbered pages, for lists the UI
+// shows as pages with a total
+type OffsetPage struct {
+	Items interface{} `json:"items"`
+	Total int64       `json:"total"`
+	Page  int         `json:"page"`
+	Limit int         `json:"limit"`
+}
+
+// parseOffsetParams reads ?page= (from 1) and ?limit= from the request
+func parseOffsetParams(c *gin.Context) (int, int, error) {
+	page := 1
+	if raw := c.Query("page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid page")
+		}
+		page = n
+	}
+	limit := defaultPageLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit")
+		}
+		if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		limit = n
+	}
+	return page, limit, nil
+}
+
+// parseCursorParams reads ?after= and ?limit= from the request
+func parseCursorParams(c *gin.Context) (*utils.Cursor, int, error) {
+	limit := defaultPageLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return nil, 0, fmt.Errorf("invalid limit")
+		}
+		if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		limit = n
+	}
+
+	var cursor *utils.Cursor
+	if raw := c.Query("after"); raw != "" {
+		decoded, err := utils.DecodeCursor(raw)
+		if err != nil {
+			return nil, 0, err
+		}
+		cursor = decoded
+	}
+
+	return cursor, limit, nil
+}
+
+// buildCursorPage trims the extra look-ahead row (queries fetch limit+1)
+// and derives the cursor for the next page from the last returned item
+func buildCursorPage[T any](items []T, limit int, key func(T) (time.Time, uint)) CursorPage {
+	page := CursorPage{Items: items}
+	if len(items) > limit {
+		items = items[:limit]
+		t, id := key(items[len(items)-1])
+		page.Items = items
+		page.NextCursor = utils.EncodeCursor(t, id)
+		page.HasMore = true
+	}
+	return page
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter
+func parseTimeParam(c *gin.Context, name string) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, expected RFC3339 timestamp", name)
+	}
+	return &t, nil
+}
+
+// parseUintParam parses an optional unsigned integer query parameter
+func parseUintParam(c *gin.Context, name string) (uint, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return uint(n), nil
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	earthRadiusMeters = 6371000
+	metersPerDegree   = 111320 // Of latitude; of longitude at the equator
+
+	// Check-ins queued on a phone without signal arrive late, but not days late
+	maxCheckInAge = 24 * time.Hour
+)
+
+type PatrolHandler struct {
+	db     *gorm.DB
+	config config.PatrolConfig
+}
+
+func NewPatrolHandler(db *gorm.DB, cfg config.PatrolConfig) *PatrolHandler {
+	return &PatrolHandler{
+		db:     db,
+		config: cfg,
+	}
+}
+
+type CheckInRequest struct {
+	Latitude       *float64   `json:"latitude" binding:"required"`
+	Longitude      *float64   `json:"longitude" binding:"required"`
+	AccuracyMeters float64    `json:"accuracy_meters"`
+	Checkpoint     string     `json:"checkpoint"`
+	Notes          string     `json:"notes"`
+	CheckedInAt    *time.Time `json:"checked_in_at"` // When the guard checked in; defaults to now
+}
+
+// CreateCheckIn records a patrol check-in of the current user and bookmarks
+// the cameras within the bookmark radius (widened by the reported GPS
+// accuracy, up to double) around the check-in time
+func (h *PatrolHandler) CreateCheckIn(c *gin.Context) {
+	userID := currentUserID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req CheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *req.Latitude < -90 || *req.Latitude > 90 || *req.Longitude < -180 || *req.Longitude > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "latitude must be between -90 and 90 and longitude between -180 and 180"})
+		return
+	}
+	if req.AccuracyMeters < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "accuracy_meters must not be negative"})
+		return
+	}
+
+	now := time.Now()
+	checkIn := models.PatrolCheckIn{
+		UserID:         *userID,
+		Latitude:       *req.Latitude,
+		Longitude:      *req.Longitude,
+		AccuracyMeters: req.AccuracyMeters,
+		Checkpoint:     strings.TrimSpace(req.Checkpoint),
+		Notes:          req.Notes,
+		CheckedInAt:    now,
+	}
+	if req.CheckedInAt != nil {
+		if req.CheckedInAt.After(now.Add(time.Minute)) || now.Sub(*req.CheckedInAt) > maxCheckInAge {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("checked_in_at must be within the last %s", maxCheckInAge)})
+			return
+		}
+		checkIn.CheckedInAt = *req.CheckedInAt
+	}
+
+	bookmarks, err := h.nearbyBookmarks(&checkIn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find nearby cameras"})
+		return
+	}
+	checkIn.Bookmarks = bookmarks
+
+	if err := requestDB(h.db, c).Create(&checkIn).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record check-in"})
+		return
+	}
+
+	recordAudit(h.db, c, "check_in", "patrol", fmt.Sprint(checkIn.ID), fmt.Sprintf(
+		"%.6f,%.6f %s: %d cameras bookmarked", checkIn.Latitude, checkIn.Longitude, checkIn.Checkpoint, len(bookmarks)))
+
+	h.fillPlaybackURLs(c, &checkIn)
+	c.JSON(http.StatusCreated, checkIn)
+}
+
+// ListCheckIns returns patrol check-ins with their bookmarks, newest first
+// using cursor pagination. Admins see everyone's, other users their own.
+// Query: ?after=&limit=&user_id=&from=&to=
+func (h *PatrolHandler) ListCheckIns(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := parseUintParam(c, "user_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.GetString("role") != "admin" {
+		current := currentUserID(c)
+		if current == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		userID = *current
+	}
+
+	query := requestDB(h.db, c).Model(&models.PatrolCheckIn{}).Preload("Bookmarks", nearestFirst).
+		Scopes(database.TimeRange("checked_in_at", from, to))
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("checked_in_at", cursor.Time, cursor.ID))
+	}
+
+	var checkIns []models.PatrolCheckIn
+	if err := query.Scopes(database.NewestFirst("checked_in_at")).Limit(limit + 1).Find(&checkIns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-ins"})
+		return
+	}
+	for i := range checkIns {
+		h.fillPlaybackURLs(c, &checkIns[i])
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(checkIns, limit, func(checkIn models.PatrolCheckIn) (time.Time, uint) {
+		return checkIn.CheckedInAt, checkIn.ID
+	}))
+}
+
+// GetCheckIn returns one check-in with its bookmarks
+func (h *PatrolHandler) GetCheckIn(c *gin.Context) {
+	var checkIn models.PatrolCheckIn
+	if err := requestDB(h.db, c).Preload("Bookmarks", nearestFirst).First(&checkIn, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Check-in not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-in"})
+		return
+	}
+	userID := currentUserID(c)
+	if c.GetString("role") != "admin" && (userID == nil || checkIn.UserID != *userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Check-in not found"})
+		return
+	}
+
+	h.fillPlaybackURLs(c, &checkIn)
+	c.JSON(http.StatusOK, checkIn)
+}
+
+// nearbyBookmarks bookmarks the cameras close to a check-in, nearest first.
+// A bounding box narrows the cameras down before the exact distance.
+func (h *PatrolHandler) nearbyBookmarks(checkIn *models.PatrolCheckIn) ([]models.PatrolBookmark, error) {
+	radius := h.config.BookmarkRadius + math.Min(checkIn.AccuracyMeters, h.config.BookmarkRadius)
+	latDelta := radius / metersPerDegree
+	lonDelta := 180.0
+	if cos := math.Cos(checkIn.Latitude * math.Pi / 180); cos > 0.01 {
+		lonDelta = math.Min(radius/(metersPerDegree*cos), 180)
+	}
+
+	var cameras []models.Camera
+	if err := h.db.Select("id", "latitude", "longitude").
+		Where("latitude BETWEEN ? AND ?", checkIn.Latitude-latDelta, checkIn.Latitude+latDelta).
+		Where("longitude BETWEEN ? AND ?", checkIn.Longitude-lonDelta, checkIn.Longitude+lonDelta).
+		Find(&cameras).Error; err != nil {
+		return nil, err
+	}
+
+	bookmarks := []models.PatrolBookmark{}
+	for _, camera := range cameras {
+		distance := distanceMeters(checkIn.Latitude, checkIn.Longitude, camera.Latitude, camera.Longitude)
+		if distance > radius {
+			continue
+		}
+		bookmarks = append(bookmarks, models.PatrolBookmark{
+			CameraID:       camera.ID,
+			DistanceMeters: math.Round(distance*10) / 10,
+			From:           checkIn.CheckedInAt.Add(-h.config.BookmarkWindow),
+			To:             checkIn.CheckedInAt.Add(h.config.BookmarkWindow),
+		})
+	}
+	sort.SliceStable(bookmarks, func(i, j int) bool { return bookmarks[i].DistanceMeters < bookmarks[j].DistanceMeters })
+	return bookmarks, nil
+}
+
+// fillPlaybackURLs links each bookmark to the camera's recordings
+func (h *PatrolHandler) fillPlaybackURLs(c *gin.Context, checkIn *models.PatrolCheckIn) {
+	// Same API version as the request: /api/v1/patrols/check-ins/:id -> /api/v1
+	prefix, _, _ := strings.Cut(c.FullPath(), "/patrols/")
+	for i := range checkIn.Bookmarks {
+		bookmark := &checkIn.Bookmarks[i]
+		bookmark.PlaybackURL = playbackURL(prefix, bookmark.CameraID, bookmark.From, bookmark.To)
+	}
+}
+
+func nearestFirst(db *gorm.DB) *gorm.DB {
+	return db.Order("distance_meters, id")
+}
+
+// distanceMeters is the great-circle (haversine) distance between two points
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxPlaybackCameras = 16
+	minPlaybackRate    = 0.1
+	maxPlaybackRate    = 16
+)
+
+type PlaybackHandler struct {
+	db       *gorm.DB
+	playback *services.PlaybackService
+}
+
+func NewPlaybackHandler(db *gorm.DB, playback *services.PlaybackService) *PlaybackHandler {
+	return &PlaybackHandler{
+		db:       db,
+		playback: playback,
+	}
+}
+
+type CreatePlaybackSessionRequest struct {
+	CameraIDs []uint    `json:"camera_ids" binding:"required"`
+	StartTime time.Time `json:"start_time" binding:"required"`
+	Rate      float64   `json:"rate"` // Default 1
+}
+
+type PlaybackControlRequest struct {
+	Action    string     `json:"action" binding:"required,oneof=play pause seek rate cameras"`
+	Position  *time.Time `json:"position"`   // seek
+	Rate      *float64   `json:"rate"`       // rate
+	CameraIDs []uint     `json:"camera_ids"` // cameras
+}
+
+// CreatePlaybackSession starts a paused synchronized playback of several
+// cameras at a common start time
+func (h *PlaybackHandler) CreatePlaybackSession(c *gin.Context) {
+	var req CreatePlaybackSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Rate == 0 {
+		req.Rate = 1
+	}
+	if err := h.validateCameras(req.CameraIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePlaybackRate(req.Rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ownerID uint
+	if id := currentUserID(c); id != nil {
+		ownerID = *id
+	}
+	msg, err := h.playback.Create(ownerID, req.CameraIDs, req.StartTime, req.Rate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create playback session"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, msg)
+}
+
+// GetPlaybackSession returns a session's current position and recordings
+func (h *PlaybackHandler) GetPlaybackSession(c *gin.Context) {
+	msg, ok := h.ownSession(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, msg)
+}
+
+// ownSession loads the session in :id when the current user created it
+// (admins reach every session); others get 404, as for unknown sessions
+func (h *PlaybackHandler) ownSession(c *gin.Context) (services.PlaybackMessage, bool) {
+	msg, err := h.playback.Get(c.Param("id"))
+	if err != nil {
+		playbackError(c, err)
+		return msg, false
+	}
+	userID := currentUserID(c)
+	if c.GetString("role") != "admin" && (userID == nil || msg.Session.OwnerID != *userID) {
+		playbackError(c, services.ErrPlaybackSessionNotFound)
+		return msg, false
+	}
+	return msg, true
+}
+
+// ControlPlaybackSession plays, pauses, seeks, changes the rate or the
+// cameras of a session, and broadcasts the result to its clients
+func (h *PlaybackHandler) ControlPlaybackSession(c *gin.Context) {
+	var req PlaybackControlRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	control := services.PlaybackControl{Action: req.Action, CameraIDs: req.CameraIDs}
+	switch req.Action {
+	case services.PlaybackSeek:
+		if req.Position == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "position is required to seek"})
+			return
+		}
+		control.Position = *req.Position
+	case services.PlaybackRate:
+		if req.Rate == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rate is required"})
+			return
+		}
+		if err := validatePlaybackRate(*req.Rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		control.Rate = *req.Rate
+	case services.PlaybackCameras:
+		if err := h.validateCameras(req.CameraIDs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if _, ok := h.ownSession(c); !ok {
+		return
+	}
+	msg, err := h.playback.Control(c.Param("id"), control)
+	if err != nil {
+		playbackError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, msg)
+}
+
+func (h *PlaybackHandler) DeletePlaybackSession(c *gin.Context) {
+	if _, ok := h.ownSession(c); !ok {
+		return
+	}
+	if err := h.playback.Delete(c.Param("id")); err != nil {
+		playbackError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Playback session ended"})
+}
+
+// HandlePlaybackWebSocket is the channel session clients receive controls on
+func (h *PlaybackHandler) HandlePlaybackWebSocket(c *gin.Context) {
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	if _, ok := h.ownSession(c); !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		fmt.Printf("[Playback] WebSocket upgrade failed for session %s: %v\n", c.Param("id"), err)
+		return
+	}
+
+	h.playback.HandleWebSocket(conn, c.Param("id"))
+}
+
+// validateCameras checks a session's camera list: 1 to maxPlaybackCameras
+// existing cameras
+func (h *PlaybackHandler) validateCameras(ids []uint) error {
+	if len(ids) == 0 || len(ids) > maxPlaybackCameras {
+		return fmt.Errorf("camera_ids must list 1 to %d cameras", maxPlaybackCameras)
+	}
+	var count int64
+	if err := h.db.Model(&models.Camera{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check cameras")
+	}
+	if int(count) != len(ids) {
+		return fmt.Errorf("camera_ids contains unknown or duplicate cameras")
+	}
+	return nil
+}
+
+func validatePlaybackRate(rate float64) error {
+	if rate < minPlaybackRate || rate > maxPlaybackRate {
+		return fmt.Errorf("rate must be between %g and %g", minPlaybackRate, float64(maxPlaybackRate))
+	}
+	return nil
+}
+
+func playbackError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrPlaybackSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playback session not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load playback session"})
+}
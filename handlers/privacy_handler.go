@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PrivacyHandler struct {
+	db      *gorm.DB
+	privacy *services.PrivacyService
+}
+
+func NewPrivacyHandler(db *gorm.DB, privacy *services.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{
+		db:      db,
+		privacy: privacy,
+	}
+}
+
+type PrivacyScheduleRequest struct {
+	Name          *string `json:"name"`
+	ScheduleDays  *string `json:"schedule_days"`
+	ScheduleStart *string `json:"schedule_start"`
+	ScheduleEnd   *string `json:"schedule_end"`
+	Reason        *string `json:"reason"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// apply copies the provided fields onto schedule and validates the result
+func (req *PrivacyScheduleRequest) apply(schedule *models.PrivacySchedule) error {
+	if req.Name != nil {
+		schedule.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.ScheduleDays != nil {
+		schedule.ScheduleDays = *req.ScheduleDays
+	}
+	if req.ScheduleStart != nil {
+		schedule.ScheduleStart = *req.ScheduleStart
+	}
+	if req.ScheduleEnd != nil {
+		schedule.ScheduleEnd = *req.ScheduleEnd
+	}
+	if req.Reason != nil {
+		schedule.Reason = *req.Reason
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	return validateSchedule(schedule.ScheduleDays, schedule.ScheduleStart, schedule.ScheduleEnd)
+}
+
+// PrivacyStatus is a camera's privacy schedules and the one blacking it out
+// now, if any
+type PrivacyStatus struct {
+	Active    *models.PrivacySchedule  `json:"active"`
+	Schedules []models.PrivacySchedule `json:"schedules"`
+}
+
+// ListPrivacySchedules returns the privacy schedules of a camera and whether
+// it is in privacy mode
+func (h *PrivacyHandler) ListPrivacySchedules(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	status := PrivacyStatus{Schedules: []models.PrivacySchedule{}}
+	if err := requestDB(h.db, c).Where("camera_id = ?", camera.ID).Order("id").Find(&status.Schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch privacy schedules"})
+		return
+	}
+	if schedule, private := h.privacy.Active(camera.ID); private {
+		status.Active = &schedule
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// CreatePrivacySchedule adds a weekly privacy window to a camera. A window
+// already under way blacks the camera out right away on this instance, on
+// the others at the next minute.
+func (h *PrivacyHandler) CreatePrivacySchedule(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	var req PrivacyScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := models.PrivacySchedule{
+		CameraID: camera.ID,
+		Enabled:  true,
+	}
+	if err := req.apply(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := requestDB(h.db, c).Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create privacy schedule"})
+		return
+	}
+	h.apply()
+
+	recordAudit(h.db, c, "create", "privacy_schedule", fmt.Sprint(schedule.ID), fmt.Sprintf("camera %d: days=%q %s-%s %s",
+		schedule.CameraID, schedule.ScheduleDays, schedule.ScheduleStart, schedule.ScheduleEnd, schedule.Reason))
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func (h *PrivacyHandler) UpdatePrivacySchedule(c *gin.Context) {
+	var schedule models.PrivacySchedule
+	if err := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).First(&schedule, c.Param("scheduleId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Privacy schedule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch privacy schedule"})
+		return
+	}
+
+	var req PrivacyScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := requestDB(h.db, c).Save(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy schedule"})
+		return
+	}
+	h.apply()
+
+	recordAudit(h.db, c, "update", "privacy_schedule", fmt.Sprint(schedule.ID), fmt.Sprintf("camera %d: enabled=%v days=%q %s-%s",
+		schedule.CameraID, schedule.Enabled, schedule.ScheduleDays, schedule.ScheduleStart, schedule.ScheduleEnd))
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (h *PrivacyHandler) DeletePrivacySchedule(c *gin.Context) {
+	result := requestDB(h.db, c).Where("camera_id = ?", c.Param("id")).Delete(&models.PrivacySchedule{}, c.Param("scheduleId"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete privacy schedule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Privacy schedule not found"})
+		return
+	}
+	h.apply()
+
+	recordAudit(h.db, c, "delete", "privacy_schedule", c.Param("scheduleId"), "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Privacy schedule deleted successfully"})
+}
+
+// ListPrivacyBlackouts returns the windows cameras spent in privacy mode,
+// newest first using cursor pagination; ended_at is null for ongoing ones
+// Query: ?after=&limit=&camera_id=&from=&to=
+func (h *PrivacyHandler) ListPrivacyBlackouts(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.PrivacyBlackout{}).Scopes(database.TimeRange("started_at", from, to))
+	if cameraID != 0 {
+		query = query.Where("camera_id = ?", cameraID)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("started_at", cursor.Time, cursor.ID))
+	}
+
+	var blackouts []models.PrivacyBlackout
+	if err := query.Scopes(database.NewestFirst("started_at")).Limit(limit + 1).Find(&blackouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch privacy blackouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(blackouts, limit, func(blackout models.PrivacyBlackout) (time.Time, uint) {
+		return blackout.StartedAt, blackout.ID
+	}))
+}
+
+// apply enforces a schedule change on this instance right away
+func (h *PrivacyHandler) apply() {
+	if err := h.privacy.Apply(time.Now()); err != nil {
+		fmt.Printf("[Privacy] Failed to apply privacy schedules: %v\n", err)
+	}
+}
+
+func (h *PrivacyHandler) findCamera(c *gin.Context) (*models.Camera, bool) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return nil, false
+	}
+	return &camera, true
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultQualityHistory is the sample history returned without ?from=
+const defaultQualityHistory = 7 * 24 * time.Hour
+
+type QualityHandler struct {
+	db             *gorm.DB
+	qualityService *services.QualityService
+}
+
+func NewQualityHandler(db *gorm.DB, qualityService *services.QualityService) *QualityHandler {
+	return &QualityHandler{
+		db:             db,
+		qualityService: qualityService,
+	}
+}
+
+// DegradedCamera is a camera with confirmed image quality issues
+type DegradedCamera struct {
+	services.QualityStatus
+	CameraName string `json:"camera_name"`
+	Area       string `json:"area"`
+	Building   string `json:"building"`
+}
+
+// GetQuality returns a camera's image quality state and its samples
+// Query: ?from=&to= (default the last 7 days)
+func (h *QualityHandler) GetQuality(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from == nil {
+		since := time.Now().Add(-defaultQualityHistory)
+		from = &since
+	}
+
+	samples := []models.QualitySample{}
+	if err := requestDB(h.db, c).Where("camera_id = ?", camera.ID).
+		Scopes(database.TimeRange("sampled_at", from, to)).
+		Order("sampled_at").Find(&samples).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quality samples"})
+		return
+	}
+
+	response := gin.H{
+		"camera_id": camera.ID,
+		"status":    nil,
+		"samples":   samples,
+	}
+	if status, ok := h.qualityService.GetStatus(camera.ID); ok {
+		response["status"] = status
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CheckQuality samples a camera's image quality now
+func (h *QualityHandler) CheckQuality(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+
+	status := h.qualityService.Check(camera)
+	if status.Error != "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Failed to sample image quality: %s", status.Error)})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// ResetQuality forgets a camera's quality history so a new baseline is
+// learned, e.g. after the camera was replaced or re-aimed
+func (h *QualityHandler) ResetQuality(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.qualityService.Reset(camera.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset image quality"})
+		return
+	}
+
+	recordAudit(h.db, c, "reset_quality", "camera", fmt.Sprint(camera.ID), fmt.Sprintf("%s: %d samples deleted", camera.Name, deleted))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image quality history reset", "samples_deleted": deleted})
+}
+
+// ListDegradedCameras returns the cameras with confirmed image quality
+// issues, lowest score first
+func (h *QualityHandler) ListDegradedCameras(c *gin.Context) {
+	statuses := h.qualityService.Degraded()
+	ids := make([]uint, 0, len(statuses))
+	for _, status := range statuses {
+		ids = append(ids, status.CameraID)
+	}
+
+	var cameras []models.Camera
+	if len(ids) > 0 {
+		if err := requestDB(h.db, c).Select("id", "name", "area", "building").Where("id IN ?", ids).Find(&cameras).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cameras"})
+			return
+		}
+	}
+	byID := make(map[uint]models.Camera, len(cameras))
+	for _, camera := range cameras {
+		byID[camera.ID] = camera
+	}
+
+	degraded := make([]DegradedCamera, 0, len(statuses))
+	for _, status := range statuses {
+		camera, ok := byID[status.CameraID]
+		if !ok {
+			continue // Deleted since
+		}
+		degraded = append(degraded, DegradedCamera{
+			QualityStatus: status,
+			CameraName:    camera.Name,
+			Area:          camera.Area,
+			Building:      camera.Building,
+		})
+	}
+
+	c.JSON(http.StatusOK, degraded)
+}
+
+func (h *QualityHandler) findCamera(c *gin.Context) (*models.Camera, bool) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return nil, false
+	}
+	return &camera, true
+}
@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RecordingHandler struct {
+	db         *gorm.DB
+	recordings *services.RecordingService
+	thumbnails *services.ThumbnailService
+	tokens     *services.StreamTokenService
+	cluster    *services.ClusterService
+	scheduler  *services.TranscodeScheduler
+}
+
+func NewRecordingHandler(db *gorm.DB, recordings *services.RecordingService, thumbnails *services.ThumbnailService, streamTokens *services.StreamTokenService, cluster *services.ClusterService, scheduler *services.TranscodeScheduler) *RecordingHandler {
+	return &RecordingHandler{
+		db:         db,
+		recordings: recordings,
+		thumbnails: thumbnails,
+		tokens:     streamTokens,
+		cluster:    cluster,
+		scheduler:  scheduler,
+	}
+}
+
+// leaderURL is where the cluster leader, which runs the recorders, is
+// reached; "" when unknown
+func (h *RecordingHandler) leaderURL() string {
+	leader, err := h.cluster.Leader()
+	if err != nil || leader == nil {
+		return ""
+	}
+	return leader.AdvertiseURL
+}
+
+// respondNotLeader answers a recording start or stop sent to a follower
+func (h *RecordingHandler) respondNotLeader(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Recordings are started and stopped on the cluster leader", "leader": h.leaderURL()})
+}
+
+type StartRecordingRequest struct {
+	DurationSeconds int `json:"duration_seconds"` // 0 = until stopped
+}
+
+type RecordingScheduleRequest struct {
+	Enabled       bool   `json:"enabled"`
+	ScheduleDays  string `json:"schedule_days"`
+	ScheduleStart string `json:"schedule_start"`
+	ScheduleEnd   string `json:"schedule_end"`
+}
+
+// ListRecordings returns recordings newest first using cursor pagination
+// Query: ?after=&limit=&camera_id=&from=&to=
+func (h *RecordingHandler) ListRecordings(c *gin.Context) {
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.listRecordings(c, cameraID)
+}
+
+// ListCameraRecordings is ListRecordings for the camera in the path
+// Query: ?after=&limit=&from=&to=
+func (h *RecordingHandler) ListCameraRecordings(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	h.listRecordings(c, camera.ID)
+}
+
+func (h *RecordingHandler) listRecordings(c *gin.Context, cameraID uint) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.Recording{}).
+		Scopes(database.ForCamera(cameraID), database.TimeRange("start_time", from, to))
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("start_time", cursor.Time, cursor.ID))
+	}
+
+	var recordings []models.Recording
+	if err := query.Scopes(database.NewestFirst("start_time")).Limit(limit + 1).Find(&recordings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recordings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(recordings, limit, func(r models.Recording) (time.Time, uint) {
+		return r.StartTime, r.ID
+	}))
+}
+
+// CalendarDay is one day of a camera's recording calendar
+type CalendarDay struct {
+	Date            string  `json:"date"`             // YYYY-MM-DD in the requested time zone
+	CoveragePercent float64 `json:"coverage_percent"` // Of the day, or of the elapsed part for today
+	RecordedSeconds int64   `json:"recorded_seconds"`
+	EventCount      int64   `json:"event_count"`
+}
+
+// maxRecordingSpan bounds how long one recording segment can be, so the
+// calendar can find segments that started before the month on the partition key
+const maxRecordingSpan = 24 * time.Hour
+
+// GetRecordingCalendar returns per-day recording coverage and event counts
+// for one month of a camera, for the playback calendar picker
+// Query: ?month=YYYY-MM (default current month)&tz=<IANA zone> (default UTC)
+func (h *RecordingHandler) GetRecordingCalendar(c *gin.Context) {
+	id := c.Param("id")
+
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	loc := time.UTC
+	if tz := c.Query("tz"); tz != "" {
+		parsed, err := time.LoadLocation(tz)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tz"})
+			return
+		}
+		loc = parsed
+	}
+
+	now := time.Now().In(loc)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if raw := c.Query("month"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01", raw, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid month, expected YYYY-MM"})
+			return
+		}
+		monthStart = parsed
+	}
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	// Segments overlapping the month (start_time bound keeps partition pruning)
+	searchFrom := monthStart.Add(-maxRecordingSpan)
+	var recordings []models.Recording
+	if err := requestDB(h.db, c).Select("start_time", "end_time", "status").
+		Scopes(database.ForCamera(camera.ID), database.TimeRange("start_time", &searchFrom, &monthEnd)).
+		Where("status NOT IN ?", []string{"failed", "quarantined"}).
+		Find(&recordings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recordings"})
+		return
+	}
+
+	var eventCounts []struct {
+		Day   time.Time
+		Count int64
+	}
+	if err := requestDB(h.db, c).Model(&models.Event{}).
+		Select("date_trunc('day', occurred_at AT TIME ZONE ?) AS day, COUNT(*) AS count", loc.String()).
+		Scopes(database.ForCamera(camera.ID), database.TimeRange("occurred_at", &monthStart, &monthEnd)).
+		Group("day").
+		Scan(&eventCounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
+		return
+	}
+	eventsByDay := make(map[string]int64, len(eventCounts))
+	for _, ec := range eventCounts {
+		// AT TIME ZONE yields local wall time without a zone
+		eventsByDay[ec.Day.Format("2006-01-02")] = ec.Count
+	}
+
+	days := []CalendarDay{}
+	for dayStart := monthStart; dayStart.Before(monthEnd); dayStart = dayStart.AddDate(0, 0, 1) {
+		dayEnd := dayStart.AddDate(0, 0, 1)
+		date := dayStart.Format("2006-01-02")
+		day := CalendarDay{Date: date, EventCount: eventsByDay[date]}
+
+		windowEnd := dayEnd
+		if now.Before(windowEnd) {
+			windowEnd = now
+		}
+		if windowEnd.After(dayStart) {
+			recorded := recordedDuration(recordings, dayStart, windowEnd, now)
+			day.RecordedSeconds = int64(recorded.Seconds())
+			day.CoveragePercent = math.Round(recorded.Seconds()/windowEnd.Sub(dayStart).Seconds()*1000) / 10
+		}
+		days = append(days, day)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"camera_id": camera.ID,
+		"month":     monthStart.Format("2006-01"),
+		"timezone":  loc.String(),
+		"days":      days,
+	})
+}
+
+// recordedDuration returns how much of [from, to) is covered by recordings,
+// merging overlapping segments. Segments still recording count up to now.
+func recordedDuration(recordings []models.Recording, from, to, now time.Time) time.Duration {
+	type interval struct{ start, end time.Time }
+	var intervals []interval
+	for _, r := range recordings {
+		end := now
+		if r.EndTime != nil {
+			end = *r.EndTime
+		}
+		start := r.StartTime
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			intervals = append(intervals, interval{start, end})
+		}
+	}
+
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start.Before(intervals[j].start) })
+
+	var total time.Duration
+	var current *interval
+	for i := range intervals {
+		iv := intervals[i]
+		if current == nil || iv.start.After(current.end) {
+			if current != nil {
+				total += current.end.Sub(current.start)
+			}
+			current = &iv
+			continue
+		}
+		if iv.end.After(current.end) {
+			current.end = iv.end
+		}
+	}
+	if current != nil {
+		total += current.end.Sub(current.start)
+	}
+	return total
+}
+
+// GetRecordingStatus returns the camera's running recorder and schedule
+func (h *RecordingHandler) GetRecordingStatus(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+
+	response := gin.H{"camera_id": camera.ID, "recording": false}
+	if recorder, running := h.recordings.Status(camera.ID); running {
+		response["recording"] = true
+		response["recorder"] = recorder
+	} else if !h.recordings.Running() {
+		// The recorder runs on the leader; an open segment tells it's recording
+		var open int64
+		requestDB(h.db, c).Model(&models.Recording{}).Where("camera_id = ? AND status = ?", camera.ID, "recording").Count(&open)
+		response["recording"] = open > 0
+		response["leader"] = h.leaderURL()
+	}
+	var schedule models.RecordingSchedule
+	if err := requestDB(h.db, c).Where("camera_id = ?", camera.ID).First(&schedule).Error; err == nil {
+		response["schedule"] = schedule
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// StartRecording starts an on-demand recording of a camera
+func (h *RecordingHandler) StartRecording(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	var req StartRecordingRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.DurationSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration_seconds must not be negative"})
+		return
+	}
+
+	recorder, err := h.recordings.StartOnDemand(camera, time.Duration(req.DurationSeconds)*time.Second)
+	if err != nil {
+		if errors.Is(err, services.ErrNotLeader) {
+			h.respondNotLeader(c)
+			return
+		}
+		if errors.Is(err, services.ErrAlreadyRecording) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Camera is already recording", "recorder": recorder})
+			return
+		}
+		if errors.Is(err, services.ErrFeatureDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Recording is disabled at this camera's site", "reason": "feature_disabled"})
+			return
+		}
+		if errors.Is(err, services.ErrPrivacyMode) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Camera is in privacy mode", "reason": "privacy_mode"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start recording: " + err.Error()})
+		return
+	}
+
+	recordAudit(h.db, c, "start_recording", "camera", fmt.Sprint(camera.ID), fmt.Sprintf("on demand, %ds", req.DurationSeconds))
+
+	c.JSON(http.StatusOK, recorder)
+}
+
+// StopRecording stops a camera's recording. A continuous recording resumes
+// at the next minute while its schedule is active; disable the schedule to
+// stop it for good.
+func (h *RecordingHandler) StopRecording(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	if !h.recordings.Running() {
+		h.respondNotLeader(c)
+		return
+	}
+	if !h.recordings.Stop(camera.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Camera is not recording"})
+		return
+	}
+
+	recordAudit(h.db, c, "stop_recording", "camera", fmt.Sprint(camera.ID), "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recording stopped"})
+}
+
+// SetRecordingSchedule creates or replaces a camera's continuous recording
+// schedule; it takes effect at the next minute
+func (h *RecordingHandler) SetRecordingSchedule(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	var req RecordingScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateSchedule(req.ScheduleDays, req.ScheduleStart, req.ScheduleEnd); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := models.RecordingSchedule{CameraID: camera.ID}
+	if err := requestDB(h.db, c).Where("camera_id = ?", camera.ID).FirstOrInit(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recording schedule"})
+		return
+	}
+	schedule.Enabled = req.Enabled
+	schedule.ScheduleDays = req.ScheduleDays
+	schedule.ScheduleStart = req.ScheduleStart
+	schedule.ScheduleEnd = req.ScheduleEnd
+	if err := requestDB(h.db, c).Save(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recording schedule"})
+		return
+	}
+
+	recordAudit(h.db, c, "set_recording_schedule", "camera", fmt.Sprint(camera.ID), fmt.Sprintf("enabled=%v days=%q %s-%s",
+		schedule.Enabled, schedule.ScheduleDays, schedule.ScheduleStart, schedule.ScheduleEnd))
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DownloadRecording sends one recorded segment of a camera. Range requests
+// resume an interrupted download; only its start is audited.
+func (h *RecordingHandler) DownloadRecording(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	recording, ok := h.findDownloadableRecording(c, camera)
+	if !ok {
+		return
+	}
+
+	if startsDownload(c) {
+		recordAudit(h.db, c, "download", "recording", fmt.Sprint(recording.ID), fmt.Sprintf("camera %d", camera.ID))
+	}
+
+	serveDownload(c, recording.FilePath, fmt.Sprintf("%s-%s", camera.Name, filepath.Base(recording.FilePath)))
+}
+
+// CreateRecordingDownloadLink returns a pre-signed link to download a
+// recorded segment, valid for STREAM_TOKEN_TTL
+func (h *RecordingHandler) CreateRecordingDownloadLink(c *gin.Context) {
+	userID := currentUserID(c)
+	if !h.tokens.Enabled() || userID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pre-signed downloads are disabled"})
+		return
+	}
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	recording, ok := h.findDownloadableRecording(c, camera)
+	if !ok {
+		return
+	}
+
+	prefix := strings.TrimSuffix(c.FullPath(), "/cameras/:id/recordings/:recordingId/download-link")
+	path := fmt.Sprintf("/cameras/%d/recordings/%d/download", camera.ID, recording.ID)
+	c.JSON(http.StatusOK, signedDownloadURL(h.tokens, prefix, path, downloadScope(downloadRecording, camera.ID, recording.ID), *userID))
+}
+
+// findDownloadableRecording loads the completed recording in :recordingId
+// of a camera whose file still exists, answering the request otherwise
+func (h *RecordingHandler) findDownloadableRecording(c *gin.Context, camera *models.Camera) (*models.Recording, bool) {
+	var recording models.Recording
+	if err := requestDB(h.db, c).Where("camera_id = ?", camera.ID).First(&recording, c.Param("recordingId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recording"})
+		return nil, false
+	}
+	if recording.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Recording is %s", recording.Status)})
+		return nil, false
+	}
+	if _, err := os.Stat(recording.FilePath); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Recording file is no longer available"})
+		return nil, false
+	}
+	return &recording, true
+}
+
+// ListRetainedClips returns the clips retention kept of a camera's deleted
+// recordings, newest first
+// Query: ?from=&to= (RFC3339)
+func (h *RecordingHandler) ListRetainedClips(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clips := []models.RetainedClip{}
+	if err := requestDB(h.db, c).Scopes(database.ForCamera(camera.ID), database.TimeRange("start_time", from, to)).
+		Order("start_time DESC").Find(&clips).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch retained clips"})
+		return
+	}
+
+	c.JSON(http.StatusOK, clips)
+}
+
+func (h *RecordingHandler) DownloadRetainedClip(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	clip, ok := h.findRetainedClip(c, camera)
+	if !ok {
+		return
+	}
+
+	if startsDownload(c) {
+		recordAudit(h.db, c, "download", "retained_clip", fmt.Sprint(clip.ID), fmt.Sprintf("camera %d", camera.ID))
+	}
+
+	serveDownload(c, clip.FilePath, fmt.Sprintf("%s-clip-%s", camera.Name, filepath.Base(clip.FilePath)))
+}
+
+// CreateRetainedClipDownloadLink returns a pre-signed link to download a
+// retained clip, valid for STREAM_TOKEN_TTL
+func (h *RecordingHandler) CreateRetainedClipDownloadLink(c *gin.Context) {
+	userID := currentUserID(c)
+	if !h.tokens.Enabled() || userID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pre-signed downloads are disabled"})
+		return
+	}
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	clip, ok := h.findRetainedClip(c, camera)
+	if !ok {
+		return
+	}
+
+	prefix := strings.TrimSuffix(c.FullPath(), "/cameras/:id/retained-clips/:clipId/download-link")
+	path := fmt.Sprintf("/cameras/%d/retained-clips/%d/download", camera.ID, clip.ID)
+	c.JSON(http.StatusOK, signedDownloadURL(h.tokens, prefix, path, downloadScope(downloadRetainedClip, camera.ID, clip.ID), *userID))
+}
+
+// findRetainedClip loads the retained clip in :clipId of a camera whose
+// file still exists, answering the request otherwise
+func (h *RecordingHandler) findRetainedClip(c *gin.Context, camera *models.Camera) (*models.RetainedClip, bool) {
+	var clip models.RetainedClip
+	if err := requestDB(h.db, c).Where("camera_id = ?", camera.ID).First(&clip, c.Param("clipId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Clip not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch clip"})
+		return nil, false
+	}
+	if _, err := os.Stat(clip.FilePath); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Clip file is no longer available"})
+		return nil, false
+	}
+	return &clip, true
+}
+
+func (h *RecordingHandler) findCamera(c *gin.Context) (*models.Camera, bool) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return nil, false
+	}
+	return &camera, true
+}
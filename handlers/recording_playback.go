@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPlaybackRange bounds one playback playlist or timeline
+const maxPlaybackRange = 24 * time.Hour
+
+// PlaybackPiece is the part of one recording that falls in a playback range
+type PlaybackPiece struct {
+	RecordingID uint      `json:"recording_id"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Offset      float64   `json:"-"` // Seconds into the recording file
+
+	recording *models.Recording
+}
+
+// PlaybackGap is a stretch of a playback range without recordings
+type PlaybackGap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// GetPlayback serves a camera's recordings over a time range as an HLS VOD
+// playlist. Each recording becomes one segment, remuxed to MPEG-TS on
+// request without re-encoding; gaps are marked with discontinuities and
+// every segment carries its recording time in EXT-X-PROGRAM-DATE-TIME.
+// Query: ?from=&to= (RFC3339, at most 24h apart)
+func (h *RecordingHandler) GetPlayback(c *gin.Context) {
+	camera, pieces, from, to, ok := h.playbackRange(c)
+	if !ok {
+		return
+	}
+	if len(pieces) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No recordings in the requested range"})
+		return
+	}
+
+	target := 1.0
+	for _, piece := range pieces {
+		target = math.Max(target, math.Ceil(piece.End.Sub(piece.Start).Seconds()))
+	}
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	fmt.Fprintf(&playlist, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", int(target))
+	for i, piece := range pieces {
+		if i > 0 {
+			playlist.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		duration := piece.End.Sub(piece.Start).Seconds()
+		fmt.Fprintf(&playlist, "#EXT-X-PROGRAM-DATE-TIME:%s\n", piece.Start.UTC().Format("2006-01-02T15:04:05.000Z"))
+		fmt.Fprintf(&playlist, "#EXTINF:%.3f,\n", duration)
+		fmt.Fprintf(&playlist, "playback/segments/%d?offset=%.3f&duration=%.3f", piece.RecordingID, piece.Offset, duration)
+		if c.GetBool("signed_playback") {
+			// Pre-signed playlists sign every segment for the same user
+			token, _ := h.tokens.Token(segmentScope(camera.ID, piece.RecordingID), *currentUserID(c))
+			playlist.WriteString("&token=" + url.QueryEscape(token))
+		}
+		playlist.WriteString("\n")
+	}
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+
+	recordAudit(h.db, c, "playback", "camera", fmt.Sprint(camera.ID),
+		fmt.Sprintf("%s to %s", from.Format(time.RFC3339), to.Format(time.RFC3339)))
+
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(playlist.String()))
+}
+
+// GetPlaybackTimeline returns which parts of a time range are recorded, for
+// drawing the playback scrubber
+// Query: ?from=&to= (RFC3339, at most 24h apart)
+func (h *RecordingHandler) GetPlaybackTimeline(c *gin.Context) {
+	camera, pieces, from, to, ok := h.playbackRange(c)
+	if !ok {
+		return
+	}
+
+	gaps := []PlaybackGap{}
+	cursor := from
+	var recorded time.Duration
+	for _, piece := range pieces {
+		if piece.Start.After(cursor) {
+			gaps = append(gaps, PlaybackGap{Start: cursor, End: piece.Start})
+		}
+		recorded += piece.End.Sub(piece.Start)
+		cursor = piece.End
+	}
+	if to.After(cursor) {
+		gaps = append(gaps, PlaybackGap{Start: cursor, End: to})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"camera_id":        camera.ID,
+		"from":             from,
+		"to":               to,
+		"recorded_seconds": int64(recorded.Seconds()),
+		"segments":         pieces,
+		"gaps":             gaps,
+	})
+}
+
+// GetPlaybackThumbnails returns WebVTT thumbnail metadata for the playback
+// playlist of the same range: one cue per sprite tile, timed on the
+// playlist's timeline (gaps left out), pointing at the recording's sprite
+// with a #xywh fragment, as scrubber preview plugins expect
+// Query: ?from=&to= (RFC3339, at most 24h apart)
+func (h *RecordingHandler) GetPlaybackThumbnails(c *gin.Context) {
+	_, pieces, _, _, ok := h.playbackRange(c)
+	if !ok {
+		return
+	}
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	var base float64 // Start of the piece on the playlist timeline
+	for _, piece := range pieces {
+		layout := h.thumbnails.Layout(piece.recording)
+		interval := layout.Interval.Seconds()
+		end := piece.Offset + piece.End.Sub(piece.Start).Seconds()
+		for i := int(piece.Offset / interval); i < layout.Frames; i++ {
+			cueStart, cueEnd := math.Max(float64(i)*interval, piece.Offset), math.Min(float64(i+1)*interval, end)
+			if cueEnd <= cueStart {
+				break
+			}
+			fmt.Fprintf(&vtt, "\n%s --> %s\nsprites/%d#xywh=%d,%d,%d,%d\n",
+				vttTime(base+cueStart-piece.Offset), vttTime(base+cueEnd-piece.Offset), piece.RecordingID,
+				i%layout.Columns*layout.Width, i/layout.Columns*layout.Height, layout.Width, layout.Height)
+		}
+		base += end - piece.Offset
+	}
+
+	c.Data(http.StatusOK, "text/vtt; charset=utf-8", []byte(vtt.String()))
+}
+
+// ServePlaybackSprite sends the thumbnail sprite of a recording, rendering
+// it first if it doesn't exist yet
+func (h *RecordingHandler) ServePlaybackSprite(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	var recording models.Recording
+	if err := requestDB(h.db, c).Where("camera_id = ? AND status = ?", camera.ID, "completed").
+		First(&recording, c.Param("recordingId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+		return
+	}
+	if _, err := os.Stat(recording.FilePath); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Recording file is no longer available"})
+		return
+	}
+
+	path, err := h.thumbnails.Sprite(&recording)
+	if err != nil {
+		if errors.Is(err, services.ErrTranscodeCapacity) {
+			c.Header("Retry-After", "10")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "All transcode slots are in use", "reason": "capacity"})
+			return
+		}
+		fmt.Printf("[Playback] Failed to render sprite of recording %d: %v\n", recording.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render thumbnails"})
+		return
+	}
+
+	// A completed recording never changes, and neither does its sprite
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.File(path)
+}
+
+// vttTime formats seconds as a WebVTT timestamp
+func vttTime(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// ServePlaybackSegment remuxes part of a recording to MPEG-TS for the
+// playback playlist
+// Query: ?offset=&duration= (seconds)
+func (h *RecordingHandler) ServePlaybackSegment(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseFloat(c.DefaultQuery("offset", "0"), 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	duration, err := strconv.ParseFloat(c.Query("duration"), 64)
+	if err != nil || duration <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration"})
+		return
+	}
+
+	var recording models.Recording
+	if err := requestDB(h.db, c).Where("camera_id = ? AND status = ?", camera.ID, "completed").
+		First(&recording, c.Param("recordingId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+		return
+	}
+	if _, err := os.Stat(recording.FilePath); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Recording file is no longer available"})
+		return
+	}
+
+	// Counted against FFMPEG_MAX_PROCESSES like a live view of the camera
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	slot, err := h.scheduler.Acquire(camera.ID, services.PipelinePlayback, camera.PriorityRank(), func() int { return 1 }, cancel)
+	if err != nil {
+		c.Header("Retry-After", "10")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "All transcode slots are in use by equal or higher priority cameras", "reason": "capacity"})
+		return
+	}
+	defer slot.Release()
+
+	cmd := services.FFmpegCommandContext(ctx,
+		"-loglevel", "error",
+		"-ss", fmt.Sprintf("%.3f", offset),
+		"-t", fmt.Sprintf("%.3f", duration),
+		"-i", recording.FilePath,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c", "copy",
+		"-f", "mpegts", "pipe:1")
+	cmd.Stdout = c.Writer
+
+	c.Header("Content-Type", "video/mp2t")
+	c.Status(http.StatusOK)
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		fmt.Printf("[Playback] Failed to remux recording %d: %v\n", recording.ID, err)
+	}
+}
+
+// RequirePlaybackToken authorizes the pre-signed playback routes: the
+// token must be signed for the exact playlist range or segment requested.
+// The signing user is set as the current user, so playback is audited as
+// theirs.
+func (h *RecordingHandler) RequirePlaybackToken(c *gin.Context) {
+	if !h.tokens.Enabled() {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Pre-signed playback is disabled"})
+		return
+	}
+	cameraID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+		return
+	}
+	scope := playlistScope(uint(cameraID), c.Query("from"), c.Query("to"))
+	if raw := c.Param("recordingId"); raw != "" {
+		recordingID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+			return
+		}
+		scope = segmentScope(uint(cameraID), uint(recordingID))
+	}
+
+	token := c.Query("token")
+	switch err := h.tokens.Validate(scope, token, c.ClientIP()); err {
+	case nil:
+	case services.ErrStreamTokenBlocked:
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case services.ErrStreamTokenExpired:
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Playback link has expired"})
+		return
+	default:
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid playback link"})
+		return
+	}
+	c.Set("user_id", h.tokens.TokenUser(token))
+	c.Set("signed_playback", true)
+}
+
+// playbackURL is the playback playlist of a camera between from and to; it
+// needs the Authorization header like any other API call. prefix is the API
+// base, e.g. /api/v1.
+func playbackURL(prefix string, cameraID uint, from, to time.Time) string {
+	return fmt.Sprintf("%s/cameras/%d/playback?from=%s&to=%s", prefix, cameraID,
+		from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+}
+
+// signedPlaybackURL returns a pre-signed playback playlist URL of a camera's
+// range for userID, and when it expires. prefix is the API base, e.g.
+// /api/v1.
+func signedPlaybackURL(tokens *services.StreamTokenService, prefix string, cameraID uint, from, to time.Time, userID uint) (string, time.Time) {
+	fromParam, toParam := from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)
+	token, expires := tokens.Token(playlistScope(cameraID, fromParam, toParam), userID)
+	query := url.Values{"from": {fromParam}, "to": {toParam}, "token": {token}}
+	return fmt.Sprintf("%s/signed/cameras/%d/playback?%s", prefix, cameraID, query.Encode()), expires
+}
+
+func playlistScope(cameraID uint, from, to string) string {
+	return fmt.Sprintf("playback/%d/%s/%s", cameraID, from, to)
+}
+
+func segmentScope(cameraID, recordingID uint) string {
+	return fmt.Sprintf("playback/%d/segments/%d", cameraID, recordingID)
+}
+
+// playbackRange parses from/to and loads the recorded pieces of the camera
+// in the path, writing the error response when it can't
+func (h *RecordingHandler) playbackRange(c *gin.Context) (*models.Camera, []PlaybackPiece, time.Time, time.Time, bool) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return nil, nil, time.Time{}, time.Time{}, false
+	}
+	from, err := parseTimeParam(c, "from")
+	if err == nil && from == nil {
+		err = fmt.Errorf("from is required")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, time.Time{}, time.Time{}, false
+	}
+	to, err := parseTimeParam(c, "to")
+	if err == nil && to == nil {
+		err = fmt.Errorf("to is required")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, time.Time{}, time.Time{}, false
+	}
+	if !to.After(*from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return nil, nil, time.Time{}, time.Time{}, false
+	}
+	if to.Sub(*from) > maxPlaybackRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("range is limited to %s", maxPlaybackRange)})
+		return nil, nil, time.Time{}, time.Time{}, false
+	}
+
+	// Segments still being written have no index yet and can't be served
+	searchFrom := from.Add(-maxRecordingSpan)
+	var recordings []models.Recording
+	if err := requestDB(h.db, c).Scopes(database.ForCamera(camera.ID), database.TimeRange("start_time", &searchFrom, to)).
+		Where("status = ? AND end_time > ?", "completed", *from).
+		Scopes(database.OldestFirst("start_time")).
+		Find(&recordings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recordings"})
+		return nil, nil, time.Time{}, time.Time{}, false
+	}
+	return camera, playbackPieces(recordings, *from, *to), *from, *to, true
+}
+
+// playbackPieces clips recordings, oldest first, to [from, to). Where
+// recordings overlap the later one starts where the earlier one ends.
+func playbackPieces(recordings []models.Recording, from, to time.Time) []PlaybackPiece {
+	pieces := []PlaybackPiece{}
+	cursor := from
+	for i, recording := range recordings {
+		if recording.EndTime == nil {
+			continue
+		}
+		start, end := recording.StartTime, *recording.EndTime
+		if start.Before(cursor) {
+			start = cursor
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+		pieces = append(pieces, PlaybackPiece{
+			RecordingID: recording.ID,
+			Start:       start,
+			End:         end,
+			Offset:      start.Sub(recording.StartTime).Seconds(),
+			recording:   &recordings[i],
+		})
+		cursor = end
+	}
+	return pieces
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdayNames = map[string]bool{"sun": true, "mon": true, "tue": true, "wed": true, "thu": true, "fri": true, "sat": true}
+
+// validateSchedule checks a weekly window as evaluated by models.ScheduleActive
+func validateSchedule(days, start, end string) error {
+	for _, day := range strings.Split(days, ",") {
+		if day = strings.TrimSpace(strings.ToLower(day)); day != "" && !weekdayNames[day] {
+			return fmt.Errorf("invalid schedule day %q, use mon,tue,wed,thu,fri,sat,sun", day)
+		}
+	}
+	for _, clock := range []string{start, end} {
+		if clock == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", clock); err != nil {
+			return fmt.Errorf("invalid schedule time %q, expected HH:MM", clock)
+		}
+	}
+	if (start == "") != (end == "") {
+		return fmt.Errorf("schedule_start and schedule_end must be set together")
+	}
+	return nil
+}
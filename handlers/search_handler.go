@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+type SearchHandler struct {
+	db *gorm.DB
+}
+
+func NewSearchHandler(db *gorm.DB) *SearchHandler {
+	return &SearchHandler{
+		db: db,
+	}
+}
+
+type SearchResponse struct {
+	Query     string            `json:"query"`
+	Cameras   []models.Camera   `json:"cameras"`
+	Events    []models.Event    `json:"events"`
+	Incidents []models.Incident `json:"incidents"`
+}
+
+// Search runs a full-text search across cameras, events and incidents
+// Query: ?q=<text>&types=cameras,events,incidents&limit=
+func (h *SearchHandler) Search(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	tsquery := database.SearchQuery(q)
+	if tsquery == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		if n > maxSearchLimit {
+			n = maxSearchLimit
+		}
+		limit = n
+	}
+
+	types := map[string]bool{"cameras": true, "events": true, "incidents": true}
+	if raw := c.Query("types"); raw != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(raw, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	response := SearchResponse{
+		Query:     q,
+		Cameras:   []models.Camera{},
+		Events:    []models.Event{},
+		Incidents: []models.Incident{},
+	}
+
+	if types["cameras"] {
+		if err := requestDB(h.db, c).Scopes(database.FullTextSearch("cameras", tsquery)).Limit(limit).Find(&response.Cameras).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search cameras"})
+			return
+		}
+	}
+	if types["events"] {
+		if err := requestDB(h.db, c).Scopes(database.FullTextSearch("events", tsquery)).Limit(limit).Find(&response.Events).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search events"})
+			return
+		}
+	}
+	if types["incidents"] {
+		if err := requestDB(h.db, c).Scopes(database.FullTextSearch("incidents", tsquery)).Limit(limit).Find(&response.Incidents).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search incidents"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
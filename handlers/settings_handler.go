@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSiteName      = "Command Center"
+	maxSiteName          = 100
+	maxLoginBanner       = 2000
+	maxMapZoom           = 22
+	defaultMapZoom       = 12
+	maxRetentionDays     = 36500
+	brandingCacheControl = "public, max-age=60"
+)
+
+type SettingsHandler struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+func NewSettingsHandler(db *gorm.DB, cfg *config.Config) *SettingsHandler {
+	return &SettingsHandler{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// SettingsResponse is the settings with the retention the server applies
+type SettingsResponse struct {
+	models.Settings
+	Retention RetentionDefaults `json:"retention"`
+}
+
+// RetentionDefaults are how long data is kept in days (0 = kept forever):
+// the value saved in the settings, or else the server's environment
+type RetentionDefaults struct {
+	RecordingDays       int `json:"recording_days"`
+	ClipDays            int `json:"clip_days"` // Clips kept around events when recordings are pruned
+	MotionDays          int `json:"motion_days"`
+	QualityDays         int `json:"quality_days"`
+	WebhookLogDays      int `json:"webhook_log_days"`
+	VisitorSnapshotDays int `json:"visitor_snapshot_days"`
+}
+
+// BrandingResponse is what the login page shows before anyone signs in
+type BrandingResponse struct {
+	SiteName    string `json:"site_name"`
+	LogoURL     string `json:"logo_url"`
+	LoginBanner string `json:"login_banner"`
+	SSOLoginURL string `json:"sso_login_url,omitempty"` // Single sign-on, when configured
+}
+
+type UpdateSettingsRequest struct {
+	SiteName     *string  `json:"site_name"`
+	LogoURL      *string  `json:"logo_url"`
+	LoginBanner  *string  `json:"login_banner"`
+	MapLatitude  *float64 `json:"map_latitude"`
+	MapLongitude *float64 `json:"map_longitude"`
+	MapZoom      *int     `json:"map_zoom"`
+	ClearMap     bool     `json:"clear_map_center"` // Fit the map to the cameras again
+
+	Retention      *RetentionUpdate `json:"retention"`
+	ResetRetention bool             `json:"reset_retention"` // Go back to the environment's retention
+}
+
+// RetentionUpdate sets how many days a kind of data is kept; fields left
+// out are unchanged
+type RetentionUpdate struct {
+	RecordingDays       *int `json:"recording_days"`
+	ClipDays            *int `json:"clip_days"`
+	MotionDays          *int `json:"motion_days"`
+	QualityDays         *int `json:"quality_days"`
+	WebhookLogDays      *int `json:"webhook_log_days"`
+	VisitorSnapshotDays *int `json:"visitor_snapshot_days"`
+}
+
+// apply copies the provided fields onto settings and validates the result
+func (req *UpdateSettingsRequest) apply(settings *models.Settings) error {
+	if req.SiteName != nil {
+		settings.SiteName = strings.TrimSpace(*req.SiteName)
+	}
+	if req.LogoURL != nil {
+		settings.LogoURL = strings.TrimSpace(*req.LogoURL)
+	}
+	if req.LoginBanner != nil {
+		settings.LoginBanner = *req.LoginBanner
+	}
+	if req.ClearMap {
+		settings.Map.Latitude = nil
+		settings.Map.Longitude = nil
+	}
+	if (req.MapLatitude == nil) != (req.MapLongitude == nil) {
+		return fmt.Errorf("map_latitude and map_longitude must be set together")
+	}
+	if req.MapLatitude != nil {
+		settings.Map.Latitude = req.MapLatitude
+		settings.Map.Longitude = req.MapLongitude
+	}
+	if req.MapZoom != nil {
+		settings.Map.Zoom = *req.MapZoom
+	}
+	if req.ResetRetention {
+		settings.Retention = models.RetentionSettings{}
+	}
+	if update := req.Retention; update != nil {
+		stored := &settings.Retention
+		for _, field := range []struct {
+			name   string
+			days   *int
+			stored **int
+		}{
+			{"recording_days", update.RecordingDays, &stored.RecordingDays},
+			{"clip_days", update.ClipDays, &stored.ClipDays},
+			{"motion_days", update.MotionDays, &stored.MotionDays},
+			{"quality_days", update.QualityDays, &stored.QualityDays},
+			{"webhook_log_days", update.WebhookLogDays, &stored.WebhookLogDays},
+			{"visitor_snapshot_days", update.VisitorSnapshotDays, &stored.VisitorSnapshotDays},
+		} {
+			if field.days == nil {
+				continue
+			}
+			if *field.days < 0 || *field.days > maxRetentionDays {
+				return fmt.Errorf("retention.%s must be between 0 and %d", field.name, maxRetentionDays)
+			}
+			days := *field.days
+			*field.stored = &days
+		}
+	}
+
+	if settings.SiteName == "" || utf8.RuneCountInString(settings.SiteName) > maxSiteName {
+		return fmt.Errorf("site_name must be 1 to %d characters", maxSiteName)
+	}
+	if utf8.RuneCountInString(settings.LoginBanner) > maxLoginBanner {
+		return fmt.Errorf("login_banner must be at most %d characters", maxLoginBanner)
+	}
+	if settings.LogoURL != "" && !validLogoURL(settings.LogoURL) {
+		return fmt.Errorf("logo_url must be an http(s) URL or a path starting with /")
+	}
+	if lat := settings.Map.Latitude; lat != nil && (*lat < -90 || *lat > 90 || *settings.Map.Longitude < -180 || *settings.Map.Longitude > 180) {
+		return fmt.Errorf("map_latitude must be between -90 and 90 and map_longitude between -180 and 180")
+	}
+	if settings.Map.Zoom < 0 || settings.Map.Zoom > maxMapZoom {
+		return fmt.Errorf("map_zoom must be between 0 and %d", maxMapZoom)
+	}
+	return nil
+}
+
+// GetBranding returns the site name, logo and login banner; public, for the
+// login page
+func (h *SettingsHandler) GetBranding(c *gin.Context) {
+	settings, err := loadSettings(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+
+	branding := BrandingResponse{
+		SiteName:    settings.SiteName,
+		LogoURL:     settings.LogoURL,
+		LoginBanner: settings.LoginBanner,
+	}
+	if h.config.OIDC.Issuer != "" && h.config.OIDC.ClientID != "" {
+		branding.SSOLoginURL = strings.TrimSuffix(c.FullPath(), "/settings/branding") + "/auth/oidc/login"
+	}
+
+	c.Header("Cache-Control", brandingCacheControl)
+	c.JSON(http.StatusOK, branding)
+}
+
+// GetSettings returns the branding, the map's default view and the
+// retention the server applies
+func (h *SettingsHandler) GetSettings(c *gin.Context) {
+	settings, err := loadSettings(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.response(settings))
+}
+
+// UpdateSettings changes the provided settings
+func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := loadSettings(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+	if err := req.apply(settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	settings.UpdatedBy = currentUserID(c)
+	if err := requestDB(h.db, c).Save(settings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save settings"})
+		return
+	}
+
+	response := h.response(settings)
+	retention := response.Retention
+	recordAudit(h.db, c, "update", "settings", "", fmt.Sprintf("site_name=%q logo_url=%q map_zoom=%d retention_days=%d/%d/%d/%d/%d/%d",
+		settings.SiteName, settings.LogoURL, settings.Map.Zoom, retention.RecordingDays, retention.ClipDays,
+		retention.MotionDays, retention.QualityDays, retention.WebhookLogDays, retention.VisitorSnapshotDays))
+
+	c.JSON(http.StatusOK, response)
+}
+
+// loadSettings returns the settings, with the defaults until they are first
+// saved
+func loadSettings(db *gorm.DB) (*models.Settings, error) {
+	settings := models.Settings{
+		ID:       models.SettingsID,
+		SiteName: defaultSiteName,
+		Map:      models.MapView{Zoom: defaultMapZoom},
+	}
+	if err := db.FirstOrInit(&settings, models.SettingsID).Error; err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (h *SettingsHandler) response(settings *models.Settings) SettingsResponse {
+	stored := settings.Retention
+	return SettingsResponse{
+		Settings: *settings,
+		Retention: RetentionDefaults{
+			RecordingDays:       retentionDays(stored.RecordingDays, h.config.Recording.Retention),
+			ClipDays:            retentionDays(stored.ClipDays, h.config.Recording.ClipRetention),
+			MotionDays:          retentionDays(stored.MotionDays, h.config.Motion.Retention),
+			QualityDays:         retentionDays(stored.QualityDays, h.config.Quality.Retention),
+			WebhookLogDays:      retentionDays(stored.WebhookLogDays, h.config.Webhook.Retention),
+			VisitorSnapshotDays: retentionDays(stored.VisitorSnapshotDays, h.config.Visitor.SnapshotRetention),
+		},
+	}
+}
+
+// retentionDays is the stored retention, or else the environment's in
+// whole days, rounded up so a retention under a day doesn't read as kept
+// forever
+func retentionDays(stored *int, retention time.Duration) int {
+	if stored != nil {
+		return *stored
+	}
+	if retention <= 0 {
+		return 0
+	}
+	return int(math.Ceil(retention.Hours() / 24))
+}
+
+// validLogoURL accepts absolute http(s) URLs and paths on the frontend's
+// origin
+func validLogoURL(raw string) bool {
+	if strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		return true
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultBurstCount    = 10
+	maxBurstCount        = 30
+	defaultBurstInterval = time.Second
+	minBurstInterval     = 200 * time.Millisecond
+	maxBurstDuration     = time.Minute // count * interval
+)
+
+type SnapshotHandler struct {
+	db         *gorm.DB
+	snapshots  *services.SnapshotService
+	thumbnails *services.CameraThumbnailService
+}
+
+func NewSnapshotHandler(db *gorm.DB, snapshots *services.SnapshotService, thumbnails *services.CameraThumbnailService) *SnapshotHandler {
+	return &SnapshotHandler{
+		db:         db,
+		snapshots:  snapshots,
+		thumbnails: thumbnails,
+	}
+}
+
+// GetSnapshot returns a JPEG of the camera's current view for thumbnails.
+// Snapshots are cached; when a new one can't be captured the last one is
+// served with X-Snapshot-Stale: true.
+// Query: ?max_age=<seconds> (default SNAPSHOT_MAX_AGE, 0 forces a new capture)
+func (h *SnapshotHandler) GetSnapshot(c *gin.Context) {
+	maxAge := h.snapshots.MaxAge()
+	if value := c.Query("max_age"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_age must be a non-negative number of seconds"})
+			return
+		}
+		maxAge = time.Duration(seconds) * time.Second
+	}
+
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+
+	snapshot, err := h.snapshots.Get(camera, maxAge)
+	if err != nil && snapshot == nil {
+		var streamErr *services.StreamError
+		if errors.As(err, &streamErr) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": streamErr.Message, "reason": streamErr.Reason})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.Header("X-Snapshot-Stale", "true")
+		c.Header("Cache-Control", "no-store")
+	} else {
+		remaining := h.snapshots.MaxAge() - time.Since(snapshot.CapturedAt)
+		c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(max(remaining, 0).Seconds())))
+	}
+	c.Header("X-Snapshot-Captured-At", snapshot.CapturedAt.UTC().Format(time.RFC3339))
+	c.Data(http.StatusOK, "image/jpeg", snapshot.JPEG)
+}
+
+// BurstFrame is one frame of a snapshot burst; the JPEG is base64 encoded
+type BurstFrame struct {
+	Index      int       `json:"index"`
+	CapturedAt time.Time `json:"captured_at"`
+	JPEG       []byte    `json:"jpeg"`
+}
+
+// GetSnapshotBurst captures a series of frames of the camera's current view,
+// interval apart, to check on activity without opening a player. Frames
+// are returned as a JSON array or a ZIP of JPEGs. When the capture fails
+// midway the frames captured so far are returned with
+// X-Snapshot-Burst-Incomplete: true.
+// Query: ?count=10&interval=1s&format=json|zip
+func (h *SnapshotHandler) GetSnapshotBurst(c *gin.Context) {
+	count := defaultBurstCount
+	if value := c.Query("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxBurstCount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("count must be between 1 and %d", maxBurstCount)})
+			return
+		}
+		count = n
+	}
+	interval := defaultBurstInterval
+	if value := c.Query("interval"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < minBurstInterval {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("interval must be a duration of at least %s, e.g. 1s", minBurstInterval)})
+			return
+		}
+		interval = d
+	}
+	if time.Duration(count)*interval > maxBurstDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("count * interval must be at most %s", maxBurstDuration)})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+
+	frames, err := h.snapshots.Burst(c.Request.Context(), camera, count, interval)
+	if err != nil && len(frames) == 0 {
+		var streamErr *services.StreamError
+		if errors.As(err, &streamErr) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": streamErr.Message, "reason": streamErr.Reason})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.Header("X-Snapshot-Burst-Incomplete", "true")
+	}
+	c.Header("Cache-Control", "no-store")
+
+	if format == "json" {
+		burst := make([]BurstFrame, len(frames))
+		for i, frame := range frames {
+			burst[i] = BurstFrame{Index: i, CapturedAt: frame.CapturedAt, JPEG: frame.JPEG}
+		}
+		c.JSON(http.StatusOK, burst)
+		return
+	}
+
+	name := fmt.Sprintf("cam%d-burst-%s", camera.ID, frames[0].CapturedAt.UTC().Format("20060102T150405Z"))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	archive := zip.NewWriter(c.Writer)
+	for i, frame := range frames {
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("%s/%02d-%s.jpg", name, i, frame.CapturedAt.UTC().Format("150405.000")),
+			Method:   zip.Store, // JPEGs don't compress
+			Modified: frame.CapturedAt,
+		})
+		if err != nil {
+			return
+		}
+		if _, err := entry.Write(frame.JPEG); err != nil {
+			return
+		}
+	}
+	archive.Close()
+}
+
+// GetThumbnail returns the camera's stored grid thumbnail, refreshed in the
+// background every CAMERA_THUMBNAIL_INTERVAL; unlike snapshots it never
+// touches the camera
+func (h *SnapshotHandler) GetThumbnail(c *gin.Context) {
+	camera, ok := h.findCamera(c)
+	if !ok {
+		return
+	}
+
+	jpeg, capturedAt, err := h.thumbnails.Get(camera.ID)
+	if err != nil {
+		if err == services.ErrThumbnailNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera has no thumbnail yet"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read thumbnail"})
+		return
+	}
+
+	remaining := h.thumbnails.Interval() - time.Since(capturedAt)
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(max(remaining, 0).Seconds())))
+	c.Header("X-Thumbnail-Captured-At", capturedAt.UTC().Format(time.RFC3339))
+	c.Data(http.StatusOK, "image/jpeg", jpeg)
+}
+
+func (h *SnapshotHandler) findCamera(c *gin.Context) (*models.Camera, bool) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return nil, false
+	}
+	return &camera, true
+}
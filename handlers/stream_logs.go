@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetStreamLogs returns the recent FFmpeg stderr of a camera's pipelines,
+// oldest first
+// Query: ?pipeline=&since=&limit=
+func (h *CameraHandler) GetStreamLogs(c *gin.Context) {
+	since, err := parseTimeParam(c, "since")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+	}
+
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id").First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	lines := services.CameraStreamLogs(camera.ID, c.Query("pipeline"), since)
+	if limit > 0 && len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"camera_id": camera.ID,
+		"lines":     lines,
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type StreamViewHandler struct {
+	db *gorm.DB
+}
+
+func NewStreamViewHandler(db *gorm.DB) *StreamViewHandler {
+	return &StreamViewHandler{
+		db: db,
+	}
+}
+
+// ListStreamViews returns stream views newest first using cursor pagination
+// Query: ?after=&limit=&camera_id=&user_id=&protocol=&from=&to=
+func (h *StreamViewHandler) ListStreamViews(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, err := parseUintParam(c, "user_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.StreamView{}).Scopes(database.TimeRange("started_at", from, to))
+	if cameraID != 0 {
+		query = query.Where("camera_id = ?", cameraID)
+	}
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if protocol := c.Query("protocol"); protocol != "" {
+		query = query.Where("protocol = ?", protocol)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("started_at", cursor.Time, cursor.ID))
+	}
+
+	var views []models.StreamView
+	if err := query.Scopes(database.NewestFirst("started_at")).Limit(limit + 1).Find(&views).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stream views"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(views, limit, func(v models.StreamView) (time.Time, uint) {
+		return v.StartedAt, v.ID
+	}))
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TamperHandler struct {
+	db            *gorm.DB
+	tamperService *services.TamperService
+	snapshots     *services.SnapshotService
+}
+
+func NewTamperHandler(db *gorm.DB, tamperService *services.TamperService, snapshots *services.SnapshotService) *TamperHandler {
+	return &TamperHandler{
+		db:            db,
+		tamperService: tamperService,
+		snapshots:     snapshots,
+	}
+}
+
+// ViewComparison is a camera's expected view (its tamper baseline) next to
+// its current one, with how they compare. JPEGs are base64 encoded.
+type ViewComparison struct {
+	CameraID   uint                       `json:"camera_id"`
+	Baseline   BaselineView               `json:"baseline"`
+	Current    CurrentView                `json:"current"`
+	Comparison *services.TamperComparison `json:"comparison"` // null when the current view couldn't be analyzed
+}
+
+type BaselineView struct {
+	CapturedAt time.Time `json:"captured_at"`
+	Brightness float64   `json:"brightness"`
+	Sharpness  float64   `json:"sharpness"`
+	Grayscale  bool      `json:"grayscale"` // Baseline from before color references were kept; reset it for one
+	JPEG       []byte    `json:"jpeg"`
+}
+
+type CurrentView struct {
+	CapturedAt time.Time `json:"captured_at"`
+	Stale      bool      `json:"stale"` // A new snapshot couldn't be captured; this is the last one
+	JPEG       []byte    `json:"jpeg"`
+}
+
+// CompareView returns the camera's tamper baseline and a current snapshot
+// side by side, so an operator can see whether it still shows what it
+// should, with the tamper measures of the current view against the baseline
+// Query: ?max_age=<seconds> (of the snapshot, default SNAPSHOT_MAX_AGE)
+func (h *TamperHandler) CompareView(c *gin.Context) {
+	maxAge := h.snapshots.MaxAge()
+	if value := c.Query("max_age"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_age must be a non-negative number of seconds"})
+			return
+		}
+		maxAge = time.Duration(seconds) * time.Second
+	}
+
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	var baseline models.TamperBaseline
+	if err := requestDB(h.db, c).First(&baseline, "camera_id = ?", camera.ID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera has no tamper baseline yet; capture one with POST /cameras/:id/tamper/baseline", "reason": "no_baseline"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tamper baseline"})
+		return
+	}
+	reference, grayscale, err := services.BaselineJPEG(&baseline)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render tamper baseline"})
+		return
+	}
+
+	snapshot, err := h.snapshots.Get(&camera, maxAge)
+	if err != nil && snapshot == nil {
+		var streamErr *services.StreamError
+		if errors.As(err, &streamErr) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": streamErr.Message, "reason": streamErr.Reason})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := ViewComparison{
+		CameraID: camera.ID,
+		Baseline: BaselineView{
+			CapturedAt: baseline.CapturedAt,
+			Brightness: baseline.Brightness,
+			Sharpness:  baseline.Sharpness,
+			Grayscale:  grayscale,
+			JPEG:       reference,
+		},
+		Current: CurrentView{
+			CapturedAt: snapshot.CapturedAt,
+			Stale:      err != nil,
+			JPEG:       snapshot.JPEG,
+		},
+	}
+	if comparison, err := services.CompareWithBaseline(&baseline, snapshot.JPEG); err == nil {
+		response.Comparison = &comparison
+	} else {
+		fmt.Printf("[Tamper] Failed to compare camera %d with its baseline: %v\n", camera.ID, err)
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
+
+// GetTamperStatus returns the latest tamper check of a camera and its baseline
+func (h *TamperHandler) GetTamperStatus(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	response := gin.H{
+		"camera_id": camera.ID,
+		"enabled":   camera.TamperDetection,
+		"baseline":  nil,
+		"status":    nil,
+	}
+
+	var baseline models.TamperBaseline
+	if err := requestDB(h.db, c).First(&baseline, "camera_id = ?", camera.ID).Error; err == nil {
+		response["baseline"] = baseline
+	} else if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tamper baseline"})
+		return
+	}
+
+	if status, ok := h.tamperService.GetStatus(camera.ID); ok {
+		response["status"] = status
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetTamperBaseline captures the camera's current view as the new baseline,
+// e.g. after it was deliberately re-aimed
+func (h *TamperHandler) ResetTamperBaseline(c *gin.Context) {
+	var camera models.Camera
+	if err := requestDB(h.db, c).First(&camera, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+		return
+	}
+
+	baseline, err := h.tamperService.ResetBaseline(&camera)
+	if errors.Is(err, services.ErrPrivacyMode) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Camera is in privacy mode", "reason": "privacy_mode"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Failed to capture baseline: %v", err)})
+		return
+	}
+
+	recordAudit(h.db, c, "reset_tamper_baseline", "camera", fmt.Sprint(camera.ID), camera.Name)
+
+	c.JSON(http.StatusOK, baseline)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserContact is how a user is shown next to what they are involved in
+// (presence, incidents): enough to recognise and reach them
+type UserContact struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name"`
+	Email      string `json:"email,omitempty"` // Left out for viewers, see contactsFor
+	Phone      string `json:"phone,omitempty"`
+	Department string `json:"department"`
+	AvatarURL  string `json:"avatar_url"`
+}
+
+// contactsFor drops the email addresses and phone numbers from contacts
+// unless the current user is an operator; viewers see names only
+func contactsFor(c *gin.Context, contacts map[uint]UserContact) map[uint]UserContact {
+	if c.GetString("role") != "viewer" {
+		return contacts
+	}
+	for id, contact := range contacts {
+		contact.Email, contact.Phone = "", ""
+		contacts[id] = contact
+	}
+	return contacts
+}
+
+// loadUserContacts returns the contacts and roles of the users by ID,
+// without loading their photos
+func loadUserContacts(db *gorm.DB, ids []uint) (map[uint]UserContact, map[uint]string, error) {
+	contacts := make(map[uint]UserContact, len(ids))
+	roles := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return contacts, roles, nil
+	}
+
+	var rows []struct {
+		ID         uint
+		Name       string
+		Email      string
+		Role       string
+		Phone      string
+		Department string
+		AvatarURL  string
+		HasPhoto   bool
+	}
+	if err := db.Model(&models.User{}).
+		Select("id, name, email, role, phone, department, avatar_url, photo IS NOT NULL AND length(photo) > 0 AS has_photo").
+		Where("id IN ?", ids).Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, row := range rows {
+		contacts[row.ID] = UserContact{
+			ID:         row.ID,
+			Name:       row.Name,
+			Email:      row.Email,
+			Phone:      row.Phone,
+			Department: row.Department,
+			AvatarURL:  models.UserAvatar(row.ID, row.HasPhoto, row.AvatarURL),
+		}
+		roles[row.ID] = row.Role
+	}
+	return contacts, roles, nil
+}
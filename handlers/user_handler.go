@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// presenceWindow is how recently an operator must have made a request to
+// count as online
+const presenceWindow = 5 * time.Minute
+
+type UserHandler struct {
+	db        *gorm.DB
+	sessions  *services.SessionService
+	directory *services.DirectoryService
+}
+
+func NewUserHandler(db *gorm.DB, sessions *services.SessionService, directory *services.DirectoryService) *UserHandler {
+	return &UserHandler{
+		db:        db,
+		sessions:  sessions,
+		directory: directory,
+	}
+}
+
+type UpdateUserProfileRequest struct {
+	Phone      *string `json:"phone"`
+	Department *string `json:"department"`
+	AvatarURL  *string `json:"avatar_url"`
+}
+
+func (r *UpdateUserProfileRequest) apply(user *models.User) {
+	if r.Phone != nil {
+		user.Phone = strings.TrimSpace(*r.Phone)
+	}
+	if r.Department != nil {
+		user.Department = strings.TrimSpace(*r.Department)
+	}
+	if r.AvatarURL != nil {
+		user.AvatarURL = strings.TrimSpace(*r.AvatarURL)
+	}
+}
+
+// validAvatarURL reports whether an avatar URL is https:// or relative to
+// this site's root; "//host" and "/\host" point browsers at other hosts
+func validAvatarURL(avatarURL string) bool {
+	if strings.HasPrefix(avatarURL, "https://") {
+		return true
+	}
+	return strings.HasPrefix(avatarURL, "/") && !strings.HasPrefix(avatarURL, "//") && !strings.HasPrefix(avatarURL, "/\\")
+}
+
+// OperatorPresence is an operator with an active session
+type OperatorPresence struct {
+	UserContact
+	Role       string    `json:"role"`
+	Online     bool      `json:"online"` // Made a request in the last 5 minutes
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Sessions   int       `json:"sessions"`
+}
+
+type SetUserAreasRequest struct {
+	Areas []string `json:"areas"`
+}
+
+// SetUserAreas replaces the camera areas assigned to an operator, which scope
+// their dashboard (GET /my/dashboard)
+func (h *UserHandler) SetUserAreas(c *gin.Context) {
+	var req SetUserAreasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := requestDB(h.db, c).First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	areas := make([]string, 0, len(req.Areas))
+	for _, area := range req.Areas {
+		area = strings.TrimSpace(area)
+		if strings.Contains(area, ",") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("area %q must not contain a comma", area)})
+			return
+		}
+		if area != "" {
+			areas = append(areas, area)
+		}
+	}
+
+	user.AssignedAreas = strings.Join(areas, ",")
+	if err := requestDB(h.db, c).Model(&user).Update("assigned_areas", user.AssignedAreas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	recordAudit(h.db, c, "set_areas", "user", fmt.Sprint(user.ID), user.AssignedAreas)
+
+	c.JSON(http.StatusOK, newUserResponse(&user))
+}
+
+// UpdateUserProfile sets a user's contact details. With a directory
+// configured, the next sync overwrites the phone and department of users
+// it knows.
+func (h *UserHandler) UpdateUserProfile(c *gin.Context) {
+	var req UpdateUserProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AvatarURL != nil && *req.AvatarURL != "" && !validAvatarURL(strings.TrimSpace(*req.AvatarURL)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "avatar_url must be an https:// or site-relative URL"})
+		return
+	}
+
+	var user models.User
+	if err := requestDB(h.db, c).First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	req.apply(&user)
+	if err := requestDB(h.db, c).Model(&user).Select("phone", "department", "avatar_url").Updates(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	recordAudit(h.db, c, "update_profile", "user", fmt.Sprint(user.ID), user.Email)
+
+	c.JSON(http.StatusOK, newUserResponse(&user))
+}
+
+// SyncUserFromDirectory refreshes a user's phone, department and photo
+// from the directory now instead of at the next LDAP_SYNC_INTERVAL
+func (h *UserHandler) SyncUserFromDirectory(c *gin.Context) {
+	if !h.directory.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "No directory is configured (LDAP_URL)"})
+		return
+	}
+
+	var user models.User
+	if err := requestDB(h.db, c).First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	found, err := h.directory.Sync(&user)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Directory sync failed: %v", err)})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found in the directory"})
+		return
+	}
+	if err := requestDB(h.db, c).First(&user, user.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	recordAudit(h.db, c, "directory_sync", "user", fmt.Sprint(user.ID), user.Email)
+
+	c.JSON(http.StatusOK, newUserResponse(&user))
+}
+
+// GetUserAvatar serves the photo synced from the directory
+func (h *UserHandler) GetUserAvatar(c *gin.Context) {
+	var user models.User
+	if err := requestDB(h.db, c).Select("id", "photo", "directory_synced_at").First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+	if len(user.Photo) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User has no photo"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, "image/jpeg", user.Photo)
+}
+
+// ListOperatorPresence returns the operators with an active session and
+// their contact details, online ones first, for picking who to hand an
+// incident to
+func (h *UserHandler) ListOperatorPresence(c *gin.Context) {
+	var sessions []models.Session
+	if err := requestDB(h.db, c).Select("id", "user_id", "last_used_at").
+		Where("revoked_at IS NULL AND expires_at > ?", time.Now()).
+		Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	byUser := make(map[uint]*OperatorPresence)
+	var userIDs []uint
+	for _, session := range sessions {
+		lastSeen := session.LastUsedAt
+		if seenAt, ok := h.sessions.LastSeen(session.ID); ok && seenAt.After(lastSeen) {
+			lastSeen = seenAt
+		}
+		presence, ok := byUser[session.UserID]
+		if !ok {
+			presence = &OperatorPresence{}
+			byUser[session.UserID] = presence
+			userIDs = append(userIDs, session.UserID)
+		}
+		presence.Sessions++
+		if lastSeen.After(presence.LastSeenAt) {
+			presence.LastSeenAt = lastSeen
+		}
+	}
+
+	contacts, roles, err := loadUserContacts(h.db, userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	response := make([]OperatorPresence, 0, len(byUser))
+	for userID, presence := range byUser {
+		contact, ok := contacts[userID]
+		if !ok {
+			continue // Deleted since
+		}
+		presence.UserContact = contact
+		presence.Role = roles[userID]
+		presence.Online = time.Since(presence.LastSeenAt) < presenceWindow
+		response = append(response, *presence)
+	}
+	sort.Slice(response, func(i, j int) bool {
+		if response[i].Online != response[j].Online {
+			return response[i].Online
+		}
+		return response[i].Name < response[j].Name
+	})
+
+	c.JSON(http.StatusOK, response)
+}
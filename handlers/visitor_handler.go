@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Check-ins reported later than this are linked to footage only; a live
+	// snapshot would show whoever is in the lobby now
+	visitorSnapshotSkew = time.Minute
+
+	// A visitor at the desk is snapshotted fresh, not from a thumbnail cache
+	visitorSnapshotMaxAge = 2 * time.Second
+)
+
+type VisitorHandler struct {
+	db        *gorm.DB
+	snapshots *services.SnapshotService
+	privacy   *services.PrivacyService
+	areas     *AreaAccess
+	config    config.VisitorConfig
+}
+
+// Check-ins are limited to the areas of their camera like the camera
+// routes; those without a camera only to users reaching every area
+func NewVisitorHandler(db *gorm.DB, snapshots *services.SnapshotService, privacy *services.PrivacyService, areas *AreaAccess, cfg config.VisitorConfig) *VisitorHandler {
+	return &VisitorHandler{
+		db:        db,
+		snapshots: snapshots,
+		privacy:   privacy,
+		areas:     areas,
+		config:    cfg,
+	}
+}
+
+type VisitorCheckInRequest struct {
+	VisitorName  string     `json:"visitor_name" binding:"required"`
+	Company      string     `json:"company"`
+	HostName     string     `json:"host_name"`
+	BadgeNumber  string     `json:"badge_number"`
+	Source       string     `json:"source"`      // External system name; defaults to builtin
+	ExternalID   string     `json:"external_id"` // Record ID in the external system
+	CameraID     *uint      `json:"camera_id"`   // Defaults to VISITOR_LOBBY_CAMERA_ID
+	CheckedInAt  *time.Time `json:"checked_in_at"`
+	CheckedOutAt *time.Time `json:"checked_out_at"`
+}
+
+// CreateVisitorCheckIn records a visitor check-in and snapshots the lobby
+// camera, which must be in the caller's areas. Records re-sent by an
+// external system (same source and external_id) update the existing
+// check-in instead.
+func (h *VisitorHandler) CreateVisitorCheckIn(c *gin.Context) {
+	var req VisitorCheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.VisitorName = strings.TrimSpace(req.VisitorName)
+	req.Source = strings.TrimSpace(req.Source)
+	req.ExternalID = strings.TrimSpace(req.ExternalID)
+	if req.VisitorName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visitor_name is required"})
+		return
+	}
+	if req.Source == "" {
+		req.Source = models.VisitorSourceBuiltin
+	}
+	if req.Source != models.VisitorSourceBuiltin && req.ExternalID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "external_id is required for check-ins from an external system"})
+		return
+	}
+
+	now := time.Now()
+	checkedInAt := now
+	if req.CheckedInAt != nil {
+		if req.CheckedInAt.After(now.Add(time.Minute)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "checked_in_at must not be in the future"})
+			return
+		}
+		checkedInAt = *req.CheckedInAt
+	}
+	if req.CheckedOutAt != nil && req.CheckedOutAt.Before(checkedInAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "checked_out_at must be after checked_in_at"})
+		return
+	}
+
+	var camera *models.Camera
+	cameraID := h.config.LobbyCameraID
+	if req.CameraID != nil {
+		cameraID = *req.CameraID
+	}
+	if cameraID != 0 {
+		camera = &models.Camera{}
+		if err := requestDB(h.db, c).First(camera, cameraID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Camera not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+			return
+		}
+		allowed, err := h.areas.CameraAllowed(c, camera)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Camera is outside your assigned areas"})
+			return
+		}
+	}
+
+	checkIn := models.VisitorCheckIn{
+		VisitorName:  req.VisitorName,
+		Company:      strings.TrimSpace(req.Company),
+		HostName:     strings.TrimSpace(req.HostName),
+		BadgeNumber:  strings.TrimSpace(req.BadgeNumber),
+		Source:       req.Source,
+		CheckedInAt:  checkedInAt,
+		CheckedOutAt: req.CheckedOutAt,
+		CreatedBy:    currentUserID(c),
+	}
+	if req.ExternalID != "" {
+		checkIn.ExternalID = &req.ExternalID
+	}
+	if camera != nil {
+		checkIn.CameraID = &camera.ID
+	}
+	// A record re-sent concurrently hits the unique index instead of
+	// adding a second check-in
+	created := requestDB(h.db, c).Clauses(clause.OnConflict{DoNothing: true}).Create(&checkIn)
+	if created.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record check-in"})
+		return
+	}
+	if created.RowsAffected == 0 {
+		var existing models.VisitorCheckIn
+		if err := requestDB(h.db, c).Where("source = ? AND external_id = ?", req.Source, req.ExternalID).First(&existing).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-in"})
+			return
+		}
+		if !h.checkInAllowed(c, &existing) {
+			return
+		}
+		h.updateExternal(c, &existing, &req, checkedInAt)
+		return
+	}
+
+	// The check-in stands without a snapshot; the footage link still covers it
+	if camera != nil && now.Sub(checkedInAt) <= visitorSnapshotSkew {
+		h.storeSnapshot(&checkIn, camera)
+	}
+
+	recordAudit(h.db, c, "check_in", "visitor", fmt.Sprint(checkIn.ID), fmt.Sprintf("%s (%s)", checkIn.VisitorName, checkIn.Source))
+
+	h.fillURLs(c, &checkIn)
+	c.JSON(http.StatusCreated, checkIn)
+}
+
+// updateExternal applies a re-sent external record to its check-in. The
+// snapshot and camera stay those of the first report.
+func (h *VisitorHandler) updateExternal(c *gin.Context, checkIn *models.VisitorCheckIn, req *VisitorCheckInRequest, checkedInAt time.Time) {
+	updates := map[string]interface{}{
+		"visitor_name":  req.VisitorName,
+		"company":       strings.TrimSpace(req.Company),
+		"host_name":     strings.TrimSpace(req.HostName),
+		"badge_number":  strings.TrimSpace(req.BadgeNumber),
+		"checked_in_at": checkedInAt,
+	}
+	if req.CheckedOutAt != nil {
+		updates["checked_out_at"] = *req.CheckedOutAt
+	}
+	if err := requestDB(h.db, c).Model(checkIn).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update check-in"})
+		return
+	}
+	if err := requestDB(h.db, c).First(checkIn, checkIn.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-in"})
+		return
+	}
+
+	h.fillURLs(c, checkIn)
+	c.JSON(http.StatusOK, checkIn)
+}
+
+// ListVisitorCheckIns searches visitor check-ins, newest first using cursor
+// pagination. q matches part of the visitor's name, from and to the
+// check-in time.
+// Query: ?after=&limit=&q=&from=&to=&camera_id=&source=
+func (h *VisitorHandler) ListVisitorCheckIns(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	areas, err := h.areas.Areas(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.VisitorCheckIn{}).Scopes(database.TimeRange("checked_in_at", from, to))
+	if areas != nil {
+		query = query.Where("camera_id IN (?)", requestDB(h.db, c).Model(&models.Camera{}).Select("id").Scopes(database.InAreas(areas)))
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query = query.Where("visitor_name ILIKE ?", "%"+likeEscaper.Replace(q)+"%")
+	}
+	if cameraID != 0 {
+		query = query.Where("camera_id = ?", cameraID)
+	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("checked_in_at", cursor.Time, cursor.ID))
+	}
+
+	var checkIns []models.VisitorCheckIn
+	if err := query.Scopes(database.NewestFirst("checked_in_at")).Limit(limit + 1).Find(&checkIns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-ins"})
+		return
+	}
+	for i := range checkIns {
+		h.fillURLs(c, &checkIns[i])
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(checkIns, limit, func(checkIn models.VisitorCheckIn) (time.Time, uint) {
+		return checkIn.CheckedInAt, checkIn.ID
+	}))
+}
+
+// GetVisitorCheckIn returns one visitor check-in
+func (h *VisitorHandler) GetVisitorCheckIn(c *gin.Context) {
+	checkIn, ok := h.findCheckIn(c)
+	if !ok {
+		return
+	}
+	h.fillURLs(c, checkIn)
+	c.JSON(http.StatusOK, checkIn)
+}
+
+// CheckOutVisitor records that a visitor left
+func (h *VisitorHandler) CheckOutVisitor(c *gin.Context) {
+	checkIn, ok := h.findCheckIn(c)
+	if !ok {
+		return
+	}
+	if checkIn.CheckedOutAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Visitor already checked out"})
+		return
+	}
+
+	now := time.Now()
+	if err := requestDB(h.db, c).Model(checkIn).Update("checked_out_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check out visitor"})
+		return
+	}
+	checkIn.CheckedOutAt = &now
+
+	recordAudit(h.db, c, "check_out", "visitor", fmt.Sprint(checkIn.ID), checkIn.VisitorName)
+
+	h.fillURLs(c, checkIn)
+	c.JSON(http.StatusOK, checkIn)
+}
+
+// ServeVisitorSnapshot serves the lobby camera's JPEG taken at check-in
+func (h *VisitorHandler) ServeVisitorSnapshot(c *gin.Context) {
+	checkIn, ok := h.findCheckIn(c)
+	if !ok {
+		return
+	}
+	if checkIn.SnapshotPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Check-in has no snapshot"})
+		return
+	}
+
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.File(checkIn.SnapshotPath)
+}
+
+// storeSnapshot captures the lobby camera and writes the JPEG under
+// <SnapshotDir>/<date>/<id>.jpg; cameras in privacy mode aren't captured
+func (h *VisitorHandler) storeSnapshot(checkIn *models.VisitorCheckIn, camera *models.Camera) {
+	if _, private := h.privacy.Active(camera.ID); private {
+		fmt.Printf("[Visitors] No snapshot for check-in %d: camera %d is in privacy mode\n", checkIn.ID, camera.ID)
+		return
+	}
+	snapshot, err := h.snapshots.Get(camera, visitorSnapshotMaxAge)
+	if err != nil {
+		fmt.Printf("[Visitors] No snapshot for check-in %d from camera %d: %v\n", checkIn.ID, camera.ID, err)
+		return
+	}
+
+	dir := filepath.Join(h.config.SnapshotDir, checkIn.CheckedInAt.UTC().Format("2006-01-02"))
+	path := filepath.Join(dir, fmt.Sprintf("%d.jpg", checkIn.ID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("[Visitors] Failed to create snapshot directory: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(path, snapshot.JPEG, 0644); err != nil {
+		fmt.Printf("[Visitors] Failed to write snapshot for check-in %d: %v\n", checkIn.ID, err)
+		return
+	}
+	if err := h.db.Model(checkIn).UpdateColumn("snapshot_path", path).Error; err != nil {
+		fmt.Printf("[Visitors] Failed to link snapshot to check-in %d: %v\n", checkIn.ID, err)
+		os.Remove(path)
+		return
+	}
+	checkIn.SnapshotPath = path
+}
+
+func (h *VisitorHandler) findCheckIn(c *gin.Context) (*models.VisitorCheckIn, bool) {
+	var checkIn models.VisitorCheckIn
+	if err := requestDB(h.db, c).First(&checkIn, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Check-in not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch check-in"})
+		return nil, false
+	}
+	if !h.checkInAllowed(c, &checkIn) {
+		return nil, false
+	}
+	return &checkIn, true
+}
+
+// checkInAllowed answers 404 for check-ins outside the caller's areas
+func (h *VisitorHandler) checkInAllowed(c *gin.Context, checkIn *models.VisitorCheckIn) bool {
+	areas, err := h.areas.Areas(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return false
+	}
+	if areas == nil {
+		return true
+	}
+	if checkIn.CameraID != nil {
+		var camera models.Camera
+		err := requestDB(h.db, c).Select("id", "area").First(&camera, *checkIn.CameraID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch camera"})
+			return false
+		}
+		if err == nil && areaAllowed(areas, camera.Area) {
+			return true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Check-in not found"})
+	return false
+}
+
+// fillURLs links a check-in to its snapshot and the lobby camera's footage
+// around the check-in
+func (h *VisitorHandler) fillURLs(c *gin.Context, checkIn *models.VisitorCheckIn) {
+	// Same API version as the request: /api/v1/visitors/check-ins -> /api/v1
+	prefix, _, _ := strings.Cut(c.FullPath(), "/visitors/")
+	if checkIn.SnapshotPath != "" {
+		checkIn.SnapshotURL = fmt.Sprintf("%s/visitors/check-ins/%d/snapshot", prefix, checkIn.ID)
+	}
+	if checkIn.CameraID != nil {
+		checkIn.PlaybackURL = playbackURL(prefix, *checkIn.CameraID,
+			checkIn.CheckedInAt.Add(-h.config.PlaybackWindow), checkIn.CheckedInAt.Add(h.config.PlaybackWindow))
+	}
+}
+
+// likeEscaper makes % and _ in a search term match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
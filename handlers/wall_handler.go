@@ -0,0 +1,487 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxWallGrid = 8
+
+type WallHandler struct {
+	db          *gorm.DB
+	wallService *services.WallService
+}
+
+func NewWallHandler(db *gorm.DB, wallService *services.WallService) *WallHandler {
+	return &WallHandler{
+		db:          db,
+		wallService: wallService,
+	}
+}
+
+type CreateWallRequest struct {
+	Name     string `json:"name" binding:"required"`
+	LayoutID *uint  `json:"layout_id"`
+}
+
+type SetWallLayoutRequest struct {
+	LayoutID uint `json:"layout_id" binding:"required"`
+}
+
+type CreateWallLayoutRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Rows        int    `json:"rows" binding:"required"`
+	Cols        int    `json:"cols" binding:"required"`
+	CameraIDs   []uint `json:"camera_ids"`
+	TourSeconds int    `json:"tour_seconds"`
+	Personal    bool   `json:"personal"` // Only visible to the creator
+}
+
+type UpdateWallLayoutRequest struct {
+	Name        *string `json:"name"`
+	Rows        *int    `json:"rows"`
+	Cols        *int    `json:"cols"`
+	CameraIDs   *[]uint `json:"camera_ids"`
+	TourSeconds *int    `json:"tour_seconds"`
+}
+
+type WallShiftRequest struct {
+	Name          *string `json:"name"`
+	LayoutID      *uint   `json:"layout_id"`
+	ScheduleDays  *string `json:"schedule_days"`
+	ScheduleStart *string `json:"schedule_start"`
+	ScheduleEnd   *string `json:"schedule_end"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// apply copies the provided fields onto shift and validates the result
+func (req *WallShiftRequest) apply(db *gorm.DB, shift *models.WallShift) error {
+	if req.Name != nil {
+		shift.Name = *req.Name
+	}
+	if req.LayoutID != nil {
+		shift.LayoutID = *req.LayoutID
+	}
+	if req.ScheduleDays != nil {
+		shift.ScheduleDays = *req.ScheduleDays
+	}
+	if req.ScheduleStart != nil {
+		shift.ScheduleStart = *req.ScheduleStart
+	}
+	if req.ScheduleEnd != nil {
+		shift.ScheduleEnd = *req.ScheduleEnd
+	}
+	if req.Enabled != nil {
+		shift.Enabled = *req.Enabled
+	}
+
+	if shift.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if shift.ScheduleStart == "" || shift.ScheduleEnd == "" {
+		return fmt.Errorf("schedule_start and schedule_end are required")
+	}
+	var count int64
+	if err := db.Model(&models.WallLayout{}).Where("id = ? AND owner_id IS NULL", shift.LayoutID).Count(&count).Error; err != nil || count == 0 {
+		return fmt.Errorf("shared layout %d not found", shift.LayoutID)
+	}
+	return validateSchedule(shift.ScheduleDays, shift.ScheduleStart, shift.ScheduleEnd)
+}
+
+func (h *WallHandler) findWall(c *gin.Context) (*models.Wall, bool) {
+	var wall models.Wall
+	if err := requestDB(h.db, c).First(&wall, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Wall not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wall"})
+		return nil, false
+	}
+	return &wall, true
+}
+
+func (h *WallHandler) ListWalls(c *gin.Context) {
+	var walls []models.Wall
+	if err := requestDB(h.db, c).Order("name").Find(&walls).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch walls"})
+		return
+	}
+
+	c.JSON(http.StatusOK, walls)
+}
+
+// GetWall returns a wall with its active layout and shift
+func (h *WallHandler) GetWall(c *gin.Context) {
+	wall, ok := h.findWall(c)
+	if !ok {
+		return
+	}
+
+	current := h.wallService.CurrentMessage(wall, services.WallReasonInitial)
+	c.JSON(http.StatusOK, gin.H{
+		"wall":    wall,
+		"layout":  current.Layout,
+		"shift":   current.Shift,
+		"clients": h.wallService.ClientCount(wall.ID),
+	})
+}
+
+func (h *WallHandler) CreateWall(c *gin.Context) {
+	var req CreateWallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wall := models.Wall{Name: req.Name}
+	if err := requestDB(h.db, c).Create(&wall).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create wall"})
+		return
+	}
+	if req.LayoutID != nil {
+		if err := h.wallService.SetLayout(&wall, *req.LayoutID, nil); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to set layout: %v", err)})
+			return
+		}
+	}
+
+	recordAudit(h.db, c, "create", "wall", fmt.Sprint(wall.ID), wall.Name)
+
+	c.JSON(http.StatusCreated, wall)
+}
+
+func (h *WallHandler) DeleteWall(c *gin.Context) {
+	wall, ok := h.findWall(c)
+	if !ok {
+		return
+	}
+
+	if err := requestDB(h.db, c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wall_id = ?", wall.ID).Delete(&models.WallShift{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(wall).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete wall"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "wall", fmt.Sprint(wall.ID), wall.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wall deleted successfully"})
+}
+
+// SetWallLayout switches a wall to a layout by hand. The switch lasts until
+// the next shift boundary.
+func (h *WallHandler) SetWallLayout(c *gin.Context) {
+	var req SetWallLayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wall, ok := h.findWall(c)
+	if !ok {
+		return
+	}
+
+	if err := h.wallService.SetLayout(wall, req.LayoutID, nil); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Layout not found"})
+			return
+		}
+		if err == services.ErrPersonalLayout {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Walls only show shared layouts"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set layout"})
+		return
+	}
+
+	recordAudit(h.db, c, "set_layout", "wall", fmt.Sprint(wall.ID), fmt.Sprintf("layout %d", req.LayoutID))
+
+	c.JSON(http.StatusOK, wall)
+}
+
+// HandleWallWebSocket is the channel wall clients use to receive layout switches
+func (h *WallHandler) HandleWallWebSocket(c *gin.Context) {
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	wall, ok := h.findWall(c)
+	if !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[Wall] WebSocket upgrade failed for wall %d: %v\n", wall.ID, err)
+		return
+	}
+
+	h.wallService.HandleWebSocket(conn, wall)
+}
+
+// ListWallLayouts returns the shared layouts and the current user's own
+// Query: ?mine=true for only the user's own
+func (h *WallHandler) ListWallLayouts(c *gin.Context) {
+	var layouts []models.WallLayout
+	if err := requestDB(h.db, c).Scopes(ownedOrShared(c)).Order("name").Find(&layouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch layouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, layouts)
+}
+
+func (h *WallHandler) CreateWallLayout(c *gin.Context) {
+	var req CreateWallLayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	layout := models.WallLayout{
+		Name:        req.Name,
+		Rows:        req.Rows,
+		Cols:        req.Cols,
+		CameraIDs:   joinIDs(req.CameraIDs),
+		TourSeconds: req.TourSeconds,
+	}
+	if req.Personal {
+		layout.OwnerID = currentUserID(c)
+	} else if c.GetString("role") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create shared layouts"})
+		return
+	}
+	if err := validateWallLayout(&layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkCameraIDs(h.db, req.CameraIDs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := requestDB(h.db, c).Create(&layout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create layout"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "wall_layout", fmt.Sprint(layout.ID), layout.Name)
+
+	c.JSON(http.StatusCreated, layout)
+}
+
+func (h *WallHandler) GetWallLayout(c *gin.Context) {
+	layout, ok := h.findWallLayout(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, layout)
+}
+
+// UpdateWallLayout edits a layout; walls showing it get the new version
+func (h *WallHandler) UpdateWallLayout(c *gin.Context) {
+	layout, ok := h.findWallLayout(c)
+	if !ok {
+		return
+	}
+	if !canEditOwned(c, layout.OwnerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change shared layouts, and only their owner personal ones"})
+		return
+	}
+
+	var req UpdateWallLayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != nil {
+		layout.Name = *req.Name
+	}
+	if req.Rows != nil {
+		layout.Rows = *req.Rows
+	}
+	if req.Cols != nil {
+		layout.Cols = *req.Cols
+	}
+	if req.CameraIDs != nil {
+		if err := checkCameraIDs(h.db, *req.CameraIDs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		layout.CameraIDs = joinIDs(*req.CameraIDs)
+	}
+	if req.TourSeconds != nil {
+		layout.TourSeconds = *req.TourSeconds
+	}
+	if err := validateWallLayout(layout); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Save(layout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update layout"})
+		return
+	}
+	h.wallService.LayoutChanged(layout.ID)
+
+	recordAudit(h.db, c, "update", "wall_layout", fmt.Sprint(layout.ID), layout.Name)
+
+	c.JSON(http.StatusOK, layout)
+}
+
+// DeleteWallLayout deletes a layout no wall or shift uses
+func (h *WallHandler) DeleteWallLayout(c *gin.Context) {
+	layout, ok := h.findWallLayout(c)
+	if !ok {
+		return
+	}
+	if !canEditOwned(c, layout.OwnerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can delete shared layouts, and only their owner personal ones"})
+		return
+	}
+
+	var walls, shifts int64
+	if err := requestDB(h.db, c).Model(&models.Wall{}).Where("active_layout_id = ?", layout.ID).Count(&walls).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check walls"})
+		return
+	}
+	if err := requestDB(h.db, c).Model(&models.WallShift{}).Where("layout_id = ?", layout.ID).Count(&shifts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check shifts"})
+		return
+	}
+	if walls > 0 || shifts > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Layout is shown on %d walls and used by %d shifts", walls, shifts)})
+		return
+	}
+
+	if err := requestDB(h.db, c).Delete(layout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete layout"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "wall_layout", fmt.Sprint(layout.ID), layout.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Layout deleted successfully"})
+}
+
+// findWallLayout loads the layout in the :id param if the current
+// user can see it, writing the error response otherwise
+func (h *WallHandler) findWallLayout(c *gin.Context) (*models.WallLayout, bool) {
+	var layout models.WallLayout
+	if err := requestDB(h.db, c).Scopes(ownedOrShared(c)).First(&layout, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Layout not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch layout"})
+		return nil, false
+	}
+	return &layout, true
+}
+
+func validateWallLayout(layout *models.WallLayout) error {
+	if layout.Rows < 1 || layout.Rows > maxWallGrid || layout.Cols < 1 || layout.Cols > maxWallGrid {
+		return fmt.Errorf("rows and cols must be between 1 and %d", maxWallGrid)
+	}
+	if layout.TourSeconds < 0 {
+		return fmt.Errorf("tour_seconds must not be negative")
+	}
+	return nil
+}
+
+// ListWallShifts returns the shift schedule of a wall
+func (h *WallHandler) ListWallShifts(c *gin.Context) {
+	var shifts []models.WallShift
+	if err := requestDB(h.db, c).Where("wall_id = ?", c.Param("id")).Order("id").Find(&shifts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shifts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shifts)
+}
+
+func (h *WallHandler) CreateWallShift(c *gin.Context) {
+	wall, ok := h.findWall(c)
+	if !ok {
+		return
+	}
+
+	var req WallShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shift := models.WallShift{WallID: wall.ID, Enabled: true}
+	if err := req.apply(h.db, &shift); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Create(&shift).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create shift"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "wall_shift", fmt.Sprint(shift.ID), shift.Name)
+
+	c.JSON(http.StatusCreated, shift)
+}
+
+func (h *WallHandler) UpdateWallShift(c *gin.Context) {
+	var shift models.WallShift
+	if err := requestDB(h.db, c).Where("wall_id = ?", c.Param("id")).First(&shift, c.Param("shiftId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shift not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shift"})
+		return
+	}
+
+	var req WallShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(h.db, &shift); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := requestDB(h.db, c).Save(&shift).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shift"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "wall_shift", fmt.Sprint(shift.ID), shift.Name)
+
+	c.JSON(http.StatusOK, shift)
+}
+
+func (h *WallHandler) DeleteWallShift(c *gin.Context) {
+	result := requestDB(h.db, c).Where("wall_id = ?", c.Param("id")).Delete(&models.WallShift{}, c.Param("shiftId"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete shift"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shift not found"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "wall_shift", c.Param("shiftId"), "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shift deleted successfully"})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WeatherHandler struct {
+	db      *gorm.DB
+	weather *services.WeatherService
+}
+
+func NewWeatherHandler(db *gorm.DB, weather *services.WeatherService) *WeatherHandler {
+	return &WeatherHandler{
+		db:      db,
+		weather: weather,
+	}
+}
+
+// GetCurrentWeather returns the latest weather of every site
+func (h *WeatherHandler) GetCurrentWeather(c *gin.Context) {
+	if !h.weather.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No weather provider is configured"})
+		return
+	}
+	observations := h.weather.Current()
+	sort.Slice(observations, func(i, j int) bool { return observations[i].Area < observations[j].Area })
+	c.JSON(http.StatusOK, observations)
+}
+
+// ListWeatherObservations returns stored observations newest first using
+// cursor pagination
+// Query: ?after=&limit=&area=&from=&to=
+func (h *WeatherHandler) ListWeatherObservations(c *gin.Context) {
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.WeatherObservation{}).Scopes(database.TimeRange("observed_at", from, to))
+	if area := c.Query("area"); area != "" {
+		query = query.Where("area = ?", area)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("observed_at", cursor.Time, cursor.ID))
+	}
+
+	var observations []models.WeatherObservation
+	if err := query.Scopes(database.NewestFirst("observed_at")).Limit(limit + 1).Find(&observations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weather observations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(observations, limit, func(o models.WeatherObservation) (time.Time, uint) {
+		return o.ObservedAt, o.ID
+	}))
+}
@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WebhookHandler struct {
+	db            *gorm.DB
+	notifications *services.NotificationService
+}
+
+func NewWebhookHandler(db *gorm.DB, notifications *services.NotificationService) *WebhookHandler {
+	return &WebhookHandler{
+		db:            db,
+		notifications: notifications,
+	}
+}
+
+type WebhookRequest struct {
+	Name       *string `json:"name"`
+	URL        *string `json:"url"`
+	EventTypes *string `json:"event_types"`
+	CameraID   *uint   `json:"camera_id"` // 0 clears it
+	Enabled    *bool   `json:"enabled"`
+}
+
+// apply copies the provided fields onto webhook and validates the result
+func (req *WebhookRequest) apply(webhook *models.Webhook) error {
+	if req.Name != nil {
+		webhook.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		webhook.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.EventTypes != nil {
+		types := []string{}
+		for _, eventType := range strings.Split(*req.EventTypes, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				types = append(types, eventType)
+			}
+		}
+		webhook.EventTypes = strings.Join(types, ",")
+	}
+	if req.CameraID != nil {
+		webhook.CameraID = req.CameraID
+		if *req.CameraID == 0 {
+			webhook.CameraID = nil
+		}
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+
+	if webhook.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	if webhook.EventTypes == "" {
+		return fmt.Errorf("event_types must name at least one event type")
+	}
+	return nil
+}
+
+// ListWebhooks returns the caller's webhooks; admins see everyone's
+// Query: ?user_id= (admins)
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID, err := parseUintParam(c, "user_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.GetString("role") != "admin" {
+		current := currentUserID(c)
+		if current == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		userID = *current
+	}
+
+	query := requestDB(h.db, c).Order("name, id")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	webhooks := []models.Webhook{}
+	if err := query.Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// CreateWebhook registers a webhook for the current user; the signing
+// secret is only returned in this response and when rotated
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID := currentUserID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook := models.Webhook{
+		UserID:     *userID,
+		EventTypes: models.DefaultWebhookEventTypes,
+		Enabled:    true,
+	}
+	if err := req.apply(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.notifications.CheckURL(webhook.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkCamera(c, &webhook) {
+		return
+	}
+	secret, encrypted, err := h.notifications.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	webhook.SecretEncrypted = encrypted
+
+	if err := requestDB(h.db, c).Create(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	recordAudit(h.db, c, "create", "webhook", fmt.Sprint(webhook.ID), fmt.Sprintf("%s: %s", webhook.Name, webhook.EventTypes))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.notifications.CheckURL(webhook.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkCamera(c, webhook) {
+		return
+	}
+
+	if err := requestDB(h.db, c).Save(webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	recordAudit(h.db, c, "update", "webhook", fmt.Sprint(webhook.ID), fmt.Sprintf("%s: %s", webhook.Name, webhook.EventTypes))
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook removes a webhook with its delivery log
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	err := requestDB(h.db, c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	recordAudit(h.db, c, "delete", "webhook", fmt.Sprint(webhook.ID), webhook.Name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// RotateWebhookSecret replaces the signing secret; deliveries from now on,
+// retries included, are signed with the new one
+func (h *WebhookHandler) RotateWebhookSecret(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+
+	secret, encrypted, err := h.notifications.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := requestDB(h.db, c).Model(webhook).Update("secret_encrypted", encrypted).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate secret"})
+		return
+	}
+
+	recordAudit(h.db, c, "rotate", "webhook", fmt.Sprint(webhook.ID), webhook.Name)
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret})
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook newest first
+// using cursor pagination
+// Query: ?after=&limit=&status=&type=&camera_id=&from=&to=
+func (h *WebhookHandler) ListWebhookDeliveries(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+	cursor, limit, err := parseCursorParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cameraID, err := parseUintParam(c, "camera_id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := requestDB(h.db, c).Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID).
+		Scopes(database.ForCamera(cameraID), database.TimeRange("created_at", from, to))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+	if cursor != nil {
+		query = query.Scopes(database.SeekBefore("created_at", cursor.Time, cursor.ID))
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Scopes(database.NewestFirst("created_at")).Limit(limit + 1).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildCursorPage(deliveries, limit, func(d models.WebhookDelivery) (time.Time, uint) {
+		return d.CreatedAt, d.ID
+	}))
+}
+
+// RedeliverWebhookDelivery queues a delivered or failed delivery again with
+// a fresh set of attempts, e.g. after the receiver was fixed
+func (h *WebhookHandler) RedeliverWebhookDelivery(c *gin.Context) {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return
+	}
+	var delivery models.WebhookDelivery
+	if err := requestDB(h.db, c).Where("webhook_id = ?", webhook.ID).First(&delivery, c.Param("deliveryId")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch delivery"})
+		return
+	}
+	if delivery.Status == models.DeliveryPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Delivery is still pending"})
+		return
+	}
+
+	now := time.Now()
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.DeliveredAt = nil
+	if err := requestDB(h.db, c).Save(&delivery).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue delivery"})
+		return
+	}
+	h.notifications.Wake()
+
+	recordAudit(h.db, c, "redeliver", "webhook", fmt.Sprint(webhook.ID), fmt.Sprintf("delivery %d: %s event %d", delivery.ID, delivery.EventType, delivery.EventID))
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// findWebhook loads the :id webhook, writing the error response when it
+// can't. Users only see their own webhooks, admins everyone's.
+func (h *WebhookHandler) findWebhook(c *gin.Context) (*models.Webhook, bool) {
+	var webhook models.Webhook
+	if err := requestDB(h.db, c).First(&webhook, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook"})
+		return nil, false
+	}
+	userID := currentUserID(c)
+	if c.GetString("role") != "admin" && (userID == nil || webhook.UserID != *userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// checkCamera rejects a webhook scoped to a camera that doesn't exist
+func (h *WebhookHandler) checkCamera(c *gin.Context, webhook *models.Webhook) bool {
+	if webhook.CameraID == nil {
+		return true
+	}
+	var camera models.Camera
+	if err := requestDB(h.db, c).Select("id").First(&camera, *webhook.CameraID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+		return false
+	}
+	return true
+}
@@ -8,7 +8,9 @@ import (
 	"command-center-vms-cctv/be/database"
 	"command-center-vms-cctv/be/handlers"
 	"command-center-vms-cctv/be/middleware"
+	"command-center-vms-cctv/be/models"
 	"command-center-vms-cctv/be/services"
+	"command-center-vms-cctv/be/tracing"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -24,30 +26,356 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// FFmpeg binary and the limits every FFmpeg the backend starts runs under
+	services.ConfigureFFmpeg(cfg.FFmpeg)
+
+	// OpenTelemetry spans of requests and stream starts, when an OTLP endpoint is set
+	tracing.Configure(cfg.Tracing, cfg.Cluster.NodeID)
+
+	// Database password, JWT secret and credential key from env, Vault or files
+	secrets, err := services.NewSecretStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
+	if cfg.Secrets.Provider != services.SecretsEnv {
+		cfg.Database.Credentials = secrets.DatabaseCredentials
+	}
+
 	// Initialize database
 	db, err := database.Initialize(cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
+	secrets.OnRotate(services.SecretCredential, func() { services.ReencryptSecrets(db, secrets) })
+	secrets.Start()
+
+	// Leader election between instances sharing the database; recorders,
+	// watchdogs and schedulers only start on the leader
+	cluster := services.NewClusterService(cfg.Cluster, secrets, db)
+	if cfg.Cluster.Enabled && cluster.ForwardSecretIsPlaceholder() {
+		log.Fatalf("Cluster mode needs CLUSTER_SECRET or JWT_SECRET: forwarded requests would be signed with the placeholder JWT secret")
+	}
+
+	// Per-site feature flags gating WebRTC, analytics and recording
+	features := services.NewFeatureFlagService(cfg.Features, db)
+	if err := features.Load(); err != nil {
+		log.Printf("Warning: Failed to load feature flags: %v", err)
+	}
+
+	// Privacy schedules blacking out live view and recording of cameras
+	privacyService := services.NewPrivacyService(db)
+	cluster.OnElected(privacyService.StartLog)
+
+	// Shared camera credentials (encrypted), resolved into RTSP URLs
+	credentialService := services.NewCredentialService(secrets, db)
+
+	// Weather per site (camera area), for event and analytics context
+	weatherService := services.NewWeatherService(cfg.Weather, db)
+	cluster.OnElected(weatherService.Start)
+
+	// Camera events POSTed to user webhooks, with retries
+	notificationService := services.NewNotificationService(cfg.Webhook, secrets, db)
+	cluster.OnElected(notificationService.Start)
+
+	// Camera status, stream health, events and alerts pushed to dashboards
+	liveFeed := services.NewLiveFeed()
+
+	// Alerts sent to users by SMS, email or digest, per their notification preferences
+	mailer := services.NewMailer(cfg.SMTP)
+	alertNotifier := services.NewAlertNotifier(cfg.Notify, db, mailer)
+	cluster.OnElected(alertNotifier.Start)
+
+	// System events (preemptions, ...) and the alerts their rules raise
+	eventService := services.NewEventService(db, weatherService, notificationService, liveFeed, alertNotifier)
 
 	// Initialize MediaMTX service (RTSP → HLS via MediaMTX)
-	mediamtxService := services.NewMediaMTXService(cfg.MediaMTX)
+	mediamtxService := services.NewMediaMTXService(cfg.MediaMTX, cfg.Watchdog, db, eventService)
+	mediamtxService.DetectAPIVersion()
+	mediamtxService.StartHealthPoller()
+	cluster.OnElected(func() { mediamtxService.StartReconciler(credentialService) })
+
+	// One RTSP pull per camera: backend pipelines read the MediaMTX path
+	ingestService := services.NewIngestService(mediamtxService, credentialService)
+
+	// Camera statuses: built-in online/offline plus admin-defined lifecycle statuses
+	cameraStatuses := services.NewCameraStatusService(db)
+	if err := cameraStatuses.Load(); err != nil {
+		log.Printf("Warning: Failed to load camera statuses: %v", err)
+	}
+
+	// Periodic RTSP health checks for health history and flap detection
+	healthHistory := services.NewHealthHistoryService(cfg.Health, db, ingestService, eventService, liveFeed, cameraStatuses)
+	cluster.OnElected(healthHistory.Start)
+
+	// Per-camera FFmpeg CPU and bandwidth accounting (hourly, for capacity planning)
+	usageTracker := services.NewUsageTracker(db)
+
+	// The FFmpeg concurrency cap
+	transcodeScheduler := services.NewTranscodeScheduler(cfg.FFmpeg, eventService)
+
+	// Failure injection for end-to-end tests (routes only outside production)
+	chaosService := services.NewChaosService(usageTracker, eventService)
+
+	// Load test mode: synthetic cameras streaming FFmpeg test sources
+	cluster.OnElected(services.NewLoadTestService(cfg.LoadTest, db, mediamtxService, eventService).Start)
 
 	// Initialize RTSP service (legacy, kept for backward compatibility)
-	rtspService := services.NewRTSPService(cfg.RTSP)
+	rtspService := services.NewRTSPService(cfg.RTSP, cfg.Watchdog, usageTracker, eventService)
 
-	// Initialize MJPEG service (simple, real-time streaming without file storage)
-	mjpegService := services.NewMJPEGService()
+	// MJPEG service, one FFmpeg per camera fanned out to every viewer
+	mjpegService := services.NewMJPEGService(usageTracker, transcodeScheduler)
 
 	// Initialize WebRTC service (optional, more complex)
-	webrtcService := services.NewWebRTCService()
+	webrtcService := services.NewWebRTCService(cfg.WebRTC, usageTracker, transcodeScheduler)
+
+	// In cluster mode each camera's WebRTC and MJPEG transcode runs on one
+	// node, which keeps its claim while the stream runs
+	cluster.TrackPipeline(services.PipelineWebRTC, func(cameraID uint) bool {
+		active, _ := webrtcService.GetStreamStatus(cameraID)
+		return active
+	}, func(cameraID uint) { webrtcService.StopStream(cameraID) })
+	cluster.TrackPipeline(services.PipelineMJPEG, func(cameraID uint) bool {
+		active, _ := mjpegService.GetStreamStatus(cameraID)
+		return active
+	}, func(cameraID uint) { mjpegService.StopStream(cameraID) })
+
+	// MediaMTX paths and WebRTC streams nobody used for STREAM_IDLE_TIMEOUT
+	// are stopped; MJPEG stops with its last viewer on its own
+	viewerTracker := services.NewViewerTracker(cfg.StreamIdle)
+	viewerTracker.Track(services.PipelineHLS, func() []uint {
+		return services.StreamCameras(mediamtxService.GetAllStreamHealth())
+	}, func(cameraID uint) bool {
+		readers, known := mediamtxService.GetPathReaders(cameraID)
+		return !known || readers > 0
+	}, mediamtxService.StopStream)
+	viewerTracker.Track(services.PipelineWebRTC, func() []uint {
+		return services.StreamCameras(webrtcService.GetAllStreamStatus())
+	}, func(cameraID uint) bool {
+		return webrtcService.GetViewerCount(cameraID) > 0
+	}, webrtcService.StopStream)
+	viewerTracker.Start()
+	features.OnDisable(models.FeatureWebRTC, func(cameraID uint) { webrtcService.StopStream(cameraID) })
+
+	// Initialize audio service (audio-only streams for monitoring posts)
+	audioService := services.NewAudioService(usageTracker, transcodeScheduler)
+
+	// Audio level monitoring for cameras with audio rules (glass break, shouting, ...)
+	cluster.OnElected(services.NewAudioLevelWorker(db, eventService, usageTracker, transcodeScheduler, ingestService).Start)
+
+	// Thumbnail sprites of recordings for scrubber hover previews
+	thumbnailService := services.NewThumbnailService(cfg.Recording, transcodeScheduler)
+	thumbnailService.Start()
+
+	// Continuous (scheduled) and on-demand recording to segmented MP4
+	recordingService := services.NewRecordingService(cfg.Recording, db, ingestService, usageTracker, thumbnailService, features, privacyService)
+	cluster.OnElected(recordingService.Start)
+	features.OnDisable(models.FeatureRecording, func(cameraID uint) { recordingService.Stop(cameraID) })
+
+	// A camera's blackout ends the streams and recording this node runs for it
+	privacyService.OnBlackout(func(cameraID uint) {
+		mediamtxService.StopStream(cameraID)
+		webrtcService.StopStream(cameraID)
+		mjpegService.StopStream(cameraID)
+		rtspService.StopStream(cameraID)
+		audioService.StopStreams(cameraID)
+		recordingService.Stop(cameraID)
+	})
+
+	// Tamper detection (covered, defocused or repositioned cameras)
+	tamperService := services.NewTamperService(cfg.Tamper, db, eventService, ingestService, features, privacyService)
+	cluster.OnElected(tamperService.Start)
+
+	// Image quality scoring (dirty lenses, failing sensors)
+	qualityService := services.NewQualityService(cfg.Quality, db, eventService, ingestService, weatherService, features)
+	cluster.OnElected(qualityService.Start)
+
+	// Cached single-frame JPEGs for camera thumbnails
+	snapshotService := services.NewSnapshotService(cfg.Snapshot, ingestService)
+	snapshotService.Start()
+
+	// Periodic thumbnails of online cameras for grid views
+	cameraThumbnailService := services.NewCameraThumbnailService(cfg.Thumbnail, db, ingestService, healthHistory, privacyService, transcodeScheduler)
+	cluster.OnElected(cameraThumbnailService.Start)
+
+	// Motion detection (FFmpeg scene change) with snapshots
+	cluster.OnElected(services.NewMotionService(cfg.Motion, db, eventService, usageTracker, transcodeScheduler, ingestService, features, privacyService).Start)
+
+	// Video walls: WebSocket clients and shift-based layout switching
+	wallService := services.NewWallService(db)
+	wallService.Start()
+
+	// Synchronized multi-camera playback sessions
+	playbackService := services.NewPlaybackService(db)
+	playbackService.Start()
+
+	// Background video exports (multi-camera composites, ...)
+	exportService := services.NewExportService(cfg.Export, db, transcodeScheduler)
+	exportService.Start()
+
+	// Morning email digest of overnight events for managers
+	digestService := services.NewDigestService(cfg.Digest, db, mailer)
+	cluster.OnElected(digestService.Start)
+
+	// Initialize ONVIF service (camera reboot and device management)
+	onvifService := services.NewONVIFService()
+
+	// Intercom calls, two-way audio and door release
+	intercomService := services.NewIntercomService(cfg.Intercom, db, eventService, liveFeed, onvifService, credentialService, webrtcService, usageTracker)
+	cluster.OnElected(intercomService.Start)
+
+	// Detections and audio events from the analytics of Profile T cameras,
+	// and doorbell presses of intercoms
+	cluster.OnElected(services.NewONVIFMetadataService(cfg.Metadata, db, eventService, usageTracker, ingestService, features, intercomService, privacyService).Start)
+
+	// Signed HLS URLs, checked by MediaMTX through its HTTP auth callback
+	streamTokens := services.NewStreamTokenService(cfg.StreamToken, eventService)
+	if cfg.MediaMTX.AuthCallbackURL != "" && !streamTokens.Enabled() {
+		log.Printf("Warning: MEDIAMTX_AUTH_CALLBACK_URL is set without STREAM_TOKEN_SECRET; MediaMTX will let every read through")
+	}
+
+	// Login sessions: short-lived access tokens renewed with refresh tokens
+	sessionService := services.NewSessionService(cfg.JWT, secrets, db)
+	cluster.OnElected(sessionService.Start)
+	sessionService.StartCachePrune()
+	if cfg.Cluster.Enabled {
+		// Revocations made through another node apply here within seconds
+		sessionService.WatchRevocations()
+	}
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, cfg.JWT)
-	cameraHandler := handlers.NewCameraHandler(db, mediamtxService, rtspService, mjpegService, webrtcService)
+	// Single sign-on through the corporate identity provider (optional)
+	oidcService := services.NewOIDCService(cfg.OIDC, db, secrets)
+	authHandler := handlers.NewAuthHandler(db, sessionService, oidcService)
+	cameraHandler := handlers.NewCameraHandler(db, mediamtxService, rtspService, mjpegService, webrtcService, onvifService, audioService, credentialService, healthHistory, services.NewStreamViewLog(db), streamTokens, recordingService, cameraStatuses, cluster, viewerTracker, features)
+	eventHandler := handlers.NewEventHandler(db, streamTokens, liveFeed)
+	recordingHandler := handlers.NewRecordingHandler(db, recordingService, thumbnailService, streamTokens, cluster, transcodeScheduler)
+	auditHandler := handlers.NewAuditHandler(db)
+	incidentHandler := handlers.NewIncidentHandler(db)
+	searchHandler := handlers.NewSearchHandler(db)
+	analyticsHandler := handlers.NewAnalyticsHandler(db, cfg.Analytics)
+	audioRuleHandler := handlers.NewAudioRuleHandler(db)
+	alertRuleHandler := handlers.NewAlertRuleHandler(db)
+	alertHandler := handlers.NewAlertHandler(db)
+	patrolHandler := handlers.NewPatrolHandler(db, cfg.Patrol)
+	areaAccess := handlers.NewAreaAccess(db)
+	cluster.OnElected(services.NewVisitorSnapshotRetention(cfg.Visitor, db).Start)
+	visitorHandler := handlers.NewVisitorHandler(db, snapshotService, privacyService, areaAccess, cfg.Visitor)
+	privacyHandler := handlers.NewPrivacyHandler(db, privacyService)
+	settingsHandler := handlers.NewSettingsHandler(db, cfg)
+	mapHandler := handlers.NewMapHandler(db, cameraStatuses)
+	weatherHandler := handlers.NewWeatherHandler(db, weatherService)
+	webhookHandler := handlers.NewWebhookHandler(db, notificationService)
+	motionHandler := handlers.NewMotionHandler(db)
+	tamperHandler := handlers.NewTamperHandler(db, tamperService, snapshotService)
+	qualityHandler := handlers.NewQualityHandler(db, qualityService)
+	snapshotHandler := handlers.NewSnapshotHandler(db, snapshotService, cameraThumbnailService)
+	// Optional LDAP / Active Directory sync of users' contact details
+	directoryService := services.NewDirectoryService(cfg.Directory, db)
+	cluster.OnElected(directoryService.Start)
+	userHandler := handlers.NewUserHandler(db, sessionService, directoryService)
+	dashboardHandler := handlers.NewDashboardHandler(db, cameraStatuses)
+	notifyHandler := handlers.NewNotificationPreferenceHandler(db)
+	wallHandler := handlers.NewWallHandler(db, wallService)
+	cameraGroupHandler := handlers.NewCameraGroupHandler(db)
+	credentialHandler := handlers.NewCredentialHandler(db, credentialService, cameraHandler)
+	cameraStatusHandler := handlers.NewCameraStatusHandler(db, cameraStatuses)
+	mediamtxHandler := handlers.NewMediaMTXHandler(db, mediamtxService, streamTokens, privacyService)
+	healthHandler := handlers.NewHealthHandler(db, healthHistory)
+	legalHoldHandler := handlers.NewLegalHoldHandler(db)
+	streamViewHandler := handlers.NewStreamViewHandler(db)
+	clientLogHandler := handlers.NewClientLogHandler(cfg.ClientLog, db)
+	cluster.OnElected(services.NewClientLogRetention(cfg.ClientLog, db).Start)
+	playbackHandler := handlers.NewPlaybackHandler(db, playbackService)
+	exportHandler := handlers.NewExportHandler(db, exportService, streamTokens)
+	macroHandler := handlers.NewMacroHandler(db, services.NewMacroService(db, recordingService, onvifService, credentialService))
+	countingHandler := handlers.NewCountingHandler(db)
+	integrationHandler := handlers.NewIntegrationHandler(db, services.NewIntegrationService(secrets, db, eventService))
+	digestHandler := handlers.NewDigestHandler(db, digestService)
+	intercomHandler := handlers.NewIntercomHandler(db, intercomService)
+
+	// Stored responses for retried requests carrying an Idempotency-Key
+	idempotencyService := services.NewIdempotencyService(cfg.Idempotency, db)
+	cluster.OnElected(idempotencyService.Start)
+
+	// Client network ACLs for the API, stream endpoints and roles
+	networkACL, err := middleware.NewNetworkACL(cfg.Network)
+	if err != nil {
+		log.Fatalf("Invalid network ACL: %v", err)
+	}
+
+	// Per-route latency histograms
+	requestMetrics := services.NewRequestMetrics()
+	metricsHandler := handlers.NewMetricsHandler(requestMetrics)
+	chaosHandler := handlers.NewChaosHandler(db, chaosService)
+	clusterHandler := handlers.NewClusterHandler(cluster)
+	featureFlagHandler := handlers.NewFeatureFlagHandler(db, features)
+
+	// Re-reads the feature flags, so changes made through another instance apply here
+	features.Start()
+
+	// Applies the privacy schedules at every minute boundary
+	privacyService.Start()
+
+	// Runs the leader-only services here, now or once elected
+	cluster.Start()
 
 	// Setup router
-	router := setupRouter(authHandler, cameraHandler, cfg)
+	router := setupRouter(&routeHandlers{
+		auth:        authHandler,
+		camera:      cameraHandler,
+		event:       eventHandler,
+		recording:   recordingHandler,
+		audit:       auditHandler,
+		incident:    incidentHandler,
+		search:      searchHandler,
+		analytics:   analyticsHandler,
+		audioRule:   audioRuleHandler,
+		alertRule:   alertRuleHandler,
+		alert:       alertHandler,
+		patrol:      patrolHandler,
+		visitor:     visitorHandler,
+		privacy:     privacyHandler,
+		settings:    settingsHandler,
+		mapView:     mapHandler,
+		weather:     weatherHandler,
+		webhook:     webhookHandler,
+		motion:      motionHandler,
+		tamper:      tamperHandler,
+		quality:     qualityHandler,
+		snapshot:    snapshotHandler,
+		user:        userHandler,
+		dashboard:   dashboardHandler,
+		notify:      notifyHandler,
+		wall:        wallHandler,
+		group:       cameraGroupHandler,
+		credential:  credentialHandler,
+		statuses:    cameraStatusHandler,
+		mediamtx:    mediamtxHandler,
+		health:      healthHandler,
+		digest:      digestHandler,
+		metrics:     metricsHandler,
+		chaos:       chaosHandler,
+		legalHold:   legalHoldHandler,
+		counting:    countingHandler,
+		integration: integrationHandler,
+		streamView:  streamViewHandler,
+		clientLog:   clientLogHandler,
+		playback:    playbackHandler,
+		export:      exportHandler,
+		macro:       macroHandler,
+		cluster:     clusterHandler,
+		features:    featureFlagHandler,
+		intercom:    intercomHandler,
+
+		sessions:    sessionService,
+		secrets:     secrets,
+		idempotency: idempotencyService,
+		nodes:       cluster,
+		privacyMode: privacyService,
+		tokens:      streamTokens,
+		areas:       areaAccess,
+		acl:         networkACL,
+	}, cfg, requestMetrics)
 
 	// Start server
 	port := cfg.Server.Port
@@ -61,13 +389,76 @@ func main() {
 	}
 }
 
-func setupRouter(authHandler *handlers.AuthHandler, cameraHandler *handlers.CameraHandler, cfg *config.Config) *gin.Engine {
+// routeHandlers groups the HTTP handlers wired into the router
+type routeHandlers struct {
+	auth        *handlers.AuthHandler
+	camera      *handlers.CameraHandler
+	event       *handlers.EventHandler
+	recording   *handlers.RecordingHandler
+	audit       *handlers.AuditHandler
+	incident    *handlers.IncidentHandler
+	search      *handlers.SearchHandler
+	analytics   *handlers.AnalyticsHandler
+	audioRule   *handlers.AudioRuleHandler
+	alertRule   *handlers.AlertRuleHandler
+	alert       *handlers.AlertHandler
+	patrol      *handlers.PatrolHandler
+	visitor     *handlers.VisitorHandler
+	privacy     *handlers.PrivacyHandler
+	settings    *handlers.SettingsHandler
+	mapView     *handlers.MapHandler
+	weather     *handlers.WeatherHandler
+	webhook     *handlers.WebhookHandler
+	motion      *handlers.MotionHandler
+	tamper      *handlers.TamperHandler
+	quality     *handlers.QualityHandler
+	snapshot    *handlers.SnapshotHandler
+	user        *handlers.UserHandler
+	dashboard   *handlers.DashboardHandler
+	notify      *handlers.NotificationPreferenceHandler
+	wall        *handlers.WallHandler
+	group       *handlers.CameraGroupHandler
+	credential  *handlers.CredentialHandler
+	statuses    *handlers.CameraStatusHandler
+	mediamtx    *handlers.MediaMTXHandler
+	health      *handlers.HealthHandler
+	digest      *handlers.DigestHandler
+	metrics     *handlers.MetricsHandler
+	chaos       *handlers.ChaosHandler
+	legalHold   *handlers.LegalHoldHandler
+	counting    *handlers.CountingHandler
+	integration *handlers.IntegrationHandler
+	streamView  *handlers.StreamViewHandler
+	clientLog   *handlers.ClientLogHandler
+	playback    *handlers.PlaybackHandler
+	export      *handlers.ExportHandler
+	macro       *handlers.MacroHandler
+	cluster     *handlers.ClusterHandler
+	features    *handlers.FeatureFlagHandler
+	intercom    *handlers.IntercomHandler
+
+	sessions    *services.SessionService     // Checks the session behind each access token
+	secrets     *services.SecretStore        // JWT secrets access tokens are verified with
+	idempotency *services.IdempotencyService // Idempotency-Key support for retry-prone endpoints
+	nodes       *services.ClusterService     // Forwards stream requests to the node running the stream
+	privacyMode *services.PrivacyService     // Refuses live views of cameras in privacy mode
+	tokens      *services.StreamTokenService // Checks pre-signed download links
+	areas       *handlers.AreaAccess         // Limits camera routes to the user's assigned areas
+	acl         *middleware.NetworkACL
+}
+
+func setupRouter(h *routeHandlers, cfg *config.Config, requestMetrics *services.RequestMetrics) *gin.Engine {
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	router := gin.Default()
+	// Only these proxies may set the client address the ACLs check; with
+	// none, X-Forwarded-For is ignored so clients can't pick their address
+	if err := router.SetTrustedProxies(cfg.Network.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// CORS configuration
 	// Allow all localhost origins for development
@@ -86,12 +477,18 @@ func setupRouter(authHandler *handlers.AuthHandler, cameraHandler *handlers.Came
 				origin == "http://127.0.0.1:3000"
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Cache-Control", "Pragma"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Cache-Control", "Pragma", "Expires"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Cache-Control", "Pragma", "Idempotency-Key", "traceparent", "Range", "If-Range"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Cache-Control", "Pragma", "Expires", "Deprecation", "Sunset", "Link", "Idempotent-Replayed", "X-Suppressed-Rows", "Location", "Accept-Ranges", "Content-Range", "Content-Disposition", "ETag", middleware.TraceIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * 3600, // 12 hours
 	}))
 
+	// Request spans, parents of the query and stream start spans of the request
+	router.Use(middleware.Tracing())
+
+	// Request latency per route; also tags slow query logs with the route
+	router.Use(middleware.RequestMetrics(requestMetrics))
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -101,39 +498,435 @@ func setupRouter(authHandler *handlers.AuthHandler, cameraHandler *handlers.Came
 	// No need to serve static files from backend anymore
 	// MediaMTX handles CORS and cache headers in its configuration
 
+	// v1 stays as is for existing clients, flagged deprecated in favor of v2
+	v1 := router.Group("/api/v1", middleware.Deprecated("/api/v1", "/api/v2", cfg.Server.V1Sunset))
+	registerAPIRoutes(v1, h, cfg, 1)
+
+	// v2: same handlers in the standard envelope, plus v2-only endpoints
+	v2 := router.Group("/api/v2", middleware.ResponseEnvelope())
+	registerAPIRoutes(v2, h, cfg, 2)
+
+	return router
+}
+
+// registerAPIRoutes registers the API on a version group. Versions share
+// handlers; the few endpoints whose contract changed branch on version.
+func registerAPIRoutes(api *gin.RouterGroup, h *routeHandlers, cfg *config.Config, version int) {
+	api.Use(h.acl.Allow(middleware.ACLClassAPI))
+
 	// Public routes
-	api := router.Group("/api/v1")
 	{
 		// Auth routes
 		auth := api.Group("/auth")
 		{
-			auth.POST("/login", authHandler.Login)
+			auth.POST("/login", h.auth.Login)
+			auth.POST("/refresh", h.auth.Refresh)
+			auth.GET("/oidc/login", h.auth.OIDCLogin)       // Redirects to the identity provider
+			auth.GET("/oidc/callback", h.auth.OIDCCallback) // Back from it, redirects to OIDC_FRONTEND_URL
+		}
+
+		// Site name, logo and banner for the login page
+		api.GET("/settings/branding", h.settings.GetBranding)
+
+		// Inbound webhooks from third-party systems, authenticated by signature
+		api.POST("/hooks/:integration", h.integration.ReceiveWebhook)
+
+		// MediaMTX HTTP auth callback: checks signed stream URLs
+		api.POST("/mediamtx/auth", h.mediamtx.AuthorizeStream)
+
+		// Pre-signed playback links (see /events/:id/media), authenticated by their token
+		signed := api.Group("/signed/cameras", h.acl.Allow(middleware.ACLClassStream))
+		{
+			signed.GET("/:id/playback", h.recording.RequirePlaybackToken, h.recording.GetPlayback)
+			signed.GET("/:id/playback/segments/:recordingId", h.recording.RequirePlaybackToken, h.recording.ServePlaybackSegment)
+
+			// Pre-signed downloads (see the download-link routes); resumable with Range
+			recordingToken := handlers.RequireDownloadToken(h.tokens, h.sessions, "recording")
+			clipToken := handlers.RequireDownloadToken(h.tokens, h.sessions, "retained_clip")
+			signed.GET("/:id/recordings/:recordingId/download", recordingToken, h.recording.DownloadRecording)
+			signed.HEAD("/:id/recordings/:recordingId/download", recordingToken, h.recording.DownloadRecording)
+			signed.GET("/:id/retained-clips/:clipId/download", clipToken, h.recording.DownloadRetainedClip)
+			signed.HEAD("/:id/retained-clips/:clipId/download", clipToken, h.recording.DownloadRetainedClip)
+		}
+		signedExports := api.Group("/signed/exports", h.acl.Allow(middleware.ACLClassStream))
+		{
+			exportToken := handlers.RequireDownloadToken(h.tokens, h.sessions, "export")
+			signedExports.GET("/:id/download", exportToken, h.export.DownloadExport)
+			signedExports.HEAD("/:id/download", exportToken, h.export.DownloadExport)
 		}
 	}
 
 	// Protected routes
 	protected := api.Group("")
-	protected.Use(middleware.AuthMiddleware(cfg.JWT.Secret))
+	protected.Use(middleware.AuthMiddleware(h.secrets, h.sessions))
+	protected.Use(h.acl.AllowRole())
+	protected.Use(middleware.RedactFields()) // Hides camera network details and exact positions from viewers
+	protected.Use(middleware.SelectFields()) // ?fields= on list endpoints
+	idempotent := middleware.Idempotency(h.idempotency)
+	streamACL := h.acl.Allow(middleware.ACLClassStream)
+	private := middleware.PrivacyMode(h.privacyMode)
+	webrtcOwner := middleware.StreamOwner(h.nodes, services.PipelineWebRTC)
+	mjpegOwner := middleware.StreamOwner(h.nodes, services.PipelineMJPEG)
+	leader := middleware.Leader(h.nodes)                           // Health history and recorders live on the leader
+	operator := middleware.RequireRole("admin", "manager", "user") // Not viewers
+	cameraArea := h.areas.Camera
 	{
 		// Auth routes
-		protected.GET("/auth/me", authHandler.GetMe)
-		protected.POST("/auth/logout", authHandler.Logout)
+		protected.GET("/auth/me", h.auth.GetMe)
+		protected.POST("/auth/logout", h.auth.Logout)
+		protected.GET("/auth/sessions", h.auth.ListSessions)
+		protected.DELETE("/auth/sessions/:id", h.auth.RevokeSession)
 
 		// Camera routes
 		cameras := protected.Group("/cameras")
 		{
-			cameras.GET("", cameraHandler.GetCameras)
-			cameras.GET("/:id", cameraHandler.GetCamera)
-			cameras.POST("", cameraHandler.CreateCamera)
-			cameras.PUT("/:id", cameraHandler.UpdateCamera)
-			cameras.DELETE("/:id", cameraHandler.DeleteCamera)
-			cameras.GET("/:id/stream", cameraHandler.GetStreamURL) // HLS stream (legacy)
-			cameras.GET("/:id/stream/health", cameraHandler.GetStreamHealth)
-			cameras.GET("/:id/mjpeg", cameraHandler.GetMJPEGStream)            // MJPEG stream (simple, real-time, no file storage)
-			cameras.GET("/:id/webrtc", cameraHandler.GetWebRTCStream)          // WebRTC stream (optional)
-			cameras.GET("/:id/webrtc/ws", cameraHandler.HandleWebRTCWebSocket) // WebRTC WebSocket signaling
+			if version >= 2 {
+				cameras.GET("", h.camera.ListCamerasPage) // Cursor paginated
+			} else {
+				cameras.GET("", h.camera.GetCameras)
+			}
+			cameras.GET("/status", leader, h.camera.GetCameraStatuses) // Compact status for map pins
+			cameras.GET("/clusters", h.mapView.GetMapClusters)         // Grid clusters of a map view
+			cameras.GET("/changes", h.camera.GetCameraChanges)         // Incremental sync feed
+			cameras.GET("/reliability", leader, h.health.GetCameraReliability)
+			cameras.GET("/quality/degraded", h.quality.ListDegradedCameras) // Dirty lenses, failing sensors
+			cameras.GET("/:id", h.camera.GetCamera)
+			cameras.POST("", idempotent, h.camera.CreateCamera)
+			cameras.PUT("/:id", h.camera.UpdateCamera)
+			cameras.DELETE("/:id", h.camera.DeleteCamera)
+			cameras.DELETE("", middleware.RequireRole("admin"), h.camera.DeleteCameras)       // Batch: ?ids=&mode=block|cascade|archive&dry_run=
+			cameras.POST("/plan", middleware.RequireRole("admin"), h.camera.PlanCameras)      // Diff a desired camera list, changes nothing
+			cameras.POST("/apply", middleware.RequireRole("admin"), h.camera.ApplyCameraPlan) // Apply a plan by plan_id
+			cameras.GET("/plans/:id", middleware.RequireRole("admin"), h.camera.GetCameraPlan)
+			if version >= 2 {
+				cameras.GET("/:id/stream", streamACL, private, middleware.StreamOwner(h.nodes, ""), idempotent, h.camera.GetStream) // Unified: ?protocol=hls|webrtc|mjpeg|audio
+			} else {
+				cameras.GET("/:id/stream", streamACL, private, idempotent, h.camera.GetStreamURL) // HLS stream (legacy)
+			}
+			cameras.POST("/:id/stream/keepalive", streamACL, private, middleware.StreamOwner(h.nodes, ""), h.camera.StreamKeepalive) // Keeps an idle stream running: ?protocol=hls|webrtc
+			cameras.POST("/:id/stream/stop", operator, streamACL, cameraArea, h.camera.StopCameraStream)                             // Stops a stuck stream (MediaMTX path, FFmpeg)
+			cameras.POST("/:id/stream/restart", operator, streamACL, private, cameraArea, h.camera.RestartCameraStream)              // Stops it and sets the MediaMTX path up again
+			cameras.GET("/:id/stream/health", h.camera.GetStreamHealth)
+			cameras.GET("/:id/stream/logs", operator, cameraArea, h.camera.GetStreamLogs) // FFmpeg stderr per pipeline
+			cameras.GET("/:id/health/history", leader, h.health.GetHealthHistory)
+			cameras.GET("/:id/status/history", h.health.GetStatusHistory)                                     // online/offline changes
+			cameras.GET("/:id/mjpeg", streamACL, private, mjpegOwner, h.camera.GetMJPEGStream)                // MJPEG stream, one FFmpeg shared by all viewers
+			cameras.GET("/:id/webrtc", streamACL, private, webrtcOwner, idempotent, h.camera.GetWebRTCStream) // WebRTC stream (optional)
+			cameras.GET("/:id/webrtc/ws", streamACL, private, webrtcOwner, h.camera.HandleWebRTCWebSocket)    // WebRTC WebSocket signaling
+			cameras.POST("/:id/whep", streamACL, private, webrtcOwner, h.camera.CreateWHEPSession)            // Standard WHEP: SDP offer in, answer out
+			cameras.DELETE("/:id/whep/:session", streamACL, webrtcOwner, h.camera.DeleteWHEPSession)          // Ends a WHEP session
+			cameras.GET("/:id/audio", streamACL, private, h.camera.GetAudioStream)                            // Audio only (AAC/Opus over HTTP)
+			cameras.GET("/:id/snapshot", streamACL, private, h.snapshot.GetSnapshot)                          // Cached JPEG thumbnail
+			cameras.GET("/:id/snapshot/burst", streamACL, private, h.snapshot.GetSnapshotBurst)               // Series of frames, JSON or ZIP
+			cameras.GET("/:id/thumbnail", streamACL, private, h.snapshot.GetThumbnail)                        // Stored grid thumbnail
+			cameras.POST("/:id/reboot", operator, cameraArea, h.camera.RebootCamera)                          // ONVIF SystemReboot
+			cameras.GET("/:id/diagnostics", operator, cameraArea, h.camera.DiagnoseCamera)                    // Ping/port checks and recent errors
+			cameras.GET("/:id/recordings/calendar", h.recording.GetRecordingCalendar)                         // Per-day coverage for playback
+			cameras.GET("/:id/recordings", h.recording.ListCameraRecordings)
+			cameras.GET("/:id/recordings/status", leader, h.recording.GetRecordingStatus)
+			cameras.POST("/:id/recordings/start", operator, cameraArea, leader, h.recording.StartRecording) // On demand, optional duration
+			cameras.POST("/:id/recordings/stop", operator, cameraArea, leader, h.recording.StopRecording)
+			cameras.GET("/:id/recordings/:recordingId/download", h.recording.DownloadRecording)
+			cameras.POST("/:id/recordings/:recordingId/download-link", h.recording.CreateRecordingDownloadLink) // Pre-signed, resumable
+			cameras.GET("/:id/retained-clips", h.recording.ListRetainedClips)                                   // Kept around events and bookmarks by retention
+			cameras.GET("/:id/retained-clips/:clipId/download", h.recording.DownloadRetainedClip)
+			cameras.POST("/:id/retained-clips/:clipId/download-link", h.recording.CreateRetainedClipDownloadLink)
+			cameras.PUT("/:id/recording-schedule", operator, cameraArea, h.recording.SetRecordingSchedule) // Continuous recording window
+			cameras.GET("/:id/playback", h.recording.GetPlayback)                                          // HLS VOD of recordings, ?from=&to=
+			cameras.GET("/:id/playback/timeline", h.recording.GetPlaybackTimeline)
+			cameras.GET("/:id/playback/segments/:recordingId", streamACL, h.recording.ServePlaybackSegment)
+			cameras.GET("/:id/playback/thumbnails.vtt", h.recording.GetPlaybackThumbnails) // Scrubber hover previews
+			cameras.GET("/:id/playback/sprites/:recordingId", h.recording.ServePlaybackSprite)
+			cameras.POST("/:id/clips", idempotent, h.export.CreateClipExport) // MP4 cut between two times
+			cameras.GET("/:id/audio-rules", h.audioRule.ListAudioRules)
+			cameras.POST("/:id/audio-rules", h.audioRule.CreateAudioRule)
+			cameras.PUT("/:id/audio-rules/:ruleId", h.audioRule.UpdateAudioRule)
+			cameras.DELETE("/:id/audio-rules/:ruleId", h.audioRule.DeleteAudioRule)
+			cameras.GET("/:id/motion-events", h.motion.ListMotionEvents) // ?from=&to=, cursor paginated
+			cameras.GET("/:id/motion-events/:eventId/snapshot", h.motion.ServeMotionSnapshot)
+			cameras.GET("/:id/alert-rules", h.alertRule.ListAlertRules) // When events alert: schedule and cooldown per type
+			cameras.POST("/:id/alert-rules", h.alertRule.CreateAlertRule)
+			cameras.PUT("/:id/alert-rules/:ruleId", h.alertRule.UpdateAlertRule)
+			cameras.DELETE("/:id/alert-rules/:ruleId", h.alertRule.DeleteAlertRule)
+			cameras.GET("/:id/privacy-schedules", h.privacy.ListPrivacySchedules) // Blackout windows: no live view or recording
+			cameras.POST("/:id/privacy-schedules", middleware.RequireRole("admin"), h.privacy.CreatePrivacySchedule)
+			cameras.PUT("/:id/privacy-schedules/:scheduleId", middleware.RequireRole("admin"), h.privacy.UpdatePrivacySchedule)
+			cameras.DELETE("/:id/privacy-schedules/:scheduleId", middleware.RequireRole("admin"), h.privacy.DeletePrivacySchedule)
+			cameras.GET("/:id/counting-rules", h.counting.ListCountingRules)
+			cameras.POST("/:id/counting-rules", h.counting.CreateCountingRule)
+			cameras.PUT("/:id/counting-rules/:ruleId", h.counting.UpdateCountingRule)
+			cameras.DELETE("/:id/counting-rules/:ruleId", h.counting.DeleteCountingRule)
+			cameras.GET("/:id/tamper", h.tamper.GetTamperStatus)
+			cameras.POST("/:id/tamper/baseline", h.tamper.ResetTamperBaseline)
+			cameras.GET("/:id/tamper/compare", streamACL, private, h.tamper.CompareView) // Expected vs current view
+			cameras.GET("/:id/quality", h.quality.GetQuality)                            // Sharpness, exposure and noise samples
+			cameras.POST("/:id/quality/check", h.quality.CheckQuality)
+			cameras.POST("/:id/quality/reset", h.quality.ResetQuality)
 		}
-	}
 
-	return router
+		// Event routes (cursor paginated)
+		protected.GET("/events", h.event.ListEvents)
+		protected.GET("/events/stream", h.event.StreamEvents)     // Live push, SSE or WebSocket
+		protected.GET("/events/:id/media", h.event.GetEventMedia) // Recording offset and playback URL, for alert deep links
+
+		// Alerts raised by the camera alert rules
+		protected.GET("/alerts", h.alert.ListAlerts)
+		protected.POST("/alerts/:id/acknowledge", h.alert.AcknowledgeAlert)
+		protected.POST("/alerts/:id/resolve", h.alert.ResolveAlert)
+
+		// Intercoms: visitor calls, talking back and opening the door
+		intercoms := protected.Group("/intercoms")
+		{
+			intercoms.GET("", h.intercom.ListIntercoms)                                                  // With their ringing or answered call
+			intercoms.GET("/calls", h.intercom.ListIntercomCalls)                                        // Call history, cursor paginated
+			intercoms.POST("/calls/:id/answer", h.intercom.AnswerIntercomCall)                           // Only one operator gets a ringing call
+			intercoms.POST("/calls/:id/hangup", h.intercom.HangupIntercomCall)                           // Also ends the talk session
+			intercoms.POST("/:id/ring", operator, cameraArea, h.intercom.RingIntercom)                   // Button press reported by a bridge
+			intercoms.POST("/:id/door/release", operator, streamACL, cameraArea, h.intercom.ReleaseDoor) // ONVIF relay output
+			intercoms.POST("/:id/talk", operator, streamACL, cameraArea, h.intercom.CreateTalkSession)   // Operator microphone: SDP offer in, answer out
+			intercoms.DELETE("/:id/talk/:session", streamACL, h.intercom.DeleteTalkSession)              // Ends a talk session
+		}
+
+		// Weather per site, the context of events and analytics
+		protected.GET("/weather", h.weather.GetCurrentWeather)
+		protected.GET("/weather/observations", h.weather.ListWeatherObservations)
+
+		// Guard patrol check-ins, bookmarking nearby cameras
+		patrols := protected.Group("/patrols")
+		{
+			patrols.POST("/check-ins", idempotent, h.patrol.CreateCheckIn) // Phones retry on flaky networks
+			patrols.GET("/check-ins", h.patrol.ListCheckIns)
+			patrols.GET("/check-ins/:id", h.patrol.GetCheckIn)
+		}
+
+		// Visitor check-ins, linked to a lobby camera snapshot and footage (not viewers)
+		visitors := protected.Group("/visitors", operator)
+		{
+			visitors.POST("/check-ins", streamACL, idempotent, h.visitor.CreateVisitorCheckIn)
+			visitors.GET("/check-ins", h.visitor.ListVisitorCheckIns)
+			visitors.GET("/check-ins/:id", h.visitor.GetVisitorCheckIn)
+			visitors.GET("/check-ins/:id/snapshot", h.visitor.ServeVisitorSnapshot)
+			visitors.POST("/check-ins/:id/check-out", h.visitor.CheckOutVisitor)
+		}
+
+		// Outgoing webhooks: camera events POSTed to URLs, with a delivery log (admin only)
+		webhooks := protected.Group("/webhooks")
+		webhooks.Use(middleware.RequireRole("admin"))
+		{
+			webhooks.GET("", h.webhook.ListWebhooks)
+			webhooks.POST("", h.webhook.CreateWebhook)
+			webhooks.PUT("/:id", h.webhook.UpdateWebhook)
+			webhooks.DELETE("/:id", h.webhook.DeleteWebhook)
+			webhooks.POST("/:id/rotate-secret", h.webhook.RotateWebhookSecret)
+			webhooks.GET("/:id/deliveries", h.webhook.ListWebhookDeliveries)
+			webhooks.POST("/:id/deliveries/:deliveryId/redeliver", h.webhook.RedeliverWebhookDelivery)
+		}
+
+		// Webhook integrations and their payload mappings (admin only)
+		integrations := protected.Group("/integrations", middleware.RequireRole("admin"))
+		{
+			integrations.GET("", h.integration.ListIntegrations)
+			integrations.POST("", h.integration.CreateIntegration)
+			integrations.PUT("/:id", h.integration.UpdateIntegration)
+			integrations.DELETE("/:id", h.integration.DeleteIntegration)
+			integrations.POST("/:id/rotate-secret", h.integration.RotateIntegrationSecret)
+			integrations.POST("/:id/test", h.integration.TestIntegration)
+			integrations.POST("/:id/mappings", h.integration.CreateIntegrationMapping)
+			integrations.PUT("/:id/mappings/:mappingId", h.integration.UpdateIntegrationMapping)
+			integrations.DELETE("/:id/mappings/:mappingId", h.integration.DeleteIntegrationMapping)
+		}
+
+		// People counting reports from camera analytics
+		protected.POST("/counting/reports", operator, h.counting.IngestCounts)
+
+		// Recording routes (cursor paginated)
+		protected.GET("/recordings", h.recording.ListRecordings)
+
+		// Legal holds on recordings (admin only, audited)
+		legalHolds := protected.Group("/legal-holds", middleware.RequireRole("admin"))
+		{
+			legalHolds.GET("", h.legalHold.ListLegalHolds)
+			legalHolds.POST("", h.legalHold.CreateLegalHold)
+			legalHolds.POST("/:id/release", h.legalHold.ReleaseLegalHold)
+		}
+
+		// Audit log routes (admin only, cursor paginated)
+		protected.GET("/audit-logs", middleware.RequireRole("admin"), h.audit.ListAuditLogs)
+		protected.GET("/privacy-blackouts", middleware.RequireRole("admin"), h.privacy.ListPrivacyBlackouts) // Windows cameras spent in privacy mode
+
+		// Branding and frontend defaults
+		protected.GET("/settings", h.settings.GetSettings)
+		protected.PUT("/settings", middleware.RequireRole("admin"), h.settings.UpdateSettings)
+
+		// Stream view log: who watched which camera and when (admin only, cursor paginated)
+		protected.GET("/stream-views", middleware.RequireRole("admin"), h.streamView.ListStreamViews)
+
+		// Playback errors reported by the frontend, listed and summarized per camera for admins
+		protected.POST("/client-logs", h.clientLog.ReportClientLog)
+		protected.GET("/client-logs", middleware.RequireRole("admin"), h.clientLog.ListClientLogs)
+		protected.GET("/client-logs/summary", middleware.RequireRole("admin"), h.clientLog.GetClientLogSummary)
+
+		// Incident routes
+		incidents := protected.Group("/incidents")
+		{
+			incidents.GET("", h.incident.ListIncidents)
+			incidents.GET("/:id", h.incident.GetIncident)
+			incidents.POST("", h.incident.CreateIncident)
+			incidents.PUT("/:id", h.incident.UpdateIncident)
+		}
+
+		// Operator dashboard scoped to the user's assigned areas
+		protected.GET("/my/dashboard", h.dashboard.GetMyDashboard)
+		protected.GET("/my/notification-preferences", h.notify.GetMyNotificationPreference)
+		protected.PUT("/my/notification-preferences", h.notify.UpdateMyNotificationPreference) // Severity routing and quiet hours
+		protected.GET("/my/notifications", h.notify.ListMyNotifications)
+
+		// Video wall routes
+		walls := protected.Group("/walls")
+		{
+			walls.GET("", h.wall.ListWalls)
+			walls.POST("", h.wall.CreateWall)
+			walls.GET("/:id", h.wall.GetWall)
+			walls.DELETE("/:id", h.wall.DeleteWall)
+			walls.PUT("/:id/layout", h.wall.SetWallLayout)   // Manual switch until the next shift
+			walls.GET("/:id/ws", h.wall.HandleWallWebSocket) // Layout pushes for wall clients
+			walls.GET("/:id/shifts", h.wall.ListWallShifts)
+			walls.POST("/:id/shifts", h.wall.CreateWallShift)
+			walls.PUT("/:id/shifts/:shiftId", h.wall.UpdateWallShift)
+			walls.DELETE("/:id/shifts/:shiftId", h.wall.DeleteWallShift)
+		}
+		protected.GET("/wall-layouts", h.wall.ListWallLayouts) // Shared and the user's own, ?mine=true
+		protected.POST("/wall-layouts", h.wall.CreateWallLayout)
+		protected.GET("/wall-layouts/:id", h.wall.GetWallLayout)
+		protected.PUT("/wall-layouts/:id", h.wall.UpdateWallLayout) // Pushed to walls showing it
+		protected.DELETE("/wall-layouts/:id", h.wall.DeleteWallLayout)
+
+		// Named camera groups (Lobby, Perimeter, ...), shared or personal
+		groups := protected.Group("/camera-groups")
+		{
+			groups.GET("", h.group.ListCameraGroups)
+			groups.POST("", h.group.CreateCameraGroup)
+			groups.GET("/:id", h.group.GetCameraGroup) // With its cameras
+			groups.PUT("/:id", h.group.UpdateCameraGroup)
+			groups.DELETE("/:id", h.group.DeleteCameraGroup)
+		}
+
+		// Synchronized playback of several cameras' recordings
+		playback := protected.Group("/playback/sessions")
+		{
+			playback.POST("", h.playback.CreatePlaybackSession)
+			playback.GET("/:id", h.playback.GetPlaybackSession)
+			playback.POST("/:id/control", h.playback.ControlPlaybackSession) // play, pause, seek, rate, cameras
+			playback.DELETE("/:id", h.playback.DeletePlaybackSession)
+			playback.GET("/:id/ws", h.playback.HandlePlaybackWebSocket) // State pushes for every client
+		}
+
+		// Video exports rendered in the background
+		exports := protected.Group("/exports")
+		{
+			exports.GET("", h.export.ListExports)
+			exports.POST("/composite", idempotent, h.export.CreateCompositeExport) // 2x2 grid of up to 4 cameras, same time range
+			exports.POST("/speed", idempotent, h.export.CreateSpeedExport)         // One camera at 0.25x-16x, MP4 or HLS
+			exports.GET("/:id", h.export.GetExport)
+			exports.GET("/:id/download", h.export.DownloadExport)
+			exports.POST("/:id/download-link", h.export.CreateExportDownloadLink) // Pre-signed, resumable
+			exports.GET("/:id/hls/:file", h.export.ServeExportHLS)                // Playlist and segments of HLS exports
+		}
+
+		// Operator macros: defined by admins, run by anyone (one call or hotkey)
+		macros := protected.Group("/macros")
+		{
+			macros.GET("", h.macro.ListMacros)
+			macros.POST("", middleware.RequireRole("admin"), h.macro.CreateMacro)
+			macros.PUT("/:id", middleware.RequireRole("admin"), h.macro.UpdateMacro)
+			macros.DELETE("/:id", middleware.RequireRole("admin"), h.macro.DeleteMacro)
+			macros.POST("/:id/run", idempotent, h.macro.RunMacro) // All steps or none, per-step results
+		}
+
+		// Camera statuses (everyone reads them, admins manage them)
+		cameraStatuses := protected.Group("/camera-statuses")
+		{
+			cameraStatuses.GET("", h.statuses.ListCameraStatuses)
+			cameraStatuses.POST("", middleware.RequireRole("admin"), h.statuses.CreateCameraStatus)
+			cameraStatuses.PUT("/:key", middleware.RequireRole("admin"), h.statuses.UpdateCameraStatus)
+			cameraStatuses.DELETE("/:key", middleware.RequireRole("admin"), h.statuses.DeleteCameraStatus)
+		}
+
+		// Credential vault (admin only)
+		credentials := protected.Group("/credentials", middleware.RequireRole("admin"))
+		{
+			credentials.GET("", h.credential.ListCredentials)
+			credentials.POST("", h.credential.CreateCredential)
+			credentials.PUT("/:id", h.credential.UpdateCredential) // Username/password change rotates it for all cameras
+			credentials.DELETE("/:id", h.credential.DeleteCredential)
+		}
+
+		// MediaMTX path configuration snapshot for disaster recovery (admin only)
+		protected.GET("/admin/mediamtx/config", middleware.RequireRole("admin"), h.mediamtx.ExportMediaMTXConfig)
+		protected.POST("/admin/mediamtx/config", middleware.RequireRole("admin"), h.mediamtx.ImportMediaMTXConfig)
+
+		// Request latency histograms (admin only)
+		protected.GET("/admin/metrics", middleware.RequireRole("admin"), h.metrics.GetRequestMetrics)
+		protected.DELETE("/admin/metrics", middleware.RequireRole("admin"), h.metrics.ResetRequestMetrics)
+
+		// Backend instances and the elected leader (admin only)
+		protected.GET("/admin/cluster", middleware.RequireRole("admin"), h.cluster.GetCluster)
+
+		// Feature flags per site: what is on for clients, switches for admins
+		protected.GET("/feature-flags", h.features.GetFeatureFlags)
+		featureFlags := protected.Group("/admin/feature-flags", middleware.RequireRole("admin"))
+		{
+			featureFlags.GET("", h.features.ListFeatureFlags)
+			featureFlags.PUT("/:key", h.features.SetFeatureFlag)
+			featureFlags.PUT("/:key/sites/:site", h.features.SetSiteFeatureFlag)
+			featureFlags.DELETE("/:key/sites/:site", h.features.ClearSiteFeatureFlag)
+		}
+
+		// Failure injection (admin only, never in production)
+		if cfg.Server.Environment != "production" {
+			chaos := protected.Group("/admin/chaos", middleware.RequireRole("admin"))
+			{
+				chaos.GET("", h.chaos.GetChaosStatus)
+				chaos.POST("/cameras/:id/kill-ffmpeg", h.chaos.KillFFmpeg)
+				chaos.POST("/mediamtx", h.chaos.BlockMediaMTX)
+				chaos.POST("/rtsp-delay", h.chaos.DelayRTSP)
+				chaos.DELETE("", h.chaos.ResetChaos)
+			}
+		}
+
+		// Email digest: templates and manual sends (admin only), preview for anyone
+		digestTemplates := protected.Group("/digest-templates", middleware.RequireRole("admin"))
+		{
+			digestTemplates.GET("", h.digest.ListDigestTemplates)
+			digestTemplates.POST("", h.digest.CreateDigestTemplate)
+			digestTemplates.PUT("/:id", h.digest.UpdateDigestTemplate)
+			digestTemplates.DELETE("/:id", h.digest.DeleteDigestTemplate)
+		}
+		protected.GET("/digest/preview", h.digest.PreviewDigest)
+		protected.POST("/digest/send", middleware.RequireRole("admin"), h.digest.SendDigest)
+
+		// User management (admin only)
+		protected.PUT("/users/:id/areas", middleware.RequireRole("admin"), h.user.SetUserAreas)
+		protected.PUT("/users/:id/profile", middleware.RequireRole("admin"), h.user.UpdateUserProfile)
+		protected.POST("/users/:id/directory-sync", middleware.RequireRole("admin"), h.user.SyncUserFromDirectory)
+		protected.GET("/users/:id/avatar", operator, h.user.GetUserAvatar)
+		protected.GET("/users/presence", operator, h.user.ListOperatorPresence)
+		protected.POST("/users/:id/sessions/revoke", middleware.RequireRole("admin"), h.auth.RevokeUserSessions)
+
+		// Full-text search across cameras, events and incidents
+		protected.GET("/search", h.search.Search)
+
+		// Analytics routes (capacity planning)
+		analytics := protected.Group("/analytics")
+		{
+			analytics.GET("/areas", h.dashboard.GetAreaStats) // Live per-area numbers for the wall widgets
+			analytics.GET("/camera-usage", h.analytics.GetCameraUsage)
+			analytics.GET("/camera-usage/:id", h.analytics.GetCameraUsageHistory)
+			analytics.GET("/movement/export", idempotent, h.analytics.ExportMovement)
+			analytics.GET("/occupancy", h.counting.GetOccupancy)
+			analytics.GET("/privacy-zones", h.analytics.ListPrivacyZones)
+			analytics.POST("/privacy-zones", middleware.RequireRole("admin"), h.analytics.CreatePrivacyZone)
+			analytics.DELETE("/privacy-zones/:id", middleware.RequireRole("admin"), h.analytics.DeletePrivacyZone)
+		}
+	}
 }
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"command-center-vms-cctv/be/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoint classes with their own allow list
+const (
+	ACLClassAPI    = "api"
+	ACLClassStream = "stream"
+)
+
+// NetworkACL restricts which client networks may reach the API, the stream
+// endpoints and each role. The client address is gin's ClientIP, so the
+// router's trusted proxies must be set for it to mean anything behind one.
+type NetworkACL struct {
+	deny    []*net.IPNet
+	classes map[string][]*net.IPNet // Endpoint class -> allowed networks
+	roles   map[string][]*net.IPNet // Role -> allowed networks
+}
+
+func NewNetworkACL(cfg config.NetworkConfig) (*NetworkACL, error) {
+	acl := &NetworkACL{
+		classes: make(map[string][]*net.IPNet),
+		roles:   make(map[string][]*net.IPNet),
+	}
+	var err error
+	if acl.deny, err = parseNetworks(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("ACL_DENY: %w", err)
+	}
+	if acl.classes[ACLClassAPI], err = parseNetworks(cfg.APIAllow); err != nil {
+		return nil, fmt.Errorf("ACL_API_ALLOW: %w", err)
+	}
+	if acl.classes[ACLClassStream], err = parseNetworks(cfg.StreamAllow); err != nil {
+		return nil, fmt.Errorf("ACL_STREAM_ALLOW: %w", err)
+	}
+	for role, networks := range cfg.RoleAllow {
+		if acl.roles[role], err = parseNetworks(networks); err != nil {
+			return nil, fmt.Errorf("ACL_ROLE_ALLOW %s: %w", role, err)
+		}
+	}
+	return acl, nil
+}
+
+// Allow refuses denied clients and clients outside the class's allow list
+func (a *NetworkACL) Allow(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := net.ParseIP(c.ClientIP())
+		if containsIP(a.deny, ip) {
+			a.refuse(c, "denied network")
+			return
+		}
+		if allowed := a.classes[class]; len(allowed) > 0 && !containsIP(allowed, ip) {
+			a.refuse(c, class+" allow list")
+			return
+		}
+		c.Next()
+	}
+}
+
+// AllowRole refuses users connecting from outside their role's allow list.
+// Must be used after AuthMiddleware, which sets "role" in the context.
+func (a *NetworkACL) AllowRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if allowed := a.roles[role]; len(allowed) > 0 && !containsIP(allowed, net.ParseIP(c.ClientIP())) {
+			a.refuse(c, "role "+role+" allow list")
+			return
+		}
+		c.Next()
+	}
+}
+
+func (a *NetworkACL) refuse(c *gin.Context, rule string) {
+	log.Printf("[ACL] Refused %s %s from %s (%s)\n", c.Request.Method, c.Request.URL.Path, c.ClientIP(), rule)
+	c.JSON(http.StatusForbidden, gin.H{"error": "Access from this network is not allowed"})
+	c.Abort()
+}
+
+// parseNetworks parses CIDRs, treating a bare IP as a single-host network
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,11 +5,27 @@ import (
 	"net/http"
 	"strings"
 
+	"command-center-vms-cctv/be/services"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(secret string) gin.HandlerFunc {
+// AuthMiddleware accepts access tokens issued for a session that is still
+// active, so logging out or revoking a session cuts its tokens off at once.
+// Tokens signed with a JWT secret that was rotated out are still accepted.
+func AuthMiddleware(secrets *services.SecretStore, sessions *services.SessionService) gin.HandlerFunc {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		keys := jwt.VerificationKeySet{}
+		for _, secret := range secrets.Keys(services.SecretJWT) {
+			keys.Keys = append(keys.Keys, []byte(secret))
+		}
+		return keys, nil
+	}
+
 	return func(c *gin.Context) {
 		// Check if this is a WebSocket upgrade request
 		if c.GetHeader("Upgrade") == "websocket" {
@@ -27,44 +43,32 @@ func AuthMiddleware(secret string) gin.HandlerFunc {
 					}
 				}
 			}
-			
+
 			if token == "" {
 				// For WebSocket without token, abort but don't write response
 				// The WebSocket handler will handle the error
 				c.Abort()
 				return
 			}
-			
+
 			// Validate token
-			jwtToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.ErrSignatureInvalid
-				}
-				return []byte(secret), nil
-			})
-			
-			if err != nil || !jwtToken.Valid {
+			jwtToken, err := jwt.Parse(token, keyFunc)
+
+			if err != nil || !jwtToken.Valid || !setSessionClaims(c, jwtToken, sessions) {
 				// Invalid token, abort but don't write response
 				// The WebSocket handler will handle the error
 				c.Abort()
 				return
 			}
-			
-			// Token is valid, set user info
-			if claims, ok := jwtToken.Claims.(jwt.MapClaims); ok {
-				c.Set("user_id", uint(claims["user_id"].(float64)))
-				c.Set("email", claims["email"].(string))
-				c.Set("role", claims["role"].(string))
-			}
-			
+
 			c.Next()
 			return
 		}
-		
+
 		// Regular HTTP request - check Authorization header or query parameter
 		var tokenString string
 		authHeader := c.GetHeader("Authorization")
-		
+
 		if authHeader != "" {
 			// Extract token from "Bearer <token>"
 			parts := strings.Split(authHeader, " ")
@@ -72,7 +76,7 @@ func AuthMiddleware(secret string) gin.HandlerFunc {
 				tokenString = parts[1]
 			}
 		}
-		
+
 		// If no token in header, check query parameter (for MJPEG streaming with <img> tag)
 		if tokenString == "" {
 			tokenString = c.Query("token")
@@ -87,7 +91,7 @@ func AuthMiddleware(secret string) gin.HandlerFunc {
 				fmt.Printf("[Auth] Token found in query parameter (length: %d)\n", len(tokenString))
 			}
 		}
-		
+
 		if tokenString == "" {
 			// Debug: log what we received
 			fmt.Printf("[Auth] No token found. Header: %s, Query: %s\n", authHeader, c.Query("token"))
@@ -95,29 +99,46 @@ func AuthMiddleware(secret string) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		
+
 		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(secret), nil
-		})
-		
+		token, err := jwt.Parse(tokenString, keyFunc)
+
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
-		
+
 		// Extract claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", uint(claims["user_id"].(float64)))
-			c.Set("email", claims["email"].(string))
-			c.Set("role", claims["role"].(string))
+		if !setSessionClaims(c, token, sessions) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, sign in again"})
+			c.Abort()
+			return
 		}
 
 		c.Next()
 	}
 }
 
+// setSessionClaims copies the token's user onto the context, reporting
+// false when the token has no session or its session is no longer active.
+// Tokens from before sessions existed carry no session and are refused.
+func setSessionClaims(c *gin.Context, token *jwt.Token, sessions *services.SessionService) bool {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	sid, ok := claims["sid"].(float64)
+	if !ok || !sessions.Active(uint(sid)) {
+		return false
+	}
+	userID, _ := claims["user_id"].(float64)
+	email, _ := claims["email"].(string)
+	role, _ := claims["role"].(string)
+
+	c.Set("user_id", uint(userID))
+	c.Set("email", email)
+	c.Set("role", role)
+	c.Set("session_id", uint(sid))
+	return true
+}
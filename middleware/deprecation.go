@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecated marks every response of the routes it is applied to as
+// deprecated (RFC 8594 style headers) and links the same path under
+// successorPrefix. sunset ("YYYY-MM-DD", optional) announces the removal date.
+func Deprecated(prefix, successorPrefix, sunset string) gin.HandlerFunc {
+	var sunsetHeader string
+	if sunset != "" {
+		if date, err := time.Parse("2006-01-02", sunset); err == nil {
+			sunsetHeader = date.UTC().Format(http.TimeFormat)
+		} else {
+			fmt.Printf("[API] Invalid sunset date %q for %s, not announcing one\n", sunset, prefix)
+		}
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		if sunsetHeader != "" {
+			c.Header("Sunset", sunsetHeader)
+		}
+		successor := successorPrefix + strings.TrimPrefix(c.Request.URL.Path, prefix)
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		c.Next()
+	}
+}
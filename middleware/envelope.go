@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIError is the error object of the v2 envelope
+type APIError struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"` // Other fields of the v1 error body
+}
+
+// Envelope is the v2 response shape. Exactly one of Data and Error is set;
+// Meta carries pagination (next_cursor, has_more) for lists.
+type Envelope struct {
+	Data  interface{}            `json:"data,omitempty"`
+	Meta  map[string]interface{} `json:"meta,omitempty"`
+	Error *APIError              `json:"error,omitempty"`
+}
+
+// errorCodes maps HTTP status to the machine-readable error code
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "unprocessable",
+	http.StatusTooManyRequests:     "rate_limited",
+	http.StatusInternalServerError: "internal",
+	http.StatusBadGateway:          "bad_gateway",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusGatewayTimeout:      "timeout",
+}
+
+// jsonRewriter buffers JSON responses so they can be rewritten once the
+// handler is done. Anything else (MJPEG, audio, WebSocket upgrades) is
+// passed through untouched from its first write.
+type jsonRewriter struct {
+	gin.ResponseWriter
+	rewrite     func(status int, body []byte) []byte
+	status      int
+	buffer      bytes.Buffer
+	buffering   bool
+	passthrough bool
+}
+
+func (w *jsonRewriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+// WriteHeaderNow is deferred until the body shows whether to wrap it
+func (w *jsonRewriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *jsonRewriter) Write(data []byte) (int, error) {
+	if !w.buffering && !w.passthrough {
+		w.decide()
+	}
+	if w.buffering {
+		return w.buffer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *jsonRewriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *jsonRewriter) Flush() {
+	if !w.buffering && !w.passthrough {
+		w.decide()
+	}
+	if w.passthrough {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *jsonRewriter) Status() int {
+	if w.status != 0 && !w.passthrough {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *jsonRewriter) Written() bool {
+	return w.buffering || w.ResponseWriter.Written()
+}
+
+// decide picks buffering for JSON bodies and passthrough for the rest
+func (w *jsonRewriter) decide() {
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.buffering = true
+		return
+	}
+	w.passthrough = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// finish writes the status and the rewritten body to the real writer
+func (w *jsonRewriter) finish() {
+	if w.passthrough || (!w.buffering && w.ResponseWriter.Written()) {
+		return // Streamed or hijacked (WebSocket)
+	}
+	status := w.status
+	if status == 0 {
+		status = w.ResponseWriter.Status()
+	}
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(status)
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+
+	body := w.rewrite(status, w.buffer.Bytes())
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.Write(body)
+}
+
+// wrapBody turns a v1 response body into the envelope. v1 errors are
+// {"error": "message", ...}; v1 cursor pages are {items, next_cursor, has_more}.
+func wrapBody(status int, raw []byte) Envelope {
+	var body interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		body = string(raw)
+	}
+	object, isObject := body.(map[string]interface{})
+
+	if status >= 400 {
+		apiErr := &APIError{Code: errorCodes[status], Message: http.StatusText(status)}
+		if apiErr.Code == "" {
+			apiErr.Code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+		}
+		if isObject {
+			if message, ok := object["error"].(string); ok {
+				apiErr.Message = message
+				delete(object, "error")
+			}
+			if len(object) > 0 {
+				apiErr.Details = object
+			}
+		}
+		return Envelope{Error: apiErr}
+	}
+
+	if isObject {
+		if items, ok := object["items"]; ok {
+			if hasMore, ok := object["has_more"]; ok {
+				meta := map[string]interface{}{"has_more": hasMore}
+				if cursor, ok := object["next_cursor"]; ok {
+					meta["next_cursor"] = cursor
+				}
+				return Envelope{Data: items, Meta: meta}
+			}
+		}
+	}
+	return Envelope{Data: body}
+}
+
+// ResponseEnvelope wraps JSON responses of the routes it is applied to in
+// the v2 envelope, so v1 handlers can be served unchanged under /api/v2
+func ResponseEnvelope() gin.HandlerFunc {
+	return rewriteJSON(func(status int, raw []byte) []byte {
+		body, err := json.Marshal(wrapBody(status, raw))
+		if err != nil {
+			return raw
+		}
+		return body
+	})
+}
+
+// rewriteJSON applies rewrite to the JSON responses of the routes it is
+// applied to
+func rewriteJSON(rewrite func(status int, body []byte) []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		writer := &jsonRewriter{ResponseWriter: original, rewrite: rewrite}
+		c.Writer = writer
+
+		c.Next()
+
+		c.Writer = original
+		writer.finish()
+	}
+}
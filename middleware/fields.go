@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SelectFields trims list responses to the fields named in ?fields=, e.g.
+// ?fields=id,name,status,latitude,longitude for map pins. Applies to JSON
+// arrays and to the items of cursor pages; other responses and errors are
+// left alone. Unknown field names are ignored.
+func SelectFields() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.Query("fields")
+		if raw == "" || c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		fields := make(map[string]bool)
+		for _, field := range strings.Split(raw, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields[field] = true
+			}
+		}
+
+		rewriteJSON(func(status int, body []byte) []byte {
+			if status >= 400 {
+				return body
+			}
+			var decoded interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				return body
+			}
+
+			switch v := decoded.(type) {
+			case []interface{}:
+				selectFields(v, fields)
+			case map[string]interface{}:
+				items, ok := v["items"].([]interface{})
+				if !ok {
+					return body
+				}
+				selectFields(items, fields)
+			default:
+				return body
+			}
+
+			selected, err := json.Marshal(decoded)
+			if err != nil {
+				return body
+			}
+			return selected
+		})(c)
+	}
+}
+
+// selectFields drops every key not in fields from the objects of a list
+func selectFields(items []interface{}, fields map[string]bool) {
+	for _, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range object {
+			if !fields[key] {
+				delete(object, key)
+			}
+		}
+	}
+}
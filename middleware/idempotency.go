@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyHeader carries the client-chosen key of a retryable request
+const IdempotencyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
+// idempotencyRecorder copies the response into a buffer as it is written,
+// giving up on the copy (not the response) past the size limit so streams
+// and big exports still flow
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *idempotencyRecorder) record(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+// Idempotency makes a route safe to retry: a request with an Idempotency-Key
+// header runs once per user, route and key, and retries get the stored
+// response (marked Idempotent-Replayed: true). Reusing a key for a different
+// request is rejected with 422, a retry while the first attempt still runs
+// with 409. Server errors and responses over the size limit are not stored.
+// Requests without the header are not affected. Must be used after
+// AuthMiddleware.
+func Idempotency(store *services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		io.WriteString(hash, c.Request.URL.RequestURI()+"\n")
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		route := c.Request.Method + " " + c.FullPath()
+		record, existing, err := store.Begin(c.GetUint("user_id"), route, key, requestHash)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+		if existing {
+			switch {
+			case record.RequestHash != requestHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case record.Status == 0:
+				c.Header("Retry-After", "1")
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+			default:
+				for name, values := range services.StoredHeaders(record) {
+					for _, value := range values {
+						c.Writer.Header().Add(name, value)
+					}
+				}
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(record.Status, c.Writer.Header().Get("Content-Type"), record.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		before := c.Writer.Header().Clone()
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer, limit: store.MaxBody()}
+		c.Writer = recorder
+		// A panicking handler leaves no response to store; free the key so
+		// retries run again instead of getting 409 until it expires
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				c.Writer = recorder.ResponseWriter
+				store.Abandon(record)
+				panic(recovered)
+			}
+		}()
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError || recorder.overflow || c.IsWebsocket() {
+			store.Abandon(record)
+			return
+		}
+
+		// Only what the handler set is replayed, not CORS and friends
+		set := http.Header{}
+		for name, values := range c.Writer.Header() {
+			if previous, ok := before[name]; !ok || !equalValues(previous, values) {
+				set[name] = values
+			}
+		}
+		store.Complete(record, status, set, recorder.body.Bytes())
+	}
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
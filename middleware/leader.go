@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"command-center-vms-cctv/be/services"
+	"command-center-vms-cctv/be/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errLeaderUnreachable = errors.New("cluster leader unreachable")
+
+// Leader sends a request to the cluster leader when this node isn't it, for
+// routes served from what only the leader keeps in memory (health checks,
+// running recorders) or does (starting and stopping recorders). When no
+// leader is reporting in, or it can't be reached, the request is served
+// here. Outside cluster mode it does nothing.
+func Leader(cluster *services.ClusterService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cluster.IsLeader() || forwardedByPeer(cluster, c) {
+			c.Next()
+			return
+		}
+		leader, err := cluster.Leader()
+		if err != nil {
+			fmt.Printf("[Cluster] Failed to look up the leader: %v\n", err)
+			c.Next()
+			return
+		}
+		if leader == nil || leader.ID == cluster.NodeID() {
+			c.Next()
+			return
+		}
+		target, err := url.Parse(leader.AdvertiseURL)
+		if err != nil || target.Host == "" {
+			fmt.Printf("[Cluster] Leader %s has no usable CLUSTER_ADVERTISE_URL, serving %s here\n", leader.ID, c.Request.URL.Path)
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(io.LimitReader(c.Request.Body, maxForwardedBody))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		unreachable := false
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Printf("[Cluster] Leader %s is unreachable: %v\n", leader.ID, err)
+			unreachable = true
+		}
+		c.Request.Header.Set(ForwardedByHeader, cluster.SignForward(c.Request.Method, c.Request.URL.Path))
+		_, forward := tracing.StartClient(c.Request.Context(), "cluster.forward")
+		forward.SetAttribute("cluster.leader", leader.ID)
+		if forward != nil {
+			c.Request.Header.Set("traceparent", forward.Traceparent())
+		}
+		proxy.ServeHTTP(c.Writer, c.Request)
+		forward.SetAttribute("unreachable", unreachable)
+		if unreachable {
+			forward.RecordError(errLeaderUnreachable)
+		}
+		forward.End()
+
+		if !unreachable || c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		c.Request.Header.Del(ForwardedByHeader)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMetrics records the latency of every request per route pattern and
+// attaches the route to the request context, so slow queries handlers run
+// with it (requestDB) are logged with their handler.
+// Long-lived streams and WebSockets are recorded too; read their numbers as
+// session lengths.
+func RequestMetrics(metrics *services.RequestMetrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		c.Request = c.Request.WithContext(database.WithRequestInfo(c.Request.Context(), database.RequestInfo{
+			Method: c.Request.Method,
+			Route:  route,
+			Path:   c.Request.URL.Path,
+		}))
+
+		start := time.Now()
+		c.Next()
+		metrics.Observe(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"command-center-vms-cctv/be/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrivacyMode refuses live views of the camera in :id while a privacy
+// schedule blacks it out. It runs before StreamOwner so a blacked out
+// stream isn't forwarded, let alone started.
+func PrivacyMode(privacy *services.PrivacyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cameraID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Next()
+			return
+		}
+		if schedule, private := privacy.Active(uint(cameraID)); private {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":       "Camera is in privacy mode",
+				"reason":      "privacy_mode",
+				"schedule_id": schedule.ID,
+				"until":       schedule.ScheduleEnd, // HH:MM server time; empty when it lasts all day
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactionPolicy is what a restricted role may not see in any response
+type redactionPolicy struct {
+	remove map[string]bool // Fields dropped wherever they appear
+	round  map[string]int  // Numeric fields rounded to this many decimals
+}
+
+// redactionPolicies by role. Roles without a policy (admin, manager, user)
+// get full responses; viewers see cameras on the map, roughly placed
+// (3 decimals is about 100m), without their network or credential details.
+var redactionPolicies = map[string]redactionPolicy{
+	"viewer": {
+		remove: map[string]bool{"rtsp_url": true, "credential_id": true, "onvif_port": true, "talk_url": true},
+		round:  map[string]int{"latitude": 3, "longitude": 3},
+	},
+}
+
+// RedactFields strips sensitive fields from JSON responses for restricted
+// roles, at serialization time, so handlers return the same models to
+// everyone and no endpoint can forget to redact. Must be used after
+// AuthMiddleware, which sets "role" in the context.
+func RedactFields() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, restricted := redactionPolicies[c.GetString("role")]
+		if !restricted {
+			c.Next()
+			return
+		}
+
+		rewriteJSON(func(status int, raw []byte) []byte {
+			var body interface{}
+			if err := json.Unmarshal(raw, &body); err != nil {
+				return raw
+			}
+			redacted, err := json.Marshal(policy.apply(body))
+			if err != nil {
+				return raw
+			}
+			return redacted
+		})(c)
+	}
+}
+
+// apply redacts a decoded JSON value in place, at any depth
+func (p redactionPolicy) apply(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if p.remove[key] {
+				delete(v, key)
+				continue
+			}
+			if decimals, ok := p.round[key]; ok {
+				if number, ok := field.(float64); ok {
+					scale := math.Pow(10, float64(decimals))
+					v[key] = math.Round(number*scale) / scale
+					continue
+				}
+			}
+			v[key] = p.apply(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = p.apply(item)
+		}
+	}
+	return value
+}
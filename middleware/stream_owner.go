@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+
+	"command-center-vms-cctv/be/services"
+	"command-center-vms-cctv/be/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForwardedByHeader marks a stream request one node forwarded to another;
+// the receiving node serves it itself instead of forwarding it again. It is
+// signed (ClusterService.SignForward) and ignored when the signature doesn't
+// check out.
+const ForwardedByHeader = "X-VMS-Forwarded-By"
+
+// maxForwardedBody is how much of a request body is kept to serve the
+// request locally if the owner can't be reached (WHEP offers are a few KB)
+const maxForwardedBody = 1 << 20
+
+var errOwnerUnreachable = errors.New("stream owner unreachable")
+
+// StreamOwner sends a camera stream request to the cluster node running
+// the camera's pipeline, so only one node transcodes each camera. The
+// pipeline is claimed for this node when no live node owns it, and taken
+// over when the owner can't be reached. An empty pipeline is read from
+// ?protocol=, for the unified stream endpoint. Outside cluster mode it does
+// nothing.
+func StreamOwner(cluster *services.ClusterService, pipeline string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := pipeline
+		if name == "" {
+			name = c.Query("protocol")
+			if name != services.PipelineWebRTC && name != services.PipelineMJPEG {
+				c.Next()
+				return
+			}
+		}
+		cameraID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || forwardedByPeer(cluster, c) {
+			c.Next()
+			return
+		}
+
+		_, claim := tracing.StartClient(c.Request.Context(), "cluster.claim_stream")
+		owner, err := cluster.ClaimStream(uint(cameraID), name)
+		claim.SetAttribute("stream.pipeline", name)
+		if owner != nil {
+			claim.SetAttribute("cluster.owner", owner.ID)
+		}
+		claim.RecordError(err)
+		claim.End()
+		if err != nil {
+			// Serving it here beats failing the viewer
+			fmt.Printf("[Cluster] Failed to look up the owner of the %s stream of camera %d: %v\n", name, cameraID, err)
+			c.Next()
+			return
+		}
+		if owner == nil {
+			c.Next()
+			return
+		}
+		target, err := url.Parse(owner.AdvertiseURL)
+		if err != nil || target.Host == "" {
+			fmt.Printf("[Cluster] Node %s owns the %s stream of camera %d but has no usable CLUSTER_ADVERTISE_URL, serving it here\n", owner.ID, name, cameraID)
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, err = io.ReadAll(io.LimitReader(c.Request.Body, maxForwardedBody))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		unreachable := false
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.FlushInterval = -1 // MJPEG and audio frames go out as they come
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Printf("[Cluster] Node %s owning the %s stream of camera %d is unreachable: %v\n", owner.ID, name, cameraID, err)
+			unreachable = true
+		}
+		c.Request.Header.Set(ForwardedByHeader, cluster.SignForward(c.Request.Method, c.Request.URL.Path))
+		// The owner continues this trace, so the forwarded hop shows up in it
+		_, forward := tracing.StartClient(c.Request.Context(), "cluster.forward")
+		forward.SetAttribute("cluster.owner", owner.ID)
+		if forward != nil {
+			c.Request.Header.Set("traceparent", forward.Traceparent())
+		}
+		proxy.ServeHTTP(c.Writer, c.Request)
+		forward.SetAttribute("unreachable", unreachable)
+		if unreachable {
+			forward.RecordError(errOwnerUnreachable)
+		}
+		forward.End()
+
+		if !unreachable || c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		if _, err := cluster.TakeOverStream(uint(cameraID), name); err != nil {
+			fmt.Printf("[Cluster] Failed to take over the %s stream of camera %d: %v\n", name, cameraID, err)
+		}
+		c.Request.Header.Del(ForwardedByHeader)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+// forwardedByPeer reports whether another node of the cluster forwarded
+// the request
+func forwardedByPeer(cluster *services.ClusterService, c *gin.Context) bool {
+	value := c.GetHeader(ForwardedByHeader)
+	return value != "" && cluster.VerifyForward(value, c.Request.Method, c.Request.URL.Path)
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"command-center-vms-cctv/be/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TraceIDHeader carries the trace ID of a traced request, to look the
+// request up in Jaeger or Tempo
+const TraceIDHeader = "X-Trace-Id"
+
+// Tracing starts the span of every request, continuing the caller's trace
+// when it sends a traceparent header. Handlers pass c.Request.Context() on
+// to record their queries and service calls in the same trace. Does
+// nothing while tracing is off.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracing.StartServer(c.Request.Context(), c.Request.Method+" "+route, c.GetHeader("traceparent"))
+		if span == nil {
+			c.Next()
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(TraceIDHeader, span.TraceID())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.request.method", c.Request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("url.path", c.Request.URL.Path)
+		span.SetAttribute("client.address", c.ClientIP())
+		span.SetAttribute("http.response.status_code", status)
+		if id := c.Param("id"); id != "" && strings.Contains(route, "/cameras/:id") {
+			span.SetAttribute("camera.id", id)
+		}
+		if userID, exists := c.Get("user_id"); exists {
+			span.SetAttribute("user.id", fmt.Sprint(userID))
+		}
+		if status >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+		}
+		span.End()
+	}
+}
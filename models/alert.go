@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Alert statuses
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged" // An operator is on it
+	AlertResolved     = "resolved"
+)
+
+// Alert is raised when an event matches an enabled alert rule inside its
+// schedule and outside its cooldown. Operators acknowledge and resolve it;
+// the event itself stays untouched.
+type Alert struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	RuleID           uint       `json:"rule_id" gorm:"not null;index"`
+	EventID          uint       `json:"event_id" gorm:"not null;index"`
+	CameraID         uint       `json:"camera_id" gorm:"not null;index"`
+	EventType        string     `json:"event_type" gorm:"not null"`
+	Severity         string     `json:"severity" gorm:"not null"` // info, warning, critical
+	Description      string     `json:"description"`
+	Status           string     `json:"status" gorm:"not null;default:open;index"` // open, acknowledged, resolved
+	RaisedAt         time.Time  `json:"raised_at" gorm:"not null;index"`           // When the event occurred
+	AcknowledgedAt   *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedByID *uint      `json:"acknowledged_by_id,omitempty"`
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`
+	ResolvedByID     *uint      `json:"resolved_by_id,omitempty"`
+	Resolution       string     `json:"resolution,omitempty"` // Operator note when resolving
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
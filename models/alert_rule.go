@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Reasons an event was kept out of alerts (Event.Suppressed)
+const (
+	SuppressedSchedule = "schedule" // Outside the rule's alerting window
+	SuppressedCooldown = "cooldown" // Within the cooldown after the previous alert
+)
+
+// AlertRule turns events of one type on one camera into alerts, e.g. motion
+// only 22:00-06:00 and at most once per 5 minutes. Events are always stored;
+// the ones a rule holds back are marked suppressed, the others raise an
+// Alert. Events without an enabled rule raise no alert and are never
+// suppressed.
+type AlertRule struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	CameraID        uint      `json:"camera_id" gorm:"not null;uniqueIndex:idx_alert_rules_camera_type,priority:1"`
+	EventType       string    `json:"event_type" gorm:"not null;uniqueIndex:idx_alert_rules_camera_type,priority:2"` // motion, person, ...
+	ScheduleDays    string    `json:"schedule_days"`                                                                 // mon,tue,...; empty = every day
+	ScheduleStart   string    `json:"schedule_start"`                                                                // HH:MM server time; empty = all day
+	ScheduleEnd     string    `json:"schedule_end"`                                                                  // HH:MM; before start means overnight
+	CooldownSeconds int       `json:"cooldown_seconds" gorm:"not null;default:0"`                                    // Minimum gap between alerts; 0 = none
+	Severity        string    `json:"severity"`                                                                      // Of the alerts: info, warning, critical; empty = the event's
+	Enabled         bool      `json:"enabled" gorm:"not null"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ActiveAt reports whether t falls inside the rule's alerting window
+func (r *AlertRule) ActiveAt(t time.Time) bool {
+	return ScheduleActive(r.ScheduleDays, r.ScheduleStart, r.ScheduleEnd, t)
+}
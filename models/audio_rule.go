@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// AudioRule raises an audio_level event when a camera's audio stays above a
+// loudness threshold, e.g. glass break (very loud, short) or shouting
+// (loud, sustained). Rules only run inside their schedule window.
+type AudioRule struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	CameraID        uint      `json:"camera_id" gorm:"not null;index"`
+	Name            string    `json:"name" gorm:"not null"`                        // glass_break, shouting, ...
+	ThresholdDB     float64   `json:"threshold_db" gorm:"not null"`                // RMS level in dBFS, e.g. -20
+	MinDurationMS   int       `json:"min_duration_ms" gorm:"not null;default:500"` // How long the level must stay above threshold
+	CooldownSeconds int       `json:"cooldown_seconds" gorm:"not null;default:60"` // Minimum gap between events
+	Severity        string    `json:"severity" gorm:"not null;default:warning"`    // info, warning, critical
+	ScheduleDays    string    `json:"schedule_days"`                               // mon,tue,...; empty = every day
+	ScheduleStart   string    `json:"schedule_start"`                              // HH:MM server time; empty = all day
+	ScheduleEnd     string    `json:"schedule_end"`                                // HH:MM; before start means overnight
+	Enabled         bool      `json:"enabled" gorm:"not null"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ActiveAt reports whether t falls inside the rule's schedule
+func (r *AudioRule) ActiveAt(t time.Time) bool {
+	if !r.Enabled {
+		return false
+	}
+	return ScheduleActive(r.ScheduleDays, r.ScheduleStart, r.ScheduleEnd, t)
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditLog records who changed what, for compliance and troubleshooting
+type AuditLog struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       *uint     `json:"user_id,omitempty" gorm:"index"`
+	Action       string    `json:"action" gorm:"not null"`        // create, update, delete, ...
+	ResourceType string    `json:"resource_type" gorm:"not null"` // camera, recording, ...
+	ResourceID   string    `json:"resource_id"`
+	Details      string    `json:"details,omitempty"`
+	IPAddress    string    `json:"ip_address,omitempty"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
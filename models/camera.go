@@ -6,18 +6,64 @@ import (
 	"gorm.io/gorm"
 )
 
+// Camera priorities, used to decide which transcodes to preempt under load
+const (
+	CameraPriorityLow      = "low"
+	CameraPriorityNormal   = "normal"
+	CameraPriorityHigh     = "high"
+	CameraPriorityCritical = "critical"
+)
+
+// WebRTC codec preferences
+const (
+	WebRTCCodecAuto = "auto" // H.264 passthrough when the camera's profile is in WEBRTC_H264_PROFILES, VP8 otherwise
+	WebRTCCodecH264 = "h264" // H.264 passthrough whatever the profile, for viewers known to decode it
+	WebRTCCodecVP8  = "vp8"  // Always transcode to VP8
+)
+
+// Device types
+const (
+	DeviceTypeCamera   = "camera"
+	DeviceTypeIntercom = "intercom" // Video intercom / door station: calls, two-way audio and door release
+)
+
+var cameraPriorityRanks = map[string]int{
+	CameraPriorityLow:      0,
+	CameraPriorityNormal:   1,
+	CameraPriorityHigh:     2,
+	CameraPriorityCritical: 3,
+}
+
 type Camera struct {
-	ID              uint           `json:"id" gorm:"primaryKey"`
-	Name            string         `json:"name" gorm:"not null"`
-	Latitude        float64        `json:"latitude" gorm:"not null"`
-	Longitude       float64        `json:"longitude" gorm:"not null"`
-	RTSPUrl         string         `json:"rtsp_url" gorm:"not null"`
-	Status          string         `json:"status" gorm:"default:offline"` // online, offline
-	Area            string         `json:"area" gorm:"not null"`
-	Building        string         `json:"building" gorm:"not null"`
-	LastMotionDetected *time.Time  `json:"last_motion_detected,omitempty"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                 uint           `json:"id" gorm:"primaryKey"`
+	Name               string         `json:"name" gorm:"not null"`
+	Latitude           float64        `json:"latitude" gorm:"not null"`
+	Longitude          float64        `json:"longitude" gorm:"not null"`
+	RTSPUrl            string         `json:"rtsp_url" gorm:"not null"`
+	Status             string         `json:"status" gorm:"default:offline"` // online, offline or an admin-defined CameraStatusDefinition key
+	Area               string         `json:"area" gorm:"not null"`
+	Building           string         `json:"building" gorm:"not null"`
+	ONVIFPort          int            `json:"onvif_port" gorm:"default:80"`
+	Priority           string         `json:"priority" gorm:"not null;default:normal"` // low, normal, high, critical
+	TamperDetection    bool           `json:"tamper_detection" gorm:"not null;default:false"`
+	MotionDetection    bool           `json:"motion_detection" gorm:"not null;default:false"`
+	ONVIFMetadata      bool           `json:"onvif_metadata" gorm:"not null;default:false"`  // Ingest the camera's own detections (ONVIF Profile T metadata stream)
+	WebRTCCodec        string         `json:"webrtc_codec" gorm:"not null;default:auto"`     // auto, h264, vp8
+	DeviceType         string         `json:"device_type" gorm:"not null;default:camera"`    // camera, intercom
+	DoorRelay          string         `json:"door_relay,omitempty"`                          // Intercoms: ONVIF relay output token opening the door ("" = the first one)
+	TalkURL            string         `json:"talk_url,omitempty"`                            // Intercoms: HTTP endpoint taking G.711 µ-law audio for two-way audio
+	CredentialID       *uint          `json:"credential_id,omitempty" gorm:"index"`          // Shared credentials, replaces user:pass in RTSPUrl
+	Synthetic          bool           `json:"synthetic" gorm:"not null;default:false;index"` // Load test camera backed by an FFmpeg test source
+	LastMotionDetected *time.Time     `json:"last_motion_detected,omitempty"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// PriorityRank orders priorities for comparison; unknown values rank as normal
+func (c *Camera) PriorityRank() int {
+	if rank, ok := cameraPriorityRanks[c.Priority]; ok {
+		return rank
+	}
+	return cameraPriorityRanks[CameraPriorityNormal]
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CameraGroup is a named set of cameras, e.g. "Lobby" or "Perimeter", for
+// the command center to open together. Groups with an owner are that user's
+// own; the others are shared.
+type CameraGroup struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null"`
+	Description string         `json:"description"`
+	OwnerID     *uint          `json:"owner_id,omitempty" gorm:"index"`
+	CameraIDs   string         `json:"camera_ids"` // Comma-separated, in display order
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Cameras returns the group's camera IDs in display order
+func (g *CameraGroup) Cameras() []uint {
+	return splitIDs(g.CameraIDs)
+}
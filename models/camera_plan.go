@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// Camera plan statuses
+const (
+	CameraPlanPending = "pending"
+	CameraPlanApplied = "applied"
+	CameraPlanStale   = "stale" // Cameras changed after planning; plan again
+)
+
+// CameraPlan is a computed set of camera creates, updates and deletes that
+// brings the cameras to a desired list, kept so an admin can review it
+// before applying exactly that
+type CameraPlan struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	CreatedByID *uint      `json:"created_by_id,omitempty"`
+	Status      string     `json:"status" gorm:"not null;default:pending"`
+	Changes     string     `json:"-" gorm:"type:text;not null"` // JSON list of changes
+	Creates     int        `json:"creates"`
+	Updates     int        `json:"updates"`
+	Deletes     int        `json:"deletes"`
+	Unchanged   int        `json:"unchanged"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	AppliedByID *uint      `json:"applied_by_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
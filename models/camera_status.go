@@ -0,0 +1,36 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// CameraStatusDefinition is a value Camera.Status may take. online and
+// offline are built in; admins add lifecycle statuses such as
+// awaiting_install, rma or decommissioned. Health checks only move cameras
+// whose status is monitored, so a decommissioned camera stays that way.
+type CameraStatusDefinition struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Key         string    `json:"key" gorm:"uniqueIndex;not null"` // Stored in Camera.Status
+	Label       string    `json:"label" gorm:"not null"`
+	Color       string    `json:"color"` // Map pin and dashboard color, e.g. #16a34a
+	Description string    `json:"description"`
+	Monitored   bool      `json:"monitored" gorm:"not null;default:false"`
+	Transitions string    `json:"transitions"` // Comma-separated statuses it may be changed to by hand; empty allows any
+	SortOrder   int       `json:"sort_order" gorm:"not null;default:0"`
+	System      bool      `json:"system" gorm:"not null;default:false"` // Built in, cannot be deleted
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Next returns the statuses this one may be changed to, nil when any is
+// allowed
+func (d *CameraStatusDefinition) Next() []string {
+	var next []string
+	for _, key := range strings.Split(d.Transitions, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			next = append(next, key)
+		}
+	}
+	return next
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// Camera statuses
+const (
+	CameraStatusOnline  = "online"
+	CameraStatusOffline = "offline"
+)
+
+// Where a camera status change came from
+const (
+	StatusSourceHealthCheck = "health_check" // Periodic RTSP probe or MediaMTX path state
+	StatusSourceManual      = "manual"       // Set through the camera API
+)
+
+// CameraStatusEvent records a change of Camera.Status, whether the health
+// checks moved the camera between online and offline or a user set it
+type CameraStatusEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CameraID   uint      `json:"camera_id" gorm:"not null;index:idx_camera_status_events_camera_time,priority:1"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status" gorm:"not null"`
+	Source     string    `json:"source" gorm:"not null"`
+	Reason     string    `json:"reason,omitempty"` // StreamError reason when the health checks took it offline
+	ChangedAt  time.Time `json:"changed_at" gorm:"not null;index:idx_camera_status_events_camera_time,priority:2"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// CameraUsage is the FFmpeg CPU time and output bytes for one camera and
+// pipeline in one hour bucket, used for capacity planning
+type CameraUsage struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CameraID   uint      `json:"camera_id" gorm:"not null;uniqueIndex:idx_camera_usage_bucket"`
+	Hour       time.Time `json:"hour" gorm:"not null;uniqueIndex:idx_camera_usage_bucket;index"`
+	Pipeline   string    `json:"pipeline" gorm:"not null;uniqueIndex:idx_camera_usage_bucket"` // webrtc, mjpeg, audio, audio_monitor, hls_legacy
+	CPUSeconds float64   `json:"cpu_seconds" gorm:"not null;default:0"`
+	BytesOut   int64     `json:"bytes_out" gorm:"not null;default:0"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
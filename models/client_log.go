@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// ClientLog is a playback error reported by a frontend, e.g. an HLS stall or
+// a failed WebRTC ICE negotiation, kept to diagnose complaints from the field
+type ClientLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CameraID   *uint     `json:"camera_id,omitempty" gorm:"index"`
+	UserID     *uint     `json:"user_id,omitempty" gorm:"index"`
+	Email      string    `json:"email,omitempty"`
+	SessionID  string    `json:"session_id,omitempty" gorm:"index"` // Player session chosen by the client, groups reports of one viewing
+	Protocol   string    `json:"protocol,omitempty"`                // hls, webrtc, mjpeg, audio
+	Type       string    `json:"type" gorm:"not null;index"`        // e.g. hls_stall, ice_failed
+	Message    string    `json:"message,omitempty"`
+	Details    string    `json:"details,omitempty" gorm:"type:text"` // JSON sent by the client
+	UserAgent  string    `json:"user_agent,omitempty"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+	OccurredAt time.Time `json:"occurred_at" gorm:"not null;index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
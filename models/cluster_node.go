@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// ClusterNode is a backend instance in cluster mode. Each instance reports
+// in every CLUSTER_ELECTION_INTERVAL; the one holding the leader lock runs
+// recorders and background jobs.
+type ClusterNode struct {
+	ID           string    `json:"id" gorm:"primaryKey"` // CLUSTER_NODE_ID
+	Hostname     string    `json:"hostname"`
+	AdvertiseURL string    `json:"advertise_url"`
+	Leader       bool      `json:"leader"`
+	StartedAt    time.Time `json:"started_at"`
+	LastSeenAt   time.Time `json:"last_seen_at" gorm:"index"`
+}
+
+// StreamOwner is the node running a camera's stream pipeline (webrtc,
+// mjpeg) in cluster mode. Requests for the stream reaching another node are
+// forwarded to the owner. The owner renews the claim while the pipeline
+// runs; a claim not renewed for a few election intervals is taken over.
+type StreamOwner struct {
+	CameraID  uint      `json:"camera_id" gorm:"primaryKey;autoIncrement:false"`
+	Pipeline  string    `json:"pipeline" gorm:"primaryKey"`
+	NodeID    string    `json:"node_id" gorm:"not null;index"`
+	ClaimedAt time.Time `json:"claimed_at"`
+	RenewedAt time.Time `json:"renewed_at"`
+	StopAsked bool      `json:"stop_asked"` // Another node changed or deleted the camera; the owner stops the pipeline
+}
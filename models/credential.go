@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Credential is a username/password shared by cameras that reference it via
+// Camera.CredentialID, so rotating it updates every camera at once. The
+// password is encrypted at rest and never returned by the API.
+type Credential struct {
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	Name              string         `json:"name" gorm:"not null;uniqueIndex"`
+	Username          string         `json:"username" gorm:"not null"`
+	PasswordEncrypted string         `json:"-" gorm:"not null"` // AES-GCM, see utils.EncryptSecret
+	Notes             string         `json:"notes"`
+	RotatedAt         *time.Time     `json:"rotated_at,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// DigestTemplate renders the morning digest email. Subject and Body are Go
+// templates executed with services.DigestData; Body is html/template when
+// HTML is set and text/template otherwise. The active template is used,
+// falling back to a built-in one when none is active.
+type DigestTemplate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null;uniqueIndex"`
+	Subject   string    `json:"subject" gorm:"not null"`
+	Body      string    `json:"body" gorm:"type:text;not null"`
+	HTML      bool      `json:"html" gorm:"not null"`
+	Active    bool      `json:"active" gorm:"not null;index"` // At most one template is active
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Event is an append-only record of something that happened in the system
+// (motion, camera offline, tamper, ...). The table is range-partitioned by
+// occurred_at, see database/partitions.go.
+type Event struct {
+	ID                   uint      `json:"id" gorm:"primaryKey"`
+	CameraID             *uint     `json:"camera_id,omitempty" gorm:"index:idx_events_camera_time,priority:1"`
+	Type                 string    `json:"type" gorm:"not null;index:idx_events_type_time,priority:1"` // motion, offline, tamper, ...
+	Severity             string    `json:"severity" gorm:"not null;default:info"`                      // info, warning, critical
+	Source               string    `json:"source,omitempty"`
+	Description          string    `json:"description"`
+	Data                 string    `json:"data,omitempty"`       // Raw JSON payload from the producer
+	Suppressed           string    `json:"suppressed,omitempty"` // Why an alert rule held the event back: schedule, cooldown; empty = alerted
+	Weather              string    `json:"weather,omitempty"`    // Conditions at the camera's site: rain, fog, snow (comma-separated) or clear
+	WeatherObservationID *uint     `json:"weather_observation_id,omitempty"`
+	OccurredAt           time.Time `json:"occurred_at" gorm:"not null;index:idx_events_camera_time,priority:2;index:idx_events_type_time,priority:2;index:idx_events_occurred_at"`
+	CreatedAt            time.Time `json:"created_at"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export job statuses
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+// Export job kinds
+const (
+	ExportComposite = "composite" // 2x2 grid of up to four cameras
+	ExportSpeed     = "speed"     // One camera, played faster or slower
+	ExportClip      = "clip"      // One camera cut between two times, not re-encoded
+)
+
+// Export formats
+const (
+	ExportMP4 = "mp4"
+	ExportHLS = "hls" // FilePath is the playlist, next to its segments
+)
+
+// ExportJob renders recorded footage into a downloadable file in the
+// background, e.g. a composite of several cameras for an incident
+type ExportJob struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     *uint      `json:"user_id,omitempty" gorm:"index"`
+	Kind       string     `json:"kind" gorm:"not null"`       // composite, speed, clip
+	CameraIDs  string     `json:"camera_ids" gorm:"not null"` // Comma-separated, in tile order
+	From       time.Time  `json:"from" gorm:"not null"`
+	To         time.Time  `json:"to" gorm:"not null"`
+	Speed      float64    `json:"speed,omitempty"`                    // Playback rate of speed exports
+	Format     string     `json:"format" gorm:"not null;default:mp4"` // mp4, hls
+	Status     string     `json:"status" gorm:"not null;default:queued;index"`
+	Error      string     `json:"error,omitempty"`
+	FilePath   string     `json:"-"`
+	SizeBytes  int64      `json:"size_bytes"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // The file is deleted after this
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Cameras returns the job's camera IDs in tile order
+func (j *ExportJob) Cameras() []uint {
+	var ids []uint
+	for _, part := range strings.Split(j.CameraIDs, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64); err == nil && id > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// Features that can be switched per site
+const (
+	FeatureWebRTC    = "webrtc"
+	FeatureAnalytics = "analytics" // Motion, tamper and image quality detection
+	FeatureRecording = "recording"
+)
+
+// FeatureFlag switches a feature on or off. The row with an empty Site is
+// the deployment-wide setting; a row for a site (camera area) overrides it
+// there, so a feature can be rolled out one site at a time.
+type FeatureFlag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Key       string    `json:"key" gorm:"not null;uniqueIndex:idx_feature_flag_site"`
+	Site      string    `json:"site" gorm:"not null;default:'';uniqueIndex:idx_feature_flag_site"` // Camera area, "" for every site
+	Enabled   bool      `json:"enabled" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey stores the response to a request sent with an
+// Idempotency-Key header, so a retry of the same request gets the same
+// response instead of repeating the action. Keys are scoped per user and
+// route.
+type IdempotencyKey struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_scope,priority:1"`
+	Route       string    `json:"route" gorm:"not null;uniqueIndex:idx_idempotency_scope,priority:2"` // "POST /api/v1/cameras"
+	Key         string    `json:"key" gorm:"not null;uniqueIndex:idx_idempotency_scope,priority:3"`
+	RequestHash string    `json:"-" gorm:"not null"` // SHA-256 of path, query and body; a reused key must match
+	Status      int       `json:"status"`            // 0 while the first request is still running
+	Headers     string    `json:"-"`                 // JSON of the headers the handler set
+	Body        []byte    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"not null;index"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Incident is an operator-managed case, optionally tied to a camera
+type Incident struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	Title        string         `json:"title" gorm:"not null"`
+	Notes        string         `json:"notes"`
+	Severity     string         `json:"severity" gorm:"not null;default:info"`     // info, warning, critical
+	Status       string         `json:"status" gorm:"not null;default:open;index"` // open, resolved
+	CameraID     *uint          `json:"camera_id,omitempty" gorm:"index"`
+	Area         string         `json:"area"`
+	CreatedByID  *uint          `json:"created_by_id,omitempty"`
+	AssignedToID *uint          `json:"assigned_to_id,omitempty" gorm:"index"` // Operator handling it
+	ResolvedAt   *time.Time     `json:"resolved_at,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// Integration is a third-party system posting webhooks to /hooks/:name.
+// Requests are signed with an HMAC-SHA256 of their timestamp and body using
+// the integration's secret; its mappings turn payloads into events.
+type Integration struct {
+	ID              uint                 `json:"id" gorm:"primaryKey"`
+	Name            string               `json:"name" gorm:"not null;uniqueIndex"` // URL slug
+	SecretEncrypted string               `json:"-" gorm:"not null"`                // AES-GCM, see utils.EncryptSecret
+	SignatureHeader string               `json:"signature_header" gorm:"not null;default:X-Signature"`
+	Enabled         bool                 `json:"enabled" gorm:"not null"`
+	Notes           string               `json:"notes"`
+	LastReceivedAt  *time.Time           `json:"last_received_at,omitempty"`
+	Mappings        []IntegrationMapping `json:"mappings,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at"`
+}
+
+// IntegrationMapping turns matching webhook payloads into an event. Mappings
+// are tried by Position and the first match wins. Fields are dot paths into
+// the JSON payload, e.g. "alarm.zone" or "devices.0.id".
+type IntegrationMapping struct {
+	ID                  uint      `json:"id" gorm:"primaryKey"`
+	IntegrationID       uint      `json:"integration_id" gorm:"not null;index"`
+	Position            int       `json:"position" gorm:"not null;default:0"`
+	MatchField          string    `json:"match_field"`                                // Empty matches every payload
+	MatchValue          string    `json:"match_value"`                                // Empty matches any value of MatchField
+	EventType           string    `json:"event_type" gorm:"not null"`                 // Type of the event created
+	Severity            string    `json:"severity" gorm:"not null;default:info"`      // info, warning, critical
+	SeverityField       string    `json:"severity_field"`                             // Takes severity from the payload when it holds a valid one
+	CameraField         string    `json:"camera_field"`                               // Field referencing the camera, if any
+	CameraLookup        string    `json:"camera_lookup" gorm:"not null;default:name"` // How CameraField is matched: id or name
+	OccurredAtField     string    `json:"occurred_at_field"`                          // RFC3339 or unix seconds; empty = time received
+	DescriptionTemplate string    `json:"description_template"`                       // Go template over the payload, e.g. "Alarm in {{.alarm.zone}}"
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// Intercom call statuses
+const (
+	IntercomCallRinging  = "ringing"
+	IntercomCallAnswered = "answered"
+	IntercomCallMissed   = "missed" // Nobody answered within INTERCOM_RING_TIMEOUT
+	IntercomCallEnded    = "ended"
+)
+
+// IntercomCall is a call from a visitor at an intercom, from the button
+// press until it was missed or hung up
+type IntercomCall struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	CameraID       uint       `json:"camera_id" gorm:"not null;index:idx_intercom_calls_camera_time,priority:1"`
+	Status         string     `json:"status" gorm:"not null;index"`
+	Source         string     `json:"source"` // How the call came in: onvif_metadata, api
+	StartedAt      time.Time  `json:"started_at" gorm:"not null;index:idx_intercom_calls_camera_time,priority:2"`
+	AnsweredAt     *time.Time `json:"answered_at,omitempty"`
+	AnsweredBy     *uint      `json:"answered_by,omitempty"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	EndedBy        *uint      `json:"ended_by,omitempty"` // Empty when missed
+	DoorReleasedAt *time.Time `json:"door_released_at,omitempty"`
+	DoorReleasedBy *uint      `json:"door_released_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// LegalHold freezes a camera's recordings over a time range: recordings
+// overlapping an active hold can't be pruned or deleted until it is
+// released. Holds on specific recordings cover exactly their span.
+type LegalHold struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	CameraID      uint       `json:"camera_id" gorm:"not null;index"`
+	RecordingID   *uint      `json:"recording_id,omitempty"` // Set when the hold was placed on one recording
+	StartTime     time.Time  `json:"start_time" gorm:"not null"`
+	EndTime       time.Time  `json:"end_time" gorm:"not null"`
+	Reason        string     `json:"reason" gorm:"not null"`
+	CaseRef       string     `json:"case_ref"` // Case or request number the hold belongs to
+	CreatedByID   *uint      `json:"created_by_id,omitempty"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty" gorm:"index"` // nil while the hold is active
+	ReleasedByID  *uint      `json:"released_by_id,omitempty"`
+	ReleaseReason string     `json:"release_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
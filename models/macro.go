@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Macro step actions
+const (
+	MacroStartRecording = "start_recording"
+	MacroPTZPreset      = "ptz_preset"
+	MacroCreateIncident = "create_incident"
+)
+
+// Macro is a named sequence of operator actions run with one API call,
+// e.g. "Lobby lockdown": record the lobby cameras, turn the dome to the
+// entrance preset and open an incident. The UI binds Hotkey to it.
+type Macro struct {
+	ID          uint        `json:"id" gorm:"primaryKey"`
+	Name        string      `json:"name" gorm:"not null;uniqueIndex"`
+	Description string      `json:"description"`
+	Hotkey      string      `json:"hotkey,omitempty"` // e.g. "ctrl+shift+l"; unique when set
+	Steps       []MacroStep `json:"steps" gorm:"constraint:OnDelete:CASCADE"`
+	CreatedByID *uint       `json:"created_by_id,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// MacroStep is one action of a macro; steps run by Position. Which fields
+// apply depends on the action.
+type MacroStep struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	MacroID         uint      `json:"macro_id" gorm:"not null;index"`
+	Position        int       `json:"position" gorm:"not null;default:0"`
+	Action          string    `json:"action" gorm:"not null"` // start_recording, ptz_preset, create_incident
+	CameraIDs       string    `json:"camera_ids"`             // Comma-separated; create_incident uses the first
+	DurationSeconds int       `json:"duration_seconds"`       // start_recording; 0 = until stopped
+	Preset          string    `json:"preset"`                 // ptz_preset: ONVIF preset token
+	Title           string    `json:"title"`                  // create_incident
+	Severity        string    `json:"severity"`               // create_incident: info, warning, critical
+	Notes           string    `json:"notes"`                  // create_incident
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Cameras returns the step's camera IDs
+func (s *MacroStep) Cameras() []uint {
+	var ids []uint
+	for _, part := range strings.Split(s.CameraIDs, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64); err == nil && id > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// MediaMTXPath marks a camera as streaming: the backend configured its
+// MediaMTX path and hasn't removed it. Paths are re-registered from these
+// after a backend or MediaMTX restart, and cam<N> paths without one are
+// removed as orphans.
+type MediaMTXPath struct {
+	CameraID  uint      `json:"camera_id" gorm:"primaryKey;autoIncrement:false"`
+	PathName  string    `json:"path_name" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// MotionEvent is a burst of motion detected on a camera, with a snapshot of
+// the first changed frame. A "motion" Event is recorded alongside, so alert
+// rules and analytics see it like motion from any other source.
+type MotionEvent struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CameraID     uint      `json:"camera_id" gorm:"not null;index:idx_motion_events_camera_time,priority:1"`
+	DetectedAt   time.Time `json:"detected_at" gorm:"not null;index:idx_motion_events_camera_time,priority:2"`
+	Source       string    `json:"source" gorm:"not null"` // scene (FFmpeg scene change)
+	SnapshotPath string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Channels alerts can be routed to
+const (
+	ChannelSMS    = "sms"
+	ChannelEmail  = "email"
+	ChannelDigest = "digest" // Batched into one email every ALERT_DIGEST_INTERVAL
+	ChannelNone   = "none"
+)
+
+// Alert notification statuses
+const (
+	NotificationPending = "pending" // Digest entries waiting for the next digest
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// NotificationPreference is how a user wants to hear about alerts on the
+// cameras in their areas: a channel per severity, and quiet hours during
+// which only the severities in QuietBypass are sent right away while the
+// rest wait for the first digest after the quiet hours. Users without a
+// preference get no alert notifications.
+type NotificationPreference struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	UserID          uint      `json:"user_id" gorm:"uniqueIndex;not null"`
+	Enabled         bool      `json:"enabled" gorm:"not null"`
+	CriticalChannel string    `json:"critical_channel" gorm:"not null;default:sms"`
+	WarningChannel  string    `json:"warning_channel" gorm:"not null;default:email"`
+	InfoChannel     string    `json:"info_channel" gorm:"not null;default:digest"`
+	QuietDays       string    `json:"quiet_days"`                                    // mon,tue,...; empty = every day
+	QuietStart      string    `json:"quiet_start"`                                   // HH:MM server time; empty = no quiet hours
+	QuietEnd        string    `json:"quiet_end"`                                     // HH:MM; before start means overnight
+	QuietBypass     string    `json:"quiet_bypass" gorm:"not null;default:critical"` // Comma-separated severities not held during quiet hours
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Channel returns where alerts of a severity go
+func (p *NotificationPreference) Channel(severity string) string {
+	switch severity {
+	case "critical":
+		return p.CriticalChannel
+	case "warning":
+		return p.WarningChannel
+	default:
+		return p.InfoChannel
+	}
+}
+
+// Quiet reports whether t falls inside the quiet hours
+func (p *NotificationPreference) Quiet(t time.Time) bool {
+	return p.QuietStart != "" && ScheduleActive(p.QuietDays, p.QuietStart, p.QuietEnd, t)
+}
+
+// Bypasses reports whether alerts of a severity are sent during quiet hours
+func (p *NotificationPreference) Bypasses(severity string) bool {
+	for _, bypass := range strings.Split(p.QuietBypass, ",") {
+		if strings.TrimSpace(bypass) == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertNotification is one alert sent, or waiting to be sent, to a user
+type AlertNotification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index:idx_alert_notifications_user_status,priority:1"`
+	AlertID   uint       `json:"alert_id" gorm:"not null;index"`
+	Severity  string     `json:"severity" gorm:"not null"`
+	Channel   string     `json:"channel" gorm:"not null"`
+	Held      bool       `json:"held" gorm:"not null;default:false"` // Moved to the digest by quiet hours
+	Status    string     `json:"status" gorm:"not null;index:idx_alert_notifications_user_status,priority:2"`
+	Summary   string     `json:"summary"`
+	Error     string     `json:"error,omitempty"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// PatrolCheckIn is a guard's mobile check-in on patrol: where they were and
+// when. Cameras near the spot are bookmarked around that moment, linking the
+// physical patrol to video evidence.
+type PatrolCheckIn struct {
+	ID             uint             `json:"id" gorm:"primaryKey"`
+	UserID         uint             `json:"user_id" gorm:"not null;index:idx_patrol_check_ins_user_time,priority:1"`
+	Latitude       float64          `json:"latitude" gorm:"not null"`
+	Longitude      float64          `json:"longitude" gorm:"not null"`
+	AccuracyMeters float64          `json:"accuracy_meters"` // GPS accuracy reported by the device; 0 = unknown
+	Checkpoint     string           `json:"checkpoint"`      // Optional checkpoint label, e.g. "North gate"
+	Notes          string           `json:"notes"`
+	CheckedInAt    time.Time        `json:"checked_in_at" gorm:"not null;index;index:idx_patrol_check_ins_user_time,priority:2"`
+	Bookmarks      []PatrolBookmark `json:"bookmarks" gorm:"foreignKey:CheckInID;constraint:OnDelete:CASCADE"`
+	CreatedAt      time.Time        `json:"created_at"`
+}
+
+// PatrolBookmark marks the footage of a camera near a check-in
+type PatrolBookmark struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CheckInID      uint      `json:"check_in_id" gorm:"not null;index"`
+	CameraID       uint      `json:"camera_id" gorm:"not null;index"`
+	DistanceMeters float64   `json:"distance_meters"`
+	From           time.Time `json:"from" gorm:"not null"`
+	To             time.Time `json:"to" gorm:"not null"`
+	PlaybackURL    string    `json:"playback_url,omitempty" gorm:"-"` // Filled in by the API
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Counting rule kinds
+const (
+	CountingLine = "line" // Counts people crossing it, in one direction or the other
+	CountingZone = "zone" // Reports how many people are inside it
+)
+
+// CountingRule is a people counting line or zone drawn on a camera's view.
+// The camera's analytics do the counting and report per rule; the counts
+// add up to the occupancy of the rule's area.
+type CountingRule struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CameraID  uint      `json:"camera_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"not null"`
+	Kind      string    `json:"kind" gorm:"not null"`                   // line, zone
+	Points    string    `json:"points" gorm:"not null"`                 // "x,y;x,y;..." normalized 0-1; 2 points for a line, 3+ for a zone
+	Area      string    `json:"area" gorm:"not null;index"`             // Area the counts add to, defaults to the camera's
+	Inverted  bool      `json:"inverted" gorm:"not null;default:false"` // Swap entries and exits for a line drawn the other way
+	Enabled   bool      `json:"enabled" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Vertices parses Points, checking the count against Kind
+func (r *CountingRule) Vertices() ([][2]float64, error) {
+	var vertices [][2]float64
+	for _, pair := range strings.Split(r.Points, ";") {
+		coords := strings.Split(strings.TrimSpace(pair), ",")
+		if len(coords) != 2 {
+			return nil, fmt.Errorf("invalid point %q", pair)
+		}
+		var vertex [2]float64
+		for i, coord := range coords {
+			value, err := strconv.ParseFloat(strings.TrimSpace(coord), 64)
+			if err != nil || value < 0 || value > 1 {
+				return nil, fmt.Errorf("invalid point %q: coordinates are normalized 0-1", pair)
+			}
+			vertex[i] = value
+		}
+		vertices = append(vertices, vertex)
+	}
+
+	switch r.Kind {
+	case CountingLine:
+		if len(vertices) != 2 {
+			return nil, fmt.Errorf("a line needs exactly 2 points")
+		}
+	case CountingZone:
+		if len(vertices) < 3 {
+			return nil, fmt.Errorf("a zone needs at least 3 points")
+		}
+	default:
+		return nil, fmt.Errorf("kind must be line or zone")
+	}
+	return vertices, nil
+}
+
+// PeopleCount is one report of a counting rule: crossings since the
+// previous report for lines, the current headcount for zones
+type PeopleCount struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	RuleID     uint      `json:"rule_id" gorm:"not null;index"`
+	CameraID   uint      `json:"camera_id" gorm:"not null"`
+	Area       string    `json:"area" gorm:"not null;index:idx_people_counts_area_time,priority:1"`
+	Entries    int       `json:"entries" gorm:"not null;default:0"`
+	Exits      int       `json:"exits" gorm:"not null;default:0"`
+	Occupancy  *int      `json:"occupancy,omitempty"` // Zones only
+	OccurredAt time.Time `json:"occurred_at" gorm:"not null;index:idx_people_counts_area_time,priority:2"`
+	CreatedAt  time.Time `json:"created_at"`
+}
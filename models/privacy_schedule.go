@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// PrivacySchedule is a weekly window during which a camera is in privacy
+// mode, e.g. a prayer room during prayer times: no live view, snapshots or
+// recording. A camera may have several.
+type PrivacySchedule struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	CameraID      uint      `json:"camera_id" gorm:"not null;index"`
+	Name          string    `json:"name"`
+	Enabled       bool      `json:"enabled" gorm:"not null"`
+	ScheduleDays  string    `json:"schedule_days"`  // mon,tue,...; empty = every day
+	ScheduleStart string    `json:"schedule_start"` // HH:MM server time; empty = all day
+	ScheduleEnd   string    `json:"schedule_end"`   // HH:MM; before start means overnight
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ActiveAt reports whether the camera is in privacy mode at t
+func (s *PrivacySchedule) ActiveAt(t time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	return ScheduleActive(s.ScheduleDays, s.ScheduleStart, s.ScheduleEnd, t)
+}
+
+// PrivacyBlackout is a window a camera spent in privacy mode, so gaps in its
+// footage can be accounted for. EndedAt is nil while it lasts.
+type PrivacyBlackout struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	CameraID   uint       `json:"camera_id" gorm:"not null;index"`
+	ScheduleID uint       `json:"schedule_id" gorm:"not null;index"`
+	StartedAt  time.Time  `json:"started_at" gorm:"not null;index"`
+	EndedAt    *time.Time `json:"ended_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// PrivacyZone marks a camera, or every camera of an area, as covering a
+// privacy-sensitive place (restroom corridors, clinics, ...). Such cameras
+// are left out of analytics exports entirely.
+type PrivacyZone struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	CameraID  *uint     `json:"camera_id,omitempty" gorm:"index"` // One camera
+	Area      string    `json:"area,omitempty" gorm:"index"`      // Or every camera of an area
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Image quality issues, see services.QualityService
+const (
+	QualityBlurry   = "blurry"   // Less sharp than usual: dirty, fogged or defocused lens
+	QualityNoisy    = "noisy"    // Noisier than usual: failing sensor or IR
+	QualityExposure = "exposure" // Far more clipped pixels than usual: iris or sensor fault
+)
+
+// QualitySample is one image quality measurement of a camera, taken from a
+// small grayscale snapshot
+type QualitySample struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CameraID   uint      `json:"camera_id" gorm:"not null;index:idx_quality_samples_camera_time,priority:1"`
+	SampledAt  time.Time `json:"sampled_at" gorm:"not null;index:idx_quality_samples_camera_time,priority:2"`
+	Sharpness  float64   `json:"sharpness"`        // Variance of the Laplacian
+	Brightness float64   `json:"brightness"`       // Mean pixel value, 0-255
+	Clipped    float64   `json:"clipped"`          // Share of pixels crushed to black or blown to white, 0-1
+	Noise      float64   `json:"noise"`            // Estimated noise standard deviation
+	Score      *float64  `json:"score,omitempty"`  // 0-100 against the camera's baseline; nil without one
+	Issues     string    `json:"issues,omitempty"` // Issues seen in this sample (comma-separated), not yet confirmed
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// Recording is a single recorded segment of a camera stream on disk.
+// The table is range-partitioned by start_time, see database/partitions.go.
+type Recording struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CameraID  uint       `json:"camera_id" gorm:"not null;index:idx_recordings_camera_time,priority:1"`
+	StartTime time.Time  `json:"start_time" gorm:"not null;index:idx_recordings_camera_time,priority:2;index:idx_recordings_start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	FilePath  string     `json:"-" gorm:"not null"`
+	SizeBytes int64      `json:"size_bytes"`
+	Status    string     `json:"status" gorm:"not null;default:recording"` // recording, completed, failed, quarantined
+	Mode      string     `json:"mode,omitempty"`                           // continuous, on_demand; empty for external recorders
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RetainedClip is footage cut out of a recording before retention deleted
+// it, around events and patrol bookmarks worth keeping longer than the bulk
+// footage
+type RetainedClip struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CameraID    uint      `json:"camera_id" gorm:"not null;index:idx_retained_clips_camera_time,priority:1"`
+	StartTime   time.Time `json:"start_time" gorm:"not null;index:idx_retained_clips_camera_time,priority:2"`
+	EndTime     time.Time `json:"end_time" gorm:"not null"`
+	FilePath    string    `json:"-" gorm:"not null"`
+	SizeBytes   int64     `json:"size_bytes"`
+	EventIDs    string    `json:"event_ids"`    // Comma-separated events the clip was kept for
+	BookmarkIDs string    `json:"bookmark_ids"` // Comma-separated patrol bookmarks
+	ExpiresAt   time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Recording modes
+const (
+	RecordingContinuous = "continuous" // Follows the camera's RecordingSchedule
+	RecordingOnDemand   = "on_demand"  // Started from the API, until stopped or its duration ends
+)
+
+// RecordingSchedule is when a camera records continuously
+type RecordingSchedule struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	CameraID      uint      `json:"camera_id" gorm:"not null;uniqueIndex"`
+	Enabled       bool      `json:"enabled" gorm:"not null"`
+	ScheduleDays  string    `json:"schedule_days"`  // mon,tue,...; empty = every day
+	ScheduleStart string    `json:"schedule_start"` // HH:MM server time; empty = all day
+	ScheduleEnd   string    `json:"schedule_end"`   // HH:MM; before start means overnight
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ActiveAt reports whether the camera should be recording at t
+func (s *RecordingSchedule) ActiveAt(t time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	return ScheduleActive(s.ScheduleDays, s.ScheduleStart, s.ScheduleEnd, t)
+}
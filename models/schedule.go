@@ -0,0 +1,43 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ScheduleActive reports whether t falls inside a weekly schedule window:
+// days is a comma-separated list of mon,tue,... (empty = every day) and
+// start/end are HH:MM server time (empty = all day, end before start wraps
+// past midnight)
+func ScheduleActive(days, start, end string, t time.Time) bool {
+	if days != "" {
+		today := strings.ToLower(t.Weekday().String()[:3])
+		found := false
+		for _, day := range strings.Split(days, ",") {
+			if strings.TrimSpace(strings.ToLower(day)) == today {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if start == "" || end == "" {
+		return true
+	}
+	startClock, err1 := time.Parse("15:04", start)
+	endClock, err2 := time.Parse("15:04", end)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	startMinute := startClock.Hour()*60 + startClock.Minute()
+	endMinute := endClock.Hour()*60 + endClock.Minute()
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute
+	}
+	// Overnight window, e.g. 22:00-06:00
+	return minute >= startMinute || minute < endMinute
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a login. Its refresh token (stored hashed) trades in for new
+// short-lived access tokens, which carry the session ID so revoking the
+// session also cuts off access tokens already handed out.
+type Session struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	UserID            uint       `json:"user_id" gorm:"not null;index"`
+	RefreshTokenHash  string     `json:"-" gorm:"not null;uniqueIndex"` // SHA-256 of the current refresh token
+	PreviousTokenHash string     `json:"-" gorm:"index"`                // Replaced refresh token; presenting it again revokes the session
+	UserAgent         string     `json:"user_agent"`
+	ClientIP          string     `json:"client_ip"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"` // Last refresh
+	ExpiresAt         time.Time  `json:"expires_at" gorm:"not null;index"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty" gorm:"index"`
+}
+
+// Active reports whether the session can still be used
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
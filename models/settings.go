@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// SettingsID is the ID of the one Settings row
+const SettingsID = 1
+
+// Settings are the deployment's branding and the defaults of its frontend,
+// kept in one row so they can be changed without a frontend build
+type Settings struct {
+	ID          uint              `json:"-" gorm:"primaryKey"`
+	SiteName    string            `json:"site_name" gorm:"not null"`
+	LogoURL     string            `json:"logo_url"`     // Absolute http(s) URL or a path on the frontend's origin
+	LoginBanner string            `json:"login_banner"` // Shown on the login page, e.g. an authorized use notice
+	Map         MapView           `json:"map" gorm:"embedded;embeddedPrefix:map_"`
+	Retention   RetentionSettings `json:"-" gorm:"embedded;embeddedPrefix:retention_"`
+	UpdatedBy   *uint             `json:"updated_by"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// MapView is where the map opens. Without a center the frontend fits the
+// map to the cameras.
+type MapView struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Zoom      int      `json:"zoom" gorm:"not null"`
+}
+
+// RetentionSettings are how many days data is kept (0 = forever), each
+// overriding its environment variable (RECORDING_RETENTION, ...) when set
+type RetentionSettings struct {
+	RecordingDays       *int
+	ClipDays            *int
+	MotionDays          *int
+	QualityDays         *int
+	WebhookLogDays      *int
+	VisitorSnapshotDays *int
+}
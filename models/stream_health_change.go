@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// StreamHealthChange records a camera's stream going up or down, as seen by
+// the periodic health checks. Only transitions are stored, which keeps weeks
+// of history small and makes flap counting a COUNT(*).
+type StreamHealthChange struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CameraID  uint      `json:"camera_id" gorm:"not null;index:idx_health_changes_camera_time,priority:1"`
+	Healthy   bool      `json:"healthy" gorm:"not null"`
+	Reason    string    `json:"reason,omitempty"`                      // StreamError reason when unhealthy
+	Initial   bool      `json:"initial" gorm:"not null;default:false"` // First check of a camera, not a real transition
+	ChangedAt time.Time `json:"changed_at" gorm:"not null;index:idx_health_changes_camera_time,priority:2"`
+}
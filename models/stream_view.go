@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// StreamView is one viewing session of a camera stream, kept to answer
+// "who watched this camera and when"
+type StreamView struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CameraID  uint       `json:"camera_id" gorm:"not null;index"`
+	UserID    *uint      `json:"user_id,omitempty" gorm:"index"`
+	Email     string     `json:"email,omitempty"`          // Kept in case the user is deleted later
+	Protocol  string     `json:"protocol" gorm:"not null"` // hls, webrtc, mjpeg, audio
+	ClientIP  string     `json:"client_ip,omitempty"`
+	StartedAt time.Time  `json:"started_at" gorm:"not null;index"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"` // Nil while watching, or when the end is unknown (HLS, restart)
+	BytesSent int64      `json:"bytes_sent" gorm:"not null;default:0"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// TamperBaseline is the reference frame tamper detection compares against:
+// a small grayscale snapshot of the camera's normal view
+type TamperBaseline struct {
+	CameraID   uint      `json:"camera_id" gorm:"primaryKey;autoIncrement:false"`
+	Width      int       `json:"width" gorm:"not null"`
+	Height     int       `json:"height" gorm:"not null"`
+	Frame      []byte    `json:"-" gorm:"not null"` // 8-bit grayscale, row-major
+	Reference  []byte    `json:"-"`                 // Color JPEG of the same view, for showing it; none on older baselines
+	Brightness float64   `json:"brightness"`        // Mean pixel value, 0-255
+	Sharpness  float64   `json:"sharpness"`         // Mean gradient magnitude
+	CapturedAt time.Time `json:"captured_at"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,8 +14,43 @@ type User struct {
 	Name      string         `json:"name" gorm:"not null"`
 	Password  string         `json:"-" gorm:"not null"`
 	Role      string         `json:"role" gorm:"default:user"`
+
+	AssignedAreas string `json:"assigned_areas"` // Comma-separated camera areas the operator watches
+
+	Phone             string     `json:"phone"`
+	Department        string     `json:"department"`
+	AvatarURL         string     `json:"avatar_url"`                    // Set by hand; a synced Photo takes precedence
+	Photo             []byte     `json:"-" gorm:"type:bytea"`           // JPEG from the directory
+	DirectorySyncedAt *time.Time `json:"directory_synced_at,omitempty"` // Last time the directory had the user
+	OIDCSubject       *string    `json:"-" gorm:"uniqueIndex"`          // sub of the identity provider account signing in as the user
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// Avatar returns the URL of the user's picture: their synced photo, the
+// avatar_url set for them, or "" when they have neither
+func (u *User) Avatar() string {
+	return UserAvatar(u.ID, len(u.Photo) > 0, u.AvatarURL)
+}
+
+// UserAvatar is User.Avatar for queries that only check whether a photo
+// exists instead of loading it
+func UserAvatar(userID uint, hasPhoto bool, avatarURL string) string {
+	if hasPhoto {
+		return fmt.Sprintf("/api/v1/users/%d/avatar", userID)
+	}
+	return avatarURL
+}
+
+// Areas returns the assigned areas as a list, empty when none are assigned
+func (u *User) Areas() []string {
+	var areas []string
+	for _, area := range strings.Split(u.AssignedAreas, ",") {
+		if area = strings.TrimSpace(area); area != "" {
+			areas = append(areas, area)
+		}
+	}
+	return areas
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// VisitorSourceBuiltin is the Source of check-ins entered in the dashboard
+const VisitorSourceBuiltin = "builtin"
+
+// VisitorCheckIn is a visitor signing in at reception, linked to a snapshot
+// of the lobby camera taken at check-in. Check-ins from an external visitor
+// management system carry its name as Source and its record ID as
+// ExternalID, so re-sent records update the check-in instead of adding one.
+type VisitorCheckIn struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	VisitorName  string     `json:"visitor_name" gorm:"not null;index"`
+	Company      string     `json:"company"`
+	HostName     string     `json:"host_name"` // Who the visitor is meeting
+	BadgeNumber  string     `json:"badge_number"`
+	Source       string     `json:"source" gorm:"not null;default:builtin;uniqueIndex:idx_visitor_check_ins_external,priority:1"`
+	ExternalID   *string    `json:"external_id,omitempty" gorm:"uniqueIndex:idx_visitor_check_ins_external,priority:2"`
+	CameraID     *uint      `json:"camera_id" gorm:"index"` // Lobby camera; cleared when the camera is deleted
+	CheckedInAt  time.Time  `json:"checked_in_at" gorm:"not null;index"`
+	CheckedOutAt *time.Time `json:"checked_out_at,omitempty"`
+	SnapshotPath string     `json:"-"`                               // Empty when no snapshot could be taken
+	SnapshotURL  string     `json:"snapshot_url,omitempty" gorm:"-"` // Filled in by the API
+	PlaybackURL  string     `json:"playback_url,omitempty" gorm:"-"` // Filled in by the API
+	CreatedBy    *uint      `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
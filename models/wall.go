@@ -0,0 +1,77 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Wall is a video wall in the control room. Wall clients subscribe to
+// /walls/:id/ws and show whatever layout is active.
+type Wall struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	Name           string         `json:"name" gorm:"not null;uniqueIndex"`
+	ActiveLayoutID *uint          `json:"active_layout_id,omitempty"`
+	ActiveShiftID  *uint          `json:"active_shift_id,omitempty"` // Shift that set the active layout, nil when set manually
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// WallLayout is a saved grid of cameras. When it lists more cameras than it
+// has cells and TourSeconds is set, the wall pages through them as a tour.
+// Layouts with an owner are that user's own; the others are shared.
+type WallLayout struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null"`
+	OwnerID     *uint          `json:"owner_id,omitempty" gorm:"index"`
+	Rows        int            `json:"rows" gorm:"not null;default:2"`
+	Cols        int            `json:"cols" gorm:"not null;default:2"`
+	CameraIDs   string         `json:"camera_ids"`                    // Comma-separated, row-major
+	TourSeconds int            `json:"tour_seconds" gorm:"default:0"` // Dwell per page, 0 = no tour
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Cameras returns the layout's camera IDs in cell order
+func (l *WallLayout) Cameras() []uint {
+	return splitIDs(l.CameraIDs)
+}
+
+// splitIDs parses a comma-separated list of IDs, skipping invalid ones
+func splitIDs(list string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(list, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64); err == nil && id > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// WallShift activates a layout on a wall during a weekly window, e.g. the
+// night shift gets a perimeter tour. When shifts overlap the lowest ID wins;
+// outside every shift the wall keeps its current layout.
+type WallShift struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	WallID        uint      `json:"wall_id" gorm:"not null;index"`
+	Name          string    `json:"name" gorm:"not null"` // morning, night, ...
+	LayoutID      uint      `json:"layout_id" gorm:"not null"`
+	ScheduleDays  string    `json:"schedule_days"`  // mon,tue,...; empty = every day
+	ScheduleStart string    `json:"schedule_start"` // HH:MM server time
+	ScheduleEnd   string    `json:"schedule_end"`   // HH:MM; before start means overnight
+	Enabled       bool      `json:"enabled" gorm:"not null"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ActiveAt reports whether t falls inside the shift
+func (s *WallShift) ActiveAt(t time.Time) bool {
+	if !s.Enabled {
+		return false
+	}
+	return ScheduleActive(s.ScheduleDays, s.ScheduleStart, s.ScheduleEnd, t)
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// WeatherObservation is the weather at a site (camera area) at one time,
+// from the configured weather provider. Rain, fog and low light explain
+// most outdoor false motion and image-quality alerts, so events and
+// analytics carry it.
+type WeatherObservation struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	Area             string    `json:"area" gorm:"not null;index:idx_weather_area_time,priority:1"`
+	ObservedAt       time.Time `json:"observed_at" gorm:"not null;index:idx_weather_area_time,priority:2"`
+	Rain             bool      `json:"rain"` // Rain, drizzle, showers or thunderstorm
+	Fog              bool      `json:"fog"`  // Fog code or visibility under 1 km
+	Snow             bool      `json:"snow"`
+	PrecipitationMM  float64   `json:"precipitation_mm"`  // In the preceding interval
+	VisibilityMeters float64   `json:"visibility_meters"` // 0 = not reported
+	CloudCover       int       `json:"cloud_cover"`       // Percent
+	Lux              float64   `json:"lux"`               // Estimated from solar radiation; ~0 at night
+	IsDay            bool      `json:"is_day"`
+	WeatherCode      int       `json:"weather_code"` // WMO code
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Conditions summarizes the observation for events: rain, fog and snow
+// comma-separated, or clear
+func (w *WeatherObservation) Conditions() string {
+	var conditions []string
+	if w.Rain {
+		conditions = append(conditions, "rain")
+	}
+	if w.Fog {
+		conditions = append(conditions, "fog")
+	}
+	if w.Snow {
+		conditions = append(conditions, "snow")
+	}
+	if len(conditions) == 0 {
+		return "clear"
+	}
+	return strings.Join(conditions, ",")
+}
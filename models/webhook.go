@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultWebhookEventTypes are sent to webhooks that don't pick their own
+const DefaultWebhookEventTypes = "offline,motion,stream_restart"
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // Gave up after WEBHOOK_MAX_ATTEMPTS
+)
+
+// Webhook is a user's URL camera events are POSTed to. Bodies are signed
+// with an HMAC-SHA256 using the webhook's secret.
+type Webhook struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	UserID          uint      `json:"user_id" gorm:"not null;index"`
+	Name            string    `json:"name" gorm:"not null"`
+	URL             string    `json:"url" gorm:"not null"`
+	SecretEncrypted string    `json:"-" gorm:"not null"`                // AES-GCM, see utils.EncryptSecret
+	EventTypes      string    `json:"event_types" gorm:"not null"`      // Comma-separated, see DefaultWebhookEventTypes
+	CameraID        *uint     `json:"camera_id,omitempty" gorm:"index"` // Only this camera's events; nil = all cameras
+	Enabled         bool      `json:"enabled" gorm:"not null"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Wants reports whether the webhook subscribes to an event
+func (w *Webhook) Wants(event *Event) bool {
+	if event.CameraID == nil || (w.CameraID != nil && *w.CameraID != *event.CameraID) {
+		return false
+	}
+	for _, eventType := range strings.Split(w.EventTypes, ",") {
+		if strings.TrimSpace(eventType) == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent to one webhook, updated after every
+// attempt. Retries send the same Payload.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;index:idx_webhook_deliveries_webhook,priority:1"`
+	EventID        uint       `json:"event_id" gorm:"not null"`
+	EventType      string     `json:"event_type" gorm:"not null"`
+	CameraID       uint       `json:"camera_id" gorm:"not null;index"`
+	Payload        string     `json:"payload" gorm:"not null"`
+	Status         string     `json:"status" gorm:"not null;index"` // pending, delivered, failed
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	ResponseStatus int        `json:"response_status,omitempty"` // HTTP status of the last attempt
+	Error          string     `json:"error,omitempty"`           // Why the last attempt failed
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty" gorm:"index"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"index:idx_webhook_deliveries_webhook,priority:2"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	smsTimeout            = 10 * time.Second
+	notificationRetention = 30 * 24 * time.Hour
+)
+
+// AlertNotifier tells users about raised alerts on the cameras in their
+// areas, over the channel their NotificationPreference routes the alert's
+// severity to. During a user's quiet hours alerts whose severity doesn't
+// bypass them are held for the digest, which goes out every
+// ALERT_DIGEST_INTERVAL once the quiet hours are over.
+type AlertNotifier struct {
+	db         *gorm.DB
+	mailer     *Mailer
+	config     config.NotifyConfig
+	httpClient *http.Client
+}
+
+func NewAlertNotifier(cfg config.NotifyConfig, db *gorm.DB, mailer *Mailer) *AlertNotifier {
+	return &AlertNotifier{
+		db:         db,
+		mailer:     mailer,
+		config:     cfg,
+		httpClient: &http.Client{Timeout: smsTimeout},
+	}
+}
+
+// Start sends the digests every interval
+func (s *AlertNotifier) Start() {
+	if s.config.DigestInterval <= 0 {
+		return
+	}
+	if !s.mailer.Enabled() {
+		fmt.Printf("[Notify] SMTP is not configured, alert digests and emails will not be sent\n")
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.DigestInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if s.mailer.Enabled() {
+				s.sendDigests(time.Now())
+			}
+			s.prune()
+		}
+	}()
+}
+
+// Notify routes an alert to every user who watches its camera, without
+// holding up the caller
+func (s *AlertNotifier) Notify(alert *models.Alert) {
+	if s == nil || alert == nil {
+		return
+	}
+	go s.notify(*alert, time.Now())
+}
+
+func (s *AlertNotifier) notify(alert models.Alert, now time.Time) {
+	var preferences []models.NotificationPreference
+	if err := s.db.Where("enabled").Find(&preferences).Error; err != nil {
+		fmt.Printf("[Notify] Failed to load notification preferences: %v\n", err)
+		return
+	}
+	if len(preferences) == 0 {
+		return
+	}
+
+	var camera models.Camera
+	if err := s.db.Select("id", "name", "area").First(&camera, alert.CameraID).Error; err != nil {
+		fmt.Printf("[Notify] Failed to load camera %d of alert %d: %v\n", alert.CameraID, alert.ID, err)
+		return
+	}
+	userIDs := make([]uint, len(preferences))
+	for i, preference := range preferences {
+		userIDs[i] = preference.UserID
+	}
+	var users []models.User
+	if err := s.db.Select("id", "email", "name", "role", "assigned_areas", "phone").
+		Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		fmt.Printf("[Notify] Failed to load users: %v\n", err)
+		return
+	}
+	byID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	summary := fmt.Sprintf("[%s] %s on %s (%s)", strings.ToUpper(alert.Severity), alert.EventType, camera.Name, camera.Area)
+	if alert.Description != "" {
+		summary += ": " + alert.Description
+	}
+
+	for i := range preferences {
+		preference := &preferences[i]
+		user := byID[preference.UserID]
+		if user == nil || !watchesArea(user, camera.Area) {
+			continue
+		}
+		channel := preference.Channel(alert.Severity)
+		if channel == "" || channel == models.ChannelNone {
+			continue
+		}
+
+		notification := models.AlertNotification{
+			UserID:   user.ID,
+			AlertID:  alert.ID,
+			Severity: alert.Severity,
+			Channel:  channel,
+			Status:   models.NotificationPending,
+			Summary:  summary,
+		}
+		if channel != models.ChannelDigest && preference.Quiet(now) && !preference.Bypasses(alert.Severity) {
+			notification.Channel = models.ChannelDigest
+			notification.Held = true
+		}
+		if notification.Channel != models.ChannelDigest {
+			s.deliver(user, &notification, alert.RaisedAt)
+		}
+		if err := s.db.Create(&notification).Error; err != nil {
+			fmt.Printf("[Notify] Failed to record notification of alert %d for user %d: %v\n", alert.ID, user.ID, err)
+		}
+	}
+}
+
+// deliver sends a notification right away. SMS falls back to email for
+// users without a phone number or when no gateway is configured.
+func (s *AlertNotifier) deliver(user *models.User, notification *models.AlertNotification, raisedAt time.Time) {
+	var err error
+	if notification.Channel == models.ChannelSMS && (user.Phone == "" || s.config.SMSGatewayURL == "") {
+		notification.Channel = models.ChannelEmail
+	}
+	switch notification.Channel {
+	case models.ChannelSMS:
+		err = s.sendSMS(user.Phone, notification.Summary)
+	case models.ChannelEmail:
+		body := fmt.Sprintf("%s\n\nRaised at %s.\n", notification.Summary, raisedAt.Format("Mon Jan 2 15:04:05"))
+		err = s.mailer.Send([]string{user.Email}, notification.Summary, body, false)
+	default:
+		err = fmt.Errorf("unknown channel %q", notification.Channel)
+	}
+
+	if err != nil {
+		fmt.Printf("[Notify] Failed to send %s to user %d: %v\n", notification.Channel, user.ID, err)
+		notification.Status = models.NotificationFailed
+		notification.Error = err.Error()
+		return
+	}
+	now := time.Now()
+	notification.Status = models.NotificationSent
+	notification.SentAt = &now
+}
+
+func (s *AlertNotifier) sendSMS(phone, message string) error {
+	payload, err := json.Marshal(map[string]string{"to": phone, "message": message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.config.SMSGatewayURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.SMSGatewayToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.SMSGatewayToken)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("SMS gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sendDigests emails each user their pending digest entries, unless they
+// are in quiet hours. Failed emails are retried on the next round.
+func (s *AlertNotifier) sendDigests(now time.Time) {
+	var pending []models.AlertNotification
+	if err := s.db.Where("channel = ? AND status = ?", models.ChannelDigest, models.NotificationPending).
+		Order("created_at").Find(&pending).Error; err != nil {
+		fmt.Printf("[Notify] Failed to load digest entries: %v\n", err)
+		return
+	}
+	byUser := make(map[uint][]models.AlertNotification)
+	for _, notification := range pending {
+		byUser[notification.UserID] = append(byUser[notification.UserID], notification)
+	}
+
+	for userID, notifications := range byUser {
+		var preference models.NotificationPreference
+		if err := s.db.Where("user_id = ?", userID).First(&preference).Error; err == nil && preference.Quiet(now) {
+			continue
+		}
+		var user models.User
+		if err := s.db.Select("id", "email").First(&user, userID).Error; err != nil {
+			continue // Deleted users' entries are pruned with the rest
+		}
+
+		var body strings.Builder
+		ids := make([]uint, len(notifications))
+		for i, notification := range notifications {
+			ids[i] = notification.ID
+			fmt.Fprintf(&body, "%s  %s\n", notification.CreatedAt.Format("Jan 2 15:04"), notification.Summary)
+		}
+		subject := fmt.Sprintf("%d alerts since %s", len(notifications), notifications[0].CreatedAt.Format("Jan 2 15:04"))
+		if err := s.mailer.Send([]string{user.Email}, subject, body.String(), false); err != nil {
+			fmt.Printf("[Notify] Failed to send digest to user %d: %v\n", userID, err)
+			continue
+		}
+		if err := s.db.Model(&models.AlertNotification{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"status": models.NotificationSent, "sent_at": now}).Error; err != nil {
+			fmt.Printf("[Notify] Failed to mark digest of user %d sent: %v\n", userID, err)
+		}
+	}
+}
+
+// prune drops notifications older than notificationRetention
+func (s *AlertNotifier) prune() {
+	if err := s.db.Where("created_at < ?", time.Now().Add(-notificationRetention)).
+		Delete(&models.AlertNotification{}).Error; err != nil {
+		fmt.Printf("[Notify] Failed to prune notifications: %v\n", err)
+	}
+}
+
+// watchesArea reports whether a user is notified about cameras in an area:
+// those assigned to it, and admins without assigned areas
+func watchesArea(user *models.User, area string) bool {
+	areas := user.Areas()
+	if areas == nil {
+		return user.Role == "admin"
+	}
+	for _, assigned := range areas {
+		if assigned == area {
+			return true
+		}
+	}
+	return false
+}
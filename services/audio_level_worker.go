@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// PipelineAudioMonitor is the background FFmpeg measuring audio levels
+const PipelineAudioMonitor = "audio_monitor"
+
+const (
+	audioMonitorReconcileInterval = 30 * time.Second
+	audioMonitorSampleRate        = 8000
+	audioMonitorWindow            = 100 * time.Millisecond
+	audioSilenceDB                = -120.0
+)
+
+// AudioLevelWorker measures the RMS level of cameras that have audio rules
+// active right now, and records an audio_level event when a rule's threshold
+// is exceeded for long enough. Rules are reloaded periodically, so changes
+// made through the API take effect within audioMonitorReconcileInterval.
+type AudioLevelWorker struct {
+	db        *gorm.DB
+	events    *EventService
+	usage     *UsageTracker
+	scheduler *TranscodeScheduler
+	ingest    *IngestService
+	monitors  map[uint]*audioMonitor // camera_id -> running monitor
+	mu        sync.Mutex
+}
+
+// audioMonitor is one FFmpeg decoding a camera's audio to PCM
+type audioMonitor struct {
+	cameraID uint
+	rtspURL  string
+	cmd      *exec.Cmd
+	slot     *TranscodeSlot
+	rules    map[uint]*audioRuleState // rule_id -> state
+	mu       sync.Mutex
+}
+
+type audioRuleState struct {
+	rule       models.AudioRule
+	aboveSince time.Time // Zero while below threshold
+	lastFired  time.Time
+}
+
+func NewAudioLevelWorker(db *gorm.DB, events *EventService, usage *UsageTracker, scheduler *TranscodeScheduler, ingest *IngestService) *AudioLevelWorker {
+	return &AudioLevelWorker{
+		db:        db,
+		events:    events,
+		usage:     usage,
+		scheduler: scheduler,
+		ingest:    ingest,
+		monitors:  make(map[uint]*audioMonitor),
+	}
+}
+
+// Start runs the worker in the background
+func (w *AudioLevelWorker) Start() {
+	go func() {
+		ticker := time.NewTicker(audioMonitorReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			w.reconcile()
+			<-ticker.C
+		}
+	}()
+}
+
+// reconcile starts monitors for cameras with rules active now, updates the
+// rules of running monitors, and stops monitors nobody needs anymore
+func (w *AudioLevelWorker) reconcile() {
+	var rules []models.AudioRule
+	if err := w.db.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		fmt.Printf("[AudioMonitor] Failed to load audio rules: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	active := make(map[uint][]models.AudioRule)
+	for _, rule := range rules {
+		if rule.ActiveAt(now) {
+			active[rule.CameraID] = append(active[rule.CameraID], rule)
+		}
+	}
+
+	var cameras []models.Camera
+	if len(active) > 0 {
+		cameraIDs := make([]uint, 0, len(active))
+		for cameraID := range active {
+			cameraIDs = append(cameraIDs, cameraID)
+		}
+		if err := w.db.Where("id IN ?", cameraIDs).Find(&cameras).Error; err != nil {
+			fmt.Printf("[AudioMonitor] Failed to load cameras: %v\n", err)
+			return
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wanted := make(map[uint]bool)
+	for i := range cameras {
+		camera := &cameras[i]
+		wanted[camera.ID] = true
+
+		// A changed URL or rotated credential restarts the monitor
+		rtspURL := w.ingest.URL(camera)
+		monitor, running := w.monitors[camera.ID]
+		if running && monitor.rtspURL != rtspURL {
+			monitor.stop()
+			running = false
+		}
+		if !running {
+			started, err := w.startMonitor(camera, rtspURL)
+			if err != nil {
+				fmt.Printf("[AudioMonitor] Cannot monitor camera %d: %v\n", camera.ID, err)
+				continue
+			}
+			monitor = started
+			w.monitors[camera.ID] = monitor
+		}
+		monitor.setRules(active[camera.ID])
+	}
+
+	for cameraID, monitor := range w.monitors {
+		if !wanted[cameraID] {
+			monitor.stop()
+			delete(w.monitors, cameraID)
+		}
+	}
+}
+
+// startMonitor launches FFmpeg decoding the camera's audio to mono 16-bit PCM
+// (must be called with w.mu held)
+func (w *AudioLevelWorker) startMonitor(camera *models.Camera, rtspURL string) (*audioMonitor, error) {
+	monitor := &audioMonitor{
+		cameraID: camera.ID,
+		rtspURL:  rtspURL,
+		rules:    make(map[uint]*audioRuleState),
+	}
+
+	slot, err := w.scheduler.Acquire(camera.ID, PipelineAudioMonitor, camera.PriorityRank(), func() int { return 0 }, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.monitors[camera.ID] == monitor {
+			monitor.stop()
+			delete(w.monitors, camera.ID)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	monitor.slot = slot
+
+	cmd := FFmpegCommand(
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", rtspURL,
+		"-vn",
+		"-ac", "1",
+		"-ar", fmt.Sprint(audioMonitorSampleRate),
+		"-f", "s16le",
+		"-",
+	)
+	cmd.Stderr = newFFmpegErrorWriter(camera.ID, PipelineAudioMonitor)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		slot.Release()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		slot.Release()
+		return nil, err
+	}
+	monitor.cmd = cmd
+	w.usage.TrackProcess(camera.ID, PipelineAudioMonitor, cmd)
+
+	fmt.Printf("[AudioMonitor] Monitoring audio for camera %d (PID: %d)\n", camera.ID, cmd.Process.Pid)
+
+	go func() {
+		w.measure(monitor, stdout)
+		cmd.Wait()
+		slot.Release()
+
+		// Let the next reconcile restart it if it's still wanted
+		w.mu.Lock()
+		if w.monitors[camera.ID] == monitor {
+			delete(w.monitors, camera.ID)
+		}
+		w.mu.Unlock()
+	}()
+
+	return monitor, nil
+}
+
+// measure reads PCM in audioMonitorWindow chunks and evaluates the rules
+func (w *AudioLevelWorker) measure(monitor *audioMonitor, stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	samplesPerWindow := int(audioMonitorSampleRate * audioMonitorWindow / time.Second)
+	buf := make([]byte, samplesPerWindow*2)
+
+	for {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return
+		}
+		level := rmsDBFS(buf)
+		for _, event := range monitor.evaluate(level, time.Now()) {
+			w.events.Record(event.event, event.data)
+		}
+	}
+}
+
+// rmsDBFS returns the RMS level of little-endian 16-bit samples in dBFS
+func rmsDBFS(pcm []byte) float64 {
+	n := len(pcm) / 2
+	if n == 0 {
+		return audioSilenceDB
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / 32768
+		sum += sample * sample
+	}
+	rms := math.Sqrt(sum / float64(n))
+	if rms == 0 {
+		return audioSilenceDB
+	}
+	return 20 * math.Log10(rms)
+}
+
+type pendingAudioEvent struct {
+	event *models.Event
+	data  map[string]interface{}
+}
+
+func (m *audioMonitor) setRules(rules []models.AudioRule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := make(map[uint]*audioRuleState, len(rules))
+	for _, rule := range rules {
+		state, exists := m.rules[rule.ID]
+		if !exists {
+			state = &audioRuleState{}
+		}
+		state.rule = rule
+		next[rule.ID] = state
+	}
+	m.rules = next
+}
+
+// evaluate updates each rule with the latest level and returns events to record
+func (m *audioMonitor) evaluate(level float64, now time.Time) []pendingAudioEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var fired []pendingAudioEvent
+	for _, state := range m.rules {
+		rule := state.rule
+		if level < rule.ThresholdDB {
+			state.aboveSince = time.Time{}
+			continue
+		}
+		if state.aboveSince.IsZero() {
+			state.aboveSince = now
+		}
+
+		duration := now.Sub(state.aboveSince) + audioMonitorWindow
+		if duration < time.Duration(rule.MinDurationMS)*time.Millisecond {
+			continue
+		}
+		if !state.lastFired.IsZero() && now.Sub(state.lastFired) < time.Duration(rule.CooldownSeconds)*time.Second {
+			continue
+		}
+		state.lastFired = now
+
+		cameraID := m.cameraID
+		fired = append(fired, pendingAudioEvent{
+			event: &models.Event{
+				CameraID:    &cameraID,
+				Type:        "audio_level",
+				Severity:    rule.Severity,
+				Source:      "audio_monitor",
+				Description: fmt.Sprintf("Audio rule %q: level %.1f dBFS above %.1f dBFS for %dms", rule.Name, level, rule.ThresholdDB, duration.Milliseconds()),
+				OccurredAt:  now,
+			},
+			data: map[string]interface{}{
+				"rule_id":      rule.ID,
+				"rule_name":    rule.Name,
+				"level_db":     math.Round(level*10) / 10,
+				"threshold_db": rule.ThresholdDB,
+				"duration_ms":  duration.Milliseconds(),
+			},
+		})
+	}
+	return fired
+}
+
+// stop kills FFmpeg; the measuring goroutine then cleans up
+func (m *audioMonitor) stop() {
+	if m.cmd != nil && m.cmd.Process != nil {
+		fmt.Printf("[AudioMonitor] Stopping audio monitor for camera %d\n", m.cameraID)
+		m.cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// PipelineAudio is the audio-only HTTP stream (FFmpeg per listener)
+const PipelineAudio = "audio"
+
+// Audio formats served by AudioService
+const (
+	AudioFormatAAC  = "aac"  // ADTS, plays in every browser's <audio>
+	AudioFormatOpus = "opus" // Ogg/Opus, lower bitrate
+)
+
+// aacSourceCodecs are SDP names for AAC, which can be remuxed to ADTS as-is
+var aacSourceCodecs = []string{"MPEG4-GENERIC", "MP4A-LATM"}
+
+// AudioService streams a camera's microphone without touching the video
+type AudioService struct {
+	usage     *UsageTracker
+	scheduler *TranscodeScheduler
+	errors    map[uint]*ffmpegErrorWriter // camera_id -> stderr of the latest listener
+	mu        sync.RWMutex
+}
+
+func NewAudioService(usage *UsageTracker, scheduler *TranscodeScheduler) *AudioService {
+	return &AudioService{
+		usage:     usage,
+		scheduler: scheduler,
+		errors:    make(map[uint]*ffmpegErrorWriter),
+	}
+}
+
+// StopStreams ends every audio listener of a camera (they get EOF and
+// reconnect) and returns how many FFmpeg processes were stopped
+func (s *AudioService) StopStreams(cameraID uint) int {
+	return s.usage.KillProcesses(cameraID, PipelineAudio)
+}
+
+// AudioContentType returns the HTTP Content-Type for a format
+func AudioContentType(format string) string {
+	if format == AudioFormatOpus {
+		return "audio/ogg"
+	}
+	return "audio/aac"
+}
+
+// OpenStream starts FFmpeg for one listener and returns its output.
+// sourceCodecs are the camera's audio codecs from ProbeRTSP; AAC sources are
+// remuxed instead of re-encoded when AAC output is requested.
+func (s *AudioService) OpenStream(cameraID uint, rtspURL, format string, sourceCodecs []string, priority int) (io.ReadCloser, error) {
+	reader := &audioReader{cameraID: cameraID}
+	slot, err := s.scheduler.Acquire(cameraID, PipelineAudio, priority, func() int { return 1 }, func() {
+		reader.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	reader.slot = slot
+
+	args := []string{
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", rtspURL,
+		"-vn", // No video decode
+	}
+	switch {
+	case format == AudioFormatOpus:
+		args = append(args, "-c:a", "libopus", "-b:a", "32k", "-f", "ogg", "-")
+	case hasAnyCodec(sourceCodecs, aacSourceCodecs):
+		args = append(args, "-c:a", "copy", "-f", "adts", "-")
+	default:
+		// G.711 (PCMU/PCMA) and friends
+		args = append(args, "-c:a", "aac", "-b:a", "64k", "-f", "adts", "-")
+	}
+
+	stderr := newFFmpegErrorWriter(cameraID, PipelineAudio)
+	cmd := FFmpegCommand(args...)
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		slot.Release()
+		return nil, fmt.Errorf("error creating stdout pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		slot.Release()
+		return nil, fmt.Errorf("error starting FFmpeg: %v", err)
+	}
+
+	s.mu.Lock()
+	s.errors[cameraID] = stderr
+	s.mu.Unlock()
+
+	fmt.Printf("[Audio] Stream started for camera %d (%s), PID: %d\n", cameraID, format, cmd.Process.Pid)
+	s.usage.TrackProcess(cameraID, PipelineAudio, cmd)
+
+	reader.mu.Lock()
+	reader.reader = stdout
+	reader.counted = s.usage.CountingReader(cameraID, PipelineAudio, stdout)
+	reader.cmd = cmd
+	preempted := reader.closed
+	reader.mu.Unlock()
+	if preempted {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, ErrTranscodeCapacity
+	}
+	return reader, nil
+}
+
+// GetStreamError returns the last classified FFmpeg error for a camera's audio
+func (s *AudioService) GetStreamError(cameraID uint) *StreamError {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.errors[cameraID].LastError()
+}
+
+// audioReader wraps the FFmpeg stdout and stops FFmpeg on Close
+type audioReader struct {
+	cameraID uint
+	reader   io.ReadCloser
+	counted  io.Reader // reader with bytes added to camera usage
+	cmd      *exec.Cmd
+	slot     *TranscodeSlot
+	closed   bool
+	mu       sync.Mutex
+}
+
+func (r *audioReader) Read(p []byte) (int, error) {
+	return r.counted.Read(p)
+}
+
+// Close stops FFmpeg and frees the transcode slot. It is called by the
+// handler when the listener goes away and by the scheduler on preemption.
+func (r *audioReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.slot.Release()
+
+	if r.reader == nil {
+		// FFmpeg not attached yet; OpenStream sees closed and cleans up
+		return nil
+	}
+
+	if r.cmd != nil && r.cmd.Process != nil {
+		fmt.Printf("[Audio] Stopping FFmpeg for camera %d (PID: %d)\n", r.cameraID, r.cmd.Process.Pid)
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+	}
+	return r.reader.Close()
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// builtinCameraStatuses are created on first start; the health checks
+// depend on them
+var builtinCameraStatuses = []models.CameraStatusDefinition{
+	{Key: models.CameraStatusOnline, Label: "Online", Color: "#16a34a", Monitored: true, System: true, SortOrder: 0},
+	{Key: models.CameraStatusOffline, Label: "Offline", Color: "#dc2626", Monitored: true, System: true, SortOrder: 1},
+}
+
+// CameraStatusService keeps the camera status definitions in memory, as
+// health checks consult them for every camera
+type CameraStatusService struct {
+	db       *gorm.DB
+	statuses map[string]models.CameraStatusDefinition
+	mu       sync.RWMutex
+}
+
+func NewCameraStatusService(db *gorm.DB) *CameraStatusService {
+	return &CameraStatusService{
+		db:       db,
+		statuses: make(map[string]models.CameraStatusDefinition),
+	}
+}
+
+// Load creates the built-in statuses when missing and reads all definitions.
+// Call it again after changing them.
+func (s *CameraStatusService) Load() error {
+	for _, builtin := range builtinCameraStatuses {
+		status := builtin
+		if err := s.db.Where("key = ?", status.Key).FirstOrCreate(&status).Error; err != nil {
+			return fmt.Errorf("failed to create status %s: %w", status.Key, err)
+		}
+	}
+
+	var definitions []models.CameraStatusDefinition
+	if err := s.db.Find(&definitions).Error; err != nil {
+		return err
+	}
+	statuses := make(map[string]models.CameraStatusDefinition, len(definitions))
+	for _, definition := range definitions {
+		statuses[definition.Key] = definition
+	}
+
+	s.mu.Lock()
+	s.statuses = statuses
+	s.mu.Unlock()
+	return nil
+}
+
+// List returns every status in display order
+func (s *CameraStatusService) List() []models.CameraStatusDefinition {
+	s.mu.RLock()
+	list := make([]models.CameraStatusDefinition, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		list = append(list, status)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].SortOrder != list[j].SortOrder {
+			return list[i].SortOrder < list[j].SortOrder
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// Get returns a status definition
+func (s *CameraStatusService) Get(key string) (models.CameraStatusDefinition, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status, exists := s.statuses[key]
+	return status, exists
+}
+
+// Monitored reports whether health checks manage cameras in a status.
+// Statuses without a definition (set before they existed) count as
+// monitored, as all statuses were before.
+func (s *CameraStatusService) Monitored(key string) bool {
+	status, exists := s.Get(key)
+	return !exists || status.Monitored
+}
+
+// Unmonitored returns the statuses health checks leave alone
+func (s *CameraStatusService) Unmonitored() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for key, status := range s.statuses {
+		if !status.Monitored {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// CheckTransition returns why a camera cannot be changed from one status to
+// another by hand, nil when it can
+func (s *CameraStatusService) CheckTransition(from, to string) error {
+	if from == to {
+		return nil
+	}
+	if _, exists := s.Get(to); !exists {
+		return fmt.Errorf("unknown status %q", to)
+	}
+	current, exists := s.Get(from)
+	if !exists {
+		return nil
+	}
+	next := current.Next()
+	if next == nil {
+		return nil
+	}
+	for _, key := range next {
+		if key == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("status cannot change from %q to %q", from, to)
+}
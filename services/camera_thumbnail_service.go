@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// PipelineCameraThumbnail is the FFmpeg refreshing a camera's grid thumbnail
+const PipelineCameraThumbnail = "camera_thumbnail"
+
+const (
+	cameraThumbnailWorkers  = 4
+	cameraThumbnailPriority = -1 // Like exports, never preempts live streams
+)
+
+// CameraThumbnailService keeps a small, recent JPEG of every online camera
+// in a ThumbnailStore for grid views, refreshed every
+// CAMERA_THUMBNAIL_INTERVAL. Cameras the health checks see as down or in
+// privacy mode are skipped and keep their last thumbnail. Captures take
+// FFmpeg slots below every stream's priority, so when the cap is reached
+// thumbnails wait for the next round instead of live views.
+type CameraThumbnailService struct {
+	config    config.CameraThumbnailConfig
+	db        *gorm.DB
+	ingest    *IngestService
+	health    *HealthHistoryService
+	privacy   *PrivacyService
+	scheduler *TranscodeScheduler
+	store     ThumbnailStore
+}
+
+func NewCameraThumbnailService(cfg config.CameraThumbnailConfig, db *gorm.DB, ingest *IngestService, health *HealthHistoryService, privacy *PrivacyService, scheduler *TranscodeScheduler) *CameraThumbnailService {
+	return &CameraThumbnailService{
+		config:    cfg,
+		db:        db,
+		ingest:    ingest,
+		health:    health,
+		privacy:   privacy,
+		scheduler: scheduler,
+		store:     NewThumbnailStore(cfg),
+	}
+}
+
+// Start refreshes all thumbnails every interval
+func (s *CameraThumbnailService) Start() {
+	if s.config.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			s.refreshAll()
+			<-ticker.C
+		}
+	}()
+}
+
+// Interval is how often thumbnails are refreshed
+func (s *CameraThumbnailService) Interval() time.Duration {
+	return s.config.Interval
+}
+
+// Get returns a camera's stored thumbnail and when it was captured
+func (s *CameraThumbnailService) Get(cameraID uint) ([]byte, time.Time, error) {
+	return s.store.Get(cameraID)
+}
+
+func (s *CameraThumbnailService) refreshAll() {
+	var cameras []models.Camera
+	if err := s.db.Find(&cameras).Error; err != nil {
+		fmt.Printf("[CameraThumbnails] Failed to load cameras: %v\n", err)
+		return
+	}
+	s.pruneDeleted(cameras)
+
+	jobs := make(chan *models.Camera)
+	var wg sync.WaitGroup
+	for i := 0; i < cameraThumbnailWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for camera := range jobs {
+				s.refresh(camera)
+			}
+		}()
+	}
+	for i := range cameras {
+		if healthy, known := s.health.IsHealthy(cameras[i].ID); known && !healthy {
+			continue
+		}
+		if _, private := s.privacy.Active(cameras[i].ID); private {
+			continue
+		}
+		jobs <- &cameras[i]
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (s *CameraThumbnailService) refresh(camera *models.Camera) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slot, err := s.scheduler.Acquire(camera.ID, PipelineCameraThumbnail, cameraThumbnailPriority, nil, cancel)
+	if err != nil {
+		// Every slot is streaming; the next round tries again
+		return
+	}
+	frame, err := captureJPEG(ctx, camera.ID, PipelineCameraThumbnail, s.ingest.URL(camera), s.config.Width)
+	slot.Release()
+	if err != nil {
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			fmt.Printf("[CameraThumbnails] Failed to capture camera %d: %v\n", camera.ID, err)
+		}
+		return
+	}
+	if err := s.store.Put(camera.ID, frame, time.Now()); err != nil {
+		fmt.Printf("[CameraThumbnails] Failed to store thumbnail of camera %d: %v\n", camera.ID, err)
+	}
+}
+
+// pruneDeleted removes the stored thumbnails of cameras that no longer
+// exist, also those left by earlier runs or other nodes
+func (s *CameraThumbnailService) pruneDeleted(cameras []models.Camera) {
+	existing := make(map[uint]bool, len(cameras))
+	for _, camera := range cameras {
+		existing[camera.ID] = true
+	}
+
+	stored, err := s.store.List()
+	if err != nil {
+		fmt.Printf("[CameraThumbnails] Failed to list thumbnails: %v\n", err)
+		return
+	}
+	var deleted []uint
+	for _, cameraID := range stored {
+		if !existing[cameraID] {
+			deleted = append(deleted, cameraID)
+		}
+	}
+
+	for _, cameraID := range deleted {
+		if err := s.store.Delete(cameraID); err != nil {
+			fmt.Printf("[CameraThumbnails] Failed to delete thumbnail of camera %d: %v\n", cameraID, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+)
+
+// faults are the failures currently injected by ChaosService. They are
+// package-level because the code paths they break (ProbeRTSP, the MediaMTX
+// HTTP client) are shared by every service.
+var faults struct {
+	mu              sync.RWMutex
+	mediamtxBlocked bool
+	rtspDelay       time.Duration
+}
+
+// injectedRTSPDelay is added before every RTSP connection the backend makes:
+// probes, and FFmpegs started with an RTSP input
+func injectedRTSPDelay() time.Duration {
+	faults.mu.RLock()
+	defer faults.mu.RUnlock()
+	return faults.rtspDelay
+}
+
+func mediaMTXAPIBlocked() bool {
+	faults.mu.RLock()
+	defer faults.mu.RUnlock()
+	return faults.mediamtxBlocked
+}
+
+// faultTransport fails requests to the MediaMTX API while it is blocked
+type faultTransport struct {
+	apiHost string // host:port of the MediaMTX API
+}
+
+func (t faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.apiHost && mediaMTXAPIBlocked() {
+		return nil, fmt.Errorf("dial tcp %s: connection refused (injected by chaos)", t.apiHost)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// ChaosStatus is the set of failures currently injected
+type ChaosStatus struct {
+	MediaMTXBlocked      bool       `json:"mediamtx_blocked"`
+	MediaMTXBlockedUntil *time.Time `json:"mediamtx_blocked_until,omitempty"`
+	RTSPDelayMs          int64      `json:"rtsp_delay_ms"`
+	RTSPDelayUntil       *time.Time `json:"rtsp_delay_until,omitempty"`
+}
+
+// ChaosService injects stream failures for testing the watchdogs, alerting
+// and UI fallbacks end to end. Toggles can expire on their own so a
+// forgotten one doesn't outlive the test.
+type ChaosService struct {
+	usage  *UsageTracker
+	events *EventService
+
+	mu            sync.Mutex
+	blockedUntil  *time.Time
+	delayUntil    *time.Time
+	blockedRevert *time.Timer
+	delayRevert   *time.Timer
+}
+
+func NewChaosService(usage *UsageTracker, events *EventService) *ChaosService {
+	return &ChaosService{
+		usage:  usage,
+		events: events,
+	}
+}
+
+// KillFFmpeg kills the FFmpeg processes the backend runs for a camera (all
+// pipelines when pipeline is empty) and returns how many were killed.
+// Transcodes run by MediaMTX itself are not affected.
+func (s *ChaosService) KillFFmpeg(cameraID uint, pipeline string) int {
+	killed := s.usage.KillProcesses(cameraID, pipeline)
+	s.record(&cameraID, fmt.Sprintf("Killed %d FFmpeg processes", killed), map[string]interface{}{
+		"fault":    "kill_ffmpeg",
+		"pipeline": pipeline,
+		"killed":   killed,
+	})
+	return killed
+}
+
+// SetMediaMTXBlocked blocks or unblocks the MediaMTX API. A non-zero
+// duration unblocks it automatically.
+func (s *ChaosService) SetMediaMTXBlocked(blocked bool, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	faults.mu.Lock()
+	faults.mediamtxBlocked = blocked
+	faults.mu.Unlock()
+
+	s.blockedUntil = nil
+	if s.blockedRevert != nil {
+		s.blockedRevert.Stop()
+		s.blockedRevert = nil
+	}
+	if blocked && duration > 0 {
+		until := time.Now().Add(duration)
+		s.blockedUntil = &until
+		s.blockedRevert = time.AfterFunc(duration, func() { s.SetMediaMTXBlocked(false, 0) })
+	}
+
+	s.record(nil, fmt.Sprintf("MediaMTX API blocked: %v", blocked), map[string]interface{}{
+		"fault":    "block_mediamtx",
+		"blocked":  blocked,
+		"duration": duration.String(),
+	})
+}
+
+// SetRTSPDelay delays every RTSP connection the backend makes (0 removes
+// the delay). A non-zero duration removes it automatically.
+func (s *ChaosService) SetRTSPDelay(delay, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	faults.mu.Lock()
+	faults.rtspDelay = delay
+	faults.mu.Unlock()
+
+	s.delayUntil = nil
+	if s.delayRevert != nil {
+		s.delayRevert.Stop()
+		s.delayRevert = nil
+	}
+	if delay > 0 && duration > 0 {
+		until := time.Now().Add(duration)
+		s.delayUntil = &until
+		s.delayRevert = time.AfterFunc(duration, func() { s.SetRTSPDelay(0, 0) })
+	}
+
+	s.record(nil, fmt.Sprintf("RTSP delay set to %v", delay), map[string]interface{}{
+		"fault":    "delay_rtsp",
+		"delay":    delay.String(),
+		"duration": duration.String(),
+	})
+}
+
+// Status returns the failures currently injected
+func (s *ChaosService) Status() ChaosStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	faults.mu.RLock()
+	defer faults.mu.RUnlock()
+
+	return ChaosStatus{
+		MediaMTXBlocked:      faults.mediamtxBlocked,
+		MediaMTXBlockedUntil: s.blockedUntil,
+		RTSPDelayMs:          faults.rtspDelay.Milliseconds(),
+		RTSPDelayUntil:       s.delayUntil,
+	}
+}
+
+// Reset removes every injected failure
+func (s *ChaosService) Reset() {
+	s.SetMediaMTXBlocked(false, 0)
+	s.SetRTSPDelay(0, 0)
+}
+
+// record logs the fault as an event so it shows up next to the alerts it causes
+func (s *ChaosService) record(cameraID *uint, description string, data interface{}) {
+	fmt.Printf("[Chaos] %s\n", description)
+	s.events.Record(&models.Event{
+		CameraID:    cameraID,
+		Type:        "chaos",
+		Severity:    "warning",
+		Source:      "chaos",
+		Description: description,
+	}, data)
+}
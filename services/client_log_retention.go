@@ -0,0 +1,46 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+const clientLogPruneInterval = time.Hour
+
+// ClientLogRetention deletes playback errors reported by the frontend once
+// they are older than CLIENT_LOG_RETENTION
+type ClientLogRetention struct {
+	db     *gorm.DB
+	config config.ClientLogConfig
+}
+
+func NewClientLogRetention(cfg config.ClientLogConfig, db *gorm.DB) *ClientLogRetention {
+	return &ClientLogRetention{db: db, config: cfg}
+}
+
+// Start prunes expired reports now and every clientLogPruneInterval
+func (r *ClientLogRetention) Start() {
+	if r.config.Retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(clientLogPruneInterval)
+		defer ticker.Stop()
+
+		for {
+			cutoff := time.Now().Add(-r.config.Retention)
+			result := r.db.Where("occurred_at < ?", cutoff).Delete(&models.ClientLog{})
+			if result.Error != nil {
+				fmt.Printf("[ClientLogs] Failed to prune reports: %v\n", result.Error)
+			} else if result.RowsAffected > 0 {
+				fmt.Printf("[ClientLogs] Deleted %d reports older than %s\n", result.RowsAffected, cutoff.Format(time.RFC3339))
+			}
+			<-ticker.C
+		}
+	}()
+}
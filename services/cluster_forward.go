@@ -0,0 +1,77 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+// clusterForwardWindow is how far a forwarded request's signing time may be
+// from this node's clock
+const clusterForwardWindow = time.Minute
+
+// SignForward returns the value of the header marking a request this node
+// forwards to another: its node ID, the time and an HMAC of both with the
+// request's method and path, keyed with the cluster secret
+func (s *ClusterService) SignForward(method, path string) string {
+	now := time.Now().Unix()
+	return fmt.Sprintf("%s.%d.%s", s.config.NodeID, now, forwardMAC(s.forwardKeys()[0], s.config.NodeID, now, method, path))
+}
+
+// VerifyForward reports whether a forwarded-by header value was signed by a
+// node of this cluster for this request, recently. Clients can't produce
+// one, so they can't make a node serve a stream it should forward.
+func (s *ClusterService) VerifyForward(value, method, path string) bool {
+	// Node IDs may contain dots; the time and MAC can't
+	mac := strings.LastIndexByte(value, '.')
+	if mac <= 0 {
+		return false
+	}
+	at := strings.LastIndexByte(value[:mac], '.')
+	if at <= 0 {
+		return false
+	}
+	nodeID := value[:at]
+	signedAt, err := strconv.ParseInt(value[at+1:mac], 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(signedAt, 0)); age > clusterForwardWindow || age < -clusterForwardWindow {
+		return false
+	}
+	// Keys being rotated still count, so nodes that haven't re-read the
+	// secret yet aren't cut off
+	for _, key := range s.forwardKeys() {
+		if key != "" && hmac.Equal([]byte(value[mac+1:]), []byte(forwardMAC(key, nodeID, signedAt, method, path))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForwardSecretIsPlaceholder reports whether forwarded requests would be
+// signed with the placeholder JWT secret, which anyone can sign with
+func (s *ClusterService) ForwardSecretIsPlaceholder() bool {
+	return s.forwardKeys()[0] == config.PlaceholderJWTSecret
+}
+
+// forwardKeys returns the cluster secret's keys, current first, or the JWT
+// secret's when no cluster secret is set
+func (s *ClusterService) forwardKeys() []string {
+	if s.secrets.Get(SecretCluster) != "" {
+		return s.secrets.Keys(SecretCluster)
+	}
+	return s.secrets.Keys(SecretJWT)
+}
+
+func forwardMAC(key, nodeID string, signedAt int64, method, path string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%s|%d|%s|%s", nodeID, signedAt, method, path)
+	return hex.EncodeToString(mac.Sum(nil))
+}
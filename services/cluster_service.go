@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	clusterQueryTimeout = 5 * time.Second
+	clusterNodeKeep     = 24 * time.Hour // Nodes not seen for this long are dropped from the list
+	clusterLockFailures = 3              // Failed lock checks in a row after which the leader gives up
+)
+
+// ErrNotLeader is returned for work only the cluster leader does, e.g.
+// starting a recording on a follower
+var ErrNotLeader = errors.New("this node is not the cluster leader")
+
+// ClusterNodeStatus is a node with whether it reported in recently
+type ClusterNodeStatus struct {
+	models.ClusterNode
+	Online  bool `json:"online"`
+	Self    bool `json:"self"`
+	Streams int  `json:"streams"` // Stream pipelines it owns
+}
+
+// ClusterService elects the instance that runs recorders, watchdogs and
+// schedulers when several share the database. The leader holds a Postgres
+// advisory lock on a connection of its own; followers try to take it every
+// CLUSTER_ELECTION_INTERVAL, so one takes over as soon as the leader's
+// session ends. Without cluster mode the instance is always the leader.
+type ClusterService struct {
+	config    config.ClusterConfig
+	secrets   *SecretStore // Keys forwarded requests are signed with
+	db        *gorm.DB
+	startedAt time.Time
+	onElected []func()
+	pipelines map[string]trackedPipeline // See TrackPipeline
+
+	mu     sync.RWMutex
+	leader bool
+	conn   *sql.Conn // Holds the advisory lock while leader
+
+	lockFailures int // Lock checks failed in a row, see checkLock
+}
+
+func NewClusterService(cfg config.ClusterConfig, secrets *SecretStore, db *gorm.DB) *ClusterService {
+	return &ClusterService{
+		config:    cfg,
+		secrets:   secrets,
+		db:        db,
+		startedAt: time.Now(),
+		pipelines: make(map[string]trackedPipeline),
+	}
+}
+
+// OnElected registers fn to run once this instance becomes the leader, in
+// the order registered; register before Start
+func (s *ClusterService) OnElected(fn func()) {
+	s.onElected = append(s.onElected, fn)
+}
+
+// Start runs the election, or the OnElected callbacks right away when
+// cluster mode is off
+func (s *ClusterService) Start() {
+	if !s.config.Enabled {
+		s.becomeLeader(time.Now())
+		return
+	}
+
+	if s.config.AdvertiseURL == "" {
+		fmt.Printf("[Cluster] CLUSTER_ADVERTISE_URL is not set, stream requests can't be forwarded to this node\n")
+	}
+	fmt.Printf("[Cluster] Node %s started, waiting for leadership\n", s.config.NodeID)
+	go func() {
+		for {
+			now := time.Now()
+			if s.IsLeader() {
+				s.checkLock()
+			} else {
+				acquired, err := s.tryLock()
+				if err != nil {
+					fmt.Printf("[Cluster] Election failed: %v\n", err)
+				} else if acquired {
+					s.becomeLeader(now)
+				}
+			}
+			s.heartbeat(now)
+			s.renewStreams(now)
+			time.Sleep(s.config.Interval)
+		}
+	}()
+}
+
+// IsLeader reports whether this instance runs the leader-only services
+func (s *ClusterService) IsLeader() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.leader
+}
+
+// NodeID is this instance's CLUSTER_NODE_ID
+func (s *ClusterService) NodeID() string {
+	return s.config.NodeID
+}
+
+// Leader returns the node currently leading, nil when none has reported in
+// recently (e.g. during a takeover)
+func (s *ClusterService) Leader() (*models.ClusterNode, error) {
+	if !s.config.Enabled {
+		node := s.self(time.Now())
+		return &node, nil
+	}
+	var node models.ClusterNode
+	err := s.db.Where("leader = ? AND last_seen_at > ?", true, time.Now().Add(-s.offlineAfter())).
+		Order("last_seen_at DESC").First(&node).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// Nodes returns the instances seen in the last day, leader first
+func (s *ClusterService) Nodes() ([]ClusterNodeStatus, error) {
+	now := time.Now()
+	if !s.config.Enabled {
+		return []ClusterNodeStatus{{ClusterNode: s.self(now), Online: true, Self: true}}, nil
+	}
+	var nodes []models.ClusterNode
+	if err := s.db.Where("last_seen_at > ?", now.Add(-clusterNodeKeep)).
+		Order("leader DESC, id").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	streams, err := s.streamCounts()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]ClusterNodeStatus, len(nodes))
+	for i, node := range nodes {
+		online := now.Sub(node.LastSeenAt) < s.offlineAfter()
+		// A leader that stopped reporting in is being replaced
+		node.Leader = node.Leader && online
+		statuses[i] = ClusterNodeStatus{ClusterNode: node, Online: online, Self: node.ID == s.config.NodeID, Streams: streams[node.ID]}
+	}
+	return statuses, nil
+}
+
+// offlineAfter is how long a node may go without reporting in before it is
+// considered gone
+func (s *ClusterService) offlineAfter() time.Duration {
+	return 3 * s.config.Interval
+}
+
+func (s *ClusterService) self(now time.Time) models.ClusterNode {
+	hostname, _ := os.Hostname()
+	return models.ClusterNode{
+		ID:           s.config.NodeID,
+		Hostname:     hostname,
+		AdvertiseURL: s.config.AdvertiseURL,
+		Leader:       s.IsLeader(),
+		StartedAt:    s.startedAt,
+		LastSeenAt:   now,
+	}
+}
+
+// tryLock takes the advisory lock on a connection kept out of the pool, so
+// the lock lives exactly as long as that session
+func (s *ClusterService) tryLock() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterQueryTimeout)
+	defer cancel()
+
+	if s.conn == nil {
+		sqlDB, err := s.db.DB()
+		if err != nil {
+			return false, err
+		}
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			return false, err
+		}
+		s.conn = conn
+	}
+	var acquired bool
+	if err := s.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", s.config.LockKey).Scan(&acquired); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return false, err
+	}
+	return acquired, nil
+}
+
+// checkLock makes sure the session holding the lock still holds it. Once
+// it doesn't another node can take over at any moment, and the leader-only
+// services can't be stopped in place, so the process exits for its
+// supervisor to restart it as a follower. A check that fails, e.g. on a
+// slow database, is retried at the next interval; only clusterLockFailures
+// in a row count as the lock being lost.
+func (s *ClusterService) checkLock() {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterQueryTimeout)
+	defer cancel()
+
+	var held bool
+	err := s.conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_locks
+		WHERE locktype = 'advisory' AND granted AND pid = pg_backend_pid() AND objsubid = 1
+		AND classid::bigint = ($1::bigint >> 32) & 4294967295 AND objid::bigint = $1::bigint & 4294967295)`, s.config.LockKey).Scan(&held)
+	if err == nil && held {
+		s.lockFailures = 0
+		return
+	}
+	if err == nil {
+		fmt.Printf("[Cluster] The leader lock is no longer held, exiting so another node takes over\n")
+		os.Exit(1)
+	}
+	s.lockFailures++
+	if s.lockFailures < clusterLockFailures {
+		fmt.Printf("[Cluster] Failed to check the leader lock (%v), retrying\n", err)
+		return
+	}
+	fmt.Printf("[Cluster] Lost the leader lock (%v), exiting so another node takes over\n", err)
+	os.Exit(1)
+}
+
+// becomeLeader starts the leader-only services
+func (s *ClusterService) becomeLeader(now time.Time) {
+	s.mu.Lock()
+	s.leader = true
+	s.mu.Unlock()
+	if s.config.Enabled {
+		s.claimNodes(now)
+	}
+	for _, fn := range s.onElected {
+		fn()
+	}
+}
+
+// claimNodes takes the leader flag from the node this one replaced and
+// drops nodes gone for a day
+func (s *ClusterService) claimNodes(now time.Time) {
+	if err := s.db.Model(&models.ClusterNode{}).Where("id <> ? AND leader = ?", s.config.NodeID, true).
+		Update("leader", false).Error; err != nil {
+		fmt.Printf("[Cluster] Failed to clear the previous leader: %v\n", err)
+	}
+	if err := s.db.Where("last_seen_at < ?", now.Add(-clusterNodeKeep)).Delete(&models.ClusterNode{}).Error; err != nil {
+		fmt.Printf("[Cluster] Failed to drop old nodes: %v\n", err)
+	}
+	fmt.Printf("[Cluster] Node %s is now the leader\n", s.config.NodeID)
+}
+
+// heartbeat records that this node is alive and whether it leads
+func (s *ClusterService) heartbeat(now time.Time) {
+	node := s.self(now)
+	if err := s.db.Save(&node).Error; err != nil {
+		fmt.Printf("[Cluster] Failed to report in: %v\n", err)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// trackedPipeline is a stream pipeline whose ownership is shared between
+// nodes
+type trackedPipeline struct {
+	active func(cameraID uint) bool // Whether the pipeline runs here for a camera
+	stop   func(cameraID uint)
+}
+
+// TrackPipeline registers a stream pipeline whose ownership is shared
+// between nodes; active reports whether it runs here for a camera and stop
+// ends it when another node asks. Register before Start.
+func (s *ClusterService) TrackPipeline(pipeline string, active func(cameraID uint) bool, stop func(cameraID uint)) {
+	s.pipelines[pipeline] = trackedPipeline{active: active, stop: stop}
+}
+
+// RequestStreamStop asks the nodes owning a camera's pipelines (all tracked
+// ones when none are given) to stop them, e.g. after its URL changed; they
+// do within an election interval. This node's own pipelines are left to the
+// caller.
+func (s *ClusterService) RequestStreamStop(cameraID uint, pipelines ...string) {
+	if !s.config.Enabled {
+		return
+	}
+	query := s.db.Model(&models.StreamOwner{}).Where("camera_id = ? AND node_id <> ?", cameraID, s.config.NodeID)
+	if len(pipelines) > 0 {
+		query = query.Where("pipeline IN ?", pipelines)
+	}
+	if err := query.Update("stop_asked", true).Error; err != nil {
+		fmt.Printf("[Cluster] Failed to ask for the streams of camera %d to stop: %v\n", cameraID, err)
+	}
+}
+
+// ClaimStream returns the node that runs a camera's pipeline, claiming it
+// for this node when no live node does. nil means this node owns it.
+func (s *ClusterService) ClaimStream(cameraID uint, pipeline string) (*models.ClusterNode, error) {
+	if !s.config.Enabled {
+		return nil, nil
+	}
+	now := time.Now()
+	// Takes over a claim its node stopped renewing
+	if err := s.db.Exec(`INSERT INTO stream_owners (camera_id, pipeline, node_id, claimed_at, renewed_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (camera_id, pipeline) DO UPDATE
+		SET node_id = EXCLUDED.node_id, claimed_at = EXCLUDED.claimed_at, renewed_at = EXCLUDED.renewed_at
+		WHERE stream_owners.renewed_at < ?`,
+		cameraID, pipeline, s.config.NodeID, now, now, now.Add(-s.offlineAfter())).Error; err != nil {
+		return nil, err
+	}
+
+	var owner models.StreamOwner
+	if err := s.db.Where("camera_id = ? AND pipeline = ?", cameraID, pipeline).First(&owner).Error; err != nil {
+		return nil, err
+	}
+	if owner.NodeID == s.config.NodeID {
+		return nil, nil
+	}
+	var node models.ClusterNode
+	if err := s.db.Where("id = ?", owner.NodeID).First(&node).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return s.TakeOverStream(cameraID, pipeline)
+		}
+		return nil, err
+	}
+	return &node, nil
+}
+
+// TakeOverStream makes this node the owner of a camera's pipeline, e.g.
+// when the owner can't be reached
+func (s *ClusterService) TakeOverStream(cameraID uint, pipeline string) (*models.ClusterNode, error) {
+	if !s.config.Enabled {
+		return nil, nil
+	}
+	now := time.Now()
+	if err := s.db.Save(&models.StreamOwner{
+		CameraID:  cameraID,
+		Pipeline:  pipeline,
+		NodeID:    s.config.NodeID,
+		ClaimedAt: now,
+		RenewedAt: now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	fmt.Printf("[Cluster] Took over the %s stream of camera %d\n", pipeline, cameraID)
+	return nil, nil
+}
+
+// renewStreams keeps this node's claims on the pipelines still running here
+// and releases the rest, stopping the ones another node asked to stop. New
+// claims get offlineAfter to start their pipeline.
+func (s *ClusterService) renewStreams(now time.Time) {
+	var owned []models.StreamOwner
+	if err := s.db.Where("node_id = ?", s.config.NodeID).Find(&owned).Error; err != nil {
+		fmt.Printf("[Cluster] Failed to load owned streams: %v\n", err)
+		return
+	}
+	for _, owner := range owned {
+		tracked, ok := s.pipelines[owner.Pipeline]
+		if owner.StopAsked && ok {
+			fmt.Printf("[Cluster] Stopping the %s stream of camera %d for another node\n", owner.Pipeline, owner.CameraID)
+			tracked.stop(owner.CameraID)
+		} else if now.Sub(owner.ClaimedAt) < s.offlineAfter() || (ok && tracked.active(owner.CameraID)) {
+			continue
+		}
+		if err := s.db.Where("camera_id = ? AND pipeline = ? AND node_id = ?", owner.CameraID, owner.Pipeline, s.config.NodeID).
+			Delete(&models.StreamOwner{}).Error; err != nil {
+			fmt.Printf("[Cluster] Failed to release the %s stream of camera %d: %v\n", owner.Pipeline, owner.CameraID, err)
+		}
+	}
+	if err := s.db.Model(&models.StreamOwner{}).Where("node_id = ?", s.config.NodeID).
+		Update("renewed_at", now).Error; err != nil {
+		fmt.Printf("[Cluster] Failed to renew owned streams: %v\n", err)
+	}
+}
+
+// streamCounts returns how many streams each node owns
+func (s *ClusterService) streamCounts() (map[string]int, error) {
+	var rows []struct {
+		NodeID string
+		Count  int
+	}
+	if err := s.db.Model(&models.StreamOwner{}).Select("node_id, COUNT(*) AS count").
+		Group("node_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.NodeID] = row.Count
+	}
+	return counts, nil
+}
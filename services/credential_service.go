@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/utils"
+
+	"gorm.io/gorm"
+)
+
+// CredentialService resolves the shared credentials cameras reference into
+// the RTSP URLs used to connect to them. Decrypted credentials are cached
+// until the credential is changed.
+type CredentialService struct {
+	db      *gorm.DB
+	secrets *SecretStore
+	cache   map[uint]url.Userinfo // credential_id -> decrypted user:pass
+	mu      sync.RWMutex
+}
+
+func NewCredentialService(secrets *SecretStore, db *gorm.DB) *CredentialService {
+	return &CredentialService{
+		db:      db,
+		secrets: secrets,
+		cache:   make(map[uint]url.Userinfo),
+	}
+}
+
+// EncryptPassword encrypts a password for Credential.PasswordEncrypted
+func (s *CredentialService) EncryptPassword(password string) (string, error) {
+	return utils.EncryptSecret(s.secrets.Get(SecretCredential), password)
+}
+
+// Invalidate drops a cached credential after it was rotated or deleted
+func (s *CredentialService) Invalidate(credentialID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, credentialID)
+}
+
+// StreamURL returns the RTSP URL to connect to a camera with, with its shared
+// credential filled in. Cameras without a credential use RTSPUrl as stored.
+func (s *CredentialService) StreamURL(camera *models.Camera) string {
+	if camera.CredentialID == nil {
+		return camera.RTSPUrl
+	}
+
+	user, err := s.userinfo(*camera.CredentialID)
+	if err != nil {
+		fmt.Printf("[Vault] Cannot use credential %d for camera %d: %v\n", *camera.CredentialID, camera.ID, err)
+		return camera.RTSPUrl
+	}
+
+	u, err := url.Parse(camera.RTSPUrl)
+	if err != nil {
+		return camera.RTSPUrl
+	}
+	u.User = &user
+	return u.String()
+}
+
+func (s *CredentialService) userinfo(credentialID uint) (url.Userinfo, error) {
+	s.mu.RLock()
+	user, cached := s.cache[credentialID]
+	s.mu.RUnlock()
+	if cached {
+		return user, nil
+	}
+
+	var credential models.Credential
+	if err := s.db.First(&credential, credentialID).Error; err != nil {
+		return url.Userinfo{}, err
+	}
+	password, err := utils.DecryptSecretAny(s.secrets.Keys(SecretCredential), credential.PasswordEncrypted)
+	if err != nil {
+		return url.Userinfo{}, err
+	}
+	user = *url.UserPassword(credential.Username, password)
+
+	s.mu.Lock()
+	s.cache[credentialID] = user
+	s.mu.Unlock()
+	return user, nil
+}
+
+// VaultURLCredentials moves the user:pass of an RTSP URL into the vault,
+// reusing a credential with the same username and password or creating one
+// named after the user and host. It returns the credential's id and the URL
+// without credentials; URLs without credentials return 0.
+func (s *CredentialService) VaultURLCredentials(rawURL string) (uint, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return 0, rawURL, nil
+	}
+	username := u.User.Username()
+	password, _ := u.User.Password()
+	u.User = nil
+	stripped := u.String()
+
+	var candidates []models.Credential
+	if err := s.db.Where("username = ?", username).Order("id").Find(&candidates).Error; err != nil {
+		return 0, "", err
+	}
+	for _, credential := range candidates {
+		existing, err := s.userinfo(credential.ID)
+		if err != nil {
+			continue
+		}
+		if stored, _ := existing.Password(); stored == password {
+			return credential.ID, stripped, nil
+		}
+	}
+
+	encrypted, err := s.EncryptPassword(password)
+	if err != nil {
+		return 0, "", err
+	}
+	name := fmt.Sprintf("%s@%s", username, u.Hostname())
+	var taken int64
+	if err := s.db.Unscoped().Model(&models.Credential{}).Where("name = ? OR name LIKE ?", name, name+" (%)").Count(&taken).Error; err != nil {
+		return 0, "", err
+	}
+	if taken > 0 {
+		name = fmt.Sprintf("%s (%d)", name, taken+1)
+	}
+	credential := models.Credential{
+		Name:              name,
+		Username:          username,
+		PasswordEncrypted: encrypted,
+		Notes:             "Moved out of a camera URL",
+	}
+	if err := s.db.Create(&credential).Error; err != nil {
+		return 0, "", err
+	}
+	return credential.ID, stripped, nil
+}
+
+// StripURLCredentials removes user:pass from an RTSP URL, for cameras that
+// take their credentials from the vault instead
+func StripURLCredentials(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
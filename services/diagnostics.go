@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiagnosticCheck is the result of a single network check against a camera
+type DiagnosticCheck struct {
+	Name      string `json:"name"`
+	Target    string `json:"target"`
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RunCameraDiagnostics runs DNS, ping and port checks against the camera host
+// so operators can tell "camera unreachable" from "wrong port" from "bad stream"
+func RunCameraDiagnostics(rtspURL string, onvifPort int) []DiagnosticCheck {
+	u, err := url.Parse(rtspURL)
+	if err != nil || u.Hostname() == "" {
+		return []DiagnosticCheck{{Name: "rtsp_url", Target: "", OK: false, Error: "invalid RTSP URL"}}
+	}
+
+	host := u.Hostname()
+	if !validHost(host) {
+		return []DiagnosticCheck{{Name: "rtsp_url", Target: "", OK: false, Error: "invalid host in RTSP URL"}}
+	}
+	rtspPort := u.Port()
+	if rtspPort == "" {
+		rtspPort = "554"
+	}
+	if onvifPort == 0 {
+		onvifPort = 80
+	}
+
+	checks := []DiagnosticCheck{checkDNS(host)}
+	checks = append(checks, checkPing(host))
+	checks = append(checks, checkTCP("rtsp_port", net.JoinHostPort(host, rtspPort)))
+	checks = append(checks, checkTCP("onvif_port", net.JoinHostPort(host, strconv.Itoa(onvifPort))))
+	return checks
+}
+
+func checkDNS(host string) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "dns", Target: host}
+	if net.ParseIP(host) != nil {
+		check.OK = true
+		return check
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	check.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.OK = true
+	check.Target = fmt.Sprintf("%s (%v)", host, addrs)
+	return check
+}
+
+// validHost reports whether host is an IP address or a DNS name, so it
+// can't be taken for an option by ping
+func validHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkPing uses the system ping binary since raw ICMP sockets need root
+func checkPing(host string) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "ping", Target: host}
+	if _, err := exec.LookPath("ping"); err != nil {
+		check.Error = "ping not available on server"
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	output, err := exec.CommandContext(ctx, "ping", "-c", "3", "-W", "2", "--", host).CombinedOutput()
+	check.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Error = fmt.Sprintf("no reply: %v", err)
+		if len(output) > 0 {
+			check.Error = string(output)
+		}
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+func checkTCP(name, address string) DiagnosticCheck {
+	check := DiagnosticCheck{Name: name, Target: address}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
+	check.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	conn.Close()
+	check.OK = true
+	return check
+}
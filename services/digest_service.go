@@ -0,0 +1,387 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+const digestTopCameras = 5
+
+// DigestData is what digest templates are executed with
+type DigestData struct {
+	Recipient   string
+	From        time.Time
+	To          time.Time
+	TotalEvents int64
+	Areas       []AreaDigest
+}
+
+// AreaDigest summarizes one camera area over the digest window
+type AreaDigest struct {
+	Area                string
+	Cameras             int
+	TotalEvents         int64
+	EventCounts         map[string]int64 // severity -> count, always has info/warning/critical
+	TopCameras          []DigestCamera   // Most events first
+	Downtime            []DigestDowntime // Longest first, only cameras that were down
+	DowntimeMinutes     int
+	UnresolvedIncidents []models.Incident
+}
+
+type DigestCamera struct {
+	ID     uint
+	Name   string
+	Events int64
+}
+
+type DigestDowntime struct {
+	ID      uint
+	Name    string
+	Minutes int
+}
+
+// DefaultDigestTemplate is used when no template in the DB is active
+var DefaultDigestTemplate = models.DigestTemplate{
+	Name:    "default",
+	Subject: `Overnight digest {{.From.Format "Jan 2 15:04"}} - {{.To.Format "Jan 2 15:04"}}: {{.TotalEvents}} events`,
+	Body: `Hello {{.Recipient}},
+
+Summary of {{.From.Format "Mon Jan 2 15:04"}} to {{.To.Format "Mon Jan 2 15:04"}}.
+{{range .Areas}}
+== {{.Area}} ({{.Cameras}} cameras) ==
+Events: {{.TotalEvents}} (critical {{index .EventCounts "critical"}}, warning {{index .EventCounts "warning"}}, info {{index .EventCounts "info"}})
+{{- if .TopCameras}}
+Top cameras:
+{{- range .TopCameras}}
+  - {{.Name}}: {{.Events}} events
+{{- end}}{{end}}
+{{- if .Downtime}}
+Downtime ({{.DowntimeMinutes}} min total):
+{{- range .Downtime}}
+  - {{.Name}}: {{.Minutes}} min
+{{- end}}{{end}}
+{{- if .UnresolvedIncidents}}
+Unresolved incidents:
+{{- range .UnresolvedIncidents}}
+  - #{{.ID}} [{{.Severity}}] {{.Title}}
+{{- end}}{{end}}
+{{end}}`,
+}
+
+// DigestService builds the morning digest of overnight events per area and
+// emails it to managers, each scoped to their assigned areas
+type DigestService struct {
+	db     *gorm.DB
+	mailer *Mailer
+	config config.DigestConfig
+}
+
+func NewDigestService(cfg config.DigestConfig, db *gorm.DB, mailer *Mailer) *DigestService {
+	return &DigestService{
+		db:     db,
+		mailer: mailer,
+		config: cfg,
+	}
+}
+
+// Start sends the digest every day at SendAt
+func (s *DigestService) Start() {
+	sendAt, err := time.Parse("15:04", s.config.SendAt)
+	if err != nil {
+		if s.config.SendAt != "" {
+			fmt.Printf("[Digest] Invalid DIGEST_SEND_AT %q, digest disabled\n", s.config.SendAt)
+		}
+		return
+	}
+	if !s.mailer.Enabled() {
+		fmt.Printf("[Digest] SMTP is not configured, digest disabled\n")
+		return
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), sendAt.Hour(), sendAt.Minute(), 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			sent, failed := s.SendDigests(next)
+			fmt.Printf("[Digest] Sent %d digests, %d failed\n", sent, len(failed))
+		}
+	}()
+}
+
+// WindowFor returns the digest window ending at to: from the latest
+// WindowStart before to (24h when WindowStart isn't set)
+func (s *DigestService) WindowFor(to time.Time) time.Time {
+	start, err := time.Parse("15:04", s.config.WindowStart)
+	if err != nil {
+		return to.Add(-24 * time.Hour)
+	}
+	from := time.Date(to.Year(), to.Month(), to.Day(), start.Hour(), start.Minute(), 0, 0, to.Location())
+	if !from.Before(to) {
+		from = from.AddDate(0, 0, -1)
+	}
+	return from
+}
+
+// SendDigests emails the digest for the window ending at to to every
+// recipient. Returns how many were sent and the error per failed address.
+func (s *DigestService) SendDigests(to time.Time) (int, map[string]string) {
+	failed := make(map[string]string)
+
+	var users []models.User
+	if err := s.db.Where("role IN ?", s.config.RecipientRoles).Find(&users).Error; err != nil {
+		failed["*"] = err.Error()
+		return 0, failed
+	}
+
+	tpl, err := s.ActiveTemplate()
+	if err != nil {
+		failed["*"] = err.Error()
+		return 0, failed
+	}
+
+	from := s.WindowFor(to)
+	sent := 0
+	for i := range users {
+		user := &users[i]
+		data, err := s.Build(from, to, DigestAreas(user))
+		if err != nil {
+			failed[user.Email] = err.Error()
+			continue
+		}
+		data.Recipient = user.Name
+
+		subject, body, err := RenderDigest(tpl, data)
+		if err != nil {
+			failed[user.Email] = err.Error()
+			continue
+		}
+		if err := s.mailer.Send([]string{user.Email}, subject, body, tpl.HTML); err != nil {
+			failed[user.Email] = err.Error()
+			continue
+		}
+		sent++
+	}
+	return sent, failed
+}
+
+// ActiveTemplate returns the active template from the DB, or the default
+func (s *DigestService) ActiveTemplate() (*models.DigestTemplate, error) {
+	var tpl models.DigestTemplate
+	err := s.db.Where("active = ?", true).Order("updated_at DESC").First(&tpl).Error
+	if err == gorm.ErrRecordNotFound {
+		fallback := DefaultDigestTemplate
+		return &fallback, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+// RenderDigest executes a template's subject and body
+func RenderDigest(tpl *models.DigestTemplate, data *DigestData) (string, string, error) {
+	subjectTpl, err := texttemplate.New("subject").Parse(tpl.Subject)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid subject template: %w", err)
+	}
+	var subject bytes.Buffer
+	if err := subjectTpl.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("failed to render subject: %w", err)
+	}
+
+	var body bytes.Buffer
+	if tpl.HTML {
+		bodyTpl, err := htmltemplate.New("body").Parse(tpl.Body)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid body template: %w", err)
+		}
+		err = bodyTpl.Execute(&body, data)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to render body: %w", err)
+		}
+	} else {
+		bodyTpl, err := texttemplate.New("body").Parse(tpl.Body)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid body template: %w", err)
+		}
+		err = bodyTpl.Execute(&body, data)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to render body: %w", err)
+		}
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// DigestAreas returns the areas a user's digest covers: their assigned
+// areas, for admins without any all (nil), for other users without any none
+func DigestAreas(user *models.User) []string {
+	areas := user.Areas()
+	if areas == nil && user.Role != "admin" {
+		return []string{}
+	}
+	return areas
+}
+
+// Build collects the digest of [from, to) for the given areas (nil = all)
+func (s *DigestService) Build(from, to time.Time, areas []string) (*DigestData, error) {
+	var cameras []models.Camera
+	if err := s.db.Select("id", "name", "area").Scopes(database.InAreas(areas)).
+		Order("area, name").Find(&cameras).Error; err != nil {
+		return nil, err
+	}
+
+	byArea := make(map[string]*AreaDigest)
+	var order []string
+	cameraArea := make(map[uint]string, len(cameras))
+	cameraName := make(map[uint]string, len(cameras))
+	cameraIDs := make([]uint, len(cameras))
+	area := func(name string) *AreaDigest {
+		if name == "" {
+			name = "Unassigned"
+		}
+		digest, exists := byArea[name]
+		if !exists {
+			digest = &AreaDigest{
+				Area:        name,
+				EventCounts: map[string]int64{"info": 0, "warning": 0, "critical": 0},
+			}
+			byArea[name] = digest
+			order = append(order, name)
+		}
+		return digest
+	}
+	for i, camera := range cameras {
+		cameraIDs[i] = camera.ID
+		cameraArea[camera.ID] = camera.Area
+		cameraName[camera.ID] = camera.Name
+		area(camera.Area).Cameras++
+	}
+
+	data := &DigestData{From: from, To: to}
+
+	// Events per camera and severity
+	var eventRows []struct {
+		CameraID uint
+		Severity string
+		Count    int64
+	}
+	if err := s.db.Model(&models.Event{}).
+		Select("camera_id, severity, COUNT(*) AS count").
+		Scopes(database.TimeRange("occurred_at", &from, &to)).
+		Where("camera_id IN ?", cameraIDs).
+		Group("camera_id, severity").
+		Scan(&eventRows).Error; err != nil {
+		return nil, err
+	}
+	perCamera := make(map[uint]int64)
+	for _, row := range eventRows {
+		digest := area(cameraArea[row.CameraID])
+		digest.EventCounts[row.Severity] += row.Count
+		digest.TotalEvents += row.Count
+		data.TotalEvents += row.Count
+		perCamera[row.CameraID] += row.Count
+	}
+	for cameraID, count := range perCamera {
+		digest := area(cameraArea[cameraID])
+		digest.TopCameras = append(digest.TopCameras, DigestCamera{ID: cameraID, Name: cameraName[cameraID], Events: count})
+	}
+
+	// Unresolved incidents, by their area or their camera's area
+	var incidents []models.Incident
+	query := s.db.Where("status = ?", "open").Order("created_at")
+	if areas != nil {
+		query = query.Where("(camera_id IN ? OR area IN ?)", cameraIDs, areas)
+	}
+	if err := query.Find(&incidents).Error; err != nil {
+		return nil, err
+	}
+	for _, incident := range incidents {
+		name := incident.Area
+		if name == "" && incident.CameraID != nil {
+			name = cameraArea[*incident.CameraID]
+		}
+		digest := area(name)
+		digest.UnresolvedIncidents = append(digest.UnresolvedIncidents, incident)
+	}
+
+	// Downtime from health history
+	downtime, err := s.downtime(cameraIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for cameraID, duration := range downtime {
+		minutes := int(duration.Minutes())
+		if minutes == 0 {
+			continue
+		}
+		digest := area(cameraArea[cameraID])
+		digest.Downtime = append(digest.Downtime, DigestDowntime{ID: cameraID, Name: cameraName[cameraID], Minutes: minutes})
+		digest.DowntimeMinutes += minutes
+	}
+
+	for _, name := range order {
+		digest := byArea[name]
+		sort.Slice(digest.TopCameras, func(i, j int) bool { return digest.TopCameras[i].Events > digest.TopCameras[j].Events })
+		if len(digest.TopCameras) > digestTopCameras {
+			digest.TopCameras = digest.TopCameras[:digestTopCameras]
+		}
+		sort.Slice(digest.Downtime, func(i, j int) bool { return digest.Downtime[i].Minutes > digest.Downtime[j].Minutes })
+		data.Areas = append(data.Areas, *digest)
+	}
+	return data, nil
+}
+
+// downtime sums how long each camera was unhealthy in [from, to) according
+// to its health transitions, including a state carried over from before from
+func (s *DigestService) downtime(cameraIDs []uint, from, to time.Time) (map[uint]time.Duration, error) {
+	var before []models.StreamHealthChange
+	if err := s.db.Raw(`SELECT DISTINCT ON (camera_id) * FROM stream_health_changes
+		WHERE camera_id IN ? AND changed_at < ?
+		ORDER BY camera_id, changed_at DESC, id DESC`, cameraIDs, from).Scan(&before).Error; err != nil {
+		return nil, err
+	}
+	var changes []models.StreamHealthChange
+	if err := s.db.Where("camera_id IN ?", cameraIDs).
+		Scopes(database.TimeRange("changed_at", &from, &to)).
+		Order("camera_id, changed_at, id").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+
+	downSince := make(map[uint]time.Time)
+	for _, change := range before {
+		if !change.Healthy {
+			downSince[change.CameraID] = from
+		}
+	}
+	result := make(map[uint]time.Duration)
+	for _, change := range changes {
+		since, down := downSince[change.CameraID]
+		switch {
+		case down && change.Healthy:
+			result[change.CameraID] += change.ChangedAt.Sub(since)
+			delete(downSince, change.CameraID)
+		case !down && !change.Healthy:
+			downSince[change.CameraID] = change.ChangedAt
+		}
+	}
+	for cameraID, since := range downSince {
+		result[cameraID] += to.Sub(since)
+	}
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// maxDirectoryPhoto is the largest photo kept (Active Directory caps
+// thumbnailPhoto at 100KB)
+const maxDirectoryPhoto = 256 * 1024
+
+// DirectoryService copies users' phone, department and photo from an LDAP
+// directory every LDAP_SYNC_INTERVAL, looking each user up by email. Users
+// the directory doesn't know keep what was set by hand, as do fields the
+// directory has no value for.
+type DirectoryService struct {
+	config config.DirectoryConfig
+	db     *gorm.DB
+}
+
+func NewDirectoryService(cfg config.DirectoryConfig, db *gorm.DB) *DirectoryService {
+	return &DirectoryService{config: cfg, db: db}
+}
+
+// Enabled reports whether a directory is configured
+func (s *DirectoryService) Enabled() bool {
+	return s.config.URL != ""
+}
+
+// Start syncs all users now and every interval
+func (s *DirectoryService) Start() {
+	if !s.Enabled() || s.config.SyncInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.SyncInterval)
+		defer ticker.Stop()
+
+		for {
+			if synced, err := s.SyncAll(); err != nil {
+				fmt.Printf("[Directory] Sync failed: %v\n", err)
+			} else {
+				fmt.Printf("[Directory] Synced %d users\n", synced)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// SyncAll updates every user found in the directory and returns how many
+// were found
+func (s *DirectoryService) SyncAll() (int, error) {
+	var users []models.User
+	if err := s.db.Select("id", "email").Find(&users).Error; err != nil {
+		return 0, err
+	}
+	conn, err := s.connect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	synced := 0
+	for i := range users {
+		found, err := s.sync(conn, &users[i])
+		if err != nil {
+			fmt.Printf("[Directory] Failed to sync %s: %v\n", users[i].Email, err)
+			continue
+		}
+		if found {
+			synced++
+		}
+	}
+	return synced, nil
+}
+
+// Sync updates one user from the directory and reports whether the
+// directory has them
+func (s *DirectoryService) Sync(user *models.User) (bool, error) {
+	conn, err := s.connect()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	return s.sync(conn, user)
+}
+
+func (s *DirectoryService) connect() (*ldapConn, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("no directory is configured")
+	}
+	conn, err := dialLDAP(s.config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.BindDN != "" {
+		if err := conn.Bind(s.config.BindDN, s.config.BindPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (s *DirectoryService) sync(conn *ldapConn, user *models.User) (bool, error) {
+	entry, err := conn.SearchOne(s.config.BaseDN, s.config.MailAttribute, user.Email,
+		[]string{s.config.PhoneAttribute, s.config.DepartmentAttribute, s.config.PhotoAttribute})
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	updates := map[string]interface{}{"directory_synced_at": time.Now()}
+	if phone := strings.TrimSpace(string(entry[strings.ToLower(s.config.PhoneAttribute)])); phone != "" {
+		updates["phone"] = phone
+	}
+	if department := strings.TrimSpace(string(entry[strings.ToLower(s.config.DepartmentAttribute)])); department != "" {
+		updates["department"] = department
+	}
+	// Only small JPEGs are served as avatars
+	if photo := entry[strings.ToLower(s.config.PhotoAttribute)]; len(photo) > 0 && len(photo) <= maxDirectoryPhoto && http.DetectContentType(photo) == "image/jpeg" {
+		updates["photo"] = photo
+	}
+	err = s.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error
+	return true, err
+}
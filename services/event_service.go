@@ -0,0 +1,158 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// EventService persists system events (preemptions, camera state changes, ...)
+// and runs them through the per-camera alert rules, raising an Alert for
+// each event a rule lets through. Camera events are tagged with the weather
+// at the camera's site and sent to the webhooks subscribed to them and to
+// live dashboards; alerts are also sent to the users watching the camera.
+type EventService struct {
+	db            *gorm.DB
+	weather       *WeatherService
+	notifications *NotificationService
+	feed          *LiveFeed
+	alerts        *AlertNotifier
+
+	alertMu    sync.Mutex
+	lastAlerts map[string]time.Time // "cameraID:type" -> occurred_at of the last alerting event
+}
+
+func NewEventService(db *gorm.DB, weather *WeatherService, notifications *NotificationService, feed *LiveFeed, alerts *AlertNotifier) *EventService {
+	return &EventService{
+		db:            db,
+		weather:       weather,
+		notifications: notifications,
+		feed:          feed,
+		alerts:        alerts,
+		lastAlerts:    make(map[string]time.Time),
+	}
+}
+
+// Record stores an event. data is marshalled into Event.Data when non-nil.
+// Failures are logged rather than returned; events are best-effort.
+func (s *EventService) Record(event *models.Event, data interface{}) {
+	if s == nil {
+		return
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	if event.Severity == "" {
+		event.Severity = "info"
+	}
+	if data != nil {
+		if raw, err := json.Marshal(data); err == nil {
+			event.Data = string(raw)
+		}
+	}
+	if event.CameraID != nil && event.Weather == "" {
+		if observation := s.weather.ForCamera(*event.CameraID); observation != nil {
+			event.Weather = observation.Conditions()
+			event.WeatherObservationID = &observation.ID
+		}
+	}
+
+	rule := s.alertRule(event)
+	if rule == nil {
+		if s.create(event) {
+			s.notifications.Notify(event)
+			s.feed.PublishEvent(event, nil)
+		}
+		return
+	}
+
+	// Held across the insert so two events in a burst can't both pass the
+	// cooldown
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+	key := fmt.Sprintf("%d:%s", *event.CameraID, event.Type)
+	if !rule.ActiveAt(event.OccurredAt) {
+		event.Suppressed = models.SuppressedSchedule
+	} else if last, ok := s.lastAlert(key, event); ok && event.OccurredAt.Sub(last) < time.Duration(rule.CooldownSeconds)*time.Second {
+		event.Suppressed = models.SuppressedCooldown
+	}
+	if s.create(event) && event.Suppressed == "" {
+		s.lastAlerts[key] = event.OccurredAt
+		alert := s.raise(rule, event)
+		s.alerts.Notify(alert)
+		s.notifications.Notify(event)
+		s.feed.PublishEvent(event, alert)
+	}
+}
+
+// raise creates the alert for an event its rule let through, returning nil
+// when it couldn't be stored
+func (s *EventService) raise(rule *models.AlertRule, event *models.Event) *models.Alert {
+	alert := models.Alert{
+		RuleID:      rule.ID,
+		EventID:     event.ID,
+		CameraID:    *event.CameraID,
+		EventType:   event.Type,
+		Severity:    rule.Severity,
+		Description: event.Description,
+		Status:      models.AlertOpen,
+		RaisedAt:    event.OccurredAt,
+	}
+	if alert.Severity == "" {
+		alert.Severity = event.Severity
+	}
+	if err := s.db.Create(&alert).Error; err != nil {
+		fmt.Printf("[Events] Failed to raise alert for %s event %d: %v\n", event.Type, event.ID, err)
+		return nil
+	}
+	return &alert
+}
+
+func (s *EventService) create(event *models.Event) bool {
+	if err := s.db.Create(event).Error; err != nil {
+		fmt.Printf("[Events] Failed to record %s event: %v\n", event.Type, err)
+		return false
+	}
+	return true
+}
+
+// alertRule returns the enabled alert rule for the event's camera and type,
+// nil when the event alerts unconditionally
+func (s *EventService) alertRule(event *models.Event) *models.AlertRule {
+	if event.CameraID == nil {
+		return nil
+	}
+	var rule models.AlertRule
+	err := s.db.Where("camera_id = ? AND event_type = ? AND enabled", *event.CameraID, event.Type).First(&rule).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			fmt.Printf("[Events] Failed to load alert rule for camera %d: %v\n", *event.CameraID, err)
+		}
+		return nil
+	}
+	return &rule
+}
+
+// lastAlert returns when the camera last alerted for the event's type,
+// looking it up once after a restart. Caller holds alertMu.
+func (s *EventService) lastAlert(key string, event *models.Event) (time.Time, bool) {
+	if last, ok := s.lastAlerts[key]; ok {
+		return last, true
+	}
+	var last models.Event
+	err := s.db.Select("occurred_at").
+		Where("camera_id = ? AND type = ? AND (suppressed IS NULL OR suppressed = '')", *event.CameraID, event.Type).
+		Where("occurred_at <= ?", event.OccurredAt).
+		Order("occurred_at DESC").First(&last).Error
+	if err != nil {
+		return time.Time{}, false
+	}
+	s.lastAlerts[key] = last.OccurredAt
+	return last.OccurredAt, true
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// PipelineExport is the transcode scheduler pipeline of export jobs
+const PipelineExport = "export"
+
+const (
+	exportQueueSize     = 64
+	exportPriority      = -1 // Below every camera priority: exports never preempt live streams
+	exportRetryInterval = 30 * time.Second
+	exportTimeout       = 4 * time.Hour
+
+	compositeTileWidth  = 640
+	compositeTileHeight = 360
+	compositeFPS        = 15
+	compositeTiles      = 4 // 2x2
+
+	speedWidth             = 640
+	speedHeight            = 360
+	speedSourceFPS         = 25
+	speedFPS               = 15
+	speedKeyframesOnly     = 8 // Speeds from which only keyframes are decoded
+	speedHLSSegmentSeconds = 4
+)
+
+// ExportService renders export jobs with FFmpeg, one at a time, and deletes
+// their files once they expire
+type ExportService struct {
+	config    config.ExportConfig
+	db        *gorm.DB
+	scheduler *TranscodeScheduler
+	queue     chan uint
+}
+
+func NewExportService(cfg config.ExportConfig, db *gorm.DB, scheduler *TranscodeScheduler) *ExportService {
+	return &ExportService{
+		config:    cfg,
+		db:        db,
+		scheduler: scheduler,
+		queue:     make(chan uint, exportQueueSize),
+	}
+}
+
+// Start requeues jobs interrupted by a restart, then runs the worker and the
+// hourly cleanup of expired files
+func (s *ExportService) Start() {
+	if err := os.MkdirAll(s.config.Dir, 0o755); err != nil {
+		fmt.Printf("[Export] Failed to create %s: %v\n", s.config.Dir, err)
+	}
+
+	var pending []models.ExportJob
+	if err := s.db.Where("status IN ?", []string{models.ExportQueued, models.ExportRunning}).Order("id").Find(&pending).Error; err != nil {
+		fmt.Printf("[Export] Failed to load pending jobs: %v\n", err)
+	}
+
+	go func() {
+		// Jobs left over from before a restart run first, straight from the
+		// list: sending them to the queue this worker drains would block
+		// once more than exportQueueSize are pending
+		for _, job := range pending {
+			s.run(job.ID)
+		}
+		for id := range s.queue {
+			s.run(id)
+		}
+	}()
+
+	go func() {
+		for {
+			s.removeExpired(time.Now())
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// Enqueue stores a job and schedules it
+func (s *ExportService) Enqueue(job *models.ExportJob) error {
+	job.Status = models.ExportQueued
+	if err := s.db.Create(job).Error; err != nil {
+		return err
+	}
+	select {
+	case s.queue <- job.ID:
+		return nil
+	default:
+		s.finish(job.ID, "", errors.New("export queue is full, try again later"))
+		job.Status = models.ExportFailed
+		return nil
+	}
+}
+
+func (s *ExportService) run(id uint) {
+	var job models.ExportJob
+	if err := s.db.First(&job, id).Error; err != nil {
+		fmt.Printf("[Export] Job %d vanished: %v\n", id, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	// Wait for a free FFmpeg slot; live streams always win
+	var slot *TranscodeSlot
+	for {
+		var err error
+		slot, err = s.scheduler.Acquire(0, PipelineExport, exportPriority, nil, cancel)
+		if err == nil {
+			break
+		}
+		fmt.Printf("[Export] No FFmpeg slot for job %d, retrying in %s\n", id, exportRetryInterval)
+		time.Sleep(exportRetryInterval)
+	}
+	defer slot.Release()
+
+	now := time.Now()
+	s.db.Model(&job).Updates(map[string]interface{}{"status": models.ExportRunning, "started_at": now})
+
+	name := fmt.Sprintf("export-%d-%s", job.ID, job.From.UTC().Format("20060102T150405"))
+	var output string
+	var err error
+	switch job.Kind {
+	case models.ExportComposite:
+		output = filepath.Join(s.config.Dir, name+".mp4")
+		err = s.renderComposite(ctx, &job, output)
+	case models.ExportSpeed:
+		name += fmt.Sprintf("-%gx", job.Speed)
+		if job.Format == models.ExportHLS {
+			if err = os.MkdirAll(filepath.Join(s.config.Dir, name), 0o755); err == nil {
+				output = filepath.Join(s.config.Dir, name, "index.m3u8")
+				err = s.renderSpeed(ctx, &job, output)
+			}
+		} else {
+			output = filepath.Join(s.config.Dir, name+".mp4")
+			err = s.renderSpeed(ctx, &job, output)
+		}
+	case models.ExportClip:
+		output = filepath.Join(s.config.Dir, name+"-clip.mp4")
+		err = s.renderClip(ctx, &job, output)
+	default:
+		err = fmt.Errorf("unknown export kind %q", job.Kind)
+	}
+	if err != nil {
+		removeExportFile(output, job.Format)
+		if ctx.Err() == context.Canceled {
+			err = errors.New("stopped to free FFmpeg capacity for live streams")
+		}
+		fmt.Printf("[Export] Job %d failed: %v\n", id, err)
+	}
+	s.finish(id, output, err)
+}
+
+// finish records the outcome of a job
+func (s *ExportService) finish(id uint, output string, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{"finished_at": now}
+	if err != nil {
+		updates["status"] = models.ExportFailed
+		updates["error"] = err.Error()
+	} else {
+		updates["status"] = models.ExportCompleted
+		updates["file_path"] = output
+		updates["expires_at"] = now.Add(s.config.TTL)
+		if info, statErr := os.Stat(output); statErr == nil {
+			updates["size_bytes"] = info.Size()
+		}
+	}
+	if err := s.db.Model(&models.ExportJob{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		fmt.Printf("[Export] Failed to update job %d: %v\n", id, err)
+	}
+}
+
+// renderComposite renders up to four cameras as a 2x2 grid over the job's
+// time range, each tile on its own timeline so the tiles stay in sync; the
+// recording time is burnt in at the bottom.
+func (s *ExportService) renderComposite(ctx context.Context, job *models.ExportJob, output string) error {
+	cameraIDs := job.Cameras()
+	var cameras []models.Camera
+	if err := s.db.Unscoped().Where("id IN ?", cameraIDs).Find(&cameras).Error; err != nil {
+		return err
+	}
+	names := make(map[uint]string, len(cameras))
+	for _, camera := range cameras {
+		names[camera.ID] = camera.Name
+	}
+
+	recordings, err := s.recordingsIn(cameraIDs, job.From, job.To)
+	if err != nil {
+		return err
+	}
+
+	duration := job.To.Sub(job.From).Seconds()
+	var args []string
+	var filters []string
+	input := 0
+	for tile := 0; tile < compositeTiles; tile++ {
+		if tile >= len(cameraIDs) {
+			filters = append(filters, fmt.Sprintf("color=c=black:s=%dx%d:r=%d:d=%.3f[tile%d]",
+				compositeTileWidth, compositeTileHeight, compositeFPS, duration, tile))
+			continue
+		}
+		label := fmt.Sprintf("t%d", tile)
+		tileArgs, tileFilters, next := timeline(recordings, cameraIDs[tile], job.From, job.To,
+			compositeTileWidth, compositeTileHeight, compositeFPS, input, label, nil)
+		args = append(args, tileArgs...)
+		filters = append(filters, tileFilters...)
+		filters = append(filters, fmt.Sprintf("[%s]drawtext=text='%s':x=8:y=8:fontsize=20:fontcolor=white:box=1:boxcolor=black@0.5[tile%d]",
+			label, drawtextSafe(names[cameraIDs[tile]]), tile))
+		input = next
+	}
+	filters = append(filters, "[tile0][tile1][tile2][tile3]xstack=inputs=4:layout=0_0|w0_0|0_h0|w0_h0,"+clockFilter(job.From)+"[out]")
+
+	args = append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", "[out]",
+		"-t", fmt.Sprintf("%.3f", duration),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		"-y", output)
+	return runFFmpeg(ctx, args)
+}
+
+// renderSpeed renders one camera's time range played back at the job's
+// speed, small enough for low-power clients: the timeline is built at
+// speedSourceFPS, the clock burnt in, then retimed and thinned to speedFPS.
+// From speedKeyframesOnly up only keyframes are decoded, which is all a
+// frame every few source seconds needs. Audio is dropped.
+func (s *ExportService) renderSpeed(ctx context.Context, job *models.ExportJob, output string) error {
+	cameraIDs := job.Cameras()
+	if len(cameraIDs) != 1 {
+		return errors.New("speed export needs exactly one camera")
+	}
+	recordings, err := s.recordingsIn(cameraIDs, job.From, job.To)
+	if err != nil {
+		return err
+	}
+
+	var inputOptions []string
+	if job.Speed >= speedKeyframesOnly {
+		inputOptions = []string{"-skip_frame", "nokey"}
+	}
+	args, filters, _ := timeline(recordings, cameraIDs[0], job.From, job.To,
+		speedWidth, speedHeight, speedSourceFPS, 0, "v", inputOptions)
+	filters = append(filters, fmt.Sprintf("[v]%s,setpts=PTS/%g,fps=%d[out]", clockFilter(job.From), job.Speed, speedFPS))
+
+	args = append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", "[out]",
+		"-t", fmt.Sprintf("%.3f", job.To.Sub(job.From).Seconds()/job.Speed),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "26", "-pix_fmt", "yuv420p",
+		"-profile:v", "baseline", "-level", "3.1")
+	if job.Format == models.ExportHLS {
+		args = append(args,
+			"-g", fmt.Sprint(speedFPS*speedHLSSegmentSeconds), "-sc_threshold", "0",
+			"-f", "hls", "-hls_time", fmt.Sprint(speedHLSSegmentSeconds), "-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(filepath.Dir(output), "segment%05d.ts"))
+	} else {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, "-y", output)
+	return runFFmpeg(ctx, args)
+}
+
+// renderClip cuts one camera's recordings between the job's times into a
+// single MP4 without re-encoding, so it is fast and keeps the original
+// quality. Cuts land on the nearest keyframes and gaps between recordings
+// are left out.
+func (s *ExportService) renderClip(ctx context.Context, job *models.ExportJob, output string) error {
+	cameraIDs := job.Cameras()
+	if len(cameraIDs) != 1 {
+		return errors.New("clip export needs exactly one camera")
+	}
+	recordings, err := s.recordingsIn(cameraIDs, job.From, job.To)
+	if err != nil {
+		return err
+	}
+
+	// Concat demuxer list with in/out points per recording
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+	pieces := 0
+	for _, recording := range recordings {
+		if recording.EndTime == nil {
+			continue // Still being written
+		}
+		start, end := recording.StartTime, *recording.EndTime
+		if start.Before(job.From) {
+			start = job.From
+		}
+		if end.After(job.To) {
+			end = job.To
+		}
+		if !end.After(start) {
+			continue
+		}
+		path, err := filepath.Abs(recording.FilePath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&list, "file '%s'\ninpoint %.3f\noutpoint %.3f\n",
+			strings.ReplaceAll(path, "'", `'\''`),
+			start.Sub(recording.StartTime).Seconds(), end.Sub(recording.StartTime).Seconds())
+		pieces++
+	}
+	if pieces == 0 {
+		return errors.New("no completed recordings in the requested range")
+	}
+
+	listPath := output + ".txt"
+	if err := os.WriteFile(listPath, []byte(list.String()), 0o644); err != nil {
+		return err
+	}
+	defer os.Remove(listPath)
+
+	return runFFmpeg(ctx, []string{
+		"-f", "concat", "-safe", "0", "-i", listPath,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c", "copy",
+		"-movflags", "+faststart",
+		"-y", output,
+	})
+}
+
+// recordingsIn returns the usable recordings of the cameras overlapping
+// [from, to), oldest first
+func (s *ExportService) recordingsIn(cameraIDs []uint, from, to time.Time) ([]models.Recording, error) {
+	var recordings []models.Recording
+	err := s.db.Where("camera_id IN ? AND start_time < ? AND (end_time IS NULL OR end_time > ?) AND status NOT IN ?",
+		cameraIDs, to, from, []string{"failed", "quarantined"}).
+		Order("start_time").Find(&recordings).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(recordings) == 0 {
+		return nil, errors.New("no recordings in the requested range")
+	}
+	return recordings, nil
+}
+
+// timeline builds the filters laying one camera's recordings over [from,
+// to) on a black canvas: every recording is placed at its offset from
+// from, so gaps stay black and the output time maps back to the recording
+// time. Inputs are numbered from input, each preceded by inputOptions; the
+// filters end in label. Returns the input args, the filters and the next
+// free input number.
+func timeline(recordings []models.Recording, cameraID uint, from, to time.Time, width, height, fps, input int, label string, inputOptions []string) ([]string, []string, int) {
+	var args []string
+	base := label + "_0"
+	filters := []string{fmt.Sprintf("color=c=black:s=%dx%d:r=%d:d=%.3f[%s]", width, height, fps, to.Sub(from).Seconds(), base)}
+
+	step := 0
+	for _, recording := range recordings {
+		if recording.CameraID != cameraID {
+			continue
+		}
+		start, end := recording.StartTime, time.Now()
+		if recording.EndTime != nil {
+			end = *recording.EndTime
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		args = append(args, inputOptions...)
+		args = append(args,
+			"-ss", fmt.Sprintf("%.3f", start.Sub(recording.StartTime).Seconds()),
+			"-t", fmt.Sprintf("%.3f", end.Sub(start).Seconds()),
+			"-i", recording.FilePath)
+		next := fmt.Sprintf("%s_%d", label, step+1)
+		filters = append(filters,
+			fmt.Sprintf("[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setpts=PTS-STARTPTS+%.3f/TB[v%d]",
+				input, width, height, width, height, start.Sub(from).Seconds(), input),
+			fmt.Sprintf("[%s][v%d]overlay=eof_action=pass[%s]", base, input, next))
+		base = next
+		input++
+		step++
+	}
+	filters = append(filters, fmt.Sprintf("[%s]null[%s]", base, label))
+	return args, filters, input
+}
+
+// clockFilter burns in the UTC recording time of a timeline starting at from
+func clockFilter(from time.Time) string {
+	return fmt.Sprintf("drawtext=text='%%{pts\\:gmtime\\:%d} UTC':x=(w-tw)/2:y=h-th-12:fontsize=24:fontcolor=white:box=1:boxcolor=black@0.5",
+		from.Unix())
+}
+
+func runFFmpeg(ctx context.Context, args []string) error {
+	cmd := FFmpegCommandContext(ctx, append([]string{"-loglevel", "error"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("ffmpeg: %v: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
+
+// drawtextSafe strips characters that would need escaping in a drawtext text
+func drawtextSafe(text string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`'\:%,;[]`, r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// removeExpired deletes the files of expired exports
+func (s *ExportService) removeExpired(now time.Time) {
+	var jobs []models.ExportJob
+	if err := s.db.Where("status = ? AND expires_at < ? AND file_path <> ''", models.ExportCompleted, now).Find(&jobs).Error; err != nil {
+		fmt.Printf("[Export] Failed to load expired jobs: %v\n", err)
+		return
+	}
+	for _, job := range jobs {
+		if err := removeExportFile(job.FilePath, job.Format); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[Export] Failed to remove %s: %v\n", job.FilePath, err)
+			continue
+		}
+		s.db.Model(&job).Update("file_path", "")
+	}
+}
+
+// removeExportFile deletes an export's file, or its directory for HLS
+func removeExportFile(path, format string) error {
+	if path == "" {
+		return nil
+	}
+	if format == models.ExportHLS {
+		return os.RemoveAll(filepath.Dir(path))
+	}
+	return os.Remove(path)
+}
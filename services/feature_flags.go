@@ -0,0 +1,238 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrFeatureDisabled is returned for work a feature flag turned off at the
+// camera's site
+var ErrFeatureDisabled = errors.New("feature is disabled for this site")
+
+// Feature is a subsystem that can be switched per site
+type Feature struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"` // Whether it is on before any flag is set
+}
+
+// features are the flags admins can set. They default to on, as they were
+// before flags existed.
+var features = []Feature{
+	{Key: models.FeatureWebRTC, Description: "WebRTC and WHEP live streams", Default: true},
+	{Key: models.FeatureAnalytics, Description: "Motion, tamper and image quality detection", Default: true},
+	{Key: models.FeatureRecording, Description: "Scheduled and on-demand recording", Default: true},
+}
+
+// FeatureFlagStatus is a feature with its deployment-wide setting and the
+// sites overriding it
+type FeatureFlagStatus struct {
+	Feature
+	Enabled bool            `json:"enabled"`
+	Sites   map[string]bool `json:"sites"` // Site (camera area) -> enabled
+}
+
+// FeatureFlagService keeps the feature flags in memory, as stream requests
+// and workers consult them for every camera. Flags are re-read every
+// FEATURE_FLAGS_REFRESH_INTERVAL so a change made through another instance
+// applies everywhere.
+type FeatureFlagService struct {
+	config    config.FeatureFlagsConfig
+	db        *gorm.DB
+	onDisable map[string][]func(cameraID uint)
+	loadMu    sync.Mutex // One Load at a time, so an older read can't replace a newer one
+
+	mu    sync.RWMutex
+	flags map[string]map[string]bool // Key -> site ("" = every site) -> enabled; nil until loaded
+}
+
+func NewFeatureFlagService(cfg config.FeatureFlagsConfig, db *gorm.DB) *FeatureFlagService {
+	return &FeatureFlagService{
+		config:    cfg,
+		db:        db,
+		onDisable: make(map[string][]func(cameraID uint)),
+	}
+}
+
+// OnDisable registers fn to run for every camera a feature gets turned off
+// for, e.g. to end its running streams; register before Start
+func (s *FeatureFlagService) OnDisable(key string, fn func(cameraID uint)) {
+	s.onDisable[key] = append(s.onDisable[key], fn)
+}
+
+// Start re-reads the flags every refresh interval
+func (s *FeatureFlagService) Start() {
+	if s.config.RefreshInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.Load(); err != nil {
+				fmt.Printf("[Features] Failed to reload feature flags: %v\n", err)
+			}
+		}
+	}()
+}
+
+// Load reads the flags and runs the OnDisable callbacks of the cameras a
+// feature was turned off for since the last load
+func (s *FeatureFlagService) Load() error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	var rows []models.FeatureFlag
+	if err := s.db.Find(&rows).Error; err != nil {
+		return err
+	}
+	flags := make(map[string]map[string]bool)
+	for _, row := range rows {
+		if flags[row.Key] == nil {
+			flags[row.Key] = make(map[string]bool)
+		}
+		flags[row.Key][row.Site] = row.Enabled
+	}
+
+	s.mu.Lock()
+	previous := s.flags
+	s.flags = flags
+	s.mu.Unlock()
+	if previous == nil {
+		return nil // Nothing runs yet on the first load
+	}
+
+	for key, callbacks := range s.onDisable {
+		if !flagsChanged(previous[key], flags[key]) {
+			continue
+		}
+		var cameras []models.Camera
+		if err := s.db.Select("id", "area").Find(&cameras).Error; err != nil {
+			fmt.Printf("[Features] Failed to load cameras to apply %s: %v\n", key, err)
+			continue
+		}
+		for _, camera := range cameras {
+			if !featureEnabled(previous, key, camera.Area) || featureEnabled(flags, key, camera.Area) {
+				continue
+			}
+			for _, fn := range callbacks {
+				fn(camera.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether a feature is on at a site: the site's own flag,
+// else the deployment-wide one, else the feature's default
+func (s *FeatureFlagService) Enabled(key, site string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return featureEnabled(s.flags, key, site)
+}
+
+// EnabledFor reports whether a feature is on at a camera's site
+func (s *FeatureFlagService) EnabledFor(key string, camera *models.Camera) bool {
+	return s.Enabled(key, camera.Area)
+}
+
+// Feature returns a feature by key
+func (s *FeatureFlagService) Feature(key string) (Feature, bool) {
+	for _, feature := range features {
+		if feature.Key == key {
+			return feature, true
+		}
+	}
+	return Feature{}, false
+}
+
+// List returns every feature with its flags
+func (s *FeatureFlagService) List() []FeatureFlagStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statuses := make([]FeatureFlagStatus, len(features))
+	for i, feature := range features {
+		sites := make(map[string]bool)
+		for site, enabled := range s.flags[feature.Key] {
+			if site != "" {
+				sites[site] = enabled
+			}
+		}
+		statuses[i] = FeatureFlagStatus{Feature: feature, Enabled: featureEnabled(s.flags, feature.Key, ""), Sites: sites}
+	}
+	return statuses
+}
+
+// ForSite returns whether each feature is on at a site, "" for the
+// deployment-wide settings
+func (s *FeatureFlagService) ForSite(site string) map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	enabled := make(map[string]bool, len(features))
+	for _, feature := range features {
+		enabled[feature.Key] = featureEnabled(s.flags, feature.Key, site)
+	}
+	return enabled
+}
+
+// Set turns a feature on or off at a site, or everywhere for "", and
+// applies it on this instance right away
+func (s *FeatureFlagService) Set(key, site string, enabled bool) error {
+	flag := models.FeatureFlag{Key: key, Site: site, Enabled: enabled}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}, {Name: "site"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&flag).Error; err != nil {
+		return err
+	}
+	return s.Load()
+}
+
+// ClearSite removes a site's own flag so the deployment-wide one applies
+// there again; false when the site had none
+func (s *FeatureFlagService) ClearSite(key, site string) (bool, error) {
+	result := s.db.Where("key = ? AND site = ?", key, site).Delete(&models.FeatureFlag{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	return true, s.Load()
+}
+
+func featureEnabled(flags map[string]map[string]bool, key, site string) bool {
+	if enabled, ok := flags[key][site]; ok {
+		return enabled
+	}
+	if enabled, ok := flags[key][""]; ok {
+		return enabled
+	}
+	for _, feature := range features {
+		if feature.Key == key {
+			return feature.Default
+		}
+	}
+	return false
+}
+
+func flagsChanged(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for site, enabled := range a {
+		if other, ok := b[site]; !ok || other != enabled {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"command-center-vms-cctv/be/config"
+)
+
+// ffmpegSandbox is how the backend runs FFmpeg, set once at startup by
+// ConfigureFFmpeg
+var ffmpegSandbox = struct {
+	path string
+	nice int
+	mu   sync.RWMutex
+}{path: "ffmpeg"}
+
+// ConfigureFFmpeg sets the FFmpeg binary and the limits every FFmpeg the
+// backend starts runs under: a lower scheduling priority and, on Linux, a
+// restricted user and a cgroup capping the CPU and memory of all of them
+// together, so a runaway encode can't take the host down with it. Limits
+// that can't be applied are logged and skipped.
+func ConfigureFFmpeg(cfg config.FFmpegConfig) {
+	path := cfg.Path
+	if path == "" {
+		path = "ffmpeg"
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		fmt.Printf("[FFmpeg] %s not found, streams, recordings and analytics will fail: %v\n", path, err)
+	}
+	nice := cfg.Nice
+	if nice < 0 || nice > 19 {
+		fmt.Printf("[FFmpeg] Ignoring FFMPEG_NICE=%d, must be 0-19\n", nice)
+		nice = 0
+	}
+
+	ffmpegSandbox.mu.Lock()
+	ffmpegSandbox.path = path
+	ffmpegSandbox.nice = nice
+	ffmpegSandbox.mu.Unlock()
+
+	configureFFmpegIsolation(cfg)
+	configureStreamLogs(cfg.LogLines)
+}
+
+// FFmpegPath returns the configured FFmpeg binary
+func FFmpegPath() string {
+	ffmpegSandbox.mu.RLock()
+	defer ffmpegSandbox.mu.RUnlock()
+	return ffmpegSandbox.path
+}
+
+// FFmpegCommand is exec.Command for FFmpeg, with the configured binary and
+// limits applied
+func FFmpegCommand(args ...string) *exec.Cmd {
+	return FFmpegCommandContext(context.Background(), args...)
+}
+
+// FFmpegCommandContext is exec.CommandContext for FFmpeg, with the
+// configured binary and limits applied
+func FFmpegCommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	ffmpegSandbox.mu.RLock()
+	path, nice := ffmpegSandbox.path, ffmpegSandbox.nice
+	ffmpegSandbox.mu.RUnlock()
+
+	name, argv := path, args
+	if delay := injectedRTSPDelay(); delay > 0 && readsRTSP(args) {
+		// Injected by ChaosService: FFmpeg connects to the camera that much
+		// later. sh execs FFmpeg in place, like nice below.
+		name = "sh"
+		argv = append([]string{"-c", `sleep "$0" && exec "$@"`, fmt.Sprintf("%.3f", delay.Seconds()), path}, args...)
+	}
+
+	var cmd *exec.Cmd
+	if nice > 0 {
+		// nice execs FFmpeg in place, so the PID stays FFmpeg's for usage
+		// accounting and kills
+		cmd = exec.CommandContext(ctx, "nice", append([]string{"-n", strconv.Itoa(nice), name}, argv...)...)
+	} else {
+		cmd = exec.CommandContext(ctx, name, argv...)
+	}
+	isolateFFmpeg(cmd)
+	return cmd
+}
+
+// readsRTSP reports whether FFmpeg arguments have an RTSP input
+func readsRTSP(args []string) bool {
+	for i := 1; i < len(args); i++ {
+		if args[i-1] == "-i" && (strings.HasPrefix(args[i], "rtsp://") || strings.HasPrefix(args[i], "rtsps://")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+//go:build linux
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"command-center-vms-cctv/be/config"
+)
+
+const cgroupCPUPeriod = 100000 // Microseconds, the kernel default
+
+var ffmpegIsolation struct {
+	credential *syscall.Credential // Restricted user, nil to keep the backend's
+	cgroup     *os.File            // cgroup v2 directory FFmpeg starts in, nil for none
+	mu         sync.RWMutex
+}
+
+// configureFFmpegIsolation resolves the restricted user and prepares the
+// FFmpeg cgroup
+func configureFFmpegIsolation(cfg config.FFmpegConfig) {
+	var credential *syscall.Credential
+	if cfg.User != "" {
+		credential = lookupFFmpegUser(cfg.User)
+	}
+
+	var cgroup *os.File
+	if cfg.Cgroup != "" {
+		dir, err := setupFFmpegCgroup(cfg)
+		if err != nil {
+			fmt.Printf("[FFmpeg] cgroup %s unavailable, FFmpeg runs without CPU/memory caps: %v\n", cfg.Cgroup, err)
+		} else {
+			cgroup = dir
+			fmt.Printf("[FFmpeg] Running FFmpeg in cgroup %s (cpu %.2f cores, memory %d MB; 0 = unlimited)\n", cfg.Cgroup, cfg.CPULimit, cfg.MemoryLimitMB)
+		}
+	}
+
+	ffmpegIsolation.mu.Lock()
+	defer ffmpegIsolation.mu.Unlock()
+	if ffmpegIsolation.cgroup != nil {
+		ffmpegIsolation.cgroup.Close()
+	}
+	ffmpegIsolation.credential = credential
+	ffmpegIsolation.cgroup = cgroup
+}
+
+// isolateFFmpeg makes cmd start as the restricted user inside the cgroup.
+// Joining the cgroup at clone time means FFmpeg never runs uncapped.
+func isolateFFmpeg(cmd *exec.Cmd) {
+	ffmpegIsolation.mu.RLock()
+	defer ffmpegIsolation.mu.RUnlock()
+
+	if ffmpegIsolation.credential == nil && ffmpegIsolation.cgroup == nil {
+		return
+	}
+	attr := &syscall.SysProcAttr{Credential: ffmpegIsolation.credential}
+	if ffmpegIsolation.cgroup != nil {
+		attr.UseCgroupFD = true
+		attr.CgroupFD = int(ffmpegIsolation.cgroup.Fd())
+	}
+	cmd.SysProcAttr = attr
+}
+
+func lookupFFmpegUser(name string) *syscall.Credential {
+	if os.Geteuid() != 0 {
+		fmt.Printf("[FFmpeg] FFMPEG_USER=%s needs the backend to run as root, FFmpeg runs as the backend's user\n", name)
+		return nil
+	}
+	account, err := user.Lookup(name)
+	if err != nil {
+		fmt.Printf("[FFmpeg] FFMPEG_USER=%s: %v, FFmpeg runs as the backend's user\n", name, err)
+		return nil
+	}
+	uid, uidErr := strconv.ParseUint(account.Uid, 10, 32)
+	gid, gidErr := strconv.ParseUint(account.Gid, 10, 32)
+	if uidErr != nil || gidErr != nil {
+		fmt.Printf("[FFmpeg] FFMPEG_USER=%s has no numeric uid/gid, FFmpeg runs as the backend's user\n", name)
+		return nil
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), NoSetGroups: true}
+}
+
+// setupFFmpegCgroup creates the cgroup, enables the cpu and memory
+// controllers for it and writes the caps
+func setupFFmpegCgroup(cfg config.FFmpegConfig) (*os.File, error) {
+	if err := os.MkdirAll(cfg.Cgroup, 0755); err != nil {
+		return nil, err
+	}
+	// Delegation may already be set up by the host, a failure here shows up
+	// below when the caps can't be written
+	os.WriteFile(filepath.Join(filepath.Dir(cfg.Cgroup), "cgroup.subtree_control"), []byte("+cpu +memory"), 0644)
+
+	cpuMax := "max"
+	if cfg.CPULimit > 0 {
+		cpuMax = strconv.Itoa(int(cfg.CPULimit * cgroupCPUPeriod))
+	}
+	if err := os.WriteFile(filepath.Join(cfg.Cgroup, "cpu.max"), []byte(fmt.Sprintf("%s %d", cpuMax, cgroupCPUPeriod)), 0644); err != nil {
+		return nil, fmt.Errorf("set cpu.max: %w", err)
+	}
+	memoryMax := "max"
+	if cfg.MemoryLimitMB > 0 {
+		memoryMax = strconv.FormatInt(int64(cfg.MemoryLimitMB)<<20, 10)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.Cgroup, "memory.max"), []byte(memoryMax), 0644); err != nil {
+		return nil, fmt.Errorf("set memory.max: %w", err)
+	}
+
+	return os.Open(cfg.Cgroup)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package services
+
+import (
+	"fmt"
+	"os/exec"
+
+	"command-center-vms-cctv/be/config"
+)
+
+func configureFFmpegIsolation(cfg config.FFmpegConfig) {
+	if cfg.User != "" || cfg.Cgroup != "" {
+		fmt.Printf("[FFmpeg] FFMPEG_USER and FFMPEG_CGROUP are only supported on Linux, ignoring them\n")
+	}
+}
+
+func isolateFFmpeg(cmd *exec.Cmd) {}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+const (
+	gcpSecretManagerURL = "https://secretmanager.googleapis.com/v1"
+	gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// gcpSecretsClient reads secrets from Google Cloud Secret Manager as the
+// service account of the VM or GKE workload, whose access token comes from
+// the metadata server. Like vaultClient it is only used by the SecretStore's
+// refresh loop, one call at a time.
+type gcpSecretsClient struct {
+	config     config.SecretsConfig
+	httpClient *http.Client
+
+	token        string
+	tokenRenewAt time.Time
+}
+
+func newGCPSecretsClient(cfg config.SecretsConfig) (*gcpSecretsClient, error) {
+	if cfg.GCPProject == "" {
+		return nil, fmt.Errorf("SECRETS_GCP_PROJECT is required with SECRETS_PROVIDER=gcp")
+	}
+	return &gcpSecretsClient{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: vaultTimeout},
+	}, nil
+}
+
+// ensureToken gets a new access token once half of the current one's
+// lifetime is used
+func (g *gcpSecretsClient) ensureToken(now time.Time) error {
+	if g.token != "" && now.Before(g.tokenRenewAt) {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("metadata server token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("metadata server token (status %d): %s", resp.StatusCode, body)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // Seconds
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("metadata server token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return fmt.Errorf("metadata server returned no access token")
+	}
+	g.token = token.AccessToken
+	g.tokenRenewAt = now.Add(time.Duration(token.ExpiresIn) * time.Second / 2)
+	return nil
+}
+
+// readSecrets reads the latest version of each secret named
+// SECRETS_GCP_PREFIX + name; secrets that don't exist are left out
+func (g *gcpSecretsClient) readSecrets(now time.Time, names []string) (map[string]string, error) {
+	if err := g.ensureToken(now); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, name := range names {
+		value, found, err := g.access(g.config.GCPPrefix + name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if found {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+func (g *gcpSecretsClient) access(secretID string) (string, bool, error) {
+	endpoint := fmt.Sprintf("%s/projects/%s/secrets/%s/versions/latest:access",
+		gcpSecretManagerURL, url.PathEscape(g.config.GCPProject), url.PathEscape(secretID))
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", false, fmt.Errorf("Secret Manager error (status %d): %s", resp.StatusCode, body)
+	}
+	var version struct {
+		Payload struct {
+			Data string `json:"data"` // base64
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", false, err
+	}
+	data, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid payload: %w", err)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
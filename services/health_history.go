@@ -0,0 +1,442 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// Camera reliability classes reported by HealthHistoryService
+const (
+	ReliabilityOK       = "ok"
+	ReliabilityDown     = "down"     // Unhealthy right now
+	ReliabilityFlapping = "flapping" // Many up/down transitions in the last 24h
+	ReliabilityChronic  = "chronic"  // Flapping on many days over the last two weeks
+)
+
+const (
+	healthCheckWorkers  = 8
+	healthCheckTimeout  = 5 * time.Second
+	healthRecentChecks  = 60 // Checks kept in memory per camera
+	healthRetention     = 30 * 24 * time.Hour
+	statusRetention     = 90 * 24 * time.Hour // Camera status changes are kept longer, they are rarer
+	flapDailyThreshold  = 6                   // Transitions in a day that count as flapping
+	chronicWindowDays   = 14                  // Days looked at for chronic flapping
+	chronicFlappingDays = 5                   // Flapping days within the window that make it chronic
+	flapRateWindow      = 7 * 24 * time.Hour
+)
+
+// HealthCheck is one health check result
+type HealthCheck struct {
+	At      time.Time `json:"at"`
+	Healthy bool      `json:"healthy"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// HealthSummary is a camera's current health and how reliable it has been
+type HealthSummary struct {
+	CameraID     uint      `json:"camera_id"`
+	Healthy      bool      `json:"healthy"`
+	Since        time.Time `json:"since"` // Last transition
+	Reliability  string    `json:"reliability"`
+	FlapRate24h  int       `json:"flap_rate_24h"` // Transitions in the last 24h
+	FlapRate7d   float64   `json:"flap_rate_7d"`  // Average transitions per day over 7 days
+	FlappingDays int       `json:"flapping_days"` // Days with >= flapDailyThreshold transitions in the last 14
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+type cameraHealth struct {
+	healthy bool
+	since   time.Time
+	known   bool
+	recent  []HealthCheck
+}
+
+// HealthHistoryService probes every camera over RTSP on a schedule (MediaMTX
+// paths are on-demand, so their readiness says nothing about idle cameras),
+// stores up/down transitions and classifies cameras by how often they flap.
+// Transitions are recorded as offline/online events and a camera starting
+// to flap as a health event, so alert rules can act on them. A camera
+// MediaMTX is already pulling counts as up without opening another session.
+// Each check also keeps Camera.Status online/offline for cameras in a
+// monitored status, recording every change as a CameraStatusEvent.
+type HealthHistoryService struct {
+	db        *gorm.DB
+	ingest    *IngestService
+	events    *EventService
+	feed      *LiveFeed
+	statuses  *CameraStatusService
+	interval  time.Duration
+	cameras   map[uint]*cameraHealth
+	summaries map[uint]HealthSummary
+	mu        sync.RWMutex
+}
+
+func NewHealthHistoryService(cfg config.HealthConfig, db *gorm.DB, ingest *IngestService, events *EventService, feed *LiveFeed, statuses *CameraStatusService) *HealthHistoryService {
+	return &HealthHistoryService{
+		db:        db,
+		ingest:    ingest,
+		events:    events,
+		feed:      feed,
+		statuses:  statuses,
+		interval:  cfg.CheckInterval,
+		cameras:   make(map[uint]*cameraHealth),
+		summaries: make(map[uint]HealthSummary),
+	}
+}
+
+// Start loads the last known state of each camera and runs the checks
+func (s *HealthHistoryService) Start() {
+	if s.interval <= 0 {
+		return
+	}
+	s.loadLastState()
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.checkAll()
+			s.summarize()
+			s.prune()
+			<-ticker.C
+		}
+	}()
+}
+
+// loadLastState restores the latest transition per camera so a restart
+// doesn't look like every camera changing state
+func (s *HealthHistoryService) loadLastState() {
+	var latest []models.StreamHealthChange
+	if err := s.db.Raw(`SELECT DISTINCT ON (camera_id) * FROM stream_health_changes
+		ORDER BY camera_id, changed_at DESC, id DESC`).Scan(&latest).Error; err != nil {
+		fmt.Printf("[Health] Failed to load last health state: %v\n", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, change := range latest {
+		s.cameras[change.CameraID] = &cameraHealth{healthy: change.Healthy, since: change.ChangedAt, known: true}
+	}
+}
+
+func (s *HealthHistoryService) checkAll() {
+	var cameras []models.Camera
+	if err := s.db.Select("id", "rtsp_url", "credential_id", "status").Find(&cameras).Error; err != nil {
+		fmt.Printf("[Health] Failed to load cameras: %v\n", err)
+		return
+	}
+
+	// Forget deleted cameras
+	existing := make(map[uint]bool, len(cameras))
+	for _, camera := range cameras {
+		existing[camera.ID] = true
+	}
+	s.mu.Lock()
+	for cameraID := range s.cameras {
+		if !existing[cameraID] {
+			delete(s.cameras, cameraID)
+		}
+	}
+	s.mu.Unlock()
+
+	jobs := make(chan *models.Camera)
+	var wg sync.WaitGroup
+	for i := 0; i < healthCheckWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for camera := range jobs {
+				s.check(camera)
+			}
+		}()
+	}
+	for i := range cameras {
+		jobs <- &cameras[i]
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// check probes one camera and records a transition when its state changed
+func (s *HealthHistoryService) check(camera *models.Camera) {
+	result := HealthCheck{At: time.Now(), Healthy: true}
+	if !s.ingest.Pulling(camera.ID) {
+		if _, probeErr := ProbeRTSP(s.ingest.DirectURL(camera), healthCheckTimeout); probeErr != nil {
+			result.Healthy = false
+			result.Reason = string(probeErr.Reason)
+		}
+	}
+
+	s.mu.Lock()
+	state, exists := s.cameras[camera.ID]
+	if !exists {
+		state = &cameraHealth{}
+		s.cameras[camera.ID] = state
+	}
+	state.recent = append(state.recent, result)
+	if len(state.recent) > healthRecentChecks {
+		state.recent = state.recent[len(state.recent)-healthRecentChecks:]
+	}
+	changed := !state.known || state.healthy != result.Healthy
+	initial := !state.known
+	if changed {
+		state.healthy, state.since, state.known = result.Healthy, result.At, true
+	}
+	s.mu.Unlock()
+
+	s.updateStatus(camera, result)
+	if !changed {
+		return
+	}
+	change := models.StreamHealthChange{
+		CameraID:  camera.ID,
+		Healthy:   result.Healthy,
+		Reason:    result.Reason,
+		Initial:   initial,
+		ChangedAt: result.At,
+	}
+	if err := s.db.Create(&change).Error; err != nil {
+		fmt.Printf("[Health] Failed to record health change for camera %d: %v\n", camera.ID, err)
+	}
+	if initial {
+		return
+	}
+	s.feed.Publish(LiveStreamHealth, camera.ID, LiveHealthChange{Healthy: result.Healthy, Reason: result.Reason})
+
+	cameraID := camera.ID
+	event := &models.Event{
+		CameraID:    &cameraID,
+		Type:        "online",
+		Source:      "health_check",
+		Description: "Camera stream is back",
+		OccurredAt:  result.At,
+	}
+	if !result.Healthy {
+		event.Type = "offline"
+		event.Severity = "warning"
+		event.Description = "Camera stream is down: " + result.Reason
+	}
+	s.events.Record(event, nil)
+}
+
+// updateStatus moves Camera.Status to match a check. Compared with the
+// stored status rather than the previous check, so online or offline set by
+// hand is corrected on the next check. Cameras in an unmonitored status
+// (awaiting install, decommissioned, ...) keep it.
+func (s *HealthHistoryService) updateStatus(camera *models.Camera, result HealthCheck) {
+	status := models.CameraStatusOnline
+	if !result.Healthy {
+		status = models.CameraStatusOffline
+	}
+	if camera.Status == status || !s.statuses.Monitored(camera.Status) {
+		return
+	}
+
+	query := s.db.Model(&models.Camera{}).Where("id = ? AND status IS DISTINCT FROM ?", camera.ID, status)
+	// The camera may have been moved to an unmonitored status since it was loaded
+	if unmonitored := s.statuses.Unmonitored(); len(unmonitored) > 0 {
+		query = query.Where("status NOT IN ?", unmonitored)
+	}
+	updated := query.Update("status", status)
+	if updated.Error != nil {
+		fmt.Printf("[Health] Failed to update status of camera %d: %v\n", camera.ID, updated.Error)
+		return
+	}
+	if updated.RowsAffected == 0 {
+		return
+	}
+	s.RecordStatusChange(&models.CameraStatusEvent{
+		CameraID:   camera.ID,
+		FromStatus: camera.Status,
+		ToStatus:   status,
+		Source:     models.StatusSourceHealthCheck,
+		Reason:     result.Reason,
+		ChangedAt:  result.At,
+	})
+}
+
+// RecordStatusChange stores a change of Camera.Status in its history and
+// pushes it to live dashboards
+func (s *HealthHistoryService) RecordStatusChange(event *models.CameraStatusEvent) {
+	if err := s.db.Create(event).Error; err != nil {
+		fmt.Printf("[Health] Failed to record status change of camera %d: %v\n", event.CameraID, err)
+	}
+	s.feed.Publish(LiveCameraStatus, event.CameraID, LiveStatusChange{
+		FromStatus: event.FromStatus,
+		ToStatus:   event.ToStatus,
+		Source:     event.Source,
+		Reason:     event.Reason,
+	})
+}
+
+// summarize recomputes flap rates and reliability for every camera
+func (s *HealthHistoryService) summarize() {
+	now := time.Now()
+	since := now.AddDate(0, 0, -chronicWindowDays)
+
+	var rows []struct {
+		CameraID uint
+		Day      time.Time
+		Count    int
+	}
+	if err := s.db.Model(&models.StreamHealthChange{}).
+		Select("camera_id, date_trunc('day', changed_at) AS day, COUNT(*) AS count").
+		Where("changed_at >= ? AND initial = ?", since, false).
+		Group("camera_id, day").
+		Scan(&rows).Error; err != nil {
+		fmt.Printf("[Health] Failed to summarize health history: %v\n", err)
+		return
+	}
+
+	var last24h []struct {
+		CameraID uint
+		Count    int
+	}
+	if err := s.db.Model(&models.StreamHealthChange{}).
+		Select("camera_id, COUNT(*) AS count").
+		Where("changed_at >= ? AND initial = ?", now.Add(-24*time.Hour), false).
+		Group("camera_id").
+		Scan(&last24h).Error; err != nil {
+		fmt.Printf("[Health] Failed to summarize health history: %v\n", err)
+		return
+	}
+
+	flapDays := make(map[uint]int)
+	week := make(map[uint]int)
+	for _, row := range rows {
+		if row.Count >= flapDailyThreshold {
+			flapDays[row.CameraID]++
+		}
+		if now.Sub(row.Day) < flapRateWindow {
+			week[row.CameraID] += row.Count
+		}
+	}
+	day := make(map[uint]int, len(last24h))
+	for _, row := range last24h {
+		day[row.CameraID] = row.Count
+	}
+
+	s.mu.Lock()
+	var flapping []HealthSummary
+	summaries := make(map[uint]HealthSummary, len(s.cameras))
+	for cameraID, state := range s.cameras {
+		if !state.known {
+			continue
+		}
+		summary := HealthSummary{
+			CameraID:     cameraID,
+			Healthy:      state.healthy,
+			Since:        state.since,
+			FlapRate24h:  day[cameraID],
+			FlapRate7d:   float64(week[cameraID]) / 7,
+			FlappingDays: flapDays[cameraID],
+			CheckedAt:    now,
+		}
+		summary.Reliability = classifyReliability(summary)
+		summaries[cameraID] = summary
+
+		previous, known := s.summaries[cameraID]
+		if known && unreliable(summary.Reliability) && !unreliable(previous.Reliability) {
+			flapping = append(flapping, summary)
+		}
+	}
+	s.summaries = summaries
+	s.mu.Unlock()
+
+	for _, summary := range flapping {
+		cameraID := summary.CameraID
+		s.events.Record(&models.Event{
+			CameraID:    &cameraID,
+			Type:        "health",
+			Severity:    "warning",
+			Source:      "health_check",
+			Description: fmt.Sprintf("Camera is %s: %d up/down transitions in 24h", summary.Reliability, summary.FlapRate24h),
+			OccurredAt:  now,
+		}, map[string]interface{}{
+			"reliability":   summary.Reliability,
+			"flap_rate_24h": summary.FlapRate24h,
+			"flapping_days": summary.FlappingDays,
+		})
+	}
+}
+
+func unreliable(reliability string) bool {
+	return reliability == ReliabilityFlapping || reliability == ReliabilityChronic
+}
+
+// classifyReliability separates "down now" from "unreliable for weeks".
+// Chronic wins over down so a flaky camera that happens to be down still
+// stands out from one that just failed.
+func classifyReliability(summary HealthSummary) string {
+	switch {
+	case summary.FlappingDays >= chronicFlappingDays:
+		return ReliabilityChronic
+	case !summary.Healthy:
+		return ReliabilityDown
+	case summary.FlapRate24h >= flapDailyThreshold:
+		return ReliabilityFlapping
+	}
+	return ReliabilityOK
+}
+
+// prune drops health history older than healthRetention and status
+// changes older than statusRetention
+func (s *HealthHistoryService) prune() {
+	if err := s.db.Where("changed_at < ?", time.Now().Add(-healthRetention)).
+		Delete(&models.StreamHealthChange{}).Error; err != nil {
+		fmt.Printf("[Health] Failed to prune health history: %v\n", err)
+	}
+	if err := s.db.Where("changed_at < ?", time.Now().Add(-statusRetention)).
+		Delete(&models.CameraStatusEvent{}).Error; err != nil {
+		fmt.Printf("[Health] Failed to prune status history: %v\n", err)
+	}
+}
+
+// GetSummary returns a camera's health summary from the last round
+func (s *HealthHistoryService) GetSummary(cameraID uint) (HealthSummary, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	summary, exists := s.summaries[cameraID]
+	return summary, exists
+}
+
+// GetAllSummaries returns the health summary of every checked camera
+func (s *HealthHistoryService) GetAllSummaries() map[uint]HealthSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	summaries := make(map[uint]HealthSummary, len(s.summaries))
+	for cameraID, summary := range s.summaries {
+		summaries[cameraID] = summary
+	}
+	return summaries
+}
+
+// IsHealthy reports a camera's state at its last check; known is false
+// before the camera was first checked
+func (s *HealthHistoryService) IsHealthy(cameraID uint) (healthy, known bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if state, exists := s.cameras[cameraID]; exists && state.known {
+		return state.healthy, true
+	}
+	return false, false
+}
+
+// GetRecentChecks returns the latest in-memory checks of a camera, oldest first
+func (s *HealthHistoryService) GetRecentChecks(cameraID uint) []HealthCheck {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, exists := s.cameras[cameraID]
+	if !exists {
+		return []HealthCheck{}
+	}
+	return append([]HealthCheck{}, state.recent...)
+}
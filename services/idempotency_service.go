@@ -0,0 +1,111 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyService stores responses of requests made with an
+// Idempotency-Key header, see middleware.Idempotency
+type IdempotencyService struct {
+	db      *gorm.DB
+	ttl     time.Duration
+	maxBody int
+}
+
+func NewIdempotencyService(cfg config.IdempotencyConfig, db *gorm.DB) *IdempotencyService {
+	return &IdempotencyService{
+		db:      db,
+		ttl:     cfg.TTL,
+		maxBody: cfg.MaxBody,
+	}
+}
+
+// Start prunes expired keys hourly
+func (s *IdempotencyService) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := s.db.Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{}).Error; err != nil {
+				fmt.Printf("[Idempotency] Failed to prune keys: %v\n", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// MaxBody is the largest response that is stored for replay
+func (s *IdempotencyService) MaxBody() int {
+	return s.maxBody
+}
+
+// Begin claims a key for a request. When the key was already used it
+// returns the existing record (still running when Status is 0) and true.
+func (s *IdempotencyService) Begin(userID uint, route, key, requestHash string) (*models.IdempotencyKey, bool, error) {
+	record := &models.IdempotencyKey{
+		UserID:      userID,
+		Route:       route,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(s.ttl),
+	}
+	created := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if created.Error != nil {
+		return nil, false, created.Error
+	}
+	if created.RowsAffected > 0 {
+		return record, false, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := s.db.Where("user_id = ? AND route = ? AND key = ?", userID, route, key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+	if existing.ExpiresAt.Before(time.Now()) {
+		// Expired but not pruned yet: start over
+		if err := s.db.Delete(&existing).Error; err != nil {
+			return nil, false, err
+		}
+		return s.Begin(userID, route, key, requestHash)
+	}
+	return &existing, true, nil
+}
+
+// Complete stores the response of a claimed key for replay
+func (s *IdempotencyService) Complete(record *models.IdempotencyKey, status int, header http.Header, body []byte) {
+	headers, _ := json.Marshal(header)
+	if err := s.db.Model(record).Updates(map[string]interface{}{
+		"status":  status,
+		"headers": string(headers),
+		"body":    body,
+	}).Error; err != nil {
+		fmt.Printf("[Idempotency] Failed to store response for key %s: %v\n", record.Key, err)
+	}
+}
+
+// Abandon releases a claimed key without storing a response, so a retry
+// runs the request again (server errors, responses too large to store)
+func (s *IdempotencyService) Abandon(record *models.IdempotencyKey) {
+	if err := s.db.Delete(record).Error; err != nil {
+		fmt.Printf("[Idempotency] Failed to release key %s: %v\n", record.Key, err)
+	}
+}
+
+// StoredHeaders decodes the headers stored with a response
+func StoredHeaders(record *models.IdempotencyKey) http.Header {
+	header := http.Header{}
+	if record.Headers != "" {
+		json.Unmarshal([]byte(record.Headers), &header)
+	}
+	return header
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"command-center-vms-cctv/be/models"
+)
+
+// IngestService hands out the RTSP URL every backend pipeline (recorder,
+// MJPEG, WebRTC, motion, audio, tamper and quality checks) reads a camera
+// from. With MEDIAMTX_SHARED_INGEST they all read the camera's MediaMTX
+// path, so MediaMTX's pull is the only RTSP session on the camera however
+// many pipelines are running.
+type IngestService struct {
+	mediamtx *MediaMTXService
+	vault    *CredentialService
+}
+
+func NewIngestService(mediamtx *MediaMTXService, vault *CredentialService) *IngestService {
+	return &IngestService{
+		mediamtx: mediamtx,
+		vault:    vault,
+	}
+}
+
+// URL returns the RTSP URL to read the camera from
+func (s *IngestService) URL(camera *models.Camera) string {
+	return s.mediamtx.IngestURL(camera.ID, s.vault.StreamURL(camera))
+}
+
+// DirectURL returns the camera's own RTSP URL, for the rare reads that must
+// reach the camera itself, e.g. a health probe while MediaMTX isn't pulling it
+func (s *IngestService) DirectURL(camera *models.Camera) string {
+	return s.vault.StreamURL(camera)
+}
+
+// Pulling reports whether the camera is already being read through the
+// shared ingest, so its reachability is known without another connection
+func (s *IngestService) Pulling(cameraID uint) bool {
+	return s.mediamtx.config.SharedIngest && s.mediamtx.SourceReady(cameraID)
+}
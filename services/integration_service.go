@@ -0,0 +1,329 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/utils"
+
+	"gorm.io/gorm"
+)
+
+// IntegrationService receives webhooks from third-party systems and turns
+// them into events using the mapping rules stored for each integration, so
+// a new source only needs configuration, not code
+type IntegrationService struct {
+	db      *gorm.DB
+	secrets *SecretStore // Holds the key the integration secrets are encrypted with
+	events  *EventService
+}
+
+func NewIntegrationService(secrets *SecretStore, db *gorm.DB, events *EventService) *IntegrationService {
+	return &IntegrationService{
+		db:      db,
+		secrets: secrets,
+		events:  events,
+	}
+}
+
+// NewSecret generates a webhook signing secret, returning it and its
+// encrypted form for Integration.SecretEncrypted
+func (s *IntegrationService) NewSecret() (string, string, error) {
+	return newSigningSecret(s.secrets.Get(SecretCredential))
+}
+
+// newSigningSecret generates a random HMAC secret, returning it and its
+// form encrypted with the vault key
+func newSigningSecret(vaultKey string) (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := hex.EncodeToString(raw)
+	encrypted, err := utils.EncryptSecret(vaultKey, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, encrypted, nil
+}
+
+// IntegrationTimestampHeader carries the unix time a webhook was signed at
+const IntegrationTimestampHeader = "X-Signature-Timestamp"
+
+// integrationSignatureTolerance is how far a webhook's signing time may be
+// from the server's clock; older deliveries are refused as replays
+const integrationSignatureTolerance = 5 * time.Minute
+
+// Verify checks a webhook signature: the hex HMAC-SHA256, with or without a
+// "sha256=" prefix, of "<timestamp>.<body>", where timestamp is the unix
+// time in IntegrationTimestampHeader and within
+// integrationSignatureTolerance of now. The signed timestamp keeps a
+// captured delivery from being replayed later.
+func (s *IntegrationService) Verify(integration *models.Integration, body []byte, signature, timestamp string, now time.Time) bool {
+	signedAt, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := now.Sub(time.Unix(signedAt, 0)); skew > integrationSignatureTolerance || skew < -integrationSignatureTolerance {
+		return false
+	}
+	secret, err := utils.DecryptSecretAny(s.secrets.Keys(SecretCredential), integration.SecretEncrypted)
+	if err != nil {
+		fmt.Printf("[Integrations] Cannot read secret of %s: %v\n", integration.Name, err)
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", signedAt)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// Receive transforms a verified webhook body and records the resulting
+// events, returning how many were recorded
+func (s *IntegrationService) Receive(integration *models.Integration, body []byte) (int, error) {
+	events, err := s.Transform(integration, body)
+	if err != nil {
+		return 0, err
+	}
+	for i := range events {
+		s.events.Record(&events[i], nil)
+	}
+
+	if err := s.db.Model(integration).Update("last_received_at", time.Now()).Error; err != nil {
+		fmt.Printf("[Integrations] Failed to update %s: %v\n", integration.Name, err)
+	}
+	return len(events), nil
+}
+
+// Transform turns a webhook body into events without storing them. A JSON
+// array is handled as one payload per element; payloads no mapping matches
+// are dropped.
+func (s *IntegrationService) Transform(integration *models.Integration, body []byte) ([]models.Event, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+	payloads, ok := decoded.([]interface{})
+	if !ok {
+		payloads = []interface{}{decoded}
+	}
+
+	mappings := append([]models.IntegrationMapping(nil), integration.Mappings...)
+	sort.SliceStable(mappings, func(i, j int) bool { return mappings[i].Position < mappings[j].Position })
+
+	cameras := make(map[string]*uint) // camera_lookup:value -> camera ID, nil when not found
+	events := []models.Event{}
+	for _, payload := range payloads {
+		mapping := matchMapping(mappings, payload)
+		if mapping == nil {
+			continue
+		}
+		event, err := s.toEvent(integration, mapping, payload, cameras)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (s *IntegrationService) toEvent(integration *models.Integration, mapping *models.IntegrationMapping, payload interface{}, cameras map[string]*uint) (models.Event, error) {
+	event := models.Event{
+		Type:     mapping.EventType,
+		Severity: mapping.Severity,
+		Source:   "integration:" + integration.Name,
+	}
+	if mapping.SeverityField != "" {
+		if value, ok := payloadField(payload, mapping.SeverityField); ok {
+			if severity := strings.ToLower(payloadString(value)); validSeverity(severity) {
+				event.Severity = severity
+			}
+		}
+	}
+
+	if mapping.CameraField != "" {
+		if value, ok := payloadField(payload, mapping.CameraField); ok {
+			event.CameraID = s.resolveCamera(mapping.CameraLookup, payloadString(value), cameras)
+		}
+	}
+
+	if mapping.OccurredAtField != "" {
+		if value, ok := payloadField(payload, mapping.OccurredAtField); ok {
+			event.OccurredAt = parsePayloadTime(payloadString(value))
+		}
+	}
+
+	if mapping.DescriptionTemplate != "" {
+		tpl, err := parseMappingTemplate(mapping.DescriptionTemplate)
+		if err != nil {
+			return event, err
+		}
+		var description bytes.Buffer
+		if err := tpl.Execute(&description, payload); err != nil {
+			return event, fmt.Errorf("mapping %d: %w", mapping.ID, err)
+		}
+		event.Description = description.String()
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return event, err
+	}
+	event.Data = string(raw)
+	return event, nil
+}
+
+// resolveCamera finds the camera a payload refers to, caching lookups for
+// the rest of the request
+func (s *IntegrationService) resolveCamera(lookup, value string, cameras map[string]*uint) *uint {
+	if value == "" {
+		return nil
+	}
+	key := lookup + ":" + value
+	if cameraID, ok := cameras[key]; ok {
+		return cameraID
+	}
+
+	var camera models.Camera
+	query := s.db.Select("id")
+	var err error
+	if lookup == "id" {
+		id, parseErr := strconv.ParseUint(value, 10, 64)
+		if parseErr != nil {
+			cameras[key] = nil
+			return nil
+		}
+		err = query.First(&camera, id).Error
+	} else {
+		err = query.First(&camera, "name = ?", value).Error
+	}
+	var cameraID *uint
+	if err == nil {
+		cameraID = &camera.ID
+	}
+	cameras[key] = cameraID
+	return cameraID
+}
+
+// ValidateMapping checks a mapping before it is saved
+func ValidateMapping(mapping *models.IntegrationMapping) error {
+	if mapping.EventType == "" {
+		return fmt.Errorf("event_type is required")
+	}
+	if !validSeverity(mapping.Severity) {
+		return fmt.Errorf("severity must be info, warning or critical")
+	}
+	if mapping.CameraLookup != "id" && mapping.CameraLookup != "name" {
+		return fmt.Errorf("camera_lookup must be id or name")
+	}
+	if mapping.MatchValue != "" && mapping.MatchField == "" {
+		return fmt.Errorf("match_value needs a match_field")
+	}
+	if mapping.DescriptionTemplate != "" {
+		if _, err := parseMappingTemplate(mapping.DescriptionTemplate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMappingTemplate parses a description template; missing payload
+// fields render as empty
+func parseMappingTemplate(text string) (*template.Template, error) {
+	tpl, err := template.New("description").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid description_template: %w", err)
+	}
+	return tpl, nil
+}
+
+// matchMapping returns the first mapping matching payload, nil if none does
+func matchMapping(mappings []models.IntegrationMapping, payload interface{}) *models.IntegrationMapping {
+	for i := range mappings {
+		mapping := &mappings[i]
+		if mapping.MatchField == "" {
+			return mapping
+		}
+		value, ok := payloadField(payload, mapping.MatchField)
+		if !ok {
+			continue
+		}
+		if mapping.MatchValue == "" || payloadString(value) == mapping.MatchValue {
+			return mapping
+		}
+	}
+	return nil
+}
+
+// payloadField follows a dot path ("alarm.zone", "devices.0.id") into a
+// decoded JSON payload
+func payloadField(payload interface{}, path string) (interface{}, bool) {
+	current := payload
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// payloadString renders a payload value for matching and lookups
+func payloadString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	raw, _ := json.Marshal(value)
+	return string(raw)
+}
+
+// parsePayloadTime reads RFC3339 or unix seconds, falling back to now
+func parsePayloadTime(value string) time.Time {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Unix(0, int64(seconds*float64(time.Second)))
+	}
+	return time.Now()
+}
+
+func validSeverity(severity string) bool {
+	return severity == "info" || severity == "warning" || severity == "critical"
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// intercomSweepInterval is how often ringing calls are checked for the ring
+// timeout
+const intercomSweepInterval = 2 * time.Second
+
+var (
+	ErrNotIntercom        = errors.New("device is not an intercom")
+	ErrIntercomCallState  = errors.New("call is not in a state allowing this")
+	ErrTalkNotConfigured  = errors.New("intercom has no talk_url for two-way audio")
+	ErrIntercomBusy       = errors.New("intercom already has a talk session")
+	ErrTalkSessionMissing = errors.New("talk session not found")
+)
+
+// IntercomService handles the calls of video intercoms (cameras with
+// device_type intercom): a button press starts a ringing call, recorded as
+// an "intercom_call" event and pushed to dashboards as intercom_call live
+// messages on each change; an operator answers it, talks to the visitor
+// and releases the door, or it is missed after RingTimeout. Calls come in
+// through the ONVIF metadata stream or the API.
+type IntercomService struct {
+	db          *gorm.DB
+	events      *EventService
+	feed        *LiveFeed
+	onvif       *ONVIFService
+	credentials *CredentialService
+	webrtc      *WebRTCService
+	usage       *UsageTracker
+	config      config.IntercomConfig
+	talks       map[uint]*talkSession // camera_id -> operator talking to the visitor
+	mu          sync.Mutex
+}
+
+func NewIntercomService(cfg config.IntercomConfig, db *gorm.DB, events *EventService, feed *LiveFeed, onvif *ONVIFService, credentials *CredentialService, webrtc *WebRTCService, usage *UsageTracker) *IntercomService {
+	return &IntercomService{
+		db:          db,
+		events:      events,
+		feed:        feed,
+		onvif:       onvif,
+		credentials: credentials,
+		webrtc:      webrtc,
+		usage:       usage,
+		config:      cfg,
+		talks:       make(map[uint]*talkSession),
+	}
+}
+
+// Start marks calls nobody answered within RingTimeout as missed
+func (s *IntercomService) Start() {
+	go func() {
+		ticker := time.NewTicker(intercomSweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.sweepMissed()
+		}
+	}()
+}
+
+// Ring starts a call from an intercom. Presses while a call is already
+// ringing return that call; created reports whether a new one was started.
+func (s *IntercomService) Ring(cameraID uint, source string) (call *models.IntercomCall, created bool, err error) {
+	var camera models.Camera
+	if err := s.db.First(&camera, cameraID).Error; err != nil {
+		return nil, false, err
+	}
+	if camera.DeviceType != models.DeviceTypeIntercom {
+		return nil, false, ErrNotIntercom
+	}
+
+	var ringing models.IntercomCall
+	err = s.db.Where("camera_id = ? AND status = ?", cameraID, models.IntercomCallRinging).
+		Order("started_at DESC").First(&ringing).Error
+	if err == nil {
+		return &ringing, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	call = &models.IntercomCall{
+		CameraID:  cameraID,
+		Status:    models.IntercomCallRinging,
+		Source:    source,
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(call).Error; err != nil {
+		return nil, false, err
+	}
+	fmt.Printf("[Intercom] Call %d from camera %d (%s)\n", call.ID, cameraID, source)
+
+	s.events.Record(&models.Event{
+		CameraID:    &cameraID,
+		Type:        "intercom_call",
+		Severity:    "warning",
+		Source:      source,
+		Description: "Call from " + camera.Name,
+		OccurredAt:  call.StartedAt,
+	}, map[string]interface{}{
+		"call_id": call.ID,
+	})
+	s.feed.Publish(LiveIntercomCall, cameraID, call)
+	return call, true, nil
+}
+
+// Answer marks a ringing call as answered by a user
+func (s *IntercomService) Answer(callID, userID uint) (*models.IntercomCall, error) {
+	now := time.Now()
+	return s.transition(callID, []string{models.IntercomCallRinging}, map[string]interface{}{
+		"status":      models.IntercomCallAnswered,
+		"answered_at": now,
+		"answered_by": userID,
+	})
+}
+
+// Hangup ends a ringing or answered call and the talk session of its
+// intercom
+func (s *IntercomService) Hangup(callID, userID uint) (*models.IntercomCall, error) {
+	call, err := s.transition(callID, []string{models.IntercomCallRinging, models.IntercomCallAnswered}, map[string]interface{}{
+		"status":   models.IntercomCallEnded,
+		"ended_at": time.Now(),
+		"ended_by": userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.closeTalk(call.CameraID, "")
+	return call, nil
+}
+
+// ActiveCall returns the ringing or answered call of an intercom, nil when
+// it has none
+func (s *IntercomService) ActiveCall(cameraID uint) *models.IntercomCall {
+	var call models.IntercomCall
+	if err := s.db.Where("camera_id = ? AND status IN ?", cameraID, []string{models.IntercomCallRinging, models.IntercomCallAnswered}).
+		Order("started_at DESC").First(&call).Error; err != nil {
+		return nil
+	}
+	return &call
+}
+
+// ReleaseDoor pulses the intercom's door relay for DoorPulse, records a
+// "door_released" event and notes it on the active call, if any
+func (s *IntercomService) ReleaseDoor(camera *models.Camera, userID uint) (*models.IntercomCall, error) {
+	if camera.DeviceType != models.DeviceTypeIntercom {
+		return nil, ErrNotIntercom
+	}
+	target, err := ONVIFTargetFromRTSP(s.credentials.StreamURL(camera), camera.ONVIFPort)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.onvif.SetRelayOutput(target, camera.DoorRelay, true); err != nil {
+		return nil, err
+	}
+	// Monostable relays fall back by themselves; bistable ones are switched back
+	time.AfterFunc(s.config.DoorPulse, func() {
+		if err := s.onvif.SetRelayOutput(target, camera.DoorRelay, false); err != nil {
+			fmt.Printf("[Intercom] Failed to close door relay of camera %d: %v\n", camera.ID, err)
+		}
+	})
+	fmt.Printf("[Intercom] Door released at camera %d by user %d\n", camera.ID, userID)
+
+	data := map[string]interface{}{"user_id": userID}
+	call := s.ActiveCall(camera.ID)
+	if call != nil {
+		now := time.Now()
+		if err := s.db.Model(call).Updates(map[string]interface{}{
+			"door_released_at": now,
+			"door_released_by": userID,
+		}).Error; err != nil {
+			fmt.Printf("[Intercom] Failed to note door release on call %d: %v\n", call.ID, err)
+		}
+		data["call_id"] = call.ID
+		s.feed.Publish(LiveIntercomCall, camera.ID, call)
+	}
+
+	cameraID := camera.ID
+	s.events.Record(&models.Event{
+		CameraID:    &cameraID,
+		Type:        "door_released",
+		Source:      "intercom",
+		Description: "Door released at " + camera.Name,
+	}, data)
+	return call, nil
+}
+
+// transition moves a call from one of the given statuses to another, so two
+// operators answering at once can't both succeed
+func (s *IntercomService) transition(callID uint, from []string, updates map[string]interface{}) (*models.IntercomCall, error) {
+	result := s.db.Model(&models.IntercomCall{}).Where("id = ? AND status IN ?", callID, from).Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	var call models.IntercomCall
+	if err := s.db.First(&call, callID).Error; err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return &call, ErrIntercomCallState
+	}
+	s.feed.Publish(LiveIntercomCall, call.CameraID, &call)
+	return &call, nil
+}
+
+// sweepMissed marks the calls ringing longer than RingTimeout as missed
+func (s *IntercomService) sweepMissed() {
+	var expired []models.IntercomCall
+	if err := s.db.Where("status = ? AND started_at < ?", models.IntercomCallRinging, time.Now().Add(-s.config.RingTimeout)).
+		Find(&expired).Error; err != nil {
+		fmt.Printf("[Intercom] Failed to load ringing calls: %v\n", err)
+		return
+	}
+	for _, call := range expired {
+		missed, err := s.transition(call.ID, []string{models.IntercomCallRinging}, map[string]interface{}{
+			"status":   models.IntercomCallMissed,
+			"ended_at": time.Now(),
+		})
+		if err != nil {
+			continue // Answered meanwhile
+		}
+		fmt.Printf("[Intercom] Call %d from camera %d was missed\n", missed.ID, missed.CameraID)
+		cameraID := missed.CameraID
+		s.events.Record(&models.Event{
+			CameraID:    &cameraID,
+			Type:        "intercom_missed_call",
+			Severity:    "warning",
+			Source:      "intercom",
+			Description: "Missed intercom call",
+		}, map[string]interface{}{
+			"call_id": missed.ID,
+		})
+	}
+}
+
+// talkURL returns where the operator's audio is sent. It is checked again
+// here, for cameras saved before talk URLs were validated.
+func (s *IntercomService) talkURL(camera *models.Camera) (string, error) {
+	if camera.TalkURL == "" {
+		return "", ErrTalkNotConfigured
+	}
+	if err := ValidateTalkURL(camera.TalkURL, camera.RTSPUrl); err != nil {
+		return "", err
+	}
+	return camera.TalkURL, nil
+}
+
+// ValidateTalkURL checks a talk_url: FFmpeg POSTs the audio to it, so only
+// http and https are accepted, and only to the station itself, the host of
+// its RTSP URL. Credentials the station needs go in the talk URL.
+func ValidateTalkURL(talkURL, rtspURL string) error {
+	u, err := url.Parse(talkURL)
+	if err != nil {
+		return fmt.Errorf("invalid talk_url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("talk_url must be an http or https URL")
+	}
+	stream, err := url.Parse(rtspURL)
+	if err != nil || stream.Hostname() == "" {
+		return fmt.Errorf("talk_url can't be checked against an invalid rtsp_url")
+	}
+	if !strings.EqualFold(u.Hostname(), stream.Hostname()) {
+		return fmt.Errorf("talk_url must point at the intercom's own host %s", stream.Hostname())
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// PipelineIntercomTalk is the FFmpeg sending an operator's voice to an
+// intercom
+const PipelineIntercomTalk = "intercom_talk"
+
+// talkPayloadType is the Opus payload type in the SDP given to FFmpeg;
+// forwarded packets are rewritten to it whatever the browser negotiated
+const talkPayloadType = 111
+
+// talkSession is an operator talking to a visitor: the browser's
+// microphone arrives over WebRTC and FFmpeg re-encodes it to G.711 µ-law
+// and POSTs it to the intercom's talk URL
+type talkSession struct {
+	id             string
+	cameraID       uint
+	peerConnection *webrtc.PeerConnection
+	cmd            *exec.Cmd
+	closeOnce      sync.Once
+	mu             sync.Mutex
+}
+
+// AnswerTalk answers a WebRTC offer carrying the operator's microphone and
+// sends the audio to the intercom, answering its ringing call. The
+// intercom's own audio is heard through the camera's audio or WebRTC
+// stream. Returns the session ID the operator ends it with.
+func (s *IntercomService) AnswerTalk(camera *models.Camera, offer string, userID uint) (string, string, error) {
+	if camera.DeviceType != models.DeviceTypeIntercom {
+		return "", "", ErrNotIntercom
+	}
+	talkURL, err := s.talkURL(camera)
+	if err != nil {
+		return "", "", err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	session := &talkSession{id: hex.EncodeToString(buf), cameraID: camera.ID}
+
+	s.mu.Lock()
+	if _, busy := s.talks[camera.ID]; busy {
+		s.mu.Unlock()
+		return "", "", ErrIntercomBusy
+	}
+	s.talks[camera.ID] = session
+	s.mu.Unlock()
+
+	answer, err := s.startTalk(session, offer, talkURL)
+	if err != nil {
+		s.closeTalk(camera.ID, session.id)
+		return "", "", err
+	}
+
+	if call := s.ActiveCall(camera.ID); call != nil && call.Status == models.IntercomCallRinging {
+		s.Answer(call.ID, userID)
+	}
+	fmt.Printf("[Intercom] Talk session %s started on camera %d by user %d\n", session.id, camera.ID, userID)
+	return session.id, answer, nil
+}
+
+// startTalk sets up the peer connection receiving the operator's audio
+func (s *IntercomService) startTalk(session *talkSession, offer, talkURL string) (string, error) {
+	peerConnection, err := s.webrtc.newPeerConnection()
+	if err != nil {
+		return "", err
+	}
+	session.mu.Lock()
+	session.peerConnection = peerConnection
+	session.mu.Unlock()
+
+	if _, err := peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		return "", err
+	}
+	peerConnection.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if track.Kind() != webrtc.RTPCodecTypeAudio {
+			return
+		}
+		if err := s.forwardTalk(session, track, talkURL); err != nil {
+			fmt.Printf("[Intercom] Talk session %s on camera %d failed: %v\n", session.id, session.cameraID, err)
+			s.closeTalk(session.cameraID, session.id)
+		}
+	})
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		fmt.Printf("[Intercom] Camera %d talk session %s: %s\n", session.cameraID, session.id, state.String())
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			s.closeTalk(session.cameraID, session.id)
+		}
+	})
+
+	if err := peerConnection.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", fmt.Errorf("invalid offer: %w", err)
+	}
+	answer, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid offer: %w", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	select {
+	case <-gathered:
+	case <-time.After(whepGatherTimeout):
+		fmt.Printf("[Intercom] ICE gathering for camera %d timed out, answering with the candidates so far\n", session.cameraID)
+	}
+	return peerConnection.LocalDescription().SDP, nil
+}
+
+// forwardTalk starts FFmpeg reading Opus RTP from a local UDP port, as
+// described by an SDP on its stdin, and copies the track's packets there
+// until the track ends
+func (s *IntercomService) forwardTalk(session *talkSession, track *webrtc.TrackRemote, talkURL string) error {
+	port, err := freeUDPPort()
+	if err != nil {
+		return err
+	}
+	sdp := strings.Join([]string{
+		"v=0",
+		"o=- 0 0 IN IP4 127.0.0.1",
+		"s=talk",
+		"c=IN IP4 127.0.0.1",
+		"t=0 0",
+		fmt.Sprintf("m=audio %d RTP/AVP %d", port, talkPayloadType),
+		fmt.Sprintf("a=rtpmap:%d opus/48000/2", talkPayloadType),
+		"",
+	}, "\r\n")
+
+	cmd := FFmpegCommand(
+		"-loglevel", "error",
+		"-protocol_whitelist", "pipe,udp,rtp",
+		"-f", "sdp",
+		"-i", "pipe:0",
+		"-c:a", "pcm_mulaw",
+		"-ar", "8000",
+		"-ac", "1",
+		"-f", "mulaw",
+		"-method", "POST",
+		"-content_type", "audio/basic",
+		talkURL,
+	)
+	cmd.Stdin = strings.NewReader(sdp)
+	cmd.Stderr = newFFmpegErrorWriter(session.cameraID, PipelineIntercomTalk)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.usage.TrackProcess(session.cameraID, PipelineIntercomTalk, cmd)
+	go cmd.Wait()
+
+	session.mu.Lock()
+	session.cmd = cmd
+	session.mu.Unlock()
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			return nil // Peer connection closed
+		}
+		packet.PayloadType = talkPayloadType
+		raw, err := packet.Marshal()
+		if err != nil {
+			continue
+		}
+		// FFmpeg may not listen yet for the first packets; they are lost
+		conn.Write(raw)
+	}
+}
+
+// CloseTalk ends an intercom's talk session
+func (s *IntercomService) CloseTalk(cameraID uint, sessionID string) error {
+	s.mu.Lock()
+	session, exists := s.talks[cameraID]
+	s.mu.Unlock()
+	if !exists || session.id != sessionID {
+		return ErrTalkSessionMissing
+	}
+	s.closeTalk(cameraID, sessionID)
+	return nil
+}
+
+// closeTalk tears a talk session down; an empty sessionID closes whichever
+// the intercom has
+func (s *IntercomService) closeTalk(cameraID uint, sessionID string) {
+	s.mu.Lock()
+	session, exists := s.talks[cameraID]
+	if !exists || (sessionID != "" && session.id != sessionID) {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.talks, cameraID)
+	s.mu.Unlock()
+
+	session.closeOnce.Do(func() {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		if session.cmd != nil && session.cmd.Process != nil {
+			session.cmd.Process.Kill()
+		}
+		if session.peerConnection != nil {
+			session.peerConnection.Close()
+		}
+		fmt.Printf("[Intercom] Talk session %s on camera %d ended\n", session.id, cameraID)
+	})
+}
+
+// freeUDPPort returns a local UDP port nothing listens on right now
+func freeUDPPort() (int, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port, nil
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ldapConn is a minimal LDAPv3 client: simple bind and single-entry
+// equality searches, which is all the directory sync needs. Messages are
+// BER-encoded by hand (RFC 4511). go-ldap would be preferable but isn't
+// among the module's dependencies; swap it in once it is added to go.mod.
+type ldapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+// BER tags of the LDAP messages and fields used
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berBoolean     = 0x01
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+
+	ldapBindRequest       = 0x60
+	ldapBindResponse      = 0x61
+	ldapUnbindRequest     = 0x42
+	ldapSearchRequest     = 0x63
+	ldapSearchResultEntry = 0x64
+	ldapSearchResultDone  = 0x65
+	ldapSimpleAuth        = 0x80
+	ldapEqualityFilter    = 0xa3
+)
+
+const ldapTimeout = 15 * time.Second
+
+// dialLDAP connects to an ldap:// or ldaps:// URL
+func dialLDAP(rawURL string) (*ldapConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldap":
+		conn, err = dialer.Dial("tcp", withDefaultPort(u.Host, "389"))
+	case "ldaps":
+		conn, err = tls.DialWithDialer(dialer, "tcp", withDefaultPort(u.Host, "636"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ldapConn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Bind authenticates with a DN and password
+func (l *ldapConn) Bind(dn, password string) error {
+	request := berElement(ldapBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, dn),
+		berString(ldapSimpleAuth, password),
+	)
+	if err := l.send(request); err != nil {
+		return err
+	}
+	tag, content, err := l.receive()
+	if err != nil {
+		return err
+	}
+	if tag != ldapBindResponse {
+		return fmt.Errorf("unexpected LDAP response 0x%x to bind", tag)
+	}
+	return ldapResultError(content, "bind")
+}
+
+// SearchOne returns the attributes of the first entry under baseDN whose
+// attribute equals value, nil when there is none
+func (l *ldapConn) SearchOne(baseDN, attribute, value string, attributes []string) (map[string][]byte, error) {
+	requested := make([][]byte, 0, len(attributes))
+	for _, name := range attributes {
+		requested = append(requested, berString(berOctetString, name))
+	}
+	request := berElement(ldapSearchRequest,
+		berString(berOctetString, baseDN),
+		berInt(berEnumerated, 2), // wholeSubtree
+		berInt(berEnumerated, 0), // neverDerefAliases
+		berInt(berInteger, 1),    // sizeLimit
+		berInt(berInteger, int(ldapTimeout.Seconds())),
+		[]byte{berBoolean, 1, 0}, // typesOnly false
+		berElement(ldapEqualityFilter, berString(berOctetString, attribute), berString(berOctetString, value)),
+		berElement(berSequence, requested...),
+	)
+	if err := l.send(request); err != nil {
+		return nil, err
+	}
+
+	var entry map[string][]byte
+	for {
+		tag, content, err := l.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case ldapSearchResultEntry:
+			if entry == nil {
+				entry, err = parseLDAPEntry(content)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case ldapSearchResultDone:
+			if err := ldapResultError(content, "search"); err != nil && entry == nil {
+				return nil, err
+			}
+			return entry, nil
+		}
+		// Referrals are ignored
+	}
+}
+
+// Close unbinds and closes the connection
+func (l *ldapConn) Close() error {
+	l.send([]byte{ldapUnbindRequest, 0})
+	return l.conn.Close()
+}
+
+// send wraps a protocol operation in an LDAPMessage with the next message ID
+func (l *ldapConn) send(op []byte) error {
+	l.nextID++
+	message := berElement(berSequence, berInt(berInteger, l.nextID), op)
+	l.conn.SetDeadline(time.Now().Add(ldapTimeout))
+	_, err := l.conn.Write(message)
+	return err
+}
+
+// receive reads one LDAPMessage and returns its protocol operation
+func (l *ldapConn) receive() (byte, []byte, error) {
+	l.conn.SetDeadline(time.Now().Add(ldapTimeout))
+	tag, message, err := readBER(l.reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag != berSequence {
+		return 0, nil, errors.New("malformed LDAP message")
+	}
+	fields, err := splitBER(message)
+	if err != nil || len(fields) < 2 {
+		return 0, nil, errors.New("malformed LDAP message")
+	}
+	return fields[1].tag, fields[1].content, nil
+}
+
+// ldapResultError turns a non-success LDAPResult into an error
+func ldapResultError(content []byte, operation string) error {
+	fields, err := splitBER(content)
+	if err != nil || len(fields) < 3 {
+		return fmt.Errorf("malformed LDAP %s response", operation)
+	}
+	code := berToInt(fields[0].content)
+	if code == 0 {
+		return nil
+	}
+	if message := string(fields[2].content); message != "" {
+		return fmt.Errorf("LDAP %s failed (code %d): %s", operation, code, message)
+	}
+	return fmt.Errorf("LDAP %s failed (code %d)", operation, code)
+}
+
+// parseLDAPEntry returns the first value of each attribute of a
+// SearchResultEntry, keyed by lowercased attribute name
+func parseLDAPEntry(content []byte) (map[string][]byte, error) {
+	fields, err := splitBER(content)
+	if err != nil || len(fields) < 2 {
+		return nil, errors.New("malformed LDAP search entry")
+	}
+	attributes, err := splitBER(fields[1].content)
+	if err != nil {
+		return nil, err
+	}
+	entry := make(map[string][]byte)
+	for _, attribute := range attributes {
+		parts, err := splitBER(attribute.content)
+		if err != nil || len(parts) < 2 {
+			continue
+		}
+		values, err := splitBER(parts[1].content)
+		if err != nil || len(values) == 0 {
+			continue
+		}
+		entry[strings.ToLower(string(parts[0].content))] = values[0].content
+	}
+	return entry, nil
+}
+
+type berField struct {
+	tag     byte
+	content []byte
+}
+
+// readBER reads one element from r
+func readBER(r *bufio.Reader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 {
+			return 0, nil, errors.New("unsupported BER length")
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+	return tag, content, nil
+}
+
+// splitBER splits the content of a constructed element into its elements
+func splitBER(data []byte) ([]berField, error) {
+	var fields []berField
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("truncated BER element")
+		}
+		tag, length, header := data[0], int(data[1]), 2
+		if data[1]&0x80 != 0 {
+			n := int(data[1] & 0x7f)
+			if n == 0 || n > 4 || len(data) < 2+n {
+				return nil, errors.New("unsupported BER length")
+			}
+			length = 0
+			for _, b := range data[2 : 2+n] {
+				length = length<<8 | int(b)
+			}
+			header += n
+		}
+		if length < 0 || len(data) < header+length {
+			return nil, errors.New("truncated BER element")
+		}
+		fields = append(fields, berField{tag: tag, content: data[header : header+length]})
+		data = data[header+length:]
+	}
+	return fields, nil
+}
+
+func berElement(tag byte, children ...[]byte) []byte {
+	var content []byte
+	for _, child := range children {
+		content = append(content, child...)
+	}
+	return append(append([]byte{tag}, berLength(len(content))...), content...)
+}
+
+func berString(tag byte, value string) []byte {
+	return append(append([]byte{tag}, berLength(len(value))...), value...)
+}
+
+// berInt encodes a non-negative integer
+func berInt(tag byte, value int) []byte {
+	content := []byte{byte(value)}
+	for value > 0xff {
+		value >>= 8
+		content = append([]byte{byte(value)}, content...)
+	}
+	if content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return append([]byte{tag, byte(len(content))}, content...)
+}
+
+func berToInt(content []byte) int {
+	value := 0
+	for _, b := range content {
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+func berLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var bytes []byte
+	for length > 0 {
+		bytes = append([]byte{byte(length)}, bytes...)
+		length >>= 8
+	}
+	return append([]byte{0x80 | byte(len(bytes))}, bytes...)
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+)
+
+// Types of LiveMessage
+const (
+	LiveCameraStatus = "camera_status" // Camera.Status changed (health checks or by hand)
+	LiveStreamHealth = "stream_health" // A health check found the stream up or down
+	LiveEvent        = "event"         // An event was recorded (motion, tamper, ...)
+	LiveAlert        = "alert"         // An alert rule raised an alert
+	LiveIntercomCall = "intercom_call" // An intercom call started ringing, was answered, missed or ended
+)
+
+const (
+	liveFeedHistory = 500 // Messages kept for clients resuming after a reconnect
+	liveFeedBuffer  = 64  // Messages a client may fall behind before it is dropped
+)
+
+// LiveMessage is pushed to dashboards over /events/stream. ID increases by
+// one per message, so a client that reconnects with the last ID it saw gets
+// what it missed.
+type LiveMessage struct {
+	ID       uint64      `json:"id"`
+	Type     string      `json:"type"`
+	CameraID uint        `json:"camera_id,omitempty"`
+	At       time.Time   `json:"at"`
+	Data     interface{} `json:"data"`
+}
+
+// LiveStatusChange is the data of a camera_status message
+type LiveStatusChange struct {
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Source     string `json:"source"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// LiveHealthChange is the data of a stream_health message
+type LiveHealthChange struct {
+	Healthy bool   `json:"healthy"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// LiveFilter picks the messages a client wants; empty fields match all
+type LiveFilter struct {
+	Types     map[string]bool
+	CameraIDs map[uint]bool
+}
+
+func (f LiveFilter) matches(msg *LiveMessage) bool {
+	if len(f.Types) > 0 && !f.Types[msg.Type] {
+		return false
+	}
+	if len(f.CameraIDs) > 0 && !f.CameraIDs[msg.CameraID] {
+		return false
+	}
+	return true
+}
+
+// LiveSubscription receives the messages matching its filter on C until
+// the feed drops it (Dropped is closed) or it is closed
+type LiveSubscription struct {
+	C       chan LiveMessage
+	Dropped chan struct{}
+	filter  LiveFilter
+}
+
+// LiveFeed fans camera status changes, stream health transitions, events
+// and alerts out to connected dashboards, so they don't have to poll each
+// camera. It only carries what happens in this process.
+type LiveFeed struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []LiveMessage
+	subscribers map[*LiveSubscription]struct{}
+}
+
+func NewLiveFeed() *LiveFeed {
+	return &LiveFeed{subscribers: make(map[*LiveSubscription]struct{})}
+}
+
+// Publish sends a message to every matching subscriber. Subscribers that
+// aren't keeping up are dropped rather than holding up the others.
+func (f *LiveFeed) Publish(msgType string, cameraID uint, data interface{}) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	msg := LiveMessage{ID: f.nextID, Type: msgType, CameraID: cameraID, At: time.Now(), Data: data}
+	f.history = append(f.history, msg)
+	if len(f.history) > liveFeedHistory {
+		f.history = f.history[len(f.history)-liveFeedHistory:]
+	}
+
+	for sub := range f.subscribers {
+		if !sub.filter.matches(&msg) {
+			continue
+		}
+		select {
+		case sub.C <- msg:
+		default:
+			fmt.Printf("[LiveFeed] Client is not keeping up, disconnecting\n")
+			delete(f.subscribers, sub)
+			close(sub.Dropped)
+		}
+	}
+}
+
+// PublishEvent sends a recorded event, and its alert when one was raised
+func (f *LiveFeed) PublishEvent(event *models.Event, alert *models.Alert) {
+	var cameraID uint
+	if event.CameraID != nil {
+		cameraID = *event.CameraID
+	}
+	f.Publish(LiveEvent, cameraID, event)
+	if alert != nil {
+		f.Publish(LiveAlert, cameraID, alert)
+	}
+}
+
+// Subscribe starts receiving messages. With lastID set, the messages after
+// it that are still kept are delivered first; resumed reports whether
+// nothing in between was lost.
+func (f *LiveFeed) Subscribe(filter LiveFilter, lastID uint64) (sub *LiveSubscription, resumed bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var missed []LiveMessage
+	resumed = lastID == 0 || lastID == f.nextID
+	for _, msg := range f.history {
+		if lastID == 0 || msg.ID <= lastID {
+			continue
+		}
+		if msg.ID == lastID+1 {
+			resumed = true
+		}
+		if filter.matches(&msg) {
+			missed = append(missed, msg)
+		}
+	}
+
+	sub = &LiveSubscription{
+		C:       make(chan LiveMessage, liveFeedBuffer+len(missed)),
+		Dropped: make(chan struct{}),
+		filter:  filter,
+	}
+	for _, msg := range missed {
+		sub.C <- msg
+	}
+	f.subscribers[sub] = struct{}{}
+	return sub, resumed
+}
+
+// Unsubscribe stops a subscription
+func (f *LiveFeed) Unsubscribe(sub *LiveSubscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subscribers, sub)
+}
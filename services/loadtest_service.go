@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	loadTestArea     = "Load Test"
+	loadTestBuilding = "Synthetic"
+	loadTestPath     = "loadtest_%d" // Of the synthetic camera's ID, so names never collide between runs
+	loadTestGridCols = 20
+	loadTestSpacing  = 0.0005 // Degrees between synthetic camera pins
+)
+
+// LoadTestService registers synthetic cameras whose RTSP streams are FFmpeg
+// test sources published into MediaMTX, so streaming, health monitoring and
+// the event pipeline can be load-tested without real cameras. Synthetic
+// cameras are flagged and never mixed up with production ones: they are
+// the only cameras this service creates or deletes.
+type LoadTestService struct {
+	db       *gorm.DB
+	mediamtx *MediaMTXService
+	events   *EventService
+	config   config.LoadTestConfig
+}
+
+func NewLoadTestService(cfg config.LoadTestConfig, db *gorm.DB, mediamtx *MediaMTXService, events *EventService) *LoadTestService {
+	return &LoadTestService{
+		db:       db,
+		mediamtx: mediamtx,
+		events:   events,
+		config:   cfg,
+	}
+}
+
+// Start syncs the synthetic cameras with LOADTEST_CAMERAS (removing them all
+// when it is 0), publishes their test sources and starts the synthetic
+// event generator
+func (s *LoadTestService) Start() {
+	cameras, err := s.syncCameras()
+	if err != nil {
+		fmt.Printf("[LoadTest] Failed to sync synthetic cameras: %v\n", err)
+		return
+	}
+	go s.removeStalePaths(cameras)
+	if len(cameras) == 0 {
+		return
+	}
+	fmt.Printf("[LoadTest] Load test mode: %d synthetic cameras (%s@%dfps)\n", len(cameras), s.config.Resolution, s.config.FPS)
+
+	go s.publishSources(cameras)
+	if s.config.EventsPerMinute > 0 {
+		go s.generateEvents(cameras)
+	}
+}
+
+// syncCameras creates missing synthetic cameras and deletes those beyond the
+// configured count. Each streams from loadtest_<its ID>; cameras from before
+// are pointed at theirs.
+func (s *LoadTestService) syncCameras() ([]models.Camera, error) {
+	var existing []models.Camera
+	if err := s.db.Where("synthetic = ?", true).Order("id").Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	if len(existing) > s.config.Cameras {
+		extra := existing[s.config.Cameras:]
+		ids := make([]uint, len(extra))
+		for i, camera := range extra {
+			ids[i] = camera.ID
+		}
+		if err := s.db.Where("id IN ? AND synthetic = ?", ids, true).Delete(&models.Camera{}).Error; err != nil {
+			return nil, err
+		}
+		fmt.Printf("[LoadTest] Removed %d synthetic cameras\n", len(extra))
+		existing = existing[:s.config.Cameras]
+	}
+
+	for i := range existing {
+		if url := s.sourceURL(existing[i].ID); existing[i].RTSPUrl != url {
+			if err := s.db.Model(&existing[i]).Update("rtsp_url", url).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := len(existing); i < s.config.Cameras; i++ {
+		camera := models.Camera{
+			Name:      fmt.Sprintf("Synthetic %d", i+1),
+			Latitude:  float64(i/loadTestGridCols) * loadTestSpacing,
+			Longitude: float64(i%loadTestGridCols) * loadTestSpacing,
+			Status:    "online",
+			Area:      loadTestArea,
+			Building:  loadTestBuilding,
+			Priority:  models.CameraPriorityLow,
+			Synthetic: true,
+		}
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&camera).Error; err != nil {
+				return err
+			}
+			camera.RTSPUrl = s.sourceURL(camera.ID)
+			return tx.Model(&camera).Update("rtsp_url", camera.RTSPUrl).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		existing = append(existing, camera)
+	}
+	return existing, nil
+}
+
+// sourceURL is where a synthetic camera streams from
+func (s *LoadTestService) sourceURL(cameraID uint) string {
+	return s.mediamtx.InternalRTSPURL(fmt.Sprintf(loadTestPath, cameraID))
+}
+
+// removeStalePaths removes the loadtest_ paths of synthetic cameras that no
+// longer exist, and those named by index by earlier versions
+func (s *LoadTestService) removeStalePaths(cameras []models.Camera) {
+	wanted := make(map[string]bool, len(cameras))
+	for _, camera := range cameras {
+		wanted[fmt.Sprintf(loadTestPath, camera.ID)] = true
+	}
+	paths, err := s.mediamtx.listPaths()
+	if err != nil {
+		fmt.Printf("[LoadTest] Failed to list MediaMTX paths: %v\n", err)
+		return
+	}
+	removed := 0
+	for name := range paths {
+		if !strings.HasPrefix(name, "loadtest_") || wanted[name] {
+			continue
+		}
+		if err := s.mediamtx.RemovePath(name); err != nil {
+			fmt.Printf("[LoadTest] Failed to remove test source %s: %v\n", name, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		fmt.Printf("[LoadTest] Removed %d stale test sources\n", removed)
+	}
+}
+
+// publishSources configures one always-on MediaMTX path per synthetic camera
+// that runs an FFmpeg test source. MediaMTX restarts the source if it dies.
+func (s *LoadTestService) publishSources(cameras []models.Camera) {
+	published := 0
+	for _, camera := range cameras {
+		if err := s.mediamtx.SetPublisherPath(fmt.Sprintf(loadTestPath, camera.ID), s.sourceCommand(camera.ID)); err != nil {
+			fmt.Printf("[LoadTest] Failed to publish test source of camera %d: %v\n", camera.ID, err)
+			continue
+		}
+		published++
+	}
+	fmt.Printf("[LoadTest] Published %d/%d test sources\n", published, len(cameras))
+}
+
+// sourceCommand is the FFmpeg test source MediaMTX runs for a synthetic
+// camera: a test pattern with a running clock and a tone at a per-camera
+// pitch
+func (s *LoadTestService) sourceCommand(n uint) string {
+	return fmt.Sprintf(
+		"ffmpeg -hide_banner -loglevel error -re "+
+			"-f lavfi -i testsrc2=size=%s:rate=%d -f lavfi -i sine=frequency=%d:sample_rate=16000 "+
+			"-c:v libx264 -preset ultrafast -tune zerolatency -profile:v baseline -pix_fmt yuv420p -g %d "+
+			"-c:a aac -b:a 32k -f rtsp rtsp://localhost:$RTSP_PORT/$MTX_PATH",
+		s.config.Resolution, s.config.FPS, 200+(n%40)*20, s.config.FPS*2,
+	)
+}
+
+// generateEvents records synthetic motion events on random synthetic
+// cameras at EventsPerMinute
+func (s *LoadTestService) generateEvents(cameras []models.Camera) {
+	ticker := time.NewTicker(time.Minute / time.Duration(s.config.EventsPerMinute))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		camera := cameras[rand.Intn(len(cameras))]
+		cameraID := camera.ID
+		s.events.Record(&models.Event{
+			CameraID:    &cameraID,
+			Type:        "motion",
+			Source:      "loadtest",
+			Description: fmt.Sprintf("Synthetic motion on %s", camera.Name),
+		}, nil)
+	}
+}
+
+// InternalRTSPURL is the URL the backend reads a MediaMTX path from
+func (s *MediaMTXService) InternalRTSPURL(pathName string) string {
+	return fmt.Sprintf("rtsp://%s:%s/%s", s.config.Host, s.config.RTSPPort, pathName)
+}
+
+// RemovePath removes a path from MediaMTX's configuration
+func (s *MediaMTXService) RemovePath(pathName string) error {
+	return s.patchConfig(map[string]interface{}{
+		"paths": map[string]interface{}{pathName: nil},
+	})
+}
+
+// SetPublisherPath configures a path whose stream is published by a command
+// MediaMTX runs (and restarts) for as long as the path exists
+func (s *MediaMTXService) SetPublisherPath(pathName, command string) error {
+	return s.patchConfig(map[string]interface{}{
+		"paths": map[string]interface{}{
+			pathName: map[string]interface{}{
+				"source":           "publisher",
+				"runOnInit":        command,
+				"runOnInitRestart": true,
+			},
+		},
+	})
+}
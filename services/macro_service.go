@@ -0,0 +1,238 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// Macro step result statuses
+const (
+	MacroStepOK         = "ok"
+	MacroStepFailed     = "failed"
+	MacroStepSkipped    = "skipped"     // Not run because an earlier step failed
+	MacroStepRolledBack = "rolled_back" // Undone because a later step failed
+)
+
+// MacroStepResult is the outcome of one step on one camera (or of a step
+// without cameras)
+type MacroStepResult struct {
+	Position   int    `json:"position"`
+	Action     string `json:"action"`
+	CameraID   *uint  `json:"camera_id,omitempty"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+	IncidentID *uint  `json:"incident_id,omitempty"`
+}
+
+// MacroRun is the outcome of running a macro
+type MacroRun struct {
+	MacroID   uint              `json:"macro_id"`
+	Succeeded bool              `json:"succeeded"`
+	Results   []MacroStepResult `json:"results"`
+}
+
+// MacroService runs operator macros. A run is all or nothing: database
+// changes share one transaction and recordings the run started are stopped
+// again when a step fails. PTZ moves can't be undone and are reported as
+// such.
+type MacroService struct {
+	db          *gorm.DB
+	recordings  *RecordingService
+	onvif       *ONVIFService
+	credentials *CredentialService
+}
+
+func NewMacroService(db *gorm.DB, recordings *RecordingService, onvif *ONVIFService, credentials *CredentialService) *MacroService {
+	return &MacroService{
+		db:          db,
+		recordings:  recordings,
+		onvif:       onvif,
+		credentials: credentials,
+	}
+}
+
+// ValidateMacroStep checks a step before it is saved
+func ValidateMacroStep(step *models.MacroStep) error {
+	switch step.Action {
+	case models.MacroStartRecording:
+		if len(step.Cameras()) == 0 {
+			return fmt.Errorf("start_recording needs camera_ids")
+		}
+		if step.DurationSeconds < 0 {
+			return fmt.Errorf("duration_seconds must not be negative")
+		}
+	case models.MacroPTZPreset:
+		if len(step.Cameras()) == 0 {
+			return fmt.Errorf("ptz_preset needs camera_ids")
+		}
+		if step.Preset == "" {
+			return fmt.Errorf("ptz_preset needs a preset")
+		}
+	case models.MacroCreateIncident:
+		if step.Title == "" {
+			return fmt.Errorf("create_incident needs a title")
+		}
+		if step.Severity != "" && !validSeverity(step.Severity) {
+			return fmt.Errorf("severity must be info, warning or critical")
+		}
+	default:
+		return fmt.Errorf("action must be start_recording, ptz_preset or create_incident")
+	}
+	return nil
+}
+
+// Run executes a macro's steps in order and returns a result per step and
+// camera. The first failure stops the run and rolls back what came before.
+func (s *MacroService) Run(macro *models.Macro, userID *uint) MacroRun {
+	steps := append([]models.MacroStep(nil), macro.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Position < steps[j].Position })
+
+	run := MacroRun{MacroID: macro.ID, Results: []MacroStepResult{}}
+	tx := s.db.Begin()
+	type undo struct {
+		result int // Index in run.Results
+		do     func()
+	}
+	var undos []undo
+	failed := false
+
+	for i := range steps {
+		step := &steps[i]
+		targets := []*uint{nil}
+		if step.Action != models.MacroCreateIncident {
+			targets = targets[:0]
+			for _, id := range step.Cameras() {
+				id := id
+				targets = append(targets, &id)
+			}
+		} else if cameras := step.Cameras(); len(cameras) > 0 {
+			targets[0] = &cameras[0]
+		}
+
+		for _, cameraID := range targets {
+			result := MacroStepResult{Position: step.Position, Action: step.Action, CameraID: cameraID}
+			if failed {
+				result.Status = MacroStepSkipped
+				run.Results = append(run.Results, result)
+				continue
+			}
+
+			var undoFn func()
+			var err error
+			switch step.Action {
+			case models.MacroStartRecording:
+				undoFn, result.Message, err = s.startRecording(*cameraID, step.DurationSeconds)
+			case models.MacroPTZPreset:
+				err = s.gotoPreset(*cameraID, step.Preset)
+			case models.MacroCreateIncident:
+				result.IncidentID, err = s.createIncident(tx, step, cameraID, userID)
+			}
+			if err != nil {
+				result.Status = MacroStepFailed
+				result.Message = err.Error()
+				failed = true
+			} else {
+				result.Status = MacroStepOK
+			}
+			run.Results = append(run.Results, result)
+			if err == nil && undoFn != nil {
+				undos = append(undos, undo{result: len(run.Results) - 1, do: undoFn})
+			}
+		}
+	}
+
+	if !failed {
+		if err := tx.Commit().Error; err != nil {
+			fmt.Printf("[Macros] Failed to commit macro %d: %v\n", macro.ID, err)
+			run.Results = append(run.Results, MacroStepResult{Action: "commit", Status: MacroStepFailed, Message: err.Error()})
+			failed = true
+		}
+	} else {
+		tx.Rollback()
+	}
+	if !failed {
+		run.Succeeded = true
+		return run
+	}
+
+	// The transaction took the incidents with it; recordings are stopped
+	// newest first
+	for i := range run.Results {
+		result := &run.Results[i]
+		if result.Status != MacroStepOK {
+			continue
+		}
+		switch result.Action {
+		case models.MacroCreateIncident:
+			result.Status = MacroStepRolledBack
+			result.IncidentID = nil
+		case models.MacroPTZPreset:
+			result.Message = "camera moved; PTZ moves are not undone"
+		}
+	}
+	for i := len(undos) - 1; i >= 0; i-- {
+		undos[i].do()
+		run.Results[undos[i].result].Status = MacroStepRolledBack
+	}
+	return run
+}
+
+// startRecording starts an on-demand recording, returning how to undo it.
+// A camera that is already recording is left as it is.
+func (s *MacroService) startRecording(cameraID uint, durationSeconds int) (func(), string, error) {
+	var camera models.Camera
+	if err := s.db.First(&camera, cameraID).Error; err != nil {
+		return nil, "", fmt.Errorf("camera %d not found", cameraID)
+	}
+	_, err := s.recordings.StartOnDemand(&camera, time.Duration(durationSeconds)*time.Second)
+	if errors.Is(err, ErrAlreadyRecording) {
+		return nil, "already recording", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return func() { s.recordings.Stop(cameraID) }, "", nil
+}
+
+func (s *MacroService) gotoPreset(cameraID uint, preset string) error {
+	var camera models.Camera
+	if err := s.db.First(&camera, cameraID).Error; err != nil {
+		return fmt.Errorf("camera %d not found", cameraID)
+	}
+	target, err := ONVIFTargetFromRTSP(s.credentials.StreamURL(&camera), camera.ONVIFPort)
+	if err != nil {
+		return err
+	}
+	return s.onvif.GotoPreset(target, preset)
+}
+
+func (s *MacroService) createIncident(tx *gorm.DB, step *models.MacroStep, cameraID, userID *uint) (*uint, error) {
+	incident := models.Incident{
+		Title:       step.Title,
+		Notes:       step.Notes,
+		Severity:    step.Severity,
+		Status:      "open",
+		CameraID:    cameraID,
+		CreatedByID: userID,
+	}
+	if incident.Severity == "" {
+		incident.Severity = "info"
+	}
+	if cameraID != nil {
+		var camera models.Camera
+		if err := s.db.Select("id", "area").First(&camera, *cameraID).Error; err != nil {
+			return nil, fmt.Errorf("camera %d not found", *cameraID)
+		}
+		incident.Area = camera.Area
+	}
+	if err := tx.Create(&incident).Error; err != nil {
+		return nil, err
+	}
+	return &incident.ID, nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+// Mailer sends email through the configured SMTP relay
+type Mailer struct {
+	config config.SMTPConfig
+}
+
+func NewMailer(cfg config.SMTPConfig) *Mailer {
+	return &Mailer{config: cfg}
+}
+
+// Enabled reports whether an SMTP relay is configured
+func (m *Mailer) Enabled() bool {
+	return m.config.Host != ""
+}
+
+// Send delivers one message to the recipients. body is HTML when html is set.
+func (m *Mailer) Send(to []string, subject, body string, html bool) error {
+	if !m.Enabled() {
+		return fmt.Errorf("SMTP is not configured")
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	contentType := "text/plain; charset=UTF-8"
+	if html {
+		contentType = "text/html; charset=UTF-8"
+	}
+	headers := []string{
+		"From: " + m.config.From,
+		"To: " + strings.Join(to, ", "),
+		"Subject: " + strings.NewReplacer("\r", "", "\n", "").Replace(subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: " + contentType,
+	}
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+	address := net.JoinHostPort(m.config.Host, m.config.Port)
+	if err := smtp.SendMail(address, auth, m.config.From, to, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
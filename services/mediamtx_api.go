@@ -0,0 +1,349 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MediaMTX control API versions. MediaMTX before v1.0 serves /v2, v1.x
+// serves /v3.
+const (
+	MediaMTXAPIAuto = "auto"
+	MediaMTXAPIV2   = "v2"
+	MediaMTXAPIV3   = "v3"
+)
+
+// patchAttempts is how many times an API request is tried before giving up
+const patchAttempts = 3
+
+// mediaMTXPathsPerPage is the page size asked for when listing paths over
+// /v3, which pages the list (100 items by default)
+const mediaMTXPathsPerPage = 1000
+
+// v3PathKeys are path settings renamed in MediaMTX v1.0. Path configs are
+// kept with the v2 names and renamed when sent to a /v3 API.
+var v3PathKeys = map[string]string{
+	"sourceProtocol":      "rtspTransport",
+	"sourceAnyPortEnable": "rtspAnyPort",
+}
+
+// mediaMTXAuthExclude are the actions MediaMTX v1.x doesn't ask the auth
+// callback about: its API, metrics and pprof listen on ports that aren't
+// published. Publishing is asked about, so only MediaMTX's own FFmpegs can
+// publish to camera paths.
+var mediaMTXAuthExclude = []map[string]string{
+	{"action": "api"},
+	{"action": "metrics"},
+	{"action": "pprof"},
+}
+
+// APIVersion returns the MediaMTX API version in use, detecting it when
+// MEDIAMTX_API_VERSION is auto and it isn't known yet
+func (s *MediaMTXService) APIVersion() (string, error) {
+	if s.config.APIVersion == MediaMTXAPIV2 || s.config.APIVersion == MediaMTXAPIV3 {
+		return s.config.APIVersion, nil
+	}
+
+	s.apiMu.Lock()
+	defer s.apiMu.Unlock()
+	if s.apiVersion != "" {
+		return s.apiVersion, nil
+	}
+
+	// The config getter exists under both versions and needs no path
+	var errs []string
+	for _, version := range []string{MediaMTXAPIV3, MediaMTXAPIV2} {
+		endpoint := "/v3/config/global/get"
+		if version == MediaMTXAPIV2 {
+			endpoint = "/v2/config/get"
+		}
+		resp, err := s.httpClient.Get(s.apiURL(endpoint))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", version, err))
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			s.apiVersion = version
+			fmt.Printf("[MediaMTX] Using the %s API at %s\n", version, s.apiHost())
+			return version, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: status %d", version, resp.StatusCode))
+	}
+	return "", fmt.Errorf("MediaMTX API not reachable at %s (tried /v3 and /v2: %s); check MEDIAMTX_HOST, MEDIAMTX_API_PORT and that the API is enabled (api: yes)", s.apiHost(), strings.Join(errs, "; "))
+}
+
+// DetectAPIVersion logs which MediaMTX API is used, or why none could be
+// found; detection is retried on the next API call when MediaMTX isn't up yet
+func (s *MediaMTXService) DetectAPIVersion() {
+	if _, err := s.APIVersion(); err != nil {
+		fmt.Printf("[MediaMTX] Warning: %v; retrying on first use\n", err)
+	}
+}
+
+// ConfigureAuth points MediaMTX's authentication at the backend's stream
+// auth callback (AuthCallbackURL), so browser reads need a signed token:
+// externalAuthenticationURL before v1.0, authMethod http since. Settings
+// made through the API don't survive a MediaMTX restart, so the reconciler
+// applies them again.
+func (s *MediaMTXService) ConfigureAuth() error {
+	if s.config.AuthCallbackURL == "" {
+		return nil
+	}
+	version, err := s.APIVersion()
+	if err != nil {
+		return err
+	}
+
+	method, endpoint := http.MethodPatch, "/v3/config/global/patch"
+	patch := map[string]interface{}{
+		"authMethod":      "http",
+		"authHTTPAddress": s.config.AuthCallbackURL,
+		"authHTTPExclude": mediaMTXAuthExclude,
+	}
+	if version == MediaMTXAPIV2 {
+		method, endpoint = http.MethodPost, "/v2/config/patch"
+		patch = map[string]interface{}{
+			"externalAuthenticationURL": s.config.AuthCallbackURL,
+		}
+	}
+
+	status, body, err := s.apiRequest(method, endpoint, patch)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("MediaMTX API error (status %d): %s", status, body)
+	}
+
+	s.apiMu.Lock()
+	first := !s.authApplied && err == nil
+	s.authApplied = err == nil
+	s.apiMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to set the stream auth callback: %w", err)
+	}
+	if first {
+		fmt.Printf("[MediaMTX] Reads are authorized by %s\n", s.config.AuthCallbackURL)
+	}
+	return nil
+}
+
+// forgetAPIVersion makes the next call detect the version again, e.g. after
+// MediaMTX was upgraded under a running backend
+func (s *MediaMTXService) forgetAPIVersion() {
+	s.apiMu.Lock()
+	s.apiVersion = ""
+	s.apiMu.Unlock()
+}
+
+func (s *MediaMTXService) apiHost() string {
+	return net.JoinHostPort(s.config.Host, s.config.APIPort)
+}
+
+func (s *MediaMTXService) apiURL(endpoint string) string {
+	return "http://" + s.apiHost() + endpoint
+}
+
+// patchConfig applies a {"paths": {name: config}} patch, where a nil config
+// removes the path. /v2 takes it as one config patch; /v3 configures each
+// path on its own.
+func (s *MediaMTXService) patchConfig(patch map[string]interface{}) error {
+	version, err := s.APIVersion()
+	if err != nil {
+		return err
+	}
+
+	if version == MediaMTXAPIV2 {
+		status, body, err := s.apiRequest(http.MethodPost, "/v2/config/patch", patch)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK && status != http.StatusCreated {
+			return fmt.Errorf("MediaMTX API error (status %d): %s", status, body)
+		}
+		return nil
+	}
+
+	paths, _ := patch["paths"].(map[string]interface{})
+	for name, config := range paths {
+		if err := s.setPathV3(name, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPathV3 merges a path config into an existing path like a /v2 patch
+// would, adds it when missing and deletes it for a nil config
+func (s *MediaMTXService) setPathV3(name string, config interface{}) error {
+	escaped := url.PathEscape(name)
+	if config == nil {
+		status, body, err := s.apiRequest(http.MethodDelete, "/v3/config/paths/delete/"+escaped, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK && status != http.StatusNotFound {
+			return fmt.Errorf("MediaMTX API error (status %d): %s", status, body)
+		}
+		return nil
+	}
+
+	converted := v3PathConfig(config)
+	status, body, err := s.apiRequest(http.MethodPatch, "/v3/config/paths/patch/"+escaped, converted)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		status, body, err = s.apiRequest(http.MethodPost, "/v3/config/paths/add/"+escaped, converted)
+		if err != nil {
+			return err
+		}
+	}
+	if status != http.StatusOK && status != http.StatusCreated {
+		return fmt.Errorf("MediaMTX API error (status %d): %s", status, body)
+	}
+	return nil
+}
+
+// v3PathConfig renames the path settings MediaMTX v1.0 renamed
+func v3PathConfig(config interface{}) interface{} {
+	var fields map[string]interface{}
+	switch c := config.(type) {
+	case PathConfig:
+		fields = c
+	case map[string]interface{}:
+		fields = c
+	default:
+		return config
+	}
+	converted := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if renamed, ok := v3PathKeys[key]; ok {
+			key = renamed
+		}
+		converted[key] = value
+	}
+	return converted
+}
+
+// apiRequest sends a JSON request to the MediaMTX API and returns the status
+// and body. Transient failures (network errors, 5xx) are retried with
+// backoff since MediaMTX briefly refuses API calls while reloading its
+// configuration.
+func (s *MediaMTXService) apiRequest(method, endpoint string, payload interface{}) (int, string, error) {
+	var data []byte
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to marshal MediaMTX request: %w", err)
+		}
+		data = encoded
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= patchAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * 500 * time.Millisecond)
+		}
+
+		req, err := http.NewRequest(method, s.apiURL(endpoint), bytes.NewReader(data))
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to create request: %w", err)
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := s.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("MediaMTX API error (status %d): %s", resp.StatusCode, string(body))
+			continue
+		}
+		return resp.StatusCode, string(body), nil
+	}
+	return 0, "", lastErr
+}
+
+// listPaths returns the paths known to MediaMTX keyed by name.
+// Handles both the map ("items": {name: {...}}) and list ("items": [{name: ...}]) formats,
+// and the pages of /v3.
+func (s *MediaMTXService) listPaths() (map[string]map[string]interface{}, error) {
+	version, err := s.APIVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]map[string]interface{})
+	for page := 0; ; page++ {
+		statusURL := s.apiURL("/v2/paths/list")
+		if version == MediaMTXAPIV3 {
+			statusURL = s.apiURL(fmt.Sprintf("/v3/paths/list?itemsPerPage=%d&page=%d", mediaMTXPathsPerPage, page))
+		}
+
+		resp, err := s.httpClient.Get(statusURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check MediaMTX path status: %w", err)
+		}
+		var pathsResponse struct {
+			PageCount int             `json:"pageCount"`
+			Items     json.RawMessage `json:"items"`
+		}
+		status := resp.StatusCode
+		if status == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&pathsResponse)
+		}
+		resp.Body.Close()
+
+		if status == http.StatusNotFound && s.config.APIVersion == MediaMTXAPIAuto {
+			// MediaMTX was replaced by a version with the other API
+			s.forgetAPIVersion()
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("MediaMTX API error (status %d)", status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode MediaMTX response: %w", err)
+		}
+		if err := decodePathItems(pathsResponse.Items, paths); err != nil {
+			return nil, err
+		}
+
+		if version != MediaMTXAPIV3 || page+1 >= pathsResponse.PageCount {
+			return paths, nil
+		}
+	}
+}
+
+func decodePathItems(items json.RawMessage, paths map[string]map[string]interface{}) error {
+	var byName map[string]map[string]interface{}
+	if err := json.Unmarshal(items, &byName); err == nil {
+		for name, item := range byName {
+			paths[name] = item
+		}
+		return nil
+	}
+
+	var list []map[string]interface{}
+	if err := json.Unmarshal(items, &list); err != nil {
+		return fmt.Errorf("failed to decode MediaMTX path list: %w", err)
+	}
+	for _, item := range list {
+		if name, ok := item["name"].(string); ok {
+			paths[name] = item
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+)
+
+// MediaMTXReconcileResult is what one reconciliation changed
+type MediaMTXReconcileResult struct {
+	Removed    []string `json:"removed"`            // Orphan camera paths removed from MediaMTX
+	Registered []uint   `json:"registered"`         // Streaming cameras whose path was registered again
+	Failed     []uint   `json:"failed,omitempty"`   // Streaming cameras whose path couldn't be registered
+	Unmarked   []uint   `json:"unmarked,omitempty"` // Deleted cameras no longer marked as streaming
+}
+
+// StartReconciler reconciles the camera paths and the auth callback with
+// MediaMTX now and every ReconcileInterval, so both survive a backend or
+// MediaMTX restart. The instances of a cluster share MediaMTX and the marks,
+// so only the leader runs it.
+func (s *MediaMTXService) StartReconciler(credentials *CredentialService) {
+	go func() {
+		s.reconcileLogged(credentials)
+		if s.config.ReconcileInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(s.config.ReconcileInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.reconcileLogged(credentials)
+		}
+	}()
+}
+
+func (s *MediaMTXService) reconcileLogged(credentials *CredentialService) {
+	if err := s.ConfigureAuth(); err != nil {
+		fmt.Printf("[MediaMTX] Warning: %v; HLS and WebRTC reads may not be checked\n", err)
+	}
+	result, err := s.Reconcile(credentials)
+	if err != nil {
+		fmt.Printf("[MediaMTX] Path reconciliation failed: %v\n", err)
+		return
+	}
+	if len(result.Removed)+len(result.Registered)+len(result.Failed)+len(result.Unmarked) > 0 {
+		fmt.Printf("[MediaMTX] Reconciled paths: removed %d orphan(s), re-registered %d camera(s), %d failed\n", len(result.Removed), len(result.Registered), len(result.Failed))
+	}
+}
+
+// Reconcile brings MediaMTX in line with the cameras marked as streaming:
+// cam<N> paths of cameras that aren't (deleted cameras, paths left by a
+// crashed backend) are removed, and marked cameras whose path this backend
+// doesn't know or MediaMTX lost are registered again. Paths not named after
+// a camera (load test sources, MediaMTX's own config) are left alone.
+func (s *MediaMTXService) Reconcile(credentials *CredentialService) (*MediaMTXReconcileResult, error) {
+	s.reconcileMu.Lock()
+	defer s.reconcileMu.Unlock()
+
+	// Paths first: a path another node adds meanwhile is marked by the time
+	// the marks are read
+	paths, err := s.listPaths()
+	if err != nil {
+		return nil, err
+	}
+	var marks []models.MediaMTXPath
+	if err := s.db.Find(&marks).Error; err != nil {
+		return nil, fmt.Errorf("failed to load streaming cameras: %w", err)
+	}
+
+	ids := make([]uint, 0, len(marks))
+	for _, mark := range marks {
+		ids = append(ids, mark.CameraID)
+	}
+	cameras := make(map[uint]*models.Camera, len(ids))
+	if len(ids) > 0 {
+		var found []models.Camera
+		if err := s.db.Where("id IN ?", ids).Find(&found).Error; err != nil {
+			return nil, fmt.Errorf("failed to load streaming cameras: %w", err)
+		}
+		for i := range found {
+			cameras[found[i].ID] = &found[i]
+		}
+	}
+
+	result := &MediaMTXReconcileResult{Removed: []string{}, Registered: []uint{}}
+	for name := range paths {
+		cameraID, ok := s.PathCamera(name)
+		if !ok || cameras[cameraID] != nil {
+			continue
+		}
+		removed, err := s.removeOrphan(cameraID, name)
+		if err != nil {
+			fmt.Printf("[MediaMTX] Failed to remove orphan path %s: %v\n", name, err)
+			continue
+		}
+		if removed {
+			result.Removed = append(result.Removed, name)
+		}
+	}
+
+	for _, mark := range marks {
+		camera := cameras[mark.CameraID]
+		if camera == nil {
+			s.syncMark(mark.CameraID)
+			result.Unmarked = append(result.Unmarked, mark.CameraID)
+			continue
+		}
+
+		_, inMediaMTX := paths[s.GetPathName(camera.ID)]
+		s.mu.Lock()
+		_, active := s.activePaths[camera.ID]
+		if active && !inMediaMTX {
+			// MediaMTX restarted and lost the path added through its API
+			delete(s.activePaths, camera.ID)
+			delete(s.pathInfo, camera.ID)
+			delete(s.pathConfigs, camera.ID)
+		}
+		s.mu.Unlock()
+		if active && inMediaMTX {
+			continue
+		}
+
+		if _, err := s.StartStream(camera.ID, credentials.StreamURL(camera)); err != nil {
+			fmt.Printf("[MediaMTX] Failed to re-register path for camera %d: %v\n", camera.ID, err)
+			result.Failed = append(result.Failed, camera.ID)
+			continue
+		}
+		result.Registered = append(result.Registered, camera.ID)
+	}
+
+	return result, nil
+}
+
+// PathCamera returns the camera a cam<N> path belongs to
+func (s *MediaMTXService) PathCamera(name string) (uint, bool) {
+	if !strings.HasPrefix(name, "cam") {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(name, "cam"), 10, 64)
+	if err != nil || s.GetPathName(uint(id)) != name {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// removeOrphan removes a camera path unless it was started since the
+// reconciliation began
+func (s *MediaMTXService) removeOrphan(cameraID uint, name string) (bool, error) {
+	pathLock := s.pathLock(cameraID)
+	pathLock.Lock()
+	defer pathLock.Unlock()
+
+	if _, active := s.GetStreamURL(cameraID); active {
+		return false, nil
+	}
+	if err := s.patchConfig(map[string]interface{}{
+		"paths": map[string]interface{}{
+			name: nil,
+		},
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// syncMark marks the camera as streaming when its path is configured, to
+// restore it after a restart, and unmarks it otherwise. Called after s.mu
+// is released; marks are written one at a time from the current state, so
+// the last write wins even when a start and a stop race. A failed write
+// only costs the restore.
+func (s *MediaMTXService) syncMark(cameraID uint) {
+	s.markMu.Lock()
+	defer s.markMu.Unlock()
+
+	s.mu.RLock()
+	pathName, active := s.activePaths[cameraID]
+	s.mu.RUnlock()
+
+	if active {
+		mark := models.MediaMTXPath{CameraID: cameraID, PathName: pathName}
+		if err := s.db.Save(&mark).Error; err != nil {
+			fmt.Printf("[MediaMTX] Failed to mark camera %d as streaming: %v\n", cameraID, err)
+		}
+		return
+	}
+	if err := s.db.Delete(&models.MediaMTXPath{}, "camera_id = ?", cameraID).Error; err != nil {
+		fmt.Printf("[MediaMTX] Failed to unmark camera %d as streaming: %v\n", cameraID, err)
+	}
+}
@@ -1,29 +1,108 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/subtle"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/tracing"
+
+	"gorm.io/gorm"
 )
 
 type MediaMTXService struct {
 	config      config.MediaMTXConfig
+	watchdog    config.WatchdogConfig
+	db          *gorm.DB
+	events      *EventService
 	httpClient  *http.Client
 	activePaths map[uint]string // camera_id -> path_name
 	mu          sync.RWMutex
+	pathInfo    map[uint]*PathInfo    // camera_id -> codec negotiation result
+	pathConfigs map[uint]PathConfig   // camera_id -> config pushed to MediaMTX
+	probes      map[uint]*cachedProbe // camera_id -> last RTSP probe
+	probesMu    sync.Mutex
+	pathLocks   map[uint]*sync.Mutex // camera_id -> serializes changes to its MediaMTX path
+	pathLocksMu sync.Mutex
+	reconcileMu sync.Mutex // Serializes reconciliations with MediaMTX
+	markMu      sync.Mutex // Serializes writes of the streaming marks (syncMark)
+	apiVersion  string     // Detected API version (v2, v3), empty until known
+	authApplied bool       // The auth callback is set in MediaMTX, as far as known
+	apiMu       sync.Mutex
+
+	// MediaMTX path list, polled every HealthInterval by the health poller
+	// so health endpoints never call the MediaMTX API themselves
+	pathsCache    map[string]map[string]interface{}
+	pathsErr      error
+	pathsPolledAt time.Time
+	pathsMu       sync.RWMutex
+	pollMu        sync.Mutex // Serializes polls when the poller falls behind
+
+	// Stream watchdog state per camera, updated after every health poll
+	watches map[uint]*pathWatch
+	watchMu sync.Mutex
+}
+
+// PathConfig is the MediaMTX path configuration for one camera, as sent to
+// the config patch API
+type PathConfig map[string]interface{}
+
+// PathInfo describes how a camera's MediaMTX path is being served
+type PathInfo struct {
+	VideoCodecs []string `json:"video_codecs,omitempty"`
+	Transcoding bool     `json:"transcoding"` // H.264 transcode via FFmpeg run by MediaMTX
+	Note        string   `json:"note,omitempty"`
 }
 
-func NewMediaMTXService(cfg config.MediaMTXConfig) *MediaMTXService {
+// StreamStatus is the detailed state of a camera's MediaMTX path
+type StreamStatus struct {
+	Healthy   bool         `json:"is_healthy"`
+	Ready     bool         `json:"ready"` // Source connected and publishing
+	Error     *StreamError `json:"error,omitempty"`
+	CheckedAt time.Time    `json:"checked_at"` // When MediaMTX was polled
+}
+
+// cachedProbe avoids probing a failing camera on every health request
+type cachedProbe struct {
+	result   *RTSPProbeResult
+	err      *StreamError
+	probedAt time.Time
+}
+
+// probeCacheTTL is how long an RTSP probe result is reused
+const probeCacheTTL = 15 * time.Second
+
+// staleHealthPolls is how many poll intervals the path list may be old
+// before a health request polls MediaMTX itself (e.g. poller not started)
+const staleHealthPolls = 3
+
+// hlsVideoCodecs are the codecs MediaMTX can serve over the mpegts HLS variant
+var hlsVideoCodecs = []string{"H264"}
+
+func NewMediaMTXService(cfg config.MediaMTXConfig, watchdog config.WatchdogConfig, db *gorm.DB, events *EventService) *MediaMTXService {
 	return &MediaMTXService{
-		config:      cfg,
-		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		config:   cfg,
+		watchdog: watchdog,
+		db:       db,
+		events:   events,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: faultTransport{apiHost: net.JoinHostPort(cfg.Host, cfg.APIPort)},
+		},
 		activePaths: make(map[uint]string),
+		pathInfo:    make(map[uint]*PathInfo),
+		pathConfigs: make(map[uint]PathConfig),
+		probes:      make(map[uint]*cachedProbe),
+		pathLocks:   make(map[uint]*sync.Mutex),
+		watches:     make(map[uint]*pathWatch),
 	}
 }
 
@@ -33,15 +112,48 @@ func (s *MediaMTXService) GetPathName(cameraID uint) string {
 }
 
 // StartStream configures a MediaMTX path for a camera and returns the HLS URL
-// MediaMTX will pull RTSP stream from the camera and serve it as HLS
+// MediaMTX will pull RTSP stream from the camera and serve it as HLS.
+// Cameras without a browser-playable codec (e.g. H.265-only) are transcoded
+// to H.264 by an FFmpeg process that MediaMTX runs on demand.
 func (s *MediaMTXService) StartStream(cameraID uint, rtspURL string) (string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.StartStreamContext(context.Background(), cameraID, rtspURL)
+}
+
+// StartStreamContext is StartStream recording the probe and the MediaMTX
+// API call in the trace of ctx
+func (s *MediaMTXService) StartStreamContext(ctx context.Context, cameraID uint, rtspURL string) (hlsURL string, err error) {
+	ctx, span := tracing.Start(ctx, "mediamtx.start_stream")
+	span.SetAttribute("camera.id", cameraID)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
 	// Check if path already exists
-	if pathName, exists := s.activePaths[cameraID]; exists {
-		// Use PublicHost for HLS URL so browser can access it
-		hlsURL := fmt.Sprintf("http://%s:%s/%s/index.m3u8", s.config.PublicHost, s.config.HTTPPort, pathName)
+	if hlsURL, exists := s.GetStreamURL(cameraID); exists {
+		span.SetAttribute("mediamtx.configured", true)
+		return hlsURL, nil
+	}
+
+	// Probe codecs before taking the lock, probing can take a few seconds
+	_, probeSpan := tracing.StartClient(ctx, "rtsp.probe")
+	info := s.negotiateCodec(cameraID, rtspURL)
+	probeSpan.SetAttribute("rtsp.video_codecs", strings.Join(info.VideoCodecs, ","))
+	probeSpan.SetAttribute("mediamtx.transcoding", info.Transcoding)
+	if info.Note != "" {
+		probeSpan.SetAttribute("mediamtx.note", info.Note)
+	}
+	probeSpan.End()
+
+	// The MediaMTX API call retries for up to half a minute, so only this
+	// camera's path lock is held across it, not s.mu
+	defer s.syncMark(cameraID) // Runs once the path lock is released
+	pathLock := s.pathLock(cameraID)
+	pathLock.Lock()
+	defer pathLock.Unlock()
+
+	if hlsURL, exists := s.GetStreamURL(cameraID); exists {
+		span.SetAttribute("mediamtx.configured", true)
 		return hlsURL, nil
 	}
 
@@ -49,7 +161,7 @@ func (s *MediaMTXService) StartStream(cameraID uint, rtspURL string) (string, er
 
 	// Configure path in MediaMTX via API
 	// MediaMTX uses config patch API to add paths dynamically
-	pathConfig := map[string]interface{}{
+	pathConfig := PathConfig{
 		"source":                     rtspURL,
 		"sourceOnDemand":             true,
 		"sourceOnDemandStartTimeout": "10s",
@@ -57,6 +169,18 @@ func (s *MediaMTXService) StartStream(cameraID uint, rtspURL string) (string, er
 		"sourceProtocol":             "tcp",
 		"sourceAnyPortEnable":        false,
 	}
+	if info.Transcoding {
+		// The path is published by FFmpeg instead of pulled from the camera
+		pathConfig = PathConfig{
+			"source":                  "publisher",
+			"runOnDemand":             s.transcodeCommand(rtspURL),
+			"runOnDemandRestart":      true,
+			"runOnDemandStartTimeout": "15s",
+			"runOnDemandCloseAfter":   "10s",
+		}
+	}
+
+	pathConfig = s.withStartTimeout(cameraID, pathConfig)
 
 	// Use config patch API to add path
 	// Format: {"paths": {"pathName": {...config...}}}
@@ -66,48 +190,219 @@ func (s *MediaMTXService) StartStream(cameraID uint, rtspURL string) (string, er
 		},
 	}
 
-	configJSON, err := json.Marshal(patchConfig)
+	_, patchSpan := tracing.StartClient(ctx, "mediamtx.config_patch")
+	patchSpan.SetAttribute("mediamtx.path", pathName)
+	err = s.patchConfig(patchConfig)
+	patchSpan.RecordError(err)
+	patchSpan.End()
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal path config: %w", err)
+		return "", fmt.Errorf("failed to configure MediaMTX path: %w", err)
 	}
 
-	// MediaMTX v2 API: POST /v2/config/patch
-	configURL := fmt.Sprintf("http://%s:%s/v2/config/patch", s.config.Host, s.config.APIPort)
+	// Store active path
+	s.mu.Lock()
+	s.activePaths[cameraID] = pathName
+	s.pathInfo[cameraID] = info
+	s.pathConfigs[cameraID] = pathConfig
+	s.mu.Unlock()
 
-	req, err := http.NewRequest("POST", configURL, bytes.NewBuffer(configJSON))
+	// Construct HLS URL using PublicHost so browser can access it
+	hlsURL = s.hlsURL(pathName)
+
+	fmt.Printf("[MediaMTX] Path configured for camera %d: %s (RTSP: %s, codecs: %v, transcoding: %v) -> HLS: %s\n", cameraID, pathName, StripURLCredentials(rtspURL), info.VideoCodecs, info.Transcoding, hlsURL)
+
+	return hlsURL, nil
+}
+
+// IsMediaMTXAddress reports whether ip is one of the MediaMTX host's
+// addresses, e.g. to accept its auth callbacks only from MediaMTX itself
+func (s *MediaMTXService) IsMediaMTXAddress(ip string) bool {
+	addrs, err := net.LookupHost(s.config.Host)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return false
+	}
+	for _, addr := range addrs {
+		if net.ParseIP(addr).Equal(net.ParseIP(ip)) {
+			return true
+		}
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return false
+}
 
-	resp, err := s.httpClient.Do(req)
+// IsInternalClient reports whether a MediaMTX client is the backend or
+// MediaMTX itself, which the auth callback lets through without a token:
+// it signs in with the internal credentials, or connects from loopback (the
+// FFmpegs MediaMTX runs), the MediaMTX host or this backend's own host
+func (s *MediaMTXService) IsInternalClient(user, password, ip string) bool {
+	if s.config.InternalPassword != "" &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(s.config.InternalUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.config.InternalPassword)) == 1 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	if addr.IsLoopback() || s.IsMediaMTXAddress(ip) {
+		return true
+	}
+	local, err := net.InterfaceAddrs()
 	if err != nil {
-		return "", fmt.Errorf("failed to configure MediaMTX path: %w", err)
+		return false
 	}
-	defer resp.Body.Close()
+	for _, a := range local {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hlsURL returns the browser-facing HLS URL for a path
+func (s *MediaMTXService) hlsURL(pathName string) string {
+	return fmt.Sprintf("http://%s:%s/%s/index.m3u8", s.config.PublicHost, s.config.HTTPPort, pathName)
+}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("MediaMTX API error (status %d): %s", resp.StatusCode, string(body))
+// negotiateCodec probes the camera and decides whether its stream can be
+// served as-is or has to be transcoded to H.264 for browser playback
+func (s *MediaMTXService) negotiateCodec(cameraID uint, rtspURL string) *PathInfo {
+	result, probeErr := s.probe(cameraID, rtspURL)
+	if probeErr != nil {
+		// Can't tell - configure a plain path, health checks will report the error
+		return &PathInfo{Note: "codec detection failed: " + probeErr.Message}
 	}
 
-	// Store active path
-	s.activePaths[cameraID] = pathName
+	info := &PathInfo{VideoCodecs: result.VideoCodecs}
+	switch {
+	case hasAnyCodec(result.VideoCodecs, hlsVideoCodecs):
+	case s.config.HEVCPassthrough && hasAnyCodec(result.VideoCodecs, []string{"H265"}):
+		info.Note = "serving H.265 as-is (fMP4 HLS), requires a browser with HEVC support"
+	case len(result.VideoCodecs) == 0:
+		info.Note = "camera advertises no video track"
+	case s.config.TranscodeUnsupported:
+		info.Transcoding = true
+		info.Note = fmt.Sprintf("camera codec %v is not playable in browsers, transcoding to H.264", result.VideoCodecs)
+	default:
+		info.Note = fmt.Sprintf("camera codec %v is not playable in browsers and transcoding is disabled", result.VideoCodecs)
+	}
+	return info
+}
 
-	// Construct HLS URL using PublicHost so browser can access it
-	hlsURL := fmt.Sprintf("http://%s:%s/%s/index.m3u8", s.config.PublicHost, s.config.HTTPPort, pathName)
+// transcodeCommand is the FFmpeg command MediaMTX runs to publish an H.264
+// version of the camera stream. $RTSP_PORT and $MTX_PATH are set by MediaMTX.
+// MediaMTX splits the command like a shell, so the URL is single-quoted to
+// stay one argument whatever spaces or quotes it contains.
+func (s *MediaMTXService) transcodeCommand(rtspURL string) string {
+	return fmt.Sprintf(
+		"ffmpeg -hide_banner -loglevel error -rtsp_transport tcp -i %s "+
+			"-c:v libx264 -preset veryfast -tune zerolatency -profile:v baseline -pix_fmt yuv420p -g 50 "+
+			"-c:a aac -b:a 64k -f rtsp rtsp://localhost:$RTSP_PORT/$MTX_PATH",
+		shellQuote(rtspURL),
+	)
+}
 
-	fmt.Printf("[MediaMTX] Path configured for camera %d: %s (RTSP: %s) -> HLS: %s\n", cameraID, pathName, rtspURL, hlsURL)
+// shellQuote single-quotes s for shell-style word splitting
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
 
-	return hlsURL, nil
+// IngestURL returns the RTSP URL backend pipelines read a camera from. With
+// SharedIngest that is the camera's MediaMTX path, configured on demand, so
+// HLS viewers and backend FFmpegs share MediaMTX's single pull from cameras
+// that throttle or drop concurrent RTSP clients. When the path can't be
+// configured the camera is read directly.
+func (s *MediaMTXService) IngestURL(cameraID uint, rtspURL string) string {
+	return s.IngestURLContext(context.Background(), cameraID, rtspURL)
+}
+
+// IngestURLContext is IngestURL tracing the path configuration in ctx
+func (s *MediaMTXService) IngestURLContext(ctx context.Context, cameraID uint, rtspURL string) string {
+	if !s.config.SharedIngest {
+		return rtspURL
+	}
+	if _, err := s.StartStreamContext(ctx, cameraID, rtspURL); err != nil {
+		fmt.Printf("[MediaMTX] Shared ingest unavailable for camera %d, reading it directly: %v\n", cameraID, err)
+		return rtspURL
+	}
+	ingestURL := s.InternalRTSPURL(s.GetPathName(cameraID))
+	if s.config.InternalPassword != "" {
+		if u, err := url.Parse(ingestURL); err == nil {
+			u.User = url.UserPassword(s.config.InternalUser, s.config.InternalPassword)
+			ingestURL = u.String()
+		}
+	}
+	return ingestURL
+}
+
+// SourceReady reports whether MediaMTX was pulling the camera at the last
+// health poll, without connecting to the camera
+func (s *MediaMTXService) SourceReady(cameraID uint) bool {
+	s.mu.RLock()
+	pathName, exists := s.activePaths[cameraID]
+	s.mu.RUnlock()
+	if !exists {
+		return false
+	}
+
+	paths, _, err := s.cachedPaths()
+	if err != nil {
+		return false
+	}
+	item, ok := paths[pathName]
+	return ok && pathReady(item)
+}
+
+// GetPathReaders returns how many readers (HLS muxer, WebRTC and RTSP
+// sessions, the backend's own FFmpegs) a camera's path had at the last
+// health poll; false when that isn't known
+func (s *MediaMTXService) GetPathReaders(cameraID uint) (int, bool) {
+	s.mu.RLock()
+	pathName, exists := s.activePaths[cameraID]
+	s.mu.RUnlock()
+	if !exists {
+		return 0, false
+	}
+
+	paths, _, err := s.cachedPaths()
+	if err != nil {
+		return 0, false
+	}
+	item, ok := paths[pathName]
+	if !ok {
+		return 0, true
+	}
+	readers, _ := item["readers"].([]interface{})
+	return len(readers), true
+}
+
+// RefreshStream reconfigures an active path with a new source URL, e.g. after
+// the camera's credentials were rotated. Viewers reconnect after a short gap.
+func (s *MediaMTXService) RefreshStream(cameraID uint, rtspURL string) (string, error) {
+	if err := s.StopStream(cameraID); err != nil {
+		return "", err
+	}
+	return s.StartStream(cameraID, rtspURL)
+}
+
+// GetPathInfo returns how a camera's path is being served (codecs, transcoding)
+func (s *MediaMTXService) GetPathInfo(cameraID uint) (*PathInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, exists := s.pathInfo[cameraID]
+	return info, exists
 }
 
 // StopStream removes a MediaMTX path for a camera
 func (s *MediaMTXService) StopStream(cameraID uint) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.syncMark(cameraID) // Runs once the path lock is released
+	pathLock := s.pathLock(cameraID)
+	pathLock.Lock()
+	defer pathLock.Unlock()
 
+	s.mu.RLock()
 	pathName, exists := s.activePaths[cameraID]
+	s.mu.RUnlock()
 	if !exists {
 		return fmt.Errorf("stream not found for camera %d", cameraID)
 	}
@@ -120,34 +415,115 @@ func (s *MediaMTXService) StopStream(cameraID uint) error {
 		},
 	}
 
-	configJSON, err := json.Marshal(patchConfig)
-	if err != nil {
-		return fmt.Errorf("failed to marshal patch config: %w", err)
+	if err := s.patchConfig(patchConfig); err != nil {
+		return fmt.Errorf("failed to remove MediaMTX path: %w", err)
 	}
 
-	configURL := fmt.Sprintf("http://%s:%s/v2/config/patch", s.config.Host, s.config.APIPort)
+	s.mu.Lock()
+	delete(s.activePaths, cameraID)
+	delete(s.pathInfo, cameraID)
+	delete(s.pathConfigs, cameraID)
+	s.mu.Unlock()
+	fmt.Printf("[MediaMTX] Path removed for camera %d: %s\n", cameraID, pathName)
 
-	req, err := http.NewRequest("POST", configURL, bytes.NewBuffer(configJSON))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	return nil
+}
+
+// pathLock returns the lock serializing MediaMTX config changes of a
+// camera's path. It is held across the MediaMTX API calls, which s.mu is not,
+// so a slow MediaMTX only blocks changes to the same camera.
+func (s *MediaMTXService) pathLock(cameraID uint) *sync.Mutex {
+	s.pathLocksMu.Lock()
+	defer s.pathLocksMu.Unlock()
+
+	lock, exists := s.pathLocks[cameraID]
+	if !exists {
+		lock = &sync.Mutex{}
+		s.pathLocks[cameraID] = lock
+	}
+	return lock
+}
+
+// WaitForReady blocks until the camera's HLS playlist has at least one
+// segment, or the timeout expires. Requesting the playlist also triggers
+// on-demand sources, so this doubles as a "start pulling now".
+func (s *MediaMTXService) WaitForReady(cameraID uint, timeout time.Duration) bool {
+	return s.WaitForReadyContext(context.Background(), cameraID, timeout)
+}
+
+// WaitForReadyContext is WaitForReady recording the wait in the trace of ctx
+func (s *MediaMTXService) WaitForReadyContext(ctx context.Context, cameraID uint, timeout time.Duration) (ready bool) {
+	_, span := tracing.Start(ctx, "mediamtx.wait_ready")
+	span.SetAttribute("camera.id", cameraID)
+	defer func() {
+		span.SetAttribute("mediamtx.ready", ready)
+		span.End()
+	}()
+
+	s.mu.RLock()
+	pathName, exists := s.activePaths[cameraID]
+	s.mu.RUnlock()
+	if !exists {
+		return false
+	}
+
+	// Use internal host - this request comes from the backend, not the browser
+	baseURL := fmt.Sprintf("http://%s:%s/%s/", s.config.Host, s.config.HTTPPort, pathName)
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		if s.playlistHasSegments(baseURL, deadline) {
+			return true
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return false
+}
+
+// playlistHasSegments fetches the multivariant playlist, follows it to the
+// first media playlist and checks that it lists a segment
+func (s *MediaMTXService) playlistHasSegments(baseURL string, deadline time.Time) bool {
+	index, ok := s.fetchPlaylist(baseURL+"index.m3u8", deadline)
+	if !ok {
+		return false
+	}
+	if strings.Contains(index, "#EXTINF") {
+		return true
+	}
+
+	for _, line := range strings.Split(index, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		media, ok := s.fetchPlaylist(baseURL+line, deadline)
+		return ok && strings.Contains(media, "#EXTINF")
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return false
+}
 
+func (s *MediaMTXService) fetchPlaylist(playlistURL string, deadline time.Time) (string, bool) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", playlistURL, nil)
+	if err != nil {
+		return "", false
+	}
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to remove MediaMTX path: %w", err)
+		return "", false
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("MediaMTX API error (status %d): %s", resp.StatusCode, string(body))
+		return "", false
 	}
-
-	delete(s.activePaths, cameraID)
-	fmt.Printf("[MediaMTX] Path removed for camera %d: %s\n", cameraID, pathName)
-
-	return nil
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", false
+	}
+	return string(body), true
 }
 
 // GetStreamURL returns the HLS URL for a camera if the stream is active
@@ -161,8 +537,7 @@ func (s *MediaMTXService) GetStreamURL(cameraID uint) (string, bool) {
 	}
 
 	// Use PublicHost for HLS URL so browser can access it
-	hlsURL := fmt.Sprintf("http://%s:%s/%s/index.m3u8", s.config.PublicHost, s.config.HTTPPort, pathName)
-	return hlsURL, true
+	return s.hlsURL(pathName), true
 }
 
 // GetStreamHealth checks if a MediaMTX path is active and healthy
@@ -175,80 +550,190 @@ func (s *MediaMTXService) GetStreamHealth(cameraID uint) (bool, error) {
 		return false, fmt.Errorf("stream not found for camera %d", cameraID)
 	}
 
-	// Check path status via MediaMTX API
-	statusURL := fmt.Sprintf("http://%s:%s/v2/paths/list", s.config.Host, s.config.APIPort)
-
-	resp, err := s.httpClient.Get(statusURL)
+	paths, _, err := s.cachedPaths()
 	if err != nil {
-		return false, fmt.Errorf("failed to check MediaMTX path status: %w", err)
+		return false, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("MediaMTX API error (status %d)", resp.StatusCode)
-	}
+	_, exists = paths[pathName]
+	return exists, nil
+}
 
-	var pathsResponse map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&pathsResponse); err != nil {
-		return false, fmt.Errorf("failed to decode MediaMTX response: %w", err)
+// GetAllStreamHealth returns, for every configured camera, whether MediaMTX
+// has a ready source, from the last health poll
+func (s *MediaMTXService) GetAllStreamHealth() map[uint]bool {
+	paths, _, err := s.cachedPaths()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	health := make(map[uint]bool, len(s.activePaths))
+	for cameraID, pathName := range s.activePaths {
+		// If the poll failed, every camera is reported unhealthy
+		item, exists := paths[pathName]
+		health[cameraID] = err == nil && exists && pathReady(item)
 	}
+	return health
+}
 
-	// Check if path exists in response
-	if paths, ok := pathsResponse["items"].(map[string]interface{}); ok {
-		if _, exists := paths[pathName]; exists {
-			return true, nil
+// StartHealthPoller polls the MediaMTX path list every HealthInterval and
+// runs the stream watchdog on it
+func (s *MediaMTXService) StartHealthPoller() {
+	interval := s.config.HealthInterval
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.pollPaths(0)
+			s.watchPaths(time.Now())
+			<-ticker.C
 		}
+	}()
+}
+
+// pollPaths refreshes the cached MediaMTX path list, unless another poll
+// made it younger than maxAge while waiting for the lock
+func (s *MediaMTXService) pollPaths(maxAge time.Duration) {
+	s.pollMu.Lock()
+	defer s.pollMu.Unlock()
+
+	if maxAge > 0 && time.Since(s.HealthCheckedAt()) <= maxAge {
+		return
 	}
+	paths, err := s.listPaths()
 
-	return false, nil
+	s.pathsMu.Lock()
+	defer s.pathsMu.Unlock()
+	if err != nil && s.pathsErr == nil {
+		fmt.Printf("[MediaMTX] Health poll failed: %v\n", err)
+	}
+	s.pathsErr = err
+	if err == nil {
+		s.pathsCache = paths
+	}
+	s.pathsPolledAt = time.Now()
 }
 
-// GetAllStreamHealth returns health status of all active streams
-func (s *MediaMTXService) GetAllStreamHealth() map[uint]bool {
+// cachedPaths returns the last polled path list and when it was polled. It
+// only polls inline when the cache is missing or stale.
+func (s *MediaMTXService) cachedPaths() (map[string]map[string]interface{}, time.Time, error) {
+	maxAge := staleHealthPolls * s.config.HealthInterval
+	if maxAge <= 0 {
+		maxAge = time.Second
+	}
+
+	if time.Since(s.HealthCheckedAt()) > maxAge {
+		s.pollPaths(maxAge)
+	}
+
+	s.pathsMu.RLock()
+	defer s.pathsMu.RUnlock()
+	return s.pathsCache, s.pathsPolledAt, s.pathsErr
+}
+
+// HealthCheckedAt returns when MediaMTX health was last polled
+func (s *MediaMTXService) HealthCheckedAt() time.Time {
+	s.pathsMu.RLock()
+	defer s.pathsMu.RUnlock()
+	return s.pathsPolledAt
+}
+
+// pathReady reports whether a MediaMTX path item has a connected source
+func pathReady(item map[string]interface{}) bool {
+	if ready, ok := item["sourceReady"].(bool); ok {
+		return ready
+	}
+	if ready, ok := item["ready"].(bool); ok {
+		return ready
+	}
+	return false
+}
+
+// GetStreamStatus returns the detailed status of a camera's path, with a
+// classified error reason when the stream isn't working. When MediaMTX
+// doesn't have a ready source, the camera is probed directly over RTSP to
+// find out why (MediaMTX only reports source errors in its logs).
+func (s *MediaMTXService) GetStreamStatus(cameraID uint, rtspURL string) StreamStatus {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	pathName, exists := s.activePaths[cameraID]
+	s.mu.RUnlock()
 
-	health := make(map[uint]bool)
+	if !exists {
+		return StreamStatus{Error: newStreamError(ReasonNotStarted, "mediamtx", fmt.Sprintf("stream not found for camera %d", cameraID))}
+	}
 
-	// Get all paths from MediaMTX
-	statusURL := fmt.Sprintf("http://%s:%s/v2/paths/list", s.config.Host, s.config.APIPort)
-	resp, err := s.httpClient.Get(statusURL)
+	paths, checkedAt, err := s.cachedPaths()
 	if err != nil {
-		// If API call fails, mark all as unhealthy
-		for cameraID := range s.activePaths {
-			health[cameraID] = false
-		}
-		return health
+		return StreamStatus{Error: newStreamError(ReasonMediaMTXUnavailable, "mediamtx", err.Error()), CheckedAt: checkedAt}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		for cameraID := range s.activePaths {
-			health[cameraID] = false
-		}
-		return health
+	item, inMediaMTX := paths[pathName]
+	status := StreamStatus{Healthy: inMediaMTX, CheckedAt: checkedAt}
+	if inMediaMTX && pathReady(item) {
+		status.Ready = true
+		return status
 	}
-
-	var pathsResponse map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&pathsResponse); err != nil {
-		for cameraID := range s.activePaths {
-			health[cameraID] = false
-		}
-		return health
+	if !inMediaMTX {
+		status.Error = newStreamError(ReasonNotStarted, "mediamtx", fmt.Sprintf("path %s is not configured in MediaMTX", pathName))
 	}
 
-	// Build map of active paths from MediaMTX
-	activePaths := make(map[string]bool)
-	if paths, ok := pathsResponse["items"].(map[string]interface{}); ok {
-		for pathName := range paths {
-			activePaths[pathName] = true
-		}
+	// On-demand paths are not ready until someone watches, so an idle path
+	// with a reachable, compatible camera is not an error
+	result, probeErr := s.probe(cameraID, rtspURL)
+	if probeErr != nil {
+		status.Error = probeErr
+		return status
+	}
+	s.mu.RLock()
+	info := s.pathInfo[cameraID]
+	s.mu.RUnlock()
+	if info != nil && (info.Transcoding || (s.config.HEVCPassthrough && hasAnyCodec(result.VideoCodecs, []string{"H265"}))) {
+		return status
 	}
+	if !hasAnyCodec(result.VideoCodecs, hlsVideoCodecs) {
+		status.Error = newStreamError(ReasonCodecUnsupported, "probe",
+			fmt.Sprintf("camera video codecs %v cannot be served as HLS (supported: %v)", result.VideoCodecs, hlsVideoCodecs))
+	}
+	return status
+}
 
-	// Check each camera's path
-	for cameraID, pathName := range s.activePaths {
-		health[cameraID] = activePaths[pathName]
+// Reprobe replaces a camera's cached probe with a fresh one, e.g. after its
+// URL changed, so the next path configuration uses the new codecs
+func (s *MediaMTXService) Reprobe(cameraID uint, rtspURL string) (*RTSPProbeResult, *StreamError) {
+	s.probesMu.Lock()
+	delete(s.probes, cameraID)
+	s.probesMu.Unlock()
+	return s.probe(cameraID, rtspURL)
+}
+
+// probe returns a cached RTSP probe for a camera, refreshing it when stale
+func (s *MediaMTXService) probe(cameraID uint, rtspURL string) (*RTSPProbeResult, *StreamError) {
+	s.probesMu.Lock()
+	cached, ok := s.probes[cameraID]
+	s.probesMu.Unlock()
+	if ok && time.Since(cached.probedAt) < probeCacheTTL {
+		return cached.result, cached.err
 	}
 
-	return health
+	result, probeErr := ProbeRTSP(rtspURL, 5*time.Second)
+
+	s.probesMu.Lock()
+	s.probes[cameraID] = &cachedProbe{result: result, err: probeErr, probedAt: time.Now()}
+	s.probesMu.Unlock()
+
+	return result, probeErr
+}
+
+func hasAnyCodec(codecs, supported []string) bool {
+	for _, codec := range codecs {
+		for _, ok := range supported {
+			if codec == ok {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mediaMTXSnapshotVersion is bumped when the snapshot format changes
+const mediaMTXSnapshotVersion = 1
+
+// MediaMTXSnapshot is the path configuration this backend manages in
+// MediaMTX, for restoring the streaming layer without its yml on disk.
+// Source URLs include camera credentials, so treat it as a secret.
+type MediaMTXSnapshot struct {
+	Version     int                `json:"version"`
+	GeneratedAt time.Time          `json:"generated_at"`
+	Paths       []MediaMTXPathSnap `json:"paths"`
+}
+
+// MediaMTXPathSnap is one managed path
+type MediaMTXPathSnap struct {
+	CameraID uint       `json:"camera_id"`
+	Path     string     `json:"path"`
+	Config   PathConfig `json:"config"`
+	Info     *PathInfo  `json:"info,omitempty"`
+	Live     bool       `json:"live"` // Present in MediaMTX when the snapshot was taken
+}
+
+// importablePathKeys are the path settings a snapshot may set: the source
+// and recording ones. Anything else, notably the run* hooks MediaMTX
+// executes on its host, is refused.
+var importablePathKeys = map[string]bool{
+	"source":                     true,
+	"sourceOnDemand":             true,
+	"sourceOnDemandStartTimeout": true,
+	"sourceOnDemandCloseAfter":   true,
+	"sourceProtocol":             true,
+	"sourceAnyPortEnable":        true,
+	"record":                     true,
+	"recordPath":                 true,
+	"recordFormat":               true,
+	"recordPartDuration":         true,
+	"recordSegmentDuration":      true,
+	"recordDeleteAfter":          true,
+}
+
+// importablePathConfig checks a snapshot path config against
+// importablePathKeys and that it pulls from an RTSP source. Transcoded
+// paths are published by a runOnDemand FFmpeg, so they can't be imported;
+// starting the camera's stream configures them again.
+func importablePathConfig(config PathConfig) error {
+	if len(config) == 0 {
+		return fmt.Errorf("empty path config")
+	}
+	for key := range config {
+		if !importablePathKeys[key] {
+			return fmt.Errorf("path setting %q can't be imported", key)
+		}
+	}
+	source, _ := config["source"].(string)
+	if !strings.HasPrefix(source, "rtsp://") && !strings.HasPrefix(source, "rtsps://") {
+		return fmt.Errorf("path source must be an rtsp:// or rtsps:// URL")
+	}
+	return nil
+}
+
+// ExportSnapshot returns the managed path configuration. Live is only
+// filled in when MediaMTX answers; the snapshot itself comes from memory.
+func (s *MediaMTXService) ExportSnapshot() *MediaMTXSnapshot {
+	live, err := s.listPaths()
+	if err != nil {
+		fmt.Printf("[MediaMTX] Snapshot taken without live state: %v\n", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot := &MediaMTXSnapshot{
+		Version:     mediaMTXSnapshotVersion,
+		GeneratedAt: time.Now(),
+		Paths:       make([]MediaMTXPathSnap, 0, len(s.activePaths)),
+	}
+	for cameraID, pathName := range s.activePaths {
+		_, isLive := live[pathName]
+		snapshot.Paths = append(snapshot.Paths, MediaMTXPathSnap{
+			CameraID: cameraID,
+			Path:     pathName,
+			Config:   s.pathConfigs[cameraID],
+			Info:     s.pathInfo[cameraID],
+			Live:     isLive,
+		})
+	}
+	return snapshot
+}
+
+// ImportSnapshot pushes every path of a snapshot to MediaMTX, replacing any
+// existing configuration of those paths, and adopts them as managed paths.
+// Paths are applied one by one so a bad entry doesn't block the rest; the
+// returned map has the error of each path that failed.
+func (s *MediaMTXService) ImportSnapshot(snapshot *MediaMTXSnapshot) (int, map[string]string) {
+	failed := make(map[string]string)
+	if snapshot.Version != mediaMTXSnapshotVersion {
+		failed["snapshot"] = fmt.Sprintf("unsupported snapshot version %d", snapshot.Version)
+		return 0, failed
+	}
+
+	applied := 0
+	for _, path := range snapshot.Paths {
+		if path.Path != s.GetPathName(path.CameraID) {
+			failed[path.Path] = fmt.Sprintf("path name does not match camera %d", path.CameraID)
+			continue
+		}
+		if err := importablePathConfig(path.Config); err != nil {
+			failed[path.Path] = err.Error()
+			continue
+		}
+
+		// Remove first so keys of a previous config (e.g. runOnDemand of a
+		// transcoded path) don't linger after the merge
+		pathLock := s.pathLock(path.CameraID)
+		pathLock.Lock()
+		if err := s.patchConfig(map[string]interface{}{
+			"paths": map[string]interface{}{path.Path: nil},
+		}); err != nil {
+			pathLock.Unlock()
+			failed[path.Path] = err.Error()
+			continue
+		}
+		if err := s.patchConfig(map[string]interface{}{
+			"paths": map[string]interface{}{path.Path: path.Config},
+		}); err != nil {
+			failed[path.Path] = err.Error()
+			s.mu.Lock()
+			delete(s.activePaths, path.CameraID)
+			delete(s.pathInfo, path.CameraID)
+			delete(s.pathConfigs, path.CameraID)
+			s.mu.Unlock()
+			pathLock.Unlock()
+			s.syncMark(path.CameraID)
+			continue
+		}
+
+		info := &PathInfo{}
+		if path.Info != nil {
+			info = &PathInfo{VideoCodecs: path.Info.VideoCodecs, Note: path.Info.Note}
+		}
+		s.mu.Lock()
+		s.activePaths[path.CameraID] = path.Path
+		s.pathInfo[path.CameraID] = info
+		s.pathConfigs[path.CameraID] = path.Config
+		s.mu.Unlock()
+		pathLock.Unlock()
+		s.syncMark(path.CameraID)
+		applied++
+	}
+
+	fmt.Printf("[MediaMTX] Snapshot imported: %d paths applied, %d failed\n", applied, len(failed))
+	return applied, failed
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+)
+
+// pathWatch is what the watchdog tracks of one camera's MediaMTX path
+// between health polls. The baseline is kept while the path is stopped and
+// configured again.
+type pathWatch struct {
+	baseline streamBaseline
+	ready    bool
+	bytes    float64   // bytesReceived at the last poll
+	grewAt   time.Time // Poll bytesReceived last grew at
+	demandAt time.Time // First poll with readers waiting for the source, zero when none are
+}
+
+// watchPaths runs the stream watchdog on the last polled path list. A
+// ready path whose bytesReceived stops growing for longer than the camera's
+// learned stall timeout is configured again, which reconnects its source.
+// Each camera's data cadence is learned from the polls its bytesReceived
+// grows at, and its reconnect time from readers waiting until the source is
+// ready; the latter sets the path's on-demand start timeout.
+func (s *MediaMTXService) watchPaths(now time.Time) {
+	s.pathsMu.RLock()
+	paths, err := s.pathsCache, s.pathsErr
+	s.pathsMu.RUnlock()
+	if err != nil {
+		// MediaMTX is down; restarting paths wouldn't help
+		return
+	}
+
+	s.mu.RLock()
+	active := make(map[uint]string, len(s.activePaths))
+	for cameraID, pathName := range s.activePaths {
+		active[cameraID] = pathName
+	}
+	s.mu.RUnlock()
+
+	var stalled []uint
+	s.watchMu.Lock()
+	for cameraID, pathName := range active {
+		item, exists := paths[pathName]
+		if !exists {
+			continue
+		}
+		watch := s.watchLocked(cameraID)
+		bytes, _ := item["bytesReceived"].(float64)
+		readers, _ := item["readers"].([]interface{})
+
+		switch {
+		case pathReady(item) && !watch.ready:
+			if !watch.demandAt.IsZero() {
+				watch.baseline.reconnect.add(now.Sub(watch.demandAt).Seconds())
+			}
+			watch.ready, watch.bytes, watch.grewAt, watch.demandAt = true, bytes, now, time.Time{}
+
+		case pathReady(item) && bytes > watch.bytes:
+			wasLearned := watch.baseline.cadence.learned()
+			watch.baseline.cadence.add(now.Sub(watch.grewAt).Seconds())
+			if !wasLearned && watch.baseline.cadence.learned() && s.watchdog.Adaptive {
+				fmt.Printf("[Watchdog] Learned camera %d: new data every %.1fs, restarting its MediaMTX path after %v without any\n",
+					cameraID, watch.baseline.cadence.mean, watch.baseline.stallTimeout(s.watchdog).Round(time.Second))
+			}
+			watch.bytes, watch.grewAt = bytes, now
+
+		case pathReady(item):
+			if idle, limit := now.Sub(watch.grewAt), watch.baseline.stallTimeout(s.watchdog); idle > limit {
+				fmt.Printf("[Watchdog] MediaMTX path of camera %d received nothing for %v (limit %v), restarting it\n",
+					cameraID, idle.Round(time.Second), limit.Round(time.Second))
+				stalled = append(stalled, cameraID)
+				watch.ready, watch.demandAt = false, now
+			}
+
+		case len(readers) > 0:
+			watch.ready = false
+			if watch.demandAt.IsZero() {
+				watch.demandAt = now
+			}
+
+		default:
+			watch.ready, watch.demandAt = false, time.Time{}
+		}
+	}
+	s.watchMu.Unlock()
+
+	for _, cameraID := range stalled {
+		s.restartPath(cameraID)
+	}
+}
+
+// watchLocked returns the camera's watch state, creating it. Caller holds
+// watchMu.
+func (s *MediaMTXService) watchLocked(cameraID uint) *pathWatch {
+	watch, exists := s.watches[cameraID]
+	if !exists {
+		watch = &pathWatch{}
+		s.watches[cameraID] = watch
+	}
+	return watch
+}
+
+// restartPath removes a camera's path from MediaMTX and adds it again with
+// the same source, so MediaMTX reconnects to the camera
+func (s *MediaMTXService) restartPath(cameraID uint) {
+	pathLock := s.pathLock(cameraID)
+	pathLock.Lock()
+	s.mu.RLock()
+	pathName, exists := s.activePaths[cameraID]
+	pathConfig := s.pathConfigs[cameraID]
+	s.mu.RUnlock()
+	pathConfig = s.withStartTimeout(cameraID, pathConfig)
+	if !exists || pathConfig == nil {
+		pathLock.Unlock()
+		return
+	}
+	err := s.patchConfig(map[string]interface{}{"paths": map[string]interface{}{pathName: nil}})
+	if err == nil {
+		err = s.patchConfig(map[string]interface{}{"paths": map[string]interface{}{pathName: pathConfig}})
+	}
+	if err == nil {
+		s.mu.Lock()
+		s.pathConfigs[cameraID] = pathConfig
+		s.mu.Unlock()
+	}
+	pathLock.Unlock()
+
+	if err != nil {
+		fmt.Printf("[Watchdog] Failed to restart MediaMTX path of camera %d: %v\n", cameraID, err)
+		return
+	}
+	if s.events != nil {
+		go s.events.Record(&models.Event{
+			CameraID:    &cameraID,
+			Type:        "stream_restart",
+			Severity:    "warning",
+			Source:      "mediamtx",
+			Description: "MediaMTX path restarted: the camera stopped sending data",
+		}, nil)
+	}
+}
+
+// withStartTimeout returns a copy of a path config whose on-demand start
+// timeout is the camera's learned startup grace, or pathConfig itself until
+// its reconnect time is learned
+func (s *MediaMTXService) withStartTimeout(cameraID uint, pathConfig PathConfig) PathConfig {
+	if pathConfig == nil || !s.watchdog.Adaptive {
+		return pathConfig
+	}
+	s.watchMu.Lock()
+	watch, exists := s.watches[cameraID]
+	learned := exists && watch.baseline.reconnect.learned()
+	var grace time.Duration
+	if learned {
+		grace = watch.baseline.startupGrace(s.watchdog)
+	}
+	s.watchMu.Unlock()
+	if !learned {
+		return pathConfig
+	}
+
+	updated := make(PathConfig, len(pathConfig))
+	for key, value := range pathConfig {
+		updated[key] = value
+	}
+	key := "sourceOnDemandStartTimeout"
+	if _, transcoding := pathConfig["runOnDemand"]; transcoding {
+		key = "runOnDemandStartTimeout"
+	}
+	updated[key] = grace.Round(time.Second).String()
+	return updated
+}
+
+// GetWatchdogBaseline returns what the watchdog has learned about a
+// camera's MediaMTX path
+func (s *MediaMTXService) GetWatchdogBaseline(cameraID uint) (WatchdogBaseline, bool) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	watch, exists := s.watches[cameraID]
+	if !exists {
+		return WatchdogBaseline{}, false
+	}
+	return watch.baseline.report(s.watchdog), true
+}
@@ -1,136 +1,356 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"sync"
 )
 
+const (
+	// MJPEGBoundary separates the JPEG parts of a multipart MJPEG response
+	MJPEGBoundary = "frame"
+
+	mjpegViewerBuffer = 2       // Frames queued per viewer; a slow viewer skips frames instead of holding up the rest
+	mjpegMaxFrameSize = 8 << 20 // Unterminated JPEG data beyond this is dropped
+	mjpegReadSize     = 64 << 10
+)
+
+var (
+	jpegSOI = []byte{0xFF, 0xD8}
+	jpegEOI = []byte{0xFF, 0xD9}
+)
+
 type MJPEGService struct {
 	activeStreams map[uint]*MJPEGStream
 	mu            sync.RWMutex
+	usage         *UsageTracker
+	scheduler     *TranscodeScheduler
 }
 
+// MJPEGStream is a camera's MJPEG transcode. One FFmpeg runs while anyone
+// watches and its frames are fanned out to every viewer.
 type MJPEGStream struct {
 	CameraID    uint
 	RTSPURL     string
 	FFmpegCmd   *exec.Cmd
 	IsActive    bool
+	Priority  int // models.Camera.PriorityRank, for transcode scheduling
+	stderr    *ffmpegErrorWriter
+	slot      *TranscodeSlot
+	run       int // Bumped by every stop, so a preemption or start of an earlier run is noticed
+	viewers   map[*MJPEGViewer]struct{}
+	latest    []byte // Last frame, sent to new viewers right away
 	mu          sync.RWMutex
+	startMu   sync.Mutex // Serializes FFmpeg starts, held while waiting for a slot
 }
 
-func NewMJPEGService() *MJPEGService {
+// MJPEGViewer is one HTTP client of a camera's MJPEG stream
+type MJPEGViewer struct {
+	frames  chan []byte
+	done    chan struct{} // Closed when the stream ends for this viewer
+	stream  *MJPEGStream
+	service *MJPEGService
+	once    sync.Once
+}
+
+func NewMJPEGService(usage *UsageTracker, scheduler *TranscodeScheduler) *MJPEGService {
 	return &MJPEGService{
 		activeStreams: make(map[uint]*MJPEGStream),
+		usage:         usage,
+		scheduler:     scheduler,
 	}
 }
 
-// StartStream starts RTSP to MJPEG conversion for a camera
-// MJPEG streams JPEG frames continuously via HTTP multipart response
-// No file storage needed - direct streaming to HTTP response
-func (s *MJPEGService) StartStream(cameraID uint, rtspURL string) error {
+// StartStream registers a camera's MJPEG stream. FFmpeg is started by the
+// first Subscribe and stopped when the last viewer leaves.
+func (s *MJPEGService) StartStream(cameraID uint, rtspURL string, priority int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Check if stream already exists
-	if stream, exists := s.activeStreams[cameraID]; exists && stream.IsActive {
+	if stream, exists := s.activeStreams[cameraID]; exists {
+		stream.mu.Lock()
+		stream.Priority = priority
+		if stream.FFmpegCmd == nil {
+			stream.RTSPURL = rtspURL
+		}
+		stream.mu.Unlock()
 		return nil
 	}
 
-	stream := &MJPEGStream{
+	s.activeStreams[cameraID] = &MJPEGStream{
 		CameraID: cameraID,
 		RTSPURL:  rtspURL,
 		IsActive: false,
+		Priority: priority,
+		stderr:   newFFmpegErrorWriter(cameraID, PipelineMJPEG),
+		viewers:  make(map[*MJPEGViewer]struct{}),
 	}
-
-	s.activeStreams[cameraID] = stream
-
-	// Stream is started when HTTP request comes in
-	// No need to start FFmpeg here - it will be started per connection
-
 	return nil
 }
 
-// GetStreamReader returns a reader for MJPEG stream
-// This will be used by HTTP handler to stream frames
-func (s *MJPEGService) GetStreamReader(cameraID uint) (io.ReadCloser, error) {
+// Subscribe adds a viewer to a camera's stream, starting FFmpeg for the
+// first one. Close the viewer when the client goes away.
+func (s *MJPEGService) Subscribe(cameraID uint) (*MJPEGViewer, error) {
 	s.mu.RLock()
 	stream, exists := s.activeStreams[cameraID]
 	s.mu.RUnlock()
-
 	if !exists {
 		return nil, fmt.Errorf("stream not found for camera %d", cameraID)
 	}
 
-	// Start FFmpeg to convert RTSP to MJPEG stream
-	// Simple approach: use MJPEG format directly (multipart/x-mixed-replace)
-	cmd := exec.Command("ffmpeg",
+	viewer := &MJPEGViewer{
+		frames:  make(chan []byte, mjpegViewerBuffer),
+		done:    make(chan struct{}),
+		stream:  stream,
+		service: s,
+	}
+
+	// Only one viewer starts FFmpeg; the others wait for it here rather
+	// than under s.mu, which every other camera's requests need
+	stream.startMu.Lock()
+	defer stream.startMu.Unlock()
+	stream.mu.RLock()
+	running := stream.FFmpegCmd != nil
+	stream.mu.RUnlock()
+	if !running {
+		if err := s.startFFmpeg(stream); err != nil {
+			return nil, err
+		}
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.FFmpegCmd == nil {
+		// FFmpeg exited right away; its error is in the health API
+		return nil, fmt.Errorf("MJPEG stream for camera %d ended", cameraID)
+	}
+	stream.viewers[viewer] = struct{}{}
+	if stream.latest != nil {
+		viewer.frames <- stream.latest
+	}
+	return viewer, nil
+}
+
+// startFFmpeg takes a transcode slot and starts the stream's FFmpeg; called
+// with stream.startMu held
+func (s *MJPEGService) startFFmpeg(stream *MJPEGStream) error {
+	stream.mu.RLock()
+	priority := stream.Priority
+	rtspURL := stream.RTSPURL
+	run := stream.run
+	stream.mu.RUnlock()
+
+	slot, err := s.scheduler.Acquire(stream.CameraID, PipelineMJPEG, priority, func() int {
+		stream.mu.RLock()
+		defer stream.mu.RUnlock()
+		return len(stream.viewers)
+	}, func() {
+		s.stopPreempted(stream, run)
+	})
+	if err != nil {
+		return err
+	}
+	stream.mu.Lock()
+	if stream.run != run {
+		// Preempted already
+		stream.mu.Unlock()
+		return ErrTranscodeCapacity
+	}
+	stream.slot = slot
+	stream.mu.Unlock()
+
+	cmd := FFmpegCommand(
 		"-rtsp_transport", "tcp",
-		"-i", stream.RTSPURL,
+		"-i", rtspURL,
 		"-vf", "fps=15,scale=1280:720",
 		"-q:v", "5",
 		"-f", "mjpeg",
 		"-",
 		"-loglevel", "error",
 	)
-	
-	// Capture stderr for debugging
-	cmd.Stderr = os.Stderr
+	// Classified for the health API
+	cmd.Stderr = stream.stderr
 
-	// Get stdout pipe
 	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("error creating stdout pipe: %v", err)
+	if err == nil {
+		err = cmd.Start()
 	}
-
-	// Start FFmpeg
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("error starting FFmpeg: %v", err)
+	if err != nil {
+		stream.mu.Lock()
+		freed := stream.stopLocked()
+		stream.mu.Unlock()
+		freed.Release()
+		return fmt.Errorf("error starting FFmpeg: %v", err)
 	}
+	s.usage.TrackProcess(stream.CameraID, PipelineMJPEG, cmd)
 
 	stream.mu.Lock()
+	if stream.run != run {
+		// Preempted while FFmpeg was starting
+		stream.mu.Unlock()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return ErrTranscodeCapacity
+	}
 	stream.FFmpegCmd = cmd
 	stream.IsActive = true
 	stream.mu.Unlock()
 
-	fmt.Printf("[MJPEG] Stream started for camera %d (RTSP: %s), PID: %d\n", cameraID, stream.RTSPURL, cmd.Process.Pid)
+	fmt.Printf("[MJPEG] FFmpeg started for camera %d (RTSP: %s), PID: %d\n", stream.CameraID, StripURLCredentials(rtspURL), cmd.Process.Pid)
 	
-	// Check if process started successfully
-	if cmd.Process == nil {
-		return nil, fmt.Errorf("FFmpeg process not started")
+	go s.pump(stream, cmd, stdout)
+	return nil
+}
+
+// pump splits FFmpeg's output into JPEG frames and hands each to every
+// viewer, until FFmpeg exits or is stopped
+func (s *MJPEGService) pump(stream *MJPEGStream, cmd *exec.Cmd, stdout io.Reader) {
+	reader := s.usage.CountingReader(stream.CameraID, PipelineMJPEG, stdout)
+	chunk := make([]byte, mjpegReadSize)
+	var pending []byte
+	for {
+		n, err := reader.Read(chunk)
+		pending = append(pending, chunk[:n]...)
+		for {
+			start := bytes.Index(pending, jpegSOI)
+			if start < 0 {
+				// Keep a trailing 0xFF that may start the next frame
+				if len(pending) > 0 && pending[len(pending)-1] == 0xFF {
+					pending = pending[len(pending)-1:]
+				} else {
+					pending = pending[:0]
+				}
+				break
+			}
+			end := bytes.Index(pending[start+len(jpegSOI):], jpegEOI)
+			if end < 0 {
+				pending = pending[start:]
+				break
+			}
+			end += start + len(jpegSOI) + len(jpegEOI)
+			frame := make([]byte, end-start)
+			copy(frame, pending[start:end])
+			stream.broadcast(frame)
+			pending = pending[end:]
+		}
+		if len(pending) > mjpegMaxFrameSize {
+			pending = nil
+		}
+		if err != nil {
+			break
+		}
+	}
+	cmd.Wait()
+
+	stream.mu.Lock()
+	var freed *TranscodeSlot
+	if stream.FFmpegCmd == cmd {
+		// Exited on its own; viewers get the error from the health API and reconnect
+		fmt.Printf("[MJPEG] FFmpeg for camera %d exited, ending %d viewers\n", stream.CameraID, len(stream.viewers))
+		freed = stream.stopLocked()
+	}
+	stream.mu.Unlock()
+	freed.Release()
+}
+
+// broadcast queues a frame for every viewer, skipping viewers that are
+// still behind
+func (stream *MJPEGStream) broadcast(frame []byte) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.latest = frame
+	for viewer := range stream.viewers {
+		select {
+		case viewer.frames <- frame:
+		default:
+		}
 	}
+}
 
-	// Return a reader that will close FFmpeg when done
-	return &mjpegReader{
-		reader: stdout,
-		cmd:    cmd,
-		stream: stream,
-	}, nil
+// stopLocked kills FFmpeg and ends every viewer; called with stream.mu
+// held. It returns the transcode slot for the caller to release once
+// stream.mu is unlocked: the scheduler's lock is taken before stream.mu
+// when it counts viewers, so never the other way round.
+func (stream *MJPEGStream) stopLocked() *TranscodeSlot {
+	if stream.FFmpegCmd != nil && stream.FFmpegCmd.Process != nil {
+		stream.FFmpegCmd.Process.Kill()
+	}
+	stream.FFmpegCmd = nil
+	stream.IsActive = false
+	stream.latest = nil
+	slot := stream.slot
+	stream.slot = nil
+	stream.run++
+	for viewer := range stream.viewers {
+		close(viewer.done)
+		delete(stream.viewers, viewer)
+	}
+	return slot
+}
+
+// stopPreempted ends a stream whose transcode slot went to a higher
+// priority camera
+func (s *MJPEGService) stopPreempted(stream *MJPEGStream, run int) {
+	stream.mu.Lock()
+	if stream.run != run {
+		stream.mu.Unlock()
+		return
+	}
+	fmt.Printf("[MJPEG] Stream for camera %d preempted, ending %d viewers\n", stream.CameraID, len(stream.viewers))
+	freed := stream.stopLocked()
+	stream.mu.Unlock()
+	freed.Release()
 }
 
-// mjpegReader wraps the FFmpeg stdout and ensures cleanup
-type mjpegReader struct {
-	reader io.ReadCloser
-	cmd    *exec.Cmd
-	stream *MJPEGStream
+// Next waits for the viewer's next frame. It returns false once the stream
+// ended or ctx is done.
+func (v *MJPEGViewer) Next(ctx context.Context) ([]byte, bool) {
+	select {
+	case frame := <-v.frames:
+		return frame, true
+	case <-v.done:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
 }
 
-func (r *mjpegReader) Read(p []byte) (n int, err error) {
-	return r.reader.Read(p)
+// Close removes the viewer; FFmpeg stops when it was the last one
+func (v *MJPEGViewer) Close() {
+	v.once.Do(func() {
+		stream := v.stream
+		stream.mu.Lock()
+		if _, ok := stream.viewers[v]; !ok {
+			stream.mu.Unlock()
+			return
+		}
+		delete(stream.viewers, v)
+		var freed *TranscodeSlot
+		if len(stream.viewers) == 0 && stream.FFmpegCmd != nil {
+			fmt.Printf("[MJPEG] Last viewer of camera %d left, stopping FFmpeg (PID: %d)\n", stream.CameraID, stream.FFmpegCmd.Process.Pid)
+			freed = stream.stopLocked()
+		}
+		stream.mu.Unlock()
+		freed.Release()
+	})
 }
 
-func (r *mjpegReader) Close() error {
-	if r.cmd != nil && r.cmd.Process != nil {
-		fmt.Printf("[MJPEG] Stopping FFmpeg for camera %d (PID: %d)\n", r.stream.CameraID, r.cmd.Process.Pid)
-		r.cmd.Process.Kill()
-		r.cmd.Wait()
+// WriteMJPEGPart writes a frame as one part of a multipart MJPEG response
+// and returns the bytes written
+func WriteMJPEGPart(w io.Writer, frame []byte) (int, error) {
+	header, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", MJPEGBoundary, len(frame))
+	if err != nil {
+		return header, err
 	}
-	r.stream.mu.Lock()
-	r.stream.IsActive = false
-	r.stream.mu.Unlock()
-	return r.reader.Close()
+	body, err := w.Write(frame)
+	if err != nil {
+		return header + body, err
+	}
+	tail, err := io.WriteString(w, "\r\n")
+	return header + body + tail, err
 }
 
 // StopStream stops MJPEG stream for a camera
@@ -143,13 +363,10 @@ func (s *MJPEGService) StopStream(cameraID uint) error {
 		return fmt.Errorf("stream not found for camera %d", cameraID)
 	}
 
-	// Stop FFmpeg if running
 	stream.mu.Lock()
-	if stream.FFmpegCmd != nil && stream.FFmpegCmd.Process != nil {
-		stream.FFmpegCmd.Process.Kill()
-		stream.FFmpegCmd.Wait()
-	}
+	freed := stream.stopLocked()
 	stream.mu.Unlock()
+	freed.Release()
 
 	delete(s.activeStreams, cameraID)
 	return nil
@@ -170,3 +387,42 @@ func (s *MJPEGService) GetStreamStatus(cameraID uint) (bool, error) {
 	return stream.IsActive, nil
 }
 
+// GetViewerCount returns how many clients watch a camera's MJPEG stream
+func (s *MJPEGService) GetViewerCount(cameraID uint) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stream, exists := s.activeStreams[cameraID]
+	if !exists {
+		return 0
+	}
+	stream.mu.RLock()
+	defer stream.mu.RUnlock()
+	return len(stream.viewers)
+}
+
+// GetAllStreamStatus returns whether each known stream is active, by camera ID
+func (s *MJPEGService) GetAllStreamStatus() map[uint]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := make(map[uint]bool, len(s.activeStreams))
+	for cameraID, stream := range s.activeStreams {
+		stream.mu.RLock()
+		status[cameraID] = stream.IsActive
+		stream.mu.RUnlock()
+	}
+	return status
+}
+
+// GetStreamError returns the last classified FFmpeg error for a stream
+func (s *MJPEGService) GetStreamError(cameraID uint) *StreamError {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stream, exists := s.activeStreams[cameraID]
+	if !exists {
+		return nil
+	}
+	return stream.stderr.LastError()
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// PipelineMotion is the background FFmpeg detecting motion
+const PipelineMotion = "motion"
+
+const (
+	motionReconcileInterval = 30 * time.Second
+	motionPruneInterval     = time.Hour
+	motionAnalysisFPS       = 5
+	motionAnalysisWidth     = 320
+	motionMaxSnapshotBytes  = 4 << 20
+	motionPriority          = -1 // Like exports, never preempts live streams and gives way to them
+)
+
+// MotionService watches cameras with motion detection enabled. One FFmpeg
+// per camera compares consecutive frames (scene change score) and only
+// outputs the frames that changed, as JPEG; each burst of changed frames
+// becomes a MotionEvent with the first frame as snapshot, a "motion" event
+// and the camera's LastMotionDetected. Cameras are reloaded periodically, so
+// enabling detection through the API takes effect within
+// motionReconcileInterval.
+type MotionService struct {
+	db        *gorm.DB
+	events    *EventService
+	usage     *UsageTracker
+	scheduler *TranscodeScheduler
+	ingest    *IngestService
+	features  *FeatureFlagService
+	privacy   *PrivacyService
+	config    config.MotionConfig
+	monitors  map[uint]*motionMonitor // camera_id -> running monitor
+	mu        sync.Mutex
+}
+
+// motionMonitor is one FFmpeg running scene change detection on a camera
+type motionMonitor struct {
+	cameraID   uint
+	rtspURL    string
+	cmd        *exec.Cmd
+	lastMotion time.Time
+}
+
+func NewMotionService(cfg config.MotionConfig, db *gorm.DB, events *EventService, usage *UsageTracker, scheduler *TranscodeScheduler, ingest *IngestService, features *FeatureFlagService, privacy *PrivacyService) *MotionService {
+	return &MotionService{
+		db:        db,
+		events:    events,
+		usage:     usage,
+		scheduler: scheduler,
+		ingest:    ingest,
+		features:  features,
+		privacy:   privacy,
+		config:    cfg,
+		monitors:  make(map[uint]*motionMonitor),
+	}
+}
+
+// Start runs detection and the retention cleanup in the background
+func (s *MotionService) Start() {
+	go func() {
+		ticker := time.NewTicker(motionReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			s.reconcile()
+			<-ticker.C
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(motionPruneInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			retention := storedRetention(s.db, func(r *models.RetentionSettings) *int { return r.MotionDays }, s.config.Retention)
+			if retention > 0 {
+				s.prune(time.Now().Add(-retention))
+			}
+		}
+	}()
+}
+
+// reconcile starts monitors for cameras with motion detection enabled and
+// stops the ones no longer wanted, also those whose site has analytics off
+// and those in privacy mode, as motion snapshots are frames of the camera
+func (s *MotionService) reconcile() {
+	var cameras []models.Camera
+	if err := s.db.Where("motion_detection = ?", true).Find(&cameras).Error; err != nil {
+		fmt.Printf("[Motion] Failed to load cameras: %v\n", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[uint]bool)
+	for i := range cameras {
+		camera := &cameras[i]
+		if !s.features.EnabledFor(models.FeatureAnalytics, camera) {
+			continue
+		}
+		if _, private := s.privacy.Active(camera.ID); private {
+			continue
+		}
+		wanted[camera.ID] = true
+
+		// A changed URL or rotated credential restarts the monitor
+		rtspURL := s.ingest.URL(camera)
+		monitor, running := s.monitors[camera.ID]
+		if running && monitor.rtspURL != rtspURL {
+			monitor.stop()
+			running = false
+		}
+		if !running {
+			started, err := s.startMonitor(camera, rtspURL)
+			if err != nil {
+				fmt.Printf("[Motion] Cannot watch camera %d: %v\n", camera.ID, err)
+				continue
+			}
+			s.monitors[camera.ID] = started
+		}
+	}
+
+	for cameraID, monitor := range s.monitors {
+		if !wanted[cameraID] {
+			monitor.stop()
+			delete(s.monitors, cameraID)
+		}
+	}
+}
+
+// startMonitor launches FFmpeg writing the changed frames of the camera as
+// a JPEG stream (must be called with s.mu held)
+func (s *MotionService) startMonitor(camera *models.Camera, rtspURL string) (*motionMonitor, error) {
+	monitor := &motionMonitor{
+		cameraID: camera.ID,
+		rtspURL:  rtspURL,
+	}
+
+	slot, err := s.scheduler.Acquire(camera.ID, PipelineMotion, motionPriority, func() int { return 0 }, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.monitors[camera.ID] == monitor {
+			monitor.stop()
+			delete(s.monitors, camera.ID)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := FFmpegCommand(
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", rtspURL,
+		"-an",
+		"-vf", fmt.Sprintf("fps=%d,scale=%d:-2,select='gt(scene,%g)'", motionAnalysisFPS, motionAnalysisWidth, s.config.SceneThreshold),
+		"-fps_mode", "vfr",
+		"-c:v", "mjpeg",
+		"-q:v", "5",
+		"-f", "image2pipe",
+		"-",
+	)
+	cmd.Stderr = newFFmpegErrorWriter(camera.ID, PipelineMotion)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		slot.Release()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		slot.Release()
+		return nil, err
+	}
+	monitor.cmd = cmd
+	s.usage.TrackProcess(camera.ID, PipelineMotion, cmd)
+
+	fmt.Printf("[Motion] Watching camera %d (PID: %d)\n", camera.ID, cmd.Process.Pid)
+
+	go func() {
+		s.detect(monitor, stdout)
+		cmd.Wait()
+		slot.Release()
+
+		// Let the next reconcile restart it if it's still wanted
+		s.mu.Lock()
+		if s.monitors[camera.ID] == monitor {
+			delete(s.monitors, camera.ID)
+		}
+		s.mu.Unlock()
+	}()
+
+	return monitor, nil
+}
+
+// detect reads the changed frames; the first one after a quiet period of
+// Cooldown starts a new motion event
+func (s *MotionService) detect(monitor *motionMonitor, stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	for {
+		frame, err := readJPEG(reader)
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		quiet := monitor.lastMotion.IsZero() || now.Sub(monitor.lastMotion) >= s.config.Cooldown
+		monitor.lastMotion = now
+		if quiet {
+			s.record(monitor.cameraID, now, frame)
+		}
+	}
+}
+
+// record stores a motion event with its snapshot, records the "motion"
+// event and updates the camera
+func (s *MotionService) record(cameraID uint, detectedAt time.Time, snapshot []byte) {
+	motion := models.MotionEvent{
+		CameraID:   cameraID,
+		DetectedAt: detectedAt,
+		Source:     "scene",
+	}
+
+	dir := filepath.Join(s.config.SnapshotDir, fmt.Sprintf("cam%d", cameraID))
+	path := filepath.Join(dir, detectedAt.UTC().Format("20060102T150405.000")+".jpg")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("[Motion] Failed to create snapshot directory for camera %d: %v\n", cameraID, err)
+	} else if err := os.WriteFile(path, snapshot, 0644); err != nil {
+		fmt.Printf("[Motion] Failed to write snapshot for camera %d: %v\n", cameraID, err)
+	} else {
+		motion.SnapshotPath = path
+	}
+
+	if err := s.db.Create(&motion).Error; err != nil {
+		fmt.Printf("[Motion] Failed to record motion on camera %d: %v\n", cameraID, err)
+		if motion.SnapshotPath != "" {
+			os.Remove(motion.SnapshotPath)
+		}
+		return
+	}
+	if err := s.db.Model(&models.Camera{}).Where("id = ?", cameraID).
+		UpdateColumn("last_motion_detected", detectedAt).Error; err != nil {
+		fmt.Printf("[Motion] Failed to update camera %d: %v\n", cameraID, err)
+	}
+
+	s.events.Record(&models.Event{
+		CameraID:    &cameraID,
+		Type:        "motion",
+		Source:      "motion_detection",
+		Description: "Motion detected",
+		OccurredAt:  detectedAt,
+	}, map[string]interface{}{
+		"motion_event_id": motion.ID,
+	})
+}
+
+// prune deletes motion events detected before cutoff with their snapshots
+func (s *MotionService) prune(cutoff time.Time) {
+	var expired []models.MotionEvent
+	if err := s.db.Select("id", "snapshot_path").Where("detected_at < ?", cutoff).Find(&expired).Error; err != nil {
+		fmt.Printf("[Motion] Failed to load expired motion events: %v\n", err)
+		return
+	}
+	if len(expired) == 0 {
+		return
+	}
+	ids := make([]uint, len(expired))
+	for i, motion := range expired {
+		ids[i] = motion.ID
+	}
+	if err := s.db.Delete(&models.MotionEvent{}, ids).Error; err != nil {
+		fmt.Printf("[Motion] Failed to delete expired motion events: %v\n", err)
+		return
+	}
+	for _, motion := range expired {
+		RemoveMotionSnapshot(motion.SnapshotPath)
+	}
+	fmt.Printf("[Motion] Deleted %d motion events older than %s\n", len(expired), cutoff.Format(time.RFC3339))
+}
+
+// RemoveMotionSnapshot deletes a motion event's snapshot file, if it has one
+func RemoveMotionSnapshot(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("[Motion] Failed to remove snapshot %s: %v\n", path, err)
+	}
+}
+
+// readJPEG returns the next JPEG image (SOI to EOI) of an image2pipe stream.
+// Entropy-coded data escapes 0xFF, so the first EOI marker ends the image.
+func readJPEG(reader *bufio.Reader) ([]byte, error) {
+	var frame []byte
+	for {
+		chunk, err := reader.ReadSlice(0xD9)
+		frame = append(frame, chunk...)
+		if err == bufio.ErrBufferFull {
+			if len(frame) > motionMaxSnapshotBytes {
+				frame = frame[:0]
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n := len(frame); n >= 2 && frame[n-2] == 0xFF {
+			if start := bytes.Index(frame, []byte{0xFF, 0xD8}); start >= 0 {
+				return frame[start:], nil
+			}
+			frame = frame[:0]
+		}
+	}
+}
+
+// stop kills FFmpeg; the detecting goroutine then cleans up
+func (m *motionMonitor) stop() {
+	if m.cmd != nil && m.cmd.Process != nil {
+		fmt.Printf("[Motion] Stopping motion detection for camera %d\n", m.cameraID)
+		m.cmd.Process.Kill()
+	}
+}
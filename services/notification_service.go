@@ -0,0 +1,365 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	webhookPollInterval = 5 * time.Second
+	webhookBatchSize    = 50
+	webhookConcurrency  = 4
+	maxWebhookError     = 500 // Bytes of a failed response's body kept in the log
+)
+
+// ErrWebhookTarget is returned for webhook URLs on addresses webhooks may
+// not reach
+var ErrWebhookTarget = errors.New("webhook URL must be on a public address")
+
+// WebhookPayload is the JSON body POSTed to webhooks
+type WebhookPayload struct {
+	WebhookID uint          `json:"webhook_id"`
+	Event     *models.Event `json:"event"`
+}
+
+// NotificationService POSTs camera events to the webhooks subscribed to
+// them. Deliveries are queued in the webhook_deliveries table, so retries
+// survive a restart, and retried with exponential backoff until they
+// succeed or WEBHOOK_MAX_ATTEMPTS is reached. Events only go to webhooks
+// whose owner may see the camera's area, and only to public addresses
+// (private ones too with WEBHOOK_ALLOW_PRIVATE_TARGETS), checked again on
+// every connection so DNS changes and redirects can't get around it.
+type NotificationService struct {
+	db         *gorm.DB
+	config     config.WebhookConfig
+	secrets    *SecretStore // Holds the key the webhook secrets are encrypted with
+	httpClient *http.Client
+	wake       chan struct{}
+}
+
+func NewNotificationService(cfg config.WebhookConfig, secrets *SecretStore, db *gorm.DB) *NotificationService {
+	s := &NotificationService{
+		db:      db,
+		config:  cfg,
+		secrets: secrets,
+		wake:    make(chan struct{}, 1),
+	}
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		// Checks the address actually connected to, after DNS resolution
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !s.allowedTarget(net.ParseIP(host)) {
+				return ErrWebhookTarget
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would connect to the target for us, unchecked
+	transport.DialContext = dialer.DialContext
+	s.httpClient = &http.Client{Timeout: cfg.Timeout, Transport: transport}
+	return s
+}
+
+// CheckURL checks a webhook URL: http or https, on a host whose every
+// address webhooks may reach
+func (s *NotificationService) CheckURL(rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("url host %s can't be resolved", target.Hostname())
+	}
+	for _, addr := range addrs {
+		if !s.allowedTarget(addr.IP) {
+			return ErrWebhookTarget
+		}
+	}
+	return nil
+}
+
+// allowedTarget reports whether webhooks may connect to ip: never loopback,
+// link-local (cloud metadata endpoints), multicast or unspecified
+// addresses, private ones only with AllowPrivateTargets
+func (s *NotificationService) allowedTarget(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	return s.config.AllowPrivateTargets || !ip.IsPrivate()
+}
+
+// Start runs the delivery worker and prunes the delivery log hourly
+func (s *NotificationService) Start() {
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+
+		for {
+			s.deliverDue()
+			if time.Since(lastPrune) > time.Hour {
+				s.prune()
+				lastPrune = time.Now()
+			}
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// NewSecret generates a webhook signing secret, returning it and its
+// encrypted form for Webhook.SecretEncrypted
+func (s *NotificationService) NewSecret() (string, string, error) {
+	return newSigningSecret(s.secrets.Get(SecretCredential))
+}
+
+// Notify queues a recorded event for every enabled webhook subscribed to it
+func (s *NotificationService) Notify(event *models.Event) {
+	if s == nil || event.CameraID == nil {
+		return
+	}
+	var webhooks []models.Webhook
+	if err := s.db.Where("enabled AND (camera_id IS NULL OR camera_id = ?)", *event.CameraID).
+		Find(&webhooks).Error; err != nil {
+		fmt.Printf("[Webhooks] Failed to load webhooks: %v\n", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	owners, area, err := s.webhookOwners(webhooks, *event.CameraID)
+	if err != nil {
+		fmt.Printf("[Webhooks] Failed to load webhook owners: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	queued := 0
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if !webhook.Wants(event) {
+			continue
+		}
+		if owner := owners[webhook.UserID]; owner == nil || !watchesArea(owner, area) {
+			continue
+		}
+		payload, err := json.Marshal(WebhookPayload{WebhookID: webhook.ID, Event: event})
+		if err != nil {
+			fmt.Printf("[Webhooks] Failed to encode event %d: %v\n", event.ID, err)
+			return
+		}
+		delivery := models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			CameraID:      *event.CameraID,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &now,
+		}
+		if err := s.db.Create(&delivery).Error; err != nil {
+			fmt.Printf("[Webhooks] Failed to queue event %d for webhook %d: %v\n", event.ID, webhook.ID, err)
+			continue
+		}
+		queued++
+	}
+	if queued > 0 {
+		s.Wake()
+	}
+}
+
+// webhookOwners loads the owners of webhooks and the area of a camera, to
+// send each owner only the events of cameras in their areas
+func (s *NotificationService) webhookOwners(webhooks []models.Webhook, cameraID uint) (map[uint]*models.User, string, error) {
+	var camera models.Camera
+	if err := s.db.Select("id", "area").First(&camera, cameraID).Error; err != nil {
+		return nil, "", err
+	}
+	ids := make([]uint, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		ids = append(ids, webhook.UserID)
+	}
+	var users []models.User
+	if err := s.db.Select("id", "role", "assigned_areas").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, "", err
+	}
+	owners := make(map[uint]*models.User, len(users))
+	for i := range users {
+		owners[users[i].ID] = &users[i]
+	}
+	return owners, camera.Area, nil
+}
+
+// Wake makes the worker look for due deliveries now
+func (s *NotificationService) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue attempts the deliveries whose next attempt is due, a few at a
+// time so one slow endpoint doesn't hold up the others
+func (s *NotificationService) deliverDue() {
+	var deliveries []models.WebhookDelivery
+	if err := s.db.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+		Order("next_attempt_at").Limit(webhookBatchSize).Find(&deliveries).Error; err != nil {
+		fmt.Printf("[Webhooks] Failed to load due deliveries: %v\n", err)
+		return
+	}
+
+	webhooks := make(map[uint]*models.Webhook)
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, webhookConcurrency)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook = &models.Webhook{}
+			if err := s.db.First(webhook, delivery.WebhookID).Error; err != nil {
+				webhook = nil
+			}
+			webhooks[delivery.WebhookID] = webhook
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			s.attempt(webhook, delivery)
+		}()
+	}
+	wg.Wait()
+}
+
+// attempt sends a delivery once and records the outcome, scheduling the
+// next attempt with exponential backoff when it failed
+func (s *NotificationService) attempt(webhook *models.Webhook, delivery *models.WebhookDelivery) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+
+	switch {
+	case webhook == nil:
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "webhook no longer exists"
+	case !webhook.Enabled:
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "webhook is disabled"
+	default:
+		delivery.ResponseStatus, delivery.Error = s.post(webhook, delivery)
+		if delivery.Error == "" {
+			delivery.Status = models.DeliveryDelivered
+			delivery.DeliveredAt = &now
+		} else if delivery.Attempts >= s.config.MaxAttempts {
+			delivery.Status = models.DeliveryFailed
+		}
+	}
+
+	if delivery.Status == models.DeliveryPending {
+		next := now.Add(s.backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	} else {
+		delivery.NextAttemptAt = nil
+	}
+	if delivery.Status == models.DeliveryFailed {
+		fmt.Printf("[Webhooks] Giving up on delivery %d after %d attempts: %s\n", delivery.ID, delivery.Attempts, delivery.Error)
+	}
+
+	if err := s.db.Save(delivery).Error; err != nil {
+		fmt.Printf("[Webhooks] Failed to update delivery %d: %v\n", delivery.ID, err)
+	}
+}
+
+// post sends the payload signed with the webhook's secret, returning the
+// HTTP status and, unless it was a 2xx, why the attempt failed
+func (s *NotificationService) post(webhook *models.Webhook, delivery *models.WebhookDelivery) (int, string) {
+	secret, err := utils.DecryptSecretAny(s.secrets.Keys(SecretCredential), webhook.SecretEncrypted)
+	if err != nil {
+		return 0, fmt.Sprintf("cannot read webhook secret: %v", err)
+	}
+	body := []byte(delivery.Payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", fmt.Sprint(delivery.ID))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, ""
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookError))
+	message := resp.Status
+	if len(snippet) > 0 {
+		message += ": " + string(snippet)
+	}
+	return resp.StatusCode, message
+}
+
+// backoff is the delay after the given number of failed attempts:
+// RetryBase, doubled per further attempt, at most RetryMax
+func (s *NotificationService) backoff(attempts int) time.Duration {
+	delay := s.config.RetryBase
+	for i := 1; i < attempts && delay < s.config.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > s.config.RetryMax {
+		delay = s.config.RetryMax
+	}
+	return delay
+}
+
+// prune drops finished deliveries older than the log retention
+func (s *NotificationService) prune() {
+	retention := storedRetention(s.db, func(r *models.RetentionSettings) *int { return r.WebhookLogDays }, s.config.Retention)
+	if retention <= 0 {
+		return
+	}
+	if err := s.db.Where("status <> ? AND created_at < ?", models.DeliveryPending, time.Now().Add(-retention)).
+		Delete(&models.WebhookDelivery{}).Error; err != nil {
+		fmt.Printf("[Webhooks] Failed to prune delivery log: %v\n", err)
+	}
+}
@@ -0,0 +1,552 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// oidcStateTTL is how long a user has to sign in at the provider
+	oidcStateTTL = 10 * time.Minute
+
+	// oidcKeysMinRefresh limits refetching the provider's keys for unknown
+	// key IDs, so forged tokens can't make us hammer the provider
+	oidcKeysMinRefresh = time.Minute
+)
+
+var (
+	ErrOIDCDisabled     = errors.New("single sign-on is not configured")
+	ErrOIDCState        = errors.New("login attempt expired or was started in another browser")
+	ErrOIDCNoEmail      = errors.New("the identity provider sent no verified email")
+	ErrOIDCUnknownUser  = errors.New("no account exists for this email")
+	ErrOIDCNotPermitted = errors.New("your account has no role in this system")
+	ErrOIDCNotLinked    = errors.New("an account with this email exists but isn't linked to single sign-on")
+)
+
+// oidcRolePrecedence decides between several mapped roles; roles not listed
+// come after these, alphabetically
+var oidcRolePrecedence = []string{"admin", "manager", "user", "viewer"}
+
+// OIDCService signs users in through an OpenID Connect provider with the
+// authorization code flow and PKCE. The login's state, nonce and PKCE
+// verifier travel in a signed cookie rather than server memory, so the
+// callback may land on any node. Users are linked to the provider account
+// (sub) and created on first login; their role follows OIDC_ROLE_MAPPING on
+// every login.
+type OIDCService struct {
+	config     config.OIDCConfig
+	db         *gorm.DB
+	secrets    *SecretStore
+	httpClient *http.Client
+	provider   *oidcProvider
+	keys       map[string]interface{} // kid -> *rsa.PublicKey or *ecdsa.PublicKey
+	keysAt     time.Time
+	mu         sync.Mutex
+}
+
+// oidcProvider is the part of the provider's discovery document used here
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCLogin is a login started at the provider: where to send the browser,
+// and the cookie value the callback checks it against
+type OIDCLogin struct {
+	URL    string
+	Cookie string
+}
+
+// OIDCIdentity is who the provider says signed in
+type OIDCIdentity struct {
+	Subject string
+	Email   string
+	Name    string
+	Roles   []string // Values of the role claim
+}
+
+func NewOIDCService(cfg config.OIDCConfig, db *gorm.DB, secrets *SecretStore) *OIDCService {
+	return &OIDCService{
+		config:     cfg,
+		db:         db,
+		secrets:    secrets,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled reports whether single sign-on is configured
+func (s *OIDCService) Enabled() bool {
+	return s != nil && s.config.Issuer != "" && s.config.ClientID != ""
+}
+
+// Secure reports whether the callback is served over HTTPS, so the login
+// cookie can be marked Secure
+func (s *OIDCService) Secure() bool {
+	return strings.HasPrefix(s.config.RedirectURL, "https://")
+}
+
+// FrontendURL is where the browser is sent once the login is done
+func (s *OIDCService) FrontendURL() string {
+	return s.config.FrontendURL
+}
+
+// Begin starts a login: a fresh state, nonce and PKCE verifier, kept in the
+// returned cookie, and the provider's authorization URL carrying them
+func (s *OIDCService) Begin() (*OIDCLogin, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	provider, err := s.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcStateTTL).Unix(),
+	}).SignedString(s.stateKey())
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.config.ClientID},
+		"redirect_uri":          {s.config.RedirectURL},
+		"scope":                 {strings.Join(s.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return &OIDCLogin{URL: provider.AuthorizationEndpoint + separator + query.Encode(), Cookie: cookie}, nil
+}
+
+// Complete finishes a login on the provider's callback: checks the state
+// against the cookie, trades the code for tokens and verifies the ID token
+func (s *OIDCService) Complete(cookie, state, code string) (*OIDCIdentity, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	var login struct {
+		State    string `json:"state"`
+		Nonce    string `json:"nonce"`
+		Verifier string `json:"verifier"`
+		jwt.RegisteredClaims
+	}
+	if _, err := jwt.ParseWithClaims(cookie, &login, func(*jwt.Token) (interface{}, error) {
+		return s.stateKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired()); err != nil {
+		return nil, ErrOIDCState
+	}
+	if state == "" || state != login.State {
+		return nil, ErrOIDCState
+	}
+
+	provider, err := s.discover()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := s.exchange(provider, code, login.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(idToken, claims, s.idTokenKey,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(s.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	); err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != login.Nonce {
+		return nil, fmt.Errorf("invalid ID token: nonce mismatch")
+	}
+
+	identity := &OIDCIdentity{
+		Email: strings.ToLower(strings.TrimSpace(claimString(claims, s.config.EmailClaim))),
+		Name:  strings.TrimSpace(claimString(claims, s.config.NameClaim)),
+		Roles: claimStrings(claims, s.config.RoleClaim),
+	}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("invalid ID token: no subject")
+	}
+	if verified, _ := claims["email_verified"].(bool); identity.Email == "" || !verified {
+		return nil, ErrOIDCNoEmail
+	}
+	return identity, nil
+}
+
+// Provision returns the user an identity signs in as: the user linked to
+// its subject, else the user with its email, which is linked to it when
+// unlinked and LinkExisting is on, else a new user when AutoCreate is on.
+// The role mapped from the identity's claims, or DefaultRole when no
+// mapping matches, replaces the user's role, so the provider stays the
+// source of truth.
+func (s *OIDCService) Provision(identity *OIDCIdentity) (*models.User, error) {
+	role := s.mapRole(identity.Roles)
+	if role == "" {
+		role = s.config.DefaultRole
+	}
+	if role == "" {
+		return nil, ErrOIDCNotPermitted
+	}
+
+	var user models.User
+	err := s.db.Where("oidc_subject = ?", identity.Subject).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = s.db.Where("LOWER(email) = ?", identity.Email).First(&user).Error
+		if err == nil {
+			if user.OIDCSubject != nil || !s.config.LinkExisting {
+				return nil, ErrOIDCNotLinked
+			}
+			if err := s.db.Model(&user).Update("oidc_subject", identity.Subject).Error; err != nil {
+				return nil, err
+			}
+			fmt.Printf("[OIDC] Linked user %d (%s) to provider subject %s\n", user.ID, user.Email, identity.Subject)
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !s.config.AutoCreate {
+			return nil, ErrOIDCUnknownUser
+		}
+		// Sign-in goes through the provider; the password can't be guessed
+		password, err := randomToken()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		subject := identity.Subject
+		user = models.User{
+			Email:       identity.Email,
+			Name:        identity.Name,
+			Password:    string(hash),
+			Role:        role,
+			OIDCSubject: &subject,
+		}
+		if user.Name == "" {
+			user.Name = identity.Email
+		}
+		if err := s.db.Create(&user).Error; err != nil {
+			return nil, err
+		}
+		fmt.Printf("[OIDC] Created user %d (%s) as %s\n", user.ID, user.Email, user.Role)
+		return &user, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if role != user.Role {
+		fmt.Printf("[OIDC] Role of user %d (%s) changed from %s to %s by the identity provider\n", user.ID, user.Email, user.Role, role)
+		if err := s.db.Model(&user).Update("role", role).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// mapRole returns the highest role the claim values are mapped to, "" when
+// none is
+func (s *OIDCService) mapRole(values []string) string {
+	have := make(map[string]bool, len(values))
+	for _, value := range values {
+		have[value] = true
+	}
+	var granted []string
+	for role, mapped := range s.config.RoleMapping {
+		for _, value := range mapped {
+			if have[value] {
+				granted = append(granted, role)
+				break
+			}
+		}
+	}
+	if len(granted) == 0 {
+		return ""
+	}
+	rank := func(role string) int {
+		for i, r := range oidcRolePrecedence {
+			if r == role {
+				return i
+			}
+		}
+		return len(oidcRolePrecedence)
+	}
+	sort.Slice(granted, func(i, j int) bool {
+		if rank(granted[i]) != rank(granted[j]) {
+			return rank(granted[i]) < rank(granted[j])
+		}
+		return granted[i] < granted[j]
+	})
+	return granted[0]
+}
+
+// exchange trades an authorization code for the ID token
+func (s *OIDCService) exchange(provider *oidcProvider, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed (status %d): %s", resp.StatusCode, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+// discover fetches the provider's discovery document once
+func (s *OIDCService) discover() (*oidcProvider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider != nil {
+		return s.provider, nil
+	}
+
+	var provider oidcProvider
+	if err := s.getJSON(s.config.Issuer+"/.well-known/openid-configuration", &provider); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != s.config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery failed: issuer is %q, expected %q", provider.Issuer, s.config.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery failed: endpoints missing")
+	}
+	s.provider = &provider
+	fmt.Printf("[OIDC] Using %s\n", provider.Issuer)
+	return s.provider, nil
+}
+
+// idTokenKey returns the provider key an ID token was signed with,
+// refetching the keys when the provider rotated them
+func (s *OIDCService) idTokenKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key, ok := s.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(s.keysAt) < oidcKeysMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var jwks struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	s.keysAt = time.Now()
+	if err := s.getJSON(s.provider.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	s.keys = make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			s.keys[jwk.Kid] = key
+		}
+	}
+	if key, ok := s.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by ID; tokens without one match a provider
+// publishing a single key
+func (s *OIDCService) lookupKey(kid string) (interface{}, bool) {
+	if key, ok := s.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (s *OIDCService) getJSON(rawURL string, into interface{}) error {
+	resp, err := s.httpClient.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(into)
+}
+
+// stateKey signs login cookies; derived from the JWT secret so the cookie
+// can't pass for an access token
+func (s *OIDCService) stateKey() []byte {
+	key := sha256.Sum256([]byte("oidc-state:" + s.secrets.Get(SecretJWT)))
+	return key[:]
+}
+
+func (s *OIDCService) scopes() []string {
+	scopes := []string{"openid"}
+	for _, scope := range s.config.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// oidcJWK is an RSA or EC public key of the provider's JWKS
+type oidcJWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k oidcJWK) publicKey() (interface{}, error) {
+	decode := func(value string) (*big.Int, error) {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(raw), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// claimString reads a string claim
+func claimString(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// claimStrings reads a claim holding a list of strings or a single one
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// randomToken returns 32 random bytes, hex encoded
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
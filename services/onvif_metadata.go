@@ -0,0 +1,506 @@
+package services
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// PipelineONVIFMetadata is the background FFmpeg reading a camera's ONVIF
+// metadata track
+const PipelineONVIFMetadata = "onvif_metadata"
+
+const (
+	metadataReconcileInterval = 30 * time.Second
+	metadataMaxDocumentBytes  = 1 << 20
+	metadataMaxTrackedObjects = 256
+)
+
+var (
+	metadataStart = regexp.MustCompile(`<(?:[\w.-]+:)?MetadataStream[\s>]`)
+	metadataEnd   = regexp.MustCompile(`</(?:[\w.-]+:)?MetadataStream\s*>`)
+)
+
+// metadataTopics maps ONVIF event topics to event types, first match wins;
+// topics matching none are recorded as "analytics"
+var metadataTopics = []struct {
+	match     string
+	eventType string
+}{
+	{"Doorbell", "doorbell"},
+	{"CallButton", "doorbell"},
+	{"LineDetector", "line_crossing"},
+	{"FieldDetector", "intrusion"},
+	{"Tamper", "tamper"},
+	{"GlobalSceneChange", "tamper"},
+	{"Audio", "audio_detection"},
+	{"DetectedSound", "audio_detection"},
+	{"Motion", "motion"},
+}
+
+var metadataDescriptions = map[string]string{
+	"object_detected": "Object detected",
+	"line_crossing":   "Line crossed",
+	"intrusion":       "Object in restricted area",
+	"tamper":          "Tampering detected",
+	"audio_detection": "Sound detected",
+	"motion":          "Motion detected",
+	"doorbell":        "Doorbell pressed",
+	"analytics":       "Camera analytics event",
+}
+
+// ONVIFMetadataService ingests the analytics a Profile T camera runs itself:
+// object detections and rule/audio events it streams as XML on the RTSP
+// metadata track. The stream is copied, never decoded, so it costs no
+// transcode slot. Detections become "object_detected" events and
+// notifications become events by topic (motion, tamper, line_crossing,
+// intrusion, audio_detection), dropping those below MinConfidence and
+// repeats within Cooldown. Doorbell presses on intercoms start a call
+// instead. Cameras are reloaded every metadataReconcileInterval like
+// motion detection; those in privacy mode are not watched.
+type ONVIFMetadataService struct {
+	db        *gorm.DB
+	events    *EventService
+	usage     *UsageTracker
+	ingest    *IngestService
+	features  *FeatureFlagService
+	intercoms *IntercomService
+	privacy   *PrivacyService
+	config    config.MetadataConfig
+	monitors  map[uint]*metadataMonitor // camera_id -> running monitor
+	mu        sync.Mutex
+}
+
+// metadataMonitor is one FFmpeg copying a camera's metadata track
+type metadataMonitor struct {
+	cameraID uint
+	rtspURL  string
+	intercom bool // Doorbell presses start intercom calls
+	cmd      *exec.Cmd
+	lastSeen map[string]time.Time // object id or event type -> last time it was reported
+}
+
+func NewONVIFMetadataService(cfg config.MetadataConfig, db *gorm.DB, events *EventService, usage *UsageTracker, ingest *IngestService, features *FeatureFlagService, intercoms *IntercomService, privacy *PrivacyService) *ONVIFMetadataService {
+	return &ONVIFMetadataService{
+		db:        db,
+		events:    events,
+		usage:     usage,
+		ingest:    ingest,
+		features:  features,
+		intercoms: intercoms,
+		privacy:   privacy,
+		config:    cfg,
+		monitors:  make(map[uint]*metadataMonitor),
+	}
+}
+
+// Start watches the metadata of enabled cameras in the background
+func (s *ONVIFMetadataService) Start() {
+	go func() {
+		ticker := time.NewTicker(metadataReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			s.reconcile()
+			<-ticker.C
+		}
+	}()
+}
+
+// reconcile starts monitors for cameras with onvif_metadata enabled and
+// stops the ones no longer wanted, also those whose site has analytics off
+// and those in privacy mode
+func (s *ONVIFMetadataService) reconcile() {
+	var cameras []models.Camera
+	if err := s.db.Where("onvif_metadata = ?", true).Find(&cameras).Error; err != nil {
+		fmt.Printf("[ONVIF Metadata] Failed to load cameras: %v\n", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[uint]bool)
+	for i := range cameras {
+		camera := &cameras[i]
+		if !s.features.EnabledFor(models.FeatureAnalytics, camera) {
+			continue
+		}
+		if _, private := s.privacy.Active(camera.ID); private {
+			continue
+		}
+		wanted[camera.ID] = true
+
+		// The camera itself: MediaMTX republishes only the video and audio
+		// tracks, so the metadata track isn't on the shared ingest
+		rtspURL := s.ingest.DirectURL(camera)
+		monitor, running := s.monitors[camera.ID]
+		intercom := camera.DeviceType == models.DeviceTypeIntercom
+		if running && (monitor.rtspURL != rtspURL || monitor.intercom != intercom) {
+			monitor.stop()
+			running = false
+		}
+		if !running {
+			started, err := s.startMonitor(camera, rtspURL)
+			if err != nil {
+				fmt.Printf("[ONVIF Metadata] Cannot watch camera %d: %v\n", camera.ID, err)
+				continue
+			}
+			s.monitors[camera.ID] = started
+		}
+	}
+
+	for cameraID, monitor := range s.monitors {
+		if !wanted[cameraID] {
+			monitor.stop()
+			delete(s.monitors, cameraID)
+		}
+	}
+}
+
+// startMonitor launches FFmpeg writing the camera's metadata track as is
+// (must be called with s.mu held)
+func (s *ONVIFMetadataService) startMonitor(camera *models.Camera, rtspURL string) (*metadataMonitor, error) {
+	monitor := &metadataMonitor{
+		cameraID: camera.ID,
+		rtspURL:  rtspURL,
+		intercom: camera.DeviceType == models.DeviceTypeIntercom,
+		lastSeen: make(map[string]time.Time),
+	}
+
+	cmd := FFmpegCommand(
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-allowed_media_types", "data",
+		"-i", rtspURL,
+		"-map", "0:d",
+		"-c", "copy",
+		"-f", "data",
+		"-",
+	)
+	cmd.Stderr = newFFmpegErrorWriter(camera.ID, PipelineONVIFMetadata)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	monitor.cmd = cmd
+	s.usage.TrackProcess(camera.ID, PipelineONVIFMetadata, cmd)
+
+	fmt.Printf("[ONVIF Metadata] Watching camera %d (PID: %d)\n", camera.ID, cmd.Process.Pid)
+
+	go func() {
+		s.read(monitor, stdout)
+		cmd.Wait()
+
+		// Let the next reconcile restart it if it's still wanted
+		s.mu.Lock()
+		if s.monitors[camera.ID] == monitor {
+			delete(s.monitors, camera.ID)
+		}
+		s.mu.Unlock()
+	}()
+
+	return monitor, nil
+}
+
+// read splits the track into MetadataStream documents and records what they
+// report. A document that doesn't parse (a lost RTP packet) is skipped.
+func (s *ONVIFMetadataService) read(monitor *metadataMonitor, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), metadataMaxDocumentBytes)
+	scanner.Split(splitMetadataStream)
+	for scanner.Scan() {
+		document := scanner.Bytes()
+		start := metadataStart.FindIndex(document)
+		if start == nil {
+			continue
+		}
+		var stream metadataStream
+		if err := xml.Unmarshal(document[start[0]:], &stream); err != nil {
+			continue
+		}
+		s.process(monitor, &stream, time.Now())
+	}
+}
+
+// splitMetadataStream is a bufio.SplitFunc ending each token after a
+// </MetadataStream> close tag, whatever its namespace prefix
+func splitMetadataStream(data []byte, atEOF bool) (int, []byte, error) {
+	if end := metadataEnd.FindIndex(data); end != nil {
+		return end[1], data[:end[1]], nil
+	}
+	if atEOF {
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
+
+// process records the detections and notifications of one document
+func (s *ONVIFMetadataService) process(monitor *metadataMonitor, stream *metadataStream, now time.Time) {
+	if len(monitor.lastSeen) > metadataMaxTrackedObjects {
+		for key, seen := range monitor.lastSeen {
+			if now.Sub(seen) >= s.config.Cooldown {
+				delete(monitor.lastSeen, key)
+			}
+		}
+	}
+
+	for _, frame := range stream.Frames {
+		for _, object := range frame.Objects {
+			objectType, confidence := object.class()
+			if objectType == "" || confidence < s.config.MinConfidence {
+				continue
+			}
+			// A tracked object is reported in every frame; only its first
+			// sighting is an event
+			key := "object:" + object.ObjectID
+			if object.ObjectID == "" {
+				key = "class:" + objectType
+			}
+			if !monitor.fresh(key, now, s.config.Cooldown) {
+				continue
+			}
+			s.record(monitor.cameraID, "object_detected", now, map[string]interface{}{
+				"object_id":   object.ObjectID,
+				"object_type": objectType,
+				"confidence":  confidence,
+				"camera_time": frame.UtcTime,
+			})
+		}
+	}
+
+	for _, notification := range stream.Notifications {
+		message := notification.Message
+		// Initialized replays the current state on connect, Deleted ends a rule
+		if message.PropertyOperation == "Initialized" || message.PropertyOperation == "Deleted" || !message.active() {
+			continue
+		}
+		topic := strings.TrimSpace(notification.Topic)
+		if i := strings.Index(topic, ":"); i >= 0 {
+			topic = topic[i+1:]
+		}
+		eventType := metadataEventType(topic)
+
+		objectType, confidence, hasConfidence := message.classification()
+		if hasConfidence && confidence < s.config.MinConfidence {
+			continue
+		}
+		if !monitor.fresh("event:"+eventType, now, s.config.Cooldown) {
+			continue
+		}
+		if eventType == "doorbell" && monitor.intercom {
+			if _, _, err := s.intercoms.Ring(monitor.cameraID, PipelineONVIFMetadata); err != nil {
+				fmt.Printf("[ONVIF Metadata] Failed to start a call from camera %d: %v\n", monitor.cameraID, err)
+			}
+			continue
+		}
+
+		data := map[string]interface{}{
+			"topic":       topic,
+			"camera_time": message.UtcTime,
+			"items":       message.items(),
+		}
+		if objectType != "" {
+			data["object_type"] = objectType
+		}
+		if hasConfidence {
+			data["confidence"] = confidence
+		}
+		s.record(monitor.cameraID, eventType, now, data)
+	}
+}
+
+// record stores one event, described with its object type and confidence
+// when the camera reported them
+func (s *ONVIFMetadataService) record(cameraID uint, eventType string, occurredAt time.Time, data map[string]interface{}) {
+	description := metadataDescriptions[eventType]
+	if objectType, ok := data["object_type"].(string); ok && objectType != "" {
+		if eventType == "object_detected" {
+			description = objectType + " detected"
+		} else {
+			description += ": " + objectType
+		}
+	}
+	if confidence, ok := data["confidence"].(float64); ok {
+		description += fmt.Sprintf(" (%.0f%%)", confidence*100)
+	}
+
+	s.events.Record(&models.Event{
+		CameraID:    &cameraID,
+		Type:        eventType,
+		Source:      PipelineONVIFMetadata,
+		Description: description,
+		OccurredAt:  occurredAt,
+	}, data)
+}
+
+func metadataEventType(topic string) string {
+	for _, t := range metadataTopics {
+		if strings.Contains(topic, t.match) {
+			return t.eventType
+		}
+	}
+	return "analytics"
+}
+
+// fresh reports whether key wasn't seen within cooldown and marks it seen
+func (m *metadataMonitor) fresh(key string, now time.Time, cooldown time.Duration) bool {
+	last, seen := m.lastSeen[key]
+	m.lastSeen[key] = now
+	return !seen || now.Sub(last) >= cooldown
+}
+
+// stop kills FFmpeg; the reading goroutine then cleans up
+func (m *metadataMonitor) stop() {
+	if m.cmd != nil && m.cmd.Process != nil {
+		fmt.Printf("[ONVIF Metadata] Stopping metadata ingest for camera %d\n", m.cameraID)
+		m.cmd.Process.Kill()
+	}
+}
+
+// metadataStream is the part of an ONVIF tt:MetadataStream document used
+// here. Elements are matched by local name, whatever prefix the camera uses.
+type metadataStream struct {
+	Frames        []metadataFrame        `xml:"VideoAnalytics>Frame"`
+	Notifications []metadataNotification `xml:"Event>NotificationMessage"`
+}
+
+type metadataFrame struct {
+	UtcTime string           `xml:"UtcTime,attr"`
+	Objects []metadataObject `xml:"Object"`
+}
+
+type metadataObject struct {
+	ObjectID   string              `xml:"ObjectId,attr"`
+	Candidates []metadataCandidate `xml:"Appearance>Class>ClassCandidate"` // ONVIF before 2.1 / 20.12
+	Types      []metadataClassType `xml:"Appearance>Class>Type"`
+}
+
+type metadataCandidate struct {
+	Type       string `xml:"Type"`
+	Likelihood string `xml:"Likelihood"`
+}
+
+type metadataClassType struct {
+	Value      string `xml:",chardata"`
+	Likelihood string `xml:"Likelihood,attr"`
+}
+
+type metadataNotification struct {
+	Topic   string          `xml:"Topic"`
+	Message metadataMessage `xml:"Message>Message"`
+}
+
+type metadataMessage struct {
+	UtcTime           string         `xml:"UtcTime,attr"`
+	PropertyOperation string         `xml:"PropertyOperation,attr"`
+	Source            []metadataItem `xml:"Source>SimpleItem"`
+	Data              []metadataItem `xml:"Data>SimpleItem"`
+}
+
+type metadataItem struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+// class returns the most likely class of an object; a class without a
+// likelihood counts as certain
+func (o *metadataObject) class() (string, float64) {
+	best, bestLikelihood := "", -1.0
+	consider := func(class, likelihood string) {
+		class = strings.TrimSpace(class)
+		if class == "" {
+			return
+		}
+		l, ok := parseLikelihood(likelihood)
+		if !ok {
+			l = 1
+		}
+		if l > bestLikelihood {
+			best, bestLikelihood = class, l
+		}
+	}
+	for _, candidate := range o.Candidates {
+		consider(candidate.Type, candidate.Likelihood)
+	}
+	for _, t := range o.Types {
+		consider(t.Value, t.Likelihood)
+	}
+	return best, bestLikelihood
+}
+
+// active reports whether a notification raises its condition rather than
+// clearing it: any of its boolean data items (IsMotion, IsInside,
+// IsTamper, State, ...) is true, or it has none (e.g. a line crossing)
+func (m *metadataMessage) active() bool {
+	hasState := false
+	for _, item := range m.Data {
+		// Not ParseBool: "1" and "0" are also object ids and counts
+		switch strings.ToLower(strings.TrimSpace(item.Value)) {
+		case "true":
+			return true
+		case "false":
+			hasState = true
+		}
+	}
+	return !hasState
+}
+
+// classification returns the object or sound class and confidence a
+// notification carries, if any
+func (m *metadataMessage) classification() (string, float64, bool) {
+	objectType, confidence, hasConfidence := "", 0.0, false
+	for _, item := range m.Data {
+		switch item.Name {
+		case "ClassTypes", "ObjectType", "SoundType", "Class":
+			objectType = strings.TrimSpace(item.Value)
+		case "Likelihood", "Confidence":
+			confidence, hasConfidence = parseLikelihood(item.Value)
+		}
+	}
+	return objectType, confidence, hasConfidence
+}
+
+func (m *metadataMessage) items() map[string]string {
+	items := make(map[string]string, len(m.Source)+len(m.Data))
+	for _, item := range m.Source {
+		items[item.Name] = item.Value
+	}
+	for _, item := range m.Data {
+		items[item.Name] = item.Value
+	}
+	return items
+}
+
+// parseLikelihood reads a likelihood as a 0-1 fraction; some cameras report
+// percentages
+func parseLikelihood(value string) (float64, bool) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	if value == "" {
+		return 0, false
+	}
+	l, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	if l > 1 {
+		l /= 100
+	}
+	return l, true
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ONVIFService talks to cameras over ONVIF (SOAP over HTTP)
+type ONVIFService struct {
+	httpClient *http.Client
+}
+
+// ONVIFTarget is the device service endpoint and credentials of a camera
+type ONVIFTarget struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func NewONVIFService() *ONVIFService {
+	return &ONVIFService{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ONVIFTargetFromRTSP derives the ONVIF endpoint from a camera's RTSP URL.
+// Cameras almost always use the same host and credentials for RTSP and ONVIF.
+func ONVIFTargetFromRTSP(rtspURL string, onvifPort int) (ONVIFTarget, error) {
+	u, err := url.Parse(rtspURL)
+	if err != nil {
+		return ONVIFTarget{}, fmt.Errorf("invalid RTSP URL: %w", err)
+	}
+	if u.Hostname() == "" {
+		return ONVIFTarget{}, fmt.Errorf("RTSP URL has no host")
+	}
+	if onvifPort == 0 {
+		onvifPort = 80
+	}
+
+	target := ONVIFTarget{
+		Host: u.Hostname(),
+		Port: onvifPort,
+	}
+	if u.User != nil {
+		target.Username = u.User.Username()
+		target.Password, _ = u.User.Password()
+	}
+	return target, nil
+}
+
+// deviceServiceURL returns the ONVIF device management endpoint
+func (t ONVIFTarget) deviceServiceURL() string {
+	return fmt.Sprintf("http://%s/onvif/device_service", net.JoinHostPort(t.Host, strconv.Itoa(t.Port)))
+}
+
+// SystemReboot asks the camera to reboot and returns the device's message
+// (usually the expected reboot duration)
+func (s *ONVIFService) SystemReboot(target ONVIFTarget) (string, error) {
+	body := `<SystemReboot xmlns="http://www.onvif.org/ver10/device/wsdl"/>`
+
+	respBody, err := s.call(target.deviceServiceURL(), target, body)
+	if err != nil {
+		return "", err
+	}
+
+	var envelope struct {
+		Body struct {
+			SystemRebootResponse struct {
+				Message string `xml:"Message"`
+			} `xml:"SystemRebootResponse"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(respBody, &envelope); err != nil {
+		return "", fmt.Errorf("failed to decode ONVIF response: %w", err)
+	}
+
+	return envelope.Body.SystemRebootResponse.Message, nil
+}
+
+// GotoPreset moves a PTZ camera to one of its presets. The PTZ and media
+// endpoints come from the device's capabilities and the first media
+// profile is used, as on single-sensor cameras it is the only one.
+func (s *ONVIFService) GotoPreset(target ONVIFTarget, preset string) error {
+	respBody, err := s.call(target.deviceServiceURL(), target,
+		`<GetCapabilities xmlns="http://www.onvif.org/ver10/device/wsdl"><Category>All</Category></GetCapabilities>`)
+	if err != nil {
+		return err
+	}
+	var capabilities struct {
+		Body struct {
+			Response struct {
+				Capabilities struct {
+					Media struct {
+						XAddr string `xml:"XAddr"`
+					} `xml:"Media"`
+					PTZ struct {
+						XAddr string `xml:"XAddr"`
+					} `xml:"PTZ"`
+				} `xml:"Capabilities"`
+			} `xml:"GetCapabilitiesResponse"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(respBody, &capabilities); err != nil {
+		return fmt.Errorf("failed to decode ONVIF capabilities: %w", err)
+	}
+	mediaURL := capabilities.Body.Response.Capabilities.Media.XAddr
+	ptzURL := capabilities.Body.Response.Capabilities.PTZ.XAddr
+	if ptzURL == "" {
+		return fmt.Errorf("camera does not support PTZ")
+	}
+	if mediaURL == "" {
+		return fmt.Errorf("camera has no ONVIF media service")
+	}
+
+	respBody, err = s.call(mediaURL, target, `<GetProfiles xmlns="http://www.onvif.org/ver10/media/wsdl"/>`)
+	if err != nil {
+		return err
+	}
+	var profiles struct {
+		Body struct {
+			Response struct {
+				Profiles []struct {
+					Token string `xml:"token,attr"`
+				} `xml:"Profiles"`
+			} `xml:"GetProfilesResponse"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(respBody, &profiles); err != nil {
+		return fmt.Errorf("failed to decode ONVIF profiles: %w", err)
+	}
+	if len(profiles.Body.Response.Profiles) == 0 {
+		return fmt.Errorf("camera has no media profile")
+	}
+
+	_, err = s.call(ptzURL, target, fmt.Sprintf(
+		`<GotoPreset xmlns="http://www.onvif.org/ver20/ptz/wsdl"><ProfileToken>%s</ProfileToken><PresetToken>%s</PresetToken></GotoPreset>`,
+		xmlEscape(profiles.Body.Response.Profiles[0].Token), xmlEscape(preset)))
+	return err
+}
+
+// SetRelayOutput switches one of the device's relay outputs (door strikes,
+// gates) on or off. An empty token picks the first relay output.
+func (s *ONVIFService) SetRelayOutput(target ONVIFTarget, token string, active bool) error {
+	if token == "" {
+		respBody, err := s.call(target.deviceServiceURL(), target, `<GetRelayOutputs xmlns="http://www.onvif.org/ver10/device/wsdl"/>`)
+		if err != nil {
+			return err
+		}
+		var outputs struct {
+			Body struct {
+				Response struct {
+					RelayOutputs []struct {
+						Token string `xml:"token,attr"`
+					} `xml:"RelayOutputs"`
+				} `xml:"GetRelayOutputsResponse"`
+			} `xml:"Body"`
+		}
+		if err := xml.Unmarshal(respBody, &outputs); err != nil {
+			return fmt.Errorf("failed to decode ONVIF relay outputs: %w", err)
+		}
+		if len(outputs.Body.Response.RelayOutputs) == 0 {
+			return fmt.Errorf("device has no relay output")
+		}
+		token = outputs.Body.Response.RelayOutputs[0].Token
+	}
+
+	state := "inactive"
+	if active {
+		state = "active"
+	}
+	_, err := s.call(target.deviceServiceURL(), target, fmt.Sprintf(
+		`<SetRelayOutputState xmlns="http://www.onvif.org/ver10/device/wsdl"><RelayOutputToken>%s</RelayOutputToken><LogicalState>%s</LogicalState></SetRelayOutputState>`,
+		xmlEscape(token), state))
+	return err
+}
+
+// call sends a SOAP request with a WS-Security UsernameToken and returns the raw response
+func (s *ONVIFService) call(endpoint string, target ONVIFTarget, body string) ([]byte, error) {
+	envelope := fmt.Sprintf(
+		`<?xml version="1.0" encoding="UTF-8"?>`+
+			`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope">`+
+			`<s:Header>%s</s:Header>`+
+			`<s:Body>%s</s:Body>`+
+			`</s:Envelope>`,
+		securityHeader(target.Username, target.Password), body,
+	)
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBufferString(envelope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach ONVIF endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ONVIF response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ONVIF error (status %d): %s", resp.StatusCode, soapFaultReason(respBody))
+	}
+
+	return respBody, nil
+}
+
+// securityHeader builds a WS-Security UsernameToken with PasswordDigest
+// Digest = Base64(SHA1(nonce + created + password))
+func securityHeader(username, password string) string {
+	if username == "" {
+		return ""
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	created := time.Now().UTC().Format(time.RFC3339)
+
+	hash := sha1.New()
+	hash.Write(nonce)
+	hash.Write([]byte(created))
+	hash.Write([]byte(password))
+	digest := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+
+	return fmt.Sprintf(
+		`<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">`+
+			`<UsernameToken>`+
+			`<Username>%s</Username>`+
+			`<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%s</Password>`+
+			`<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">%s</Nonce>`+
+			`<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%s</Created>`+
+			`</UsernameToken>`+
+			`</Security>`,
+		xmlEscape(username), digest, base64.StdEncoding.EncodeToString(nonce), created,
+	)
+}
+
+// soapFaultReason extracts the human readable reason from a SOAP fault
+func soapFaultReason(body []byte) string {
+	var fault struct {
+		Body struct {
+			Fault struct {
+				Reason struct {
+					Text string `xml:"Text"`
+				} `xml:"Reason"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(body, &fault); err == nil && fault.Body.Fault.Reason.Text != "" {
+		return fault.Body.Fault.Reason.Text
+	}
+	if len(body) > 200 {
+		return string(body[:200])
+	}
+	return string(body)
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// Playback controls, sent in PlaybackMessage.Reason
+const (
+	PlaybackInitial = "initial" // Sent once when a client connects
+	PlaybackPlay    = "play"
+	PlaybackPause   = "pause"
+	PlaybackSeek    = "seek"
+	PlaybackRate    = "rate"
+	PlaybackCameras = "cameras" // Cameras added or removed
+)
+
+const (
+	playbackClientBuffer = 8
+	playbackIdleTimeout  = time.Hour      // Sessions without clients or controls for this long are dropped
+	maxRecordingSpan     = 24 * time.Hour // Longest recording looked back for when locating a position
+)
+
+var ErrPlaybackSessionNotFound = errors.New("playback session not found")
+
+// PlaybackSession plays the recordings of several cameras at the same
+// wall-clock position. The position is anchored at AnchoredAt and advances
+// at Rate while not paused, so every client derives the same position.
+type PlaybackSession struct {
+	ID         string    `json:"id"`
+	OwnerID    uint      `json:"owner_id"`
+	CameraIDs  []uint    `json:"camera_ids"`
+	Position   time.Time `json:"position"` // Recording time at AnchoredAt
+	AnchoredAt time.Time `json:"anchored_at"`
+	Rate       float64   `json:"rate"`
+	Paused     bool      `json:"paused"`
+	Version    int       `json:"version"` // Increments with every control, to drop stale messages
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PositionAt returns the recording time playing at server time now
+func (p *PlaybackSession) PositionAt(now time.Time) time.Time {
+	if p.Paused {
+		return p.Position
+	}
+	return p.Position.Add(time.Duration(float64(now.Sub(p.AnchoredAt)) * p.Rate))
+}
+
+// PlaybackCamera is where one camera of a session is at the current position
+type PlaybackCamera struct {
+	CameraID      uint       `json:"camera_id"`
+	RecordingID   *uint      `json:"recording_id,omitempty"`   // Nil in a recording gap
+	OffsetSeconds float64    `json:"offset_seconds,omitempty"` // Into the recording
+	NextStart     *time.Time `json:"next_start,omitempty"`     // Next recording after a gap
+}
+
+// PlaybackMessage is pushed to a session's clients on every control
+type PlaybackMessage struct {
+	Type       string           `json:"type"` // state
+	Reason     string           `json:"reason"`
+	Session    PlaybackSession  `json:"session"`
+	ServerTime time.Time        `json:"server_time"` // Lets clients correct for clock skew
+	Current    time.Time        `json:"current"`     // Position at ServerTime
+	Cameras    []PlaybackCamera `json:"cameras"`
+}
+
+// PlaybackControl changes a session; only the fields of the action are used
+type PlaybackControl struct {
+	Action    string    // play, pause, seek, rate, cameras
+	Position  time.Time // seek
+	Rate      float64   // rate
+	CameraIDs []uint    // cameras
+}
+
+// PlaybackService keeps synchronized playback sessions and their
+// WebSocket clients. Sessions live in memory; they are short-lived reviews.
+type PlaybackService struct {
+	db       *gorm.DB
+	sessions map[string]*playbackState
+	mu       sync.Mutex
+}
+
+type playbackState struct {
+	session  PlaybackSession
+	clients  map[*playbackClient]struct{}
+	lastUsed time.Time
+}
+
+type playbackClient struct {
+	conn *websocket.Conn
+	send chan PlaybackMessage
+}
+
+func NewPlaybackService(db *gorm.DB) *PlaybackService {
+	return &PlaybackService{
+		db:       db,
+		sessions: make(map[string]*playbackState),
+	}
+}
+
+// Start drops idle sessions in the background
+func (s *PlaybackService) Start() {
+	go func() {
+		ticker := time.NewTicker(playbackIdleTimeout / 4)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			s.mu.Lock()
+			for id, state := range s.sessions {
+				if len(state.clients) == 0 && now.Sub(state.lastUsed) > playbackIdleTimeout {
+					delete(s.sessions, id)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// Create starts a paused session at position
+func (s *PlaybackService) Create(ownerID uint, cameraIDs []uint, position time.Time, rate float64) (PlaybackMessage, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return PlaybackMessage{}, err
+	}
+	now := time.Now()
+	session := PlaybackSession{
+		ID:         hex.EncodeToString(raw),
+		OwnerID:    ownerID,
+		CameraIDs:  cameraIDs,
+		Position:   position,
+		AnchoredAt: now,
+		Rate:       rate,
+		Paused:     true,
+		CreatedAt:  now,
+	}
+
+	s.mu.Lock()
+	s.sessions[session.ID] = &playbackState{
+		session:  session,
+		clients:  make(map[*playbackClient]struct{}),
+		lastUsed: now,
+	}
+	s.mu.Unlock()
+	return s.message(session, PlaybackInitial, now)
+}
+
+// Get returns a session's current state
+func (s *PlaybackService) Get(id string) (PlaybackMessage, error) {
+	s.mu.Lock()
+	state, ok := s.sessions[id]
+	if !ok {
+		s.mu.Unlock()
+		return PlaybackMessage{}, ErrPlaybackSessionNotFound
+	}
+	session := state.session
+	s.mu.Unlock()
+	return s.message(session, PlaybackInitial, time.Now())
+}
+
+// Control applies a control to a session and pushes the new state to its clients
+func (s *PlaybackService) Control(id string, control PlaybackControl) (PlaybackMessage, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	state, ok := s.sessions[id]
+	if !ok {
+		s.mu.Unlock()
+		return PlaybackMessage{}, ErrPlaybackSessionNotFound
+	}
+	session := &state.session
+	// Re-anchor at the current position so the change applies from now on
+	session.Position = session.PositionAt(now)
+	session.AnchoredAt = now
+	switch control.Action {
+	case PlaybackPlay:
+		session.Paused = false
+	case PlaybackPause:
+		session.Paused = true
+	case PlaybackSeek:
+		session.Position = control.Position
+	case PlaybackRate:
+		session.Rate = control.Rate
+	case PlaybackCameras:
+		session.CameraIDs = control.CameraIDs
+	}
+	session.Version++
+	state.lastUsed = now
+	snapshot := *session
+	s.mu.Unlock()
+
+	msg, err := s.message(snapshot, control.Action, now)
+	if err != nil {
+		return msg, err
+	}
+	s.broadcast(id, msg)
+	return msg, nil
+}
+
+// Delete ends a session and disconnects its clients
+func (s *PlaybackService) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.sessions[id]
+	if !ok {
+		return ErrPlaybackSessionNotFound
+	}
+	for client := range state.clients {
+		client.conn.Close()
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+// message describes session at server time now, with each camera's recording
+func (s *PlaybackService) message(session PlaybackSession, reason string, now time.Time) (PlaybackMessage, error) {
+	current := session.PositionAt(now)
+	cameras, err := s.locate(session.CameraIDs, current)
+	if err != nil {
+		return PlaybackMessage{}, err
+	}
+	return PlaybackMessage{
+		Type:       "state",
+		Reason:     reason,
+		Session:    session,
+		ServerTime: now,
+		Current:    current,
+		Cameras:    cameras,
+	}, nil
+}
+
+// locate finds the recording of each camera covering at, or the next one
+// when at falls in a gap
+func (s *PlaybackService) locate(cameraIDs []uint, at time.Time) ([]PlaybackCamera, error) {
+	var covering []models.Recording
+	err := s.db.Where("camera_id IN ? AND start_time BETWEEN ? AND ? AND (end_time IS NULL OR end_time > ?)",
+		cameraIDs, at.Add(-maxRecordingSpan), at, at).
+		Order("start_time DESC").Find(&covering).Error
+	if err != nil {
+		return nil, err
+	}
+	byCamera := make(map[uint]models.Recording, len(covering))
+	for _, recording := range covering {
+		if _, ok := byCamera[recording.CameraID]; !ok {
+			byCamera[recording.CameraID] = recording
+		}
+	}
+
+	cameras := make([]PlaybackCamera, 0, len(cameraIDs))
+	for _, cameraID := range cameraIDs {
+		camera := PlaybackCamera{CameraID: cameraID}
+		if recording, ok := byCamera[cameraID]; ok {
+			id := recording.ID
+			camera.RecordingID = &id
+			camera.OffsetSeconds = at.Sub(recording.StartTime).Seconds()
+		} else {
+			var next models.Recording
+			err := s.db.Select("start_time").Where("camera_id = ? AND start_time > ?", cameraID, at).
+				Order("start_time").Limit(1).Find(&next).Error
+			if err != nil {
+				return nil, err
+			}
+			if !next.StartTime.IsZero() {
+				camera.NextStart = &next.StartTime
+			}
+		}
+		cameras = append(cameras, camera)
+	}
+	return cameras, nil
+}
+
+// broadcast sends a message to every client of a session. Slow clients
+// whose buffer is full are dropped rather than holding up the others.
+func (s *PlaybackService) broadcast(id string, msg PlaybackMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.sessions[id]
+	if !ok {
+		return
+	}
+	for client := range state.clients {
+		select {
+		case client.send <- msg:
+		default:
+			fmt.Printf("[Playback] Client of session %s is not keeping up, disconnecting\n", id)
+			client.conn.Close()
+		}
+	}
+}
+
+// HandleWebSocket serves one session client until it disconnects. The
+// client gets the current state right away and every control after that.
+func (s *PlaybackService) HandleWebSocket(conn *websocket.Conn, id string) {
+	defer conn.Close()
+
+	initial, err := s.Get(id)
+	if err != nil {
+		conn.WriteJSON(map[string]string{"error": err.Error()})
+		return
+	}
+	client := &playbackClient{conn: conn, send: make(chan PlaybackMessage, playbackClientBuffer)}
+	client.send <- initial
+
+	s.mu.Lock()
+	state, ok := s.sessions[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	state.clients[client] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if state, ok := s.sessions[id]; ok {
+			delete(state.clients, client)
+			state.lastUsed = time.Now()
+		}
+		s.mu.Unlock()
+	}()
+
+	// Reads only detect the client going away; controls go through the API
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-client.send:
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrPrivacyMode is returned for streams and recordings of a camera a
+// privacy schedule blacks out
+var ErrPrivacyMode = errors.New("camera is in privacy mode")
+
+// PrivacyService keeps in memory which cameras are in privacy mode, as
+// stream requests and workers consult it for every camera. Schedules are
+// applied at every minute boundary on each instance; when a camera's
+// blackout starts the OnBlackout callbacks end whatever this instance runs
+// for it. The cluster leader logs the blackout windows.
+type PrivacyService struct {
+	db         *gorm.DB
+	onBlackout []func(cameraID uint)
+	applyMu    sync.Mutex // One Apply at a time, so callbacks run once per blackout
+
+	mu      sync.RWMutex
+	active  map[uint]models.PrivacySchedule // camera_id -> schedule blacking it out now
+	logging bool                            // Blackout windows are logged here; only on the cluster leader
+}
+
+func NewPrivacyService(db *gorm.DB) *PrivacyService {
+	return &PrivacyService{
+		db:     db,
+		active: make(map[uint]models.PrivacySchedule),
+	}
+}
+
+// OnBlackout registers fn to run for every camera entering privacy mode,
+// e.g. to end its running streams; register before Start
+func (s *PrivacyService) OnBlackout(fn func(cameraID uint)) {
+	s.onBlackout = append(s.onBlackout, fn)
+}
+
+// Start applies the schedules now and at every minute boundary
+func (s *PrivacyService) Start() {
+	if err := s.Apply(time.Now()); err != nil {
+		fmt.Printf("[Privacy] Failed to apply privacy schedules: %v\n", err)
+	}
+	go func() {
+		for {
+			now := time.Now()
+			time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+			if err := s.Apply(time.Now()); err != nil {
+				fmt.Printf("[Privacy] Failed to apply privacy schedules: %v\n", err)
+			}
+		}
+	}()
+}
+
+// StartLog makes this instance log blackout windows, closing the ones left
+// open by a previous leader that have since ended
+func (s *PrivacyService) StartLog() {
+	s.mu.Lock()
+	s.logging = true
+	s.mu.Unlock()
+	if err := s.Apply(time.Now()); err != nil {
+		fmt.Printf("[Privacy] Failed to apply privacy schedules: %v\n", err)
+	}
+}
+
+// Active returns the schedule blacking a camera out, if any
+func (s *PrivacyService) Active(cameraID uint) (models.PrivacySchedule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	schedule, ok := s.active[cameraID]
+	return schedule, ok
+}
+
+// Apply reads the schedules, runs the OnBlackout callbacks of the cameras
+// entering privacy mode at now and, on the leader, logs the blackouts
+func (s *PrivacyService) Apply(now time.Time) error {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+
+	var schedules []models.PrivacySchedule
+	if err := s.db.Where("enabled = ?", true).Order("id").Find(&schedules).Error; err != nil {
+		return err
+	}
+	active := make(map[uint]models.PrivacySchedule)
+	for _, schedule := range schedules {
+		if _, ok := active[schedule.CameraID]; !ok && schedule.ActiveAt(now) {
+			active[schedule.CameraID] = schedule
+		}
+	}
+
+	s.mu.Lock()
+	previous := s.active
+	s.active = active
+	logging := s.logging
+	s.mu.Unlock()
+
+	for cameraID, schedule := range active {
+		if _, ok := previous[cameraID]; ok {
+			continue
+		}
+		fmt.Printf("[Privacy] Camera %d entered privacy mode (schedule %d)\n", cameraID, schedule.ID)
+		for _, fn := range s.onBlackout {
+			fn(cameraID)
+		}
+	}
+	for cameraID := range previous {
+		if _, ok := active[cameraID]; !ok {
+			fmt.Printf("[Privacy] Camera %d left privacy mode\n", cameraID)
+		}
+	}
+
+	if logging {
+		return s.logBlackouts(active, now)
+	}
+	return nil
+}
+
+// logBlackouts opens a blackout for every camera in privacy mode without one
+// and ends the open ones of cameras no longer in it
+func (s *PrivacyService) logBlackouts(active map[uint]models.PrivacySchedule, now time.Time) error {
+	var open []models.PrivacyBlackout
+	if err := s.db.Where("ended_at IS NULL").Find(&open).Error; err != nil {
+		return err
+	}
+	logged := make(map[uint]bool, len(open))
+	for _, blackout := range open {
+		if _, ok := active[blackout.CameraID]; ok {
+			logged[blackout.CameraID] = true
+			continue
+		}
+		if err := s.db.Model(&blackout).Update("ended_at", now).Error; err != nil {
+			return err
+		}
+	}
+	for cameraID, schedule := range active {
+		if logged[cameraID] {
+			continue
+		}
+		if err := s.db.Create(&models.PrivacyBlackout{
+			CameraID:   cameraID,
+			ScheduleID: schedule.ID,
+			StartedAt:  now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,505 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// PipelineQuality is the FFmpeg snapshotting a camera for quality scoring
+const PipelineQuality = "quality"
+
+const (
+	qualityFrameWidth  = 320
+	qualityFrameHeight = 180
+	qualityWorkers     = 4
+	// An issue must be seen (or gone) on this many consecutive samples before
+	// it is flagged (or cleared); lenses get dirty slowly, not in one check
+	qualityConfirmations = 3
+
+	qualityMinBaseline  = 3              // Samples needed before a camera has a baseline
+	qualityBaselineAge  = 24 * time.Hour // Recent samples are compared, not part of the baseline
+	qualityHourSpread   = 2              // Baseline samples are from within this many hours of the time of day
+	qualityBlurRatio    = 0.6            // Sharpness below this share of baseline is blurry
+	qualityNoiseRatio   = 1.8            // Noise above this multiple of baseline is noisy
+	qualityMinNoise     = 2.0            // Noise below this is never flagged
+	qualityMaxClipped   = 0.25           // Clipped share above this (and well above baseline) is an exposure issue
+	qualityClippedRatio = 2.0            // Multiple of the baseline's clipped share that is well above it
+	qualityPruneEvery   = 24 * time.Hour
+)
+
+var qualityIssueKinds = []string{models.QualityBlurry, models.QualityNoisy, models.QualityExposure}
+
+// QualityBaseline is a camera's normal image quality at a time of day: the
+// medians of its unflagged samples
+type QualityBaseline struct {
+	Sharpness float64 `json:"sharpness"`
+	Noise     float64 `json:"noise"`
+	Clipped   float64 `json:"clipped"`
+	Samples   int     `json:"samples"`
+}
+
+// QualityStatus is the image quality state of a camera
+type QualityStatus struct {
+	CameraID  uint                  `json:"camera_id"`
+	Degraded  bool                  `json:"degraded"`
+	Issues    []string              `json:"issues"` // Confirmed issues
+	Since     time.Time             `json:"since,omitempty"`
+	Latest    *models.QualitySample `json:"latest,omitempty"`
+	Baseline  *QualityBaseline      `json:"baseline,omitempty"`
+	CheckedAt time.Time             `json:"checked_at"`
+	Error     string                `json:"error,omitempty"`
+}
+
+type qualityState struct {
+	status  QualityStatus
+	flagged map[string]bool
+	present map[string]int // issue -> consecutive samples showing it
+	absent  map[string]int // issue -> consecutive samples without it
+}
+
+// QualityService periodically measures sharpness, exposure and noise of
+// every camera from a snapshot and compares them with the camera's own
+// history at the same time of day, so dirty lenses and failing sensors are
+// flagged before operators notice. Fog at the camera's site doesn't count
+// as a blurry lens.
+type QualityService struct {
+	db       *gorm.DB
+	events   *EventService
+	ingest   *IngestService
+	weather  *WeatherService
+	features *FeatureFlagService
+	config   config.QualityConfig
+	states   map[uint]*qualityState
+	mu       sync.RWMutex
+}
+
+func NewQualityService(cfg config.QualityConfig, db *gorm.DB, events *EventService, ingest *IngestService, weather *WeatherService, features *FeatureFlagService) *QualityService {
+	return &QualityService{
+		db:       db,
+		events:   events,
+		ingest:   ingest,
+		weather:  weather,
+		features: features,
+		config:   cfg,
+		states:   make(map[uint]*qualityState),
+	}
+}
+
+// Start samples every camera each CheckInterval and prunes old samples daily
+func (s *QualityService) Start() {
+	if s.config.CheckInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.CheckInterval)
+		defer ticker.Stop()
+		lastPrune := time.Time{}
+
+		for range ticker.C {
+			s.checkAll()
+			if time.Since(lastPrune) > qualityPruneEvery {
+				s.prune()
+				lastPrune = time.Now()
+			}
+		}
+	}()
+}
+
+func (s *QualityService) checkAll() {
+	var cameras []models.Camera
+	if err := s.db.Find(&cameras).Error; err != nil {
+		fmt.Printf("[Quality] Failed to load cameras: %v\n", err)
+		return
+	}
+
+	jobs := make(chan models.Camera)
+	var wg sync.WaitGroup
+	for i := 0; i < qualityWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for camera := range jobs {
+				s.Check(&camera)
+			}
+		}()
+	}
+	for _, camera := range cameras {
+		if s.features.EnabledFor(models.FeatureAnalytics, &camera) {
+			jobs <- camera
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Check samples one camera's image quality and updates its state
+func (s *QualityService) Check(camera *models.Camera) QualityStatus {
+	now := time.Now()
+	frame, err := captureGrayFrame(camera.ID, PipelineQuality, s.ingest.URL(camera), qualityFrameWidth, qualityFrameHeight)
+	if err != nil {
+		// Offline cameras are reported by stream health, not as poor quality
+		return s.update(camera.ID, QualityStatus{CameraID: camera.ID, CheckedAt: now, Error: err.Error()}, nil)
+	}
+
+	sample := measureQuality(frame, qualityFrameWidth, qualityFrameHeight)
+	sample.CameraID = camera.ID
+	sample.SampledAt = now
+
+	baseline, err := s.baseline(camera.ID, now)
+	if err != nil {
+		return s.update(camera.ID, QualityStatus{CameraID: camera.ID, CheckedAt: now, Error: "failed to load baseline"}, nil)
+	}
+	fog := false
+	if observation := s.weather.ForCamera(camera.ID); observation != nil {
+		fog = observation.Fog
+	}
+	issues := qualityIssues(sample, baseline, fog)
+	sample.Issues = strings.Join(issues, ",")
+	if baseline != nil {
+		score := qualityScore(sample, baseline)
+		sample.Score = &score
+	}
+
+	if err := s.db.Create(sample).Error; err != nil {
+		fmt.Printf("[Quality] Failed to store sample for camera %d: %v\n", camera.ID, err)
+	}
+	return s.update(camera.ID, QualityStatus{CameraID: camera.ID, Latest: sample, Baseline: baseline, CheckedAt: now}, issues)
+}
+
+// update applies a sample's issues to the camera's state, recording
+// quality_degraded / quality_restored events when the confirmed issues change
+func (s *QualityService) update(cameraID uint, status QualityStatus, issues []string) QualityStatus {
+	s.mu.Lock()
+	state := s.state(cameraID, status.CheckedAt)
+	previous := state.status
+
+	if status.Error != "" {
+		// Keep the last known state while the camera can't be read
+		status.Degraded, status.Issues, status.Since = previous.Degraded, previous.Issues, previous.Since
+		status.Latest, status.Baseline = previous.Latest, previous.Baseline
+		state.status = status
+		s.mu.Unlock()
+		return status
+	}
+
+	added, cleared := state.apply(issues)
+	status.Issues = state.issues()
+	status.Degraded = len(status.Issues) > 0
+	status.Since = previous.Since
+	if !status.Degraded {
+		status.Since = time.Time{}
+	} else if !previous.Degraded {
+		status.Since = status.CheckedAt
+	}
+	state.status = status
+	s.mu.Unlock()
+
+	id := cameraID
+	data := map[string]interface{}{"issues": status.Issues, "sample": status.Latest, "baseline": status.Baseline}
+	if len(added) > 0 {
+		s.events.Record(&models.Event{
+			CameraID:    &id,
+			Type:        "quality_degraded",
+			Severity:    "warning",
+			Source:      "quality_scoring",
+			Description: qualityDescription(added),
+			OccurredAt:  status.CheckedAt,
+		}, data)
+	} else if len(cleared) > 0 && !status.Degraded {
+		s.events.Record(&models.Event{
+			CameraID:    &id,
+			Type:        "quality_restored",
+			Severity:    "info",
+			Source:      "quality_scoring",
+			Description: "Camera image quality is back to normal",
+			OccurredAt:  status.CheckedAt,
+		}, data)
+	}
+	return status
+}
+
+// state returns a camera's state, replaying its latest samples after a
+// restart so confirmed issues aren't raised again. Caller holds mu.
+func (s *QualityService) state(cameraID uint, before time.Time) *qualityState {
+	if state, ok := s.states[cameraID]; ok {
+		return state
+	}
+	state := &qualityState{
+		status:  QualityStatus{CameraID: cameraID, Issues: []string{}},
+		flagged: make(map[string]bool),
+		present: make(map[string]int),
+		absent:  make(map[string]int),
+	}
+	s.states[cameraID] = state
+
+	var recent []models.QualitySample
+	if err := s.db.Where("camera_id = ? AND sampled_at < ?", cameraID, before).
+		Order("sampled_at DESC").Limit(qualityConfirmations).Find(&recent).Error; err != nil {
+		fmt.Printf("[Quality] Failed to restore state of camera %d: %v\n", cameraID, err)
+		return state
+	}
+	for i := len(recent) - 1; i >= 0; i-- {
+		var issues []string
+		if recent[i].Issues != "" {
+			issues = strings.Split(recent[i].Issues, ",")
+		}
+		state.apply(issues)
+		if len(state.flagged) > 0 && state.status.Since.IsZero() {
+			state.status.Since = recent[i].SampledAt
+		}
+	}
+	state.status.Issues = state.issues()
+	state.status.Degraded = len(state.status.Issues) > 0
+	return state
+}
+
+// apply counts a sample's issues, returning the issues that became
+// confirmed and those that cleared
+func (state *qualityState) apply(issues []string) ([]string, []string) {
+	var added, cleared []string
+	for _, kind := range qualityIssueKinds {
+		if slices.Contains(issues, kind) {
+			state.present[kind]++
+			state.absent[kind] = 0
+		} else {
+			state.absent[kind]++
+			state.present[kind] = 0
+		}
+		if !state.flagged[kind] && state.present[kind] >= qualityConfirmations {
+			state.flagged[kind] = true
+			added = append(added, kind)
+		}
+		if state.flagged[kind] && state.absent[kind] >= qualityConfirmations {
+			delete(state.flagged, kind)
+			cleared = append(cleared, kind)
+		}
+	}
+	return added, cleared
+}
+
+func (state *qualityState) issues() []string {
+	issues := []string{}
+	for _, kind := range qualityIssueKinds {
+		if state.flagged[kind] {
+			issues = append(issues, kind)
+		}
+	}
+	return issues
+}
+
+// baseline is the median quality of the camera's unflagged samples taken
+// at about the same time of day over the baseline window, nil while there
+// are too few
+func (s *QualityService) baseline(cameraID uint, at time.Time) (*QualityBaseline, error) {
+	var samples []models.QualitySample
+	if err := s.db.Where("camera_id = ? AND sampled_at BETWEEN ? AND ? AND (issues IS NULL OR issues = '')",
+		cameraID, at.Add(-s.config.BaselineWindow), at.Add(-qualityBaselineAge)).
+		Find(&samples).Error; err != nil {
+		return nil, err
+	}
+
+	var sharpness, noise, clipped []float64
+	for _, sample := range samples {
+		diff := sample.SampledAt.In(at.Location()).Hour() - at.Hour()
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > 12 {
+			diff = 24 - diff
+		}
+		if diff > qualityHourSpread {
+			continue
+		}
+		sharpness = append(sharpness, sample.Sharpness)
+		noise = append(noise, sample.Noise)
+		clipped = append(clipped, sample.Clipped)
+	}
+	if len(sharpness) < qualityMinBaseline {
+		return nil, nil
+	}
+	return &QualityBaseline{
+		Sharpness: round1(median(sharpness)),
+		Noise:     round1(median(noise)*100) / 100,
+		Clipped:   math.Round(median(clipped)*1000) / 1000,
+		Samples:   len(sharpness),
+	}, nil
+}
+
+// GetStatus returns the latest quality state of a camera
+func (s *QualityService) GetStatus(cameraID uint) (QualityStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, exists := s.states[cameraID]
+	if !exists {
+		return QualityStatus{}, false
+	}
+	return state.status, true
+}
+
+// Degraded returns the cameras with confirmed quality issues, worst first
+func (s *QualityService) Degraded() []QualityStatus {
+	s.mu.RLock()
+	statuses := []QualityStatus{}
+	for _, state := range s.states {
+		if state.status.Degraded {
+			statuses = append(statuses, state.status)
+		}
+	}
+	s.mu.RUnlock()
+
+	score := func(status QualityStatus) float64 {
+		if status.Latest == nil || status.Latest.Score == nil {
+			return 100
+		}
+		return *status.Latest.Score
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if score(statuses[i]) != score(statuses[j]) {
+			return score(statuses[i]) < score(statuses[j])
+		}
+		return statuses[i].CameraID < statuses[j].CameraID
+	})
+	return statuses
+}
+
+// Reset drops a camera's samples and state so a new baseline is learned,
+// e.g. after the camera was replaced or re-aimed
+func (s *QualityService) Reset(cameraID uint) (int64, error) {
+	result := s.db.Where("camera_id = ?", cameraID).Delete(&models.QualitySample{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	s.mu.Lock()
+	delete(s.states, cameraID)
+	s.mu.Unlock()
+	return result.RowsAffected, nil
+}
+
+func (s *QualityService) prune() {
+	retention := storedRetention(s.db, func(r *models.RetentionSettings) *int { return r.QualityDays }, s.config.Retention)
+	if retention <= 0 {
+		return
+	}
+	if err := s.db.Where("sampled_at < ?", time.Now().Add(-retention)).
+		Delete(&models.QualitySample{}).Error; err != nil {
+		fmt.Printf("[Quality] Failed to prune samples: %v\n", err)
+	}
+}
+
+// measureQuality computes the quality metrics of a grayscale frame
+func measureQuality(frame []byte, width, height int) *models.QualitySample {
+	brightness, _ := frameStats(frame)
+	clipped := 0
+	for _, p := range frame {
+		if p <= 4 || p >= 251 {
+			clipped++
+		}
+	}
+	return &models.QualitySample{
+		Sharpness:  round1(laplacianVariance(frame, width, height)),
+		Brightness: round1(brightness),
+		Clipped:    math.Round(float64(clipped)/float64(len(frame))*1000) / 1000,
+		Noise:      math.Round(noiseSigma(frame, width, height)*100) / 100,
+	}
+}
+
+// qualityIssues compares a sample with the camera's baseline; without a
+// baseline nothing is flagged
+func qualityIssues(sample *models.QualitySample, baseline *QualityBaseline, fog bool) []string {
+	issues := []string{}
+	if baseline == nil {
+		return issues
+	}
+	if !fog && sample.Sharpness < baseline.Sharpness*qualityBlurRatio {
+		issues = append(issues, models.QualityBlurry)
+	}
+	if sample.Noise > qualityMinNoise && sample.Noise > baseline.Noise*qualityNoiseRatio {
+		issues = append(issues, models.QualityNoisy)
+	}
+	if sample.Clipped > qualityMaxClipped && sample.Clipped > baseline.Clipped*qualityClippedRatio {
+		issues = append(issues, models.QualityExposure)
+	}
+	return issues
+}
+
+// qualityScore rates a sample 0-100 against the baseline: 100 is as sharp,
+// clean and well exposed as usual or better
+func qualityScore(sample *models.QualitySample, baseline *QualityBaseline) float64 {
+	score := 100.0
+	if baseline.Sharpness > 0 {
+		score *= math.Min(1, sample.Sharpness/baseline.Sharpness)
+	}
+	score *= math.Min(1, (baseline.Noise+0.5)/(sample.Noise+0.5))
+	score *= 1 - math.Max(0, sample.Clipped-baseline.Clipped)
+	return round1(score)
+}
+
+func qualityDescription(issues []string) string {
+	causes := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		switch issue {
+		case models.QualityBlurry:
+			causes = append(causes, "blurry (dirty, fogged or defocused lens)")
+		case models.QualityNoisy:
+			causes = append(causes, "noisy (failing sensor or IR)")
+		case models.QualityExposure:
+			causes = append(causes, "badly exposed (iris or sensor fault)")
+		}
+	}
+	return "Camera image quality degraded: " + strings.Join(causes, ", ")
+}
+
+// laplacianVariance is the variance of the 4-neighbour Laplacian, the usual
+// focus measure: fine detail disappears when the lens is smeared or defocused
+func laplacianVariance(frame []byte, width, height int) float64 {
+	var sum, sumSq float64
+	n := 0
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			v := 4*float64(frame[i]) - float64(frame[i-1]) - float64(frame[i+1]) - float64(frame[i-width]) - float64(frame[i+width])
+			sum += v
+			sumSq += v * v
+			n++
+		}
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
+
+// noiseSigma estimates the noise standard deviation with Immerkær's method:
+// a mask that cancels out image structure leaves mostly noise
+func noiseSigma(frame []byte, width, height int) float64 {
+	var sum float64
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			p := func(offset int) float64 { return float64(frame[i+offset]) }
+			v := p(-width-1) - 2*p(-width) + p(-width+1) -
+				2*p(-1) + 4*p(0) - 2*p(1) +
+				p(width-1) - 2*p(width) + p(width+1)
+			sum += math.Abs(v)
+		}
+	}
+	return sum * math.Sqrt(math.Pi/2) / (6 * float64((width-2)*(height-2)))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
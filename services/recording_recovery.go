@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+)
+
+// recoveryTimeout bounds the remux of one interrupted segment
+const recoveryTimeout = 2 * time.Minute
+
+// loadInterrupted returns the segments a previous run was still writing
+// when it stopped without closing them (crash, kill, power loss)
+func (s *RecordingService) loadInterrupted() []models.Recording {
+	var segments []models.Recording
+	if err := s.db.Where("status = ? AND mode <> ''", "recording").Find(&segments).Error; err != nil {
+		fmt.Printf("[Recording] Failed to load interrupted segments: %v\n", err)
+	}
+	return segments
+}
+
+// recoverInterrupted finalizes or quarantines segments left open by an
+// unclean shutdown. Segments are fragmented MP4, so everything up to the
+// last complete fragment is readable: it is remuxed into a regular MP4 and
+// completed with its real duration. Empty segments are dropped; segments
+// FFmpeg can't read are moved to <Dir>/quarantine/ and marked quarantined.
+func (s *RecordingService) recoverInterrupted(segments []models.Recording) {
+	if len(segments) == 0 {
+		return
+	}
+	fmt.Printf("[Recording] Recovering %d interrupted segments\n", len(segments))
+
+	var finalized, dropped, quarantined int
+	for i := range segments {
+		segment := &segments[i]
+		info, err := os.Stat(segment.FilePath)
+		if err != nil || info.Size() == 0 {
+			os.Remove(segment.FilePath)
+			if err := s.db.Delete(segment).Error; err != nil {
+				fmt.Printf("[Recording] Failed to drop empty segment %s: %v\n", segment.FilePath, err)
+			}
+			dropped++
+			continue
+		}
+
+		duration, err := remuxSegment(segment.CameraID, segment.FilePath)
+		if err != nil {
+			fmt.Printf("[Recording] Segment %s is unreadable, quarantining it: %v\n", segment.FilePath, err)
+			s.quarantine(segment)
+			quarantined++
+			continue
+		}
+		s.closeSegment(segment, segment.StartTime.Add(duration), true)
+		finalized++
+	}
+
+	fmt.Printf("[Recording] Recovery done: %d finalized, %d empty dropped, %d quarantined\n", finalized, dropped, quarantined)
+}
+
+// remuxSegment rewrites an interrupted segment in place as a regular MP4
+// and returns how much of it was recovered
+func remuxSegment(cameraID uint, path string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), recoveryTimeout)
+	defer cancel()
+
+	// Keeps the extension so FFmpeg picks the MP4 muxer
+	partial := strings.TrimSuffix(path, filepath.Ext(path)) + ".recovered.mp4"
+	stderr := newFFmpegErrorWriter(cameraID, PipelineRecording)
+	cmd := FFmpegCommandContext(ctx,
+		"-loglevel", "error",
+		"-i", path,
+		"-map", "0", "-c", "copy",
+		"-movflags", "+faststart",
+		"-progress", "pipe:1", // key=value lines, out_time_us is how far the copy got
+		"-y", partial,
+	)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		os.Remove(partial)
+		if streamErr := stderr.LastError(); streamErr != nil {
+			return 0, streamErr
+		}
+		return 0, err
+	}
+
+	var duration time.Duration
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "out_time_us="); ok {
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us > 0 {
+				duration = time.Duration(us) * time.Microsecond
+			}
+		}
+	}
+	if duration <= 0 {
+		os.Remove(partial)
+		return 0, fmt.Errorf("no media could be read")
+	}
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return 0, err
+	}
+	return duration, nil
+}
+
+// quarantine moves an unreadable segment out of the camera's directory so
+// playback and exports never pick it up, keeping it for manual inspection
+func (s *RecordingService) quarantine(segment *models.Recording) {
+	dir := filepath.Join(s.config.Dir, "quarantine", fmt.Sprintf("cam%d", segment.CameraID))
+	path := filepath.Join(dir, filepath.Base(segment.FilePath))
+	if err := os.MkdirAll(dir, 0o755); err == nil {
+		if err := os.Rename(segment.FilePath, path); err == nil {
+			segment.FilePath = path
+		} else {
+			fmt.Printf("[Recording] Failed to move %s to quarantine: %v\n", segment.FilePath, err)
+		}
+	}
+
+	err := s.db.Model(segment).Updates(map[string]interface{}{
+		"status":    "quarantined",
+		"file_path": segment.FilePath,
+	}).Error
+	if err != nil {
+		fmt.Printf("[Recording] Failed to quarantine segment %s: %v\n", segment.FilePath, err)
+	}
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/database"
+	"command-center-vms-cctv/be/models"
+)
+
+const (
+	retentionInterval  = time.Hour
+	retentionBatchSize = 500 // Segments pruned per round; the rest wait for the next
+	clipCutTimeout     = 2 * time.Minute
+)
+
+// clipWindow is a stretch of a segment kept as a RetainedClip, with what it
+// was kept for
+type clipWindow struct {
+	start, end time.Time
+	events     []uint
+	bookmarks  []uint
+}
+
+// startRetention deletes completed segments older than the settings'
+// recording_days (default RECORDING_RETENTION) every hour. Segments on
+// legal hold are skipped; footage around events and patrol bookmarks is cut
+// out first and kept as RetainedClips for clip_days (default
+// RECORDING_CLIP_RETENTION). Failed and quarantined segments are deleted
+// after the same retention, without clips.
+func (s *RecordingService) startRetention() {
+	go func() {
+		for {
+			if retention := storedRetention(s.db, func(r *models.RetentionSettings) *int { return r.RecordingDays }, s.config.Retention); retention > 0 {
+				s.pruneRecordings(time.Now(), retention)
+				s.pruneUnreadable(time.Now(), retention)
+			}
+			s.pruneClips(time.Now())
+			time.Sleep(retentionInterval)
+		}
+	}()
+}
+
+func (s *RecordingService) pruneRecordings(now time.Time, retention time.Duration) {
+	var segments []models.Recording
+	if err := s.db.Scopes(database.NotOnLegalHold()).
+		Where("status = ? AND end_time < ?", "completed", now.Add(-retention)).
+		Order("start_time").Limit(retentionBatchSize).Find(&segments).Error; err != nil {
+		fmt.Printf("[Recording] Failed to load expired segments: %v\n", err)
+		return
+	}
+
+	clipRetention := storedRetention(s.db, func(r *models.RetentionSettings) *int { return r.ClipDays }, s.config.ClipRetention)
+	deleted, clips := 0, 0
+	for i := range segments {
+		segment := &segments[i]
+		kept, err := s.keepClips(segment, now, clipRetention)
+		if err != nil {
+			// The segment stays until its clips can be cut
+			fmt.Printf("[Recording] Failed to keep clips of %s: %v\n", segment.FilePath, err)
+			continue
+		}
+		clips += kept
+
+		if err := s.db.Delete(segment).Error; err != nil {
+			fmt.Printf("[Recording] Failed to delete expired segment %s: %v\n", segment.FilePath, err)
+			continue
+		}
+		removeSegmentFiles(segment.FilePath)
+		deleted++
+	}
+	if deleted > 0 {
+		fmt.Printf("[Recording] Retention deleted %d segments, kept %d clips\n", deleted, clips)
+	}
+}
+
+// pruneUnreadable deletes failed and quarantined segments older than the
+// retention, by their end or, when they never got one, start time. Nothing
+// can be cut from them, so no clips are kept.
+func (s *RecordingService) pruneUnreadable(now time.Time, retention time.Duration) {
+	var segments []models.Recording
+	if err := s.db.Scopes(database.NotOnLegalHold()).
+		Where("status IN ? AND COALESCE(end_time, start_time) < ?", []string{"failed", "quarantined"}, now.Add(-retention)).
+		Order("start_time").Limit(retentionBatchSize).Find(&segments).Error; err != nil {
+		fmt.Printf("[Recording] Failed to load expired unreadable segments: %v\n", err)
+		return
+	}
+
+	deleted := 0
+	for i := range segments {
+		if err := s.db.Delete(&segments[i]).Error; err != nil {
+			fmt.Printf("[Recording] Failed to delete expired segment %s: %v\n", segments[i].FilePath, err)
+			continue
+		}
+		removeSegmentFiles(segments[i].FilePath)
+		deleted++
+	}
+	if deleted > 0 {
+		fmt.Printf("[Recording] Retention deleted %d failed or quarantined segments\n", deleted)
+	}
+}
+
+// keepClips cuts the clips of a segment about to be deleted and returns how
+// many were kept
+func (s *RecordingService) keepClips(segment *models.Recording, now time.Time, clipRetention time.Duration) (int, error) {
+	if clipRetention <= 0 || segment.EndTime == nil {
+		return 0, nil
+	}
+	windows, err := s.clipWindows(segment)
+	if err != nil {
+		return 0, err
+	}
+
+	dir := filepath.Join(s.config.Dir, "clips", fmt.Sprintf("cam%d", segment.CameraID))
+	if len(windows) > 0 {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return 0, err
+		}
+	}
+	for _, window := range windows {
+		// Left over from a round that failed on a later clip of the segment
+		var existing int64
+		if err := s.db.Model(&models.RetainedClip{}).
+			Where("camera_id = ? AND start_time = ?", segment.CameraID, window.start).Count(&existing).Error; err != nil {
+			return 0, err
+		}
+		if existing > 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, window.start.UTC().Format("20060102-150405")+".mp4")
+		if err := cutClip(segment, window, path); err != nil {
+			return 0, err
+		}
+		var size int64
+		if info, err := os.Stat(path); err == nil {
+			size = info.Size()
+		}
+		clip := models.RetainedClip{
+			CameraID:    segment.CameraID,
+			StartTime:   window.start,
+			EndTime:     window.end,
+			FilePath:    path,
+			SizeBytes:   size,
+			EventIDs:    joinUints(window.events),
+			BookmarkIDs: joinUints(window.bookmarks),
+			ExpiresAt:   now.Add(clipRetention),
+		}
+		if err := s.db.Create(&clip).Error; err != nil {
+			os.Remove(path)
+			return 0, err
+		}
+	}
+	return len(windows), nil
+}
+
+// clipWindows returns the stretches of a segment within ClipPadding of an
+// event of a clip severity or a patrol bookmark, overlapping ones merged
+func (s *RecordingService) clipWindows(segment *models.Recording) ([]clipWindow, error) {
+	padding := s.config.ClipPadding
+	from, to := segment.StartTime, *segment.EndTime
+
+	var events []models.Event
+	if len(s.config.ClipSeverities) > 0 {
+		if err := s.db.Select("id", "occurred_at").
+			Where("camera_id = ? AND severity IN ? AND occurred_at >= ? AND occurred_at <= ?",
+				segment.CameraID, s.config.ClipSeverities, from.Add(-padding), to.Add(padding)).
+			Find(&events).Error; err != nil {
+			return nil, err
+		}
+	}
+	var bookmarks []models.PatrolBookmark
+	if err := s.db.Select("id", "\"from\"", "\"to\"").
+		Where("camera_id = ? AND \"from\" <= ? AND \"to\" >= ?", segment.CameraID, to.Add(padding), from.Add(-padding)).
+		Find(&bookmarks).Error; err != nil {
+		return nil, err
+	}
+
+	var windows []clipWindow
+	for _, event := range events {
+		windows = append(windows, clipWindow{
+			start:  event.OccurredAt.Add(-padding),
+			end:    event.OccurredAt.Add(padding),
+			events: []uint{event.ID},
+		})
+	}
+	for _, bookmark := range bookmarks {
+		windows = append(windows, clipWindow{
+			start:     bookmark.From.Add(-padding),
+			end:       bookmark.To.Add(padding),
+			bookmarks: []uint{bookmark.ID},
+		})
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start.Before(windows[j].start) })
+
+	var merged []clipWindow
+	for _, window := range windows {
+		if window.start.Before(from) {
+			window.start = from
+		}
+		if window.end.After(to) {
+			window.end = to
+		}
+		if !window.end.After(window.start) {
+			continue
+		}
+		if last := len(merged) - 1; last >= 0 && !window.start.After(merged[last].end) {
+			if window.end.After(merged[last].end) {
+				merged[last].end = window.end
+			}
+			merged[last].events = append(merged[last].events, window.events...)
+			merged[last].bookmarks = append(merged[last].bookmarks, window.bookmarks...)
+			continue
+		}
+		merged = append(merged, window)
+	}
+	return merged, nil
+}
+
+// cutClip copies a window of a segment to path without re-encoding; the
+// clip starts at the keyframe before the window
+func cutClip(segment *models.Recording, window clipWindow, path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), clipCutTimeout)
+	defer cancel()
+
+	stderr := newFFmpegErrorWriter(segment.CameraID, PipelineRecording)
+	cmd := FFmpegCommandContext(ctx,
+		"-loglevel", "error",
+		"-ss", fmt.Sprintf("%.3f", window.start.Sub(segment.StartTime).Seconds()),
+		"-i", segment.FilePath,
+		"-t", fmt.Sprintf("%.3f", window.end.Sub(window.start).Seconds()),
+		"-map", "0", "-c", "copy",
+		"-movflags", "+faststart",
+		"-y", path,
+	)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(path)
+		if streamErr := stderr.LastError(); streamErr != nil {
+			return streamErr
+		}
+		return err
+	}
+	return nil
+}
+
+// pruneClips deletes expired clips, unless a legal hold covers them
+func (s *RecordingService) pruneClips(now time.Time) {
+	var clips []models.RetainedClip
+	if err := s.db.Where("expires_at < ?", now).
+		Where(`NOT EXISTS (SELECT 1 FROM legal_holds h
+			WHERE h.camera_id = retained_clips.camera_id AND h.released_at IS NULL
+			AND h.start_time < retained_clips.end_time AND h.end_time > retained_clips.start_time)`).
+		Limit(retentionBatchSize).Find(&clips).Error; err != nil {
+		fmt.Printf("[Recording] Failed to load expired clips: %v\n", err)
+		return
+	}
+	for i := range clips {
+		if err := s.db.Delete(&clips[i]).Error; err != nil {
+			fmt.Printf("[Recording] Failed to delete expired clip %s: %v\n", clips[i].FilePath, err)
+			continue
+		}
+		if err := os.Remove(clips[i].FilePath); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[Recording] Failed to remove clip %s: %v\n", clips[i].FilePath, err)
+		}
+	}
+	if len(clips) > 0 {
+		fmt.Printf("[Recording] Retention deleted %d expired clips\n", len(clips))
+	}
+}
+
+// removeSegmentFiles deletes a segment's file and thumbnail sprite
+func removeSegmentFiles(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("[Recording] Failed to remove segment %s: %v\n", path, err)
+	}
+	if err := os.Remove(SpritePath(path)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("[Recording] Failed to remove thumbnails of %s: %v\n", path, err)
+	}
+}
+
+func joinUints(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// PipelineRecording is the usage tracker pipeline of recorders
+const PipelineRecording = "recording"
+
+// PipelinePlayback is the FFmpeg remuxing a recording into a playback
+// segment
+const PipelinePlayback = "playback"
+
+// recorderStopTimeout is how long FFmpeg gets to finalize the current
+// segment after an interrupt before it is killed
+const recorderStopTimeout = 10 * time.Second
+
+var ErrAlreadyRecording = errors.New("camera is already recording")
+
+// Recorder is a running recording of one camera
+type Recorder struct {
+	CameraID  uint       `json:"camera_id"`
+	Mode      string     `json:"mode"` // continuous, on_demand
+	StartedAt time.Time  `json:"started_at"`
+	StopAt    *time.Time `json:"stop_at,omitempty"` // End of an on-demand recording with a duration
+	Segments  int        `json:"segments"`          // Completed segments so far
+
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// RecordingService records camera RTSP streams to disk as segmented MP4 with
+// FFmpeg (stream copy, no transcode), one Recording row per segment.
+// Continuous recording follows each camera's RecordingSchedule; on-demand
+// recordings are started and stopped from the API. Neither runs while a
+// privacy schedule blacks the camera out.
+type RecordingService struct {
+	config     config.RecordingConfig
+	db         *gorm.DB
+	ingest     *IngestService
+	usage      *UsageTracker
+	thumbnails *ThumbnailService
+	features   *FeatureFlagService
+	privacy    *PrivacyService
+	mu         sync.Mutex
+	running    bool               // Recorders run here; only on the cluster leader
+	recorders  map[uint]*Recorder // camera_id -> running recorder
+}
+
+func NewRecordingService(cfg config.RecordingConfig, db *gorm.DB, ingest *IngestService, usage *UsageTracker, thumbnails *ThumbnailService, features *FeatureFlagService, privacy *PrivacyService) *RecordingService {
+	return &RecordingService{
+		config:     cfg,
+		db:         db,
+		ingest:     ingest,
+		usage:      usage,
+		thumbnails: thumbnails,
+		features:   features,
+		privacy:    privacy,
+		recorders:  make(map[uint]*Recorder),
+	}
+}
+
+// Start recovers segments left open by a previous run in the background and
+// applies schedules now and at every minute boundary, so recording resumes
+// right away after a crash. Recorders that died (camera offline) are
+// restarted on the next tick. Retention pruning runs hourly when enabled.
+func (s *RecordingService) Start() {
+	s.mu.Lock()
+	s.running = true
+	s.mu.Unlock()
+
+	// Loaded before any recorder opens new segments
+	interrupted := s.loadInterrupted()
+	go s.recoverInterrupted(interrupted)
+	s.startRetention()
+
+	go func() {
+		for {
+			s.applySchedules(time.Now())
+			now := time.Now()
+			time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		}
+	}()
+}
+
+// applySchedules starts and stops continuous recorders and ends on-demand
+// recordings whose duration is over
+func (s *RecordingService) applySchedules(now time.Time) {
+	var schedules []models.RecordingSchedule
+	if err := s.db.Where("enabled = ?", true).Find(&schedules).Error; err != nil {
+		fmt.Printf("[Recording] Failed to load schedules: %v\n", err)
+		return
+	}
+	wanted := make(map[uint]bool)
+	for i := range schedules {
+		if schedules[i].ActiveAt(now) {
+			wanted[schedules[i].CameraID] = true
+		}
+	}
+
+	var stop []uint
+	s.mu.Lock()
+	for cameraID, recorder := range s.recorders {
+		switch {
+		case recorder.Mode == models.RecordingContinuous && !wanted[cameraID]:
+			stop = append(stop, cameraID)
+		case recorder.StopAt != nil && now.After(*recorder.StopAt):
+			stop = append(stop, cameraID)
+		}
+		delete(wanted, cameraID)
+	}
+	s.mu.Unlock()
+
+	for _, cameraID := range stop {
+		s.Stop(cameraID)
+	}
+	for cameraID := range wanted {
+		var camera models.Camera
+		if err := s.db.First(&camera, cameraID).Error; err != nil {
+			continue
+		}
+		if _, err := s.start(&camera, models.RecordingContinuous, nil); err != nil && err != ErrAlreadyRecording && err != ErrFeatureDisabled && err != ErrPrivacyMode {
+			fmt.Printf("[Recording] Failed to start recording camera %d: %v\n", cameraID, err)
+		}
+	}
+}
+
+// StartOnDemand records a camera until Stop, or for duration when non-zero
+func (s *RecordingService) StartOnDemand(camera *models.Camera, duration time.Duration) (Recorder, error) {
+	var stopAt *time.Time
+	if duration > 0 {
+		at := time.Now().Add(duration)
+		stopAt = &at
+	}
+	return s.start(camera, models.RecordingOnDemand, stopAt)
+}
+
+// Running reports whether recorders run on this instance. In cluster mode
+// they only run on the leader, and recordings are started and stopped there.
+func (s *RecordingService) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Status returns the camera's running recorder
+func (s *RecordingService) Status(cameraID uint) (Recorder, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recorder, ok := s.recorders[cameraID]
+	if !ok {
+		return Recorder{}, false
+	}
+	return *recorder, true
+}
+
+// Stop ends a camera's recording, letting FFmpeg finalize the current
+// segment, and reports whether one was running. A continuous recording
+// starts again on the next schedule tick if its schedule is still active.
+func (s *RecordingService) Stop(cameraID uint) bool {
+	s.mu.Lock()
+	recorder, ok := s.recorders[cameraID]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	recorder.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-recorder.done:
+	case <-time.After(recorderStopTimeout):
+		recorder.cmd.Process.Kill()
+		<-recorder.done
+	}
+	return true
+}
+
+func (s *RecordingService) start(camera *models.Camera, mode string, stopAt *time.Time) (Recorder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return Recorder{}, ErrNotLeader
+	}
+	if recorder, ok := s.recorders[camera.ID]; ok {
+		return *recorder, ErrAlreadyRecording
+	}
+	if !s.features.EnabledFor(models.FeatureRecording, camera) {
+		return Recorder{}, ErrFeatureDisabled
+	}
+	if _, private := s.privacy.Active(camera.ID); private {
+		return Recorder{}, ErrPrivacyMode
+	}
+
+	dir := filepath.Join(s.config.Dir, fmt.Sprintf("cam%d", camera.ID))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Recorder{}, err
+	}
+	startedAt := time.Now()
+	pattern := filepath.Join(dir, startedAt.UTC().Format("20060102T150405")+"-%05d.mp4")
+
+	cmd := FFmpegCommand(
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", s.ingest.URL(camera),
+		"-map", "0:v", "-map", "0:a?",
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", strconv.Itoa(int(s.config.SegmentDuration.Seconds())),
+		"-segment_format", "mp4",
+		// Fragmented, so a segment cut short by a crash stays readable
+		"-segment_format_options", "movflags=+frag_keyframe+empty_moov+default_base_moof",
+		"-reset_timestamps", "1",
+		"-segment_list", "pipe:1", // One "file,start,end" line per finished segment
+		"-segment_list_type", "csv",
+		pattern,
+	)
+	stderr := newFFmpegErrorWriter(camera.ID, PipelineRecording)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return Recorder{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return Recorder{}, err
+	}
+	s.usage.TrackProcess(camera.ID, PipelineRecording, cmd)
+
+	recorder := &Recorder{
+		CameraID:  camera.ID,
+		Mode:      mode,
+		StartedAt: startedAt,
+		StopAt:    stopAt,
+		cmd:       cmd,
+		done:      make(chan struct{}),
+	}
+	s.recorders[camera.ID] = recorder
+	fmt.Printf("[Recording] Started %s recording of camera %d\n", mode, camera.ID)
+
+	go s.track(recorder, pattern, bufio.NewScanner(stdout), stderr)
+	return *recorder, nil
+}
+
+// track keeps the Recording rows of a recorder in step with FFmpeg: a row is
+// opened for each segment and completed when FFmpeg lists it as finished
+func (s *RecordingService) track(recorder *Recorder, pattern string, segments *bufio.Scanner, stderr *ffmpegErrorWriter) {
+	defer close(recorder.done)
+
+	index := 0
+	current := s.openSegment(recorder, pattern, index, recorder.StartedAt)
+	for segments.Scan() {
+		// file,start,end with start and end in seconds since the recording began
+		fields := strings.Split(segments.Text(), ",")
+		if len(fields) < 3 {
+			continue
+		}
+		endOffset, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			continue
+		}
+		end := recorder.StartedAt.Add(time.Duration(endOffset * float64(time.Second)))
+		s.closeSegment(current, end, true)
+
+		s.mu.Lock()
+		recorder.Segments++
+		s.mu.Unlock()
+		index++
+		current = s.openSegment(recorder, pattern, index, end)
+	}
+
+	err := recorder.cmd.Wait()
+	s.closeSegment(current, time.Now(), false)
+
+	s.mu.Lock()
+	delete(s.recorders, recorder.CameraID)
+	s.mu.Unlock()
+
+	if streamErr := stderr.LastError(); streamErr != nil {
+		fmt.Printf("[Recording] Recording of camera %d ended: %s\n", recorder.CameraID, streamErr.Message)
+	} else {
+		fmt.Printf("[Recording] Recording of camera %d ended (%v)\n", recorder.CameraID, err)
+	}
+}
+
+func (s *RecordingService) openSegment(recorder *Recorder, pattern string, index int, start time.Time) *models.Recording {
+	segment := &models.Recording{
+		CameraID:  recorder.CameraID,
+		StartTime: start,
+		FilePath:  fmt.Sprintf(pattern, index),
+		Status:    "recording",
+		Mode:      recorder.Mode,
+	}
+	if err := s.db.Create(segment).Error; err != nil {
+		fmt.Printf("[Recording] Failed to store segment of camera %d: %v\n", recorder.CameraID, err)
+	}
+	return segment
+}
+
+// closeSegment completes a segment row; a segment FFmpeg never finished is
+// kept if it has data and dropped otherwise
+func (s *RecordingService) closeSegment(segment *models.Recording, end time.Time, finished bool) {
+	var size int64
+	if info, err := os.Stat(segment.FilePath); err == nil {
+		size = info.Size()
+	}
+	if !finished && size == 0 {
+		os.Remove(segment.FilePath)
+		if err := s.db.Delete(segment).Error; err != nil {
+			fmt.Printf("[Recording] Failed to drop empty segment %s: %v\n", segment.FilePath, err)
+		}
+		return
+	}
+	err := s.db.Model(segment).Updates(map[string]interface{}{
+		"end_time":   end,
+		"size_bytes": size,
+		"status":     "completed",
+	}).Error
+	if err != nil {
+		fmt.Printf("[Recording] Failed to complete segment %s: %v\n", segment.FilePath, err)
+		return
+	}
+	segment.EndTime = &end
+	s.thumbnails.Enqueue(*segment)
+}
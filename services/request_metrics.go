@@ -0,0 +1,150 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds (ms) of the request latency histogram;
+// slower requests land in a final overflow bucket
+var latencyBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// LatencyBucket is one histogram bucket. LE is the upper bound in ms, 0 for
+// the overflow bucket.
+type LatencyBucket struct {
+	LE    float64 `json:"le_ms"`
+	Count int64   `json:"count"`
+}
+
+// RouteMetrics is the latency histogram of one route since startup (or the
+// last reset)
+type RouteMetrics struct {
+	Method  string          `json:"method"`
+	Route   string          `json:"route"`
+	Count   int64           `json:"count"`
+	Errors  int64           `json:"errors"` // 5xx responses
+	AvgMs   float64         `json:"avg_ms"`
+	MaxMs   float64         `json:"max_ms"`
+	P50Ms   float64         `json:"p50_ms"` // Percentiles are bucket upper bounds
+	P95Ms   float64         `json:"p95_ms"`
+	P99Ms   float64         `json:"p99_ms"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type routeStats struct {
+	count   int64
+	errors  int64
+	totalMs float64
+	maxMs   float64
+	buckets []int64 // len(latencyBuckets)+1
+}
+
+// RequestMetrics keeps per-route latency histograms in memory
+type RequestMetrics struct {
+	mu     sync.Mutex
+	routes map[routeKey]*routeStats
+	since  time.Time
+}
+
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{
+		routes: make(map[routeKey]*routeStats),
+		since:  time.Now(),
+	}
+}
+
+// Observe records one request
+func (m *RequestMetrics) Observe(method, route string, status int, elapsed time.Duration) {
+	ms := float64(elapsed) / float64(time.Millisecond)
+	bucket := sort.SearchFloat64s(latencyBuckets, ms)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := routeKey{method: method, route: route}
+	stats, exists := m.routes[key]
+	if !exists {
+		stats = &routeStats{buckets: make([]int64, len(latencyBuckets)+1)}
+		m.routes[key] = stats
+	}
+	stats.count++
+	if status >= 500 {
+		stats.errors++
+	}
+	stats.totalMs += ms
+	if ms > stats.maxMs {
+		stats.maxMs = ms
+	}
+	stats.buckets[bucket]++
+}
+
+// Snapshot returns every route's metrics, slowest p95 first, and when
+// collection started
+func (m *RequestMetrics) Snapshot() ([]RouteMetrics, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]RouteMetrics, 0, len(m.routes))
+	for key, stats := range m.routes {
+		metrics := RouteMetrics{
+			Method:  key.method,
+			Route:   key.route,
+			Count:   stats.count,
+			Errors:  stats.errors,
+			AvgMs:   stats.totalMs / float64(stats.count),
+			MaxMs:   stats.maxMs,
+			P50Ms:   stats.percentile(0.50),
+			P95Ms:   stats.percentile(0.95),
+			P99Ms:   stats.percentile(0.99),
+			Buckets: make([]LatencyBucket, len(stats.buckets)),
+		}
+		for i, count := range stats.buckets {
+			if i < len(latencyBuckets) {
+				metrics.Buckets[i].LE = latencyBuckets[i]
+			}
+			metrics.Buckets[i].Count = count
+		}
+		result = append(result, metrics)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].P95Ms != result[j].P95Ms {
+			return result[i].P95Ms > result[j].P95Ms
+		}
+		return result[i].Route < result[j].Route
+	})
+	return result, m.since
+}
+
+// Reset clears all histograms
+func (m *RequestMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes = make(map[routeKey]*routeStats)
+	m.since = time.Now()
+}
+
+// percentile returns the upper bound of the bucket holding the p-th request;
+// for the overflow bucket that's the slowest request seen
+func (s *routeStats) percentile(p float64) float64 {
+	target := int64(float64(s.count)*p + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for i, count := range s.buckets {
+		seen += count
+		if seen >= target {
+			if i < len(latencyBuckets) {
+				return latencyBuckets[i]
+			}
+			break
+		}
+	}
+	return s.maxMs
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// storedRetention is the retention of a kind of data saved in the settings,
+// or fallback (its environment variable) when none is. The retention
+// workers look it up every round, so a change applies without a restart.
+func storedRetention(db *gorm.DB, days func(*models.RetentionSettings) *int, fallback time.Duration) time.Duration {
+	var settings models.Settings
+	err := db.First(&settings, models.SettingsID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fallback
+	}
+	if err != nil {
+		fmt.Printf("[Settings] Failed to load retention settings, using the environment's: %v\n", err)
+		return fallback
+	}
+	if stored := days(&settings.Retention); stored != nil {
+		return time.Duration(*stored) * 24 * time.Hour
+	}
+	return fallback
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RTSPProbeResult describes what a camera advertises in its SDP
+type RTSPProbeResult struct {
+	VideoCodecs []string      `json:"video_codecs"`
+	AudioCodecs []string      `json:"audio_codecs"`
+	H264Profile string        `json:"h264_profile,omitempty"` // profile-level-id from fmtp, e.g. 42e01f
+	Latency     time.Duration `json:"latency"`
+}
+
+// IsH264Baseline reports whether the camera's H.264 stream uses the
+// (constrained) baseline profile, which every WebRTC browser can decode
+func (r *RTSPProbeResult) IsH264Baseline() bool {
+	return r.HasVideoCodec("H264") && strings.HasPrefix(strings.ToLower(r.H264Profile), "42")
+}
+
+// H264ProfileName names the profile of the camera's H.264 stream from its
+// profile_idc: baseline, main, extended or high ("" if unknown)
+func (r *RTSPProbeResult) H264ProfileName() string {
+	if !r.HasVideoCodec("H264") || len(r.H264Profile) < 2 {
+		return ""
+	}
+	switch strings.ToLower(r.H264Profile[:2]) {
+	case "42":
+		return "baseline"
+	case "4d":
+		return "main"
+	case "58":
+		return "extended"
+	case "64":
+		return "high"
+	}
+	return ""
+}
+
+// HasVideoCodec reports whether the camera advertises the given video codec (e.g. "H264")
+func (r *RTSPProbeResult) HasVideoCodec(codec string) bool {
+	for _, c := range r.VideoCodecs {
+		if strings.EqualFold(c, codec) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProbeRTSP connects to an RTSP source and issues a DESCRIBE to check that the
+// stream is reachable, credentials work, and which codecs it carries.
+// Failures are returned as a classified *StreamError.
+func ProbeRTSP(rtspURL string, timeout time.Duration) (*RTSPProbeResult, *StreamError) {
+	u, err := url.Parse(rtspURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, newStreamError(ReasonUnknown, "probe", "invalid RTSP URL")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "554"
+	}
+	address := net.JoinHostPort(u.Hostname(), port)
+
+	// Injected by ChaosService; counts against the timeout like a slow network
+	if delay := injectedRTSPDelay(); delay > 0 {
+		if delay >= timeout {
+			time.Sleep(timeout)
+			return nil, newStreamError(ReasonTimeout, "probe", "connection timed out (delay injected by chaos)")
+		}
+		time.Sleep(delay)
+		timeout -= delay
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, newStreamError(classifyNetError(err), "probe", err.Error())
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Request URL must not contain credentials
+	requestURL := *u
+	requestURL.User = nil
+	uri := requestURL.String()
+
+	username, password := "", ""
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+
+	reader := bufio.NewReader(conn)
+	status, headers, body, err := rtspDescribe(conn, reader, uri, 1, "")
+	if err != nil {
+		return nil, newStreamError(classifyNetError(err), "probe", err.Error())
+	}
+
+	if status == 401 {
+		if username == "" {
+			return nil, newStreamError(ReasonAuthFailed, "probe", "camera requires credentials but none are configured")
+		}
+		authorization := rtspAuthorization(preferredChallenge(headers.Values("WWW-Authenticate")), "DESCRIBE", uri, username, password)
+		status, _, body, err = rtspDescribe(conn, reader, uri, 2, authorization)
+		if err != nil {
+			return nil, newStreamError(classifyNetError(err), "probe", err.Error())
+		}
+	}
+
+	switch {
+	case status == 200:
+	case status == 401 || status == 403:
+		return nil, newStreamError(ReasonAuthFailed, "probe", fmt.Sprintf("camera rejected credentials (RTSP %d)", status))
+	case status == 404:
+		return nil, newStreamError(ReasonStreamNotFound, "probe", "stream path not found on camera (RTSP 404)")
+	default:
+		return nil, newStreamError(ReasonUnknown, "probe", fmt.Sprintf("unexpected RTSP status %d", status))
+	}
+
+	result := parseSDPCodecs(body)
+	result.Latency = time.Since(start)
+	return result, nil
+}
+
+// rtspDescribe sends a DESCRIBE request and reads the response
+func rtspDescribe(conn net.Conn, reader *bufio.Reader, uri string, cseq int, authorization string) (int, textproto.MIMEHeader, string, error) {
+	request := fmt.Sprintf("DESCRIBE %s RTSP/1.0\r\nCSeq: %d\r\nAccept: application/sdp\r\nUser-Agent: command-center-vms\r\n", uri, cseq)
+	if authorization != "" {
+		request += "Authorization: " + authorization + "\r\n"
+	}
+	request += "\r\n"
+
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return 0, nil, "", err
+	}
+
+	tp := textproto.NewReader(reader)
+	statusLine, err := tp.ReadLine()
+	if err != nil {
+		return 0, nil, "", err
+	}
+	// RTSP/1.0 200 OK
+	parts := strings.SplitN(statusLine, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "RTSP/") {
+		return 0, nil, "", fmt.Errorf("invalid RTSP response: %q", statusLine)
+	}
+	status, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, nil, "", fmt.Errorf("invalid RTSP status: %q", statusLine)
+	}
+
+	headers, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return 0, nil, "", err
+	}
+
+	var body string
+	if length, _ := strconv.Atoi(headers.Get("Content-Length")); length > 0 {
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return 0, nil, "", err
+		}
+		body = string(buf)
+	}
+
+	return status, headers, body, nil
+}
+
+// preferredChallenge picks the Digest challenge when a camera offers several
+func preferredChallenge(challenges []string) string {
+	for _, challenge := range challenges {
+		if strings.HasPrefix(strings.ToLower(challenge), "digest") {
+			return challenge
+		}
+	}
+	if len(challenges) > 0 {
+		return challenges[0]
+	}
+	return ""
+}
+
+// rtspAuthorization builds a Basic or Digest Authorization header for a challenge
+func rtspAuthorization(challenge, method, uri, username, password string) string {
+	if !strings.HasPrefix(strings.ToLower(challenge), "digest") {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+
+	params := make(map[string]string)
+	for _, field := range strings.Split(challenge[len("Digest"):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	md5hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := md5hex(username + ":" + params["realm"] + ":" + password)
+	ha2 := md5hex(method + ":" + uri)
+	response := md5hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, params["realm"], params["nonce"], uri, response)
+}
+
+// staticPayloadCodecs are RTP payload types with a fixed codec (RFC 3551),
+// which cameras often advertise without an a=rtpmap line
+var staticPayloadCodecs = map[string]string{
+	"0":  "PCMU",
+	"8":  "PCMA",
+	"14": "MPA",
+	"26": "JPEG",
+	"32": "MPV",
+}
+
+// parseSDPCodecs extracts codec names per media section from an SDP body
+func parseSDPCodecs(sdp string) *RTSPProbeResult {
+	result := &RTSPProbeResult{}
+	seen := make(map[string]bool)
+	add := func(media, codec string) {
+		if seen[media+codec] {
+			return
+		}
+		seen[media+codec] = true
+		switch media {
+		case "video":
+			result.VideoCodecs = append(result.VideoCodecs, codec)
+		case "audio":
+			result.AudioCodecs = append(result.AudioCodecs, codec)
+		}
+	}
+
+	media := ""
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			// m=video 0 RTP/AVP 96
+			fields := strings.Fields(line[2:])
+			if len(fields) == 0 {
+				continue
+			}
+			media = fields[0]
+			if len(fields) > 3 {
+				for _, pt := range fields[3:] {
+					if codec, ok := staticPayloadCodecs[pt]; ok {
+						add(media, codec)
+					}
+				}
+			}
+		case strings.HasPrefix(line, "a=rtpmap:"):
+			// a=rtpmap:96 H264/90000
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			add(media, strings.ToUpper(strings.SplitN(fields[1], "/", 2)[0]))
+		case strings.HasPrefix(line, "a=fmtp:") && media == "video":
+			// a=fmtp:96 packetization-mode=1;profile-level-id=42e01f;sprop-parameter-sets=...
+			for _, param := range strings.Split(line, ";") {
+				param = strings.TrimSpace(param)
+				if idx := strings.Index(param, "profile-level-id="); idx >= 0 {
+					result.H264Profile = param[idx+len("profile-level-id="):]
+				}
+			}
+		}
+	}
+	return result
+}
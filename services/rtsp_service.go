@@ -11,13 +11,18 @@ import (
 	"time"
 
 	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
 )
 
 type RTSPService struct {
 	config        config.RTSPConfig
-	activeStreams map[uint]*StreamInfo // camera_id -> stream info
+	watchdog      config.WatchdogConfig
+	activeStreams map[uint]*StreamInfo     // camera_id -> stream info
+	baselines     map[uint]*streamBaseline // Learned per camera, kept when its stream stops
 	mu            sync.RWMutex
 	stopMonitor   chan struct{}
+	usage         *UsageTracker
+	events        *EventService
 }
 
 type StreamInfo struct {
@@ -31,16 +36,34 @@ type StreamInfo struct {
 	RestartCount int
 	IsHealthy   bool
 	UseMemoryStream bool // Flag untuk stream langsung tanpa file
+	stderr          *ffmpegErrorWriter
+
+	// Watchdog state of the current FFmpeg run
+	startedAt     time.Time
+	producing     bool      // Wrote a playlist since startedAt
+	lastSegment   int       // Newest segment number seen, -1 before the first
+	lastSegmentAt time.Time // When the playlist listing lastSegment was written
+}
+
+// resetWatch starts watching a new FFmpeg run
+func (si *StreamInfo) resetWatch() {
+	si.startedAt = time.Now()
+	si.producing = false
+	si.lastSegment = -1
 }
 
-func NewRTSPService(cfg config.RTSPConfig) *RTSPService {
+func NewRTSPService(cfg config.RTSPConfig, watchdog config.WatchdogConfig, usage *UsageTracker, events *EventService) *RTSPService {
 	// Note: We don't create output directory anymore since we're using in-memory streaming
 	// The tmpfs mount in docker-compose.yml handles the directory creation
 
 	service := &RTSPService{
 		config:        cfg,
+		watchdog:      watchdog,
 		activeStreams: make(map[uint]*StreamInfo),
+		baselines:     make(map[uint]*streamBaseline),
 		stopMonitor:   make(chan struct{}),
+		usage:         usage,
+		events:        events,
 	}
 
 	// Start monitoring goroutine
@@ -142,31 +165,35 @@ func (s *RTSPService) checkStreamHealth() {
 			continue
 		}
 
-		// Check if playlist file exists and is being updated
+		// Check if playlist file exists and is being updated. A playlist
+		// older than this FFmpeg run is left over from the previous one.
+		baseline := s.baselineLocked(cameraID)
 		playlistPath := streamInfo.OutputPath
-		if fileInfo, err := os.Stat(playlistPath); err == nil {
-			// Check if file was updated in the last 20 seconds (should update every 2 seconds for HLS)
-			// Increased timeout to give FFmpeg more time to connect to RTSP source
+		if fileInfo, err := os.Stat(playlistPath); err == nil && !fileInfo.ModTime().Before(streamInfo.startedAt) {
+			s.learnLocked(cameraID, streamInfo, baseline, fileInfo.ModTime())
+
+			// Thresholds follow the camera's own cadence: a camera writing a
+			// segment every 6s isn't stalled after 10s
 			timeSinceUpdate := time.Since(fileInfo.ModTime())
-			if timeSinceUpdate > 20*time.Second {
-				fmt.Printf("Playlist file for camera %d hasn't been updated in %v, restarting stream...\n", cameraID, timeSinceUpdate)
+			if stallTimeout := baseline.stallTimeout(s.watchdog); timeSinceUpdate > stallTimeout {
+				fmt.Printf("Playlist file for camera %d hasn't been updated in %v (limit %v), restarting stream...\n", cameraID, timeSinceUpdate.Round(time.Second), stallTimeout.Round(time.Second))
 				s.restartStreamUnsafe(cameraID, streamInfo)
 				continue
 			}
 			streamInfo.LastUpdate = fileInfo.ModTime()
 			streamInfo.IsHealthy = true
 		} else {
-			// Playlist file doesn't exist - check if FFmpeg process is still running
-			// If process is running, give it more time (up to 30 seconds) before restarting
+			// No playlist from this run yet - check if FFmpeg process is still running
+			// If process is running, give it as long as this camera usually takes to connect
 			if streamInfo.FFmpegCmd != nil && streamInfo.FFmpegCmd.Process != nil {
 				// Check if process is still alive by checking if we can send signal 0 (doesn't actually send signal)
 				// This is a common way to check if process is alive
 				if err := streamInfo.FFmpegCmd.Process.Signal(os.Signal(syscall.Signal(0))); err == nil {
 					// Process is still running, check how long it's been running
-					timeSinceStart := time.Since(streamInfo.LastUpdate)
-					if timeSinceStart < 30*time.Second {
+					timeSinceStart := time.Since(streamInfo.startedAt)
+					if startupGrace := baseline.startupGrace(s.watchdog); timeSinceStart < startupGrace {
 						// Still within grace period, don't restart yet
-						fmt.Printf("Playlist file for camera %d doesn't exist yet, but FFmpeg is still running (started %v ago), waiting...\n", cameraID, timeSinceStart)
+						fmt.Printf("Playlist file for camera %d doesn't exist yet, but FFmpeg is still running (started %v ago, limit %v), waiting...\n", cameraID, timeSinceStart.Round(time.Second), startupGrace.Round(time.Second))
 						continue
 					}
 				}
@@ -179,6 +206,42 @@ func (s *RTSPService) checkStreamHealth() {
 	}
 }
 
+// baselineLocked returns the camera's learned baseline, creating an empty
+// one. Caller holds mu.
+func (s *RTSPService) baselineLocked(cameraID uint) *streamBaseline {
+	baseline, ok := s.baselines[cameraID]
+	if !ok {
+		baseline = &streamBaseline{}
+		s.baselines[cameraID] = baseline
+	}
+	return baseline
+}
+
+// learnLocked samples the reconnect time from a run's first playlist and
+// the segment cadence from later ones. Caller holds mu.
+func (s *RTSPService) learnLocked(cameraID uint, streamInfo *StreamInfo, baseline *streamBaseline, modTime time.Time) {
+	if !streamInfo.producing {
+		streamInfo.producing = true
+		baseline.reconnect.add(modTime.Sub(streamInfo.startedAt).Seconds())
+	}
+
+	segment := lastSegmentNumber(streamInfo.OutputPath)
+	if segment < 0 {
+		return
+	}
+	if streamInfo.lastSegment >= 0 && segment > streamInfo.lastSegment && modTime.After(streamInfo.lastSegmentAt) {
+		wasLearned := baseline.cadence.learned()
+		baseline.cadence.add(modTime.Sub(streamInfo.lastSegmentAt).Seconds() / float64(segment-streamInfo.lastSegment))
+		if !wasLearned && baseline.cadence.learned() && s.watchdog.Adaptive {
+			fmt.Printf("[Watchdog] Learned camera %d: a segment every %.1fs, restarting after %v without one\n", cameraID, baseline.cadence.mean, baseline.stallTimeout(s.watchdog).Round(time.Second))
+		}
+	}
+	if segment != streamInfo.lastSegment {
+		streamInfo.lastSegment = segment
+		streamInfo.lastSegmentAt = modTime
+	}
+}
+
 // restartStreamUnsafe restarts a stream (must be called with lock held)
 func (s *RTSPService) restartStreamUnsafe(cameraID uint, streamInfo *StreamInfo) {
 	// Stop existing process
@@ -195,6 +258,16 @@ func (s *RTSPService) restartStreamUnsafe(cameraID uint, streamInfo *StreamInfo)
 
 	streamInfo.RestartCount++
 	streamInfo.IsHealthy = false
+	streamInfo.resetWatch()
+
+	// Recording runs alert rules and webhooks, don't hold the stream lock for it
+	go s.events.Record(&models.Event{
+		CameraID:    &cameraID,
+		Type:        "stream_restart",
+		Severity:    "warning",
+		Source:      "rtsp",
+		Description: fmt.Sprintf("Legacy HLS stream restarted (attempt %d of 5)", streamInfo.RestartCount),
+	}, nil)
 
 	// Restart stream in goroutine
 	go s.convertRTSPToHLS(streamInfo.RTSPURL, streamInfo.OutputPath, cameraID, streamInfo)
@@ -234,6 +307,7 @@ func (s *RTSPService) StartStream(cameraID uint, rtspURL string) (string, error)
 		IsHealthy:   false,
 		UseMemoryStream: false, // Using tmpfs (RAM disk) instead of pure in-memory
 	}
+	streamInfo.resetWatch()
 
 	// Start conversion in goroutine
 	go s.convertRTSPToHLS(rtspURL, playlistFile, cameraID, streamInfo)
@@ -246,7 +320,7 @@ func (s *RTSPService) StartStream(cameraID uint, rtspURL string) (string, error)
 
 func (s *RTSPService) convertRTSPToHLS(rtspURL, outputPath string, cameraID uint, streamInfo *StreamInfo) {
 	// Check if ffmpeg is available
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
+	if _, err := exec.LookPath(FFmpegPath()); err != nil {
 		fmt.Printf("Error: ffmpeg not found. RTSP to HLS conversion requires ffmpeg to be installed.\n")
 		fmt.Printf("Install ffmpeg: https://ffmpeg.org/download.html\n")
 		fmt.Printf("For macOS: brew install ffmpeg\n")
@@ -263,7 +337,7 @@ func (s *RTSPService) convertRTSPToHLS(rtspURL, outputPath string, cameraID uint
 	// Segments are stored in tmpfs (RAM disk) - configured in docker-compose.yml
 	// This prevents disk usage: segments are in RAM only, auto-deleted when old
 	// Optimized to reduce flickering and prevent replay of old segments
-	cmd := exec.Command("ffmpeg",
+	cmd := FFmpegCommand(
 		"-rtsp_transport", "tcp",        // Use TCP for better reliability
 		"-i", rtspURL,
 		"-c:v", "libx264",               // Video codec
@@ -287,13 +361,16 @@ func (s *RTSPService) convertRTSPToHLS(rtspURL, outputPath string, cameraID uint
 		outputPath,
 	)
 
-	// Set output to capture errors
+	// Set output to capture errors (stderr is also classified for the health API)
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if streamInfo.stderr == nil {
+		streamInfo.stderr = newFFmpegErrorWriter(cameraID, PipelineHLSLegacy)
+	}
+	cmd.Stderr = streamInfo.stderr
 
 	streamInfo.FFmpegCmd = cmd
 
-	fmt.Printf("Starting RTSP to HLS conversion for camera %d: %s -> %s\n", cameraID, rtspURL, outputPath)
+	fmt.Printf("Starting RTSP to HLS conversion for camera %d: %s -> %s\n", cameraID, StripURLCredentials(rtspURL), outputPath)
 	
 	// Start the command
 	if err := cmd.Start(); err != nil {
@@ -304,11 +381,14 @@ func (s *RTSPService) convertRTSPToHLS(rtspURL, outputPath string, cameraID uint
 		return
 	}
 
+	s.usage.TrackProcess(cameraID, PipelineHLSLegacy, cmd)
+
 	// Mark as starting (not healthy yet - will be marked healthy when playlist file is created)
 	s.mu.Lock()
 	streamInfo.IsHealthy = false
 	streamInfo.RestartCount = 0 // Reset restart count on successful start
 	streamInfo.LastUpdate = time.Now() // Track when FFmpeg started
+	streamInfo.resetWatch()
 	s.mu.Unlock()
 
 	// Wait for command to finish (or error)
@@ -377,3 +457,28 @@ func (s *RTSPService) GetAllStreamHealth() map[uint]bool {
 	
 	return health
 }
+
+// GetWatchdogBaseline returns what the watchdog has learned about a camera
+// and the thresholds it currently restarts the camera's stream at
+func (s *RTSPService) GetWatchdogBaseline(cameraID uint) (WatchdogBaseline, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	baseline, exists := s.baselines[cameraID]
+	if !exists {
+		return WatchdogBaseline{}, false
+	}
+	return baseline.report(s.watchdog), true
+}
+
+// GetStreamError returns the last classified FFmpeg error for a stream
+func (s *RTSPService) GetStreamError(cameraID uint) *StreamError {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	streamInfo, exists := s.activeStreams[cameraID]
+	if !exists {
+		return nil
+	}
+	return streamInfo.stderr.LastError()
+}
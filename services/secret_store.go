@@ -0,0 +1,365 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/utils"
+
+	"gorm.io/gorm"
+)
+
+// Secrets the store serves, by their key in Vault and file name in SECRETS_DIR.
+// "<name>_previous" holds comma-separated older keys still accepted.
+const (
+	SecretDBPassword = "db_password"
+	SecretJWT        = "jwt_secret"
+	SecretCredential = "credential_secret" // Encrypts stored camera credentials and webhook/integration secrets
+	SecretCluster    = "cluster_secret"    // Signs requests cluster nodes forward to each other; the JWT secret when unset
+)
+
+// Secret providers
+const (
+	SecretsEnv   = "env"
+	SecretsVault = "vault"
+	SecretsGCP   = "gcp"
+	SecretsFile  = "file"
+)
+
+// maxRotatedKeys is how many keys replaced while running are still accepted
+const maxRotatedKeys = 3
+
+// dbLease is the lease of dynamic database credentials from Vault
+type dbLease struct {
+	id        string
+	renewable bool
+	renewAt   time.Time
+}
+
+// SecretStore serves the database password, JWT secret, credential key and
+// cluster secret from env vars, Vault, Google Cloud Secret Manager or files, re-reading
+// them every SECRETS_REFRESH_INTERVAL. A rotated JWT secret or credential
+// key becomes the one new tokens and values are signed and encrypted with,
+// while the one it replaced is still accepted. Secrets the provider doesn't
+// have at startup fall back to their env vars, except the placeholder JWT
+// secret; one that disappears later keeps its last value.
+type SecretStore struct {
+	config   config.SecretsConfig
+	defaults map[string]string
+	vault    *vaultClient
+	gcp      *gcpSecretsClient
+	onRotate map[string][]func()
+
+	mu       sync.RWMutex
+	values   map[string]string
+	previous map[string][]string // name -> older keys from <name>_previous
+	rotated  map[string][]string // name -> keys replaced while running, newest first
+	dbUser   string
+	lease    dbLease
+}
+
+// NewSecretStore loads the secrets; an unreachable provider is an error so
+// the backend doesn't start on the env defaults by accident
+func NewSecretStore(cfg *config.Config) (*SecretStore, error) {
+	s := &SecretStore{
+		config: cfg.Secrets,
+		defaults: map[string]string{
+			SecretDBPassword: cfg.Database.Password,
+			SecretJWT:        cfg.JWT.Secret,
+			SecretCredential: cfg.Vault.Secret,
+			SecretCluster:    cfg.Cluster.Secret,
+		},
+		onRotate: make(map[string][]func()),
+		values:   make(map[string]string),
+		previous: make(map[string][]string),
+		rotated:  make(map[string][]string),
+		dbUser:   cfg.Database.User,
+	}
+
+	switch s.config.Provider {
+	case "", SecretsEnv, SecretsFile:
+	case SecretsVault:
+		vault, err := newVaultClient(s.config)
+		if err != nil {
+			return nil, err
+		}
+		s.vault = vault
+	case SecretsGCP:
+		gcp, err := newGCPSecretsClient(s.config)
+		if err != nil {
+			return nil, err
+		}
+		s.gcp = gcp
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q, must be env, vault, gcp or file", s.config.Provider)
+	}
+
+	if err := s.refresh(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start re-reads the secrets every interval, renewing the Vault token and
+// database lease on the way
+func (s *SecretStore) Start() {
+	if s.config.Provider == "" || s.config.Provider == SecretsEnv || s.config.RefreshInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.refresh(time.Now()); err != nil {
+				fmt.Printf("[Secrets] Refresh failed, keeping the current secrets: %v\n", err)
+			}
+		}
+	}()
+}
+
+// OnRotate registers fn to run after a secret changes
+func (s *SecretStore) OnRotate(name string, fn func()) {
+	s.onRotate[name] = append(s.onRotate[name], fn)
+}
+
+// Get returns the current value of a secret
+func (s *SecretStore) Get(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[name]
+}
+
+// Keys returns the current value of a secret followed by the older ones
+// still accepted
+func (s *SecretStore) Keys(name string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := []string{s.values[name]}
+	keys = append(keys, s.rotated[name]...)
+	return append(keys, s.previous[name]...)
+}
+
+// DatabaseCredentials returns the user and password for a new database
+// connection; config.DatabaseConfig.Credentials
+func (s *SecretStore) DatabaseCredentials() (string, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dbUser, s.values[SecretDBPassword]
+}
+
+func (s *SecretStore) refresh(now time.Time) error {
+	fetched, err := s.fetch(now)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	values := make(map[string]string, len(s.values))
+	for _, name := range []string{SecretDBPassword, SecretJWT, SecretCredential, SecretCluster} {
+		value := fetched[name]
+		if value == "" {
+			// Gone from the provider: keep the last good value, the env
+			// default only stands in until the provider has one
+			if old, loaded := s.values[name]; loaded {
+				value = old
+			} else {
+				value = s.defaults[name]
+			}
+		}
+		if name != SecretDBPassword && value == config.PlaceholderJWTSecret && s.config.Provider != "" && s.config.Provider != SecretsEnv {
+			s.mu.RUnlock()
+			return fmt.Errorf("%s is missing from the %s provider and its env var is the placeholder", name, s.config.Provider)
+		}
+		values[name] = value
+	}
+	s.mu.RUnlock()
+
+	var changed []string
+	s.mu.Lock()
+	for _, name := range []string{SecretDBPassword, SecretJWT, SecretCredential, SecretCluster} {
+		value := values[name]
+		if old, loaded := s.values[name]; loaded && old != value {
+			rotated := append([]string{old}, s.rotated[name]...)
+			if len(rotated) > maxRotatedKeys {
+				rotated = rotated[:maxRotatedKeys]
+			}
+			s.rotated[name] = rotated
+			changed = append(changed, name)
+		}
+		s.values[name] = value
+		s.previous[name] = splitSecretList(fetched[name+"_previous"])
+	}
+	if user := fetched["db_user"]; user != "" {
+		s.dbUser = user
+	}
+	s.mu.Unlock()
+
+	for _, name := range changed {
+		fmt.Printf("[Secrets] %s was rotated\n", name)
+		for _, fn := range s.onRotate[name] {
+			fn()
+		}
+	}
+	return nil
+}
+
+// fetch reads the secrets from the provider; db_user is set when Vault
+// hands out dynamic database credentials
+func (s *SecretStore) fetch(now time.Time) (map[string]string, error) {
+	switch s.config.Provider {
+	case SecretsVault:
+		return s.fetchVault(now)
+	case SecretsGCP:
+		return s.gcp.readSecrets(now, []string{SecretDBPassword, SecretJWT, SecretCredential, SecretCluster, SecretJWT + "_previous", SecretCredential + "_previous", SecretCluster + "_previous"})
+	case SecretsFile:
+		return s.fetchFiles()
+	default:
+		return map[string]string{}, nil
+	}
+}
+
+func (s *SecretStore) fetchVault(now time.Time) (map[string]string, error) {
+	if err := s.vault.ensureToken(now); err != nil {
+		return nil, err
+	}
+	values, err := s.vault.readKV(s.config.VaultPath)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.VaultDBCredsPath == "" {
+		return values, nil
+	}
+
+	user, password, err := s.databaseLease(now)
+	if err != nil {
+		return nil, err
+	}
+	if user != "" {
+		values["db_user"] = user
+		values[SecretDBPassword] = password
+	} else {
+		// Lease still good, keep the credentials it came with
+		s.mu.RLock()
+		values["db_user"] = s.dbUser
+		values[SecretDBPassword] = s.values[SecretDBPassword]
+		s.mu.RUnlock()
+	}
+	return values, nil
+}
+
+// databaseLease renews the lease of the dynamic database credentials once
+// half of it is used, and gets new credentials when it can't be renewed for
+// at least two more refreshes. Returns empty credentials while the current
+// ones are kept.
+func (s *SecretStore) databaseLease(now time.Time) (string, string, error) {
+	if s.lease.id != "" && now.Before(s.lease.renewAt) {
+		return "", "", nil
+	}
+	if s.lease.id != "" && s.lease.renewable {
+		duration, err := s.vault.renewLease(s.lease.id, 2*s.config.RefreshInterval)
+		if err == nil && duration >= 2*s.config.RefreshInterval {
+			s.lease.renewAt = now.Add(duration / 2)
+			return "", "", nil
+		}
+		if err != nil {
+			fmt.Printf("[Secrets] Database lease renewal failed, getting new credentials: %v\n", err)
+		}
+	}
+
+	resp, err := s.vault.read(s.config.VaultDBCredsPath)
+	if err != nil {
+		return "", "", fmt.Errorf("database credentials: %w", err)
+	}
+	user, _ := resp.Data["username"].(string)
+	password, _ := resp.Data["password"].(string)
+	if user == "" || password == "" {
+		return "", "", fmt.Errorf("database credentials at %s have no username/password", s.config.VaultDBCredsPath)
+	}
+	s.lease = dbLease{
+		id:        resp.LeaseID,
+		renewable: resp.Renewable,
+		renewAt:   now.Add(time.Duration(resp.LeaseDuration) * time.Second / 2),
+	}
+	fmt.Printf("[Secrets] Got database credentials for %s, lease %ds\n", user, resp.LeaseDuration)
+	return user, password, nil
+}
+
+func (s *SecretStore) fetchFiles() (map[string]string, error) {
+	values := make(map[string]string)
+	for _, name := range []string{SecretDBPassword, SecretJWT, SecretCredential, SecretCluster, SecretJWT + "_previous", SecretCredential + "_previous", SecretCluster + "_previous"} {
+		data, err := os.ReadFile(filepath.Join(s.config.Dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[name] = strings.TrimSpace(string(data))
+	}
+	return values, nil
+}
+
+func splitSecretList(list string) []string {
+	var keys []string
+	for _, key := range strings.Split(list, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ReencryptSecrets rewrites every stored camera credential and webhook and
+// integration secret with the current credential key, so the keys it
+// replaced can be retired. Values no key can decrypt are left as they are.
+func ReencryptSecrets(db *gorm.DB, secrets *SecretStore) {
+	keys := secrets.Keys(SecretCredential)
+	for _, target := range []struct {
+		model  interface{}
+		table  string
+		column string
+	}{
+		{&models.Credential{}, "credentials", "password_encrypted"},
+		{&models.Webhook{}, "webhooks", "secret_encrypted"},
+		{&models.Integration{}, "integrations", "secret_encrypted"},
+	} {
+		var rows []struct {
+			ID    uint
+			Value string
+		}
+		if err := db.Unscoped().Model(target.model).Select("id", target.column+" AS value").Scan(&rows).Error; err != nil {
+			fmt.Printf("[Secrets] Failed to load %s to re-encrypt: %v\n", target.table, err)
+			continue
+		}
+		reencrypted := 0
+		for _, row := range rows {
+			if _, err := utils.DecryptSecret(keys[0], row.Value); err == nil {
+				continue
+			}
+			plaintext, err := utils.DecryptSecretAny(keys[1:], row.Value)
+			if err != nil {
+				fmt.Printf("[Secrets] Cannot decrypt %s %d with any key, leaving it\n", target.table, row.ID)
+				continue
+			}
+			ciphertext, err := utils.EncryptSecret(keys[0], plaintext)
+			if err != nil {
+				continue
+			}
+			if err := db.Unscoped().Model(target.model).Where("id = ?", row.ID).Update(target.column, ciphertext).Error; err != nil {
+				fmt.Printf("[Secrets] Failed to re-encrypt %s %d: %v\n", target.table, row.ID, err)
+				continue
+			}
+			reencrypted++
+		}
+		if reencrypted > 0 {
+			fmt.Printf("[Secrets] Re-encrypted %d %s with the new credential key\n", reencrypted, target.table)
+		}
+	}
+}
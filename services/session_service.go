@@ -0,0 +1,343 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAccessTokenExpiry = 15 * time.Minute
+	sessionCheckTTL          = 30 * time.Second // How long a session known to be active skips the database
+	revocationPollInterval   = 2 * time.Second  // How often sessions revoked through other instances are looked up
+)
+
+// ErrInvalidRefreshToken is returned for unknown, expired and revoked
+// refresh tokens
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// TokenPair is what a login or refresh hands the client
+type TokenPair struct {
+	Token            string    `json:"token"` // Access token (JWT)
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// SessionService issues short-lived access tokens backed by server-side
+// sessions. Refresh tokens are rotated on every use; presenting a replaced
+// one means it was copied, so the session is revoked.
+type SessionService struct {
+	db            *gorm.DB
+	secrets       *SecretStore
+	accessExpiry  time.Duration
+	refreshExpiry time.Duration
+
+	checked map[uint]time.Time // session_id -> when it was last found active
+	seen    map[uint]time.Time // session_id -> last request with one of its access tokens
+	mu      sync.Mutex
+}
+
+func NewSessionService(cfg config.JWTConfig, secrets *SecretStore, db *gorm.DB) *SessionService {
+	accessExpiry, err := time.ParseDuration(cfg.Expiry)
+	if err != nil || accessExpiry <= 0 {
+		fmt.Printf("[Sessions] Invalid JWT_EXPIRY %q, using %s\n", cfg.Expiry, defaultAccessTokenExpiry)
+		accessExpiry = defaultAccessTokenExpiry
+	}
+	return &SessionService{
+		db:            db,
+		secrets:       secrets,
+		accessExpiry:  accessExpiry,
+		refreshExpiry: cfg.RefreshExpiry,
+		checked:       make(map[uint]time.Time),
+		seen:          make(map[uint]time.Time),
+	}
+}
+
+// Start prunes sessions that expired or were revoked over a day ago,
+// hourly
+func (s *SessionService) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			cutoff := time.Now().Add(-24 * time.Hour)
+			if err := s.db.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.Session{}).Error; err != nil {
+				fmt.Printf("[Sessions] Failed to prune sessions: %v\n", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// StartCachePrune drops this instance's activity older than a day and
+// expired session checks, hourly. Unlike Start it runs on every instance.
+func (s *SessionService) StartCachePrune() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			now := time.Now()
+			s.mu.Lock()
+			for sessionID, seenAt := range s.seen {
+				if now.Sub(seenAt) > 24*time.Hour {
+					delete(s.seen, sessionID)
+				}
+			}
+			for sessionID, checkedAt := range s.checked {
+				if now.Sub(checkedAt) >= sessionCheckTTL {
+					delete(s.checked, sessionID)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// WatchRevocations drops sessions revoked through other instances from the
+// active cache within revocationPollInterval rather than sessionCheckTTL,
+// so logging out or an admin revoking a session cuts its access tokens off
+// on every instance, not just the one that handled it. Both revoked_at and
+// the poll times are the database's clock, so skew between instances
+// doesn't hide revocations.
+func (s *SessionService) WatchRevocations() {
+	go func() {
+		ticker := time.NewTicker(revocationPollInterval)
+		defer ticker.Stop()
+
+		var since time.Time
+		for range ticker.C {
+			var polledAt time.Time
+			if err := s.db.Raw("SELECT NOW()").Scan(&polledAt).Error; err != nil {
+				fmt.Printf("[Sessions] Failed to look up revoked sessions: %v\n", err)
+				continue
+			}
+			if since.IsZero() {
+				since = polledAt
+				continue
+			}
+			var ids []uint
+			// Overlaps the previous poll, for revocations committed after it
+			// read the clock
+			if err := s.db.Model(&models.Session{}).Where("revoked_at >= ?", since.Add(-revocationPollInterval)).
+				Pluck("id", &ids).Error; err != nil {
+				fmt.Printf("[Sessions] Failed to look up revoked sessions: %v\n", err)
+				continue
+			}
+			for _, id := range ids {
+				s.forget(id)
+			}
+			since = polledAt
+		}
+	}()
+}
+
+// Create starts a session for a user who just logged in
+func (s *SessionService) Create(user *models.User, userAgent, clientIP string) (*TokenPair, error) {
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: refreshHash,
+		UserAgent:        userAgent,
+		ClientIP:         clientIP,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(s.refreshExpiry),
+	}
+	if err := s.db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return s.issue(user, &session, refreshToken)
+}
+
+// Refresh trades a refresh token in for a new access token and refresh
+// token, returning the user with their current role
+func (s *SessionService) Refresh(refreshToken, userAgent, clientIP string) (*TokenPair, *models.User, error) {
+	hash := hashRefreshToken(refreshToken)
+
+	var session models.Session
+	err := s.db.Where("refresh_token_hash = ?", hash).First(&session).Error
+	if err == gorm.ErrRecordNotFound {
+		// A replaced token coming back means two parties hold the session
+		var reused models.Session
+		if s.db.Where("previous_token_hash = ?", hash).First(&reused).Error == nil && reused.RevokedAt == nil {
+			fmt.Printf("[Sessions] Replaced refresh token of session %d reused, revoking it\n", reused.ID)
+			s.Revoke(reused.ID)
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !session.Active() {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	var user models.User
+	if err := s.db.First(&user, session.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			s.Revoke(session.ID)
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, err
+	}
+
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Conditional on the old hash so two concurrent refreshes can't both win
+	result := s.db.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ?", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  newHash,
+			"previous_token_hash": hash,
+			"user_agent":          userAgent,
+			"client_ip":           clientIP,
+			"last_used_at":        time.Now(),
+		})
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := s.issue(&user, &session, newToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, &user, nil
+}
+
+// Active reports whether a session exists and is neither expired nor
+// revoked; the auth middleware calls it for every request
+func (s *SessionService) Active(sessionID uint) bool {
+	s.mu.Lock()
+	checkedAt, ok := s.checked[sessionID]
+	s.seen[sessionID] = time.Now()
+	s.mu.Unlock()
+	if ok && time.Since(checkedAt) < sessionCheckTTL {
+		return true
+	}
+
+	var session models.Session
+	if err := s.db.Select("id", "expires_at", "revoked_at").First(&session, sessionID).Error; err != nil || !session.Active() {
+		s.forget(sessionID)
+		return false
+	}
+
+	s.mu.Lock()
+	s.checked[sessionID] = time.Now()
+	s.mu.Unlock()
+	return true
+}
+
+// UserActive reports whether a user still exists and has a session that is
+// neither expired nor revoked; pre-signed download links check it, as they
+// carry no session of their own
+func (s *SessionService) UserActive(userID uint) bool {
+	var count int64
+	if err := s.db.Model(&models.Session{}).
+		Joins("JOIN users ON users.id = sessions.user_id AND users.deleted_at IS NULL").
+		Where("sessions.user_id = ? AND sessions.revoked_at IS NULL AND sessions.expires_at > ?", userID, time.Now()).
+		Count(&count).Error; err != nil {
+		fmt.Printf("[Sessions] Failed to check sessions of user %d: %v\n", userID, err)
+		return false
+	}
+	return count > 0
+}
+
+// Revoke ends a session; its refresh token and access tokens stop working
+// immediately
+func (s *SessionService) Revoke(sessionID uint) error {
+	s.forget(sessionID)
+	return s.db.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", gorm.Expr("NOW()")).Error
+}
+
+// RevokeUser ends all sessions of a user, returning how many were active
+func (s *SessionService) RevokeUser(userID uint) (int64, error) {
+	var ids []uint
+	if err := s.db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		s.forget(id)
+	}
+	result := s.db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", gorm.Expr("NOW()"))
+	return result.RowsAffected, result.Error
+}
+
+// LastSeen returns when a session last made a request since this process
+// started
+func (s *SessionService) LastSeen(sessionID uint) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seenAt, ok := s.seen[sessionID]
+	return seenAt, ok
+}
+
+func (s *SessionService) forget(sessionID uint) {
+	s.mu.Lock()
+	delete(s.checked, sessionID)
+	delete(s.seen, sessionID)
+	s.mu.Unlock()
+}
+
+// issue signs an access token for the session
+func (s *SessionService) issue(user *models.User, session *models.Session, refreshToken string) (*TokenPair, error) {
+	expiresAt := time.Now().Add(s.accessExpiry)
+	if expiresAt.After(session.ExpiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": user.ID,
+		"email":   user.Email,
+		"role":    user.Role,
+		"sid":     session.ID,
+		"exp":     expiresAt.Unix(),
+	})
+	signed, err := token.SignedString([]byte(s.secrets.Get(SecretJWT)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		Token:            signed,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// newRefreshToken returns a random refresh token and its hash
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+)
+
+// PipelineSnapshotBurst is the FFmpeg capturing a series of snapshots
+const PipelineSnapshotBurst = "snapshot_burst"
+
+// jpegEnd is the end-of-image marker closing each frame of FFmpeg's MJPEG
+// output
+var jpegEnd = []byte{0xFF, 0xD9}
+
+// Burst captures count frames of a camera, interval apart, with one FFmpeg
+// through the shared ingest. Frames are timed as they come out of FFmpeg.
+// When the capture fails midway the frames captured so far are returned
+// along with the error. The last frame also refreshes the cached snapshot.
+// Bursts wait for one of their own SNAPSHOT_MAX_BURSTS slots; FFmpeg stops
+// when ctx is done.
+func (s *SnapshotService) Burst(ctx context.Context, camera *models.Camera, count int, interval time.Duration) ([]Snapshot, error) {
+	select {
+	case s.bursts <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.bursts }()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(count)*interval+snapshotCaptureTimeout)
+	defer cancel()
+
+	stderr := newFFmpegErrorWriter(camera.ID, PipelineSnapshotBurst)
+	cmd := FFmpegCommandContext(ctx,
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", s.ingest.URL(camera),
+		"-vf", fmt.Sprintf("fps=%g,scale=%d:-2", 1/interval.Seconds(), s.config.Width),
+		"-frames:v", fmt.Sprint(count),
+		"-q:v", "4",
+		"-f", "image2pipe",
+		"-c:v", "mjpeg",
+		"-",
+	)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	frames := make([]Snapshot, 0, count)
+	var pending []byte
+	buf := make([]byte, 64*1024)
+	for len(frames) < count {
+		n, readErr := stdout.Read(buf)
+		pending = append(pending, buf[:n]...)
+		for {
+			end := bytes.Index(pending, jpegEnd)
+			if end < 0 {
+				break
+			}
+			frame := make([]byte, end+len(jpegEnd))
+			copy(frame, pending)
+			frames = append(frames, Snapshot{JPEG: frame, CapturedAt: time.Now()})
+			pending = pending[end+len(jpegEnd):]
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	io.Copy(io.Discard, stdout)
+	waitErr := cmd.Wait()
+
+	if len(frames) > 0 {
+		last := frames[len(frames)-1]
+		s.mu.Lock()
+		s.cache[camera.ID] = &last
+		s.lastUsed[camera.ID] = time.Now()
+		s.mu.Unlock()
+	}
+	if len(frames) < count {
+		if streamErr := stderr.LastError(); streamErr != nil {
+			return frames, streamErr
+		}
+		if ctx.Err() != nil {
+			return frames, newStreamError(ReasonTimeout, "ffmpeg", "frames stopped arriving")
+		}
+		if waitErr != nil {
+			return frames, fmt.Errorf("failed to capture snapshots: %v", waitErr)
+		}
+		return frames, fmt.Errorf("failed to capture snapshots: got %d of %d frames", len(frames), count)
+	}
+	return frames, nil
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+)
+
+// PipelineSnapshot is the FFmpeg capturing a thumbnail snapshot
+const PipelineSnapshot = "snapshot"
+
+const (
+	snapshotCaptureTimeout = 10 * time.Second
+	snapshotKeep           = 10 * time.Minute // Unrequested snapshots are dropped after this
+)
+
+// Snapshot is a JPEG frame of a camera
+type Snapshot struct {
+	JPEG       []byte
+	CapturedAt time.Time
+}
+
+// snapshotCapture is a capture in progress that concurrent requests for the
+// same camera wait on
+type snapshotCapture struct {
+	done     chan struct{}
+	snapshot *Snapshot
+	err      error
+}
+
+// SnapshotService captures single JPEG frames of cameras for thumbnails
+// (map, camera list) and caches them, so a page of thumbnails costs one
+// short FFmpeg per camera at most every SNAPSHOT_MAX_AGE.
+type SnapshotService struct {
+	config   config.SnapshotConfig
+	ingest   *IngestService
+	cache    map[uint]*Snapshot        // camera_id -> last snapshot
+	inflight map[uint]*snapshotCapture // camera_id -> capture in progress
+	lastUsed map[uint]time.Time        // camera_id -> last request
+	slots    chan struct{}
+	bursts   chan struct{} // Bursts run up to a minute, so they don't take slots
+	mu       sync.Mutex
+}
+
+func NewSnapshotService(cfg config.SnapshotConfig, ingest *IngestService) *SnapshotService {
+	concurrent := cfg.MaxConcurrent
+	if concurrent <= 0 {
+		concurrent = 1
+	}
+	bursts := cfg.MaxBursts
+	if bursts <= 0 {
+		bursts = 1
+	}
+	return &SnapshotService{
+		config:   cfg,
+		ingest:   ingest,
+		cache:    make(map[uint]*Snapshot),
+		inflight: make(map[uint]*snapshotCapture),
+		lastUsed: make(map[uint]time.Time),
+		slots:    make(chan struct{}, concurrent),
+		bursts:   make(chan struct{}, bursts),
+	}
+}
+
+// Start drops the snapshots of cameras nobody asked for in a while
+func (s *SnapshotService) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.mu.Lock()
+			for cameraID, usedAt := range s.lastUsed {
+				if time.Since(usedAt) > snapshotKeep {
+					delete(s.cache, cameraID)
+					delete(s.lastUsed, cameraID)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// MaxAge is how old a cached snapshot may be unless the caller asks otherwise
+func (s *SnapshotService) MaxAge() time.Duration {
+	return s.config.MaxAge
+}
+
+// Get returns a snapshot of the camera at most maxAge old, capturing a new
+// one when needed. When the capture fails the last snapshot, if any, is
+// returned along with the error.
+func (s *SnapshotService) Get(camera *models.Camera, maxAge time.Duration) (*Snapshot, error) {
+	s.mu.Lock()
+	s.lastUsed[camera.ID] = time.Now()
+	cached := s.cache[camera.ID]
+	if cached != nil && time.Since(cached.CapturedAt) <= maxAge {
+		s.mu.Unlock()
+		return cached, nil
+	}
+	capture, running := s.inflight[camera.ID]
+	if !running {
+		capture = &snapshotCapture{done: make(chan struct{})}
+		s.inflight[camera.ID] = capture
+	}
+	s.mu.Unlock()
+
+	if running {
+		<-capture.done
+	} else {
+		s.capture(camera, capture)
+	}
+	if capture.err != nil {
+		return cached, capture.err
+	}
+	return capture.snapshot, nil
+}
+
+// capture grabs a frame, waiting for a free slot first, and publishes the
+// result to everyone waiting on it
+func (s *SnapshotService) capture(camera *models.Camera, capture *snapshotCapture) {
+	s.slots <- struct{}{}
+	frame, err := captureJPEG(context.Background(), camera.ID, PipelineSnapshot, s.ingest.URL(camera), s.config.Width)
+	<-s.slots
+
+	s.mu.Lock()
+	if err != nil {
+		capture.err = err
+	} else {
+		capture.snapshot = &Snapshot{JPEG: frame, CapturedAt: time.Now()}
+		s.cache[camera.ID] = capture.snapshot
+	}
+	delete(s.inflight, camera.ID)
+	s.mu.Unlock()
+	close(capture.done)
+
+	if err != nil {
+		fmt.Printf("[Snapshot] Failed to capture camera %d: %v\n", camera.ID, err)
+	}
+}
+
+// captureJPEG grabs one frame scaled to width as a JPEG; cancelling ctx
+// stops FFmpeg
+func captureJPEG(ctx context.Context, cameraID uint, pipeline, rtspURL string, width int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, snapshotCaptureTimeout)
+	defer cancel()
+
+	stderr := newFFmpegErrorWriter(cameraID, pipeline)
+	cmd := FFmpegCommandContext(ctx,
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", rtspURL,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", width),
+		"-q:v", "4",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"-",
+	)
+	cmd.Stderr = stderr
+
+	frame, err := cmd.Output()
+	if err != nil {
+		if streamErr := stderr.LastError(); streamErr != nil {
+			return nil, streamErr
+		}
+		if ctx.Err() != nil {
+			return nil, newStreamError(ReasonTimeout, "ffmpeg", "no frame received in time")
+		}
+		return nil, fmt.Errorf("failed to capture snapshot: %v", err)
+	}
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("failed to capture snapshot: empty frame")
+	}
+	return frame, nil
+}
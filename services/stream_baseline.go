@@ -0,0 +1,125 @@
+package services
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+const (
+	baselineAlpha      = 0.2 // Weight of a new sample in the moving averages
+	baselineMinSamples = 5   // Samples needed before a learned threshold replaces the default
+	stallSegments      = 3   // Segment intervals without a new segment before a stream counts as stalled
+	startupFactor      = 2   // Times the usual reconnect time a new FFmpeg gets to write its first segment
+	baselineDeviations = 4   // Mean deviations added to either threshold as a margin for jitter
+)
+
+// movingStat is an exponential moving average with its mean absolute
+// deviation
+type movingStat struct {
+	mean    float64
+	dev     float64
+	samples int
+}
+
+func (m *movingStat) add(value float64) {
+	if m.samples == 0 {
+		m.mean = value
+	} else {
+		diff := value - m.mean
+		m.mean += baselineAlpha * diff
+		m.dev += baselineAlpha * (math.Abs(diff) - m.dev)
+	}
+	m.samples++
+}
+
+func (m *movingStat) learned() bool {
+	return m.samples >= baselineMinSamples
+}
+
+// streamBaseline is what a stream watchdog has learned about one camera:
+// how often new data arrives (MediaMTX bytes received, legacy HLS segments)
+// and how long a fresh source takes to deliver it. Kept across stream
+// restarts.
+type streamBaseline struct {
+	cadence   movingStat // Seconds between new data
+	reconnect movingStat // Seconds from requesting the source to its first data
+}
+
+// WatchdogBaseline reports a camera's learned cadence and the thresholds
+// a stream watchdog restarts it at
+type WatchdogBaseline struct {
+	SegmentCadence   float64 `json:"segment_cadence_seconds"`
+	CadenceSamples   int     `json:"cadence_samples"`
+	ReconnectTime    float64 `json:"reconnect_seconds"`
+	ReconnectSamples int     `json:"reconnect_samples"`
+	StallTimeout     float64 `json:"stall_timeout_seconds"`
+	StartupGrace     float64 `json:"startup_grace_seconds"`
+	Learned          bool    `json:"learned"` // False while the configured defaults still apply
+}
+
+// stallTimeout is how old the playlist may get before the stream is
+// restarted; the configured default until the cadence is learned
+func (b *streamBaseline) stallTimeout(cfg config.WatchdogConfig) time.Duration {
+	if !cfg.Adaptive || !b.cadence.learned() {
+		return cfg.StallTimeout
+	}
+	return clampWatchdog(cfg, stallSegments*b.cadence.mean+baselineDeviations*b.cadence.dev)
+}
+
+// startupGrace is how long a new FFmpeg may take to write its first
+// segment; the configured default until the reconnect time is learned
+func (b *streamBaseline) startupGrace(cfg config.WatchdogConfig) time.Duration {
+	if !cfg.Adaptive || !b.reconnect.learned() {
+		return cfg.StartupGrace
+	}
+	return clampWatchdog(cfg, startupFactor*b.reconnect.mean+baselineDeviations*b.reconnect.dev)
+}
+
+func (b *streamBaseline) report(cfg config.WatchdogConfig) WatchdogBaseline {
+	return WatchdogBaseline{
+		SegmentCadence:   b.cadence.mean,
+		CadenceSamples:   b.cadence.samples,
+		ReconnectTime:    b.reconnect.mean,
+		ReconnectSamples: b.reconnect.samples,
+		StallTimeout:     b.stallTimeout(cfg).Seconds(),
+		StartupGrace:     b.startupGrace(cfg).Seconds(),
+		Learned:          cfg.Adaptive && b.cadence.learned(),
+	}
+}
+
+func clampWatchdog(cfg config.WatchdogConfig, seconds float64) time.Duration {
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout < cfg.MinTimeout {
+		return cfg.MinTimeout
+	}
+	if cfg.MaxTimeout > 0 && timeout > cfg.MaxTimeout {
+		return cfg.MaxTimeout
+	}
+	return timeout
+}
+
+// lastSegmentNumber reads the number of the newest segment_NNN.ts in a
+// playlist, -1 when it has none
+func lastSegmentNumber(playlistPath string) int {
+	data, err := os.ReadFile(playlistPath)
+	if err != nil {
+		return -1
+	}
+	last := -1
+	for _, line := range strings.Split(string(data), "\n") {
+		name := filepath.Base(strings.TrimSpace(line))
+		if !strings.HasPrefix(name, "segment_") || !strings.HasSuffix(name, ".ts") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "segment_"), ".ts")); err == nil && n > last {
+			last = n
+		}
+	}
+	return last
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// StreamErrorReason is a machine-readable category of stream failure
+type StreamErrorReason string
+
+const (
+	ReasonAuthFailed          StreamErrorReason = "auth_failed"
+	ReasonTimeout             StreamErrorReason = "timeout"
+	ReasonCodecUnsupported    StreamErrorReason = "codec_unsupported"
+	ReasonDNS                 StreamErrorReason = "dns"
+	ReasonConnectionRefused   StreamErrorReason = "connection_refused"
+	ReasonNetworkUnreachable  StreamErrorReason = "network_unreachable"
+	ReasonStreamNotFound      StreamErrorReason = "stream_not_found"
+	ReasonMediaMTXUnavailable StreamErrorReason = "mediamtx_unavailable"
+	ReasonNotStarted          StreamErrorReason = "not_started"
+	ReasonUnknown             StreamErrorReason = "unknown"
+)
+
+// StreamError is a classified stream failure with the raw message it came from
+type StreamError struct {
+	Reason     StreamErrorReason `json:"reason"`
+	Message    string            `json:"message"`
+	Source     string            `json:"source"` // ffmpeg, mediamtx, probe
+	DetectedAt time.Time         `json:"detected_at"`
+}
+
+func (e *StreamError) Error() string {
+	return string(e.Reason) + ": " + e.Message
+}
+
+func newStreamError(reason StreamErrorReason, source, message string) *StreamError {
+	return &StreamError{
+		Reason:     reason,
+		Message:    message,
+		Source:     source,
+		DetectedAt: time.Now(),
+	}
+}
+
+// streamErrorPatterns maps substrings of FFmpeg/MediaMTX/RTSP error output
+// to a reason. Matched case-insensitively, first match wins.
+var streamErrorPatterns = []struct {
+	pattern string
+	reason  StreamErrorReason
+}{
+	{"401 unauthorized", ReasonAuthFailed},
+	{"authentication failed", ReasonAuthFailed},
+	{"403 forbidden", ReasonAuthFailed},
+	{"404 not found", ReasonStreamNotFound},
+	{"454 session not found", ReasonStreamNotFound},
+	{"name or service not known", ReasonDNS},
+	{"temporary failure in name resolution", ReasonDNS},
+	{"failed to resolve hostname", ReasonDNS},
+	{"no such host", ReasonDNS},
+	{"connection refused", ReasonConnectionRefused},
+	{"no route to host", ReasonNetworkUnreachable},
+	{"network is unreachable", ReasonNetworkUnreachable},
+	{"connection timed out", ReasonTimeout},
+	{"operation timed out", ReasonTimeout},
+	{"i/o timeout", ReasonTimeout},
+	{"deadline exceeded", ReasonTimeout},
+	{"unsupported codec", ReasonCodecUnsupported},
+	{"codec not currently supported", ReasonCodecUnsupported},
+	{"decoder not found", ReasonCodecUnsupported},
+	{"could not find codec parameters", ReasonCodecUnsupported},
+}
+
+// ClassifyStreamError returns the reason for an error message, or "" when
+// the message doesn't look like a known failure
+func ClassifyStreamError(message string) StreamErrorReason {
+	lower := strings.ToLower(message)
+	for _, p := range streamErrorPatterns {
+		if strings.Contains(lower, p.pattern) {
+			return p.reason
+		}
+	}
+	return ""
+}
+
+// classifyNetError classifies errors returned by net.Dial and friends
+func classifyNetError(err error) StreamErrorReason {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ReasonDNS
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ReasonConnectionRefused
+	}
+	if errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) {
+		return ReasonNetworkUnreachable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ReasonTimeout
+	}
+	if reason := ClassifyStreamError(err.Error()); reason != "" {
+		return reason
+	}
+	return ReasonUnknown
+}
+
+// ffmpegErrorWriter is used as FFmpeg's stderr. It keeps the output in the
+// camera's stream logs (see CameraStreamLogs) and remembers the last line
+// that matched a known failure.
+type ffmpegErrorWriter struct {
+	cameraID uint
+	pipeline string
+	mu       sync.Mutex
+	partial  []byte
+	lastErr  *StreamError
+}
+
+func newFFmpegErrorWriter(cameraID uint, pipeline string) *ffmpegErrorWriter {
+	return &ffmpegErrorWriter{cameraID: cameraID, pipeline: pipeline}
+}
+
+func (w *ffmpegErrorWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		idx := bytes.IndexAny(w.partial, "\r\n")
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(w.partial[:idx]))
+		w.partial = w.partial[idx+1:]
+		if line == "" || isFFmpegProgress(line) {
+			continue
+		}
+		reason := ClassifyStreamError(line)
+		if reason != "" {
+			w.lastErr = newStreamError(reason, "ffmpeg", line)
+		}
+		appendStreamLog(w.cameraID, w.pipeline, line, reason)
+	}
+	// Guard against unbounded growth if FFmpeg never writes a newline
+	if len(w.partial) > 4096 {
+		w.partial = w.partial[:0]
+	}
+	return len(p), nil
+}
+
+// LastError returns the most recent classified FFmpeg error, if any
+func (w *ffmpegErrorWriter) LastError() *StreamError {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastErr
+}
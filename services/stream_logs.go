@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStreamLogLines = 200
+	maxStreamLogLine      = 500 // Longer stderr lines are truncated
+)
+
+// urlCredentials matches the user:password part of URLs FFmpeg echoes
+var urlCredentials = regexp.MustCompile(`(?i)([a-z][a-z0-9+.-]*://)[^/@\s]+@`)
+
+// StreamLogLine is one line an FFmpeg wrote to stderr
+type StreamLogLine struct {
+	At       time.Time         `json:"at"`
+	Pipeline string            `json:"pipeline"`
+	Level    string            `json:"level"`            // "error" for lines matching a known failure, otherwise "info"
+	Reason   StreamErrorReason `json:"reason,omitempty"` // Classification of error lines
+	Line     string            `json:"line"`
+}
+
+type streamLogKey struct {
+	cameraID uint
+	pipeline string
+}
+
+// streamLogRing keeps the last lines of one camera's pipeline
+type streamLogRing struct {
+	lines []StreamLogLine
+	next  int
+	full  bool
+}
+
+func (r *streamLogRing) add(line StreamLogLine) {
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// ordered returns the lines oldest first
+func (r *streamLogRing) ordered() []StreamLogLine {
+	if !r.full {
+		return append([]StreamLogLine(nil), r.lines[:r.next]...)
+	}
+	return append(append([]StreamLogLine(nil), r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// streamLogs holds the FFmpeg stderr of every camera's pipelines in bounded
+// ring buffers, so output can be attributed to the stream that wrote it.
+// Logs outlive the FFmpeg that wrote them, to see why a stream died.
+var streamLogs = struct {
+	size  int
+	rings map[streamLogKey]*streamLogRing
+	mu    sync.Mutex
+}{size: defaultStreamLogLines, rings: make(map[streamLogKey]*streamLogRing)}
+
+// configureStreamLogs sets how many lines are kept per camera and pipeline
+func configureStreamLogs(lines int) {
+	if lines <= 0 {
+		lines = defaultStreamLogLines
+	}
+	streamLogs.mu.Lock()
+	defer streamLogs.mu.Unlock()
+	streamLogs.size = lines
+	streamLogs.rings = make(map[streamLogKey]*streamLogRing)
+}
+
+// appendStreamLog records a stderr line of a camera's pipeline
+func appendStreamLog(cameraID uint, pipeline, line string, reason StreamErrorReason) {
+	line = urlCredentials.ReplaceAllString(line, "${1}***@")
+	if len(line) > maxStreamLogLine {
+		line = line[:maxStreamLogLine] + "..."
+	}
+	entry := StreamLogLine{At: time.Now(), Pipeline: pipeline, Level: "info", Reason: reason, Line: line}
+	if reason != "" {
+		entry.Level = "error"
+		fmt.Printf("[FFmpeg] camera %d %s: %s\n", cameraID, pipeline, line)
+	}
+
+	key := streamLogKey{cameraID: cameraID, pipeline: pipeline}
+	streamLogs.mu.Lock()
+	defer streamLogs.mu.Unlock()
+	ring, exists := streamLogs.rings[key]
+	if !exists {
+		ring = &streamLogRing{lines: make([]StreamLogLine, streamLogs.size)}
+		streamLogs.rings[key] = ring
+	}
+	ring.add(entry)
+}
+
+// CameraStreamLogs returns the kept FFmpeg stderr lines of a camera, oldest
+// first, optionally only those of one pipeline and after since
+func CameraStreamLogs(cameraID uint, pipeline string, since *time.Time) []StreamLogLine {
+	streamLogs.mu.Lock()
+	var lines []StreamLogLine
+	for key, ring := range streamLogs.rings {
+		if key.cameraID != cameraID || (pipeline != "" && key.pipeline != pipeline) {
+			continue
+		}
+		lines = append(lines, ring.ordered()...)
+	}
+	streamLogs.mu.Unlock()
+
+	filtered := make([]StreamLogLine, 0, len(lines))
+	for _, line := range lines {
+		if since == nil || line.At.After(*since) {
+			filtered = append(filtered, line)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].At.Before(filtered[j].At) })
+	return filtered
+}
+
+// ClearStreamLogs forgets a camera's stream logs, e.g. when it is deleted
+func ClearStreamLogs(cameraID uint) {
+	streamLogs.mu.Lock()
+	defer streamLogs.mu.Unlock()
+	for key := range streamLogs.rings {
+		if key.cameraID == cameraID {
+			delete(streamLogs.rings, key)
+		}
+	}
+}
+
+// isFFmpegProgress reports whether a stderr line is FFmpeg's periodic
+// progress report, which would push everything useful out of the ring
+func isFFmpegProgress(line string) bool {
+	return strings.HasPrefix(line, "frame=") || strings.HasPrefix(line, "size=")
+}
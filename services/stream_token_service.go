@@ -0,0 +1,175 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+)
+
+var (
+	ErrStreamTokenInvalid = errors.New("invalid stream token")
+	ErrStreamTokenExpired = errors.New("stream token expired")
+	ErrStreamTokenBlocked = errors.New("too many invalid stream tokens, try again later")
+)
+
+// maxTrackedClients bounds the failure map; stale entries are pruned past it
+const maxTrackedClients = 1024
+
+// StreamTokenService signs the stream URLs served by MediaMTX and validates
+// them from MediaMTX's HTTP auth callback. A client sending too many invalid
+// tokens is blocked for a while and reported as a security event.
+type StreamTokenService struct {
+	config   config.StreamTokenConfig
+	events   *EventService
+	mu       sync.Mutex
+	failures map[string]*tokenFailures // client IP -> recent invalid tokens
+}
+
+type tokenFailures struct {
+	count        int
+	windowStart  time.Time
+	blockedUntil time.Time
+}
+
+func NewStreamTokenService(cfg config.StreamTokenConfig, events *EventService) *StreamTokenService {
+	return &StreamTokenService{
+		config:   cfg,
+		events:   events,
+		failures: make(map[string]*tokenFailures),
+	}
+}
+
+// Enabled reports whether stream URLs are signed
+func (s *StreamTokenService) Enabled() bool {
+	return s != nil && s.config.Secret != ""
+}
+
+// SignURL adds a token for pathName to a MediaMTX URL; unchanged when
+// signing is disabled
+func (s *StreamTokenService) SignURL(rawURL, pathName string, userID uint) string {
+	if !s.Enabled() || rawURL == "" {
+		return rawURL
+	}
+	token, _ := s.Token(pathName, userID)
+
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + "token=" + url.QueryEscape(token)
+}
+
+// Token signs pathName for userID, returning the token and when it expires.
+// Only call when Enabled.
+func (s *StreamTokenService) Token(pathName string, userID uint) (string, time.Time) {
+	expires := time.Now().Add(s.config.TTL).Truncate(time.Second)
+	return fmt.Sprintf("%d.%d.%s", userID, expires.Unix(), s.mac(pathName, userID, expires.Unix())), expires
+}
+
+// TokenUser returns the user a token was signed for; only meaningful once
+// Validate accepted it
+func (s *StreamTokenService) TokenUser(token string) uint {
+	userID, _ := strconv.ParseUint(strings.SplitN(token, ".", 2)[0], 10, 64)
+	return uint(userID)
+}
+
+// Validate checks a token against the path it is used for. Invalid tokens
+// count towards blocking the client; expired ones don't, players holding an
+// old URL are not attackers.
+func (s *StreamTokenService) Validate(pathName, token, clientIP string) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	if f, ok := s.failures[clientIP]; ok && now.Before(f.blockedUntil) {
+		s.mu.Unlock()
+		return ErrStreamTokenBlocked
+	}
+	s.mu.Unlock()
+
+	err := s.check(pathName, token, now)
+	if err == ErrStreamTokenInvalid {
+		s.recordFailure(pathName, clientIP, now)
+	}
+	return err
+}
+
+func (s *StreamTokenService) check(pathName, token string, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrStreamTokenInvalid
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return ErrStreamTokenInvalid
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrStreamTokenInvalid
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.mac(pathName, uint(userID), expires))) {
+		return ErrStreamTokenInvalid
+	}
+	if now.Unix() > expires {
+		return ErrStreamTokenExpired
+	}
+	return nil
+}
+
+func (s *StreamTokenService) mac(pathName string, userID uint, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Secret))
+	fmt.Fprintf(mac, "%s|%d|%d", pathName, userID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordFailure counts an invalid token and blocks the client once it hits
+// MaxFailures within FailureWindow (0 = never)
+func (s *StreamTokenService) recordFailure(pathName, clientIP string, now time.Time) {
+	s.mu.Lock()
+	if len(s.failures) >= maxTrackedClients {
+		for ip, f := range s.failures {
+			if now.Sub(f.windowStart) > s.config.FailureWindow && now.After(f.blockedUntil) {
+				delete(s.failures, ip)
+			}
+		}
+	}
+	f, ok := s.failures[clientIP]
+	if !ok || now.Sub(f.windowStart) > s.config.FailureWindow {
+		f = &tokenFailures{windowStart: now}
+		s.failures[clientIP] = f
+	}
+	f.count++
+	blocked := s.config.MaxFailures > 0 && f.count >= s.config.MaxFailures
+	count := f.count
+	if blocked {
+		f.blockedUntil = now.Add(s.config.BlockFor)
+		f.count = 0
+		f.windowStart = now
+	}
+	s.mu.Unlock()
+
+	if !blocked {
+		return
+	}
+	fmt.Printf("[StreamAuth] Blocked %s for %s after %d invalid stream tokens (last path %s)\n", clientIP, s.config.BlockFor, count, pathName)
+	s.events.Record(&models.Event{
+		Type:        "stream_token_abuse",
+		Severity:    "warning",
+		Source:      "stream_auth",
+		Description: fmt.Sprintf("%d invalid stream tokens from %s within %s; blocked for %s", count, clientIP, s.config.FailureWindow, s.config.BlockFor),
+	}, map[string]interface{}{
+		"client_ip":     clientIP,
+		"path":          pathName,
+		"failures":      count,
+		"blocked_until": now.Add(s.config.BlockFor),
+	})
+}
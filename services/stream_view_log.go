@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// StreamViewLog records every stream view: who watched which camera, over
+// which protocol, for how long and how many bytes were sent. HLS segments
+// are served by MediaMTX, so HLS views only have a start.
+type StreamViewLog struct {
+	db *gorm.DB
+}
+
+func NewStreamViewLog(db *gorm.DB) *StreamViewLog {
+	return &StreamViewLog{db: db}
+}
+
+// Open records the start of a view. Returns nil when it couldn't be stored;
+// a failing log never blocks the stream.
+func (l *StreamViewLog) Open(cameraID uint, userID *uint, email, protocol, clientIP string) *models.StreamView {
+	view := &models.StreamView{
+		CameraID:  cameraID,
+		UserID:    userID,
+		Email:     email,
+		Protocol:  protocol,
+		ClientIP:  clientIP,
+		StartedAt: time.Now(),
+	}
+	if err := l.db.Create(view).Error; err != nil {
+		fmt.Printf("[StreamViews] Failed to record %s view of camera %d: %v\n", protocol, cameraID, err)
+		return nil
+	}
+	return view
+}
+
+// Close records the end of a view opened with Open
+func (l *StreamViewLog) Close(view *models.StreamView, bytesSent int64) {
+	if view == nil {
+		return
+	}
+	err := l.db.Model(view).Updates(map[string]interface{}{
+		"ended_at":   time.Now(),
+		"bytes_sent": bytesSent,
+	}).Error
+	if err != nil {
+		fmt.Printf("[StreamViews] Failed to close view %d of camera %d: %v\n", view.ID, view.CameraID, err)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"command-center-vms-cctv/be/models"
+)
+
+// TamperComparison is how a view compares with the camera's tamper
+// baseline, by the same measures as the periodic tamper checks
+type TamperComparison struct {
+	Brightness  float64 `json:"brightness"`
+	Sharpness   float64 `json:"sharpness"`
+	Correlation float64 `json:"correlation"`    // Structure correlation with the baseline (-1..1)
+	Kind        string  `json:"kind,omitempty"` // Tamper kind the view shows, when any
+}
+
+// CompareWithBaseline compares a JPEG of a camera's view with its tamper
+// baseline. A single look: unlike the periodic checks, nothing is confirmed
+// over several frames and no event is recorded.
+func CompareWithBaseline(baseline *models.TamperBaseline, view []byte) (TamperComparison, error) {
+	img, err := jpeg.Decode(bytes.NewReader(view))
+	if err != nil {
+		return TamperComparison{}, fmt.Errorf("failed to decode view: %w", err)
+	}
+	frame := grayFrame(img, baseline.Width, baseline.Height)
+
+	brightness, stdDev := frameStats(frame)
+	sharpness := frameSharpness(frame, baseline.Width, baseline.Height)
+	kind, correlation := classifyTamper(frame, brightness, stdDev, sharpness, baseline)
+	return TamperComparison{
+		Brightness:  round1(brightness),
+		Sharpness:   round1(sharpness),
+		Correlation: correlation,
+		Kind:        kind,
+	}, nil
+}
+
+// BaselineJPEG returns the baseline's view as a JPEG: its color reference,
+// or for baselines without one the grayscale frame tamper detection uses.
+// grayscale reports the latter.
+func BaselineJPEG(baseline *models.TamperBaseline) (data []byte, grayscale bool, err error) {
+	if len(baseline.Reference) > 0 {
+		return baseline.Reference, false, nil
+	}
+	if len(baseline.Frame) != baseline.Width*baseline.Height {
+		return nil, false, fmt.Errorf("baseline frame is corrupt")
+	}
+	img := &image.Gray{
+		Pix:    baseline.Frame,
+		Stride: baseline.Width,
+		Rect:   image.Rect(0, 0, baseline.Width, baseline.Height),
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// grayFrame scales an image to width x height 8-bit grayscale by averaging
+// the pixels falling in each target pixel, like FFmpeg's scale and format
+// filters do for the periodic checks
+func grayFrame(img image.Image, width, height int) []byte {
+	bounds := img.Bounds()
+	frame := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+			var sum, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, _ := img.At(sx, sy).RGBA()
+					// BT.601 luma, from 16-bit channels
+					sum += (299*uint64(r) + 587*uint64(g) + 114*uint64(b)) / 1000 >> 8
+					n++
+				}
+			}
+			frame[y*width+x] = byte(sum / n)
+		}
+	}
+	return frame
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+// PipelineTamper is the FFmpeg snapshotting a camera for tamper detection
+const PipelineTamper = "tamper"
+
+// Tamper kinds reported in tamper events
+const (
+	TamperBlackout     = "blackout"     // Covered, painted over or no picture
+	TamperDefocus      = "defocus"      // Lens blurred or pushed out of focus
+	TamperRepositioned = "repositioned" // Pointed somewhere else
+)
+
+const (
+	tamperFrameWidth  = 160
+	tamperFrameHeight = 90
+	tamperWorkers     = 4
+	// A kind must be seen on this many consecutive checks before an event,
+	// so a passing truck or an IR switch doesn't raise an alarm
+	tamperConfirmations = 2
+
+	tamperDarkBrightness = 20.0 // Mean below this is a blackout
+	tamperFlatStdDev     = 6.0  // Nearly uniform frame (covered lens)
+	tamperSharpnessRatio = 0.35 // Sharpness below this share of baseline is defocus
+	tamperMinSharpness   = 2.0  // Baselines flatter than this can't detect defocus
+	tamperMinCorrelation = 0.4  // Structure correlation below this is repositioned
+	tamperCaptureTimeout = 20 * time.Second
+	tamperReferenceWidth = 640 // Of the color reference JPEG kept with a baseline
+)
+
+// TamperStatus is the latest tamper check result for a camera
+type TamperStatus struct {
+	CameraID    uint      `json:"camera_id"`
+	Tampered    bool      `json:"tampered"`
+	Kind        string    `json:"kind,omitempty"`
+	Since       time.Time `json:"since,omitempty"`
+	Brightness  float64   `json:"brightness"`
+	Sharpness   float64   `json:"sharpness"`
+	Correlation float64   `json:"correlation"`
+	CheckedAt   time.Time `json:"checked_at"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type tamperState struct {
+	status       TamperStatus
+	pendingKind  string
+	pendingCount int
+}
+
+// TamperService periodically snapshots cameras with tamper detection enabled
+// and compares them with a stored baseline to detect blackout, defocus and
+// repositioning. The first good frame of a camera becomes its baseline.
+// Cameras in privacy mode are not captured.
+type TamperService struct {
+	db       *gorm.DB
+	events   *EventService
+	ingest   *IngestService
+	features *FeatureFlagService
+	privacy  *PrivacyService
+	interval time.Duration
+	states   map[uint]*tamperState
+	mu       sync.RWMutex
+}
+
+func NewTamperService(cfg config.TamperConfig, db *gorm.DB, events *EventService, ingest *IngestService, features *FeatureFlagService, privacy *PrivacyService) *TamperService {
+	return &TamperService{
+		db:       db,
+		events:   events,
+		ingest:   ingest,
+		features: features,
+		privacy:  privacy,
+		interval: cfg.CheckInterval,
+		states:   make(map[uint]*tamperState),
+	}
+}
+
+// Start runs the periodic checks in the background
+func (s *TamperService) Start() {
+	if s.interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.checkAll()
+		}
+	}()
+}
+
+func (s *TamperService) checkAll() {
+	var cameras []models.Camera
+	if err := s.db.Where("tamper_detection = ?", true).Find(&cameras).Error; err != nil {
+		fmt.Printf("[Tamper] Failed to load cameras: %v\n", err)
+		return
+	}
+
+	jobs := make(chan models.Camera)
+	var wg sync.WaitGroup
+	for i := 0; i < tamperWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for camera := range jobs {
+				s.Check(&camera)
+			}
+		}()
+	}
+	for _, camera := range cameras {
+		if _, private := s.privacy.Active(camera.ID); private {
+			continue
+		}
+		if s.features.EnabledFor(models.FeatureAnalytics, &camera) {
+			jobs <- camera
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Check snapshots one camera and updates its tamper state
+func (s *TamperService) Check(camera *models.Camera) TamperStatus {
+	now := time.Now()
+	frame, err := captureGrayFrame(camera.ID, PipelineTamper, s.ingest.URL(camera), tamperFrameWidth, tamperFrameHeight)
+	if err != nil {
+		// Offline cameras are reported by stream health, not as tampering
+		return s.update(camera.ID, TamperStatus{CameraID: camera.ID, CheckedAt: now, Error: err.Error()}, "")
+	}
+
+	brightness, stdDev := frameStats(frame)
+	sharpness := frameSharpness(frame, tamperFrameWidth, tamperFrameHeight)
+	status := TamperStatus{
+		CameraID:    camera.ID,
+		Brightness:  round1(brightness),
+		Sharpness:   round1(sharpness),
+		Correlation: 1,
+		CheckedAt:   now,
+	}
+
+	var baseline models.TamperBaseline
+	err = s.db.First(&baseline, "camera_id = ?", camera.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if brightness >= tamperDarkBrightness && stdDev >= tamperFlatStdDev {
+			s.saveBaseline(camera)
+		}
+		return s.update(camera.ID, status, "")
+	}
+	if err != nil {
+		status.Error = "failed to load baseline"
+		return s.update(camera.ID, status, "")
+	}
+
+	kind, correlation := classifyTamper(frame, brightness, stdDev, sharpness, &baseline)
+	status.Correlation = correlation
+	return s.update(camera.ID, status, kind)
+}
+
+// classifyTamper compares a frame with the baseline, returning the tamper
+// kind it shows ("" for none) and its structure correlation with the
+// baseline (1 when not compared)
+func classifyTamper(frame []byte, brightness, stdDev, sharpness float64, baseline *models.TamperBaseline) (string, float64) {
+	switch {
+	case brightness < tamperDarkBrightness || stdDev < tamperFlatStdDev:
+		return TamperBlackout, 1
+	case baseline.Sharpness >= tamperMinSharpness && sharpness < baseline.Sharpness*tamperSharpnessRatio:
+		return TamperDefocus, 1
+	}
+	if len(baseline.Frame) != len(frame) {
+		return "", 1
+	}
+	correlation := round1(frameCorrelation(frame, baseline.Frame)*100) / 100
+	if correlation < tamperMinCorrelation {
+		return TamperRepositioned, correlation
+	}
+	return "", correlation
+}
+
+// update applies a check result, confirming a kind over consecutive checks
+// before recording tamper / tamper_cleared events
+func (s *TamperService) update(cameraID uint, status TamperStatus, kind string) TamperStatus {
+	s.mu.Lock()
+	state, exists := s.states[cameraID]
+	if !exists {
+		state = &tamperState{}
+		s.states[cameraID] = state
+	}
+
+	previous := state.status
+	if status.Error != "" {
+		// Keep the last known tamper state while the camera can't be read
+		status.Tampered, status.Kind, status.Since = previous.Tampered, previous.Kind, previous.Since
+		state.status = status
+		s.mu.Unlock()
+		return status
+	}
+
+	if kind == state.pendingKind {
+		state.pendingCount++
+	} else {
+		state.pendingKind = kind
+		state.pendingCount = 1
+	}
+
+	status.Tampered, status.Kind, status.Since = previous.Tampered, previous.Kind, previous.Since
+	var event *models.Event
+	if state.pendingCount >= tamperConfirmations && kind != previous.Kind {
+		id := cameraID
+		if kind != "" {
+			status.Tampered, status.Kind, status.Since = true, kind, status.CheckedAt
+			event = &models.Event{
+				CameraID:    &id,
+				Type:        "tamper",
+				Severity:    "critical",
+				Source:      "tamper_detection",
+				Description: tamperDescription(kind),
+				OccurredAt:  status.CheckedAt,
+			}
+		} else {
+			status.Tampered, status.Kind, status.Since = false, "", time.Time{}
+			event = &models.Event{
+				CameraID:    &id,
+				Type:        "tamper_cleared",
+				Severity:    "info",
+				Source:      "tamper_detection",
+				Description: "Camera view is back to normal",
+				OccurredAt:  status.CheckedAt,
+			}
+		}
+	}
+	state.status = status
+	s.mu.Unlock()
+
+	if event != nil {
+		s.events.Record(event, map[string]interface{}{
+			"kind":        kind,
+			"brightness":  status.Brightness,
+			"sharpness":   status.Sharpness,
+			"correlation": status.Correlation,
+		})
+	}
+	return status
+}
+
+func tamperDescription(kind string) string {
+	switch kind {
+	case TamperBlackout:
+		return "Camera view is black or covered"
+	case TamperDefocus:
+		return "Camera view is blurred or out of focus"
+	case TamperRepositioned:
+		return "Camera view no longer matches its baseline (repositioned)"
+	}
+	return "Camera tampering detected"
+}
+
+// GetStatus returns the last check result for a camera
+func (s *TamperService) GetStatus(cameraID uint) (TamperStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, exists := s.states[cameraID]
+	if !exists {
+		return TamperStatus{}, false
+	}
+	return state.status, true
+}
+
+// ResetBaseline captures a new baseline now, e.g. after a camera was
+// deliberately re-aimed, and clears any active tamper state
+func (s *TamperService) ResetBaseline(camera *models.Camera) (*models.TamperBaseline, error) {
+	baseline, err := s.saveBaseline(camera)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	delete(s.states, camera.ID)
+	s.mu.Unlock()
+	return baseline, nil
+}
+
+// saveBaseline captures a baseline frame along with a color reference JPEG
+// of the same frame and stores them. Cameras in privacy mode are refused,
+// as are views too dark or uniform to compare later checks with.
+func (s *TamperService) saveBaseline(camera *models.Camera) (*models.TamperBaseline, error) {
+	cameraID := camera.ID
+	if _, private := s.privacy.Active(cameraID); private {
+		return nil, ErrPrivacyMode
+	}
+	frame, reference, err := captureBaselineFrame(cameraID, s.ingest.URL(camera))
+	if err != nil {
+		fmt.Printf("[Tamper] Failed to capture baseline for camera %d: %v\n", cameraID, err)
+		return nil, err
+	}
+	brightness, stdDev := frameStats(frame)
+	if brightness < tamperDarkBrightness || stdDev < tamperFlatStdDev {
+		return nil, fmt.Errorf("current view is too dark or uniform to use as a baseline")
+	}
+	sharpness := frameSharpness(frame, tamperFrameWidth, tamperFrameHeight)
+
+	baseline := &models.TamperBaseline{
+		CameraID:   cameraID,
+		Width:      tamperFrameWidth,
+		Height:     tamperFrameHeight,
+		Frame:      frame,
+		Reference:  reference,
+		Brightness: round1(brightness),
+		Sharpness:  round1(sharpness),
+		CapturedAt: time.Now(),
+	}
+	if err := s.db.Save(baseline).Error; err != nil {
+		fmt.Printf("[Tamper] Failed to save baseline for camera %d: %v\n", cameraID, err)
+		return nil, err
+	}
+	fmt.Printf("[Tamper] Baseline captured for camera %d\n", cameraID)
+	return baseline, nil
+}
+
+// captureGrayFrame grabs one frame scaled to width x height 8-bit grayscale
+func captureGrayFrame(cameraID uint, pipeline, rtspURL string, width, height int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tamperCaptureTimeout)
+	defer cancel()
+
+	stderr := newFFmpegErrorWriter(cameraID, pipeline)
+	cmd := FFmpegCommandContext(ctx,
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", rtspURL,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:%d,format=gray", width, height),
+		"-f", "rawvideo",
+		"-",
+	)
+	cmd.Stderr = stderr
+
+	frame, err := cmd.Output()
+	if err != nil {
+		if streamErr := stderr.LastError(); streamErr != nil {
+			return nil, streamErr
+		}
+		return nil, fmt.Errorf("failed to capture frame: %v", err)
+	}
+	if len(frame) != width*height {
+		return nil, fmt.Errorf("unexpected frame size %d", len(frame))
+	}
+	return frame, nil
+}
+
+// captureBaselineFrame grabs one frame both as a tamperFrameWidth x
+// tamperFrameHeight grayscale frame and as a color JPEG tamperReferenceWidth
+// wide, from a single decode so both show the same moment
+func captureBaselineFrame(cameraID uint, rtspURL string) ([]byte, []byte, error) {
+	file, err := os.CreateTemp("", "tamper-reference-*.jpg")
+	if err != nil {
+		return nil, nil, err
+	}
+	referencePath := file.Name()
+	file.Close()
+	defer os.Remove(referencePath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), tamperCaptureTimeout)
+	defer cancel()
+
+	stderr := newFFmpegErrorWriter(cameraID, PipelineTamper)
+	cmd := FFmpegCommandContext(ctx,
+		"-loglevel", "error",
+		"-rtsp_transport", "tcp",
+		"-i", rtspURL,
+		"-filter_complex", fmt.Sprintf("[0:v]split=2[g][c];[g]scale=%d:%d,format=gray[gray];[c]scale=%d:-2[color]",
+			tamperFrameWidth, tamperFrameHeight, tamperReferenceWidth),
+		"-map", "[gray]", "-frames:v", "1", "-f", "rawvideo", "-",
+		"-map", "[color]", "-frames:v", "1", "-q:v", "4", "-c:v", "mjpeg", "-f", "image2", "-y", referencePath,
+	)
+	cmd.Stderr = stderr
+
+	frame, err := cmd.Output()
+	if err != nil {
+		if streamErr := stderr.LastError(); streamErr != nil {
+			return nil, nil, streamErr
+		}
+		return nil, nil, fmt.Errorf("failed to capture frame: %v", err)
+	}
+	if len(frame) != tamperFrameWidth*tamperFrameHeight {
+		return nil, nil, fmt.Errorf("unexpected frame size %d", len(frame))
+	}
+	reference, err := os.ReadFile(referencePath)
+	if err != nil || len(reference) == 0 {
+		return nil, nil, fmt.Errorf("failed to capture reference view: %v", err)
+	}
+	return frame, reference, nil
+}
+
+// frameStats returns the mean and standard deviation of pixel values
+func frameStats(frame []byte) (float64, float64) {
+	var sum, sumSq float64
+	for _, p := range frame {
+		v := float64(p)
+		sum += v
+		sumSq += v * v
+	}
+	n := float64(len(frame))
+	mean := sum / n
+	return mean, math.Sqrt(math.Max(sumSq/n-mean*mean, 0))
+}
+
+// frameSharpness is the mean absolute horizontal+vertical gradient; it drops
+// sharply when the lens is defocused or smeared
+func frameSharpness(frame []byte, width, height int) float64 {
+	var sum float64
+	for y := 0; y < height-1; y++ {
+		for x := 0; x < width-1; x++ {
+			p := float64(frame[y*width+x])
+			sum += math.Abs(p-float64(frame[y*width+x+1])) + math.Abs(p-float64(frame[(y+1)*width+x]))
+		}
+	}
+	return sum / float64((width-1)*(height-1))
+}
+
+// frameCorrelation is the normalized cross-correlation of two frames (-1..1).
+// Normalizing by mean and deviation makes it tolerant of day/night changes.
+func frameCorrelation(a, b []byte) float64 {
+	meanA, stdA := frameStats(a)
+	meanB, stdB := frameStats(b)
+	if stdA == 0 || stdB == 0 {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += (float64(a[i]) - meanA) * (float64(b[i]) - meanB)
+	}
+	return sum / float64(len(a)) / (stdA * stdB)
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
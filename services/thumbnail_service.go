@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+)
+
+// PipelineThumbnails is the transcode scheduler pipeline of sprite rendering
+const PipelineThumbnails = "thumbnails"
+
+const (
+	thumbnailQueueSize = 256
+	thumbnailPriority  = -1 // Like exports, never preempts live streams
+	thumbnailTimeout   = 2 * time.Minute
+
+	thumbnailWidth    = 160
+	thumbnailHeight   = 90
+	spriteColumns     = 10
+	spriteMaxFrames   = 200 // Longer recordings get a wider interval instead of a bigger sprite
+	spriteJPEGQuality = 5   // FFmpeg -q:v, 2 (best) to 31
+)
+
+// SpriteLayout describes the thumbnail grid of a recording's sprite: frame i
+// shows the recording at i*Interval and sits at column i%Columns, row
+// i/Columns
+type SpriteLayout struct {
+	Interval time.Duration
+	Frames   int
+	Columns  int
+	Rows     int
+	Width    int // Of one thumbnail
+	Height   int
+}
+
+// ThumbnailService renders a JPEG sprite of periodic thumbnails for each
+// recording, for hover previews on the playback scrubber. Sprites of new
+// segments are rendered in the background; older recordings get theirs on
+// first request.
+type ThumbnailService struct {
+	interval  time.Duration
+	scheduler *TranscodeScheduler
+	queue     chan models.Recording
+	mu        sync.Mutex
+	rendering map[uint]chan struct{} // recording ID -> closed when its render ends
+}
+
+func NewThumbnailService(cfg config.RecordingConfig, scheduler *TranscodeScheduler) *ThumbnailService {
+	interval := cfg.ThumbnailInterval
+	if interval < time.Second {
+		interval = 10 * time.Second
+	}
+	return &ThumbnailService{
+		interval:  interval,
+		scheduler: scheduler,
+		queue:     make(chan models.Recording, thumbnailQueueSize),
+		rendering: make(map[uint]chan struct{}),
+	}
+}
+
+// Start runs the background worker
+func (s *ThumbnailService) Start() {
+	go func() {
+		for recording := range s.queue {
+			if _, err := s.Sprite(&recording); err != nil && !errors.Is(err, ErrTranscodeCapacity) {
+				fmt.Printf("[Thumbnails] Failed to render sprite of recording %d: %v\n", recording.ID, err)
+			}
+		}
+	}()
+}
+
+// Enqueue schedules a completed recording's sprite. Dropped when the queue
+// is full; the sprite is then rendered when first requested.
+func (s *ThumbnailService) Enqueue(recording models.Recording) {
+	select {
+	case s.queue <- recording:
+	default:
+	}
+}
+
+// SpritePath is where the sprite of a recording file is stored
+func SpritePath(recordingPath string) string {
+	return strings.TrimSuffix(recordingPath, filepath.Ext(recordingPath)) + ".sprite.jpg"
+}
+
+// Layout returns the sprite grid of a completed recording
+func (s *ThumbnailService) Layout(recording *models.Recording) SpriteLayout {
+	var duration time.Duration
+	if recording.EndTime != nil {
+		duration = recording.EndTime.Sub(recording.StartTime)
+	}
+	interval := s.interval
+	if duration > interval*spriteMaxFrames {
+		interval = (duration / spriteMaxFrames).Truncate(time.Second) + time.Second
+	}
+	frames := int(math.Ceil(duration.Seconds() / interval.Seconds()))
+	if frames < 1 {
+		frames = 1
+	}
+	columns := spriteColumns
+	if frames < columns {
+		columns = frames
+	}
+	return SpriteLayout{
+		Interval: interval,
+		Frames:   frames,
+		Columns:  columns,
+		Rows:     (frames + columns - 1) / columns,
+		Width:    thumbnailWidth,
+		Height:   thumbnailHeight,
+	}
+}
+
+// Sprite returns the sprite of a completed recording, rendering it first if
+// needed. Concurrent requests for the same recording share one render.
+// Returns ErrTranscodeCapacity when no FFmpeg slot is free.
+func (s *ThumbnailService) Sprite(recording *models.Recording) (string, error) {
+	path := SpritePath(recording.FilePath)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+
+		s.mu.Lock()
+		done, busy := s.rendering[recording.ID]
+		if !busy {
+			done = make(chan struct{})
+			s.rendering[recording.ID] = done
+		}
+		s.mu.Unlock()
+		if busy {
+			<-done
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+			continue
+		}
+
+		err := s.render(recording, path)
+		s.mu.Lock()
+		delete(s.rendering, recording.ID)
+		s.mu.Unlock()
+		close(done)
+		if err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// render draws the sprite from keyframes only, which is plenty for one
+// frame every few seconds and keeps decoding cheap
+func (s *ThumbnailService) render(recording *models.Recording, path string) error {
+	if recording.EndTime == nil {
+		return errors.New("recording is not completed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), thumbnailTimeout)
+	defer cancel()
+
+	slot, err := s.scheduler.Acquire(recording.CameraID, PipelineThumbnails, thumbnailPriority, nil, cancel)
+	if err != nil {
+		return err
+	}
+	defer slot.Release()
+
+	layout := s.Layout(recording)
+	filter := fmt.Sprintf("fps=%.6f,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		1/layout.Interval.Seconds(), layout.Width, layout.Height, layout.Width, layout.Height, layout.Columns, layout.Rows)
+
+	// Written aside and renamed so a half-written sprite is never served
+	partial := path + ".part"
+	err = runFFmpeg(ctx, []string{
+		"-skip_frame", "nokey", "-i", recording.FilePath,
+		"-vf", filter, "-frames:v", "1", "-q:v", fmt.Sprint(spriteJPEGQuality),
+		"-f", "image2", "-y", partial,
+	})
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, path)
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+// ErrThumbnailNotFound is returned for cameras without a stored thumbnail
+var ErrThumbnailNotFound = errors.New("thumbnail not found")
+
+// ThumbnailStore persists the latest thumbnail of each camera
+type ThumbnailStore interface {
+	Put(cameraID uint, jpeg []byte, capturedAt time.Time) error
+	Get(cameraID uint) ([]byte, time.Time, error)
+	Delete(cameraID uint) error
+	List() ([]uint, error) // Cameras with a stored thumbnail
+}
+
+// NewThumbnailStore returns the S3-compatible store when a bucket is
+// configured, otherwise the directory store
+func NewThumbnailStore(cfg config.CameraThumbnailConfig) ThumbnailStore {
+	if cfg.S3Bucket != "" {
+		return &s3ThumbnailStore{
+			endpoint:   strings.TrimRight(cfg.S3Endpoint, "/"),
+			bucket:     cfg.S3Bucket,
+			region:     cfg.S3Region,
+			prefix:     cfg.S3Prefix,
+			accessKey:  cfg.S3AccessKey,
+			secretKey:  cfg.S3SecretKey,
+			httpClient: &http.Client{Timeout: 15 * time.Second},
+		}
+	}
+	return &dirThumbnailStore{dir: cfg.Dir}
+}
+
+func thumbnailName(cameraID uint) string {
+	return fmt.Sprintf("cam%d.jpg", cameraID)
+}
+
+// thumbnailCamera is the camera of a thumbnailName, false for other names
+func thumbnailCamera(name string) (uint, bool) {
+	if !strings.HasPrefix(name, "cam") || !strings.HasSuffix(name, ".jpg") {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "cam"), ".jpg"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// dirThumbnailStore keeps thumbnails as <dir>/cam<id>.jpg, with the capture
+// time as the file's modification time
+type dirThumbnailStore struct {
+	dir string
+}
+
+func (s *dirThumbnailStore) Put(cameraID uint, jpeg []byte, capturedAt time.Time) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, thumbnailName(cameraID))
+	// Written aside and renamed so readers never see half a JPEG
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, jpeg, 0644); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp, capturedAt, capturedAt); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *dirThumbnailStore) Get(cameraID uint) ([]byte, time.Time, error) {
+	path := filepath.Join(s.dir, thumbnailName(cameraID))
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, time.Time{}, ErrThumbnailNotFound
+		}
+		return nil, time.Time{}, err
+	}
+	jpeg, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return jpeg, info.ModTime(), nil
+}
+
+func (s *dirThumbnailStore) Delete(cameraID uint) error {
+	err := os.Remove(filepath.Join(s.dir, thumbnailName(cameraID)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *dirThumbnailStore) List() ([]uint, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var cameraIDs []uint
+	for _, entry := range entries {
+		if cameraID, ok := thumbnailCamera(entry.Name()); ok && !entry.IsDir() {
+			cameraIDs = append(cameraIDs, cameraID)
+		}
+	}
+	return cameraIDs, nil
+}
+
+// s3ThumbnailStore keeps thumbnails in an S3-compatible bucket (AWS, MinIO,
+// ...) as <prefix>cam<id>.jpg, addressed path-style and signed with AWS
+// Signature Version 4. The capture time travels as object metadata.
+type s3ThumbnailStore struct {
+	endpoint   string
+	bucket     string
+	region     string
+	prefix     string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+}
+
+const s3CapturedAtHeader = "X-Amz-Meta-Captured-At"
+
+func (s *s3ThumbnailStore) Put(cameraID uint, jpeg []byte, capturedAt time.Time) error {
+	req, err := s.request(http.MethodPut, cameraID, jpeg)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	req.Header.Set(s3CapturedAtHeader, capturedAt.UTC().Format(time.RFC3339))
+	resp, err := s.do(req, jpeg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3ThumbnailStore) Get(cameraID uint) ([]byte, time.Time, error) {
+	req, err := s.request(http.MethodGet, cameraID, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	jpeg, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	capturedAt, err := time.Parse(time.RFC3339, resp.Header.Get(s3CapturedAtHeader))
+	if err != nil {
+		capturedAt, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	}
+	return jpeg, capturedAt, nil
+}
+
+func (s *s3ThumbnailStore) Delete(cameraID uint) error {
+	req, err := s.request(http.MethodDelete, cameraID, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, nil)
+	if err == ErrThumbnailNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List pages through the objects under the prefix with ListObjectsV2
+func (s *s3ThumbnailStore) List() ([]uint, error) {
+	var cameraIDs []uint
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		// Signature Version 4 wants spaces as %20
+		listURL := fmt.Sprintf("%s/%s?%s", s.endpoint, url.PathEscape(s.bucket), strings.ReplaceAll(query.Encode(), "+", "%20"))
+		req, err := http.NewRequest(http.MethodGet, listURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid object listing: %w", err)
+		}
+		for _, object := range page.Contents {
+			if cameraID, ok := thumbnailCamera(strings.TrimPrefix(object.Key, s.prefix)); ok {
+				cameraIDs = append(cameraIDs, cameraID)
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return cameraIDs, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (s *s3ThumbnailStore) request(method string, cameraID uint, body []byte) (*http.Request, error) {
+	objectURL := fmt.Sprintf("%s/%s/%s", s.endpoint, url.PathEscape(s.bucket), escapeObjectKey(s.prefix+thumbnailName(cameraID)))
+	return http.NewRequest(method, objectURL, bytes.NewReader(body))
+}
+
+// do signs and sends a request, turning 404 into ErrThumbnailNotFound and
+// other non-2xx responses into errors
+func (s *s3ThumbnailStore) do(req *http.Request, body []byte) (*http.Response, error) {
+	s.sign(req, body, time.Now())
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrThumbnailNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		resp.Body.Close()
+		return nil, fmt.Errorf("object store returned %s: %s", resp.Status, snippet)
+	}
+	return resp, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header covering the
+// host, the x-amz-* headers and the payload hash
+func (s *s3ThumbnailStore) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// escapeObjectKey escapes each segment of an object key, keeping the slashes
+func escapeObjectKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
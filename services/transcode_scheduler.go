@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+)
+
+// ErrTranscodeCapacity is returned when every FFmpeg slot is taken by a
+// stream of equal or higher priority
+var ErrTranscodeCapacity = errors.New("transcode capacity reached")
+
+// TranscodeSlot is one running FFmpeg transcode counted against the cap
+type TranscodeSlot struct {
+	CameraID  uint
+	Pipeline  string
+	Priority  int
+	StartedAt time.Time
+
+	viewers   func() int // Current viewer count, used to find idle streams
+	stop      func()     // Stops the stream when it is preempted
+	scheduler *TranscodeScheduler
+}
+
+// Release frees the slot. Safe to call more than once and on nil.
+func (s *TranscodeSlot) Release() {
+	if s == nil || s.scheduler == nil {
+		return
+	}
+	s.scheduler.release(s)
+}
+
+// TranscodeScheduler enforces FFmpeg.MaxProcesses. When the cap is reached a
+// request may preempt a lower-priority stream, preferring ones nobody watches.
+type TranscodeScheduler struct {
+	maxProcesses int
+	events       *EventService
+	mu           sync.Mutex
+	slots        map[*TranscodeSlot]struct{}
+}
+
+func NewTranscodeScheduler(cfg config.FFmpegConfig, events *EventService) *TranscodeScheduler {
+	return &TranscodeScheduler{
+		maxProcesses: cfg.MaxProcesses,
+		events:       events,
+		slots:        make(map[*TranscodeSlot]struct{}),
+	}
+}
+
+// Acquire reserves a slot for a camera's transcode. stop is called (in its
+// own goroutine) if the slot is later preempted; viewers may be nil.
+func (s *TranscodeScheduler) Acquire(cameraID uint, pipeline string, priority int, viewers func() int, stop func()) (*TranscodeSlot, error) {
+	slot := &TranscodeSlot{
+		CameraID:  cameraID,
+		Pipeline:  pipeline,
+		Priority:  priority,
+		StartedAt: time.Now(),
+		viewers:   viewers,
+		stop:      stop,
+		scheduler: s,
+	}
+
+	s.mu.Lock()
+	if s.maxProcesses <= 0 || len(s.slots) < s.maxProcesses {
+		s.slots[slot] = struct{}{}
+		s.mu.Unlock()
+		return slot, nil
+	}
+
+	victim := s.pickVictimLocked(priority)
+	if victim == nil {
+		s.mu.Unlock()
+		return nil, ErrTranscodeCapacity
+	}
+	victimViewers := victim.viewerCount()
+	delete(s.slots, victim) // Its Release is now a no-op
+	s.slots[slot] = struct{}{}
+	s.mu.Unlock()
+
+	fmt.Printf("[Scheduler] Preempting %s stream for camera %d (priority %d, %d viewers) for camera %d (priority %d)\n",
+		victim.Pipeline, victim.CameraID, victim.Priority, victimViewers, cameraID, priority)
+
+	// Stopping takes the owning service's lock, so never do it under ours
+	if victim.stop != nil {
+		go victim.stop()
+	}
+
+	victimCameraID := victim.CameraID
+	s.events.Record(&models.Event{
+		CameraID:    &victimCameraID,
+		Type:        "stream_preempted",
+		Severity:    "warning",
+		Source:      "transcode_scheduler",
+		Description: fmt.Sprintf("%s stream stopped to free a transcode slot for camera %d", victim.Pipeline, cameraID),
+	}, map[string]interface{}{
+		"pipeline":              victim.Pipeline,
+		"priority":              victim.Priority,
+		"viewers":               victimViewers,
+		"running_seconds":       int(time.Since(victim.StartedAt).Seconds()),
+		"preempted_by":          cameraID,
+		"preempted_by_priority": priority,
+		"preempted_by_pipeline": pipeline,
+	})
+
+	return slot, nil
+}
+
+// pickVictimLocked returns the lowest-priority slot below priority, breaking
+// ties by fewest viewers and then the longest-running stream
+func (s *TranscodeScheduler) pickVictimLocked(priority int) *TranscodeSlot {
+	var victim *TranscodeSlot
+	victimViewers := 0
+	for slot := range s.slots {
+		if slot.Priority >= priority {
+			continue
+		}
+		viewers := slot.viewerCount()
+		if victim == nil ||
+			slot.Priority < victim.Priority ||
+			(slot.Priority == victim.Priority && viewers < victimViewers) ||
+			(slot.Priority == victim.Priority && viewers == victimViewers && slot.StartedAt.Before(victim.StartedAt)) {
+			victim = slot
+			victimViewers = viewers
+		}
+	}
+	return victim
+}
+
+func (s *TranscodeSlot) viewerCount() int {
+	if s.viewers == nil {
+		return 0
+	}
+	return s.viewers()
+}
+
+func (s *TranscodeScheduler) release(slot *TranscodeSlot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.slots, slot)
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Pipelines accounted by UsageTracker (same keys as ffmpeg_errors in stream
+// health); PipelineAudio lives in audio_service.go
+const (
+	PipelineWebRTC    = "webrtc"
+	PipelineMJPEG     = "mjpeg"
+	PipelineHLSLegacy = "hls_legacy"
+)
+
+const (
+	usageFlushInterval = time.Minute
+	clockTicksPerSec   = 100 // USER_HZ, fixed at 100 on Linux
+)
+
+type usageKey struct {
+	cameraID uint
+	pipeline string
+	hour     time.Time
+}
+
+type usageDelta struct {
+	cpuSeconds float64
+	bytesOut   int64
+}
+
+type trackedProcess struct {
+	cameraID uint
+	pipeline string
+	cmd      *exec.Cmd
+	cpuTicks uint64 // Last sampled utime+stime
+}
+
+// UsageTracker accumulates FFmpeg CPU time and output bytes per camera and
+// flushes them into hourly CameraUsage rows
+type UsageTracker struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	processes map[int]*trackedProcess // pid -> process
+	pending   map[usageKey]*usageDelta
+}
+
+func NewUsageTracker(db *gorm.DB) *UsageTracker {
+	t := &UsageTracker{
+		db:        db,
+		processes: make(map[int]*trackedProcess),
+		pending:   make(map[usageKey]*usageDelta),
+	}
+	go t.run()
+	return t
+}
+
+// TrackProcess starts CPU accounting for a running FFmpeg process. The
+// process is dropped automatically once it has exited.
+func (t *UsageTracker) TrackProcess(cameraID uint, pipeline string, cmd *exec.Cmd) {
+	if t == nil || cmd == nil || cmd.Process == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.processes[cmd.Process.Pid] = &trackedProcess{
+		cameraID: cameraID,
+		pipeline: pipeline,
+		cmd:      cmd,
+	}
+}
+
+// KillProcesses kills the tracked processes of a camera's pipeline (every
+// pipeline when pipeline is empty) and returns how many were signalled
+func (t *UsageTracker) KillProcesses(cameraID uint, pipeline string) int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	killed := 0
+	for _, proc := range t.processes {
+		if proc.cameraID != cameraID || (pipeline != "" && proc.pipeline != pipeline) {
+			continue
+		}
+		// ProcessState is written by whoever waits on the process, so it
+		// isn't read here; Kill fails with os.ErrProcessDone once it exited
+		if err := proc.cmd.Process.Kill(); err == nil {
+			killed++
+		}
+	}
+	return killed
+}
+
+// AddBytes records bytes produced by a camera's pipeline
+func (t *UsageTracker) AddBytes(cameraID uint, pipeline string, n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deltaLocked(cameraID, pipeline, time.Now()).bytesOut += int64(n)
+}
+
+// CountingReader wraps r so every byte read is added to the camera's usage
+func (t *UsageTracker) CountingReader(cameraID uint, pipeline string, r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &countingReader{reader: r, tracker: t, cameraID: cameraID, pipeline: pipeline}
+}
+
+type countingReader struct {
+	reader   io.Reader
+	tracker  *UsageTracker
+	cameraID uint
+	pipeline string
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.tracker.AddBytes(r.cameraID, r.pipeline, n)
+	return n, err
+}
+
+func (t *UsageTracker) deltaLocked(cameraID uint, pipeline string, now time.Time) *usageDelta {
+	key := usageKey{cameraID: cameraID, pipeline: pipeline, hour: now.UTC().Truncate(time.Hour)}
+	delta, ok := t.pending[key]
+	if !ok {
+		delta = &usageDelta{}
+		t.pending[key] = delta
+	}
+	return delta
+}
+
+func (t *UsageTracker) run() {
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		t.sampleCPU()
+		if err := t.flush(); err != nil {
+			fmt.Printf("[Usage] Failed to flush camera usage: %v\n", err)
+		}
+	}
+}
+
+// sampleCPU adds the CPU time each tracked process used since the last sample
+func (t *UsageTracker) sampleCPU() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for pid, proc := range t.processes {
+		ticks, err := readProcessCPUTicks(pid)
+		exited := err != nil
+		if exited {
+			// /proc entry is gone; use the final total if Wait() has reaped it
+			if state := proc.cmd.ProcessState; state != nil {
+				ticks = uint64((state.UserTime() + state.SystemTime()).Seconds() * clockTicksPerSec)
+			} else {
+				ticks = proc.cpuTicks
+			}
+		}
+
+		if ticks > proc.cpuTicks {
+			t.deltaLocked(proc.cameraID, proc.pipeline, now).cpuSeconds += float64(ticks-proc.cpuTicks) / clockTicksPerSec
+			proc.cpuTicks = ticks
+		}
+		if exited {
+			delete(t.processes, pid)
+		}
+	}
+}
+
+// flush upserts pending deltas into their hourly rows. On an error the
+// deltas not yet written go back to pending for the next flush.
+func (t *UsageTracker) flush() error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[usageKey]*usageDelta)
+	t.mu.Unlock()
+
+	for key, delta := range pending {
+		row := models.CameraUsage{
+			CameraID:   key.cameraID,
+			Hour:       key.hour,
+			Pipeline:   key.pipeline,
+			CPUSeconds: delta.cpuSeconds,
+			BytesOut:   delta.bytesOut,
+		}
+		err := t.db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "camera_id"}, {Name: "hour"}, {Name: "pipeline"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"cpu_seconds": gorm.Expr("camera_usages.cpu_seconds + EXCLUDED.cpu_seconds"),
+				"bytes_out":   gorm.Expr("camera_usages.bytes_out + EXCLUDED.bytes_out"),
+				"updated_at":  time.Now(),
+			}),
+		}).Create(&row).Error
+		if err != nil {
+			t.requeue(pending)
+			return err
+		}
+		delete(pending, key)
+	}
+	return nil
+}
+
+// requeue adds deltas that couldn't be flushed back into pending
+func (t *UsageTracker) requeue(deltas map[usageKey]*usageDelta) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, delta := range deltas {
+		pending, ok := t.pending[key]
+		if !ok {
+			t.pending[key] = delta
+			continue
+		}
+		pending.cpuSeconds += delta.cpuSeconds
+		pending.bytesOut += delta.bytesOut
+	}
+}
+
+// readProcessCPUTicks returns utime+stime from /proc/<pid>/stat
+func readProcessCPUTicks(pid int) (uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// comm (field 2) may contain spaces, so split after the closing paren
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	// Fields after comm start at state (field 3); utime/stime are fields 14/15
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return utime + stime, nil
+}
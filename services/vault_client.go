@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+const vaultTimeout = 10 * time.Second
+
+// vaultClient talks to the HashiCorp Vault HTTP API: token or AppRole
+// login, token renewal, KV reads and lease renewal. It is only used by the
+// SecretStore's refresh loop, one call at a time.
+type vaultClient struct {
+	config     config.SecretsConfig
+	httpClient *http.Client
+
+	token          string
+	tokenRenewable bool
+	tokenRenewAt   time.Time // Zero for tokens that never expire
+}
+
+// vaultResponse is the envelope of every Vault API response
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"` // Seconds
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func newVaultClient(cfg config.SecretsConfig) (*vaultClient, error) {
+	if cfg.VaultAddr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is required with SECRETS_PROVIDER=vault")
+	}
+	if cfg.VaultToken == "" && cfg.VaultRoleID == "" {
+		return nil, fmt.Errorf("VAULT_TOKEN or VAULT_ROLE_ID is required with SECRETS_PROVIDER=vault")
+	}
+	return &vaultClient{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: vaultTimeout},
+	}, nil
+}
+
+// login gets a token with AppRole, or looks up the configured token's TTL
+func (v *vaultClient) login(now time.Time) error {
+	if v.config.VaultRoleID != "" {
+		resp, err := v.do(http.MethodPost, "auth/approle/login", map[string]string{
+			"role_id":   v.config.VaultRoleID,
+			"secret_id": v.config.VaultSecretID,
+		})
+		if err != nil {
+			return fmt.Errorf("AppRole login: %w", err)
+		}
+		if resp.Auth == nil || resp.Auth.ClientToken == "" {
+			return fmt.Errorf("AppRole login returned no token")
+		}
+		v.token = resp.Auth.ClientToken
+		v.setTokenLease(now, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+		return nil
+	}
+
+	v.token = v.config.VaultToken
+	resp, err := v.do(http.MethodGet, "auth/token/lookup-self", nil)
+	if err != nil {
+		return fmt.Errorf("token lookup: %w", err)
+	}
+	ttl, _ := resp.Data["ttl"].(float64)
+	renewable, _ := resp.Data["renewable"].(bool)
+	v.setTokenLease(now, int(ttl), renewable)
+	return nil
+}
+
+// ensureToken renews the token once half its TTL is used, logging in again
+// with AppRole when it can't be renewed
+func (v *vaultClient) ensureToken(now time.Time) error {
+	if v.token == "" {
+		return v.login(now)
+	}
+	if v.tokenRenewAt.IsZero() || now.Before(v.tokenRenewAt) {
+		return nil
+	}
+	if v.tokenRenewable {
+		resp, err := v.do(http.MethodPost, "auth/token/renew-self", map[string]string{})
+		if err == nil && resp.Auth != nil {
+			v.setTokenLease(now, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+			return nil
+		}
+		fmt.Printf("[Secrets] Vault token renewal failed: %v\n", err)
+	}
+	if v.config.VaultRoleID == "" {
+		return fmt.Errorf("Vault token expires and can't be renewed")
+	}
+	return v.login(now)
+}
+
+func (v *vaultClient) setTokenLease(now time.Time, seconds int, renewable bool) {
+	v.tokenRenewable = renewable
+	v.tokenRenewAt = time.Time{}
+	if seconds > 0 {
+		v.tokenRenewAt = now.Add(time.Duration(seconds) * time.Second / 2)
+	}
+}
+
+// readKV returns the string values of a KV secret, version 1 or 2
+func (v *vaultClient) readKV(path string) (map[string]string, error) {
+	resp, err := v.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := resp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, v2 := data["metadata"]; v2 {
+			data = inner
+		}
+	}
+	values := make(map[string]string, len(data))
+	for key, value := range data {
+		if s, ok := value.(string); ok {
+			values[key] = s
+		}
+	}
+	return values, nil
+}
+
+// read returns a secret with its lease, e.g. dynamic database credentials
+func (v *vaultClient) read(path string) (*vaultResponse, error) {
+	return v.do(http.MethodGet, path, nil)
+}
+
+// renewLease extends a lease and returns how long it now lasts
+func (v *vaultClient) renewLease(leaseID string, increment time.Duration) (time.Duration, error) {
+	resp, err := v.do(http.MethodPut, "sys/leases/renew", map[string]interface{}{
+		"lease_id":  leaseID,
+		"increment": int(increment.Seconds()),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+func (v *vaultClient) do(method, path string, body interface{}) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	url := strings.TrimRight(v.config.VaultAddr, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.config.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.VaultNamespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var decoded vaultResponse
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&decoded); err != nil && resp.StatusCode < 300 {
+			return nil, fmt.Errorf("%s %s: invalid response: %w", method, path, err)
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: Vault returned %d: %s", method, path, resp.StatusCode, strings.Join(decoded.Errors, "; "))
+	}
+	return &decoded, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+// Pipeline of MediaMTX paths (HLS and the shared ingest) in ViewerTracker
+const PipelineHLS = "hls"
+
+// viewerKey is a camera's stream of one pipeline
+type viewerKey struct {
+	cameraID uint
+	pipeline string
+}
+
+// idlePipeline is a stream pipeline ViewerTracker stops when idle
+type idlePipeline struct {
+	running func() []uint            // Cameras the pipeline runs for
+	inUse   func(cameraID uint) bool // Whether anyone watches or reads it right now
+	stop    func(cameraID uint) error
+}
+
+// ViewerTracker stops streams nobody used for STREAM_IDLE_TIMEOUT. A
+// stream is used while its pipeline reports viewers or readers, and when a
+// viewer asks for it or sends a keepalive. Stopped streams start again on
+// the next request for them.
+type ViewerTracker struct {
+	config    config.StreamIdleConfig
+	pipelines map[string]idlePipeline
+	mu        sync.Mutex
+	lastUsed  map[viewerKey]time.Time
+}
+
+func NewViewerTracker(cfg config.StreamIdleConfig) *ViewerTracker {
+	return &ViewerTracker{
+		config:    cfg,
+		pipelines: make(map[string]idlePipeline),
+		lastUsed:  make(map[viewerKey]time.Time),
+	}
+}
+
+// Track registers a pipeline to stop when idle; register before Start
+func (t *ViewerTracker) Track(pipeline string, running func() []uint, inUse func(cameraID uint) bool, stop func(cameraID uint) error) {
+	t.pipelines[pipeline] = idlePipeline{running: running, inUse: inUse, stop: stop}
+}
+
+// Touch marks a camera's stream as used now; every pipeline when pipeline
+// is empty
+func (t *ViewerTracker) Touch(cameraID uint, pipeline string) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name := range t.pipelines {
+		if pipeline == "" || pipeline == name {
+			t.lastUsed[viewerKey{cameraID, name}] = now
+		}
+	}
+}
+
+// IdleTimeout is how long a stream may go unused before it is stopped
+func (t *ViewerTracker) IdleTimeout() time.Duration {
+	return t.config.Timeout
+}
+
+// Start checks for idle streams every quarter of the idle timeout
+func (t *ViewerTracker) Start() {
+	if t.config.Timeout <= 0 {
+		return
+	}
+	interval := t.config.Timeout / 4
+	if interval < 5*time.Second {
+		interval = 5 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			t.stopIdle(now)
+		}
+	}()
+}
+
+func (t *ViewerTracker) stopIdle(now time.Time) {
+	for name, pipeline := range t.pipelines {
+		running := make(map[uint]bool)
+		for _, cameraID := range pipeline.running() {
+			running[cameraID] = true
+			key := viewerKey{cameraID, name}
+
+			used := pipeline.inUse(cameraID)
+			t.mu.Lock()
+			lastUsed, seen := t.lastUsed[key]
+			if used || !seen {
+				// Streams started before the tracker saw them get a full timeout
+				t.lastUsed[key] = now
+			}
+			t.mu.Unlock()
+			if used || !seen || now.Sub(lastUsed) < t.config.Timeout {
+				continue
+			}
+
+			if err := pipeline.stop(cameraID); err != nil {
+				fmt.Printf("[Viewers] Failed to stop idle %s stream of camera %d: %v\n", name, cameraID, err)
+				continue
+			}
+			fmt.Printf("[Viewers] Stopped %s stream of camera %d, unused for %s\n", name, cameraID, now.Sub(lastUsed).Round(time.Second))
+			t.mu.Lock()
+			delete(t.lastUsed, key)
+			t.mu.Unlock()
+		}
+
+		// Streams stopped some other way
+		t.mu.Lock()
+		for key := range t.lastUsed {
+			if key.pipeline == name && !running[key.cameraID] && now.Sub(t.lastUsed[key]) > t.config.Timeout {
+				delete(t.lastUsed, key)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// StreamCameras returns the camera IDs of a per-camera stream status map,
+// e.g. GetAllStreamStatus
+func StreamCameras(streams map[uint]bool) []uint {
+	ids := make([]uint, 0, len(streams))
+	for cameraID := range streams {
+		ids = append(ids, cameraID)
+	}
+	return ids
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+const visitorPruneInterval = time.Hour
+
+// VisitorSnapshotRetention deletes check-in snapshots older than
+// the settings' visitor_snapshot_days (default VISITOR_SNAPSHOT_RETENTION)
+// from VISITOR_SNAPSHOT_DIR. The check-ins are
+// kept, without a snapshot, along with their footage link.
+type VisitorSnapshotRetention struct {
+	db     *gorm.DB
+	config config.VisitorConfig
+}
+
+func NewVisitorSnapshotRetention(cfg config.VisitorConfig, db *gorm.DB) *VisitorSnapshotRetention {
+	return &VisitorSnapshotRetention{db: db, config: cfg}
+}
+
+// Start prunes expired snapshots now and every visitorPruneInterval
+func (r *VisitorSnapshotRetention) Start() {
+	go func() {
+		ticker := time.NewTicker(visitorPruneInterval)
+		defer ticker.Stop()
+
+		for {
+			retention := storedRetention(r.db, func(s *models.RetentionSettings) *int { return s.VisitorSnapshotDays }, r.config.SnapshotRetention)
+			if retention > 0 {
+				r.prune(time.Now().Add(-retention))
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func (r *VisitorSnapshotRetention) prune(cutoff time.Time) {
+	var expired []models.VisitorCheckIn
+	if err := r.db.Select("id", "snapshot_path").
+		Where("checked_in_at < ? AND snapshot_path <> ''", cutoff).Find(&expired).Error; err != nil {
+		fmt.Printf("[Visitors] Failed to load expired snapshots: %v\n", err)
+		return
+	}
+	if len(expired) > 0 {
+		ids := make([]uint, len(expired))
+		for i, checkIn := range expired {
+			ids[i] = checkIn.ID
+		}
+		if err := r.db.Model(&models.VisitorCheckIn{}).Where("id IN ?", ids).
+			UpdateColumn("snapshot_path", "").Error; err != nil {
+			fmt.Printf("[Visitors] Failed to unlink expired snapshots: %v\n", err)
+			return
+		}
+		for _, checkIn := range expired {
+			if err := os.Remove(checkIn.SnapshotPath); err != nil && !os.IsNotExist(err) {
+				fmt.Printf("[Visitors] Failed to remove snapshot %s: %v\n", checkIn.SnapshotPath, err)
+			}
+		}
+		fmt.Printf("[Visitors] Deleted %d check-in snapshots older than %s\n", len(expired), cutoff.Format(time.RFC3339))
+	}
+
+	// Also files no check-in links to any more (e.g. left by a failed
+	// write), in the per-day directories before the cutoff
+	days, err := os.ReadDir(r.config.SnapshotDir)
+	if err != nil {
+		return
+	}
+	for _, day := range days {
+		date, err := time.Parse("2006-01-02", day.Name())
+		if err != nil || !day.IsDir() || !date.AddDate(0, 0, 1).Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(r.config.SnapshotDir, day.Name())); err != nil {
+			fmt.Printf("[Visitors] Failed to remove snapshot directory %s: %v\n", day.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/models"
+
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// Reasons a wall's layout changed, sent in WallMessage.Reason
+const (
+	WallReasonInitial = "initial" // Sent once when a client connects
+	WallReasonShift   = "shift"   // A shift boundary was crossed
+	WallReasonManual  = "manual"  // An operator picked a layout
+	WallReasonEdited  = "edited"  // The active layout itself was changed
+)
+
+const wallClientBuffer = 8
+
+// ErrPersonalLayout is returned for putting a personal layout on a wall;
+// walls are shared, so they only show shared layouts
+var ErrPersonalLayout = errors.New("personal layouts can't be shown on a wall")
+
+// WallMessage is pushed to wall clients whenever the active layout changes
+type WallMessage struct {
+	Type   string             `json:"type"` // layout
+	WallID uint               `json:"wall_id"`
+	Reason string             `json:"reason"`
+	Layout *models.WallLayout `json:"layout"` // nil when the wall has no layout yet
+	Shift  *models.WallShift  `json:"shift,omitempty"`
+}
+
+// WallService keeps the WebSocket clients of each video wall and switches
+// wall layouts at shift boundaries
+type WallService struct {
+	db      *gorm.DB
+	clients map[uint]map[*wallClient]struct{} // wall_id -> connected clients
+	mu      sync.RWMutex
+}
+
+type wallClient struct {
+	conn *websocket.Conn
+	send chan WallMessage
+}
+
+func NewWallService(db *gorm.DB) *WallService {
+	return &WallService{
+		db:      db,
+		clients: make(map[uint]map[*wallClient]struct{}),
+	}
+}
+
+// Start applies shifts now and then at every minute boundary, so a shift
+// starting at 07:00 switches the wall within a second of 07:00
+func (s *WallService) Start() {
+	go func() {
+		for {
+			s.applyShifts(time.Now())
+			now := time.Now()
+			time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		}
+	}()
+}
+
+// applyShifts activates the layout of a wall's shift when the shift starts,
+// i.e. it is the wall's shift now but wasn't a minute ago. In between the
+// wall is left alone, so a layout picked by hand lasts until the next shift
+// boundary. Walls without any layout get their current shift's right away.
+func (s *WallService) applyShifts(now time.Time) {
+	var shifts []models.WallShift
+	if err := s.db.Where("enabled = ?", true).Order("id").Find(&shifts).Error; err != nil {
+		fmt.Printf("[Wall] Failed to load shifts: %v\n", err)
+		return
+	}
+
+	active := currentShifts(shifts, now)
+	previous := currentShifts(shifts, now.Add(-time.Minute))
+	if len(active) == 0 {
+		return
+	}
+
+	wallIDs := make([]uint, 0, len(active))
+	for wallID := range active {
+		wallIDs = append(wallIDs, wallID)
+	}
+	var walls []models.Wall
+	if err := s.db.Where("id IN ?", wallIDs).Find(&walls).Error; err != nil {
+		fmt.Printf("[Wall] Failed to load walls: %v\n", err)
+		return
+	}
+
+	for i := range walls {
+		wall := &walls[i]
+		shift := active[wall.ID]
+		started := previous[wall.ID] == nil || previous[wall.ID].ID != shift.ID
+		if wall.ActiveLayoutID != nil && !started {
+			continue
+		}
+		if wall.ActiveShiftID != nil && *wall.ActiveShiftID == shift.ID &&
+			wall.ActiveLayoutID != nil && *wall.ActiveLayoutID == shift.LayoutID {
+			continue
+		}
+		fmt.Printf("[Wall] Shift %q starts on wall %q, switching to layout %d\n", shift.Name, wall.Name, shift.LayoutID)
+		if err := s.SetLayout(wall, shift.LayoutID, shift); err != nil {
+			fmt.Printf("[Wall] Failed to switch wall %d: %v\n", wall.ID, err)
+		}
+	}
+}
+
+// currentShifts returns each wall's shift at a time: the lowest ID of its
+// enabled shifts active then
+func currentShifts(shifts []models.WallShift, at time.Time) map[uint]*models.WallShift {
+	current := make(map[uint]*models.WallShift)
+	for i := range shifts {
+		shift := &shifts[i]
+		if _, taken := current[shift.WallID]; !taken && shift.ActiveAt(at) {
+			current[shift.WallID] = shift
+		}
+	}
+	return current
+}
+
+// SetLayout makes layoutID the wall's active layout and pushes it to the
+// wall's clients. shift is nil for manual switches.
+func (s *WallService) SetLayout(wall *models.Wall, layoutID uint, shift *models.WallShift) error {
+	var layout models.WallLayout
+	if err := s.db.First(&layout, layoutID).Error; err != nil {
+		return err
+	}
+	if layout.OwnerID != nil {
+		return ErrPersonalLayout
+	}
+
+	var shiftID *uint
+	reason := WallReasonManual
+	if shift != nil {
+		id := shift.ID
+		shiftID = &id
+		reason = WallReasonShift
+	}
+	if err := s.db.Model(wall).Updates(map[string]interface{}{
+		"active_layout_id": layout.ID,
+		"active_shift_id":  shiftID,
+	}).Error; err != nil {
+		return err
+	}
+	wall.ActiveLayoutID = &layout.ID
+	wall.ActiveShiftID = shiftID
+
+	s.Broadcast(WallMessage{
+		Type:   "layout",
+		WallID: wall.ID,
+		Reason: reason,
+		Layout: &layout,
+		Shift:  shift,
+	})
+	return nil
+}
+
+// CurrentMessage describes the wall's active layout (and shift, if any)
+func (s *WallService) CurrentMessage(wall *models.Wall, reason string) WallMessage {
+	msg := WallMessage{Type: "layout", WallID: wall.ID, Reason: reason}
+	if wall.ActiveLayoutID != nil {
+		var layout models.WallLayout
+		if err := s.db.First(&layout, *wall.ActiveLayoutID).Error; err == nil {
+			msg.Layout = &layout
+		}
+	}
+	if wall.ActiveShiftID != nil {
+		var shift models.WallShift
+		if err := s.db.First(&shift, *wall.ActiveShiftID).Error; err == nil {
+			msg.Shift = &shift
+		}
+	}
+	return msg
+}
+
+// LayoutChanged pushes an edited layout to the walls showing it
+func (s *WallService) LayoutChanged(layoutID uint) {
+	var walls []models.Wall
+	if err := s.db.Where("active_layout_id = ?", layoutID).Find(&walls).Error; err != nil {
+		fmt.Printf("[Wall] Failed to load walls showing layout %d: %v\n", layoutID, err)
+		return
+	}
+	for i := range walls {
+		s.Broadcast(s.CurrentMessage(&walls[i], WallReasonEdited))
+	}
+}
+
+// Broadcast sends a message to every client of the wall. Slow clients whose
+// buffer is full are dropped rather than holding up the others.
+func (s *WallService) Broadcast(msg WallMessage) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for client := range s.clients[msg.WallID] {
+		select {
+		case client.send <- msg:
+		default:
+			fmt.Printf("[Wall] Client of wall %d is not keeping up, disconnecting\n", msg.WallID)
+			client.conn.Close()
+		}
+	}
+}
+
+// HandleWebSocket serves one wall client until it disconnects. The client
+// gets the current layout right away and every change after that.
+func (s *WallService) HandleWebSocket(conn *websocket.Conn, wall *models.Wall) {
+	client := &wallClient{conn: conn, send: make(chan WallMessage, wallClientBuffer)}
+	client.send <- s.CurrentMessage(wall, WallReasonInitial)
+
+	s.mu.Lock()
+	if s.clients[wall.ID] == nil {
+		s.clients[wall.ID] = make(map[*wallClient]struct{})
+	}
+	s.clients[wall.ID][client] = struct{}{}
+	s.mu.Unlock()
+	fmt.Printf("[Wall] Client connected to wall %d\n", wall.ID)
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients[wall.ID], client)
+		if len(s.clients[wall.ID]) == 0 {
+			delete(s.clients, wall.ID)
+		}
+		s.mu.Unlock()
+		conn.Close()
+		fmt.Printf("[Wall] Client disconnected from wall %d\n", wall.ID)
+	}()
+
+	// Reads only detect the client going away; walls don't send anything
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-client.send:
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// ClientCount returns how many clients are connected to a wall
+func (s *WallService) ClientCount(wallID uint) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.clients[wallID])
+}
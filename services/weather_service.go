@@ -0,0 +1,200 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	weatherRetention = 93 * 24 * time.Hour // As far back as analytics exports go
+	// Daylight luminous efficacy: lux per W/m² of global solar radiation
+	luxPerWattPerSquareMeter = 120
+	fogVisibilityMeters      = 1000
+)
+
+// WeatherService fetches the weather of every site (camera area, located at
+// the average position of its cameras) from an Open-Meteo compatible API,
+// stores the observations for analytics and keeps the latest per site in
+// memory to tag events with.
+type WeatherService struct {
+	db         *gorm.DB
+	config     config.WeatherConfig
+	httpClient *http.Client
+	current    map[string]*models.WeatherObservation // area -> latest observation
+	areas      map[uint]string                       // camera_id -> area
+	mu         sync.RWMutex
+}
+
+func NewWeatherService(cfg config.WeatherConfig, db *gorm.DB) *WeatherService {
+	return &WeatherService{
+		db:         db,
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		current:    make(map[string]*models.WeatherObservation),
+		areas:      make(map[uint]string),
+	}
+}
+
+// Enabled reports whether a weather provider is configured
+func (s *WeatherService) Enabled() bool {
+	return s != nil && s.config.ProviderURL != "" && s.config.RefreshInterval > 0
+}
+
+// Start fetches the weather of every site every RefreshInterval
+func (s *WeatherService) Start() {
+	if !s.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			s.refresh()
+			s.prune()
+			<-ticker.C
+		}
+	}()
+}
+
+// ForCamera returns the current weather at a camera's site, nil when unknown
+// or older than two refreshes
+func (s *WeatherService) ForCamera(cameraID uint) *models.WeatherObservation {
+	if !s.Enabled() {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	observation, ok := s.current[s.areas[cameraID]]
+	if !ok || time.Since(observation.ObservedAt) > 2*s.config.RefreshInterval {
+		return nil
+	}
+	return observation
+}
+
+// Current returns the latest observation of every site
+func (s *WeatherService) Current() []models.WeatherObservation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	observations := make([]models.WeatherObservation, 0, len(s.current))
+	for _, observation := range s.current {
+		observations = append(observations, *observation)
+	}
+	return observations
+}
+
+type weatherSite struct {
+	Area      string
+	Latitude  float64
+	Longitude float64
+}
+
+func (s *WeatherService) refresh() {
+	var cameras []models.Camera
+	if err := s.db.Select("id", "area").Find(&cameras).Error; err != nil {
+		fmt.Printf("[Weather] Failed to load cameras: %v\n", err)
+		return
+	}
+	var sites []weatherSite
+	if err := s.db.Model(&models.Camera{}).
+		Select("area, AVG(latitude) AS latitude, AVG(longitude) AS longitude").
+		Group("area").Scan(&sites).Error; err != nil {
+		fmt.Printf("[Weather] Failed to load sites: %v\n", err)
+		return
+	}
+
+	areas := make(map[uint]string, len(cameras))
+	for _, camera := range cameras {
+		areas[camera.ID] = camera.Area
+	}
+	s.mu.Lock()
+	s.areas = areas
+	s.mu.Unlock()
+
+	for _, site := range sites {
+		observation, err := s.fetch(site)
+		if err != nil {
+			fmt.Printf("[Weather] Failed to fetch weather for %s: %v\n", site.Area, err)
+			continue
+		}
+		if err := s.db.Create(observation).Error; err != nil {
+			fmt.Printf("[Weather] Failed to store weather for %s: %v\n", site.Area, err)
+			continue
+		}
+		s.mu.Lock()
+		s.current[site.Area] = observation
+		s.mu.Unlock()
+	}
+}
+
+// openMeteoResponse is the part of an Open-Meteo forecast response we use
+type openMeteoResponse struct {
+	Current struct {
+		Time               string  `json:"time"` // UTC, e.g. 2024-03-01T14:15
+		Precipitation      float64 `json:"precipitation"`
+		WeatherCode        int     `json:"weather_code"`
+		CloudCover         int     `json:"cloud_cover"`
+		Visibility         float64 `json:"visibility"`
+		IsDay              int     `json:"is_day"`
+		ShortwaveRadiation float64 `json:"shortwave_radiation"`
+	} `json:"current"`
+}
+
+func (s *WeatherService) fetch(site weatherSite) (*models.WeatherObservation, error) {
+	query := url.Values{
+		"latitude":  {fmt.Sprintf("%.4f", site.Latitude)},
+		"longitude": {fmt.Sprintf("%.4f", site.Longitude)},
+		"current":   {"precipitation,weather_code,cloud_cover,visibility,is_day,shortwave_radiation"},
+		"timezone":  {"GMT"},
+	}
+	resp, err := s.httpClient.Get(s.config.ProviderURL + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("provider returned %s", resp.Status)
+	}
+
+	var body openMeteoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid provider response: %w", err)
+	}
+	current := body.Current
+	observedAt, err := time.Parse("2006-01-02T15:04", current.Time)
+	if err != nil {
+		observedAt = time.Now()
+	}
+
+	code := current.WeatherCode
+	return &models.WeatherObservation{
+		Area:             site.Area,
+		ObservedAt:       observedAt,
+		Rain:             (code >= 51 && code <= 67) || (code >= 80 && code <= 82) || code >= 95,
+		Fog:              code == 45 || code == 48 || (current.Visibility > 0 && current.Visibility < fogVisibilityMeters),
+		Snow:             (code >= 71 && code <= 77) || code == 85 || code == 86,
+		PrecipitationMM:  current.Precipitation,
+		VisibilityMeters: current.Visibility,
+		CloudCover:       current.CloudCover,
+		Lux:              current.ShortwaveRadiation * luxPerWattPerSquareMeter,
+		IsDay:            current.IsDay == 1,
+		WeatherCode:      code,
+	}, nil
+}
+
+// prune drops observations older than weatherRetention
+func (s *WeatherService) prune() {
+	if err := s.db.Where("observed_at < ?", time.Now().Add(-weatherRetention)).
+		Delete(&models.WeatherObservation{}).Error; err != nil {
+		fmt.Printf("[Weather] Failed to prune observations: %v\n", err)
+	}
+}
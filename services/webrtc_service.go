@@ -2,36 +2,87 @@ package services
 
 import (
 	"bufio"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v3"
 	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/h264reader"
+
+	"command-center-vms-cctv/be/config"
+	"command-center-vms-cctv/be/models"
+	"command-center-vms-cctv/be/tracing"
+)
+
+// WebRTC video codecs a stream can be delivered in
+const (
+	WebRTCCodecVP8  = "vp8"  // Transcoded by FFmpeg (libvpx)
+	WebRTCCodecH264 = "h264" // Camera's baseline H.264 forwarded as-is
 )
 
+// h264FmtpLines are the H.264 profiles passthrough can forward, by name;
+// the track of a stream advertises the camera's profile
+var h264FmtpLines = map[string]string{
+	"baseline": "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+	"main":     "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=4d001f",
+	"high":     "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=64001f",
+}
+
 type WebRTCService struct {
-	activeStreams map[uint]*WebRTCStream
-	mu            sync.RWMutex
-	api           *webrtc.API
+	activeStreams   map[uint]*WebRTCStream
+	mu              sync.RWMutex
+	api             *webrtc.API
+	h264Passthrough bool
+	h264Profiles    map[string]bool // Profiles forwarded for cameras on auto
+	usage           *UsageTracker
+	scheduler       *TranscodeScheduler
 }
 
 type WebRTCStream struct {
 	CameraID         uint
 	RTSPURL          string
+	Codec           string // WebRTCCodecVP8 or WebRTCCodecH264
+	Profile         string // H.264 profile forwarded: baseline, main or high
 	PeerConnections  map[string]*webrtc.PeerConnection
+	whepSessions    map[string]func() // WHEP session ID -> ends its view; the session's peer connection is in PeerConnections
 	VideoTrack       *webrtc.TrackLocalStaticSample
 	IsActive         bool
 	FFmpegCmd        *exec.Cmd
 	FFmpegStdin      io.WriteCloser
+	stderr          *ffmpegErrorWriter
+	keyframe        chan struct{} // Closed when the first keyframe reaches the track
+	keyframeOnce    sync.Once
+	slot            *TranscodeSlot  // FFmpeg slot held while the stream runs
+	trace           context.Context // Carries the span of the request that started the stream
+	firstKeyframe   *tracing.Span   // From FFmpeg start to the first keyframe
+	traceOnce       sync.Once
 	mu               sync.RWMutex
 }
 
+// keyframeReached signals viewers waiting for the first keyframe
+func (stream *WebRTCStream) keyframeReached() {
+	stream.keyframeOnce.Do(func() { close(stream.keyframe) })
+	stream.endFirstKeyframe(nil)
+}
+
+// endFirstKeyframe ends the first keyframe span, failed when FFmpeg exited
+// before producing one
+func (stream *WebRTCStream) endFirstKeyframe(err error) {
+	stream.traceOnce.Do(func() {
+		stream.firstKeyframe.RecordError(err)
+		stream.firstKeyframe.End()
+	})
+}
+
 type SignalingMessage struct {
 	Type      string          `json:"type"`      // "offer", "answer", "ice-candidate"
 	CameraID  uint            `json:"camera_id"`
@@ -39,8 +90,8 @@ type SignalingMessage struct {
 	Candidate json.RawMessage `json:"candidate,omitempty"`
 }
 
-func NewWebRTCService() *WebRTCService {
-	// Configure WebRTC API with VP8 codec for video
+func NewWebRTCService(cfg config.WebRTCConfig, usage *UsageTracker, scheduler *TranscodeScheduler) *WebRTCService {
+	// Configure WebRTC API with VP8 and H.264 codecs for video
 	mediaEngine := &webrtc.MediaEngine{}
 	
 	// Register VP8 codec for video
@@ -57,6 +108,26 @@ func NewWebRTCService() *WebRTCService {
 		panic(err)
 	}
 
+	// Register H.264 for cameras forwarded without re-encoding, one payload
+	// type per profile so viewers negotiate the one the camera sends
+	for _, h264 := range []struct {
+		profile     string
+		payloadType webrtc.PayloadType
+	}{{"baseline", 102}, {"main", 104}, {"high", 106}} {
+		if err := mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:     webrtc.MimeTypeH264,
+				ClockRate:    90000,
+				Channels:     0,
+				SDPFmtpLine:  h264FmtpLines[h264.profile],
+				RTCPFeedback: nil,
+			},
+			PayloadType: h264.payloadType,
+		}, webrtc.RTPCodecTypeVideo); err != nil {
+			panic(err)
+		}
+	}
+
 	// Register Opus codec for audio (optional)
 	if err := mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
 		RTPCodecCapability: webrtc.RTPCodecCapability{
@@ -73,29 +144,92 @@ func NewWebRTCService() *WebRTCService {
 
 	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine))
 
+	profiles := make(map[string]bool)
+	for _, profile := range cfg.H264Profiles {
+		profile = strings.ToLower(strings.TrimSpace(profile))
+		if _, known := h264FmtpLines[profile]; !known {
+			fmt.Printf("[WebRTC] Ignoring unknown H.264 profile %q in WEBRTC_H264_PROFILES\n", profile)
+			continue
+		}
+		profiles[profile] = true
+	}
+
 	return &WebRTCService{
-		activeStreams: make(map[uint]*WebRTCStream),
-		api:           api,
+		activeStreams:   make(map[uint]*WebRTCStream),
+		api:             api,
+		h264Passthrough: cfg.H264Passthrough,
+		h264Profiles:    profiles,
+		usage:           usage,
+		scheduler:       scheduler,
 	}
 }
 
-// StartStream starts RTSP to WebRTC conversion for a camera
-func (s *WebRTCService) StartStream(cameraID uint, rtspURL string) error {
+// StartStream starts RTSP to WebRTC conversion for a camera. priority is the
+// camera's rank (models.Camera.PriorityRank) used when FFmpeg slots run out;
+// ErrTranscodeCapacity is returned if no lower-priority stream can be preempted.
+// preference is the camera's models.Camera.WebRTCCodec.
+func (s *WebRTCService) StartStream(cameraID uint, rtspURL string, priority int, preference string) error {
+	return s.StartStreamContext(context.Background(), cameraID, rtspURL, priority, preference)
+}
+
+// StartStreamContext is StartStream recording its steps, up to the first
+// keyframe, in the trace of ctx
+func (s *WebRTCService) StartStreamContext(ctx context.Context, cameraID uint, rtspURL string, priority int, preference string) (err error) {
+	ctx, span := tracing.Start(ctx, "webrtc.start_stream")
+	span.SetAttribute("camera.id", cameraID)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	s.mu.RLock()
+	existing, exists := s.activeStreams[cameraID]
+	s.mu.RUnlock()
+	if exists && existing.IsActive {
+		span.SetAttribute("webrtc.running", true)
+		return nil
+	}
+
+	// Probe outside the lock; it can take a few seconds on a slow camera
+	codec, profile := s.selectCodec(ctx, cameraID, rtspURL, preference)
+	span.SetAttribute("webrtc.codec", codec)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// Check if stream already exists
 	if stream, exists := s.activeStreams[cameraID]; exists && stream.IsActive {
+		span.SetAttribute("webrtc.running", true)
 		return nil
 	}
 
 	stream := &WebRTCStream{
 		CameraID:        cameraID,
 		RTSPURL:         rtspURL,
+		Codec:           codec,
+		Profile:         profile,
 		PeerConnections: make(map[string]*webrtc.PeerConnection),
 		IsActive:        false,
+		stderr:          newFFmpegErrorWriter(cameraID, PipelineWebRTC),
+		keyframe:        make(chan struct{}),
+		trace:           ctx,
 	}
 
+	_, acquireSpan := tracing.Start(ctx, "transcode.acquire")
+	slot, err := s.scheduler.Acquire(cameraID, PipelineWebRTC, priority, func() int {
+		stream.mu.RLock()
+		defer stream.mu.RUnlock()
+		return len(stream.PeerConnections)
+	}, func() {
+		s.stopPreempted(stream)
+	})
+	acquireSpan.RecordError(err)
+	acquireSpan.End()
+	if err != nil {
+		return err
+	}
+	stream.slot = slot
+
 	s.activeStreams[cameraID] = stream
 
 	// Start RTSP to WebRTC conversion
@@ -104,13 +238,56 @@ func (s *WebRTCService) StartStream(cameraID uint, rtspURL string) error {
 	return nil
 }
 
+// selectCodec picks H.264 passthrough when the camera already sends H.264
+// the viewers can decode, and the VP8 transcode otherwise. On auto that is
+// a profile in WEBRTC_H264_PROFILES; a camera set to h264 is forwarded
+// whatever its profile. Returns the codec and the H.264 profile forwarded.
+func (s *WebRTCService) selectCodec(ctx context.Context, cameraID uint, rtspURL, preference string) (string, string) {
+	if !s.h264Passthrough || preference == models.WebRTCCodecVP8 {
+		return WebRTCCodecVP8, ""
+	}
+
+	_, span := tracing.StartClient(ctx, "rtsp.probe")
+	probe, probeErr := ProbeRTSP(rtspURL, 5*time.Second)
+	if probeErr != nil {
+		span.RecordError(errors.New(probeErr.Message))
+	} else {
+		span.SetAttribute("rtsp.video_codecs", strings.Join(probe.VideoCodecs, ","))
+	}
+	span.End()
+	if probeErr != nil {
+		// FFmpeg will surface the same failure; VP8 handles any input codec
+		return WebRTCCodecVP8, ""
+	}
+	profile := probe.H264ProfileName()
+	if _, forwardable := h264FmtpLines[profile]; forwardable && (preference == models.WebRTCCodecH264 || s.h264Profiles[profile]) {
+		return WebRTCCodecH264, profile
+	}
+	fmt.Printf("[WebRTC] Camera %d sends %v (profile %q), transcoding to VP8\n", cameraID, probe.VideoCodecs, probe.H264Profile)
+	return WebRTCCodecVP8, ""
+}
+
 // convertRTSPToWebRTC converts RTSP stream to WebRTC using FFmpeg
 // FFmpeg decodes RTSP, encodes to VP8, and outputs to stdout (in-memory, no disk storage)
-// We read VP8 frames from stdout and send directly to WebRTC track
+// We read VP8 frames from stdout and send directly to WebRTC track.
+// For H.264 passthrough FFmpeg only remuxes to an Annex-B elementary stream and
+// pion repackages the NAL units into RTP.
 func (s *WebRTCService) convertRTSPToWebRTC(stream *WebRTCStream) {
+	started := false
+	defer func() {
+		if !started {
+			stream.slot.Release()
+		}
+	}()
+
+	capability := webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}
+	if stream.Codec == WebRTCCodecH264 {
+		capability = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, SDPFmtpLine: h264FmtpLines[stream.Profile]}
+	}
+
 	// Create video track
 	videoTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8},
+		capability,
 		"video",
 		fmt.Sprintf("camera_%d", stream.CameraID),
 	)
@@ -127,24 +304,38 @@ func (s *WebRTCService) convertRTSPToWebRTC(stream *WebRTCStream) {
 	// Output to stdout (in-memory, no file storage)
 	// Using VP8 codec for WebRTC compatibility
 	// Note: If libvpx is not available, FFmpeg will error and we'll handle it
-	cmd := exec.Command("ffmpeg",
-		"-rtsp_transport", "tcp",        // Use TCP for better reliability
-		"-i", stream.RTSPURL,            // RTSP input
-		"-c:v", "libvpx",                // VP8 video codec (WebRTC compatible)
-		"-deadline", "realtime",         // Real-time encoding
-		"-cpu-used", "8",                // Fast encoding (0-8, 8 is fastest)
-		"-b:v", "1M",                    // Video bitrate
-		"-maxrate", "1M",                // Max bitrate
-		"-bufsize", "2M",                // Buffer size
-		"-g", "30",                       // GOP size (keyframe interval)
-		"-keyint_min", "30",             // Minimum keyframe interval
-		"-f", "ivf",                     // IVF format (VP8 container, easy to parse)
-		"-",                             // Output to stdout (in-memory)
-		"-loglevel", "warning",          // Show warnings and errors for debugging
-	)
+	var cmd *exec.Cmd
+	if stream.Codec == WebRTCCodecH264 {
+		cmd = FFmpegCommand(
+			"-loglevel", "warning",
+			"-rtsp_transport", "tcp",
+			"-i", stream.RTSPURL,
+			"-an",          // Video only
+			"-c:v", "copy", // No re-encoding
+			"-bsf:v", "h264_mp4toannexb", // Start codes, SPS/PPS before each IDR
+			"-f", "h264", // Raw Annex-B elementary stream
+			"-",
+		)
+	} else {
+		cmd = FFmpegCommand(
+			"-rtsp_transport", "tcp", // Use TCP for better reliability
+			"-i", stream.RTSPURL, // RTSP input
+			"-c:v", "libvpx", // VP8 video codec (WebRTC compatible)
+			"-deadline", "realtime", // Real-time encoding
+			"-cpu-used", "8", // Fast encoding (0-8, 8 is fastest)
+			"-b:v", "1M", // Video bitrate
+			"-maxrate", "1M", // Max bitrate
+			"-bufsize", "2M", // Buffer size
+			"-g", "30", // GOP size (keyframe interval)
+			"-keyint_min", "30", // Minimum keyframe interval
+			"-f", "ivf", // IVF format (VP8 container, easy to parse)
+			"-",                    // Output to stdout (in-memory)
+			"-loglevel", "warning", // Show warnings and errors for debugging
+		)
+	}
 	
-	// Capture stderr for error messages
-	cmd.Stderr = os.Stderr
+	// Capture stderr for error messages (also classified for the health API)
+	cmd.Stderr = stream.stderr
 
 	// Get stdout pipe
 	stdout, err := cmd.StdoutPipe()
@@ -166,42 +357,60 @@ func (s *WebRTCService) convertRTSPToWebRTC(stream *WebRTCStream) {
 	stream.mu.Unlock()
 
 	// Start FFmpeg
+	_, startSpan := tracing.Start(stream.trace, "ffmpeg.start")
+	startSpan.SetAttribute("ffmpeg.pipeline", PipelineWebRTC)
 	if err := cmd.Start(); err != nil {
 		fmt.Printf("[WebRTC] Error starting FFmpeg for camera %d: %v\n", stream.CameraID, err)
+		startSpan.RecordError(err)
+		startSpan.End()
 		stream.mu.Lock()
 		stream.IsActive = false
 		stream.mu.Unlock()
 		return
 	}
+	startSpan.SetAttribute("process.pid", cmd.Process.Pid)
+	startSpan.End()
+	_, stream.firstKeyframe = tracing.Start(stream.trace, "ffmpeg.first_keyframe")
 
-	fmt.Printf("[WebRTC] Stream started for camera %d (RTSP: %s)\n", stream.CameraID, stream.RTSPURL)
+	fmt.Printf("[WebRTC] Stream started for camera %d (RTSP: %s, codec: %s)\n", stream.CameraID, StripURLCredentials(stream.RTSPURL), stream.Codec)
 	fmt.Printf("[WebRTC] FFmpeg PID: %d\n", cmd.Process.Pid)
 
 	stream.mu.Lock()
 	stream.IsActive = true
 	stream.mu.Unlock()
+	started = true
 
-	// Read VP8 frames from FFmpeg stdout and send to WebRTC track
-	go s.readAndSendVP8Frames(stdout, videoTrack, stream.CameraID)
+	s.usage.TrackProcess(stream.CameraID, PipelineWebRTC, cmd)
+	output := s.usage.CountingReader(stream.CameraID, PipelineWebRTC, stdout)
+
+	// Read frames from FFmpeg stdout and send to WebRTC track
+	if stream.Codec == WebRTCCodecH264 {
+		go s.readAndSendH264(output, videoTrack, stream)
+	} else {
+		go s.readAndSendVP8Frames(output, videoTrack, stream)
+	}
 
 	// Wait for FFmpeg to finish (or error)
 	go func() {
 		if err := cmd.Wait(); err != nil {
 			fmt.Printf("FFmpeg process ended for camera %d: %v\n", stream.CameraID, err)
 		}
+		stream.endFirstKeyframe(errors.New("FFmpeg exited before the first keyframe"))
 		
 		// Mark stream as inactive
 		stream.mu.Lock()
 		stream.IsActive = false
 		stream.mu.Unlock()
+		stream.slot.Release()
 	}()
 }
 
 // readAndSendVP8Frames reads VP8 frames from FFmpeg stdout and sends to WebRTC track
 // IVF format structure:
-// - 32 bytes header
-// - Frame: 4 bytes size + frame data
-func (s *WebRTCService) readAndSendVP8Frames(stdout io.Reader, track *webrtc.TrackLocalStaticSample, cameraID uint) {
+// - 32 bytes header (bytes 16-23: timebase denominator/numerator)
+// - Frame: 4 bytes size + 8 bytes timestamp + frame data
+func (s *WebRTCService) readAndSendVP8Frames(stdout io.Reader, track *webrtc.TrackLocalStaticSample, stream *WebRTCStream) {
+	cameraID := stream.CameraID
 	reader := bufio.NewReader(stdout)
 	
 	// Read IVF header (32 bytes)
@@ -217,27 +426,36 @@ func (s *WebRTCService) readAndSendVP8Frames(stdout io.Reader, track *webrtc.Tra
 		return
 	}
 
-	fmt.Printf("[WebRTC] Reading VP8 frames for camera %d...\n", cameraID)
+	// FFmpeg writes the encoder timebase (1/fps for libvpx) into the header,
+	// so 25fps cameras get 40ms frames instead of drifting against 30fps
+	timebase := ivfTimebase(header)
+	nominalDuration := timebase
+	if nominalDuration < time.Millisecond {
+		// Timebase is a clock (e.g. 1/90000), not a frame rate
+		nominalDuration = time.Second / 30
+	}
+	frameDuration := nominalDuration
+	fmt.Printf("[WebRTC] Reading VP8 frames for camera %d (timebase %v)...\n", cameraID, timebase)
 	
-	// Frame timing for 30 FPS (33.33ms per frame)
-	frameDuration := time.Duration(33_333_333) // 33.33ms in nanoseconds
 	lastFrameTime := time.Now()
+	var lastPTS uint64
+	havePTS := false
 
 	// Read frames continuously
+	frameHeader := make([]byte, 12)
 	for {
-		// Read frame size (4 bytes, little-endian)
-		sizeBytes := make([]byte, 4)
-		if _, err := io.ReadFull(reader, sizeBytes); err != nil {
+		// Read frame header (4 bytes size + 8 bytes timestamp, little-endian)
+		if _, err := io.ReadFull(reader, frameHeader); err != nil {
 			if err == io.EOF {
 				fmt.Printf("FFmpeg stdout closed for camera %d\n", cameraID)
 				break
 			}
-			fmt.Printf("Error reading frame size for camera %d: %v\n", cameraID, err)
+			fmt.Printf("Error reading frame header for camera %d: %v\n", cameraID, err)
 			break
 		}
 
-		// Parse frame size (little-endian uint32)
-		frameSize := uint32(sizeBytes[0]) | uint32(sizeBytes[1])<<8 | uint32(sizeBytes[2])<<16 | uint32(sizeBytes[3])<<24
+		frameSize := binary.LittleEndian.Uint32(frameHeader[0:4])
+		pts := binary.LittleEndian.Uint64(frameHeader[4:12])
 		
 		if frameSize == 0 {
 			fmt.Printf("Zero frame size for camera %d, skipping\n", cameraID)
@@ -255,6 +473,16 @@ func (s *WebRTCService) readAndSendVP8Frames(stdout io.Reader, track *webrtc.Tra
 			break
 		}
 
+		// Duration comes from the timestamp delta, which also covers
+		// variable frame rate cameras; fall back to the nominal rate otherwise
+		if havePTS && pts > lastPTS && time.Duration(pts-lastPTS)*timebase <= time.Second {
+			frameDuration = time.Duration(pts-lastPTS) * timebase
+		} else {
+			frameDuration = nominalDuration
+		}
+		lastPTS = pts
+		havePTS = true
+
 		// Calculate timing for this frame
 		now := time.Now()
 		elapsed := now.Sub(lastFrameTime)
@@ -273,17 +501,102 @@ func (s *WebRTCService) readAndSendVP8Frames(stdout io.Reader, track *webrtc.Tra
 			// Continue reading even if write fails (might be no peer connections yet)
 		}
 
+		// VP8 frame tag: lowest bit of the first byte is 0 for keyframes
+		if frameData[0]&0x01 == 0 {
+			stream.keyframeReached()
+		}
+
 		lastFrameTime = time.Now()
 	}
 
 	fmt.Printf("Stopped reading VP8 frames for camera %d\n", cameraID)
 }
 
+// ivfTimebase returns the duration of one timestamp tick from an IVF header,
+// defaulting to 30fps when the header doesn't carry a usable value
+func ivfTimebase(header []byte) time.Duration {
+	denominator := binary.LittleEndian.Uint32(header[16:20])
+	numerator := binary.LittleEndian.Uint32(header[20:24])
+	if denominator == 0 || numerator == 0 {
+		return time.Second / 30
+	}
+	tick := time.Duration(uint64(time.Second) * uint64(numerator) / uint64(denominator))
+	if tick <= 0 || tick > time.Second {
+		return time.Second / 30
+	}
+	return tick
+}
+
+// readAndSendH264 reads Annex-B NAL units from FFmpeg stdout and writes one
+// sample per access unit. Parameter sets and SEI are held back and sent in
+// front of the next slice so each sample carries a complete frame; the H.264
+// payloader splits it into RTP packets (FU-A / STAP-A).
+func (s *WebRTCService) readAndSendH264(stdout io.Reader, track *webrtc.TrackLocalStaticSample, stream *WebRTCStream) {
+	cameraID := stream.CameraID
+	reader, err := h264reader.NewReader(stdout)
+	if err != nil {
+		fmt.Printf("Error creating H.264 reader for camera %d: %v\n", cameraID, err)
+		return
+	}
+
+	fmt.Printf("[WebRTC] Forwarding H.264 for camera %d...\n", cameraID)
+
+	// Source is live, so FFmpeg already delivers frames in real time; use the
+	// wall clock between frames as the sample duration
+	annexBStartCode := []byte{0x00, 0x00, 0x00, 0x01}
+	var pending []byte
+	lastFrameTime := time.Now()
+
+	for {
+		nal, err := reader.NextNAL()
+		if err != nil {
+			if err == io.EOF {
+				fmt.Printf("FFmpeg stdout closed for camera %d\n", cameraID)
+			} else {
+				fmt.Printf("Error reading H.264 NAL for camera %d: %v\n", cameraID, err)
+			}
+			break
+		}
+
+		switch nal.UnitType {
+		case h264reader.NalUnitTypeAUD:
+			continue
+		case h264reader.NalUnitTypeCodedSliceNonIdr, h264reader.NalUnitTypeCodedSliceIdr:
+		default:
+			// SPS, PPS, SEI: send together with the slice that follows
+			pending = append(pending, annexBStartCode...)
+			pending = append(pending, nal.Data...)
+			continue
+		}
+
+		sample := append(pending, annexBStartCode...)
+		sample = append(sample, nal.Data...)
+		pending = nil
+
+		now := time.Now()
+		duration := now.Sub(lastFrameTime)
+		lastFrameTime = now
+
+		if err := track.WriteSample(media.Sample{
+			Data:     sample,
+			Duration: duration,
+		}); err != nil {
+			fmt.Printf("Error writing sample to track for camera %d: %v\n", cameraID, err)
+		}
+
+		if nal.UnitType == h264reader.NalUnitTypeCodedSliceIdr {
+			stream.keyframeReached()
+		}
+	}
+
+	fmt.Printf("Stopped forwarding H.264 for camera %d\n", cameraID)
+}
+
 // Note: readRTPPackets function removed - not needed in simplified implementation
 // Full RTSP to WebRTC conversion requires complex RTP packet parsing
 
 // HandleWebSocket handles WebSocket connection for WebRTC signaling
-func (s *WebRTCService) HandleWebSocket(conn *websocket.Conn, cameraID uint) {
+func (s *WebRTCService) HandleWebSocket(conn *websocket.Conn, cameraID uint) (bytesSent int64) {
 	defer conn.Close()
 
 	stream, exists := s.activeStreams[cameraID]
@@ -306,16 +619,16 @@ func (s *WebRTCService) HandleWebSocket(conn *websocket.Conn, cameraID uint) {
 	}
 
 	// Create peer connection
-	peerConnection, err := s.api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
-		},
-	})
+	peerConnection, err := s.newPeerConnection()
 	if err != nil {
 		conn.WriteJSON(map[string]string{"error": fmt.Sprintf("Failed to create peer connection: %v", err)})
 		return
 	}
 	defer peerConnection.Close()
+	defer func() {
+		// Read before the deferred Close tears the transport down
+		bytesSent = peerBytesSent(peerConnection)
+	}()
 
 	// Store peer connection
 	connID := fmt.Sprintf("%p", conn)
@@ -415,6 +728,7 @@ func (s *WebRTCService) HandleWebSocket(conn *websocket.Conn, cameraID uint) {
 			}
 		}
 	}
+	return
 }
 
 // StopStream stops WebRTC stream for a camera
@@ -446,10 +760,23 @@ func (s *WebRTCService) StopStream(cameraID uint) error {
 	}
 	stream.mu.Unlock()
 
+	stream.slot.Release()
 	delete(s.activeStreams, cameraID)
 	return nil
 }
 
+// stopPreempted stops a stream whose FFmpeg slot was given to a higher-priority
+// camera, unless it has already been replaced by a newer stream
+func (s *WebRTCService) stopPreempted(stream *WebRTCStream) {
+	s.mu.RLock()
+	current := s.activeStreams[stream.CameraID]
+	s.mu.RUnlock()
+	if current != stream {
+		return
+	}
+	s.StopStream(stream.CameraID)
+}
+
 // GetStreamStatus returns the status of a stream
 func (s *WebRTCService) GetStreamStatus(cameraID uint) (bool, error) {
 	s.mu.RLock()
@@ -465,3 +792,72 @@ func (s *WebRTCService) GetStreamStatus(cameraID uint) (bool, error) {
 	return stream.IsActive, nil
 }
 
+// GetViewerCount returns how many peer connections play a camera's stream
+func (s *WebRTCService) GetViewerCount(cameraID uint) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stream, exists := s.activeStreams[cameraID]
+	if !exists {
+		return 0
+	}
+	stream.mu.RLock()
+	defer stream.mu.RUnlock()
+	return len(stream.PeerConnections)
+}
+
+// GetStreamCodec returns the codec a stream is delivered in ("" if not started)
+func (s *WebRTCService) GetStreamCodec(cameraID uint) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stream, exists := s.activeStreams[cameraID]
+	if !exists {
+		return ""
+	}
+	return stream.Codec
+}
+
+// GetAllStreamStatus returns whether each known stream is active, by camera ID
+func (s *WebRTCService) GetAllStreamStatus() map[uint]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := make(map[uint]bool, len(s.activeStreams))
+	for cameraID, stream := range s.activeStreams {
+		stream.mu.RLock()
+		status[cameraID] = stream.IsActive
+		stream.mu.RUnlock()
+	}
+	return status
+}
+
+// GetStreamError returns the last classified FFmpeg error for a stream
+func (s *WebRTCService) GetStreamError(cameraID uint) *StreamError {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stream, exists := s.activeStreams[cameraID]
+	if !exists {
+		return nil
+	}
+	return stream.stderr.LastError()
+}
+
+// WaitForKeyframe blocks until the stream has produced its first keyframe
+// (viewers can start decoding) or the timeout expires
+func (s *WebRTCService) WaitForKeyframe(cameraID uint, timeout time.Duration) bool {
+	s.mu.RLock()
+	stream, exists := s.activeStreams[cameraID]
+	s.mu.RUnlock()
+	if !exists {
+		return false
+	}
+
+	select {
+	case <-stream.keyframe:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// whepGatherTimeout bounds ICE gathering before the answer is sent; WHEP
+// answers carry all candidates since there is no trickle
+const whepGatherTimeout = 5 * time.Second
+
+var (
+	ErrStreamNotReady      = errors.New("stream is not ready")
+	ErrWHEPSessionNotFound = errors.New("WHEP session not found")
+)
+
+// AnswerWHEP answers a WHEP offer (RFC 9725) with a peer connection playing
+// the camera's running stream and returns the session ID the viewer uses to
+// end it. onClose is called once with the bytes sent when the session ends,
+// whether the viewer deleted it, the connection failed or the stream stopped.
+func (s *WebRTCService) AnswerWHEP(cameraID uint, offer string, onClose func(bytesSent int64)) (string, string, error) {
+	s.mu.RLock()
+	stream, exists := s.activeStreams[cameraID]
+	s.mu.RUnlock()
+	if !exists {
+		return "", "", ErrStreamNotReady
+	}
+
+	// Same grace as the WebSocket signaling for a stream that just started
+	var videoTrack *webrtc.TrackLocalStaticSample
+	for i := 0; i < 10; i++ {
+		stream.mu.RLock()
+		isActive := stream.IsActive
+		videoTrack = stream.VideoTrack
+		stream.mu.RUnlock()
+
+		if isActive && videoTrack != nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if videoTrack == nil {
+		return "", "", ErrStreamNotReady
+	}
+
+	peerConnection, err := s.newPeerConnection()
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := peerConnection.AddTrack(videoTrack); err != nil {
+		peerConnection.Close()
+		return "", "", err
+	}
+	if err := peerConnection.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		peerConnection.Close()
+		return "", "", fmt.Errorf("invalid offer: %w", err)
+	}
+	answer, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		peerConnection.Close()
+		return "", "", fmt.Errorf("invalid offer: %w", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(answer); err != nil {
+		peerConnection.Close()
+		return "", "", err
+	}
+	select {
+	case <-gathered:
+	case <-time.After(whepGatherTimeout):
+		fmt.Printf("[WebRTC] ICE gathering for camera %d timed out, answering with the candidates so far\n", cameraID)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		peerConnection.Close()
+		return "", "", err
+	}
+	sessionID := hex.EncodeToString(buf)
+
+	var closeOnce sync.Once
+	closed := func() {
+		closeOnce.Do(func() {
+			stream.mu.Lock()
+			delete(stream.PeerConnections, sessionID)
+			delete(stream.whepSessions, sessionID)
+			stream.mu.Unlock()
+			if onClose != nil {
+				onClose(peerBytesSent(peerConnection))
+			}
+		})
+	}
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		fmt.Printf("[WebRTC] Camera %d WHEP session %s: %s\n", cameraID, sessionID, state.String())
+		switch state {
+		case webrtc.PeerConnectionStateFailed:
+			closed()
+			peerConnection.Close()
+		case webrtc.PeerConnectionStateClosed:
+			closed()
+		}
+	})
+
+	stream.mu.Lock()
+	stream.PeerConnections[sessionID] = peerConnection
+	if stream.whepSessions == nil {
+		stream.whepSessions = make(map[string]func())
+	}
+	stream.whepSessions[sessionID] = closed
+	stream.mu.Unlock()
+
+	return sessionID, peerConnection.LocalDescription().SDP, nil
+}
+
+// CloseWHEP ends a WHEP session of a camera
+func (s *WebRTCService) CloseWHEP(cameraID uint, sessionID string) error {
+	s.mu.RLock()
+	stream, exists := s.activeStreams[cameraID]
+	s.mu.RUnlock()
+	if !exists {
+		return ErrWHEPSessionNotFound
+	}
+
+	stream.mu.RLock()
+	peerConnection := stream.PeerConnections[sessionID]
+	closed, exists := stream.whepSessions[sessionID]
+	stream.mu.RUnlock()
+	if !exists {
+		return ErrWHEPSessionNotFound
+	}
+	// Ends the view while the transport stats can still be read
+	closed()
+	return peerConnection.Close()
+}
+
+func (s *WebRTCService) newPeerConnection() (*webrtc.PeerConnection, error) {
+	return s.api.NewPeerConnection(webrtc.Configuration{
+		ICEServers: []webrtc.ICEServer{
+			{URLs: []string{"stun:stun.l.google.com:19302"}},
+		},
+	})
+}
+
+// peerBytesSent returns what a peer connection has sent so far; read it
+// before the connection is torn down
+func peerBytesSent(peerConnection *webrtc.PeerConnection) int64 {
+	var bytesSent int64
+	for _, stat := range peerConnection.GetStats() {
+		if transport, ok := stat.(webrtc.TransportStats); ok {
+			bytesSent += int64(transport.BytesSent)
+		}
+	}
+	return bytesSent
+}
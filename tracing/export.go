@@ -0,0 +1,212 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+const (
+	exportInterval  = 5 * time.Second
+	exportBatchSize = 512
+	exportQueueSize = 4096 // Spans beyond this are dropped while the collector is slow or down
+	exportTimeout   = 10 * time.Second
+)
+
+// exporter sends finished spans to an OTLP/HTTP collector as JSON, in
+// batches every exportInterval
+type exporter struct {
+	url      string
+	headers  map[string]string
+	resource []otlpAttribute
+	client   *http.Client
+	queue    chan *Span
+	dropped  atomic.Int64
+}
+
+// OTLP/HTTP JSON encoding of ExportTraceServiceRequest
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"` // Hex, not base64, in OTLP JSON
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 0 unset, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func newExporter(cfg config.TracingConfig, resource map[string]interface{}) *exporter {
+	url := strings.TrimRight(cfg.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &exporter{
+		url:      url,
+		headers:  cfg.Headers,
+		resource: attributes(resource),
+		client:   &http.Client{Timeout: exportTimeout},
+		queue:    make(chan *Span, exportQueueSize),
+	}
+}
+
+// add queues a finished span without blocking the traced work
+func (e *exporter) add(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) < exportBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := e.export(batch); err != nil {
+			fmt.Printf("[Tracing] Failed to export %d spans: %v\n", len(batch), err)
+		}
+		if dropped := e.dropped.Swap(0); dropped > 0 {
+			fmt.Printf("[Tracing] Dropped %d spans, the export queue was full\n", dropped)
+		}
+		batch = nil
+	}
+}
+
+func (e *exporter) export(batch []*Span) error {
+	spans := make([]otlpSpan, len(batch))
+	for i, span := range batch {
+		spans[i] = span.otlp()
+	}
+	scope := otlpScopeSpans{Spans: spans}
+	scope.Scope.Name = "command-center-vms-cctv/be"
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: e.resource},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        attributes(s.attrs),
+	}
+	if !isZero(s.parentID[:]) {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != "" {
+		span.Status = otlpStatus{Code: 2, Message: s.err}
+	}
+	return span
+}
+
+// attributes encodes values as OTLP AnyValues; integers are strings in
+// OTLP JSON
+func attributes(values map[string]interface{}) []otlpAttribute {
+	list := make([]otlpAttribute, 0, len(values))
+	for key, value := range values {
+		var encoded map[string]interface{}
+		switch v := value.(type) {
+		case string:
+			encoded = map[string]interface{}{"stringValue": v}
+		case bool:
+			encoded = map[string]interface{}{"boolValue": v}
+		case int:
+			encoded = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			encoded = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case uint:
+			encoded = map[string]interface{}{"intValue": strconv.FormatUint(uint64(v), 10)}
+		case float64:
+			encoded = map[string]interface{}{"doubleValue": v}
+		case time.Duration:
+			encoded = map[string]interface{}{"stringValue": v.String()}
+		default:
+			encoded = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		list = append(list, otlpAttribute{Key: key, Value: encoded})
+	}
+	return list
+}
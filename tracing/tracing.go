@@ -0,0 +1,252 @@
+// Package tracing records OpenTelemetry spans and exports them over
+// OTLP/HTTP, so a slow request can be followed through the handler, its
+// queries, MediaMTX calls, RTSP probes and FFmpeg starts in Jaeger or Tempo.
+// A trace starts at an HTTP request (StartServer); work outside one, e.g.
+// background workers, isn't traced. The exporter is a small OTLP/HTTP JSON
+// one because the OpenTelemetry SDK isn't among the module's dependencies;
+// the span API here mirrors it so it can be swapped in.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"command-center-vms-cctv/be/config"
+)
+
+// Span kinds, as numbered by OTLP
+const (
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+)
+
+// active is the exporter set by Configure, nil while tracing is off
+var active = struct {
+	exporter *exporter
+	ratio    float64
+	mu       sync.RWMutex
+}{}
+
+// Configure starts exporting spans to the OTLP endpoint; without one every
+// Start returns a nil span, whose methods do nothing
+func Configure(cfg config.TracingConfig, instanceID string) {
+	if cfg.Endpoint == "" {
+		return
+	}
+	ratio := cfg.SampleRatio
+	if ratio < 0 || ratio > 1 {
+		fmt.Printf("[Tracing] Ignoring OTEL_TRACES_SAMPLER_ARG=%v, must be 0-1\n", ratio)
+		ratio = 1
+	}
+	hostname, _ := os.Hostname()
+	exporter := newExporter(cfg, map[string]interface{}{
+		"service.name":        cfg.ServiceName,
+		"service.instance.id": instanceID,
+		"host.name":           hostname,
+	})
+	go exporter.run()
+
+	active.mu.Lock()
+	active.exporter = exporter
+	active.ratio = ratio
+	active.mu.Unlock()
+	fmt.Printf("[Tracing] Exporting %.0f%% of traces to %s\n", ratio*100, exporter.url)
+}
+
+// Span is one timed operation of a trace. A nil *Span is valid and records
+// nothing.
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	name  string
+	end   time.Time
+	attrs map[string]interface{}
+	err   string
+}
+
+type spanKey struct{}
+
+// FromContext returns the span a context carries, nil when none
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start begins a span for work done in-process, as a child of the span in
+// ctx. Returns ctx unchanged and a nil span when ctx isn't traced.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return startChild(ctx, name, kindInternal)
+}
+
+// StartClient begins a span for a call to another system, e.g. a query or
+// a MediaMTX API request
+func StartClient(ctx context.Context, name string) (context.Context, *Span) {
+	return startChild(ctx, name, kindClient)
+}
+
+// StartServer begins the span of an incoming request, continuing the trace
+// of a W3C traceparent header when there is one. Whether the trace is
+// sampled is decided on its trace ID, never on the header's sampled flag:
+// clients could otherwise force every request of theirs to be exported.
+func StartServer(ctx context.Context, name, traceparent string) (context.Context, *Span) {
+	active.mu.RLock()
+	exporter, ratio := active.exporter, active.ratio
+	active.mu.RUnlock()
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	span := &Span{name: name, kind: kindServer, start: time.Now()}
+	if !parseTraceparent(traceparent, span) {
+		rand.Read(span.traceID[:])
+	}
+	// Decided on the trace ID, so every node forwarding it agrees
+	span.sampled = float64(binary.BigEndian.Uint64(span.traceID[8:]))/float64(^uint64(0)) < ratio
+	rand.Read(span.spanID[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func startChild(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		traceID:  parent.traceID,
+		parentID: parent.spanID,
+		sampled:  parent.sampled,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+	}
+	rand.Read(span.spanID[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// parseTraceparent reads the trace and parent IDs of
+// "00-<trace id>-<parent id>-<flags>" into span; the flags are checked but
+// not used
+func parseTraceparent(header string, span *Span) bool {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return false
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || isZero(traceID) {
+		return false
+	}
+	parentID, err := hex.DecodeString(parts[2])
+	if err != nil || isZero(parentID) {
+		return false
+	}
+	if _, err := hex.DecodeString(parts[3]); err != nil {
+		return false
+	}
+	copy(span.traceID[:], traceID)
+	copy(span.parentID[:], parentID)
+	return true
+}
+
+func isZero(id []byte) bool {
+	for _, b := range id {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TraceID is the hex trace ID, to look the trace up in Jaeger or Tempo
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// Traceparent is the W3C traceparent header that continues this trace in
+// the service a request is sent to
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceID(), hex.EncodeToString(s.spanID[:]), flags)
+}
+
+// SetName renames the span, e.g. once the query it timed is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute records a string, bool, integer or float value on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError marks the span failed; nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export; later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if !s.sampled {
+		return
+	}
+	active.mu.RLock()
+	exporter := active.exporter
+	active.mu.RUnlock()
+	if exporter != nil {
+		exporter.add(s)
+	}
+}
@@ -0,0 +1,302 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ParquetColumnType is the type of a ParquetWriter column
+type ParquetColumnType int
+
+const (
+	ParquetInt64     ParquetColumnType = iota
+	ParquetDouble                      // float64
+	ParquetString                      // UTF-8
+	ParquetTimestamp                   // time.Time, stored as UTC milliseconds
+)
+
+// ParquetColumn describes one column of a ParquetWriter
+type ParquetColumn struct {
+	Name string
+	Type ParquetColumnType
+}
+
+// ParquetWriter writes a small, flat Parquet file: required columns, plain
+// encoding, no compression, one row group. Enough for report exports
+// without pulling in a Parquet library; rows are buffered until Close.
+type ParquetWriter struct {
+	w       io.Writer
+	columns []ParquetColumn
+	values  []bytes.Buffer // Plain-encoded values per column
+	rows    int
+}
+
+func NewParquetWriter(w io.Writer, columns []ParquetColumn) *ParquetWriter {
+	return &ParquetWriter{
+		w:       w,
+		columns: columns,
+		values:  make([]bytes.Buffer, len(columns)),
+	}
+}
+
+// Write appends a row; values must match the column types in order
+// (int64, float64, string, time.Time)
+func (p *ParquetWriter) Write(row ...interface{}) error {
+	if len(row) != len(p.columns) {
+		return fmt.Errorf("parquet: row has %d values, want %d", len(row), len(p.columns))
+	}
+	var scratch [8]byte
+	for i, column := range p.columns {
+		buf := &p.values[i]
+		switch column.Type {
+		case ParquetInt64:
+			v, ok := row[i].(int64)
+			if !ok {
+				return fmt.Errorf("parquet: column %s wants int64, got %T", column.Name, row[i])
+			}
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+			buf.Write(scratch[:])
+		case ParquetDouble:
+			v, ok := row[i].(float64)
+			if !ok {
+				return fmt.Errorf("parquet: column %s wants float64, got %T", column.Name, row[i])
+			}
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+			buf.Write(scratch[:])
+		case ParquetString:
+			v, ok := row[i].(string)
+			if !ok {
+				return fmt.Errorf("parquet: column %s wants string, got %T", column.Name, row[i])
+			}
+			binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+			buf.Write(scratch[:4])
+			buf.WriteString(v)
+		case ParquetTimestamp:
+			v, ok := row[i].(time.Time)
+			if !ok {
+				return fmt.Errorf("parquet: column %s wants time.Time, got %T", column.Name, row[i])
+			}
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v.UnixMilli()))
+			buf.Write(scratch[:])
+		}
+	}
+	p.rows++
+	return nil
+}
+
+// Parquet enums (parquet.thrift)
+const (
+	parquetTypeInt64     = 2
+	parquetTypeDouble    = 5
+	parquetTypeByteArray = 6
+
+	parquetRequired         = 0
+	parquetConvertedUTF8    = 0
+	parquetConvertedTSMilli = 9
+	parquetEncodingPlain    = 0
+	parquetEncodingRLE      = 3
+	parquetCodecNone        = 0
+	parquetDataPage         = 0
+)
+
+func (c ParquetColumn) physicalType() int32 {
+	switch c.Type {
+	case ParquetDouble:
+		return parquetTypeDouble
+	case ParquetString:
+		return parquetTypeByteArray
+	}
+	return parquetTypeInt64
+}
+
+// Close writes the file: magic, one data page per column, footer
+func (p *ParquetWriter) Close() error {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	type chunk struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunk, len(p.columns))
+	var totalSize int64
+	for i := range p.columns {
+		values := p.values[i].Bytes()
+
+		header := &thriftCompact{}
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(values)))
+		header.i32(3, int32(len(values)))
+		header.beginStruct(5)
+		header.i32(1, int32(p.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.stop()
+
+		chunks[i] = chunk{offset: int64(file.Len()), size: int64(header.buf.Len() + len(values))}
+		totalSize += chunks[i].size
+		file.Write(header.buf.Bytes())
+		file.Write(values)
+	}
+
+	meta := &thriftCompact{}
+	meta.i32(1, 1)
+	meta.beginList(2, thriftStruct, len(p.columns)+1)
+	meta.beginListStruct()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(p.columns)))
+	meta.endListStruct()
+	for _, column := range p.columns {
+		meta.beginListStruct()
+		meta.i32(1, column.physicalType())
+		meta.i32(3, parquetRequired)
+		meta.binary(4, column.Name)
+		switch column.Type {
+		case ParquetString:
+			meta.i32(6, parquetConvertedUTF8)
+		case ParquetTimestamp:
+			meta.i32(6, parquetConvertedTSMilli)
+		}
+		meta.endListStruct()
+	}
+	meta.i64(3, int64(p.rows))
+	meta.beginList(4, thriftStruct, 1)
+	meta.beginListStruct()
+	meta.beginList(1, thriftStruct, len(p.columns))
+	for i, column := range p.columns {
+		meta.beginListStruct()
+		meta.i64(2, chunks[i].offset)
+		meta.beginStruct(3)
+		meta.i32(1, column.physicalType())
+		meta.beginList(2, thriftI32, 2)
+		meta.listI32(parquetEncodingPlain)
+		meta.listI32(parquetEncodingRLE)
+		meta.beginList(3, thriftBinary, 1)
+		meta.listBinary(column.Name)
+		meta.i32(4, parquetCodecNone)
+		meta.i64(5, int64(p.rows))
+		meta.i64(6, chunks[i].size)
+		meta.i64(7, chunks[i].size)
+		meta.i64(9, chunks[i].offset)
+		meta.endStruct()
+		meta.endListStruct()
+	}
+	meta.i64(2, totalSize)
+	meta.i64(3, int64(p.rows))
+	meta.endListStruct()
+	meta.binary(6, "command-center-vms")
+	meta.stop()
+
+	file.Write(meta.buf.Bytes())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+	file.Write(length[:])
+	file.WriteString("PAR1")
+
+	_, err := p.w.Write(file.Bytes())
+	return err
+}
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftCompact encodes the subset of the Thrift compact protocol the
+// Parquet footer and page headers need
+type thriftCompact struct {
+	buf       bytes.Buffer
+	lastField int16
+	stack     []int16 // lastField of enclosing structs
+}
+
+func (t *thriftCompact) varint(v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	t.buf.Write(scratch[:n])
+}
+
+func (t *thriftCompact) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftCompact) field(id int16, kind byte) {
+	if delta := id - t.lastField; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.buf.WriteByte(kind)
+		t.zigzag(int64(id))
+	}
+	t.lastField = id
+}
+
+func (t *thriftCompact) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftCompact) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftCompact) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+func (t *thriftCompact) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.stack = append(t.stack, t.lastField)
+	t.lastField = 0
+}
+
+func (t *thriftCompact) endStruct() {
+	t.stop()
+	t.lastField = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftCompact) stop() {
+	t.buf.WriteByte(0)
+}
+
+func (t *thriftCompact) beginList(id int16, elem byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xF0 | elem)
+		t.varint(uint64(size))
+	}
+}
+
+// beginListStruct starts a struct element of a list
+func (t *thriftCompact) beginListStruct() {
+	t.stack = append(t.stack, t.lastField)
+	t.lastField = 0
+}
+
+func (t *thriftCompact) endListStruct() {
+	t.endStruct()
+}
+
+func (t *thriftCompact) listI32(v int32) {
+	t.zigzag(int64(v))
+}
+
+func (t *thriftCompact) listBinary(v string) {
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// EncryptSecret encrypts a value with AES-256-GCM using a key derived from
+// secret. The result is base64 and safe to store in a text column.
+func EncryptSecret(secret, plaintext string) (string, error) {
+	gcm, err := secretCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret
+func DecryptSecret(secret, ciphertext string) (string, error) {
+	gcm, err := secretCipher(secret)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid ciphertext")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret (wrong key?)")
+	}
+	return string(plaintext), nil
+}
+
+// DecryptSecretAny is DecryptSecret trying each key in turn, for values
+// encrypted before a key rotation
+func DecryptSecretAny(secrets []string, ciphertext string) (string, error) {
+	err := fmt.Errorf("no key to decrypt with")
+	for _, secret := range secrets {
+		var plaintext string
+		if plaintext, err = DecryptSecret(secret, ciphertext); err == nil {
+			return plaintext, nil
+		}
+	}
+	return "", err
+}
+
+func secretCipher(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}